@@ -0,0 +1,218 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"pesapal-ledger/engine"
+	"pesapal-ledger/storage"
+	"strconv"
+	"strings"
+)
+
+// maintenanceRetryAfter is the Retry-After hint (seconds) sent with writes
+// rejected during maintenance
+const maintenanceRetryAfter = "30"
+
+// MaintenanceRequest is the body of POST /admin/maintenance
+type MaintenanceRequest struct {
+	Enabled bool `json:"enabled"`
+}
+
+// requireAdmin checks the admin bearer token and writes the error response
+// when it is missing or wrong. Admin routes are disabled when no token is set.
+func (s *Server) requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if s.adminToken == "" {
+		writeJSON(w, http.StatusForbidden, SQLResponse{Success: false, Error: "Admin API disabled: LITELEDGER_ADMIN_TOKEN is not set"})
+		return false
+	}
+
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) != 1 {
+		writeJSON(w, http.StatusUnauthorized, SQLResponse{Success: false, Error: "Unauthorized"})
+		return false
+	}
+	return true
+}
+
+// handleMaintenance toggles maintenance mode, during which writes are
+// rejected with 503 while reads keep working
+func (s *Server) handleMaintenance(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.requireAdmin(w, r) {
+		return
+	}
+
+	var req MaintenanceRequest
+	if err := decodeStrict(r.Body, &req); err != nil {
+		writeJSON(w, http.StatusBadRequest, SQLResponse{Success: false, Error: "Invalid request body: " + err.Error() + `; expected {"enabled": true|false}`})
+		return
+	}
+
+	s.db.SetMaintenance(req.Enabled)
+	writeJSON(w, http.StatusOK, SQLResponse{
+		Success: true,
+		Data:    map[string]bool{"maintenance": s.db.InMaintenance()},
+	})
+}
+
+// handleTableStats serves planner statistics: GET /admin/stats/tables for
+// every table, or ?table=name for a single one
+func (s *Server) handleTableStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.requireAdmin(w, r) {
+		return
+	}
+
+	if name := r.URL.Query().Get("table"); name != "" {
+		stats, err := s.db.Stats(name)
+		if err != nil {
+			writeJSON(w, http.StatusNotFound, SQLResponse{Success: false, Error: err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, SQLResponse{Success: true, Data: stats})
+		return
+	}
+
+	all := make([]engine.TableStats, 0)
+	for _, name := range s.db.AllTables() {
+		stats, err := s.db.Stats(name)
+		if err != nil {
+			continue // dropped while we were iterating
+		}
+		all = append(all, stats)
+	}
+	writeJSON(w, http.StatusOK, SQLResponse{Success: true, Data: all})
+}
+
+// handleReindex rebuilds one table's index from its log:
+// POST /admin/reindex?table=name
+func (s *Server) handleReindex(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.requireAdmin(w, r) {
+		return
+	}
+
+	name := r.URL.Query().Get("table")
+	if name == "" {
+		writeJSON(w, http.StatusBadRequest, SQLResponse{Success: false, Error: "missing ?table=name"})
+		return
+	}
+	result, err := s.db.Reindex(name)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, engine.ErrTableNotFound) {
+			status = http.StatusNotFound
+		}
+		writeJSON(w, status, SQLResponse{Success: false, Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, SQLResponse{Success: true, Data: result})
+}
+
+// handleBackupTable streams a table's file as it is at the start of the
+// request: GET /admin/backup/table/{name}. Rows written while it streams
+// aren't included.
+func (s *Server) handleBackupTable(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.requireAdmin(w, r) {
+		return
+	}
+
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin/backup/table/"), "/")
+	if name == "" || strings.Contains(name, "/") {
+		writeJSON(w, http.StatusNotFound, SQLResponse{Success: false, Error: "Not found"})
+		return
+	}
+	backup, err := s.db.BackupTable(name)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, engine.ErrTableNotFound) {
+			status = http.StatusNotFound
+		}
+		writeJSON(w, status, SQLResponse{Success: false, Error: err.Error()})
+		return
+	}
+	defer backup.Close()
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.FormatInt(backup.Size, 10))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+".db"))
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, backup); err != nil {
+		// Too late for an error response; the client sees a short body
+		requestLogger(r).Warn("backup stream failed", "table", name, "error", err)
+	}
+}
+
+// handleRestoreTable replaces a table's file with the request body, a file
+// from GET /admin/backup/table/{name}: PUT /admin/restore/table/{name}.
+// A table that already holds data needs ?force=true.
+func (s *Server) handleRestoreTable(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.requireAdmin(w, r) {
+		return
+	}
+
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin/restore/table/"), "/")
+	if name == "" || strings.Contains(name, "/") {
+		writeJSON(w, http.StatusNotFound, SQLResponse{Success: false, Error: "Not found"})
+		return
+	}
+	force := false
+	if v := r.URL.Query().Get("force"); v != "" {
+		var err error
+		if force, err = strconv.ParseBool(v); err != nil {
+			writeJSON(w, http.StatusBadRequest, SQLResponse{Success: false, Error: "invalid ?force: expected true or false"})
+			return
+		}
+	}
+
+	result, err := s.db.RestoreTable(name, r.Body, force)
+	if err != nil {
+		if writeMaintenanceError(w, err) {
+			return
+		}
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, storage.ErrCorruptUpload):
+			status = http.StatusBadRequest
+		case errors.Is(err, engine.ErrTableNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, engine.ErrTableNotEmpty):
+			status = http.StatusConflict
+		}
+		requestLogger(r).Warn("restore failed", "table", name, "error", err)
+		writeJSON(w, status, SQLResponse{Success: false, Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, SQLResponse{Success: true, Data: result})
+}
+
+// writeMaintenanceError answers 503 with a retry hint if err came from the
+// maintenance gate. It reports whether it handled the error.
+func writeMaintenanceError(w http.ResponseWriter, err error) bool {
+	if !errors.Is(err, engine.ErrMaintenance) {
+		return false
+	}
+	w.Header().Set("Retry-After", maintenanceRetryAfter)
+	writeJSON(w, http.StatusServiceUnavailable, SQLResponse{Success: false, Error: err.Error()})
+	return true
+}
@@ -0,0 +1,444 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"pesapal-ledger/storage"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// testAdminToken is the admin token newAdminServer configures
+const testAdminToken = "test-admin-token"
+
+// newAdminServer is newTestServer with the admin API enabled
+func newAdminServer(t *testing.T, setup ...string) *Server {
+	t.Helper()
+	s := newTestServer(t, setup...)
+	s.adminToken = testAdminToken
+	return s
+}
+
+// serveAdmin is serve with the admin bearer token attached
+func serveAdmin(t *testing.T, handler http.HandlerFunc, method, target, body string) (*httptest.ResponseRecorder, SQLResponse) {
+	t.Helper()
+	return serve(t, func(w http.ResponseWriter, r *http.Request) {
+		r.Header.Set("Authorization", "Bearer "+testAdminToken)
+		handler(w, r)
+	}, method, target, body)
+}
+
+func TestMaintenanceMode(t *testing.T) {
+	s := newAdminServer(t,
+		"CREATE TABLE users (id int, name text)",
+		"INSERT INTO users VALUES (1, alice)",
+	)
+
+	rec, resp := serve(t, s.handleMaintenance, http.MethodPost, "/admin/maintenance", `{"enabled": true}`)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("without a token: status %d (%s), want 401", rec.Code, resp.Error)
+	}
+	rec, resp = serveAdmin(t, s.handleMaintenance, http.MethodPost, "/admin/maintenance", `{"on": true}`)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("unknown field: status %d (%s), want 400", rec.Code, resp.Error)
+	}
+	rec, resp = serveAdmin(t, s.handleMaintenance, http.MethodPost, "/admin/maintenance", `{"enabled": true}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("enable: status %d (%s)", rec.Code, resp.Error)
+	}
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		method  string
+		target  string
+		body    string
+		want    int
+	}{
+		{"SQL insert", s.handleSQL, http.MethodPost, "/sql", `{"query": "INSERT INTO users VALUES (2, bob)"}`, http.StatusServiceUnavailable},
+		{"SQL update", s.handleSQL, http.MethodPost, "/sql", `{"query": "UPDATE users SET name = carol WHERE id = 1"}`, http.StatusServiceUnavailable},
+		{"SQL delete", s.handleSQL, http.MethodPost, "/sql", `{"query": "DELETE FROM users WHERE id = 1"}`, http.StatusServiceUnavailable},
+		{"REST create", s.handleTableRows, http.MethodPost, "/tables/users/rows", `{"id": 3, "name": "dave"}`, http.StatusServiceUnavailable},
+		{"REST delete", s.handleTableRows, http.MethodDelete, "/tables/users/rows/1", "", http.StatusServiceUnavailable},
+		{"SQL select", s.handleSQL, http.MethodPost, "/sql", `{"query": "SELECT * FROM users"}`, http.StatusOK},
+		{"REST get", s.handleTableRows, http.MethodGet, "/tables/users/rows/1", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec, resp := serve(t, tt.handler, tt.method, tt.target, tt.body)
+			if rec.Code != tt.want {
+				t.Fatalf("status %d (%s), want %d", rec.Code, resp.Error, tt.want)
+			}
+			if tt.want == http.StatusServiceUnavailable && rec.Header().Get("Retry-After") == "" {
+				t.Error("no Retry-After hint on a write rejected for maintenance")
+			}
+		})
+	}
+
+	rec, resp = serveAdmin(t, s.handleMaintenance, http.MethodPost, "/admin/maintenance", `{"enabled": false}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("disable: status %d (%s)", rec.Code, resp.Error)
+	}
+	rec, resp = serve(t, s.handleSQL, http.MethodPost, "/sql", `{"query": "INSERT INTO users VALUES (2, bob)"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("insert after maintenance: status %d (%s)", rec.Code, resp.Error)
+	}
+	rec, resp = serve(t, s.handleSQL, http.MethodPost, "/sql", `{"query": "SELECT name FROM users WHERE id = 1"}`)
+	if rows, _ := resp.Data.([]interface{}); rec.Code != http.StatusOK || len(rows) != 1 || rows[0].([]interface{})[0] != "alice" {
+		t.Errorf("rows changed during maintenance: %v", resp.Data)
+	}
+}
+
+func TestServerStats(t *testing.T) {
+	s := newAdminServer(t,
+		"CREATE TABLE users (id int, name text)",
+		"CREATE TABLE __migrations (version int)",
+	)
+
+	stats := func() ServerStats {
+		t.Helper()
+		rec, resp := serveAdmin(t, s.handleServerStats, http.MethodGet, "/admin/stats", "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET /admin/stats: status %d (%s)", rec.Code, resp.Error)
+		}
+		var stats ServerStats
+		data, _ := json.Marshal(resp.Data)
+		if err := json.Unmarshal(data, &stats); err != nil {
+			t.Fatal(err)
+		}
+		return stats
+	}
+
+	before := stats()
+	if before.Queries != 0 || before.Errors != 0 || before.Tables != 2 || before.LiveRows != 0 {
+		t.Fatalf("initial stats = %+v", before)
+	}
+
+	requests := []struct {
+		handler http.HandlerFunc
+		target  string
+		body    string
+		queries int64 // counted so far
+	}{
+		{s.handleSQL, "/sql", `{"query": "INSERT INTO users VALUES (1, alice)"}`, 1},
+		{s.handleSQL, "/sql", `{"query": "insert into users values (2, bob)"}`, 2},
+		{s.handleSQL, "/sql", `{"query": "INSERT INTO users VALUES (1, carol)"}`, 3},
+		{s.handleSQL, "/sql", `{"query": "SELECT * FROM users"}`, 4},
+		{s.handleSQL, "/sql", `{"query": "SELECT * FROM nope"}`, 5},
+		{s.handleSQL, "/sql", `{"querry": "SELECT * FROM users"}`, 6},
+		// Each statement of a batch counts as a query
+		{s.handleSQLBatch, "/sql/batch", `{"query": "DELETE FROM users WHERE id = 2; SELECT name FROM users"}`, 8},
+	}
+	for _, req := range requests {
+		serve(t, req.handler, http.MethodPost, req.target, req.body)
+		if got := stats().Queries; got != req.queries {
+			t.Fatalf("after %s: %d queries, want %d", req.body, got, req.queries)
+		}
+	}
+
+	after := stats()
+	wantByType := map[string]int64{"INSERT": 3, "SELECT": 3, "DELETE": 1, "OTHER": 1}
+	wantErrors := map[string]int64{"INSERT": 1, "SELECT": 1, "OTHER": 1}
+	if after.Queries != 8 || after.Errors != 3 ||
+		!reflect.DeepEqual(after.QueriesByType, wantByType) || !reflect.DeepEqual(after.ErrorsByType, wantErrors) {
+		t.Errorf("counters = %d queries %v, %d errors %v; want 8 %v, 3 %v",
+			after.Queries, after.QueriesByType, after.Errors, after.ErrorsByType, wantByType, wantErrors)
+	}
+	if after.Tables != 2 || after.LiveRows != 1 {
+		t.Errorf("tables = %d, live rows = %d; want 2 and 1", after.Tables, after.LiveRows)
+	}
+	if !after.StartedAt.Equal(before.StartedAt) || after.UptimeSeconds < before.UptimeSeconds {
+		t.Errorf("uptime went from %v (%v) to %v (%v)", before.StartedAt, before.UptimeSeconds, after.StartedAt, after.UptimeSeconds)
+	}
+
+	// Resetting needs the token and zeroes the counters but not the uptime
+	if rec, _ := serve(t, s.handleServerStatsReset, http.MethodPost, "/admin/stats/reset", ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("reset without a token: status %d, want 401", rec.Code)
+	}
+	if got := stats(); got.Queries != 8 {
+		t.Fatalf("the refused reset cleared the counters: %+v", got)
+	}
+	if rec, resp := serveAdmin(t, s.handleServerStatsReset, http.MethodPost, "/admin/stats/reset", ""); rec.Code != http.StatusOK {
+		t.Fatalf("reset: status %d (%s)", rec.Code, resp.Error)
+	}
+	reset := stats()
+	if reset.Queries != 0 || reset.Errors != 0 || len(reset.QueriesByType) != 0 || len(reset.ErrorsByType) != 0 {
+		t.Errorf("after reset = %+v", reset)
+	}
+	if !reset.StartedAt.Equal(before.StartedAt) || !reset.CountersSince.After(after.CountersSince) || reset.LiveRows != 1 {
+		t.Errorf("after reset: started %v, counters since %v, live rows %d", reset.StartedAt, reset.CountersSince, reset.LiveRows)
+	}
+
+	serve(t, s.handleSQL, http.MethodPost, "/sql", `{"query": "SELECT * FROM users"}`)
+	if got := stats(); got.Queries != 1 || got.QueriesByType["SELECT"] != 1 {
+		t.Errorf("counting after the reset: %+v", got)
+	}
+}
+
+func TestTableStatsSizes(t *testing.T) {
+	s := newAdminServer(t,
+		"CREATE TABLE users (id int, name text)",
+		"CREATE TABLE empty (id int)",
+		"INSERT INTO users VALUES (1, alice)",
+		"INSERT INTO users VALUES (2, bob)",
+		"UPDATE users SET name = carol WHERE id = 1",
+	)
+
+	tests := []struct {
+		target     string
+		wantStatus int
+		wantTables []string
+		wantDead   bool // users has dead bytes
+	}{
+		{"/admin/stats/tables?table=users", http.StatusOK, []string{"users"}, true},
+		{"/admin/stats/tables?table=empty", http.StatusOK, []string{"empty"}, false},
+		{"/admin/stats/tables", http.StatusOK, []string{"empty", "users"}, true},
+		{"/admin/stats/tables?table=nope", http.StatusNotFound, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			rec, resp := serveAdmin(t, s.handleTableStats, http.MethodGet, tt.target, "")
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status %d (%s), want %d", rec.Code, resp.Error, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			data, _ := json.Marshal(resp.Data)
+			if data[0] == '{' {
+				data = append(append([]byte("["), data...), ']')
+			}
+			var all []struct {
+				Table     string `json:"table"`
+				LiveBytes int64  `json:"liveBytes"`
+				DeadBytes int64  `json:"deadBytes"`
+				FileBytes int64  `json:"fileBytes"`
+			}
+			if err := json.Unmarshal(data, &all); err != nil {
+				t.Fatal(err)
+			}
+			var tables []string
+			for _, stats := range all {
+				tables = append(tables, stats.Table)
+				if stats.LiveBytes+stats.DeadBytes != stats.FileBytes {
+					t.Errorf("%s: live %d + dead %d bytes, file %d", stats.Table, stats.LiveBytes, stats.DeadBytes, stats.FileBytes)
+				}
+				if stats.Table == "users" && (stats.DeadBytes > 0) != tt.wantDead {
+					t.Errorf("users: %d dead bytes", stats.DeadBytes)
+				}
+			}
+			if !reflect.DeepEqual(tables, tt.wantTables) {
+				t.Errorf("tables = %v, want %v", tables, tt.wantTables)
+			}
+		})
+	}
+}
+
+func TestReindex(t *testing.T) {
+	s := newAdminServer(t,
+		"CREATE TABLE users (id int, name text)",
+		"INSERT INTO users VALUES (1, alice)",
+		"INSERT INTO users VALUES (2, bob)",
+	)
+
+	// Change the log behind the engine's back: delete 1, update 2, add 3
+	for _, row := range [][]string{{"1", "0", "alice"}, {"2", "1", "bobby"}, {"3", "1", "carol"}} {
+		if _, err := storage.AppendRow("users", row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	names := func() []interface{} {
+		t.Helper()
+		_, resp := serve(t, s.handleSQL, http.MethodPost, "/sql", `{"query": "SELECT name FROM users WHERE id >= 1"}`)
+		var out []interface{}
+		for _, row := range resp.Data.([]interface{}) {
+			out = append(out, row.([]interface{})[0])
+		}
+		return out
+	}
+	if got, want := names(), []interface{}{"alice", "bob"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("before the reindex = %v, want the stale %v", got, want)
+	}
+
+	tests := []struct {
+		name   string
+		admin  bool
+		method string
+		target string
+		status int
+		want   interface{}
+	}{
+		{"without a token", false, http.MethodPost, "/admin/reindex?table=users", http.StatusUnauthorized, nil},
+		{"missing table", true, http.MethodPost, "/admin/reindex", http.StatusBadRequest, nil},
+		{"unknown table", true, http.MethodPost, "/admin/reindex?table=nope", http.StatusNotFound, nil},
+		{"rebuild", true, http.MethodPost, "/admin/reindex?table=users", http.StatusOK,
+			map[string]interface{}{"table": "users", "liveRows": float64(2), "previousLiveRows": float64(2)}},
+		{"again", true, http.MethodPost, "/admin/reindex?table=users", http.StatusOK,
+			map[string]interface{}{"table": "users", "liveRows": float64(2), "previousLiveRows": float64(2)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			send := serve
+			if tt.admin {
+				send = serveAdmin
+			}
+			rec, resp := send(t, s.handleReindex, tt.method, tt.target, "")
+			if rec.Code != tt.status {
+				t.Fatalf("status %d (%s), want %d", rec.Code, resp.Error, tt.status)
+			}
+			if tt.want == nil {
+				if resp.Success {
+					t.Errorf("response = %+v, want an error", resp)
+				}
+				return
+			}
+			if !reflect.DeepEqual(resp.Data, tt.want) {
+				t.Errorf("data = %#v, want %#v", resp.Data, tt.want)
+			}
+		})
+	}
+
+	if got, want := names(), []interface{}{"bobby", "carol"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after the reindex = %v, want %v", got, want)
+	}
+	rec, resp := serve(t, s.handleSQL, http.MethodPost, "/sql", `{"query": "INSERT INTO users VALUES (3, dave)"}`)
+	if rec.Code != http.StatusConflict {
+		t.Errorf("inserting the out-of-band key: status %d (%s), want 409", rec.Code, resp.Error)
+	}
+}
+
+func TestBackupTableEndpoint(t *testing.T) {
+	s := newAdminServer(t,
+		"CREATE TABLE ledger (id int, memo text)",
+		"CREATE TABLE sales.ledger (id int, memo text)",
+		"CREATE TABLE empty (id int)",
+		"INSERT INTO ledger VALUES (1, alpha)",
+		"INSERT INTO ledger VALUES (2, beta)",
+		"UPDATE ledger SET memo = bravo WHERE id = 2",
+		"INSERT INTO sales.ledger VALUES (7, gamma)",
+	)
+
+	tests := []struct {
+		method     string
+		target     string
+		token      bool
+		wantStatus int
+		wantFile   string // table whose file the body must be
+	}{
+		{http.MethodGet, "/admin/backup/table/ledger", true, http.StatusOK, "ledger"},
+		{http.MethodGet, "/admin/backup/table/sales.ledger", true, http.StatusOK, "sales.ledger"},
+		{http.MethodGet, "/admin/backup/table/empty", true, http.StatusOK, "empty"},
+		{http.MethodGet, "/admin/backup/table/ledger", false, http.StatusUnauthorized, ""},
+		{http.MethodGet, "/admin/backup/table/nope", true, http.StatusNotFound, ""},
+		{http.MethodGet, "/admin/backup/table/", true, http.StatusNotFound, ""},
+		{http.MethodGet, "/admin/backup/table/a/b", true, http.StatusNotFound, ""},
+		{http.MethodPost, "/admin/backup/table/ledger", true, http.StatusMethodNotAllowed, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.target, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, nil)
+			if tt.token {
+				req.Header.Set("Authorization", "Bearer "+testAdminToken)
+			}
+			rec := httptest.NewRecorder()
+			s.handleBackupTable(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status %d (%s), want %d", rec.Code, rec.Body.String(), tt.wantStatus)
+			}
+			if tt.wantFile == "" {
+				return
+			}
+			file, err := os.ReadFile(storage.TableFilePath(tt.wantFile))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(rec.Body.Bytes(), file) {
+				t.Errorf("body is %d bytes, want the %d bytes of the table file", rec.Body.Len(), len(file))
+			}
+			if got := rec.Header().Get("Content-Length"); got != strconv.Itoa(len(file)) {
+				t.Errorf("Content-Length = %s, want %d", got, len(file))
+			}
+			if got := rec.Header().Get("Content-Type"); got != "application/octet-stream" {
+				t.Errorf("Content-Type = %s", got)
+			}
+		})
+	}
+}
+
+func TestRestoreTableEndpoint(t *testing.T) {
+	// Back a table up from one server...
+	source := newAdminServer(t,
+		"CREATE TABLE ledger (id int, memo text)",
+		"INSERT INTO ledger VALUES (1, alpha)",
+		"INSERT INTO ledger VALUES (2, beta)",
+		"UPDATE ledger SET memo = bravo WHERE id = 2",
+	)
+	req := httptest.NewRequest(http.MethodGet, "/admin/backup/table/ledger", nil)
+	req.Header.Set("Authorization", "Bearer "+testAdminToken)
+	rec := httptest.NewRecorder()
+	source.handleBackupTable(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("backup: status %d (%s)", rec.Code, rec.Body.String())
+	}
+	backup := rec.Body.String()
+	corrupt := strings.Replace(backup, "alpha", "alpho", 1)
+
+	// ...and restore it into another
+	s := newAdminServer(t,
+		"CREATE TABLE ledger (id int, memo text)",
+		"CREATE TABLE other (id int, memo text)",
+	)
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		body       string
+		token      bool
+		wantStatus int
+		wantRows   int // live rows of ledger afterwards
+	}{
+		{"no token", http.MethodPut, "/admin/restore/table/ledger", backup, false, http.StatusUnauthorized, 0},
+		{"wrong method", http.MethodPost, "/admin/restore/table/ledger", backup, true, http.StatusMethodNotAllowed, 0},
+		{"unknown table", http.MethodPut, "/admin/restore/table/nope", backup, true, http.StatusNotFound, 0},
+		{"corrupt upload", http.MethodPut, "/admin/restore/table/ledger", corrupt, true, http.StatusBadRequest, 0},
+		{"restore", http.MethodPut, "/admin/restore/table/ledger", backup, true, http.StatusOK, 2},
+		{"again without force", http.MethodPut, "/admin/restore/table/ledger", backup, true, http.StatusConflict, 2},
+		{"bad force", http.MethodPut, "/admin/restore/table/ledger?force=yes please", backup, true, http.StatusBadRequest, 2},
+		{"corrupt upload over rows", http.MethodPut, "/admin/restore/table/ledger?force=true", corrupt, true, http.StatusBadRequest, 2},
+		{"again with force", http.MethodPut, "/admin/restore/table/ledger?force=true", backup, true, http.StatusOK, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, strings.ReplaceAll(tt.target, " ", "%20"), strings.NewReader(tt.body))
+			if tt.token {
+				req.Header.Set("Authorization", "Bearer "+testAdminToken)
+			}
+			rec := httptest.NewRecorder()
+			s.handleRestoreTable(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status %d (%s), want %d", rec.Code, rec.Body.String(), tt.wantStatus)
+			}
+			rows, err := s.db.SelectAll("ledger")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rows) != tt.wantRows {
+				t.Errorf("ledger holds %d rows, want %d", len(rows), tt.wantRows)
+			}
+		})
+	}
+
+	_, resp := serve(t, s.handleSQL, http.MethodPost, "/sql", `{"query": "SELECT memo FROM ledger WHERE id = 2"}`)
+	if got, _ := json.Marshal(resp.Data); string(got) != `[["bravo"]]` {
+		t.Errorf("restored row = %s (%s), want bravo", got, resp.Error)
+	}
+	s.db.SetMaintenance(true)
+	if rec, resp := serveAdmin(t, s.handleRestoreTable, http.MethodPut, "/admin/restore/table/ledger?force=true", backup); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("in maintenance: status %d (%s), want 503", rec.Code, resp.Error)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"pesapal-ledger/parser"
+)
+
+// handleSQLBatch runs the semicolon-separated statements of one request body
+// ({"query": "INSERT ...; INSERT ..."}) in order and answers with the result
+// of each, so a bulk load costs one round trip. A failing statement doesn't
+// stop the ones after it; its result carries the error. Statements are
+// authorized and counted one by one, as if each had been sent to /sql.
+func (s *Server) handleSQLBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req SQLRequest
+	if err := decodeStrict(r.Body, &req); err != nil {
+		s.counters.record("", true)
+		writeResponse(w, r, http.StatusBadRequest, SQLResponse{Success: false, Error: "Invalid request body: " + err.Error()})
+		return
+	}
+
+	results, err := parser.ParseSQLBatchAuthorized(r.Context(), req.Query, s.db, s.authorize)
+	if err == nil && len(results) == 0 {
+		err = fmt.Errorf("query cannot be empty")
+	}
+	if err != nil {
+		s.counters.record(req.Query, true)
+		writeResponse(w, r, http.StatusBadRequest, SQLResponse{Success: false, Error: err.Error()})
+		return
+	}
+
+	failed := 0
+	for _, result := range results {
+		s.counters.record(result.Statement, !result.Success)
+		if !result.Success {
+			failed++
+			requestLogger(r).Warn("query failed", "query", result.Statement, "error", result.Error)
+		}
+	}
+
+	resp := SQLResponse{Success: true, Data: results}
+	if failed > 0 {
+		resp.Warning = fmt.Sprintf("%d of %d statements failed (see the error of each)", failed, len(results))
+	}
+	writeResponse(w, r, http.StatusOK, resp)
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestSQLBatchMalformedStatement(t *testing.T) {
+	s := newTestServer(t, "CREATE TABLE users (id int, name text)")
+
+	rec, resp := serve(t, s.handleSQLBatch, http.MethodPost, "/sql/batch",
+		`{"query": "INSERT INTO users VALUES (1, alice);INSERT INTO;INSERT INTO users VALUES (2, bob)"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d (%s), want 200", rec.Code, resp.Error)
+	}
+	results, _ := resp.Data.([]interface{})
+	if len(results) != 3 {
+		t.Fatalf("got %d results, want one per statement: %v", len(results), resp.Data)
+	}
+	for i, wantSuccess := range []bool{true, false, true} {
+		result := results[i].(map[string]interface{})
+		if result["success"] != wantSuccess {
+			t.Errorf("statement %d (%v): success = %v, want %v (%v)", i+1, result["statement"], result["success"], wantSuccess, result["error"])
+		}
+	}
+	if resp.Warning == "" {
+		t.Error("no warning about the failed statement")
+	}
+
+	rec, resp = serve(t, s.handleSQL, http.MethodPost, "/sql", `{"query": "SELECT * FROM users"}`)
+	if rows, _ := resp.Data.([]interface{}); rec.Code != http.StatusOK || len(rows) != 2 {
+		t.Errorf("SELECT after the batch = %v (%s), want both rows", resp.Data, resp.Error)
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"pesapal-ledger/engine"
+	"sort"
+	"strings"
+)
+
+// maxImportErrors caps the row errors listed in an import report; the rest
+// are only counted
+const maxImportErrors = 1000
+
+// maxImportSize caps the CSV body of an import, which is held in memory
+// until its rows are inserted
+const maxImportSize = 64 << 20
+
+// ImportReport is the outcome of a CSV import
+type ImportReport struct {
+	Table    string           `json:"table"`
+	Imported int              `json:"imported"`
+	Failed   int              `json:"failed"`
+	Errors   []ImportRowError `json:"errors,omitempty"`
+}
+
+// ImportRowError is a CSV row that wasn't imported. Line is its line number
+// in the file, the header being line 1.
+type ImportRowError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+func (rep *ImportReport) fail(line int, err error) {
+	rep.Failed++
+	if len(rep.Errors) < maxImportErrors {
+		rep.Errors = append(rep.Errors, ImportRowError{Line: line, Error: err.Error()})
+	}
+}
+
+// importCSV handles POST /tables/{name}/import. The body is CSV whose first
+// line names the columns, in any order; a serial id column may be left out.
+// The whole file, up to maxImportSize, is read and turned into rows before
+// the transaction begins, so a slow upload doesn't hold up other writers;
+// the rows are then inserted inside a single transaction. ?on_error=abort
+// (the default) rolls the whole import back at the first bad row and answers
+// 400 naming its line. ?on_error=continue skips bad rows, commits the others
+// and lists each skipped line with its error. A storage failure aborts the
+// import in either mode.
+func (s *Server) importCSV(w http.ResponseWriter, r *http.Request, metadata engine.TableMetadata) {
+	mode := r.URL.Query().Get("on_error")
+	switch mode {
+	case "":
+		mode = "abort"
+	case "abort", "continue":
+	default:
+		writeJSON(w, http.StatusBadRequest, SQLResponse{Success: false, Error: fmt.Sprintf("invalid on_error %q: expected abort or continue", mode)})
+		return
+	}
+
+	reader := csv.NewReader(http.MaxBytesReader(w, r.Body, maxImportSize))
+	reader.FieldsPerRecord = -1 // a short or long row fails on its own
+	header, err := reader.Read()
+	if err == io.EOF {
+		err = fmt.Errorf("empty file: expected a header line naming the columns")
+	}
+	if err == nil {
+		err = checkImportHeader(metadata, header)
+	}
+	if err != nil {
+		if writeImportReadError(w, err) {
+			return
+		}
+		writeJSON(w, http.StatusBadRequest, SQLResponse{Success: false, Error: "Invalid CSV header: " + err.Error()})
+		return
+	}
+
+	report := ImportReport{Table: metadata.Name}
+	var rows []importRow
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		var line int
+		var parseErr *csv.ParseError
+		if err == nil {
+			line, _ = reader.FieldPos(0)
+		} else if errors.As(err, &parseErr) {
+			line = parseErr.Line
+		} else {
+			if !writeImportReadError(w, err) {
+				writeJSON(w, http.StatusBadRequest, SQLResponse{Success: false, Error: "Failed to read CSV: " + err.Error()})
+			}
+			return
+		}
+		var row []string
+		if err == nil {
+			row, err = importRecord(metadata, header, record)
+		}
+		if err == nil {
+			rows = append(rows, importRow{line: line, row: row})
+			continue
+		}
+
+		report.fail(line, err)
+		if mode == "abort" {
+			writeImportAbort(w, report, line, err)
+			return
+		}
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		writeImportError(w, err)
+		return
+	}
+	defer tx.Rollback() // unless committed
+
+	for _, row := range rows {
+		err := insertImported(tx, metadata, row.row)
+		if err == nil {
+			report.Imported++
+			continue
+		}
+		if !isRowError(err) {
+			writeImportError(w, err)
+			return
+		}
+
+		report.fail(row.line, err)
+		if mode == "abort" {
+			report.Imported = 0
+			writeImportAbort(w, report, row.line, err)
+			return
+		}
+	}
+	// Lines skipped while reading come before the ones that failed to insert
+	sort.SliceStable(report.Errors, func(i, j int) bool { return report.Errors[i].Line < report.Errors[j].Line })
+
+	if err := tx.Commit(); err != nil {
+		writeImportError(w, err)
+		return
+	}
+	resp := SQLResponse{Success: true, Data: report}
+	if report.Failed > 0 {
+		resp.Warning = fmt.Sprintf("%d rows failed to import (see errors)", report.Failed)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// importRow is a CSV record turned into a stored row, with its line number
+type importRow struct {
+	line int
+	row  []string
+}
+
+// isRowError reports whether an insert failed because of the row itself, a
+// value or key the client sent, rather than the storage. Only those are
+// skipped with ?on_error=continue.
+func isRowError(err error) bool {
+	status := sqlErrorStatus(err)
+	return status == http.StatusBadRequest || status == http.StatusConflict
+}
+
+// writeImportAbort answers an import aborted at a bad row
+func writeImportAbort(w http.ResponseWriter, report ImportReport, line int, err error) {
+	writeJSON(w, sqlErrorStatus(err), SQLResponse{
+		Success: false,
+		Data:    report,
+		Error:   fmt.Sprintf("line %d: %v (nothing was imported; add ?on_error=continue to skip bad rows)", line, err),
+	})
+}
+
+// writeImportReadError answers a body over maxImportSize with 413 and
+// reports whether err was that
+func writeImportReadError(w http.ResponseWriter, err error) bool {
+	var tooLarge *http.MaxBytesError
+	if !errors.As(err, &tooLarge) {
+		return false
+	}
+	writeJSON(w, http.StatusRequestEntityTooLarge, SQLResponse{Success: false, Error: fmt.Sprintf("CSV file is larger than %d bytes; split it into several imports", maxImportSize)})
+	return true
+}
+
+// writeImportError answers a failure to begin or commit the import. Nothing
+// the client sent causes those, so what sqlErrorStatus would call a bad
+// request is a 500 here; a full disk is still 507.
+func writeImportError(w http.ResponseWriter, err error) {
+	if writeMaintenanceError(w, err) {
+		return
+	}
+	status := sqlErrorStatus(err)
+	if status == http.StatusBadRequest {
+		status = http.StatusInternalServerError
+	}
+	writeJSON(w, status, SQLResponse{Success: false, Error: err.Error()})
+}
+
+// checkImportHeader checks that every header name is a column of the table,
+// named once
+func checkImportHeader(metadata engine.TableMetadata, header []string) error {
+	schema := metadata.Schema()
+	names := make([]string, len(schema))
+	for i, col := range schema {
+		names[i] = col.Name
+	}
+	seen := make(map[int]bool, len(header))
+	for _, name := range header {
+		pos, err := engine.ResolveColumn(metadata.Name, names, strings.TrimSpace(name))
+		if err != nil {
+			return err
+		}
+		if seen[pos] {
+			return fmt.Errorf("column %s is given more than once", names[pos])
+		}
+		seen[pos] = true
+	}
+	return nil
+}
+
+// importRecord turns one CSV record into a row to insert
+func importRecord(metadata engine.TableMetadata, header, record []string) ([]string, error) {
+	if len(record) != len(header) {
+		return nil, fmt.Errorf("expected %d values, got %d", len(header), len(record))
+	}
+	body := make(map[string]interface{}, len(header))
+	for i, name := range header {
+		body[strings.TrimSpace(name)] = record[i]
+	}
+	return rowFromObject(metadata, body)
+}
+
+// insertImported inserts one imported row inside tx. A row whose key already
+// exists fails, as a POST to /tables/{name}/rows would.
+func insertImported(tx *engine.Tx, metadata engine.TableMetadata, row []string) error {
+	inserted, err := tx.UpsertRow(metadata.Name, row, nil)
+	if err != nil {
+		return err
+	}
+	if !inserted {
+		return fmt.Errorf("record with id %s already exists in table %s", strings.Join(metadata.KeyValues(row), ", "), metadata.Name)
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"pesapal-ledger/engine"
+	"pesapal-ledger/parser"
+	"pesapal-ledger/storage"
+)
+
+func TestImportCSV(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string // after /tables/ledger/import
+		csv     string
+		status  int
+		report  ImportReport
+		wantErr string   // in the response's error
+		want    []string // "id merchant amount" of the rows afterwards
+	}{
+		{
+			name:   "columns in any order",
+			csv:    "amount,id,merchant\n5,1,acme\n7,2,globex\n",
+			status: http.StatusOK,
+			report: ImportReport{Table: "ledger", Imported: 2},
+			want:   []string{"1 acme 5", "2 globex 7", "10 initech 1"},
+		},
+		{
+			// A text table can't store the newline, and the row after it is
+			// reported by its own line
+			name:   "quoted values over several lines",
+			csv:    "id,merchant,amount\n1,\"acme, inc\",5\n2,\"two\nlines\",6\n3,x,seven\n",
+			query:  "?on_error=continue",
+			status: http.StatusOK,
+			report: ImportReport{Table: "ledger", Imported: 1, Failed: 2, Errors: []ImportRowError{{Line: 3}, {Line: 5}}},
+			want:   []string{"1 acme, inc 5", "10 initech 1"},
+		},
+		{
+			name:    "abort at the first bad row",
+			csv:     "id,merchant,amount\n1,acme,5\n2,globex,lots\n3,initech,9\n",
+			status:  http.StatusBadRequest,
+			report:  ImportReport{Table: "ledger", Failed: 1, Errors: []ImportRowError{{Line: 3}}},
+			wantErr: "line 3: ",
+			want:    []string{"10 initech 1"},
+		},
+		{
+			name:   "continue past bad rows",
+			query:  "?on_error=continue",
+			csv:    "id,merchant,amount\n1,acme,5\n2,globex,lots\n10,dup,1\n3,short\n4,hooli,9\n",
+			status: http.StatusOK,
+			report: ImportReport{Table: "ledger", Imported: 2, Failed: 3, Errors: []ImportRowError{{Line: 3}, {Line: 4}, {Line: 5}}},
+			want:   []string{"1 acme 5", "4 hooli 9", "10 initech 1"},
+		},
+		{
+			name:   "a key repeated in the file",
+			query:  "?on_error=continue",
+			csv:    "id,merchant,amount\n1,acme,5\n1,again,6\n",
+			status: http.StatusOK,
+			report: ImportReport{Table: "ledger", Imported: 1, Failed: 1, Errors: []ImportRowError{{Line: 3}}},
+			want:   []string{"1 acme 5", "10 initech 1"},
+		},
+		{
+			name:   "header only",
+			csv:    "id,merchant,amount\n",
+			status: http.StatusOK,
+			report: ImportReport{Table: "ledger"},
+			want:   []string{"10 initech 1"},
+		},
+		{name: "empty file", csv: "", status: http.StatusBadRequest, wantErr: "empty file", want: []string{"10 initech 1"}},
+		{name: "unknown column", csv: "id,nope\n1,x\n", status: http.StatusBadRequest, wantErr: "Invalid CSV header", want: []string{"10 initech 1"}},
+		{name: "column given twice", csv: "id,merchant,ID\n1,x,1\n", status: http.StatusBadRequest, wantErr: "column id is given more than once", want: []string{"10 initech 1"}},
+		{name: "unknown mode", query: "?on_error=skip", csv: "id\n1\n", status: http.StatusBadRequest, wantErr: `invalid on_error "skip"`, want: []string{"10 initech 1"}},
+		{name: "over the size cap", csv: "id,merchant,amount\n1,acme,5\n2," + strings.Repeat("x", maxImportSize) + ",6\n",
+			status: http.StatusRequestEntityTooLarge, wantErr: "CSV file is larger than", want: []string{"10 initech 1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t,
+				"CREATE TABLE ledger (id int, merchant text, amount int)",
+				"INSERT INTO ledger VALUES (10, initech, 1)",
+			)
+			rec, resp := serve(t, s.handleTableRows, http.MethodPost, "/tables/ledger/import"+tt.query, tt.csv)
+			if rec.Code != tt.status {
+				t.Fatalf("status %d (%s), want %d", rec.Code, resp.Error, tt.status)
+			}
+			if !strings.Contains(resp.Error, tt.wantErr) {
+				t.Errorf("error = %q, want it to contain %q", resp.Error, tt.wantErr)
+			}
+			if tt.report.Table != "" {
+				var report ImportReport
+				data, _ := json.Marshal(resp.Data)
+				if err := json.Unmarshal(data, &report); err != nil {
+					t.Fatal(err)
+				}
+				for i := range report.Errors {
+					if report.Errors[i].Error == "" {
+						t.Errorf("line %d is listed without its error", report.Errors[i].Line)
+					}
+					report.Errors[i].Error = ""
+				}
+				if !reflect.DeepEqual(report, tt.report) {
+					t.Errorf("report = %+v, want %+v", report, tt.report)
+				}
+				if (report.Failed > 0 && rec.Code == http.StatusOK) != (resp.Warning != "") {
+					t.Errorf("warning = %q with %d failures", resp.Warning, report.Failed)
+				}
+			}
+
+			result, err := parser.Execute(s.db, "SELECT id, merchant, amount FROM ledger ORDER BY id")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, row := range result.([][]interface{}) {
+				got = append(got, fmt.Sprintf("%v %v %v", row...))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("rows = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestImportSkipsOnlyRowErrors(t *testing.T) {
+	tests := []struct {
+		err  error
+		skip bool
+	}{
+		{errors.New(`invalid value "x" for column amount: expected int`), true},
+		{fmt.Errorf("record with id 9 %w in table orders", engine.ErrDuplicateKey), true},
+		{fmt.Errorf("failed to append row: %w", storage.ErrDiskFull), false},
+		{fmt.Errorf("%w: orders (data file missing)", engine.ErrTableDegraded), false},
+		{engine.TableNotExist("orders"), false},
+		{engine.ErrShuttingDown, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.err.Error(), func(t *testing.T) {
+			if got := isRowError(tt.err); got != tt.skip {
+				t.Errorf("isRowError = %v, want %v", got, tt.skip)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// decodeStrict decodes a single JSON object from r into v. Unlike a plain
+// json.Decoder it rejects fields v doesn't have and anything after the
+// object, and its errors name the problem, e.g. "unknown field 'querry'".
+func decodeStrict(r io.Reader, v interface{}) error {
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return describeDecodeError(err)
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return fmt.Errorf("unexpected data after the JSON object")
+	}
+	return nil
+}
+
+// describeDecodeError turns an encoding/json error into a message for API clients
+func describeDecodeError(err error) error {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.Is(err, io.EOF):
+		return fmt.Errorf("request body is empty")
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return fmt.Errorf("request body ends in the middle of the JSON object")
+	case errors.As(err, &syntaxErr):
+		return fmt.Errorf("malformed JSON at byte %d: %s", syntaxErr.Offset, strings.TrimPrefix(syntaxErr.Error(), "json: "))
+	case errors.As(err, &typeErr):
+		if typeErr.Field == "" {
+			return fmt.Errorf("expected a JSON object, got %s", typeErr.Value)
+		}
+		return fmt.Errorf("field '%s' must be a %s, got %s", typeErr.Field, typeErr.Type, typeErr.Value)
+	}
+
+	// Unknown fields only come back as text: json: unknown field "querry"
+	if name, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		return fmt.Errorf("unknown field '%s'", strings.Trim(name, `"`))
+	}
+	return err
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestDecodeStrict(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    string // the decoded query when there is no error
+		wantErr string
+	}{
+		{"valid", `{"query": "SELECT 1"}`, "SELECT 1", ""},
+		{"trailing whitespace", "{\"query\": \"SELECT 1\"}\n\t ", "SELECT 1", ""},
+		{"unknown field", `{"querry": "SELECT 1"}`, "", "unknown field 'querry'"},
+		{"unknown field beside a known one", `{"query": "SELECT 1", "timeout": 5}`, "", "unknown field 'timeout'"},
+		{"second object", `{"query": "SELECT 1"}{"query": "SELECT 2"}`, "", "unexpected data after the JSON object"},
+		{"trailing garbage", `{"query": "SELECT 1"} oops`, "", "unexpected data after the JSON object"},
+		{"trailing comma", `{"query": "SELECT 1"},`, "", "unexpected data after the JSON object"},
+		{"empty body", "", "", "request body is empty"},
+		{"truncated", `{"query": "SELECT 1"`, "", "ends in the middle of the JSON object"},
+		{"malformed", `{"query" "SELECT 1"}`, "", "malformed JSON at byte"},
+		{"wrong type", `{"query": 42}`, "", "field 'query' must be a string, got number"},
+		{"not an object", `["SELECT 1"]`, "", "expected a JSON object, got array"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req SQLRequest
+			err := decodeStrict(strings.NewReader(tt.body), &req)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("decodeStrict: %v", err)
+				}
+				if req.Query != tt.want {
+					t.Errorf("query = %q, want %q", req.Query, tt.want)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("decodeStrict: got %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSQLRejectsUnknownFields(t *testing.T) {
+	s := newTestServer(t,
+		"CREATE TABLE users (id int, name text)",
+		"INSERT INTO users VALUES (0, root)",
+	)
+
+	for _, body := range []string{
+		`{"querry": "INSERT INTO users VALUES (1, alice)"}`,
+		`{"query": "INSERT INTO users VALUES (1, alice)"} {"query": "INSERT INTO users VALUES (2, bob)"}`,
+	} {
+		rec, resp := serve(t, s.handleSQL, http.MethodPost, "/sql", body)
+		if rec.Code != http.StatusBadRequest || !strings.HasPrefix(resp.Error, "Invalid request body: ") {
+			t.Errorf("%s: status %d (%s), want 400", body, rec.Code, resp.Error)
+		}
+	}
+	rec, resp := serve(t, s.handleSQL, http.MethodPost, "/sql", `{"query": "SELECT * FROM users"}`)
+	if rows, _ := resp.Data.([]interface{}); rec.Code != http.StatusOK || len(rows) != 1 {
+		t.Errorf("rejected requests ran: %v (%s)", resp.Data, resp.Error)
+	}
+}
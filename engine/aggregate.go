@@ -0,0 +1,283 @@
+package engine
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Aggregate is an aggregate function call such as SUM(amount).
+// Column is "*" for COUNT(*).
+type Aggregate struct {
+	Func   string // COUNT, SUM, MIN, MAX or AVG
+	Column string
+}
+
+// accumulator folds the values of one group into an aggregate result
+type accumulator struct {
+	agg    Aggregate
+	col    Column
+	count  int64
+	sumInt int64
+	sum    float64
+	best   interface{} // MIN/MAX so far
+}
+
+// isIntType reports whether a column type holds integers
+func isIntType(colType string) bool {
+	return colType == "int" || colType == "integer" || colType == "bigint" || colType == "serial"
+}
+
+// add feeds one stored value into the accumulator
+func (acc *accumulator) add(raw string) error {
+	if acc.agg.Column == "*" {
+		acc.count++
+		return nil
+	}
+	if raw == "" {
+		return nil // nothing to aggregate
+	}
+
+	switch acc.agg.Func {
+	case "COUNT":
+		acc.count++
+	case "SUM", "AVG":
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return fmt.Errorf("cannot %s non-numeric value %q in column %s", acc.agg.Func, raw, acc.col.Name)
+		}
+		if isIntType(acc.col.Type) {
+			if n, err := strconv.ParseInt(raw, 10, 64); err == nil {
+				acc.sumInt += n
+			}
+		}
+		acc.sum += f
+		acc.count++
+	case "MIN", "MAX":
+		value := TypedValue(acc.col, raw)
+		if acc.best == nil {
+			acc.best = value
+		} else if cmp := CompareValues(value, acc.best); (acc.agg.Func == "MIN" && cmp < 0) || (acc.agg.Func == "MAX" && cmp > 0) {
+			acc.best = value
+		}
+		acc.count++
+	}
+	return nil
+}
+
+// result returns the aggregate value of the group
+func (acc *accumulator) result() interface{} {
+	switch acc.agg.Func {
+	case "COUNT":
+		return acc.count
+	case "SUM":
+		if acc.count == 0 {
+			return nil
+		}
+		if isIntType(acc.col.Type) {
+			return acc.sumInt
+		}
+		return acc.sum
+	case "AVG":
+		if acc.count == 0 {
+			return nil
+		}
+		return acc.sum / float64(acc.count)
+	}
+	return acc.best
+}
+
+// GroupRows groups rows by a column and evaluates the aggregates per group.
+// Each result row is the typed group key followed by one value per
+// aggregate. Groups come out in the order their key was first seen.
+func (db *Database) GroupRows(tableName, groupColumn string, aggs []Aggregate, rows [][]string) ([][]interface{}, error) {
+	db.mu.RLock()
+	metadata, exists := db.Tables[tableName]
+	db.mu.RUnlock()
+
+	if !exists {
+		return nil, TableNotExist(tableName)
+	}
+
+	keyCol, keyPos, err := findColumn(metadata, groupColumn)
+	if err != nil {
+		return nil, err
+	}
+	cols, positions, err := resolveAggregates(metadata, aggs)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make(map[string][]*accumulator)
+	var keys []string
+	for _, row := range rows {
+		key := ""
+		if keyPos < len(row) {
+			key = row[keyPos]
+		}
+
+		accs, seen := groups[key]
+		if !seen {
+			accs = newAccumulators(aggs, cols)
+			groups[key] = accs
+			keys = append(keys, key)
+		}
+		if err := addRow(accs, positions, row); err != nil {
+			return nil, err
+		}
+	}
+
+	result := make([][]interface{}, 0, len(keys))
+	for _, key := range keys {
+		out := make([]interface{}, 0, len(aggs)+1)
+		out = append(out, TypedValue(keyCol, key))
+		for _, acc := range groups[key] {
+			out = append(out, acc.result())
+		}
+		result = append(result, out)
+	}
+	return result, nil
+}
+
+// AggregateRows evaluates the aggregates over all rows as a single group,
+// for a SELECT of aggregates without GROUP BY. No rows give a COUNT and SUM
+// of 0 and a MIN, MAX and AVG of nil.
+func (db *Database) AggregateRows(tableName string, aggs []Aggregate, rows [][]string) ([]interface{}, error) {
+	db.mu.RLock()
+	metadata, exists := db.Tables[tableName]
+	db.mu.RUnlock()
+
+	if !exists {
+		return nil, TableNotExist(tableName)
+	}
+	cols, positions, err := resolveAggregates(metadata, aggs)
+	if err != nil {
+		return nil, err
+	}
+
+	accs := newAccumulators(aggs, cols)
+	for _, row := range rows {
+		if err := addRow(accs, positions, row); err != nil {
+			return nil, err
+		}
+	}
+	result := make([]interface{}, len(accs))
+	for i, acc := range accs {
+		result[i] = acc.result()
+	}
+	return result, nil
+}
+
+// resolveAggregates checks the aggregate functions and finds the column each
+// one reads and its position in a stored row (-1 for COUNT(*))
+func resolveAggregates(metadata TableMetadata, aggs []Aggregate) ([]Column, []int, error) {
+	cols := make([]Column, len(aggs))
+	positions := make([]int, len(aggs))
+	for i, agg := range aggs {
+		switch agg.Func {
+		case "COUNT", "SUM", "MIN", "MAX", "AVG":
+		default:
+			return nil, nil, fmt.Errorf("unsupported aggregate function %s", agg.Func)
+		}
+		if agg.Column == "*" {
+			if agg.Func != "COUNT" {
+				return nil, nil, fmt.Errorf("%s(*) is not supported, only COUNT(*)", agg.Func)
+			}
+			positions[i] = -1
+			continue
+		}
+		var err error
+		cols[i], positions[i], err = findColumn(metadata, agg.Column)
+		if err != nil {
+			return nil, nil, err
+		}
+		// Text columns are checked value by value: an untyped column can
+		// hold numbers
+		if family := cols[i].TypeFamily(); (agg.Func == "SUM" || agg.Func == "AVG") && (family == "bool" || family == "time" || cols[i].Type == "blob") {
+			return nil, nil, fmt.Errorf("cannot %s column %s: it holds %s values, not numbers", agg.Func, cols[i].Name, cols[i].Type)
+		}
+	}
+	return cols, positions, nil
+}
+
+func newAccumulators(aggs []Aggregate, cols []Column) []*accumulator {
+	accs := make([]*accumulator, len(aggs))
+	for i, agg := range aggs {
+		accs[i] = &accumulator{agg: agg, col: cols[i]}
+	}
+	return accs
+}
+
+// addRow feeds a stored row into each accumulator
+func addRow(accs []*accumulator, positions []int, row []string) error {
+	for i, acc := range accs {
+		raw := ""
+		if positions[i] >= 0 && positions[i] < len(row) {
+			raw = row[positions[i]]
+		}
+		if err := acc.add(raw); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CompareValues orders two values as produced by TypedValue: numbers
+// numerically, false before true, times chronologically, and anything else
+// as strings.
+// nil sorts first.
+func CompareValues(a, b interface{}) int {
+	if a == nil || b == nil {
+		switch {
+		case a == nil && b == nil:
+			return 0
+		case a == nil:
+			return -1
+		}
+		return 1
+	}
+
+	fa, aNum := toFloat(a)
+	fb, bNum := toFloat(b)
+	if aNum && bNum {
+		switch {
+		case fa < fb:
+			return -1
+		case fa > fb:
+			return 1
+		}
+		return 0
+	}
+
+	ta, aTime := a.(time.Time)
+	tb, bTime := b.(time.Time)
+	if aTime && bTime {
+		return ta.Compare(tb)
+	}
+
+	ba, aBool := a.(bool)
+	bb, bBool := b.(bool)
+	if aBool && bBool {
+		switch {
+		case ba == bb:
+			return 0
+		case !ba:
+			return -1
+		}
+		return 1
+	}
+
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+// toFloat converts numeric values to float64
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
@@ -0,0 +1,99 @@
+package engine
+
+import (
+	"fmt"
+	"pesapal-ledger/storage"
+	"strings"
+)
+
+// DropColumn removes a column from a table. Rows are stored positionally, so
+// the whole log is rewritten without the column's field (superseded versions
+// and tombstones included, keeping the history readable) and the index is
+// rebuilt. The first column and key columns can't be dropped, nor columns a
+// table-level CHECK refers to.
+func (db *Database) DropColumn(tableName, colName string) error {
+	if err := db.checkTableWritable(tableName); err != nil {
+		return err
+	}
+
+	db.writeMu.Lock()
+	defer db.writeMu.Unlock()
+
+	db.mu.RLock()
+	metadata, exists := db.Tables[tableName]
+	db.mu.RUnlock()
+	if !exists {
+		return TableNotExist(tableName)
+	}
+
+	col, pos, err := findColumn(metadata, colName)
+	if err != nil {
+		return err
+	}
+	if pos == 0 {
+		// The first column holds the stored row's id slot, ahead of the active flag
+		return fmt.Errorf("cannot drop column %s: it is the first column of table %s", col.Name, tableName)
+	}
+	for _, key := range metadata.KeyColumns() {
+		if strings.EqualFold(key, col.Name) {
+			return fmt.Errorf("cannot drop column %s: it is part of the primary key of table %s", col.Name, tableName)
+		}
+	}
+
+	updated := metadata
+	updated.Columns = make([]string, 0, len(metadata.Columns)-1)
+	for i, colDef := range metadata.Columns {
+		if rowPosition(i) != pos {
+			updated.Columns = append(updated.Columns, colDef)
+		}
+	}
+	if err := validateChecks(updated); err != nil {
+		return fmt.Errorf("cannot drop column %s: %w", col.Name, err)
+	}
+
+	// pos is always before the LSN, so rows with or without one lose the
+	// same field; a row too short to hold the column is written as it was.
+	// The new log is staged and the metadata saved before it replaces the
+	// old one, so a crash leaves either the old pair or the new pair.
+	updated.SchemaVersion = metadata.SchemaVersion + 1
+	err = storage.StageTransformTableFile(tableName, updated.SchemaVersion, func(_ int64, data []string) ([]string, bool) {
+		if pos >= len(data) {
+			return data, true
+		}
+		row := make([]string, 0, len(data)-1)
+		row = append(row, data[:pos]...)
+		return append(row, data[pos+1:]...), true
+	})
+	if err != nil {
+		return fmt.Errorf("failed to drop column %s: %w", col.Name, err)
+	}
+
+	db.mu.Lock()
+	db.Tables[tableName] = updated
+	db.mu.Unlock()
+	if err := db.SaveMetadata(); err != nil {
+		db.mu.Lock()
+		db.Tables[tableName] = metadata
+		db.mu.Unlock()
+		storage.DiscardStagedTableFile(tableName, updated.SchemaVersion)
+		return fmt.Errorf("failed to save metadata: %w", err)
+	}
+
+	if err := storage.CommitStagedTableFile(tableName, updated.SchemaVersion); err != nil {
+		// The old file is still in place: put its schema back
+		db.mu.Lock()
+		db.Tables[tableName] = metadata
+		db.mu.Unlock()
+		if saveErr := db.SaveMetadata(); saveErr != nil {
+			// The saved metadata keeps the new schema, and the next start
+			// finishes the rename
+			db.mu.Lock()
+			db.Degraded[tableName] = "DROP COLUMN not finished; restart to complete it"
+			db.mu.Unlock()
+			return fmt.Errorf("failed to drop column %s: %w (and restoring the metadata failed: %v)", col.Name, err, saveErr)
+		}
+		storage.DiscardStagedTableFile(tableName, updated.SchemaVersion)
+		return fmt.Errorf("failed to drop column %s: %w", col.Name, err)
+	}
+	return db.RebuildIndex(tableName)
+}
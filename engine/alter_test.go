@@ -0,0 +1,122 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"pesapal-ledger/storage"
+	"reflect"
+	"testing"
+)
+
+// dropThird stages the log of accounts without its third column (note), as
+// DROP COLUMN note would
+func dropThird(t *testing.T, version int) {
+	t.Helper()
+	err := storage.StageTransformTableFile("accounts", version, func(_ int64, data []string) ([]string, bool) {
+		return append(append([]string(nil), data[:3]...), data[4:]...), true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDropColumnReload(t *testing.T) {
+	full := []string{"1", "1", "alice", "vip", "100"}
+	dropped := []string{"1", "1", "alice", "100"}
+
+	tests := []struct {
+		name string
+		// interrupt leaves the table as a crash partway through DROP COLUMN
+		// would; nil runs DropColumn to the end
+		interrupt func(t *testing.T, db *Database)
+		want      []string
+	}{
+		{
+			name: "completed",
+			want: dropped,
+		},
+		{
+			name: "crash after staging",
+			interrupt: func(t *testing.T, db *Database) {
+				dropThird(t, 1)
+			},
+			want: full,
+		},
+		{
+			name: "crash after saving the metadata",
+			interrupt: func(t *testing.T, db *Database) {
+				dropThird(t, 1)
+				metadata := db.Tables["accounts"]
+				metadata.Columns = []string{"id int", "owner text", "balance int"}
+				metadata.SchemaVersion = 1
+				db.Tables["accounts"] = metadata
+				if err := db.SaveMetadata(); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: dropped,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			if err := db.CreateTable("accounts", []string{"id int", "owner text", "note text", "balance int"}); err != nil {
+				t.Fatal(err)
+			}
+			if err := db.InsertRow("accounts", append([]string(nil), full...)); err != nil {
+				t.Fatal(err)
+			}
+			if tt.interrupt == nil {
+				if err := db.DropColumn("accounts", "note"); err != nil {
+					t.Fatal(err)
+				}
+			} else {
+				tt.interrupt(t, db)
+			}
+
+			db = reopen(t, db)
+			row, err := db.FindByID("accounts", "1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(row, tt.want) {
+				t.Errorf("row after reload = %v, want %v", row, tt.want)
+			}
+			if got := len(db.Tables["accounts"].Columns); got != len(tt.want)-1 {
+				t.Errorf("reloaded schema has %d columns, want %d", got, len(tt.want)-1)
+			}
+			if staged, _ := filepath.Glob(storage.TableFilePath("accounts") + ".v*"); len(staged) > 0 {
+				t.Errorf("staged files left behind: %v", staged)
+			}
+		})
+	}
+}
+
+func TestDropColumnSaveFailure(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.CreateTable("accounts", []string{"id int", "owner text", "note text"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.InsertRow("accounts", []string{"1", "1", "alice", "vip"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A directory in the way of the temporary metadata file fails the save
+	if err := os.Mkdir(filepath.Join(storage.DataDir(), "metadata.json.tmp"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.DropColumn("accounts", "note"); err == nil {
+		t.Fatal("DropColumn succeeded with the metadata unsaveable")
+	}
+	if got := len(db.Tables["accounts"].Columns); got != 3 {
+		t.Errorf("in-memory schema has %d columns after the failed drop, want 3", got)
+	}
+	row, err := db.FindByID("accounts", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"1", "1", "alice", "vip"}; !reflect.DeepEqual(row, want) {
+		t.Errorf("row after the failed drop = %v, want %v", row, want)
+	}
+}
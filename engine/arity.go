@@ -0,0 +1,30 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrRowArity is returned in strict mode for a stored row whose field count
+// doesn't match its table's schema
+var ErrRowArity = errors.New("row does not match the table schema")
+
+// fitRow shapes a stored row read at offset to the table's schema, dropping
+// the LSN after the columns. By default extra fields are truncated and short
+// rows are passed through, which papers over old corruption; with StrictRows
+// any row that isn't exactly the columns (plus an LSN) is an error instead.
+func (db *Database) fitRow(metadata TableMetadata, offset int64, row []string) ([]string, error) {
+	width := metadata.rowWidth()
+	if db.StrictRows {
+		hasLSN := len(row) == width+1 && rowLSN(row, width) > 0
+		if len(row) != width && !hasLSN {
+			return nil, fmt.Errorf("row at offset %d of table %s has %d fields, expected %d: %w",
+				offset, metadata.Name, len(row), width, ErrRowArity)
+		}
+	}
+
+	if len(row) > width {
+		row = row[:width]
+	}
+	return row, nil
+}
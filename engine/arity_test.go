@@ -0,0 +1,157 @@
+package engine
+
+import (
+	"errors"
+	"pesapal-ledger/storage"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestStrictRows plants rows with the wrong number of fields in a table file
+// and reads them back in tolerant and strict mode
+func TestStrictRows(t *testing.T) {
+	tests := []struct {
+		name     string
+		stored   []string
+		tolerant []string // what a tolerant read returns
+	}{
+		{"short row", []string{"2", "1"}, []string{"2", "1"}},
+		{"extra fields", []string{"2", "1", "bob", "x", "y"}, []string{"2", "1", "bob"}},
+		{"extra field that is not an LSN", []string{"2", "1", "bob", "x"}, []string{"2", "1", "bob"}},
+	}
+	for _, tt := range tests {
+		for _, strict := range []bool{false, true} {
+			mode := "tolerant"
+			if strict {
+				mode = "strict"
+			}
+			t.Run(tt.name+"/"+mode, func(t *testing.T) {
+				db := newTestDB(t)
+				if err := db.CreateTable("users", []string{"id int", "name text"}); err != nil {
+					t.Fatal(err)
+				}
+				if err := db.InsertRow("users", []string{"1", "1", "alice"}); err != nil {
+					t.Fatal(err)
+				}
+				offset, err := storage.AppendRow("users", tt.stored)
+				if err != nil {
+					t.Fatal(err)
+				}
+				db = reopen(t, db)
+				db.StrictRows = strict
+
+				// The well-formed row reads the same either way
+				if row, err := db.FindByID("users", "1"); err != nil || !reflect.DeepEqual(row, []string{"1", "1", "alice"}) {
+					t.Fatalf("FindByID(1) = %v, %v", row, err)
+				}
+
+				reads := map[string]func() ([]string, error){
+					"FindByID": func() ([]string, error) { return db.FindByID("users", "2") },
+					"SelectAll": func() ([]string, error) {
+						rows, err := db.SelectAll("users")
+						if err != nil || len(rows) != 2 {
+							return nil, err
+						}
+						return rows[1], nil
+					},
+					"RangeByID": func() ([]string, error) {
+						rows, err := db.RangeByID("users", "2", "2")
+						if err != nil || len(rows) != 1 {
+							return nil, err
+						}
+						return rows[0], nil
+					},
+					"TailRows": func() ([]string, error) {
+						rows, err := db.TailRows("users", 1)
+						if err != nil || len(rows) != 1 {
+							return nil, err
+						}
+						return rows[0], nil
+					},
+				}
+				for name, read := range reads {
+					row, err := read()
+					if !strict {
+						if err != nil || !reflect.DeepEqual(row, tt.tolerant) {
+							t.Errorf("%s = %v, %v; want %v", name, row, err, tt.tolerant)
+						}
+						continue
+					}
+					if !errors.Is(err, ErrRowArity) {
+						t.Errorf("%s = %v, %v; want ErrRowArity", name, row, err)
+						continue
+					}
+					if want := "at offset " + strconv.FormatInt(offset, 10); !strings.Contains(err.Error(), want) {
+						t.Errorf("%s error %q does not give the offset (%s)", name, err, want)
+					}
+				}
+			})
+		}
+	}
+}
+
+// TestInsertValueCount checks that inserts and upserts with fewer or more
+// values than columns are refused before anything is written, so the LSN is
+// never stored where a column value belongs
+func TestInsertValueCount(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.CreateTable("t", []string{"id int", "name text", "amount int", "ok bool"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.InsertRow("t", []string{"1", "1", "alice", "3", "true"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		write   func() error
+		wantErr string // "" for a write that passes
+	}{
+		{"exact", func() error { return db.InsertRow("t", []string{"2", "1", "bob", "4", "false"}) }, ""},
+		{"short", func() error { return db.InsertRow("t", []string{"6", "1"}) }, "expected 4, got 1"},
+		{"one short", func() error { return db.InsertRow("t", []string{"6", "1", "x", "3"}) }, "expected 4, got 3"},
+		{"long", func() error { return db.InsertRow("t", []string{"5", "1", "x", "1", "true", "extra"}) }, "expected 4, got 5"},
+		{"short upsert", func() error { _, err := db.UpsertRow("t", []string{"6", "1", "x"}, nil); return err }, "expected 4, got 2"},
+		{"long upsert of an existing key", func() error {
+			_, err := db.UpsertRow("t", []string{"1", "1", "x", "1", "true", "extra"}, map[string]string{"name": "y"})
+			return err
+		}, "expected 4, got 5"},
+		{"short insert in a transaction", func() error {
+			tx, err := db.Begin()
+			if err != nil {
+				return err
+			}
+			defer tx.Rollback()
+			return tx.InsertRow("t", []string{"7", "1", "x"})
+		}, "expected 4, got 2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.write()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) || !strings.Contains(err.Error(), "wrong number of values for table t") {
+				t.Fatalf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	db = reopen(t, db)
+	for _, id := range []string{"5", "6", "7"} {
+		if row, err := db.FindByID("t", id); err == nil {
+			t.Errorf("refused row %s was written: %v", id, row)
+		}
+	}
+	if row, err := db.FindByID("t", "1"); err != nil || !reflect.DeepEqual(row[:5], []string{"1", "1", "alice", "3", "true"}) {
+		t.Errorf("row 1 = %v, %v; want it unchanged", row, err)
+	}
+	if err := db.UpdateRow("t", "2", map[string]string{"amount": "9"}); err != nil {
+		t.Errorf("update of a full row: %v", err)
+	}
+}
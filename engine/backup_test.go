@@ -0,0 +1,200 @@
+package engine
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"pesapal-ledger/storage"
+)
+
+// TestBackupTable checks that a backup holds the table file's bytes as of
+// the moment it was opened, not the writes made while it is read, and that
+// a data directory rebuilt from it has the same rows
+func TestBackupTable(t *testing.T) {
+	tests := []struct {
+		name       string
+		table      string
+		format     storage.RecordFormat
+		compressed bool
+	}{
+		{"text", "ledger", storage.FormatText, false},
+		{"binary", "ledger", storage.FormatBinary, false},
+		{"compressed", "ledger", storage.FormatText, true},
+		{"schema-qualified", "sales.ledger", storage.FormatBinary, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			if err := db.CreateTableWithFormat(tt.table, []string{"id int", "memo text"}, tt.format); err != nil {
+				t.Fatal(err)
+			}
+			if tt.compressed {
+				if err := db.SetCompression(tt.table, true); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, row := range [][]string{{"1", "1", "alpha"}, {"2", "1", "beta"}, {"3", "1", "gamma"}} {
+				if err := db.InsertRow(tt.table, row); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := db.UpdateRow(tt.table, "2", map[string]string{"memo": "bravo"}); err != nil {
+				t.Fatal(err)
+			}
+			if err := db.DeleteRow(tt.table, "3"); err != nil {
+				t.Fatal(err)
+			}
+			want := liveRows(t, db, tt.table)
+
+			backup, err := db.BackupTable(tt.table)
+			if err != nil {
+				t.Fatal(err)
+			}
+			file, err := os.ReadFile(storage.TableFilePath(tt.table))
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Written after the backup started, so not part of it
+			if err := db.InsertRow(tt.table, []string{"4", "1", "delta"}); err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(backup)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := backup.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if backup.Size != int64(len(file)) || !bytes.Equal(got, file) {
+				t.Fatalf("backup is %d bytes (size %d), want the %d bytes of the file", len(got), backup.Size, len(file))
+			}
+
+			// A fresh data directory with the schema and the backup
+			metadata, err := os.ReadFile(filepath.Join(storage.DataDir(), "metadata.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := storage.SetDataDir(t.TempDir()); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(storage.DataDir(), "metadata.json"), metadata, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			path := storage.TableFilePath(tt.table)
+			if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, got, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			restored := NewDatabase()
+			if err := restored.Recover(); err != nil {
+				t.Fatal(err)
+			}
+			if rows := liveRows(t, restored, tt.table); !reflect.DeepEqual(rows, want) {
+				t.Errorf("rows rebuilt from the backup = %v, want %v", rows, want)
+			}
+		})
+	}
+
+	db := newTestDB(t)
+	if _, err := db.BackupTable("missing"); !errors.Is(err, ErrTableNotFound) {
+		t.Errorf("unknown table: err = %v, want ErrTableNotFound", err)
+	}
+}
+
+// TestRestoreTable restores a backup into a table in each state it can be
+// found in, and checks which restores are refused and that a refused one
+// leaves the table as it was
+func TestRestoreTable(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.CreateTable("ledger", []string{"id int", "memo text"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range [][]string{{"1", "1", "alpha"}, {"2", "1", "beta"}, {"3", "1", "gamma"}} {
+		if err := db.InsertRow("ledger", row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.DeleteRow("ledger", "3"); err != nil {
+		t.Fatal(err)
+	}
+	want := liveRows(t, db, "ledger")
+	backup, err := db.BackupTable("ledger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	good, err := io.ReadAll(backup)
+	backup.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	corrupt := bytes.Replace(good, []byte("beta"), []byte("bota"), 1)
+	truncated := good[:len(good)-3]
+
+	tests := []struct {
+		name     string
+		existing []string // ids of rows the table holds before the restore
+		upload   []byte
+		force    bool
+		wantErr  error
+		wantRows [][]string // rows after the restore, or after the refusal
+	}{
+		{"into an empty table", nil, good, false, nil, want},
+		{"empty upload", nil, nil, false, nil, nil},
+		{"into a table with rows", []string{"9"}, good, false, ErrTableNotEmpty, [][]string{{"9", "kept"}}},
+		{"forced over rows", []string{"9"}, good, true, nil, want},
+		{"corrupt upload", []string{"9"}, corrupt, true, storage.ErrCorruptUpload, [][]string{{"9", "kept"}}},
+		{"truncated upload", nil, truncated, false, storage.ErrCorruptUpload, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			if err := db.CreateTable("ledger", []string{"id int", "memo text"}); err != nil {
+				t.Fatal(err)
+			}
+			for _, id := range tt.existing {
+				if err := db.InsertRow("ledger", []string{id, "1", "kept"}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			result, err := db.RestoreTable("ledger", bytes.NewReader(tt.upload), tt.force)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("RestoreTable: err = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && (result.Bytes != int64(len(tt.upload)) || result.LiveRows != len(tt.wantRows)) {
+				t.Errorf("result = %+v, want %d bytes and %d live rows", result, len(tt.upload), len(tt.wantRows))
+			}
+			if rows := liveRows(t, db, "ledger"); !reflect.DeepEqual(rows, tt.wantRows) {
+				t.Errorf("rows = %v, want %v", rows, tt.wantRows)
+			}
+
+			// The table takes writes after the restore and keeps them across a restart
+			if err := db.InsertRow("ledger", []string{"8", "1", "after"}); err != nil {
+				t.Fatal(err)
+			}
+			db = reopen(t, db)
+			if rows := liveRows(t, db, "ledger"); len(rows) != len(tt.wantRows)+1 {
+				t.Errorf("rows after a restart = %v, want %v and the row written after", rows, tt.wantRows)
+			}
+		})
+	}
+
+	db = newTestDB(t)
+	if err := db.CreateTable("ledger", []string{"id int", "memo text"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.RestoreTable("missing", bytes.NewReader(good), true); !errors.Is(err, ErrTableNotFound) {
+		t.Errorf("unknown table: err = %v, want ErrTableNotFound", err)
+	}
+	db.SetMaintenance(true)
+	if _, err := db.RestoreTable("ledger", bytes.NewReader(good), true); !errors.Is(err, ErrMaintenance) {
+		t.Errorf("in maintenance: err = %v, want ErrMaintenance", err)
+	}
+}
@@ -0,0 +1,207 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+)
+
+// comparisonOps lists the operators a CHECK comparison may use. Two-character
+// operators come first so ">=" isn't read as ">".
+var comparisonOps = []string{">=", "<=", "<>", "!=", "=", "<", ">"}
+
+// comparison is one "column op literal" term of a CHECK expression
+type comparison struct {
+	column  string
+	op      string
+	literal string
+}
+
+// splitCheck separates a trailing "CHECK (expr)" from a column definition,
+// returning the rest of the definition and the expression
+func splitCheck(colDef string) (string, string) {
+	upper := strings.ToUpper(colDef)
+	idx := strings.Index(upper, " CHECK")
+	if idx == -1 {
+		return colDef, ""
+	}
+	rest := strings.TrimSpace(colDef[idx+6:]) // len(" CHECK")
+	if !strings.HasPrefix(rest, "(") {
+		return colDef, ""
+	}
+	return strings.TrimSpace(colDef[:idx]), checkExpr(rest)
+}
+
+// tableCheck returns the expression of a table-level "CHECK (expr)"
+// definition, or false when colDef is an ordinary column
+func tableCheck(colDef string) (string, bool) {
+	trimmed := strings.TrimSpace(colDef)
+	if len(trimmed) < 5 || !strings.EqualFold(trimmed[:5], "CHECK") {
+		return "", false
+	}
+	rest := strings.TrimSpace(trimmed[5:])
+	if !strings.HasPrefix(rest, "(") {
+		return "", false
+	}
+	return checkExpr(rest), true
+}
+
+// hasBareCheck reports whether a column definition uses CHECK without
+// parentheses around the expression, as in "amount int CHECK amount >= 0" or
+// a table-level "CHECK amount >= 0". Neither splitCheck nor tableCheck takes
+// those, so the constraint would silently not exist.
+func hasBareCheck(colDef string) bool {
+	fields := strings.Fields(colDef)
+	for i, field := range fields {
+		if !strings.EqualFold(field, "CHECK") {
+			continue
+		}
+		// A column may be named check: "check int", "check varchar (10)"
+		if i >= 2 || (i == 0 && len(fields) > 2 && !strings.HasPrefix(fields[2], "(")) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkExpr strips the parentheses around a CHECK expression
+func checkExpr(parenthesized string) string {
+	if strings.HasSuffix(parenthesized, ")") {
+		return strings.TrimSpace(parenthesized[1 : len(parenthesized)-1])
+	}
+	return strings.TrimSpace(parenthesized[1:])
+}
+
+// parseCheck parses a CHECK expression: comparisons of a column against a
+// literal, optionally joined with AND, e.g. "amount >= 0 AND amount < 1000"
+func parseCheck(expr string) ([]comparison, error) {
+	var terms []comparison
+	for _, term := range splitAnd(expr) {
+		term = strings.TrimSpace(term)
+		cmp, ok := parseComparison(term)
+		if !ok {
+			return nil, fmt.Errorf("invalid CHECK expression %q: expected 'column op literal'", term)
+		}
+		terms = append(terms, cmp)
+	}
+	return terms, nil
+}
+
+// splitAnd splits an expression on the AND keyword, case-insensitively
+func splitAnd(expr string) []string {
+	var parts []string
+	for {
+		idx := strings.Index(strings.ToUpper(expr), " AND ")
+		if idx == -1 {
+			return append(parts, expr)
+		}
+		parts = append(parts, expr[:idx])
+		expr = expr[idx+5:] // len(" AND ")
+	}
+}
+
+// parseComparison parses "column op literal". Quotes around the literal are stripped.
+func parseComparison(term string) (comparison, bool) {
+	idx, op := -1, ""
+	for _, candidate := range comparisonOps {
+		if i := strings.Index(term, candidate); i != -1 && (idx == -1 || i < idx) {
+			idx, op = i, candidate
+		}
+	}
+	if idx <= 0 {
+		return comparison{}, false
+	}
+
+	column := strings.TrimSpace(term[:idx])
+	literal := strings.TrimSpace(term[idx+len(op):])
+	if column == "" || literal == "" || strings.ContainsAny(column, " ") {
+		return comparison{}, false
+	}
+	if len(literal) >= 2 && strings.HasPrefix(literal, "'") && strings.HasSuffix(literal, "'") {
+		literal = literal[1 : len(literal)-1]
+	}
+	return comparison{column: column, op: op, literal: literal}, true
+}
+
+// holds reports whether a compare result satisfies the operator
+func (c comparison) holds(cmp int) bool {
+	switch c.op {
+	case "=":
+		return cmp == 0
+	case "<>", "!=":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	}
+	return cmp >= 0
+}
+
+// AllChecks returns every CHECK expression of the table: column-level ones in
+// column order, then table-level ones
+func (m TableMetadata) AllChecks() []string {
+	var exprs []string
+	for _, col := range m.Schema() {
+		if col.Check != "" {
+			exprs = append(exprs, col.Check)
+		}
+	}
+	return append(exprs, m.Checks...)
+}
+
+// validateChecks makes sure every CHECK of a new table parses and compares
+// existing columns against literals of the right type
+func validateChecks(metadata TableMetadata) error {
+	for _, expr := range metadata.AllChecks() {
+		terms, err := parseCheck(expr)
+		if err != nil {
+			return err
+		}
+		for _, term := range terms {
+			col, _, err := findColumn(metadata, term.column)
+			if err != nil {
+				return fmt.Errorf("invalid CHECK expression %q: %w", expr, err)
+			}
+			if _, isText := TypedValue(col, term.literal).(string); isText && isTypedColumn(col) {
+				return fmt.Errorf("invalid CHECK expression %q: %s is not a valid %s", expr, term.literal, col.Type)
+			}
+		}
+	}
+	return nil
+}
+
+// isTypedColumn reports whether TypedValue converts the column's values
+func isTypedColumn(col Column) bool {
+	switch col.Type {
+	case "bool", "boolean", "float", "double", "real":
+		return true
+	}
+	return isIntType(col.Type)
+}
+
+// checkRow evaluates the table's CHECK constraints against a candidate row.
+// Empty values pass, as NULL does in SQL.
+func checkRow(metadata TableMetadata, row []string) error {
+	for _, expr := range metadata.AllChecks() {
+		terms, err := parseCheck(expr)
+		if err != nil {
+			return err
+		}
+		for _, term := range terms {
+			col, pos, err := findColumn(metadata, term.column)
+			if err != nil {
+				return err
+			}
+			if pos >= len(row) || row[pos] == "" {
+				continue
+			}
+			cmp := CompareValues(TypedValue(col, row[pos]), TypedValue(col, term.literal))
+			if !term.holds(cmp) {
+				return fmt.Errorf("CHECK constraint violated on table %s: %s (%s = %s)", metadata.Name, expr, col.Name, row[pos])
+			}
+		}
+	}
+	return nil
+}
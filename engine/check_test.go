@@ -0,0 +1,101 @@
+package engine
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestCheckConstraints runs inserts and updates that pass and fail column
+// and table CHECK constraints, including after a restart, and checks that
+// a rejected write leaves the table as it was
+func TestCheckConstraints(t *testing.T) {
+	db := newTestDB(t)
+	columns := []string{"id int", "amount int CHECK (amount >= 0 AND amount < 1000)", "status text", "CHECK (status != 'bad')"}
+	if err := db.CreateTable("txns", columns); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.InsertRow("txns", []string{"1", "1", "10", "ok"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		write   func() error
+		wantErr string // "" for a write that passes
+	}{
+		{"insert at the lower bound", func() error { return db.InsertRow("txns", []string{"2", "1", "0", "ok"}) }, ""},
+		{"insert below the lower bound", func() error { return db.InsertRow("txns", []string{"3", "1", "-1", "ok"}) }, "(amount = -1)"},
+		{"insert at the upper bound", func() error { return db.InsertRow("txns", []string{"3", "1", "1000", "ok"}) }, "(amount = 1000)"},
+		{"insert failing a table check", func() error { return db.InsertRow("txns", []string{"3", "1", "5", "bad"}) }, "status != 'bad' (status = bad)"},
+		{"update passing", func() error { return db.UpdateRow("txns", "1", map[string]string{"amount": "999"}) }, ""},
+		{"update failing a column check", func() error { return db.UpdateRow("txns", "1", map[string]string{"amount": "-5"}) }, "amount >= 0"},
+		{"update failing a table check", func() error { return db.UpdateRow("txns", "2", map[string]string{"status": "bad"}) }, "status != 'bad'"},
+		{"restart", func() error { db = reopen(t, db); return nil }, ""},
+		{"insert failing after restart", func() error { return db.InsertRow("txns", []string{"3", "1", "-1", "ok"}) }, "amount >= 0"},
+		{"update failing after restart", func() error { return db.UpdateRow("txns", "2", map[string]string{"status": "bad"}) }, "status != 'bad'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.write()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("got %v, want the write to pass", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), "CHECK constraint violated") || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got %v, want a CHECK violation on %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	rows, err := db.SelectAll("txns")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string][]string)
+	for _, row := range rows {
+		got[row[0]] = row[2:4]
+	}
+	want := map[string][]string{"1": {"999", "ok"}, "2": {"0", "ok"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("rows = %v, want %v", got, want)
+	}
+}
+
+// TestCheckConstraintSyntax checks that a CHECK whose expression can't be
+// enforced is refused when the table is created
+func TestCheckConstraintSyntax(t *testing.T) {
+	tests := []struct {
+		name    string
+		columns []string
+		wantErr string // "" for a definition that is accepted
+	}{
+		{"column check", []string{"id int", "a int CHECK (a > 0)"}, ""},
+		{"no space before the parenthesis", []string{"id int", "a int CHECK(a > 0)"}, ""},
+		{"table check", []string{"id int", "a int", "CHECK (a > 0)"}, ""},
+		{"column named check", []string{"id int", "check int"}, ""},
+		{"column named check with a length", []string{"id int", "check varchar (10)"}, ""},
+		{"unknown column", []string{"id int", "a int CHECK (b > 0)"}, "column b not found"},
+		{"not a comparison", []string{"id int", "a int CHECK (a)"}, "expected 'column op literal'"},
+		{"column check without parentheses", []string{"id int", "a int CHECK a > 0"}, "must be in parentheses"},
+		{"table check without parentheses", []string{"id int", "a int", "CHECK a > 0"}, "must be in parentheses"},
+		{"check without an expression", []string{"id int", "a int CHECK"}, "must be in parentheses"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			err := db.CreateTable("t", tt.columns)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("CreateTable: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("CreateTable: got %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
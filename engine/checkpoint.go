@@ -0,0 +1,98 @@
+package engine
+
+import (
+	"fmt"
+	"pesapal-ledger/storage"
+)
+
+// Checkpoint saves the index of every table to disk (see
+// storage.IndexCheckpoint), so the next Recover loads it and replays only the
+// rows appended since, instead of scanning whole logs. Compressed and
+// degraded tables are skipped and always scanned in full. Writes wait while
+// the checkpoint is taken.
+func (db *Database) Checkpoint() error {
+	db.writeMu.Lock()
+	defer db.writeMu.Unlock()
+
+	var firstErr error
+	for _, name := range db.AllTables() {
+		if err := db.checkpointTable(name); err != nil {
+			fmt.Printf("Warning: Failed to checkpoint index of table %s: %v\n", name, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+// checkpointTable saves one table's index; callers must hold db.writeMu so
+// the log doesn't grow while its size is taken
+func (db *Database) checkpointTable(tableName string) error {
+	db.mu.RLock()
+	metadata, exists := db.Tables[tableName]
+	_, degraded := db.Degraded[tableName]
+	stats := db.stats[tableName]
+	// A checkpoint of a table with corrupt entries would hide them from the
+	// next load, which only replays what follows it
+	if !exists || degraded || metadata.Compressed || stats == nil || len(stats.corrupt) > 0 {
+		db.mu.RUnlock()
+		return nil
+	}
+
+	index := db.Indexes[tableName]
+	cp := &storage.IndexCheckpoint{
+		Versions:   stats.versions,
+		TotalBytes: stats.totalBytes,
+		MaxID:      stats.maxID,
+		MaxLSN:     db.lsn.Load(),
+		Entries:    make([]storage.IndexEntry, 0, len(index)),
+	}
+	for key, offset := range index {
+		cp.Entries = append(cp.Entries, storage.IndexEntry{Key: key, Offset: offset, Size: stats.rowBytes[key]})
+	}
+	db.mu.RUnlock()
+
+	size, err := storage.TableFileSize(tableName)
+	if err != nil {
+		return err
+	}
+	cp.LogSize = size
+	return storage.WriteIndexCheckpoint(tableName, cp)
+}
+
+// loadCheckpoint rebuilds a table's index and stats from its checkpoint plus
+// the rows appended after it. ok is false when there is no usable
+// checkpoint and the log must be scanned in full.
+func loadCheckpoint(tableName string, metadata TableMetadata) (index Index, stats *tableStats, ok bool, err error) {
+	cp, err := storage.ReadIndexCheckpoint(tableName)
+	if err != nil {
+		fmt.Printf("Warning: Ignoring index checkpoint of table %s: %v\n", tableName, err)
+		return nil, nil, false, nil
+	}
+	if cp == nil {
+		return nil, nil, false, nil
+	}
+
+	index = make(Index, len(cp.Entries))
+	stats = newTableStats()
+	stats.versions = cp.Versions
+	stats.totalBytes = cp.TotalBytes
+	stats.maxID = cp.MaxID
+	stats.maxLSN = cp.MaxLSN
+	for _, e := range cp.Entries {
+		index[e.Key] = e.Offset
+		stats.rowBytes[e.Key] = e.Size
+		stats.liveBytes += e.Size
+	}
+
+	reader, file, err := storage.NewRecordReaderAt(tableName, cp.LogSize)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	defer file.Close()
+	if err := replayLog(tableName, reader, metadata, index, stats); err != nil {
+		return nil, nil, false, err
+	}
+	return index, stats, true, nil
+}
@@ -0,0 +1,54 @@
+package engine
+
+import (
+	"os"
+	"pesapal-ledger/storage"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestDamagedCheckpointFallsBackToScan(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.CreateTable("accounts", []string{"id int", "owner text"}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 50; i++ {
+		if err := db.InsertRow("accounts", []string{strconv.Itoa(i), "1", "owner" + strconv.Itoa(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.DeleteRow("accounts", "7"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Flip a byte in the middle of the checkpoint, so its CRC no longer matches
+	path := strings.TrimSuffix(storage.TableFilePath("accounts"), ".db") + ".idx"
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)/2] ^= 0xff
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, ok, err := loadCheckpoint("accounts", db.Tables["accounts"]); ok || err != nil {
+		t.Fatalf("loadCheckpoint of a damaged checkpoint: ok=%v err=%v, want a fallback", ok, err)
+	}
+
+	db = reopen(t, db)
+	if got := len(db.Indexes["accounts"]); got != 49 {
+		t.Errorf("reloaded index has %d keys, want 49", got)
+	}
+	if _, err := db.FindByID("accounts", "7"); err == nil {
+		t.Error("deleted row 7 is back after the reload")
+	}
+	row, err := db.FindByID("accounts", "50")
+	if err != nil || row[2] != "owner50" {
+		t.Errorf("FindByID(50) = %v, %v", row, err)
+	}
+}
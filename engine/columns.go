@@ -0,0 +1,108 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ColumnError reports a column name that doesn't resolve to exactly one column
+type ColumnError struct {
+	Table   string
+	Column  string
+	Matches []string // the columns an ambiguous name matches; empty when none does
+	Clause  string   // where the name was used, e.g. "ORDER BY"; set by InClause
+}
+
+func (e *ColumnError) Error() string {
+	if e.Clause != "" {
+		if len(e.Matches) == 0 {
+			return fmt.Sprintf("unknown column %s in %s of table %s", e.Column, e.Clause, e.Table)
+		}
+		return fmt.Sprintf("ambiguous column %s in %s of table %s: it matches %s", e.Column, e.Clause, e.Table, strings.Join(e.Matches, " and "))
+	}
+	if len(e.Matches) == 0 {
+		return fmt.Sprintf("column %s not found in table %s", e.Column, e.Table)
+	}
+	return fmt.Sprintf("ambiguous column %s in table %s: it matches %s", e.Column, e.Table, strings.Join(e.Matches, " and "))
+}
+
+// InClause names the clause a ColumnError's column was used in, so the error
+// says where the bad name is. Other errors, and ColumnErrors that already
+// name a clause, are returned as they are.
+func InClause(err error, clause string) error {
+	var colErr *ColumnError
+	if !errors.As(err, &colErr) || colErr.Clause != "" {
+		return err
+	}
+	tagged := *colErr
+	tagged.Clause = clause
+	return &tagged
+}
+
+// IsAmbiguousColumn reports whether err is a ColumnError for a name that
+// matches several columns
+func IsAmbiguousColumn(err error) bool {
+	var colErr *ColumnError
+	return errors.As(err, &colErr) && len(colErr.Matches) > 0
+}
+
+// ResolveColumn returns the position of name in columns. Column names match
+// ignoring case, and an exact match wins: a table created before duplicate
+// names were rejected can have both "name" and "Name", which still resolve,
+// while "NAME" is reported as ambiguous. Every lookup of a column by name
+// goes through here.
+func ResolveColumn(tableName string, columns []string, name string) (int, error) {
+	pos := -1
+	var matches []string
+	for i, col := range columns {
+		if col == name {
+			return i, nil
+		}
+		if strings.EqualFold(col, name) {
+			pos = i
+			matches = append(matches, col)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return -1, &ColumnError{Table: tableName, Column: name}
+	case 1:
+		return pos, nil
+	}
+	return -1, &ColumnError{Table: tableName, Column: name, Matches: matches}
+}
+
+// findColumn resolves a schema column by name and returns it with its
+// position in a stored row
+func findColumn(metadata TableMetadata, name string) (Column, int, error) {
+	schema := metadata.Schema()
+	names := make([]string, len(schema))
+	for i, col := range schema {
+		names[i] = col.Name
+	}
+	i, err := ResolveColumn(metadata.Name, names, name)
+	if err != nil {
+		return Column{}, -1, err
+	}
+	return schema[i], rowPosition(i), nil
+}
+
+// CheckColumns resolves the names used in one clause of a query against the
+// table's schema, so a bad name fails the query before any row is read. The
+// LSN pseudo-column is accepted.
+func (db *Database) CheckColumns(tableName, clause string, names []string) error {
+	columns, err := db.ColumnNames(tableName)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if strings.EqualFold(name, LSNColumn) {
+			continue
+		}
+		if _, err := ResolveColumn(tableName, columns, name); err != nil {
+			return InClause(err, clause)
+		}
+	}
+	return nil
+}
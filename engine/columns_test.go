@@ -0,0 +1,174 @@
+package engine
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"pesapal-ledger/storage"
+)
+
+// TestResolveColumn looks names up ignoring case, with an exact match
+// winning over a case-insensitive one
+func TestResolveColumn(t *testing.T) {
+	columns := []string{"id", "name", "Name", "Amount"}
+	tests := []struct {
+		name      string
+		want      int
+		wantErr   string // "" when the name resolves
+		ambiguous bool
+	}{
+		{"id", 0, "", false},
+		{"ID", 0, "", false},
+		{"amount", 3, "", false},
+		{"AMOUNT", 3, "", false},
+		{"name", 1, "", false},
+		{"Name", 2, "", false},
+		{"NAME", -1, "ambiguous column NAME in table t: it matches name and Name", true},
+		{"nAme", -1, "ambiguous column nAme in table t: it matches name and Name", true},
+		{"missing", -1, "column missing not found in table t", false},
+		{"", -1, "column  not found in table t", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ResolveColumn("t", columns, tt.name)
+			if got != tt.want {
+				t.Errorf("position = %d, want %d", got, tt.want)
+			}
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("ResolveColumn: %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Fatalf("err = %v, want %q", err, tt.wantErr)
+			}
+			if IsAmbiguousColumn(err) != tt.ambiguous {
+				t.Errorf("IsAmbiguousColumn = %v, want %v", !tt.ambiguous, tt.ambiguous)
+			}
+			if tagged := InClause(err, "ORDER BY"); !strings.Contains(tagged.Error(), " in ORDER BY of table t") {
+				t.Errorf("InClause: %v", tagged)
+			}
+		})
+	}
+}
+
+// TestLegacyCaseDuplicates opens a table whose metadata predates the check
+// on names differing only in case and checks that the engine's lookups by
+// name resolve the exact spellings and reject the ambiguous ones
+func TestLegacyCaseDuplicates(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.CreateTable("t", []string{"id int", "name text", "nick text"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.InsertRow("t", []string{"1", "1", "alice", "Al"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// CREATE TABLE refuses the duplicate now, so plant it in the metadata
+	path := filepath.Join(storage.DataDir(), "metadata.json")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"nick text"`) {
+		t.Fatalf("metadata has no nick column: %s", data)
+	}
+	data = []byte(strings.Replace(string(data), `"nick text"`, `"Name text"`, 1))
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateTable("u", []string{"id int", "name text", "Name text"}); err == nil {
+		t.Error("CreateTable accepted names differing only in case")
+	}
+	db = reopen(t, db)
+
+	tests := []struct {
+		column  string
+		value   string
+		want    [][]string
+		wantErr string
+	}{
+		{"name", "alice", [][]string{{"1", "1", "alice", "Al"}}, ""},
+		{"Name", "al", [][]string{{"1", "1", "alice", "Al"}}, ""},
+		{"Name", "alice", nil, ""},
+		{"NAME", "alice", nil, "ambiguous column NAME"},
+		{"nick", "Al", nil, "column nick not found"},
+	}
+	for _, tt := range tests {
+		t.Run("select by "+tt.column, func(t *testing.T) {
+			got, err := db.SelectByColumn("t", tt.column, tt.value)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) == 0 {
+				got = nil
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if err := db.UpdateRow("t", "1", map[string]string{"NAME": "bob"}); err == nil || !IsAmbiguousColumn(err) {
+		t.Errorf("UpdateRow of NAME: err = %v, want an ambiguous column error", err)
+	}
+	if err := db.UpdateRow("t", "1", map[string]string{"Name": "Bo"}); err != nil {
+		t.Fatal(err)
+	}
+	row, err := db.FindByID("t", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"1", "1", "alice", "Bo"}; !reflect.DeepEqual(row, want) {
+		t.Errorf("row after update = %v, want %v", row, want)
+	}
+}
+
+// TestCheckColumns resolves the names of one clause and names the clause in
+// the error
+func TestCheckColumns(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.CreateTable("t", []string{"id int", "amount int"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		clause  string
+		names   []string
+		wantErr string // "" when every name resolves
+	}{
+		{"ORDER BY", []string{"amount"}, ""},
+		{"SELECT list", []string{"ID", "Amount", LSNColumn}, ""},
+		{"GROUP BY", []string{"nope"}, "unknown column nope in GROUP BY of table t"},
+		{"SELECT list", []string{"id", "nope"}, "unknown column nope in SELECT list of table t"},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.names, ","), func(t *testing.T) {
+			err := db.CheckColumns("t", tt.clause, tt.names)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	if err := db.CheckColumns("missing", "ORDER BY", []string{"id"}); !errors.Is(err, ErrTableNotFound) {
+		t.Errorf("unknown table: err = %v, want ErrTableNotFound", err)
+	}
+}
@@ -0,0 +1,116 @@
+package engine
+
+import "errors"
+
+// ErrShuttingDown stops long maintenance work once the server is shutting down
+var ErrShuttingDown = errors.New("the server is shutting down")
+
+// CompactResult reports what compacting one table reclaimed
+type CompactResult struct {
+	Table          string `json:"table"`
+	Rows           int    `json:"rows"` // live rows kept
+	BytesBefore    int64  `json:"bytesBefore"`
+	BytesAfter     int64  `json:"bytesAfter"`
+	ReclaimedBytes int64  `json:"reclaimedBytes"`
+	Skipped        bool   `json:"skipped,omitempty"` // nothing to reclaim, left as is
+	Error          string `json:"error,omitempty"`
+}
+
+// VacuumResult reports a VACUUM: one entry per table in name order. Tables
+// after an interruption or a failure are listed with the error that stopped
+// them.
+type VacuumResult struct {
+	Tables         []CompactResult `json:"tables"`
+	ReclaimedBytes int64           `json:"reclaimedBytes"`
+	Interrupted    bool            `json:"interrupted,omitempty"`
+}
+
+// BeginShutdown tells long maintenance work such as Vacuum to stop at the next
+// safe point. Requests already running are otherwise left to finish.
+func (db *Database) BeginShutdown() {
+	db.shuttingDown.Store(true)
+}
+
+// Compact rewrites a table's log keeping only the current version of each
+// live row, dropping superseded versions and tombstones. The rewrite is
+// atomic (see storage.RewriteTableFile); writes to the table wait for it.
+func (db *Database) Compact(tableName string) (CompactResult, error) {
+	if err := db.checkTableWritable(tableName); err != nil {
+		return CompactResult{}, err
+	}
+
+	db.writeMu.Lock()
+	defer db.writeMu.Unlock()
+	return db.compact(tableName)
+}
+
+// compact is Compact without the write lock; callers must hold db.writeMu
+func (db *Database) compact(tableName string) (CompactResult, error) {
+	purged, err := db.purge(tableName, PurgeCutoff{})
+	if err != nil {
+		return CompactResult{}, err
+	}
+	return CompactResult{
+		Table:          tableName,
+		Rows:           purged.Kept,
+		BytesBefore:    purged.BytesBefore,
+		BytesAfter:     purged.BytesAfter,
+		ReclaimedBytes: purged.BytesBefore - purged.BytesAfter,
+	}, nil
+}
+
+// Vacuum compacts every table, one at a time. Tables without superseded
+// versions or tombstones are skipped without a rewrite. The write lock is
+// taken per table, so writes to other tables go on in between. Vacuum stops
+// between tables once BeginShutdown is called (each table is rewritten
+// atomically, so stopping there is always safe), and after the first table
+// that fails.
+func (db *Database) Vacuum() (VacuumResult, error) {
+	if err := db.checkWritable(); err != nil {
+		return VacuumResult{}, err
+	}
+
+	var result VacuumResult
+	var stopped error
+	for _, name := range db.AllTables() {
+		if stopped == nil && db.shuttingDown.Load() {
+			stopped = ErrShuttingDown
+			result.Interrupted = true
+		}
+		if stopped != nil {
+			result.Tables = append(result.Tables, CompactResult{Table: name, Error: stopped.Error()})
+			continue
+		}
+
+		table, err := db.vacuumTable(name)
+		if err != nil {
+			stopped = err
+			table = CompactResult{Table: name, Error: err.Error()}
+		}
+		result.Tables = append(result.Tables, table)
+		result.ReclaimedBytes += table.ReclaimedBytes
+	}
+	if stopped != nil && !result.Interrupted {
+		return result, stopped
+	}
+	return result, nil
+}
+
+// vacuumTable compacts one table for Vacuum unless it has nothing to reclaim
+func (db *Database) vacuumTable(tableName string) (CompactResult, error) {
+	db.writeMu.Lock()
+	defer db.writeMu.Unlock()
+
+	db.mu.RLock()
+	stats, ok := db.stats[tableName]
+	var total, live int64
+	if ok {
+		total, live = stats.totalBytes, stats.liveBytes
+	}
+	rows := len(db.Indexes[tableName])
+	db.mu.RUnlock()
+	if ok && total == live {
+		return CompactResult{Table: tableName, Rows: rows, BytesBefore: total, BytesAfter: total, Skipped: true}, nil
+	}
+	return db.compact(tableName)
+}
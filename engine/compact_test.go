@@ -0,0 +1,155 @@
+package engine
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"pesapal-ledger/storage"
+)
+
+// TestVacuum fills tables with different amounts of dead rows and checks
+// VACUUM shrinks each file to its live rows, skips the clean table and keeps
+// every live row, also across a restart
+func TestVacuum(t *testing.T) {
+	db := newTestDB(t)
+
+	tables := []struct {
+		name    string
+		format  storage.RecordFormat
+		updates int // rewrites of each row
+		deletes int // rows deleted, from the lowest id up
+		skipped bool
+	}{
+		{"accounts", storage.FormatText, 3, 0, false},
+		{"clean", storage.FormatText, 0, 0, true},
+		{"ledger", storage.FormatBinary, 1, 2, false},
+		{"purged", storage.FormatText, 0, 5, false},
+	}
+	want := make(map[string][][]string)
+	for _, tt := range tables {
+		if err := db.CreateTableWithFormat(tt.name, []string{"id int", "note text"}, tt.format); err != nil {
+			t.Fatal(err)
+		}
+		for id := 1; id <= 5; id++ {
+			if err := db.InsertRow(tt.name, []string{strconv.Itoa(id), "1", "v0"}); err != nil {
+				t.Fatal(err)
+			}
+			for n := 1; n <= tt.updates; n++ {
+				if err := db.UpdateRow(tt.name, strconv.Itoa(id), map[string]string{"note": "v" + strconv.Itoa(n)}); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		for id := 1; id <= tt.deletes; id++ {
+			if err := db.DeleteRow(tt.name, strconv.Itoa(id)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		want[tt.name] = liveRows(t, db, tt.name)
+	}
+
+	before := make(map[string]int64)
+	for _, tt := range tables {
+		size, err := storage.TableFileSize(tt.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		before[tt.name] = size
+	}
+
+	result, err := db.Vacuum()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Interrupted || len(result.Tables) != len(tables) {
+		t.Fatalf("result = %+v, want every table compacted", result)
+	}
+
+	var reclaimed int64
+	for i, tt := range tables {
+		t.Run(tt.name, func(t *testing.T) {
+			got := result.Tables[i]
+			if got.Table != tt.name || got.Skipped != tt.skipped || got.Error != "" {
+				t.Fatalf("result = %+v, want table %s with skipped %v", got, tt.name, tt.skipped)
+			}
+			after, err := storage.TableFileSize(tt.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.BytesBefore != before[tt.name] || got.BytesAfter != after || got.ReclaimedBytes != before[tt.name]-after {
+				t.Errorf("result = %+v, file went from %d to %d bytes", got, before[tt.name], after)
+			}
+			if tt.skipped != (after == before[tt.name]) {
+				t.Errorf("file went from %d to %d bytes, want it shrunk unless skipped", before[tt.name], after)
+			}
+			if got.Rows != len(want[tt.name]) {
+				t.Errorf("rows kept = %d, want %d", got.Rows, len(want[tt.name]))
+			}
+			if records := readRecords(t, tt.name); len(records) != len(want[tt.name]) {
+				t.Errorf("file holds %d records, want only the %d live rows", len(records), len(want[tt.name]))
+			}
+		})
+		reclaimed += result.Tables[i].ReclaimedBytes
+	}
+	if result.ReclaimedBytes != reclaimed || reclaimed == 0 {
+		t.Errorf("total reclaimed = %d, tables add up to %d", result.ReclaimedBytes, reclaimed)
+	}
+
+	db = reopen(t, db)
+	for _, tt := range tables {
+		if got := liveRows(t, db, tt.name); !reflect.DeepEqual(got, want[tt.name]) {
+			t.Errorf("%s after restart = %v, want %v", tt.name, got, want[tt.name])
+		}
+	}
+
+	// A second VACUUM has nothing left to do
+	again, err := db.Vacuum()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range again.Tables {
+		if !table.Skipped {
+			t.Errorf("second VACUUM rewrote %s: %+v", table.Table, table)
+		}
+	}
+}
+
+// TestVacuumShutdown checks that a VACUUM started after BeginShutdown leaves
+// every table untouched and reports it as interrupted
+func TestVacuumShutdown(t *testing.T) {
+	db := newTestDB(t)
+	for _, name := range []string{"a", "b"} {
+		if err := db.CreateTable(name, []string{"id int", "note text"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.InsertRow(name, []string{"1", "1", "x"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.UpdateRow(name, "1", map[string]string{"note": "y"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	db.BeginShutdown()
+	result, err := db.Vacuum()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Interrupted || result.ReclaimedBytes != 0 {
+		t.Errorf("result = %+v, want an interrupted VACUUM reclaiming nothing", result)
+	}
+	for _, table := range result.Tables {
+		if table.Error != ErrShuttingDown.Error() {
+			t.Errorf("%s: error = %q, want %q", table.Table, table.Error, ErrShuttingDown)
+		}
+		if records := readRecords(t, table.Table); len(records) != 2 {
+			t.Errorf("%s holds %d records, want it untouched", table.Table, len(records))
+		}
+	}
+
+	if _, err := db.Compact("missing"); !errors.Is(err, ErrTableNotFound) {
+		t.Errorf("Compact of a missing table: err = %v, want ErrTableNotFound", err)
+	}
+}
@@ -0,0 +1,78 @@
+package engine
+
+import (
+	"fmt"
+	"pesapal-ledger/storage"
+)
+
+// rowReader returns a function that reads the rows at the given offsets.
+// Plain tables seek straight to each offset. Compressed tables can't, so
+// the wanted rows are collected up front in one pass over the log.
+func rowReader(tableName string, offsets []int64) (func(offset int64) ([]string, error), error) {
+	if !storage.IsCompressed(tableName) {
+		return func(offset int64) ([]string, error) {
+			return storage.ReadRow(tableName, offset)
+		}, nil
+	}
+
+	wanted := make(map[int64]bool, len(offsets))
+	for _, offset := range offsets {
+		wanted[offset] = true
+	}
+
+	type result struct {
+		row []string
+		err error
+	}
+	found := make(map[int64]result, len(offsets))
+	err := storage.ScanRows(tableName, func(offset int64, data []string, err error) bool {
+		if wanted[offset] {
+			found[offset] = result{row: data, err: err}
+		}
+		return len(found) < len(wanted)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return func(offset int64) ([]string, error) {
+		res, ok := found[offset]
+		if !ok {
+			return nil, fmt.Errorf("no row at offset %d in compressed table %s", offset, tableName)
+		}
+		return res.row, res.err
+	}, nil
+}
+
+// SetCompression converts a table's log to gzip-compressed storage, or back.
+// Compressed tables take less disk but every read scans the whole log, so
+// this is meant for cold or archived tables.
+func (db *Database) SetCompression(tableName string, compressed bool) error {
+	if err := db.checkTableWritable(tableName); err != nil {
+		return err
+	}
+
+	db.writeMu.Lock()
+	defer db.writeMu.Unlock()
+
+	db.mu.RLock()
+	metadata, exists := db.Tables[tableName]
+	db.mu.RUnlock()
+	if !exists {
+		return TableNotExist(tableName)
+	}
+
+	if err := storage.ConvertTableFile(tableName, compressed); err != nil {
+		return err
+	}
+
+	db.mu.Lock()
+	metadata.Compressed = compressed
+	db.Tables[tableName] = metadata
+	db.mu.Unlock()
+
+	if err := db.SaveMetadata(); err != nil {
+		return fmt.Errorf("failed to save metadata: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package engine
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"pesapal-ledger/storage"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// gzipMagic starts every gzip stream
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// TestCompressedTableRoundTrip converts a table to gzip storage and back,
+// writing to it in between, and checks its rows survive each step and a
+// restart
+func TestCompressedTableRoundTrip(t *testing.T) {
+	for _, format := range []storage.RecordFormat{storage.FormatText, storage.FormatBinary} {
+		t.Run(string(format), func(t *testing.T) {
+			db := newTestDB(t)
+			if err := db.CreateTableWithFormat("archive", []string{"id int", "memo text"}, format); err != nil {
+				t.Fatal(err)
+			}
+			for _, row := range [][]string{{"1", "1", "alpha"}, {"2", "1", "beta"}, {"3", "1", "gamma"}} {
+				if err := db.InsertRow("archive", row); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := db.SetCompression("archive", true); err != nil {
+				t.Fatal(err)
+			}
+
+			steps := []struct {
+				name  string
+				write func() error
+				want  [][]string
+			}{
+				{"compress", func() error { return nil },
+					[][]string{{"1", "alpha"}, {"2", "beta"}, {"3", "gamma"}}},
+				{"insert", func() error { return db.InsertRow("archive", []string{"4", "1", "delta"}) },
+					[][]string{{"1", "alpha"}, {"2", "beta"}, {"3", "gamma"}, {"4", "delta"}}},
+				{"update", func() error { return db.UpdateRow("archive", "2", map[string]string{"memo": "BETA"}) },
+					[][]string{{"1", "alpha"}, {"2", "BETA"}, {"3", "gamma"}, {"4", "delta"}}},
+				{"delete", func() error { return db.DeleteRow("archive", "1") },
+					[][]string{{"2", "BETA"}, {"3", "gamma"}, {"4", "delta"}}},
+				{"restart", func() error { db = reopen(t, db); return nil },
+					[][]string{{"2", "BETA"}, {"3", "gamma"}, {"4", "delta"}}},
+				{"decompress", func() error { return db.SetCompression("archive", false) },
+					[][]string{{"2", "BETA"}, {"3", "gamma"}, {"4", "delta"}}},
+			}
+			for _, step := range steps {
+				if err := step.write(); err != nil {
+					t.Fatalf("%s: %v", step.name, err)
+				}
+				if got := liveRows(t, db, "archive"); !reflect.DeepEqual(got, step.want) {
+					t.Errorf("after %s: rows = %v, want %v", step.name, got, step.want)
+				}
+
+				data, err := os.ReadFile(storage.TableFilePath("archive"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				wantCompressed := step.name != "decompress"
+				if bytes.HasPrefix(data, gzipMagic) != wantCompressed {
+					t.Errorf("after %s: file compressed = %v, want %v", step.name, !wantCompressed, wantCompressed)
+				}
+				_, err = storage.ReadRow("archive", 0)
+				if errors.Is(err, storage.ErrCompressedSeek) != wantCompressed {
+					t.Errorf("after %s: ReadRow at offset 0: %v", step.name, err)
+				}
+			}
+		})
+	}
+}
+
+// liveRows returns the id and memo of every live row of a table, by id
+func liveRows(t *testing.T, db *Database, tableName string) [][]string {
+	t.Helper()
+	rows, err := db.SelectAll(tableName)
+	if err != nil {
+		t.Fatalf("SelectAll: %v", err)
+	}
+	var out [][]string
+	for _, row := range rows {
+		out = append(out, []string{row[0], row[2]})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i][0] < out[j][0] })
+	return out
+}
@@ -0,0 +1,92 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"pesapal-ledger/storage"
+	"strconv"
+	"strings"
+)
+
+// SkippedRow is a row a scan left out because it failed its checksum. Key is
+// empty for a record skipped when the log was loaded, whose key can't be
+// trusted.
+type SkippedRow struct {
+	Table  string `json:"table"`
+	Key    string `json:"key,omitempty"`
+	Offset int64  `json:"offset"`
+}
+
+// skipCorrupt reports whether a scan should go on without the row at offset,
+// which failed to read with err. Only checksum failures are skipped, and only
+// with SkipCorruptRows set; the row is recorded in trace so the caller can
+// warn that the results are partial.
+func (db *Database) skipCorrupt(trace *Trace, tableName, key string, offset int64, err error) bool {
+	if !db.SkipCorruptRows || !errors.Is(err, storage.ErrTampered) {
+		return false
+	}
+	fmt.Printf("Warning: skipping corrupt row %s at offset %d of table %s: %v\n", displayKey(key), offset, tableName, err)
+	trace.skip(SkippedRow{Table: tableName, Key: displayKey(key), Offset: offset})
+	return true
+}
+
+// checkLoadedCorrupt vets a read of a table whose log had records failing
+// their checksum when it was loaded. Those records are not in the index, so a
+// damaged update or delete leaves its key at the version before it, and the
+// read would return that version without a word. The read fails, as a scan
+// meeting a corrupt row does, unless SkipCorruptRows is set; then it goes on
+// and the records are reported in trace.
+func (db *Database) checkLoadedCorrupt(tableName string, trace *Trace) error {
+	db.mu.RLock()
+	var offsets []int64
+	if stats, ok := db.stats[tableName]; ok {
+		offsets = append(offsets, stats.corrupt...)
+	}
+	db.mu.RUnlock()
+	if len(offsets) == 0 {
+		return nil
+	}
+
+	if !db.SkipCorruptRows {
+		return fmt.Errorf("table %s had %d corrupt record(s) at offsets %s when its log was loaded; rows they updated or deleted may show an older version: %w",
+			tableName, len(offsets), joinOffsets(offsets), storage.ErrTampered)
+	}
+	for _, offset := range offsets {
+		trace.skip(SkippedRow{Table: tableName, Offset: offset})
+	}
+	return nil
+}
+
+// joinOffsets lists file offsets for messages
+func joinOffsets(offsets []int64) string {
+	list := make([]string, len(offsets))
+	for i, offset := range offsets {
+		list[i] = strconv.FormatInt(offset, 10)
+	}
+	return strings.Join(list, ", ")
+}
+
+// skip records a skipped row once, however many reads of the query meet it
+func (t *Trace) skip(row SkippedRow) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, seen := range t.skipped {
+		if seen.Table == row.Table && seen.Offset == row.Offset {
+			return
+		}
+	}
+	t.skipped = append(t.skipped, row)
+}
+
+// Skipped returns the corrupt rows the query left out, in the order met
+func (t *Trace) Skipped() []SkippedRow {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]SkippedRow(nil), t.skipped...)
+}
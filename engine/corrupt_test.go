@@ -0,0 +1,98 @@
+package engine
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"pesapal-ledger/storage"
+	"testing"
+)
+
+// reopen recovers a second Database from the files db wrote, as a restart would
+func reopen(t testing.TB, db *Database) *Database {
+	t.Helper()
+	storage.CloseWriters()
+	reopened := NewDatabase()
+	reopened.StrictRows = db.StrictRows
+	reopened.SkipCorruptRows = db.SkipCorruptRows
+	if err := reopened.Recover(); err != nil {
+		t.Fatal(err)
+	}
+	return reopened
+}
+
+// damage flips a byte of the table file inside the first occurrence of value
+func damage(t *testing.T, tableName, value string) {
+	t.Helper()
+	path := storage.TableFilePath(tableName)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := bytes.Index(data, []byte(value))
+	if at < 0 {
+		t.Fatalf("%q is not in %s", value, path)
+	}
+	data[at] ^= 0x01
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCorruptUpdateAfterReload(t *testing.T) {
+	for _, skip := range []bool{false, true} {
+		name := "strict"
+		if skip {
+			name = "skip corrupt rows"
+		}
+		t.Run(name, func(t *testing.T) {
+			db := newTestDB(t)
+			db.SkipCorruptRows = skip
+			if err := db.CreateTable("accounts", []string{"id int", "owner text"}); err != nil {
+				t.Fatal(err)
+			}
+			if err := db.InsertRow("accounts", []string{"1", "1", "alice"}); err != nil {
+				t.Fatal(err)
+			}
+			if err := db.UpdateRow("accounts", "1", map[string]string{"owner": "mallory"}); err != nil {
+				t.Fatal(err)
+			}
+			damage(t, "accounts", "mallory")
+			db = reopen(t, db)
+
+			stats, err := db.Stats("accounts")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(stats.CorruptOffsets) != 1 {
+				t.Errorf("CorruptOffsets = %v, want the update", stats.CorruptOffsets)
+			}
+			infos := db.TableInfos()
+			if len(infos) != 1 || !infos[0].Degraded {
+				t.Errorf("TableInfos = %+v, want accounts degraded", infos)
+			}
+
+			trace := &Trace{}
+			rows, err := db.selectAll("accounts", trace)
+			if !skip {
+				// The damaged update must not quietly bring back alice
+				if !errors.Is(err, storage.ErrTampered) {
+					t.Fatalf("SelectAll = %v, %v; want ErrTampered", rows, err)
+				}
+				if _, err := db.FindByID("accounts", "1"); !errors.Is(err, storage.ErrTampered) {
+					t.Errorf("FindByID: got %v, want ErrTampered", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rows) != 1 || rows[0][2] != "alice" {
+				t.Errorf("SelectAll = %v, want the intact version", rows)
+			}
+			if skipped := trace.Skipped(); len(skipped) != 1 || skipped[0].Offset != stats.CorruptOffsets[0] {
+				t.Errorf("Skipped = %v, want the corrupt update reported", skipped)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"pesapal-ledger/storage"
+)
+
+// TestDataDirsAreSeparate opens a database in each of two data directories,
+// as two instances on one machine would, and checks that each keeps its own
+// metadata and rows across a restart
+func TestDataDirsAreSeparate(t *testing.T) {
+	newTestDB(t)
+	dirs := []struct {
+		dir    string
+		tables []string
+		owner  string
+	}{
+		{filepath.Join(t.TempDir(), "first"), []string{"accounts"}, "alice"},
+		{filepath.Join(t.TempDir(), "second"), []string{"accounts", "ledger"}, "bob"},
+	}
+	for _, d := range dirs {
+		if err := storage.SetDataDir(d.dir); err != nil {
+			t.Fatal(err)
+		}
+		db := NewDatabase()
+		if err := db.Recover(); err != nil {
+			t.Fatal(err)
+		}
+		if tables := db.ListTables(); len(tables) != 0 {
+			t.Fatalf("%s: a new data directory has tables %v", d.dir, tables)
+		}
+		for _, table := range d.tables {
+			if err := db.CreateTable(table, []string{"id int", "owner text"}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := db.InsertRow("accounts", []string{"1", "1", d.owner}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, d := range dirs {
+		t.Run(filepath.Base(d.dir), func(t *testing.T) {
+			if err := storage.SetDataDir(d.dir); err != nil {
+				t.Fatal(err)
+			}
+			db := reopen(t, NewDatabase())
+			if got := db.ListTables(); !reflect.DeepEqual(got, d.tables) {
+				t.Errorf("tables = %v, want %v", got, d.tables)
+			}
+			if row, err := db.FindByID("accounts", "1"); err != nil || row[2] != d.owner {
+				t.Errorf("row 1 = %v, %v; want %s", row, err, d.owner)
+			}
+			for _, name := range []string{"metadata.json", "accounts.db"} {
+				if _, err := os.Stat(filepath.Join(d.dir, name)); err != nil {
+					t.Errorf("%s not in the data directory: %v", name, err)
+				}
+			}
+		})
+	}
+	if _, err := os.Stat(filepath.Join(storage.DefaultDataDir, "metadata.json")); err == nil {
+		t.Errorf("metadata.json was written to the default %s directory", storage.DefaultDataDir)
+	}
+}
@@ -1,17 +1,55 @@
 package engine
 
 import (
-	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"pesapal-ledger/storage"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 )
 
+// ErrMaintenance is returned by every write while maintenance mode is on
+var ErrMaintenance = errors.New("database is in maintenance mode: writes are temporarily disabled")
+
+// ErrTableDegraded is returned by writes to a table that recovered with
+// problems, such as a missing data file (see Database.Degraded)
+var ErrTableDegraded = errors.New("table is degraded")
+
+// reasonFileMissing is the Degraded reason of a table listed in metadata
+// whose data file is gone. RestoreTable clears it.
+const reasonFileMissing = "data file missing"
+
+// ErrRowNotFound is returned by FindByID for a key with no live row
+var ErrRowNotFound = errors.New("not found")
+
+// ErrDuplicateKey is returned by an insert whose key already has a live row.
+// Only INSERT ... ON CONFLICT replaces an existing row.
+var ErrDuplicateKey = errors.New("already exists")
+
+// ErrTableNotFound matches every error about a table that doesn't exist:
+// those of Reindex, BackupTable and RestoreTable wrap it, and the others
+// are TableNotExist errors
+var ErrTableNotFound = errors.New("table not found")
+
+// tableNotExist is the "table x does not exist" error
+type tableNotExist string
+
+func (e tableNotExist) Error() string { return fmt.Sprintf("table %s does not exist", string(e)) }
+
+func (e tableNotExist) Is(target error) bool { return target == ErrTableNotFound }
+
+// TableNotExist returns the error for a statement naming a table that
+// doesn't exist; errors.Is matches it with ErrTableNotFound
+func TableNotExist(tableName string) error {
+	return tableNotExist(tableName)
+}
+
 // Index maps Primary Key (string) -> File Offset (int64)
 type Index map[string]int64
 
@@ -19,6 +57,20 @@ type Index map[string]int64
 type TableMetadata struct {
 	Name    string
 	Columns []string
+	// Compressed tables keep their log gzip-compressed and are read by full scan
+	Compressed bool `json:",omitempty"`
+	// Format is the record format of the log file; empty means text
+	Format storage.RecordFormat `json:",omitempty"`
+	// Checks holds the table-level CHECK expressions; column-level ones stay
+	// in their column definition
+	Checks []string `json:",omitempty"`
+	// PrimaryKey lists the columns of a declared "PRIMARY KEY (a, b)"; empty
+	// means the table is keyed on its first column
+	PrimaryKey []string `json:",omitempty"`
+	// SchemaVersion goes up with each schema change that rewrites the rows,
+	// such as DROP COLUMN; it names the staged file of an unfinished one
+	// (see storage.StageTransformTableFile)
+	SchemaVersion int `json:",omitempty"`
 }
 
 // Database represents the in-memory state of the database
@@ -27,41 +79,132 @@ type Database struct {
 	Indexes map[string]Index
 	// Metadata maps Table Name -> Metadata
 	Tables map[string]TableMetadata
+	// Ordered maps Table Name -> live primary keys in id order (for range scans)
+	Ordered map[string]*OrderedKeys
+	// Degraded maps Table Name -> reason, for tables that recovered with problems
+	Degraded map[string]string
 	// Mutex to protect concurrent access to the indexes
 	mu sync.RWMutex
+	// writeMu serializes row mutations so read-modify-write operations
+	// (update, delete, upsert) see a stable current row
+	writeMu sync.Mutex
+	// maintenance rejects all writes while set (reads keep working)
+	maintenance atomic.Bool
+	// shuttingDown stops long maintenance such as Vacuum (see BeginShutdown)
+	shuttingDown atomic.Bool
+	// stats maps Table Name -> planner statistics, kept up to date on writes
+	stats map[string]*tableStats
+	// Limits caps the number of tables and columns CreateTable accepts
+	Limits Limits
+	// lsn is the last log sequence number handed out (see stampLSN)
+	lsn atomic.Int64
+	// StrictRows makes reads fail on rows whose field count doesn't match
+	// the schema instead of truncating them (see fitRow)
+	StrictRows bool
+	// SkipCorruptRows makes scans leave out rows that fail their checksum
+	// instead of failing the query (see skipCorrupt)
+	SkipCorruptRows bool
+	// Paranoid makes reads check that a table file wasn't changed from
+	// outside the server since it was indexed, and rebuild the index if it
+	// was (see checkTableFile). Set it before Recover.
+	Paranoid bool
+	// txn is the journal of the running transaction, if any; guarded by
+	// writeMu, which the transaction holds until it ends (see Begin)
+	txn *storage.Journal
 }
 
 // NewDatabase initializes a new Database instance
 func NewDatabase() *Database {
 	return &Database{
-		Indexes: make(map[string]Index),
-		Tables:  make(map[string]TableMetadata),
+		Indexes:  make(map[string]Index),
+		Tables:   make(map[string]TableMetadata),
+		Ordered:  make(map[string]*OrderedKeys),
+		Degraded: make(map[string]string),
+		stats:    make(map[string]*tableStats),
+		Limits:   DefaultLimits,
 	}
 }
 
+// SetMaintenance turns maintenance mode on or off
+func (db *Database) SetMaintenance(enabled bool) {
+	db.maintenance.Store(enabled)
+}
+
+// InMaintenance reports whether maintenance mode is on
+func (db *Database) InMaintenance() bool {
+	return db.maintenance.Load()
+}
+
+// checkWritable is the central gate every write path passes through
+func (db *Database) checkWritable() error {
+	if db.maintenance.Load() {
+		return ErrMaintenance
+	}
+	return nil
+}
+
+// checkTableWritable is checkWritable for a write to one table. Degraded
+// tables refuse writes: appending to a table whose data file went missing
+// would recreate the file empty, and the lost rows would pass as deleted.
+func (db *Database) checkTableWritable(tableName string) error {
+	if err := db.checkWritable(); err != nil {
+		return err
+	}
+	db.mu.RLock()
+	reason, degraded := db.Degraded[tableName]
+	db.mu.RUnlock()
+	if degraded {
+		return fmt.Errorf("%w: %s (%s); writes are refused until it is repaired", ErrTableDegraded, tableName, reason)
+	}
+	return nil
+}
+
+// TableInfo describes a table and its health for status listings
+type TableInfo struct {
+	Name     string `json:"name"`
+	Degraded bool   `json:"degraded"`
+	Reason   string `json:"reason,omitempty"`
+}
+
 // SaveMetadata persists the table schemas to disk
 func (db *Database) SaveMetadata() error {
 	db.mu.RLock()
 	defer db.mu.RUnlock()
 
 	// Ensure data directory exists
-	if err := os.MkdirAll("data", 0755); err != nil {
+	if err := os.MkdirAll(storage.DataDir(), 0755); err != nil {
 		return fmt.Errorf("failed to create data directory: %w", err)
 	}
 
-	filePath := filepath.Join("data", "metadata.json")
-	file, err := os.Create(filePath)
+	// Write a temporary file and rename it over the old one, so a crash or a
+	// failed write leaves the previous metadata whole
+	filePath := filepath.Join(storage.DataDir(), "metadata.json")
+	tmpPath := filePath + ".tmp"
+	file, err := os.Create(tmpPath)
 	if err != nil {
 		return fmt.Errorf("failed to create metadata file: %w", err)
 	}
-	defer file.Close()
 
 	encoder := json.NewEncoder(file)
 	encoder.SetIndent("", "  ")
-	if err := encoder.Encode(db.Tables); err != nil {
-		return fmt.Errorf("failed to encode metadata: %w", err)
+	err = encoder.Encode(db.Tables)
+	if err != nil {
+		err = fmt.Errorf("failed to encode metadata: %w", err)
+	} else if err = file.Sync(); err != nil {
+		err = fmt.Errorf("failed to sync metadata file: %w", err)
+	}
+	if closeErr := file.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to write metadata file: %w", closeErr)
+	}
+	if err == nil {
+		if err = os.Rename(tmpPath, filePath); err != nil {
+			err = fmt.Errorf("failed to replace metadata file: %w", err)
+		}
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
 	}
-
 	return nil
 }
 
@@ -70,7 +213,7 @@ func (db *Database) LoadMetadata() error {
 	db.mu.Lock()
 	defer db.mu.Unlock()
 
-	filePath := filepath.Join("data", "metadata.json")
+	filePath := filepath.Join(storage.DataDir(), "metadata.json")
 	file, err := os.Open(filePath)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -85,10 +228,27 @@ func (db *Database) LoadMetadata() error {
 	}
 
 	// Initialize indexes for loaded tables
-	for name := range db.Tables {
+	for name, metadata := range db.Tables {
+		storage.SetCompressed(name, metadata.Compressed)
+		storage.SetFormat(name, metadata.Format)
+		// A crash in the middle of a schema change leaves its new file
+		// staged; the saved metadata says whether it counts
+		finished, err := storage.RecoverStagedTableFile(name, metadata.SchemaVersion)
+		if err != nil {
+			return err
+		}
+		if finished {
+			fmt.Printf("Warning: finished the interrupted schema change of table %s\n", name)
+		}
 		if _, exists := db.Indexes[name]; !exists {
 			db.Indexes[name] = make(Index)
 		}
+		if _, exists := db.Ordered[name]; !exists {
+			db.Ordered[name] = &OrderedKeys{}
+		}
+		if _, exists := db.stats[name]; !exists {
+			db.stats[name] = newTableStats()
+		}
 	}
 
 	return nil
@@ -101,10 +261,20 @@ func (db *Database) Recover() error {
 		return fmt.Errorf("failed to load metadata: %w", err)
 	}
 
+	// A transaction interrupted before its commit marker is undone before
+	// the indexes are built from the files
+	rolledBack, err := storage.RecoverJournal()
+	if err != nil {
+		return fmt.Errorf("failed to recover transaction journal: %w", err)
+	}
+	if len(rolledBack) > 0 {
+		fmt.Printf("Warning: rolled back uncommitted transaction on tables %s\n", strings.Join(rolledBack, ", "))
+	}
+
 	// 2. Load Indexes for each table
 	// We iterate over a copy of keys to avoid locking issues if LoadIndex locks
 	// LoadMetadata already populated db.Tables keys.
-	
+
 	// We need to read tables safely
 	db.mu.RLock()
 	var tables []string
@@ -114,85 +284,230 @@ func (db *Database) Recover() error {
 	db.mu.RUnlock()
 
 	for _, name := range tables {
+		// A table in metadata without its data file means the log was lost.
+		// Don't let it pass as an empty table.
+		exists, err := storage.TableFileExists(name)
+		if err != nil {
+			fmt.Printf("Warning: Failed to check data file for table %s: %v\n", name, err)
+		} else if !exists {
+			fmt.Printf("Warning: DATA LOSS: table %s is listed in metadata but its data file is missing; marking it degraded\n", name)
+			db.mu.Lock()
+			db.Degraded[name] = reasonFileMissing
+			db.mu.Unlock()
+		}
+
 		if err := db.LoadIndex(name); err != nil {
 			fmt.Printf("Warning: Failed to load index for table %s: %v\n", name, err)
 			// Continue recovering other tables
 		}
 	}
 
+	if err := db.recoverLSN(); err != nil {
+		return fmt.Errorf("failed to recover LSN: %w", err)
+	}
 	return nil
 }
 
 // CreateTable creates a new table with the given name and columns
 func (db *Database) CreateTable(name string, columns []string) error {
+	return db.CreateTableWithFormat(name, columns, storage.FormatText)
+}
+
+// CreateTableWithFormat creates a new table whose log uses the given record format.
+// Creates are serialized with writes, so of several concurrent creates of one
+// table exactly one succeeds and the others get "already exists".
+func (db *Database) CreateTableWithFormat(name string, columns []string, format storage.RecordFormat) error {
+	_, err := db.createTable(name, columns, format, false)
+	return err
+}
+
+// CreateResult reports what a create did
+type CreateResult struct {
+	Table string `json:"table"`
+	// Created is false when the table already existed and was left alone
+	Created bool `json:"created"`
+	// Adopted is set when the table was new to the metadata but its file
+	// was already there (left by a crash before the metadata was saved, say)
+	// and its rows were loaded
+	Adopted bool `json:"adopted,omitempty"`
+}
+
+// CreateTableIfNotExists is CreateTableWithFormat that leaves an existing
+// table alone instead of failing; the result tells which happened. The
+// schema of an existing table isn't compared with columns.
+func (db *Database) CreateTableIfNotExists(name string, columns []string, format storage.RecordFormat) (CreateResult, error) {
+	return db.createTable(name, columns, format, true)
+}
+
+// createTable creates a table; with ifNotExists an existing table of that
+// name is reported rather than an error
+func (db *Database) createTable(name string, columns []string, format storage.RecordFormat, ifNotExists bool) (CreateResult, error) {
+	result := CreateResult{Table: name}
+	if err := db.checkWritable(); err != nil {
+		return CreateResult{}, err
+	}
+
+	// Table-level "CHECK (expr)" and "PRIMARY KEY (cols)" entries are
+	// constraints, not columns
+	var checks, primaryKey []string
+	var colDefs []string
+	for _, colDef := range columns {
+		if expr, ok := tableCheck(colDef); ok {
+			checks = append(checks, expr)
+		} else if keyColumns, ok := tablePrimaryKey(colDef); ok {
+			if primaryKey != nil {
+				return CreateResult{}, fmt.Errorf("invalid schema for table %s: more than one PRIMARY KEY", name)
+			}
+			primaryKey = keyColumns
+		} else {
+			colDefs = append(colDefs, colDef)
+		}
+	}
+	columns = colDefs
+
+	if err := validateTableName(name); err != nil {
+		return CreateResult{}, err
+	}
+	if err := validateColumns(columns); err != nil {
+		return CreateResult{}, fmt.Errorf("invalid schema for table %s: %w", name, err)
+	}
+	if err := db.Limits.checkColumnLimit(name, len(columns)); err != nil {
+		return CreateResult{}, err
+	}
+	if err := validateChecks(TableMetadata{Name: name, Columns: columns, Checks: checks}); err != nil {
+		return CreateResult{}, fmt.Errorf("invalid schema for table %s: %w", name, err)
+	}
+	if err := validatePrimaryKey(TableMetadata{Name: name, Columns: columns, PrimaryKey: primaryKey}); err != nil {
+		return CreateResult{}, fmt.Errorf("invalid schema for table %s: %w", name, err)
+	}
+
+	// writeMu also keeps two SaveMetadata calls from writing the file at once
+	db.writeMu.Lock()
+	defer db.writeMu.Unlock()
+
 	db.mu.Lock()
 	// No defer unlock because we need to unlock before SaveMetadata
 
 	if _, exists := db.Tables[name]; exists {
 		db.mu.Unlock()
-		return fmt.Errorf("table %s already exists", name)
+		if ifNotExists {
+			return result, nil
+		}
+		return CreateResult{}, fmt.Errorf("table %s already exists", name)
+	}
+	if err := db.checkTableLimit(name); err != nil {
+		db.mu.Unlock()
+		return CreateResult{}, err
 	}
 
 	// Initialize metadata
-	db.Tables[name] = TableMetadata{
-		Name:    name,
-		Columns: columns,
+	metadata := TableMetadata{
+		Name:       name,
+		Columns:    columns,
+		Checks:     checks,
+		PrimaryKey: primaryKey,
+	}
+	if format == storage.FormatBinary {
+		metadata.Format = format
 	}
+	db.Tables[name] = metadata
+	storage.SetFormat(name, format)
+	storage.SetCompressed(name, false)
 
 	// Initialize index
 	db.Indexes[name] = make(Index)
+	db.Ordered[name] = &OrderedKeys{}
+	db.stats[name] = newTableStats()
 
 	// Ensure the underlying file exists
 	if err := storage.CreateTableFile(name); err != nil {
 		// Check if error is "already exists"
 		if strings.Contains(err.Error(), "already exists") {
-			// If file exists, load index
+			// A file left without metadata (by a crash before SaveMetadata,
+			// say); adopt it and load its index
 			file, errOpen := storage.OpenTableFile(name)
 			if errOpen == nil {
 				defer file.Close()
-				scanner := bufio.NewScanner(file)
-				var offset int64 = 0
-				for scanner.Scan() {
-					line := scanner.Text()
-					lineLen := int64(len(line) + 1)
-					parts := strings.Split(line, "|")
-					if len(parts) >= 2 {
-						id := parts[0]
-						activeFlag := parts[1]
-						if activeFlag == "1" {
-							db.Indexes[name][id] = offset
-						} else if activeFlag == "0" {
-							delete(db.Indexes[name], id)
-						}
-					}
-					offset += lineLen
+				if index, stats, err := scanLog(name, file, db.Tables[name]); err == nil {
+					db.Indexes[name] = index
+					db.Ordered[name] = newOrderedKeys(index)
+					db.stats[name] = stats
+					db.observeLSN(stats.maxLSN)
+					warnCorrupt(name, stats)
 				}
 			}
-			
+
 			db.mu.Unlock()
-			if err := db.SaveMetadata(); err != nil {
-				return fmt.Errorf("failed to save metadata: %w", err)
+			if err := db.saveCreatedTable(name); err != nil {
+				return CreateResult{}, err
 			}
-			return nil
+			result.Created, result.Adopted = true, true
+			return result, nil
 		}
-		
+
 		// Real error
-		delete(db.Tables, name)
-		delete(db.Indexes, name)
+		db.forgetTable(name)
 		db.mu.Unlock()
-		return fmt.Errorf("failed to create table file: %w", err)
+		return CreateResult{}, fmt.Errorf("failed to create table file: %w", err)
 	}
 
 	db.mu.Unlock()
+	if err := db.saveCreatedTable(name); err != nil {
+		return CreateResult{}, err
+	}
+	result.Created = true
+	return result, nil
+}
+
+// saveCreatedTable saves the metadata after a table was added. If that fails
+// the table is dropped from memory again, so it doesn't exist until restart
+// only; its file stays and is adopted by the next create of the same name.
+// Callers must hold db.writeMu.
+func (db *Database) saveCreatedTable(name string) error {
 	if err := db.SaveMetadata(); err != nil {
+		db.mu.Lock()
+		db.forgetTable(name)
+		db.mu.Unlock()
 		return fmt.Errorf("failed to save metadata: %w", err)
 	}
-
+	db.watchTableFile(name)
 	return nil
 }
 
-// ListTables returns a list of all table names
+// forgetTable removes a table from memory. Callers must hold db.mu.
+func (db *Database) forgetTable(name string) {
+	delete(db.Tables, name)
+	delete(db.Indexes, name)
+	delete(db.Ordered, name)
+	delete(db.stats, name)
+	storage.SetFormat(name, storage.FormatText)
+	storage.SetCompressed(name, false)
+}
+
+// Table returns the metadata of a table and whether it exists
+func (db *Database) Table(name string) (TableMetadata, bool) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	metadata, exists := db.Tables[name]
+	return metadata, exists
+}
+
+// ListTables returns the names of the user tables; system tables are left
+// out (see AllTables)
 func (db *Database) ListTables() []string {
+	tables := db.AllTables()
+	user := tables[:0]
+	for _, name := range tables {
+		if !IsSystemTable(name) {
+			user = append(user, name)
+		}
+	}
+	return user
+}
+
+// AllTables returns the names of all tables, system tables included
+func (db *Database) AllTables() []string {
 	db.mu.RLock()
 	defer db.mu.RUnlock()
 
@@ -200,64 +515,85 @@ func (db *Database) ListTables() []string {
 	for name := range db.Tables {
 		tables = append(tables, name)
 	}
-	
+
 	// Sort for consistent output
 	sort.Strings(tables)
 	return tables
 }
 
+// TableInfos returns every user table with its health status, sorted by name
+func (db *Database) TableInfos() []TableInfo {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	infos := make([]TableInfo, 0, len(db.Tables))
+	for name := range db.Tables {
+		if IsSystemTable(name) {
+			continue
+		}
+		reason, degraded := db.Degraded[name]
+		if !degraded {
+			reason = db.stats[name].corruptReason()
+			degraded = reason != ""
+		}
+		infos = append(infos, TableInfo{Name: name, Degraded: degraded, Reason: reason})
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+	return infos
+}
+
 // LoadIndex rebuilds the in-memory index from the log file on startup
 func (db *Database) LoadIndex(tableName string) error {
 	db.mu.Lock()
 	defer db.mu.Unlock()
+	db.watchTableFile(tableName)
 
 	// Initialize index for this table if it doesn't exist
 	if _, exists := db.Indexes[tableName]; !exists {
 		db.Indexes[tableName] = make(Index)
 	}
+	if _, exists := db.Ordered[tableName]; !exists {
+		db.Ordered[tableName] = &OrderedKeys{}
+	}
+
+	// A checkpoint spares the full scan: only the rows after it are replayed
+	if index, stats, ok, err := loadCheckpoint(tableName, db.Tables[tableName]); err != nil {
+		return fmt.Errorf("error reading table file %s: %w", tableName, err)
+	} else if ok {
+		db.Indexes[tableName] = index
+		db.Ordered[tableName] = newOrderedKeys(index)
+		db.stats[tableName] = stats
+		db.observeLSN(stats.maxLSN)
+		warnCorrupt(tableName, stats)
+		return nil
+	}
 
 	file, err := storage.OpenTableFile(tableName)
 	if err != nil {
-		// If file doesn't exist, that's fine, we just start fresh. 
+		// If file doesn't exist, that's fine, we just start fresh.
 		// But if it's another error, we should return it.
-        // For now, let's treat "not exist" as empty table.
-        // We'll verify error type string or check wrapped error if possible, 
-        // but simple check is: if error, maybe just return nil if it's "not exist"
-        // Let's pass the error up for now, caller decides.
-        // Actually, if it's a new table, file won't exist.
+		// For now, let's treat "not exist" as empty table.
+		// We'll verify error type string or check wrapped error if possible,
+		// but simple check is: if error, maybe just return nil if it's "not exist"
+		// Let's pass the error up for now, caller decides.
+		// Actually, if it's a new table, file won't exist.
 		return nil // Assume new table
 	}
 	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
-	var offset int64 = 0
-
-	for scanner.Scan() {
-		line := scanner.Text()
-		lineLen := int64(len(line) + 1) // +1 for newline
-
-		parts := strings.Split(line, "|")
-		if len(parts) < 2 {
-			offset += lineLen
-			continue
-		}
-
-		id := parts[0]
-		activeFlag := parts[1]
-
-		if activeFlag == "1" {
-			db.Indexes[tableName][id] = offset
-		} else if activeFlag == "0" {
-			delete(db.Indexes[tableName], id)
-		}
-
-		offset += lineLen
-	}
-
-	if err := scanner.Err(); err != nil {
+	index, stats, err := scanLog(tableName, file, db.Tables[tableName])
+	if err != nil {
 		return fmt.Errorf("error reading table file %s: %w", tableName, err)
 	}
 
+	db.Indexes[tableName] = index
+	db.Ordered[tableName] = newOrderedKeys(index)
+	db.stats[tableName] = stats
+	db.observeLSN(stats.maxLSN)
+	warnCorrupt(tableName, stats)
 	return nil
 }
 
@@ -266,9 +602,12 @@ func (db *Database) LoadIndex(tableName string) error {
 func (db *Database) RebuildIndex(tableName string) error {
 	db.mu.Lock()
 	defer db.mu.Unlock()
+	db.watchTableFile(tableName)
 
 	// Clear the index for this table (start fresh)
 	db.Indexes[tableName] = make(Index)
+	db.Ordered[tableName] = &OrderedKeys{}
+	db.stats[tableName] = newTableStats()
 
 	file, err := storage.OpenTableFile(tableName)
 	if err != nil {
@@ -278,211 +617,561 @@ func (db *Database) RebuildIndex(tableName string) error {
 		// For robustness, we'll assume any error opening means we can't read it,
 		// but specifically for "doesn't exist" we should be fine.
 		// Given LoadIndex behavior, we'll return nil for now.
-		return nil 
+		return nil
 	}
 	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
-	var offset int64 = 0
-
-	for scanner.Scan() {
-		line := scanner.Text()
-		// Calculate length including newline. 
-		// We assume \n line endings as written by AppendRow.
-		lineLen := int64(len(line) + 1) 
-
-		parts := strings.Split(line, "|")
-		if len(parts) >= 2 {
-			id := parts[0]
-			activeFlag := parts[1]
-
-			if activeFlag == "1" {
-				db.Indexes[tableName][id] = offset
-			} else if activeFlag == "0" {
-				// Tombstone: remove from index
-				delete(db.Indexes[tableName], id)
-			}
-		}
-
-		// Update offset for the NEXT line
-		offset += lineLen
-	}
-
-	if err := scanner.Err(); err != nil {
+	// scanLog tracks byte offsets and handles tombstones; it also recomputes the stats
+	index, stats, err := scanLog(tableName, file, db.Tables[tableName])
+	if err != nil {
 		return fmt.Errorf("error scanning table file %s: %w", tableName, err)
 	}
 
+	db.Indexes[tableName] = index
+	db.Ordered[tableName] = newOrderedKeys(index)
+	db.stats[tableName] = stats
+	db.observeLSN(stats.maxLSN)
+	warnCorrupt(tableName, stats)
 	return nil
 }
 
 // FindByID looks up a row by its primary key
 func (db *Database) FindByID(tableName string, id string) ([]string, error) {
-	db.mu.RLock()
-	index, exists := db.Indexes[tableName]
-	metadata, metaExists := db.Tables[tableName]
-	if !exists {
-		db.mu.RUnlock()
-		return nil, fmt.Errorf("table %s does not exist", tableName)
+	return db.findByID(tableName, id, nil)
+}
+
+// findByID is FindByID recording its reads in trace
+func (db *Database) findByID(tableName string, id string, trace *Trace) ([]string, error) {
+	start := trace.Start()
+	var metadata TableMetadata
+	var metaExists, found bool
+	var offset int64
+	err := db.readTable(tableName, trace, func(index Index, _ *OrderedKeys, meta TableMetadata, ok bool) {
+		metadata, metaExists = meta, ok
+		offset, found = index[id]
+	})
+	if err != nil {
+		return nil, err
 	}
-	
-	offset, found := index[id]
-	db.mu.RUnlock() // Unlock early
+	trace.accessPath("index lookup on " + tableName + "." + strings.Join(metadata.KeyColumns(), "+"))
+	trace.Stop(StageIndexLookup, start)
 
 	if !found {
-		return nil, fmt.Errorf("record with id %s not found in table %s", id, tableName)
+		return nil, fmt.Errorf("record with id %s %w in table %s", displayKey(id), ErrRowNotFound, tableName)
 	}
 
 	// Read from storage (disk I/O outside of lock)
-	row, err := storage.ReadRow(tableName, offset)
+	start = trace.Start()
+	read, err := rowReader(tableName, []int64{offset})
+	if err != nil {
+		return nil, err
+	}
+	row, err := read(offset)
 	if err != nil {
 		return nil, err
 	}
+	trace.Stop(StageScan, start)
+	trace.add(1)
 
-	// Clean up row if it has extra checksums
+	// Drop the LSN and any other fields past the columns
 	if metaExists {
-		expectedTotalLen := len(metadata.Columns) + 2
-		if len(row) > expectedTotalLen {
-			row = row[:expectedTotalLen]
-		}
+		return db.fitRow(metadata, offset, row)
 	}
 
 	return row, nil
 }
 
-// SelectAll returns all rows in the table
-func (db *Database) SelectAll(tableName string) ([][]string, error) {
-	db.mu.RLock()
-	index, exists := db.Indexes[tableName]
-	metadata, metaExists := db.Tables[tableName] // Get metadata while locked
-	if !exists {
-		db.mu.RUnlock()
-		return nil, fmt.Errorf("table %s does not exist", tableName)
-	}
+// ForEachRow calls fn for every live row of the table in disk (offset) order.
+// Rows are read and handed over one at a time, so callers that filter only
+// hold on to what they keep instead of the whole table. Returning false from
+// fn stops the scan early.
+func (db *Database) ForEachRow(tableName string, fn func(row []string) bool) error {
+	return db.forEachRow(tableName, nil, fn)
+}
 
+// forEachRow is ForEachRow recording its reads in trace
+func (db *Database) forEachRow(tableName string, trace *Trace, fn func(row []string) bool) error {
+	return db.forFirstRows(tableName, trace, 0, fn)
+}
+
+// forFirstRows is forEachRow over at most the first n live rows in disk order
+// (all of them when n <= 0). Only those rows are read, even from a compressed
+// table.
+func (db *Database) forFirstRows(tableName string, trace *Trace, n int, fn func(row []string) bool) error {
+	if n > 0 {
+		trace.accessPath(fmt.Sprintf("first %d rows of %s", n, tableName))
+	} else {
+		trace.accessPath("full scan of " + tableName)
+	}
 	// Collect offsets to read
 	type record struct {
 		id     string
 		offset int64
 	}
 	var records []record
-	for id, off := range index {
-		records = append(records, record{id: id, offset: off})
+	var metadata TableMetadata
+	var metaExists bool
+	err := db.readTable(tableName, trace, func(index Index, _ *OrderedKeys, meta TableMetadata, ok bool) {
+		metadata, metaExists = meta, ok
+		records = make([]record, 0, len(index))
+		for id, off := range index {
+			records = append(records, record{id: id, offset: off})
+		}
+	})
+	if err != nil {
+		return err
 	}
-	db.mu.RUnlock()
 
 	// Sort by offset to preserve insertion order (or at least disk order)
 	sort.Slice(records, func(i, j int) bool {
 		return records[i].offset < records[j].offset
 	})
+	if n > 0 && n < len(records) {
+		records = records[:n]
+	}
 
-	// Expected total length (data + checksum)
-	expectedTotalLen := 0
-	if metaExists {
-		// id + active + (cols-1 because id is in cols) + checksum?
-		// No, len(Columns) is N. Row has N+1 data items (active inserted at 1). +1 checksum.
-		// Total N+2.
-		expectedTotalLen = len(metadata.Columns) + 2
+	offsets := make([]int64, len(records))
+	for i, rec := range records {
+		offsets[i] = rec.offset
 	}
+	start := trace.Start()
+	read, err := rowReader(tableName, offsets)
+	if err != nil {
+		return err
+	}
+	trace.Stop(StageScan, start)
 
-	// Read rows
-	var rows [][]string
 	for _, rec := range records {
-		row, err := storage.ReadRow(tableName, rec.offset)
+		start := trace.Start()
+		row, err := read(rec.offset)
+		if err != nil {
+			if db.skipCorrupt(trace, tableName, rec.id, rec.offset, err) {
+				continue
+			}
+			return fmt.Errorf("failed to read row for id %s: %w", rec.id, err)
+		}
+
+		// Drop the LSN and any other fields past the columns
+		if metaExists {
+			if row, err = db.fitRow(metadata, rec.offset, row); err != nil {
+				return err
+			}
+		}
+		trace.Stop(StageScan, start)
+
+		trace.add(1)
+		start = trace.Start()
+		keepGoing := fn(row)
+		trace.Stop(StageFilter, start)
+		if !keepGoing {
+			break
+		}
+	}
+
+	return nil
+}
+
+// SelectAll returns all rows in the table
+func (db *Database) SelectAll(tableName string) ([][]string, error) {
+	return db.selectAll(tableName, nil)
+}
+
+// selectAll is SelectAll recording its reads in trace
+func (db *Database) selectAll(tableName string, trace *Trace) ([][]string, error) {
+	var rows [][]string
+	var collectErr error
+	err := db.forEachRow(tableName, trace, func(row []string) bool {
+		if collectErr = db.collectRow(trace); collectErr != nil {
+			return false
+		}
+		rows = append(rows, row)
+		return true
+	})
+	if err == nil {
+		err = collectErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return rows, nil
+}
+
+// SelectFirst returns the first n live rows of a table in disk order, as
+// SelectAll would list them. Only those rows are read from the file, so it
+// stays cheap on big tables. Corrupt rows skipped in SkipCorruptRows mode
+// leave the result short.
+func (db *Database) SelectFirst(tableName string, n int) ([][]string, error) {
+	return db.selectFirst(tableName, n, nil)
+}
+
+// selectFirst is SelectFirst recording its reads in trace
+func (db *Database) selectFirst(tableName string, n int, trace *Trace) ([][]string, error) {
+	if n <= 0 {
+		if _, exists := db.Table(tableName); !exists {
+			return nil, TableNotExist(tableName)
+		}
+		return [][]string{}, nil
+	}
+	var rows [][]string
+	var collectErr error
+	err := db.forFirstRows(tableName, trace, n, func(row []string) bool {
+		if collectErr = db.collectRow(trace); collectErr != nil {
+			return false
+		}
+		rows = append(rows, row)
+		return true
+	})
+	if err == nil {
+		err = collectErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// RangeByID returns the rows whose primary key lies in [lo, hi], ordered by id.
+// It walks the ordered key list instead of scanning every key in the index.
+func (db *Database) RangeByID(tableName, lo, hi string) ([][]string, error) {
+	return db.rangeByID(tableName, lo, hi, nil)
+}
+
+// rangeByID is RangeByID recording its reads in trace
+func (db *Database) rangeByID(tableName, lo, hi string, trace *Trace) ([][]string, error) {
+	start := trace.Start()
+	var ids []string
+	var offsets []int64
+	var metadata TableMetadata
+	var metaExists, missing bool
+	err := db.readTable(tableName, trace, func(index Index, ordered *OrderedKeys, meta TableMetadata, ok bool) {
+		metadata, metaExists = meta, ok
+		if ordered == nil {
+			missing = true
+			return
+		}
+		ids = ordered.Range(lo, hi)
+		offsets = make([]int64, len(ids))
+		for i, id := range ids {
+			offsets[i] = index[id]
+		}
+	})
+	if err == nil && missing {
+		err = TableNotExist(tableName)
+	}
+	if err != nil {
+		return nil, err
+	}
+	trace.accessPath("range scan on " + tableName + "." + strings.Join(metadata.KeyColumns(), "+"))
+	trace.Stop(StageIndexLookup, start)
+
+	start = trace.Start()
+	defer trace.Stop(StageScan, start)
+	read, err := rowReader(tableName, offsets)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows [][]string
+	for i, offset := range offsets {
+		row, err := read(offset)
 		if err != nil {
-			return nil, fmt.Errorf("failed to read row for id %s: %w", rec.id, err)
+			if db.skipCorrupt(trace, tableName, ids[i], offset, err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to read row for id %s: %w", ids[i], err)
+		}
+		trace.add(1)
+
+		// Drop the LSN and any other fields past the columns
+		if metaExists {
+			if row, err = db.fitRow(metadata, offset, row); err != nil {
+				return nil, err
+			}
 		}
-		
-		// Clean up row if it has extra checksums
-		if expectedTotalLen > 0 && len(row) > expectedTotalLen {
-			// Keep only expected length
-			row = row[:expectedTotalLen]
+
+		if err := db.collectRow(trace); err != nil {
+			return nil, err
 		}
-		
 		rows = append(rows, row)
 	}
 
 	return rows, nil
 }
 
+// columnName extracts the name from a column definition like "merchant text"
+func columnName(colDef string) string {
+	return strings.SplitN(strings.TrimSpace(colDef), " ", 2)[0]
+}
+
+// rowPosition maps a schema column index to its position in a stored row.
+// Metadata: [id, col1, col2]
+// Row:      [id, active, col1, col2]
+func rowPosition(colIndex int) int {
+	if colIndex == 0 {
+		return 0
+	}
+	return colIndex + 1
+}
+
+// ColumnNames returns the column names of a table in schema order
+func (db *Database) ColumnNames(tableName string) ([]string, error) {
+	db.mu.RLock()
+	metadata, exists := db.Tables[tableName]
+	db.mu.RUnlock()
+
+	if !exists {
+		return nil, TableNotExist(tableName)
+	}
+
+	names := make([]string, len(metadata.Columns))
+	for i, colDef := range metadata.Columns {
+		names[i] = columnName(colDef)
+	}
+	return names, nil
+}
+
+// ProjectColumns reduces stored rows to the given columns, in the given order.
+// The active_flag is dropped since it is not a schema column. LSNColumn
+// selects each row's LSN.
+func (db *Database) ProjectColumns(tableName string, rows [][]string, columns []string) ([][]string, error) {
+	db.mu.RLock()
+	metadata, exists := db.Tables[tableName]
+	db.mu.RUnlock()
+
+	if !exists {
+		return nil, TableNotExist(tableName)
+	}
+
+	positions := make([]int, len(columns))
+	var lsns []int64
+	for i, col := range columns {
+		positions[i] = -1
+		if strings.EqualFold(col, LSNColumn) {
+			if lsns == nil {
+				var err error
+				if lsns, err = db.LSNs(tableName, rows); err != nil {
+					return nil, err
+				}
+			}
+			positions[i] = metadata.rowWidth() // where the LSN is stored
+			continue
+		}
+		_, pos, err := findColumn(metadata, col)
+		if err != nil {
+			return nil, err
+		}
+		positions[i] = pos
+	}
+
+	projected := make([][]string, 0, len(rows))
+	for r, row := range rows {
+		out := make([]string, len(positions))
+		for i, pos := range positions {
+			if pos == metadata.rowWidth() {
+				out[i] = strconv.FormatInt(lsns[r], 10)
+			} else if pos < len(row) {
+				out[i] = row[pos]
+			}
+		}
+		projected = append(projected, out)
+	}
+
+	return projected, nil
+}
+
 // InsertRow adds a new row to the database and updates the index
 func (db *Database) InsertRow(tableName string, row []string) error {
-    // Basic validation: row must have at least id and active_flag
-    if len(row) < 2 {
-        return fmt.Errorf("invalid row data: too few columns")
-    }
-    
-    id := row[0]
-    
-    // Write to storage
-    offset, err := storage.AppendRow(tableName, row)
-    if err != nil {
-        return fmt.Errorf("failed to append row: %w", err)
-    }
-    
-    // Update index
-    db.mu.Lock()
-    defer db.mu.Unlock()
-    
-    if _, exists := db.Indexes[tableName]; !exists {
-        db.Indexes[tableName] = make(Index)
-    }
-    
-    db.Indexes[tableName][id] = offset
-    
-    return nil
+	db.writeMu.Lock()
+	err := db.insertRow(tableName, row)
+	db.writeMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	// Wait for group commit outside the write lock so concurrent writers share one fsync
+	return storage.WaitForSync()
+}
+
+// insertRow is InsertRow without the write lock; callers must hold db.writeMu
+func (db *Database) insertRow(tableName string, row []string) error {
+	if err := db.checkTableWritable(tableName); err != nil {
+		return err
+	}
+	if err := db.resyncTableFile(tableName); err != nil {
+		return err
+	}
+
+	// Basic validation: row must have at least id and active_flag
+	if len(row) < 2 {
+		return fmt.Errorf("invalid row data: too few columns")
+	}
+
+	db.mu.RLock()
+	metadata, exists := db.Tables[tableName]
+	db.mu.RUnlock()
+	if !exists {
+		return tableNotExist(tableName)
+	}
+
+	// Normalize typed values (e.g. TRUE -> true for bool columns)
+	if metadata.AutoIncrement() && strings.EqualFold(row[0], "DEFAULT") {
+		row[0] = "" // assigned below, once the values check out
+	}
+	if err := normalizeRow(metadata, row); err != nil {
+		return err
+	}
+
+	// Serial tables assign the id when none was given
+	if metadata.AutoIncrement() && row[0] == "" {
+		id, err := db.nextID(tableName)
+		if err != nil {
+			return err
+		}
+		row[0] = id
+	}
+
+	if err := metadata.checkKey(row); err != nil {
+		return err
+	}
+	if err := checkRow(metadata, row); err != nil {
+		return err
+	}
+	id := metadata.rowKey(row)
+
+	// The caller holds writeMu, so the key can't be taken between this check
+	// and the append
+	db.mu.RLock()
+	_, duplicate := db.Indexes[tableName][id]
+	db.mu.RUnlock()
+	if duplicate {
+		return fmt.Errorf("record with id %s %w in table %s", displayKey(id), ErrDuplicateKey, tableName)
+	}
+
+	// Write to storage
+	stored := db.stampLSN(row)
+	offset, err := db.appendRow(tableName, stored)
+	if err != nil {
+		return fmt.Errorf("failed to append row: %w", err)
+	}
+
+	// Update index
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, exists := db.Indexes[tableName]; !exists {
+		db.Indexes[tableName] = make(Index)
+	}
+	if _, exists := db.Ordered[tableName]; !exists {
+		db.Ordered[tableName] = &OrderedKeys{}
+	}
+
+	db.Indexes[tableName][id] = offset
+	db.Ordered[tableName].Insert(id)
+	db.recordWrite(tableName, id, storage.RowSize(tableName, stored), true)
+
+	return nil
 }
 
 // DeleteRow appends a tombstone row (active_flag=0) and removes the record from the index
 func (db *Database) DeleteRow(tableName string, id string) error {
+	db.writeMu.Lock()
+	_, err := db.deleteRow(tableName, id)
+	db.writeMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	// Wait for group commit outside the write lock so concurrent writers share one fsync
+	return storage.WaitForSync()
+}
+
+// deleteRow is DeleteRow without the write lock; callers must hold db.writeMu.
+// It returns the row as it was before the delete.
+func (db *Database) deleteRow(tableName string, id string) ([]string, error) {
+	if err := db.checkTableWritable(tableName); err != nil {
+		return nil, err
+	}
+	if err := db.resyncTableFile(tableName); err != nil {
+		return nil, err
+	}
+
 	// Step 1: Find the record to get current data
 	currentRow, err := db.FindByID(tableName, id)
 	if err != nil {
-		return err // Record not found or table doesn't exist
+		return nil, err // Record not found or table doesn't exist
 	}
-	
+
 	// Step 2: Create tombstone row
 	if len(currentRow) < 2 {
-		return fmt.Errorf("corrupt data: row too short")
+		return nil, fmt.Errorf("corrupt data: row too short")
 	}
-	
+
 	tombstoneRow := make([]string, len(currentRow))
 	copy(tombstoneRow, currentRow)
 	tombstoneRow[1] = "0" // Set active_flag to 0
-	
-	// Step 3: Append to storage
-	_, err = storage.AppendRow(tableName, tombstoneRow)
+
+	// Step 3: Append to storage; the checksum is computed over the row as
+	// written, flipped active_flag included
+	tombstoneRow = db.stampLSN(tombstoneRow)
+	_, err = db.appendRow(tableName, tombstoneRow)
 	if err != nil {
-		return fmt.Errorf("failed to append tombstone: %w", err)
+		return nil, fmt.Errorf("failed to append tombstone: %w", err)
 	}
-	
+
 	// Step 4: Update Index (Remove)
 	db.mu.Lock()
 	defer db.mu.Unlock()
-	
+
 	if index, exists := db.Indexes[tableName]; exists {
 		delete(index, id)
 	}
-	
-	return nil
+	if ordered, exists := db.Ordered[tableName]; exists {
+		ordered.Remove(id)
+	}
+	db.recordWrite(tableName, id, storage.RowSize(tableName, tombstoneRow), false)
+
+	return currentRow, nil
 }
 
 // UpdateRow reads the current row, applies updates, and appends a new version
 func (db *Database) UpdateRow(tableName string, id string, updates map[string]string) error {
+	db.writeMu.Lock()
+	_, err := db.updateRow(tableName, id, updates)
+	db.writeMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	// Wait for group commit outside the write lock so concurrent writers share one fsync
+	return storage.WaitForSync()
+}
+
+// updateRow is UpdateRow without the write lock; callers must hold db.writeMu.
+// It returns the new version of the row.
+func (db *Database) updateRow(tableName string, id string, updates map[string]string) ([]string, error) {
+	if err := db.checkTableWritable(tableName); err != nil {
+		return nil, err
+	}
+	if err := db.resyncTableFile(tableName); err != nil {
+		return nil, err
+	}
+
 	// Step 1: Find current row
 	currentRow, err := db.FindByID(tableName, id)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	
+
 	// Step 2: Get metadata to map columns
 	db.mu.RLock()
 	metadata, exists := db.Tables[tableName]
 	db.mu.RUnlock()
-	
+
 	if !exists {
-		return fmt.Errorf("table %s metadata not found", tableName)
+		return nil, fmt.Errorf("table %s metadata not found", tableName)
 	}
-	
+
 	// Step 3: Prepare new row
 	// Strict length enforcement: len(Columns) + 1 (for active_flag)
 	// This strips ALL trailing checksums or garbage from previous corruptions
@@ -496,109 +1185,335 @@ func (db *Database) UpdateRow(tableName string, id string, updates map[string]st
 		// Actually, let's just error if it's too short, but if it's too long (checksums), we truncate.
 		// If it's short, we can't reliably map columns.
 		// But wait, if schema has 3 cols, and row has 2...
-		return fmt.Errorf("data corruption: row shorter than schema (len=%d, expected=%d)", len(currentRow), expectedLen)
+		return nil, fmt.Errorf("data corruption: row shorter than schema (len=%d, expected=%d)", len(currentRow), expectedLen)
 	}
-	
+
 	newRow := make([]string, expectedLen)
 	copy(newRow, currentRow[:expectedLen])
 	newRow[1] = "1" // Ensure active_flag is 1
-	
+
 	// Step 4: Apply updates
 	for colName, newVal := range updates {
-		colIndex := -1
-		
-		// Find column index in metadata
-		// Metadata Columns: ["id int", "merchant text", ...]
-		// Row: [id, active, merchant, ...]
-		for i, colDef := range metadata.Columns {
-			// Extract name from definition "name type"
-			parts := strings.SplitN(colDef, " ", 2)
-			name := parts[0]
-			
-			if strings.EqualFold(name, colName) {
-				if i == 0 {
-					colIndex = 0 // id
-				} else {
-					colIndex = i + 1 // Shift for active_flag
-				}
-				break
-			}
-		}
-		
-		if colIndex == -1 {
-			return fmt.Errorf("column %s not found in table %s", colName, tableName)
+		// Row: [id, active, merchant, ...], so columns after the id shift by one
+		column, colIndex, err := findColumn(metadata, colName)
+		if err != nil {
+			return nil, err
 		}
-		
+
 		if colIndex >= len(newRow) {
-			return fmt.Errorf("row structure mismatch for column %s", colName)
+			return nil, fmt.Errorf("row structure mismatch for column %s", colName)
+		}
+
+		normalized, err := normalizeValue(column, newVal)
+		if err != nil {
+			return nil, err
 		}
-		
-		newRow[colIndex] = newVal
+		newRow[colIndex] = normalized
+	}
+
+	// Validate the merged row as INSERT would: types, key and CHECK constraints
+	if err := checkRowTypes(metadata, newRow); err != nil {
+		return nil, err
 	}
-	
+	if err := metadata.checkKey(newRow); err != nil {
+		return nil, err
+	}
+	if err := checkRow(metadata, newRow); err != nil {
+		return nil, err
+	}
+	if newID := metadata.rowKey(newRow); newID != id {
+		db.mu.RLock()
+		_, taken := db.Indexes[tableName][newID]
+		db.mu.RUnlock()
+		if taken {
+			return nil, fmt.Errorf("duplicate key %s in table %s: the primary key must be unique", displayKey(newID), tableName)
+		}
+		return nil, fmt.Errorf("cannot update primary key columns (%s) of table %s", strings.Join(metadata.KeyColumns(), ", "), tableName)
+	}
+
 	// Step 5: Append new row
-	offset, err := storage.AppendRow(tableName, newRow)
+	stored := db.stampLSN(newRow)
+	offset, err := db.appendRow(tableName, stored)
 	if err != nil {
-		return fmt.Errorf("failed to append updated row: %w", err)
+		return nil, fmt.Errorf("failed to append updated row: %w", err)
 	}
-	
+
 	// Step 6: Update Index
 	db.mu.Lock()
 	defer db.mu.Unlock()
-	
+
 	if _, exists := db.Indexes[tableName]; exists {
 		db.Indexes[tableName][id] = offset
 	}
-	
-	return nil
+	db.recordWrite(tableName, id, storage.RowSize(tableName, stored), true)
+
+	return newRow, nil
 }
 
-// SelectByColumn returns rows where the specified column matches the value
+// UpsertRow inserts the row, or resolves a conflict when its id already exists.
+// With nil updates the existing row is left untouched (DO NOTHING); otherwise
+// the updates are applied to the existing row (DO UPDATE). The existence check
+// and the write happen under the write lock, so the upsert is atomic.
+// It reports whether a new row was inserted.
+func (db *Database) UpsertRow(tableName string, row []string, updates map[string]string) (bool, error) {
+	if len(row) < 2 {
+		return false, fmt.Errorf("invalid row data: too few columns")
+	}
+
+	db.writeMu.Lock()
+	inserted, err := db.upsertRow(tableName, row, updates)
+	db.writeMu.Unlock()
+	if err != nil {
+		return false, err
+	}
+
+	return inserted, storage.WaitForSync()
+}
+
+// upsertRow is UpsertRow without the write lock; callers must hold db.writeMu
+func (db *Database) upsertRow(tableName string, row []string, updates map[string]string) (bool, error) {
+	if err := db.checkTableWritable(tableName); err != nil {
+		return false, err
+	}
+	if err := db.resyncTableFile(tableName); err != nil {
+		return false, err
+	}
+
+	db.mu.RLock()
+	index, exists := db.Indexes[tableName]
+	metadata := db.Tables[tableName]
+	if !exists {
+		db.mu.RUnlock()
+		return false, TableNotExist(tableName)
+	}
+	if err := metadata.checkWidth(row); err != nil {
+		db.mu.RUnlock()
+		return false, err
+	}
+	id := metadata.rowKey(row)
+	_, conflict := index[id]
+	db.mu.RUnlock()
+
+	if !conflict {
+		return true, db.insertRow(tableName, row)
+	}
+
+	if updates == nil {
+		return false, nil
+	}
+	_, err := db.updateRow(tableName, id, updates)
+	return false, err
+}
+
+// liveIDs returns a snapshot of the live primary keys of a table, in id order
+func (db *Database) liveIDs(tableName string) ([]string, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	ordered, exists := db.Ordered[tableName]
+	if !exists {
+		return nil, TableNotExist(tableName)
+	}
+	return ordered.Keys(), nil
+}
+
+// DeleteAll tombstones every live row in the table and returns how many were deleted
+func (db *Database) DeleteAll(tableName string) (int, error) {
+	return db.deleteAll(tableName, db.DeleteRowReturning, nil)
+}
+
+// deleteAll deletes every live row with del, handing each deleted row to
+// collect if set
+func (db *Database) deleteAll(tableName string, del func(tableName, id string) ([]string, error), collect func(row []string)) (int, error) {
+	if err := db.checkWritable(); err != nil {
+		return 0, err
+	}
+
+	ids, err := db.liveIDs(tableName)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, id := range ids {
+		row, err := del(tableName, id)
+		if err != nil {
+			return deleted, fmt.Errorf("failed to delete row %s: %w", id, err)
+		}
+		if collect != nil {
+			collect(row)
+		}
+		deleted++
+	}
+
+	return deleted, nil
+}
+
+// UpdateAll applies the same updates to every live row and returns how many were updated
+func (db *Database) UpdateAll(tableName string, updates map[string]string) (int, error) {
+	return db.updateAll(tableName, updates, db.UpdateRowReturning, nil)
+}
+
+// updateAll updates every live row with update, handing each new row version
+// to collect if set
+func (db *Database) updateAll(tableName string, updates map[string]string, update func(tableName, id string, updates map[string]string) ([]string, error), collect func(row []string)) (int, error) {
+	if err := db.checkWritable(); err != nil {
+		return 0, err
+	}
+
+	ids, err := db.liveIDs(tableName)
+	if err != nil {
+		return 0, err
+	}
+
+	updated := 0
+	for _, id := range ids {
+		row, err := update(tableName, id, updates)
+		if err != nil {
+			return updated, fmt.Errorf("failed to update row %s: %w", id, err)
+		}
+		if collect != nil {
+			collect(row)
+		}
+		updated++
+	}
+
+	return updated, nil
+}
+
+// SelectByColumn returns rows where the specified column matches the value,
+// ordered by primary key. The table is still read in disk order; the
+// matches are sorted afterwards, so repeated queries list them the same way.
 func (db *Database) SelectByColumn(tableName, colName, value string) ([][]string, error) {
+	return db.selectByColumn(tableName, colName, value, nil)
+}
+
+// selectByColumn is SelectByColumn recording its reads in trace
+func (db *Database) selectByColumn(tableName, colName, value string, trace *Trace) ([][]string, error) {
 	// 1. Get column index
 	db.mu.RLock()
 	metadata, exists := db.Tables[tableName]
 	db.mu.RUnlock()
-	
+
 	if !exists {
-		return nil, fmt.Errorf("table %s does not exist", tableName)
+		return nil, TableNotExist(tableName)
 	}
-	
-	targetColIndex := -1
-	for i, colDef := range metadata.Columns {
-		parts := strings.SplitN(colDef, " ", 2)
-		if strings.EqualFold(parts[0], colName) {
-			// Map to row index:
-			// Metadata: [id, col1, col2]
-			// Row:      [id, active, col1, col2, checksum]
-			// If i==0 (id), row index 0.
-			// If i>0, row index i+1.
-			if i == 0 {
-				targetColIndex = 0
-			} else {
-				targetColIndex = i + 1
+
+	// Map to row index: the id is field 0 and the active_flag field 1
+	targetCol, targetColIndex, err := findColumn(metadata, colName)
+	if err != nil {
+		return nil, err
+	}
+	if err := CheckComparable(targetCol); err != nil {
+		return nil, err
+	}
+
+	// Bool columns compare on the canonical form, so TRUE, true and 1 all match
+	isBool := targetCol.Type == "bool" || targetCol.Type == "boolean"
+	if isBool {
+		normalized, ok := NormalizeBool(value)
+		if !ok {
+			return nil, fmt.Errorf("invalid value %q for column %s: expected bool", value, targetCol.Name)
+		}
+		value = normalized
+	}
+
+	// 2. Stream rows and keep only the matches
+	var filtered [][]string
+	var collectErr error
+	err = db.forEachRow(tableName, trace, func(row []string) bool {
+		if targetColIndex >= len(row) {
+			return true
+		}
+		cell := row[targetColIndex]
+		if isBool {
+			cell, _ = NormalizeBool(cell)
+		}
+		if strings.EqualFold(cell, value) {
+			if collectErr = db.collectRow(trace); collectErr != nil {
+				return false
 			}
-			break
+			filtered = append(filtered, row)
 		}
+		return true
+	})
+	if err == nil {
+		err = collectErr
 	}
-	
-	if targetColIndex == -1 {
-		return nil, fmt.Errorf("column %s not found", colName)
+	if err != nil {
+		return nil, err
 	}
-	
-	// 2. Get all rows
-	allRows, err := db.SelectAll(tableName)
+	sortRowsByKey(metadata, filtered)
+
+	return filtered, nil
+}
+
+// SelectIn returns rows where the specified column matches any of the values,
+// ordered by primary key. Values compare like in SelectByColumn: ignoring
+// case, and on the canonical form for bool columns.
+func (db *Database) SelectIn(tableName, colName string, values []string) ([][]string, error) {
+	return db.selectIn(tableName, colName, values, nil)
+}
+
+// selectIn is SelectIn recording its reads in trace
+func (db *Database) selectIn(tableName, colName string, values []string, trace *Trace) ([][]string, error) {
+	db.mu.RLock()
+	metadata, exists := db.Tables[tableName]
+	db.mu.RUnlock()
+
+	if !exists {
+		return nil, TableNotExist(tableName)
+	}
+
+	col, pos, err := findColumn(metadata, colName)
 	if err != nil {
 		return nil, err
 	}
-	
-	// 3. Filter
+	if err := CheckComparable(col); err != nil {
+		return nil, err
+	}
+	isBool := col.Type == "bool" || col.Type == "boolean"
+
+	wanted := make(map[string]bool, len(values))
+	for _, value := range values {
+		if isBool {
+			normalized, ok := NormalizeBool(value)
+			if !ok {
+				return nil, fmt.Errorf("invalid value %q for column %s: expected bool", value, col.Name)
+			}
+			value = normalized
+		}
+		wanted[strings.ToLower(value)] = true
+	}
+	if len(wanted) == 0 {
+		return nil, nil
+	}
+
 	var filtered [][]string
-	for _, row := range allRows {
-		if targetColIndex < len(row) && strings.EqualFold(row[targetColIndex], value) {
+	var collectErr error
+	err = db.forEachRow(tableName, trace, func(row []string) bool {
+		if pos >= len(row) {
+			return true
+		}
+		cell := row[pos]
+		if isBool {
+			cell, _ = NormalizeBool(cell)
+		}
+		if wanted[strings.ToLower(cell)] {
+			if collectErr = db.collectRow(trace); collectErr != nil {
+				return false
+			}
 			filtered = append(filtered, row)
 		}
+		return true
+	})
+	if err == nil {
+		err = collectErr
 	}
-	
+	if err != nil {
+		return nil, err
+	}
+	sortRowsByKey(metadata, filtered)
+
 	return filtered, nil
 }
@@ -0,0 +1,298 @@
+package engine
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"pesapal-ledger/storage"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// newTestDB opens an empty database in a temporary data directory, with
+// fsync off to keep the tests fast
+func newTestDB(t testing.TB) *Database {
+	t.Helper()
+	if err := storage.SetDataDir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.SetSyncPolicy(storage.SyncPolicy{Mode: storage.SyncNone}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(storage.CloseWriters)
+
+	db := NewDatabase()
+	if err := db.Recover(); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestInsertDuplicateKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		columns []string
+		first   []string
+		second  []string
+		key     string
+		last    string // the last column, updated by the upsert
+	}{
+		{
+			name:    "first column",
+			columns: []string{"id int", "name text"},
+			first:   []string{"1", "1", "alice"},
+			second:  []string{"1", "1", "bob"},
+			key:     "1",
+			last:    "name",
+		},
+		{
+			name:    "composite key",
+			columns: []string{"base text", "quote text", "rate float", "PRIMARY KEY (base, quote)"},
+			first:   []string{"USD", "1", "KES", "129.5"},
+			second:  []string{"USD", "1", "KES", "130"},
+			key:     "USD" + keySeparator + "KES",
+			last:    "rate",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			if err := db.CreateTable("t", tt.columns); err != nil {
+				t.Fatal(err)
+			}
+			if err := db.InsertRow("t", tt.first); err != nil {
+				t.Fatal(err)
+			}
+
+			err := db.InsertRow("t", append([]string(nil), tt.second...))
+			if !errors.Is(err, ErrDuplicateKey) {
+				t.Fatalf("second insert: got %v, want ErrDuplicateKey", err)
+			}
+			row, err := db.FindByID("t", tt.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := row[len(row)-1], tt.first[len(tt.first)-1]; got != want {
+				t.Errorf("row after the rejected insert has %q, want the original %q", got, want)
+			}
+
+			// ON CONFLICT DO NOTHING leaves it alone
+			inserted, err := db.UpsertRow("t", append([]string(nil), tt.second...), nil)
+			if err != nil || inserted {
+				t.Fatalf("upsert DO NOTHING: inserted=%v err=%v, want neither", inserted, err)
+			}
+			if row, err := db.FindByID("t", tt.key); err != nil || row[len(row)-1] != tt.first[len(tt.first)-1] {
+				t.Errorf("row after DO NOTHING = %v (%v), want it unchanged", row, err)
+			}
+
+			// ON CONFLICT DO UPDATE still replaces it
+			inserted, err = db.UpsertRow("t", append([]string(nil), tt.second...), map[string]string{tt.last: "9"})
+			if err != nil || inserted {
+				t.Fatalf("upsert: inserted=%v err=%v, want an update", inserted, err)
+			}
+			if row, err := db.FindByID("t", tt.key); err != nil || row[len(row)-1] != "9" {
+				t.Errorf("row after the upsert = %v (%v), want %s updated", row, err, tt.last)
+			}
+		})
+	}
+}
+
+func TestInsertUnknownTable(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.CreateTable("t", []string{"id int", "name text"}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		table string
+		row   []string
+	}{
+		{"nope", []string{"1", "1", "alice"}},
+		{"T2", []string{"1", "1"}},
+		{"sales.t", []string{"1", "1", "alice"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.table, func(t *testing.T) {
+			if err := db.InsertRow(tt.table, tt.row); !errors.Is(err, ErrTableNotFound) {
+				t.Fatalf("InsertRow: err = %v, want ErrTableNotFound", err)
+			}
+			if _, err := os.Stat(storage.TableFilePath(tt.table)); !os.IsNotExist(err) {
+				t.Errorf("insert left a table file behind: %v", err)
+			}
+		})
+	}
+	if tables := db.ListTables(); len(tables) != 1 {
+		t.Errorf("tables = %v, want only t", tables)
+	}
+}
+
+func TestTombstoneChecksum(t *testing.T) {
+	for _, format := range []storage.RecordFormat{storage.FormatText, storage.FormatBinary} {
+		t.Run(string(format), func(t *testing.T) {
+			db := newTestDB(t)
+			if err := db.CreateTableWithFormat("accounts", []string{"id int", "owner text"}, format); err != nil {
+				t.Fatal(err)
+			}
+			if err := db.InsertRow("accounts", []string{"1", "1", "alice"}); err != nil {
+				t.Fatal(err)
+			}
+			if err := db.DeleteRow("accounts", "1"); err != nil {
+				t.Fatal(err)
+			}
+
+			tombstone := readRecords(t, "accounts")[1]
+			if tombstone.Err != nil || tombstone.Fields[1] != "0" {
+				t.Fatalf("tombstone = %+v, want a verified record with active_flag 0", tombstone)
+			}
+			if format == storage.FormatText {
+				// The checksum is the hex SHA-256 of the other fields, flag included
+				raw, err := os.ReadFile(storage.TableFilePath("accounts"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				line, _, _ := strings.Cut(string(raw[tombstone.Offset:]), "\n")
+				cut := strings.LastIndex(line, "|")
+				sum := sha256.Sum256([]byte(line[:cut]))
+				if line[cut+1:] != hex.EncodeToString(sum[:]) {
+					t.Errorf("tombstone %q doesn't end in the SHA-256 of its fields", line)
+				}
+			}
+
+			// Flip the flag back to 1 in place: the row must not come back
+			flag := tombstone.Offset + int64(len("1|"))
+			if format == storage.FormatBinary {
+				flag = tombstone.Offset + 4 + 4 + int64(len("1")) + 4
+			}
+			raw, err := os.ReadFile(storage.TableFilePath("accounts"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if raw[flag] != '0' {
+				t.Fatalf("byte %d is %q, not the tombstone's flag", flag, raw[flag])
+			}
+			raw[flag] = '1'
+			if err := os.WriteFile(storage.TableFilePath("accounts"), raw, 0644); err != nil {
+				t.Fatal(err)
+			}
+			if tampered := readRecords(t, "accounts")[1]; !errors.Is(tampered.Err, storage.ErrTampered) {
+				t.Errorf("tampered tombstone read back with %v, want ErrTampered", tampered.Err)
+			}
+		})
+	}
+}
+
+// readRecords reads every entry of a table's log
+func readRecords(t *testing.T, tableName string) []storage.Record {
+	t.Helper()
+	file, err := storage.OpenTableFile(tableName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var records []storage.Record
+	reader := storage.NewRecordReader(tableName, file)
+	for reader.Next() {
+		records = append(records, reader.Record())
+	}
+	if err := reader.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
+
+func TestRecoverMissingDataFile(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.CreateTable("accounts", []string{"id int", "owner text"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.InsertRow("accounts", []string{"1", "1", "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	storage.CloseWriters()
+	backup, err := os.ReadFile(storage.TableFilePath("accounts"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(storage.TableFilePath("accounts")); err != nil {
+		t.Fatal(err)
+	}
+	db = reopen(t, db)
+
+	infos := db.TableInfos()
+	if len(infos) != 1 || !infos[0].Degraded || infos[0].Reason != reasonFileMissing {
+		t.Fatalf("TableInfos = %+v, want accounts degraded for its missing file", infos)
+	}
+
+	writes := map[string]func() error{
+		"insert":  func() error { return db.InsertRow("accounts", []string{"2", "1", "bob"}) },
+		"upsert":  func() error { _, err := db.UpsertRow("accounts", []string{"2", "1", "bob"}, nil); return err },
+		"import":  func() error { _, err := db.ImportRows("accounts", [][]string{{"2", "1", "bob"}}); return err },
+		"compact": func() error { _, err := db.Compact("accounts"); return err },
+	}
+	for name, write := range writes {
+		if err := write(); !errors.Is(err, ErrTableDegraded) {
+			t.Errorf("%s: got %v, want ErrTableDegraded", name, err)
+		}
+	}
+	if exists, err := storage.TableFileExists("accounts"); err != nil || exists {
+		t.Errorf("refused writes recreated the data file (exists=%v, %v)", exists, err)
+	}
+
+	// Restoring the file clears the flag
+	if _, err := db.RestoreTable("accounts", bytes.NewReader(backup), false); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.InsertRow("accounts", []string{"2", "1", "bob"}); err != nil {
+		t.Errorf("insert after the restore: %v", err)
+	}
+	if row, err := db.FindByID("accounts", "1"); err != nil || row[2] != "alice" {
+		t.Errorf("restored row = %v, %v", row, err)
+	}
+}
+
+// BenchmarkSelectByColumn filters a 10000-row table down to 10 rows by
+// streaming it, and by loading every row first as SelectByColumn did before
+func BenchmarkSelectByColumn(b *testing.B) {
+	db := newTestDB(b)
+	if err := db.CreateTable("transactions", []string{"id int", "merchant text", "amount int"}); err != nil {
+		b.Fatal(err)
+	}
+	for i := 1; i <= 10000; i++ {
+		id := strconv.Itoa(i)
+		if err := db.InsertRow("transactions", []string{id, "1", "merchant" + strconv.Itoa(i%1000), id}); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.Run("streaming", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			rows, err := db.SelectByColumn("transactions", "merchant", "merchant7")
+			if err != nil || len(rows) != 10 {
+				b.Fatalf("SelectByColumn = %d rows, %v", len(rows), err)
+			}
+		}
+	})
+	b.Run("load all", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			rows, err := db.SelectAll("transactions")
+			if err != nil {
+				b.Fatal(err)
+			}
+			var matched [][]string
+			for _, row := range rows {
+				if row[2] == "merchant7" {
+					matched = append(matched, row)
+				}
+			}
+			if len(matched) != 10 {
+				b.Fatalf("load all matched %d rows", len(matched))
+			}
+		}
+	})
+}
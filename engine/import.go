@@ -0,0 +1,96 @@
+package engine
+
+import (
+	"fmt"
+	"pesapal-ledger/storage"
+)
+
+// ImportResult reports what ImportRows wrote
+type ImportResult struct {
+	Table   string `json:"table"`
+	Active  int    `json:"active"`  // rows written live
+	Deleted int    `json:"deleted"` // rows written as tombstones
+}
+
+// ImportRows writes rows given in the stored layout, active_flag included
+// (id, active_flag, col2, ...), for migrating data from a system that tracks
+// soft deletes itself. The rows are applied in order like a replayed log: a
+// row with flag 1 becomes its key's current version and a row with flag 0 is
+// written as a tombstone, leaving the key out of the index. Values are
+// normalized and checked as on insert, and every row is validated before
+// any is written. Ids are taken as given, also on serial tables.
+func (db *Database) ImportRows(tableName string, rows [][]string) (ImportResult, error) {
+	if err := db.checkTableWritable(tableName); err != nil {
+		return ImportResult{}, err
+	}
+
+	db.mu.RLock()
+	metadata, exists := db.Tables[tableName]
+	db.mu.RUnlock()
+	if !exists {
+		return ImportResult{}, TableNotExist(tableName)
+	}
+
+	width := metadata.rowWidth()
+	for i, row := range rows {
+		if len(row) != width {
+			return ImportResult{}, fmt.Errorf("import row %d has %d values, expected %d (id, active_flag and the other columns)", i+1, len(row), width)
+		}
+		if row[1] != "1" && row[1] != "0" {
+			return ImportResult{}, fmt.Errorf("import row %d: active_flag must be 1 or 0, got %q", i+1, row[1])
+		}
+		if row[0] == "" {
+			return ImportResult{}, fmt.Errorf("import row %d: id is required", i+1)
+		}
+		if err := normalizeRow(metadata, row); err != nil {
+			return ImportResult{}, fmt.Errorf("import row %d: %w", i+1, err)
+		}
+		if err := metadata.checkKey(row); err != nil {
+			return ImportResult{}, fmt.Errorf("import row %d: %w", i+1, err)
+		}
+		if row[1] == "1" {
+			if err := checkRow(metadata, row); err != nil {
+				return ImportResult{}, fmt.Errorf("import row %d: %w", i+1, err)
+			}
+		}
+	}
+
+	db.writeMu.Lock()
+	result, err := db.importRows(metadata, rows)
+	db.writeMu.Unlock()
+	if err != nil {
+		return result, err
+	}
+	return result, storage.WaitForSync()
+}
+
+// importRows appends validated import rows and updates the index; callers
+// must hold db.writeMu. On an append failure the rows before it stay written
+// and are reported in the result.
+func (db *Database) importRows(metadata TableMetadata, rows [][]string) (ImportResult, error) {
+	tableName := metadata.Name
+	result := ImportResult{Table: tableName}
+	for i, row := range rows {
+		stored := db.stampLSN(row)
+		offset, err := db.appendRow(tableName, stored)
+		if err != nil {
+			return result, fmt.Errorf("failed to append import row %d: %w", i+1, err)
+		}
+
+		key := metadata.rowKey(row)
+		live := row[1] == "1"
+		db.mu.Lock()
+		if live {
+			db.Indexes[tableName][key] = offset
+			db.Ordered[tableName].Insert(key)
+			result.Active++
+		} else {
+			delete(db.Indexes[tableName], key)
+			db.Ordered[tableName].Remove(key)
+			result.Deleted++
+		}
+		db.recordWrite(tableName, key, storage.RowSize(tableName, stored), live)
+		db.mu.Unlock()
+	}
+	return result, nil
+}
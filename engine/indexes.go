@@ -0,0 +1,52 @@
+package engine
+
+import "sort"
+
+// PrimaryIndexName is the name SHOW INDEXES gives a table's primary key index
+const PrimaryIndexName = "PRIMARY"
+
+// IndexInfo describes one index of a table
+type IndexInfo struct {
+	Table   string   `json:"table"`
+	Name    string   `json:"name"`
+	Columns []string `json:"columns"`
+	Unique  bool     `json:"unique"`
+	Primary bool     `json:"primary"`
+	Entries int      `json:"entries"` // live keys in the index
+}
+
+// IndexInfos lists the indexes of a table, or of every user table sorted by
+// name when tableName is empty. Every table has its primary key index: a hash
+// of key -> offset plus the ordered key list used by range scans.
+func (db *Database) IndexInfos(tableName string) ([]IndexInfo, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var names []string
+	if tableName != "" {
+		if _, exists := db.Tables[tableName]; !exists {
+			return nil, TableNotExist(tableName)
+		}
+		names = []string{tableName}
+	} else {
+		for name := range db.Tables {
+			if !IsSystemTable(name) {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+	}
+
+	infos := make([]IndexInfo, 0, len(names))
+	for _, name := range names {
+		infos = append(infos, IndexInfo{
+			Table:   name,
+			Name:    PrimaryIndexName,
+			Columns: db.Tables[name].KeyColumns(),
+			Unique:  true,
+			Primary: true,
+			Entries: len(db.Indexes[name]),
+		})
+	}
+	return infos, nil
+}
@@ -0,0 +1,164 @@
+package engine
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// keySeparator joins the parts of a composite primary key in the index.
+// It is a control character, so it doesn't clash with ordinary values.
+const keySeparator = "\x1f"
+
+// tablePrimaryKey returns the columns of a table-level "PRIMARY KEY (a, b)"
+// definition, or false when colDef is an ordinary column
+func tablePrimaryKey(colDef string) ([]string, bool) {
+	fields := strings.Fields(colDef)
+	if len(fields) < 2 || !strings.EqualFold(fields[0], "PRIMARY") || !strings.HasPrefix(strings.ToUpper(fields[1]), "KEY") {
+		return nil, false
+	}
+	rest := strings.TrimSpace(colDef[strings.Index(strings.ToUpper(colDef), "KEY")+3:])
+	if !strings.HasPrefix(rest, "(") || !strings.HasSuffix(rest, ")") {
+		return nil, false
+	}
+
+	var columns []string
+	for _, name := range strings.Split(rest[1:len(rest)-1], ",") {
+		columns = append(columns, strings.TrimSpace(name))
+	}
+	return columns, true
+}
+
+// validatePrimaryKey makes sure every column of a declared primary key exists
+// and appears once, and that no key column is a blob
+func validatePrimaryKey(metadata TableMetadata) error {
+	seen := make(map[string]bool, len(metadata.PrimaryKey))
+	for _, name := range metadata.PrimaryKey {
+		if name == "" {
+			return fmt.Errorf("invalid PRIMARY KEY: empty column name")
+		}
+		if _, _, err := findColumn(metadata, name); err != nil {
+			return fmt.Errorf("invalid PRIMARY KEY: %w", err)
+		}
+		if seen[strings.ToLower(name)] {
+			return fmt.Errorf("invalid PRIMARY KEY: column %s is listed twice", name)
+		}
+		seen[strings.ToLower(name)] = true
+	}
+	// Blob values are stored encoded, so a lookup by the raw key would miss
+	for _, name := range metadata.KeyColumns() {
+		if col, _, err := findColumn(metadata, name); err == nil && col.Type == "blob" {
+			return fmt.Errorf("invalid PRIMARY KEY: blob column %s can't be part of a key", col.Name)
+		}
+	}
+	return nil
+}
+
+// KeyColumns returns the primary key columns of the table: the declared
+// PRIMARY KEY, or the first column when none was declared
+func (m TableMetadata) KeyColumns() []string {
+	if len(m.PrimaryKey) > 0 {
+		return m.PrimaryKey
+	}
+	if len(m.Columns) == 0 {
+		return nil
+	}
+	return []string{columnName(m.Columns[0])}
+}
+
+// CompositeKey reports whether the table is keyed on more than one column
+func (m TableMetadata) CompositeKey() bool {
+	return len(m.PrimaryKey) > 1
+}
+
+// rowKey computes the index key of a stored row. Without a declared PRIMARY
+// KEY that is the first field, as it always was.
+func (m TableMetadata) rowKey(row []string) string {
+	if len(m.PrimaryKey) == 0 {
+		return row[0]
+	}
+	return strings.Join(m.KeyValues(row), keySeparator)
+}
+
+// KeyValues returns the primary key values of a stored row, one per key
+// column in KeyColumns order
+func (m TableMetadata) KeyValues(row []string) []string {
+	if len(m.PrimaryKey) == 0 {
+		return []string{row[0]}
+	}
+
+	parts := make([]string, len(m.PrimaryKey))
+	for i, name := range m.PrimaryKey {
+		if _, pos, err := findColumn(m, name); err == nil && pos < len(row) {
+			parts[i] = row[pos]
+		}
+	}
+	return parts
+}
+
+// checkKey rejects a row whose key values don't match the declared types of
+// the key columns: integer keys must be integers and float keys numbers, so
+// keys keep the numeric order range scans rely on. Text keys take anything.
+func (m TableMetadata) checkKey(row []string) error {
+	for _, name := range m.KeyColumns() {
+		col, pos, err := findColumn(m, name)
+		if err != nil || pos >= len(row) {
+			continue
+		}
+		value := row[pos]
+		switch col.TypeFamily() {
+		case "integer":
+			if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+				return fmt.Errorf("invalid key %q for column %s of table %s: expected an integer (%s)", value, col.Name, m.Name, col.Type)
+			}
+		case "float":
+			if _, err := strconv.ParseFloat(value, 64); err != nil {
+				return fmt.Errorf("invalid key %q for column %s of table %s: expected a number (%s)", value, col.Name, m.Name, col.Type)
+			}
+		}
+	}
+	return nil
+}
+
+// KeyFor builds the index key of a table from a value for each primary key
+// column, keyed by column name (case-insensitively). The result can be passed
+// to FindByID, UpdateRow and DeleteRow.
+func (db *Database) KeyFor(tableName string, values map[string]string) (string, error) {
+	db.mu.RLock()
+	metadata, exists := db.Tables[tableName]
+	db.mu.RUnlock()
+	if !exists {
+		return "", TableNotExist(tableName)
+	}
+
+	keyColumns := metadata.KeyColumns()
+	if len(values) != len(keyColumns) {
+		return "", fmt.Errorf("table %s is keyed on (%s): expected a value for each key column", tableName, strings.Join(keyColumns, ", "))
+	}
+
+	parts := make([]string, len(keyColumns))
+	for i, name := range keyColumns {
+		found := false
+		for given, value := range values {
+			if strings.EqualFold(given, name) {
+				col, _, _ := findColumn(metadata, name)
+				normalized, err := normalizeValue(col, value)
+				if err != nil {
+					return "", err
+				}
+				parts[i], found = normalized, true
+				break
+			}
+		}
+		if !found {
+			return "", fmt.Errorf("table %s is keyed on (%s): missing a value for %s", tableName, strings.Join(keyColumns, ", "), name)
+		}
+	}
+	return strings.Join(parts, keySeparator), nil
+}
+
+// displayKey renders an index key for messages, showing the parts of a
+// composite key as "a, b"
+func displayKey(key string) string {
+	return strings.ReplaceAll(key, keySeparator, ", ")
+}
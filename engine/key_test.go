@@ -0,0 +1,77 @@
+package engine
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestKeyTypes inserts keys into tables keyed on columns of each type and
+// checks that only keys of the declared type are accepted
+func TestKeyTypes(t *testing.T) {
+	tests := []struct {
+		name    string
+		columns []string
+		row     []string
+		wantErr string // "" when the row is accepted
+	}{
+		{"int key", []string{"id int", "name text"}, []string{"42", "1", "alice"}, ""},
+		{"negative int key", []string{"id int", "name text"}, []string{"-7", "1", "alice"}, ""},
+		{"word in an int key", []string{"id int", "name text"}, []string{"abc", "1", "alice"}, "id"},
+		{"float in an int key", []string{"id int", "name text"}, []string{"4.2", "1", "alice"}, "id"},
+		{"digits then text in a bigint key", []string{"id bigint", "name text"}, []string{"12ab", "1", "alice"}, "id"},
+		{"word in a serial key", []string{"id serial", "name text"}, []string{"abc", "1", "alice"}, "id"},
+		{"float key", []string{"price float", "name text"}, []string{"4.5", "1", "tea"}, ""},
+		{"word in a float key", []string{"price float", "name text"}, []string{"cheap", "1", "tea"}, "price"},
+		{"text key", []string{"code text", "name text"}, []string{"abc", "1", "alice"}, ""},
+		{"number in a text key", []string{"code text", "name text"}, []string{"42", "1", "alice"}, ""},
+		{"declared int key", []string{"name text", "number int", "PRIMARY KEY (number)"}, []string{"alice", "1", "x1"}, "number"},
+		{"composite key", []string{"student int", "course text", "PRIMARY KEY (student, course)"}, []string{"7", "1", "math"}, ""},
+		{"word in a composite key", []string{"student int", "course text", "PRIMARY KEY (student, course)"}, []string{"seven", "1", "math"}, "student"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			if err := db.CreateTable("t", tt.columns); err != nil {
+				t.Fatal(err)
+			}
+			err := db.InsertRow("t", tt.row)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("InsertRow: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("InsertRow: got %v, want an error naming column %s", err, tt.wantErr)
+			}
+			if stats, _ := db.Stats("t"); stats.LiveRows != 0 {
+				t.Errorf("the rejected row was written: %+v", stats)
+			}
+		})
+	}
+}
+
+// TestKeyTypesOnUpdateAndImport checks that updates and imports can't bring
+// in a key of the wrong type either
+func TestKeyTypesOnUpdateAndImport(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.CreateTable("t", []string{"name text", "number int", "PRIMARY KEY (number)"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.InsertRow("t", []string{"alice", "1", "1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.UpdateRow("t", "1", map[string]string{"number": "one"}); err == nil || !strings.Contains(err.Error(), "number") {
+		t.Errorf("UpdateRow to a word key: %v", err)
+	}
+	if _, err := db.ImportRows("t", [][]string{{"bob", "1", "2"}, {"carol", "1", "three"}}); err == nil || !strings.Contains(err.Error(), "import row 2") {
+		t.Errorf("ImportRows with a word key: %v", err)
+	}
+	if row, err := db.FindByID("t", "1"); err != nil || row[0] != "alice" {
+		t.Errorf("row 1 = %v, %v", row, err)
+	}
+	if _, err := db.FindByID("t", "2"); err == nil {
+		t.Error("the import was partly written")
+	}
+}
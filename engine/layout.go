@@ -0,0 +1,67 @@
+package engine
+
+import "pesapal-ledger/storage"
+
+// ChecksumField is the name reported for the checksum that ends every stored
+// record
+const ChecksumField = "checksum"
+
+// StoredField is one field of a record as it is laid out in the table file
+type StoredField struct {
+	Position int    `json:"position"` // 0-based field index in the record
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	// Managed fields are written by the engine, not declared in the schema
+	Managed bool   `json:"managed"`
+	Note    string `json:"note,omitempty"`
+}
+
+// RowLayout is the physical layout of a table's records, for matching query
+// results against the raw file
+type RowLayout struct {
+	Table      string        `json:"table"`
+	File       string        `json:"file"`
+	Format     string        `json:"format"`
+	Compressed bool          `json:"compressed,omitempty"`
+	Encoding   string        `json:"encoding"`
+	Fields     []StoredField `json:"fields"`
+}
+
+// Layout describes how a row of the table is stored: the first column, the
+// active_flag, the other columns, the LSN and the checksum. It only reads the
+// metadata.
+func (m TableMetadata) Layout() RowLayout {
+	layout := RowLayout{
+		Table:      m.Name,
+		File:       storage.TableFilePath(m.Name),
+		Format:     string(storage.FormatText),
+		Compressed: m.Compressed,
+		Encoding:   "one line per record: the fields joined by '|', then the checksum and '\\n'",
+	}
+	checksumNote := "hex SHA-256 of the fields before it joined by '|'"
+	if m.Format == storage.FormatBinary {
+		layout.Format = string(storage.FormatBinary)
+		layout.Encoding = "[uint32 payload length][payload]; the payload is [uint32 length][bytes] per field, then the checksum (big-endian lengths)"
+		checksumNote = "raw 32-byte SHA-256 of the length-prefixed fields before it"
+	}
+	if m.Compressed {
+		layout.Encoding += "; the whole log is gzip-compressed"
+	}
+
+	add := func(name, typ string, managed bool, note string) {
+		layout.Fields = append(layout.Fields, StoredField{Position: len(layout.Fields), Name: name, Type: typ, Managed: managed, Note: note})
+	}
+	for i, col := range m.Schema() {
+		note := ""
+		if col.Type == "blob" {
+			note = "base64"
+		}
+		add(col.Name, col.Type, false, note)
+		if i == 0 {
+			add(ActiveFlagColumn, "flag", true, "1 for a live row, 0 for a tombstone")
+		}
+	}
+	add(LSNColumn, "int", true, "log sequence number of this version; missing on rows written before LSNs")
+	add(ChecksumField, "sha256", true, checksumNote)
+	return layout
+}
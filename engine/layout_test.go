@@ -0,0 +1,97 @@
+package engine
+
+import (
+	"encoding/base64"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"pesapal-ledger/storage"
+)
+
+// TestLayoutMatchesFile checks that the layout DESCRIBE FULL reports puts
+// each field of a stored record where the record actually holds it, in both
+// record formats and in a compressed log
+func TestLayoutMatchesFile(t *testing.T) {
+	tests := []struct {
+		name       string
+		format     storage.RecordFormat
+		compressed bool
+	}{
+		{"text", storage.FormatText, false},
+		{"binary", storage.FormatBinary, false},
+		{"compressed", storage.FormatText, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			if err := db.CreateTableWithFormat("files", []string{"name text", "id int", "data blob", "PRIMARY KEY (id)"}, tt.format); err != nil {
+				t.Fatal(err)
+			}
+			if tt.compressed {
+				if err := db.SetCompression("files", true); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := db.InsertRow("files", []string{"report", "1", "7", "\x00bin"}); err != nil {
+				t.Fatal(err)
+			}
+
+			metadata, _ := db.Table("files")
+			layout := metadata.Layout()
+			if layout.Format != string(tt.format) || layout.Compressed != tt.compressed || layout.File != storage.TableFilePath("files") {
+				t.Errorf("layout = %+v", layout)
+			}
+			if tt.compressed != strings.Contains(layout.Encoding, "gzip") {
+				t.Errorf("encoding %q for a compressed log: %v", layout.Encoding, tt.compressed)
+			}
+
+			records := readRecords(t, "files")
+			if len(records) != 1 || records[0].Err != nil {
+				t.Fatalf("records = %+v", records)
+			}
+			stored := records[0].Fields
+			// The checksum isn't among the decoded fields but ends the record
+			if len(layout.Fields) != len(stored)+1 {
+				t.Fatalf("layout has %d fields, the record %d and a checksum", len(layout.Fields), len(stored))
+			}
+			want := map[string]string{
+				"name":           "report",
+				ActiveFlagColumn: "1",
+				"id":             "7",
+				"data":           base64.StdEncoding.EncodeToString([]byte("\x00bin")),
+			}
+			for _, field := range layout.Fields {
+				switch field.Name {
+				case ChecksumField:
+					if field.Position != len(stored) || !field.Managed {
+						t.Errorf("checksum field = %+v", field)
+					}
+				case LSNColumn:
+					if lsn, err := strconv.ParseUint(stored[field.Position], 10, 64); err != nil || lsn == 0 || !field.Managed {
+						t.Errorf("LSN field %+v holds %q", field, stored[field.Position])
+					}
+				default:
+					if got := stored[field.Position]; got != want[field.Name] {
+						t.Errorf("field %s at %d holds %q, want %q", field.Name, field.Position, got, want[field.Name])
+					}
+					if field.Managed != (field.Name == ActiveFlagColumn) {
+						t.Errorf("field %+v: managed is wrong", field)
+					}
+				}
+			}
+
+			// In a plain text log the checksum is the last '|'-separated field
+			if tt.format == storage.FormatText && !tt.compressed {
+				data, err := os.ReadFile(layout.File)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if n := len(strings.Split(strings.TrimSuffix(string(data), "\n"), "|")); n != len(layout.Fields) {
+					t.Errorf("the line has %d fields, the layout %d", n, len(layout.Fields))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Limits caps how much schema a client can create and how much a query can
+// hold in memory. Every table keeps an in-memory index and a storage writer,
+// so unbounded CREATE TABLE spam would exhaust memory and file handles, and a
+// SELECT without a filter on a big table would build its whole result at
+// once. Zero means unlimited.
+type Limits struct {
+	MaxTables     int // tables in the database
+	MaxColumns    int // columns per table, including the id
+	MaxResultRows int // rows a SELECT may collect
+}
+
+// DefaultLimits are generous for real schemas but finite
+var DefaultLimits = Limits{
+	MaxTables:     1000,
+	MaxColumns:    256,
+	MaxResultRows: 100000,
+}
+
+// ErrResultTooLarge is returned when a SELECT collects more rows than
+// Limits.MaxResultRows
+var ErrResultTooLarge = errors.New("result too large")
+
+// checkColumnLimit rejects a table definition with too many columns
+func (l Limits) checkColumnLimit(name string, columns int) error {
+	if l.MaxColumns > 0 && columns > l.MaxColumns {
+		return fmt.Errorf("table %s has %d columns, more than the limit of %d", name, columns, l.MaxColumns)
+	}
+	return nil
+}
+
+// checkTableLimit rejects a new table once the database holds the maximum.
+// Callers must hold db.mu.
+func (db *Database) checkTableLimit(name string) error {
+	if max := db.Limits.MaxTables; max > 0 && len(db.Tables) >= max {
+		return fmt.Errorf("cannot create table %s: the limit of %d tables has been reached", name, max)
+	}
+	return nil
+}
+
+// collectRow counts a row a query keeps in memory and fails once the query
+// holds more than MaxResultRows, before the rest are read. Only traced reads
+// are capped: SELECTs run through the server trace theirs, while internal
+// reads such as DUMP and RETURNING pass a nil trace.
+func (db *Database) collectRow(trace *Trace) error {
+	max := db.Limits.MaxResultRows
+	if max <= 0 || trace.collect() <= int64(max) {
+		return nil
+	}
+	return fmt.Errorf("%w: the query collects more than %d rows; narrow it with WHERE, page through the table with WHERE id BETWEEN lo AND hi, or read the newest rows with TAIL n", ErrResultTooLarge, max)
+}
@@ -0,0 +1,123 @@
+package engine
+
+import (
+	"errors"
+	"pesapal-ledger/storage"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestSchemaLimits creates tables against small caps and checks the table
+// and column limits are enforced, with nothing created past them
+func TestSchemaLimits(t *testing.T) {
+	db := newTestDB(t)
+	db.Limits = Limits{MaxTables: 2, MaxColumns: 3}
+
+	tests := []struct {
+		name    string
+		create  func() error
+		wantErr string // "" when the create must succeed
+	}{
+		{"columns at the limit", func() error { return db.CreateTable("a", []string{"id int", "x int", "y int"}) }, ""},
+		{"one column too many", func() error { return db.CreateTable("b", []string{"id int", "x int", "y int", "z int"}) }, "has 4 columns, more than the limit of 3"},
+		{"constraints don't count as columns", func() error {
+			return db.CreateTable("b", []string{"id int", "x int", "y int", "CHECK (x > 0)", "PRIMARY KEY (id, x)"})
+		}, ""},
+		{"one table too many", func() error { return db.CreateTable("c", []string{"id int"}) }, "the limit of 2 tables has been reached"},
+		{"existing table at the limit", func() error {
+			result, err := db.CreateTableIfNotExists("a", []string{"id int"}, storage.FormatText)
+			if err == nil && result.Created {
+				t.Error("CREATE TABLE IF NOT EXISTS created a table that exists")
+			}
+			return err
+		}, ""},
+		{"limits lifted", func() error {
+			db.Limits = Limits{}
+			return db.CreateTable("c", []string{"id int", "v1 int", "v2 int", "v3 int", "v4 int"})
+		}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.create()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("got %v, want success", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	if got := strings.Join(db.ListTables(), ","); got != "a,b,c" {
+		t.Errorf("tables = %s, want a,b,c", got)
+	}
+}
+
+// TestMaxResultRows reads a five-row table with a cap of three rows and
+// checks every traced read fails once it would hold a fourth row, while
+// untraced internal reads are not capped
+func TestMaxResultRows(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.CreateTable("t", []string{"id int", "kind text"}); err != nil {
+		t.Fatal(err)
+	}
+	for i, kind := range []string{"a", "a", "a", "b", "b"} {
+		if err := db.InsertRow("t", []string{strconv.Itoa(i + 1), "1", kind}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Limits.MaxResultRows = 3
+
+	tests := []struct {
+		name     string
+		read     func(r Reader) ([][]string, error)
+		wantRows int // -1 when the read must fail
+	}{
+		{"select all", func(r Reader) ([][]string, error) { return r.SelectAll("t") }, -1},
+		{"select by column at the cap", func(r Reader) ([][]string, error) { return r.SelectByColumn("t", "kind", "a") }, 3},
+		{"select by column under the cap", func(r Reader) ([][]string, error) { return r.SelectByColumn("t", "kind", "b") }, 2},
+		{"select where over the cap", func(r Reader) ([][]string, error) {
+			return r.SelectWhere("t", []Predicate{{Column: "id", Op: ">", Value: "1"}})
+		}, -1},
+		{"select where at the cap", func(r Reader) ([][]string, error) {
+			return r.SelectWhere("t", []Predicate{{Column: "id", Op: ">", Value: "2"}})
+		}, 3},
+		{"select in over the cap", func(r Reader) ([][]string, error) { return r.SelectIn("t", "kind", []string{"a", "b"}) }, -1},
+		{"range at the cap", func(r Reader) ([][]string, error) { return r.RangeByID("t", "2", "4") }, 3},
+		{"range over the cap", func(r Reader) ([][]string, error) { return r.RangeByID("t", "1", "4") }, -1},
+		{"tail at the cap", func(r Reader) ([][]string, error) { return r.TailRows("t", 3) }, 3},
+		{"tail over the cap", func(r Reader) ([][]string, error) { return r.TailRows("t", 4) }, -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := tt.read(db.Reader(&Trace{}))
+			if tt.wantRows < 0 {
+				if !errors.Is(err, ErrResultTooLarge) {
+					t.Fatalf("err = %v, want ErrResultTooLarge", err)
+				}
+				if !strings.Contains(err.Error(), "more than 3 rows") {
+					t.Errorf("err = %v, want it to name the cap", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rows) != tt.wantRows {
+				t.Errorf("got %d rows, want %d", len(rows), tt.wantRows)
+			}
+		})
+	}
+
+	if rows, err := db.SelectAll("t"); err != nil || len(rows) != 5 {
+		t.Errorf("untraced SelectAll = %d rows, %v; want all 5", len(rows), err)
+	}
+	db.Limits.MaxResultRows = 0
+	if rows, err := db.Reader(&Trace{}).SelectAll("t"); err != nil || len(rows) != 5 {
+		t.Errorf("uncapped SelectAll = %d rows, %v; want all 5", len(rows), err)
+	}
+}
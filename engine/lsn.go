@@ -0,0 +1,117 @@
+package engine
+
+import (
+	"fmt"
+	"pesapal-ledger/storage"
+	"strconv"
+)
+
+// LSNColumn is the pseudo-column that selects the log sequence number of a
+// row's current version, e.g. "SELECT id, _lsn FROM t". It is meant for
+// debugging and isn't part of SELECT *.
+const LSNColumn = "_lsn"
+
+// Every row version written (inserts, updates and tombstones) is stamped with
+// a log sequence number: a database-wide counter, stored as the last field of
+// the row after the column values:
+//
+//	[id, active, col1, col2, ..., lsn]
+//
+// LSNs only grow, so they order writes independently of file offsets, which
+// change when a log is rewritten. Rows written before LSNs existed have none
+// and report 0.
+
+// lsnSequence names the sequence file saving the LSN high-water mark. Purge
+// can remove the rows holding the highest LSNs, and recovery must not hand
+// those out again.
+const lsnSequence = ".lsn"
+
+// rowWidth is the number of fields of a stored row without its LSN
+func (m TableMetadata) rowWidth() int {
+	return len(m.Columns) + 1 // the columns plus the active_flag
+}
+
+// stampLSN returns a copy of row with the next LSN appended. Callers must hold
+// db.writeMu, which keeps LSNs in append order within each table.
+func (db *Database) stampLSN(row []string) []string {
+	stamped := make([]string, len(row), len(row)+1)
+	copy(stamped, row)
+	return append(stamped, strconv.FormatInt(db.lsn.Add(1), 10))
+}
+
+// observeLSN raises the LSN counter to at least lsn, so recovery resumes
+// after the highest LSN in the logs
+func (db *Database) observeLSN(lsn int64) {
+	for {
+		current := db.lsn.Load()
+		if lsn <= current || db.lsn.CompareAndSwap(current, lsn) {
+			return
+		}
+	}
+}
+
+// recoverLSN raises the LSN counter to the saved high-water mark, if any
+func (db *Database) recoverLSN() error {
+	lsn, err := storage.ReadSequence(lsnSequence)
+	if err != nil {
+		return err
+	}
+	db.observeLSN(lsn)
+	return nil
+}
+
+// LastLSN returns the highest LSN handed out or recovered
+func (db *Database) LastLSN() int64 {
+	return db.lsn.Load()
+}
+
+// rowLSN returns the LSN of a stored row with width data fields, or 0 if the
+// row has none
+func rowLSN(row []string, width int) int64 {
+	if width <= 0 || len(row) <= width {
+		return 0
+	}
+	lsn, err := strconv.ParseInt(row[len(row)-1], 10, 64)
+	if err != nil {
+		return 0
+	}
+	return lsn
+}
+
+// LSNs returns the LSN of the current version of each row, in order. rows are
+// stored rows as returned by the select methods, which drop the LSN, so each
+// one is read again by id.
+func (db *Database) LSNs(tableName string, rows [][]string) ([]int64, error) {
+	db.mu.RLock()
+	index, exists := db.Indexes[tableName]
+	metadata := db.Tables[tableName]
+	offsets := make([]int64, 0, len(rows))
+	for _, row := range rows {
+		if offset, found := index[metadata.rowKey(row)]; found {
+			offsets = append(offsets, offset)
+		} else {
+			offsets = append(offsets, -1) // deleted since it was read
+		}
+	}
+	db.mu.RUnlock()
+	if !exists {
+		return nil, TableNotExist(tableName)
+	}
+
+	read, err := rowReader(tableName, offsets)
+	if err != nil {
+		return nil, err
+	}
+	lsns := make([]int64, len(rows))
+	for i, offset := range offsets {
+		if offset < 0 {
+			continue
+		}
+		row, err := read(offset)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read row for id %s: %w", rows[i][0], err)
+		}
+		lsns[i] = rowLSN(row, metadata.rowWidth())
+	}
+	return lsns, nil
+}
@@ -0,0 +1,87 @@
+package engine
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestLSNsSurviveCompaction checks that every write takes the next LSN across
+// tables, and that compaction and restarts keep each row's LSN and never
+// hand out one again, even after the versions holding the highest were
+// compacted away
+func TestLSNsSurviveCompaction(t *testing.T) {
+	db := newTestDB(t)
+	for _, table := range []string{"accounts", "audit"} {
+		if err := db.CreateTable(table, []string{"id int", "note text"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writes := []struct {
+		name  string
+		write func() error
+	}{
+		{"insert", func() error { return db.InsertRow("accounts", []string{"1", "1", "a"}) }},
+		{"insert into another table", func() error { return db.InsertRow("audit", []string{"1", "1", "x"}) }},
+		{"insert", func() error { return db.InsertRow("accounts", []string{"2", "1", "b"}) }},
+		{"update", func() error { return db.UpdateRow("accounts", "1", map[string]string{"note": "a2"}) }},
+		{"insert", func() error { return db.InsertRow("accounts", []string{"3", "1", "c"}) }},
+		{"delete", func() error { return db.DeleteRow("accounts", "3") }},
+	}
+	last := db.LastLSN()
+	for _, w := range writes {
+		if err := w.write(); err != nil {
+			t.Fatalf("%s: %v", w.name, err)
+		}
+		if got := db.LastLSN(); got != last+1 {
+			t.Fatalf("%s: LSN %d after %d, want the next one", w.name, got, last)
+		}
+		last = db.LastLSN()
+	}
+
+	want := map[string]int64{"1": last - 2, "2": last - 3}
+	if got := rowLSNs(t, db, "accounts"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("LSNs = %v, want %v", got, want)
+	}
+
+	// Compaction drops the tombstone holding the highest LSN
+	if _, err := db.Compact("accounts"); err != nil {
+		t.Fatal(err)
+	}
+	if got := rowLSNs(t, db, "accounts"); !reflect.DeepEqual(got, want) {
+		t.Errorf("LSNs after compaction = %v, want %v", got, want)
+	}
+
+	db = reopen(t, db)
+	if got := rowLSNs(t, db, "accounts"); !reflect.DeepEqual(got, want) {
+		t.Errorf("LSNs after restart = %v, want %v", got, want)
+	}
+	if got := db.LastLSN(); got != last {
+		t.Errorf("recovered LSN counter %d, want %d", got, last)
+	}
+	if err := db.InsertRow("accounts", []string{"4", "1", "d"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := rowLSNs(t, db, "accounts")["4"]; got != last+1 {
+		t.Errorf("first LSN after restart %d, want %d", got, last+1)
+	}
+}
+
+// rowLSNs maps the id of each live row of a table to the LSN of its current
+// version
+func rowLSNs(t *testing.T, db *Database, tableName string) map[string]int64 {
+	t.Helper()
+	rows, err := db.SelectAll(tableName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lsns, err := db.LSNs(tableName, rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byID := make(map[string]int64, len(rows))
+	for i, row := range rows {
+		byID[row[0]] = lsns[i]
+	}
+	return byID
+}
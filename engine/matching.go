@@ -0,0 +1,70 @@
+package engine
+
+import "fmt"
+
+// MatchingKeys returns the keys of the live rows whose column colName equals
+// value, in key order and at most limit of them. An empty colName matches
+// every live row. UPDATE and DELETE ... LIMIT n use it to pick their rows.
+func (db *Database) MatchingKeys(tableName, colName, value string, limit int) ([]string, error) {
+	if colName == "" {
+		return db.MatchingKeysWhere(tableName, nil, limit)
+	}
+	return db.MatchingKeysWhere(tableName, []Predicate{{Column: colName, Op: "=", Value: value}}, limit)
+}
+
+// MatchingKeysWhere is MatchingKeys for the rows satisfying every predicate
+// (see SelectWhere). No predicates match every live row.
+func (db *Database) MatchingKeysWhere(tableName string, preds []Predicate, limit int) ([]string, error) {
+	if limit < 0 {
+		return nil, fmt.Errorf("limit must not be negative, got %d", limit)
+	}
+
+	var keys []string
+	if len(preds) == 0 {
+		ids, err := db.liveIDs(tableName)
+		if err != nil {
+			return nil, err
+		}
+		keys = ids // already in key order
+	} else {
+		rows, err := db.selectWhere(tableName, preds, nil)
+		if err != nil {
+			return nil, err
+		}
+		keys = db.rowKeys(tableName, rows)
+	}
+
+	if len(keys) > limit {
+		keys = keys[:limit]
+	}
+	return keys, nil
+}
+
+// MatchingKeysFunc is MatchingKeys for the rows for which match reports true
+// (see SelectMatching).
+func (db *Database) MatchingKeysFunc(tableName string, match func(row []string) bool, limit int) ([]string, error) {
+	if limit < 0 {
+		return nil, fmt.Errorf("limit must not be negative, got %d", limit)
+	}
+	rows, err := db.selectMatching(tableName, match, nil)
+	if err != nil {
+		return nil, err
+	}
+	keys := db.rowKeys(tableName, rows)
+	if len(keys) > limit {
+		keys = keys[:limit]
+	}
+	return keys, nil
+}
+
+// rowKeys returns the primary keys of rows, which come in key order
+func (db *Database) rowKeys(tableName string, rows [][]string) []string {
+	db.mu.RLock()
+	metadata := db.Tables[tableName]
+	db.mu.RUnlock()
+	keys := make([]string, len(rows))
+	for i, row := range rows {
+		keys[i] = metadata.rowKey(row)
+	}
+	return keys
+}
@@ -0,0 +1,65 @@
+package engine
+
+import "sort"
+
+// SortRows orders stored rows of a table by one column, in place. Values of
+// int and float columns compare as numbers, dates and timestamps as times,
+// bools false first and everything else as text (case-sensitive). Empty
+// values are NULL and come first, or last when desc is set. The sort is
+// stable, so rows with equal values keep their order.
+func (db *Database) SortRows(tableName string, rows [][]string, column string, desc bool) error {
+	metadata, exists := db.Table(tableName)
+	if !exists {
+		return TableNotExist(tableName)
+	}
+	col, pos, err := findColumn(metadata, column)
+	if err != nil {
+		return err
+	}
+
+	keys := make([]interface{}, len(rows))
+	for i, row := range rows {
+		keys[i] = sortValue(col, pos, row)
+	}
+	sort.Stable(rowSorter{rows: rows, keys: keys, desc: desc})
+	return nil
+}
+
+// sortValue is the value a row is sorted on: nil for NULL
+func sortValue(col Column, pos int, row []string) interface{} {
+	if pos >= len(row) || row[pos] == "" {
+		return nil
+	}
+	raw := row[pos]
+	switch {
+	case col.Type == "blob":
+		return raw
+	case col.IsTimeType():
+		if t, err := ParseTime(col, raw); err == nil {
+			return t
+		}
+		return raw
+	}
+	return TypedValue(col, raw)
+}
+
+// rowSorter sorts rows by precomputed keys, moving both together
+type rowSorter struct {
+	rows [][]string
+	keys []interface{}
+	desc bool
+}
+
+func (s rowSorter) Len() int { return len(s.rows) }
+
+func (s rowSorter) Less(i, j int) bool {
+	if s.desc {
+		return CompareValues(s.keys[i], s.keys[j]) > 0
+	}
+	return CompareValues(s.keys[i], s.keys[j]) < 0
+}
+
+func (s rowSorter) Swap(i, j int) {
+	s.rows[i], s.rows[j] = s.rows[j], s.rows[i]
+	s.keys[i], s.keys[j] = s.keys[j], s.keys[i]
+}
@@ -0,0 +1,63 @@
+package engine
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestSortRows sorts stored rows on columns of each type family, with NULLs
+// first ascending and last descending, and ties kept in their order
+func TestSortRows(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.CreateTable("t", []string{"id int", "n int", "settled bool", "note text"}); err != nil {
+		t.Fatal(err)
+	}
+	rows := [][]string{
+		{"1", "1", "10", "true", "b"},
+		{"2", "1", "9", "false", "B"},
+		{"3", "1", "", "true", "a"},
+		{"4", "1", "100", "false", ""},
+		{"5", "1", "9", "true", "b"},
+		// Short, as rows written before a column was added are
+		{"6", "1"},
+	}
+
+	tests := []struct {
+		column string
+		desc   bool
+		want   []string // ids in order
+	}{
+		{"n", false, []string{"3", "6", "2", "5", "1", "4"}},
+		{"n", true, []string{"4", "1", "2", "5", "3", "6"}},
+		{"settled", false, []string{"6", "2", "4", "1", "3", "5"}},
+		{"note", false, []string{"4", "6", "2", "3", "1", "5"}},
+		{"ID", true, []string{"6", "5", "4", "3", "2", "1"}},
+	}
+	for _, tt := range tests {
+		name := tt.column
+		if tt.desc {
+			name += " desc"
+		}
+		t.Run(name, func(t *testing.T) {
+			sorted := append([][]string(nil), rows...)
+			if err := db.SortRows("t", sorted, tt.column, tt.desc); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, row := range sorted {
+				got = append(got, row[0])
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("order = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if err := db.SortRows("t", rows, "nope", false); err == nil || !strings.Contains(err.Error(), "nope") {
+		t.Errorf("unknown column: err = %v", err)
+	}
+	if err := db.SortRows("missing", rows, "id", false); err == nil {
+		t.Error("SortRows of an unknown table succeeded")
+	}
+}
@@ -0,0 +1,146 @@
+package engine
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// compareIDs orders two primary keys.
+// Keys that both parse as finite numbers are compared numerically (so
+// "9" < "10"), otherwise they fall back to plain string comparison. Numeric
+// keys always sort before non-numeric ones so mixed tables still have a
+// stable order. "NaN", "Inf" and the like are text: NaN compares unordered,
+// which would break the sort OrderedKeys relies on. Composite keys are
+// compared part by part, so (2, b) sorts before (10, a).
+func compareIDs(a, b string) int {
+	if !strings.Contains(a, keySeparator) && !strings.Contains(b, keySeparator) {
+		return compareKeyParts(a, b)
+	}
+	partsA := strings.Split(a, keySeparator)
+	partsB := strings.Split(b, keySeparator)
+	for i := 0; i < len(partsA) && i < len(partsB); i++ {
+		if c := compareKeyParts(partsA[i], partsB[i]); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case len(partsA) < len(partsB):
+		return -1
+	case len(partsA) > len(partsB):
+		return 1
+	}
+	return 0
+}
+
+// compareKeyParts orders two single key values, numbers first
+func compareKeyParts(a, b string) int {
+	fa, okA := numericID(a)
+	fb, okB := numericID(b)
+
+	switch {
+	case okA && okB:
+		if fa < fb {
+			return -1
+		}
+		if fa > fb {
+			return 1
+		}
+		return strings.Compare(a, b)
+	case okA:
+		return -1
+	case okB:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// numericID parses a key that compareIDs orders as a number
+func numericID(id string) (float64, bool) {
+	f, err := strconv.ParseFloat(id, 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, false
+	}
+	return f, true
+}
+
+// sortRowsByKey orders rows by primary key with compareIDs, the order
+// OrderedKeys keeps, so a filtered result lists rows like a range does
+func sortRowsByKey(metadata TableMetadata, rows [][]string) {
+	sort.SliceStable(rows, func(i, j int) bool {
+		return compareIDs(metadata.rowKey(rows[i]), metadata.rowKey(rows[j])) < 0
+	})
+}
+
+// OrderedKeys keeps the live primary keys of a table sorted with compareIDs.
+// It sits next to the hash Index so range and ordered-by-id queries can
+// walk the keys in order instead of scanning the whole map.
+type OrderedKeys struct {
+	keys []string
+}
+
+// newOrderedKeys builds the sorted key list for an existing index in one pass
+func newOrderedKeys(index Index) *OrderedKeys {
+	keys := make([]string, 0, len(index))
+	for id := range index {
+		keys = append(keys, id)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return compareIDs(keys[i], keys[j]) < 0
+	})
+	return &OrderedKeys{keys: keys}
+}
+
+// search returns the position of the first key >= id
+func (o *OrderedKeys) search(id string) int {
+	return sort.Search(len(o.keys), func(i int) bool {
+		return compareIDs(o.keys[i], id) >= 0
+	})
+}
+
+// Insert adds a key, keeping the slice sorted. Existing keys are ignored.
+func (o *OrderedKeys) Insert(id string) {
+	pos := o.search(id)
+	if pos < len(o.keys) && o.keys[pos] == id {
+		return
+	}
+	o.keys = append(o.keys, "")
+	copy(o.keys[pos+1:], o.keys[pos:])
+	o.keys[pos] = id
+}
+
+// Remove deletes a key if present
+func (o *OrderedKeys) Remove(id string) {
+	pos := o.search(id)
+	if pos < len(o.keys) && o.keys[pos] == id {
+		o.keys = append(o.keys[:pos], o.keys[pos+1:]...)
+	}
+}
+
+// Range returns the keys k with lo <= k <= hi, in order
+func (o *OrderedKeys) Range(lo, hi string) []string {
+	start := o.search(lo)
+	end := sort.Search(len(o.keys), func(i int) bool {
+		return compareIDs(o.keys[i], hi) > 0
+	})
+	if start >= end {
+		return nil
+	}
+
+	result := make([]string, end-start)
+	copy(result, o.keys[start:end])
+	return result
+}
+
+// Keys returns a copy of all live keys, in order
+func (o *OrderedKeys) Keys() []string {
+	result := make([]string, len(o.keys))
+	copy(result, o.keys)
+	return result
+}
+
+// Len returns the number of live keys
+func (o *OrderedKeys) Len() int {
+	return len(o.keys)
+}
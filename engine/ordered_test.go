@@ -0,0 +1,158 @@
+package engine
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+func TestOrderedKeysRange(t *testing.T) {
+	keys := &OrderedKeys{}
+	for _, id := range []string{"10", "NaN", "9", "Inf", "100", "b", "-Inf", "2", "a", "9", "infinity", "NaN"} {
+		keys.Insert(id)
+	}
+	keys.Remove("100")
+
+	all := keys.Keys()
+	if !sort.SliceIsSorted(all, func(i, j int) bool { return compareIDs(all[i], all[j]) < 0 }) {
+		t.Fatalf("keys out of order: %v", all)
+	}
+
+	tests := []struct {
+		lo, hi string
+		want   []string
+	}{
+		{"2", "10", []string{"2", "9", "10"}},
+		{"3", "9", []string{"9"}},
+		{"11", "99", nil},
+		{"0", "z", []string{"2", "9", "10", "-Inf", "Inf", "NaN", "a", "b", "infinity"}},
+		// Not-a-number and infinite ids are text, not numbers out of range
+		{"A", "Z", []string{"Inf", "NaN"}},
+		{"9", "1e308", []string{"9", "10"}},
+		{"-1e308", "0", nil},
+	}
+	for _, tt := range tests {
+		if got := keys.Range(tt.lo, tt.hi); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Range(%s, %s) = %v, want %v", tt.lo, tt.hi, got, tt.want)
+		}
+	}
+}
+
+// BenchmarkRangeScan reads 100 ids out of a 10000-row table through the
+// ordered keys, and by filtering a full scan as the range did before them
+func BenchmarkRangeScan(b *testing.B) {
+	db := newTestDB(b)
+	if err := db.CreateTable("transactions", []string{"id int", "amount int"}); err != nil {
+		b.Fatal(err)
+	}
+	for i := 1; i <= 10000; i++ {
+		id := strconv.Itoa(i)
+		if err := db.InsertRow("transactions", []string{id, "1", id}); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.Run("ordered keys", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			rows, err := db.RangeByID("transactions", "5000", "5099")
+			if err != nil || len(rows) != 100 {
+				b.Fatalf("RangeByID = %d rows, %v", len(rows), err)
+			}
+		}
+	})
+	b.Run("full scan", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			rows, err := db.SelectAll("transactions")
+			if err != nil {
+				b.Fatal(err)
+			}
+			var matched [][]string
+			for _, row := range rows {
+				if compareIDs(row[0], "5000") >= 0 && compareIDs(row[0], "5099") <= 0 {
+					matched = append(matched, row)
+				}
+			}
+			if len(matched) != 100 {
+				b.Fatalf("full scan matched %d rows", len(matched))
+			}
+		}
+	})
+}
+
+// TestSelectByColumnKeyOrder checks that SelectByColumn and SelectIn list
+// their matches in primary key order, whatever order they sit in the table
+// file, and the same way on every call
+func TestSelectByColumnKeyOrder(t *testing.T) {
+	tests := []struct {
+		name    string
+		columns []string
+		rows    [][]string // inserted in this order
+		update  string     // key of a row rewritten to the end of the file
+		column  string
+		value   string
+		want    []string // the keys, as rowKey gives them
+	}{
+		{"int key", []string{"id int", "grp text"},
+			[][]string{{"10", "1", "a"}, {"2", "1", "a"}, {"33", "1", "b"}, {"1", "1", "a"}, {"9", "1", "a"}},
+			"2", "grp", "a", []string{"1", "2", "9", "10"}},
+		{"text key", []string{"code text", "grp text"},
+			[][]string{{"b", "1", "x"}, {"c", "1", "x"}, {"a", "1", "x"}, {"d", "1", "y"}},
+			"b", "grp", "x", []string{"a", "b", "c"}},
+		{"composite key", []string{"student int", "course text", "grade text", "PRIMARY KEY (student, course)"},
+			[][]string{{"10", "1", "math", "A"}, {"2", "1", "math", "A"}, {"2", "1", "art", "A"}, {"1", "1", "art", "B"}},
+			"", "grade", "A", []string{"2\x1fart", "2\x1fmath", "10\x1fmath"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			if err := db.CreateTable("t", tt.columns); err != nil {
+				t.Fatal(err)
+			}
+			for _, row := range tt.rows {
+				if err := db.InsertRow("t", row); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.update != "" {
+				if err := db.UpdateRow("t", tt.update, map[string]string{tt.column: tt.value}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			metadata := db.Tables["t"]
+			var first []string
+			for i := 0; i < 3; i++ {
+				rows, err := db.SelectByColumn("t", tt.column, tt.value)
+				if err != nil {
+					t.Fatal(err)
+				}
+				in, err := db.SelectIn("t", tt.column, []string{tt.value})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(in, rows) {
+					t.Fatalf("SelectIn = %v, SelectByColumn = %v", in, rows)
+				}
+				keys := make([]string, len(rows))
+				for j, row := range rows {
+					keys[j] = metadata.rowKey(row)
+				}
+				if !sort.SliceIsSorted(keys, func(a, b int) bool { return compareIDs(keys[a], keys[b]) < 0 }) {
+					t.Fatalf("keys out of order: %v", keys)
+				}
+				if tt.want != nil && !reflect.DeepEqual(keys, tt.want) {
+					t.Fatalf("keys = %q, want %q", keys, tt.want)
+				}
+				if i == 0 {
+					first = keys
+				} else if !reflect.DeepEqual(keys, first) {
+					t.Fatalf("call %d listed %v, the first %v", i+1, keys, first)
+				}
+			}
+			if len(first) == 0 {
+				t.Fatal("no rows matched")
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"pesapal-ledger/storage"
+)
+
+// ErrTableFileChanged is returned, in paranoid mode, by a read that finds its
+// table file was changed from outside the server while a write holds the
+// table, so the index can't be rebuilt yet. Retrying after the write
+// finishes rebuilds it.
+var ErrTableFileChanged = errors.New("table file was changed outside the server")
+
+// watchTableFile starts watching a table file for outside changes in
+// paranoid mode. Call it before reading the file into the index, so that a
+// change made during the read is noticed afterwards.
+func (db *Database) watchTableFile(tableName string) {
+	if !db.Paranoid {
+		return
+	}
+	if err := storage.WatchTableFile(tableName); err != nil {
+		fmt.Printf("Warning: can't watch table file %s for outside changes: %v\n", tableName, err)
+	}
+}
+
+// checkTableFile runs before a read trusts the indexed offsets of a table in
+// paranoid mode: if the file's size or mtime moved since it was indexed,
+// without the server writing it, the index is rebuilt from the file first.
+// The server's own writes never count as a change, even mid-append. The
+// rebuild needs writeMu; when a write holds it the read fails with
+// ErrTableFileChanged rather than wait. Row writes check the file themselves
+// on the way in (see resyncTableFile), so their own reads find it current.
+func (db *Database) checkTableFile(tableName string) error {
+	changed, err := storage.TableFileChanged(tableName)
+	if err != nil || !changed {
+		return err
+	}
+	if !db.writeMu.TryLock() {
+		return fmt.Errorf("%w: %s (retry once the running write finishes)", ErrTableFileChanged, tableName)
+	}
+	defer db.writeMu.Unlock()
+	return db.resyncTableFile(tableName)
+}
+
+// resyncTableFile rebuilds a table's index in paranoid mode if its file was
+// changed from outside since it was indexed. Callers must hold db.writeMu.
+func (db *Database) resyncTableFile(tableName string) error {
+	if !db.Paranoid {
+		return nil
+	}
+	if changed, err := storage.TableFileChanged(tableName); err != nil || !changed {
+		return err
+	}
+	fmt.Printf("Warning: table file %s was changed outside the server; rebuilding its index\n", tableName)
+	storage.ResyncTableFile(tableName)
+	return db.RebuildIndex(tableName)
+}
@@ -0,0 +1,99 @@
+package engine
+
+import (
+	"os"
+	"pesapal-ledger/storage"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// newParanoidDB is newTestDB with paranoid reads and an accounts table
+func newParanoidDB(t *testing.T) *Database {
+	t.Helper()
+	db := newTestDB(t)
+	db.Paranoid = true
+	if err := db.CreateTable("accounts", []string{"id int", "owner text"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.InsertRow("accounts", []string{"1", "1", "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestParanoidReadRebuildsAfterOutsideAppend(t *testing.T) {
+	db := newParanoidDB(t)
+
+	// Write the row through a scratch table, then append its bytes to the
+	// accounts file behind the server's back
+	if err := db.CreateTable("scratch", []string{"id int", "owner text"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.InsertRow("scratch", []string{"2", "1", "bob"}); err != nil {
+		t.Fatal(err)
+	}
+	storage.CloseWriters()
+	row, err := os.ReadFile(storage.TableFilePath("scratch"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.OpenFile(storage.TableFilePath("accounts"), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.Write(row); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	got, err := db.FindByID("accounts", "2")
+	if err != nil {
+		t.Fatalf("FindByID after the outside append: %v", err)
+	}
+	if got[2] != "bob" {
+		t.Errorf("appended row = %v", got)
+	}
+	if _, err := db.FindByID("accounts", "1"); err != nil {
+		t.Errorf("original row lost in the rebuild: %v", err)
+	}
+}
+
+// TestParanoidReadDuringWrites reads while other writers hold writeMu and
+// append: the server's own writes must not look like outside changes
+func TestParanoidReadDuringWrites(t *testing.T) {
+	db := newParanoidDB(t)
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.InsertRow("accounts", []string{"2", "1", "bob"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.FindByID("accounts", "1"); err != nil {
+		t.Errorf("read during an open transaction: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 3; i < 300; i++ {
+			if err := db.InsertRow("accounts", []string{strconv.Itoa(i), "1", "owner"}); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	for i := 0; i < 300; i++ {
+		if _, err := db.FindByID("accounts", "1"); err != nil {
+			t.Errorf("read %d during inserts: %v", i, err)
+			break
+		}
+	}
+	wg.Wait()
+}
@@ -0,0 +1,185 @@
+package engine
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Predicate is one "column op value" condition of a WHERE clause
+type Predicate struct {
+	Column string
+	Op     string // one of PredicateOps
+	Value  string
+}
+
+// PredicateOps are the comparison operators of a Predicate, longest first so
+// ">=" is found before ">"
+var PredicateOps = []string{">=", "<=", "<>", "!=", "=", "<", ">"}
+
+// boundPredicate is a Predicate resolved against a table's schema
+type boundPredicate struct {
+	Predicate
+	col   Column
+	pos   int // position of the column in a stored row
+	isNum bool
+	num   float64
+}
+
+// bindPredicates resolves the columns of preds and checks their operators
+// and values
+func bindPredicates(metadata TableMetadata, preds []Predicate) ([]boundPredicate, error) {
+	bound := make([]boundPredicate, len(preds))
+	for i, pred := range preds {
+		if !isPredicateOp(pred.Op) {
+			return nil, fmt.Errorf("unsupported operator %q in WHERE clause", pred.Op)
+		}
+		col, pos, err := findColumn(metadata, pred.Column)
+		if err != nil {
+			return nil, err
+		}
+		if err := CheckComparable(col); err != nil {
+			return nil, err
+		}
+		b := boundPredicate{Predicate: pred, col: col, pos: pos}
+		switch {
+		case col.Type == "bool" || col.Type == "boolean":
+			normalized, ok := NormalizeBool(pred.Value)
+			if !ok {
+				return nil, fmt.Errorf("invalid value %q for column %s: expected bool", pred.Value, col.Name)
+			}
+			b.Value = normalized
+		case col.IsTimeType():
+			if _, err := ParseTime(col, pred.Value); err != nil {
+				return nil, err
+			}
+		default:
+			b.num, err = strconv.ParseFloat(pred.Value, 64)
+			b.isNum = err == nil
+		}
+		bound[i] = b
+	}
+	return bound, nil
+}
+
+func isPredicateOp(op string) bool {
+	for _, candidate := range PredicateOps {
+		if op == candidate {
+			return true
+		}
+	}
+	return false
+}
+
+// holds reports whether a stored row satisfies the predicate. Empty values
+// are NULL and never match.
+func (p boundPredicate) holds(row []string) bool {
+	if p.pos >= len(row) || row[p.pos] == "" {
+		return false
+	}
+	cell := row[p.pos]
+
+	var cmp int
+	switch {
+	case p.col.Type == "bool" || p.col.Type == "boolean":
+		cell, _ = NormalizeBool(cell)
+		cmp = strings.Compare(cell, p.Value)
+	case p.col.IsTimeType():
+		cellTime, err := ParseTime(p.col, cell)
+		if err != nil {
+			return false
+		}
+		valueTime, _ := ParseTime(p.col, p.Value)
+		cmp = cellTime.Compare(valueTime)
+	default:
+		if n, err := strconv.ParseFloat(cell, 64); err == nil && p.isNum {
+			cmp = CompareValues(n, p.num)
+		} else if strings.EqualFold(cell, p.Value) {
+			cmp = 0 // text compares ignoring case, like SelectByColumn
+		} else {
+			cmp = strings.Compare(cell, p.Value)
+		}
+	}
+
+	switch p.Op {
+	case "=":
+		return cmp == 0
+	case "!=", "<>":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	}
+	return cmp >= 0
+}
+
+// SelectWhere returns the live rows that satisfy every predicate, in primary
+// key order. Values compare as numbers when both sides parse as numbers, as
+// times on date and timestamp columns, on the canonical form on bool
+// columns, and as text otherwise (= and != ignoring case).
+func (db *Database) SelectWhere(tableName string, preds []Predicate) ([][]string, error) {
+	return db.selectWhere(tableName, preds, nil)
+}
+
+// selectWhere is SelectWhere recording its reads in trace
+func (db *Database) selectWhere(tableName string, preds []Predicate, trace *Trace) ([][]string, error) {
+	db.mu.RLock()
+	metadata, exists := db.Tables[tableName]
+	db.mu.RUnlock()
+	if !exists {
+		return nil, TableNotExist(tableName)
+	}
+	bound, err := bindPredicates(metadata, preds)
+	if err != nil {
+		return nil, err
+	}
+	return db.selectMatching(tableName, func(row []string) bool {
+		for _, pred := range bound {
+			if !pred.holds(row) {
+				return false
+			}
+		}
+		return true
+	}, trace)
+}
+
+// SelectMatching returns the live rows for which match reports true, in
+// primary key order. It is SelectWhere for conditions a Predicate cannot
+// express, such as comparing two columns of the same row.
+func (db *Database) SelectMatching(tableName string, match func(row []string) bool) ([][]string, error) {
+	return db.selectMatching(tableName, match, nil)
+}
+
+// selectMatching is SelectMatching recording its reads in trace
+func (db *Database) selectMatching(tableName string, match func(row []string) bool, trace *Trace) ([][]string, error) {
+	db.mu.RLock()
+	metadata, exists := db.Tables[tableName]
+	db.mu.RUnlock()
+	if !exists {
+		return nil, TableNotExist(tableName)
+	}
+
+	var filtered [][]string
+	var collectErr error
+	err := db.forEachRow(tableName, trace, func(row []string) bool {
+		if !match(row) {
+			return true
+		}
+		if collectErr = db.collectRow(trace); collectErr != nil {
+			return false
+		}
+		filtered = append(filtered, row)
+		return true
+	})
+	if err == nil {
+		err = collectErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	sortRowsByKey(metadata, filtered)
+	return filtered, nil
+}
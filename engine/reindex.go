@@ -0,0 +1,36 @@
+package engine
+
+import "fmt"
+
+// ReindexResult reports a rebuilt index
+type ReindexResult struct {
+	Table            string `json:"table"`
+	LiveRows         int    `json:"liveRows"`
+	PreviousLiveRows int    `json:"previousLiveRows"` // before the rebuild
+}
+
+// Reindex rebuilds a table's index from its log, for an operator who
+// suspects the in-memory index no longer matches the file (say after it was
+// changed by hand). Writes to the table wait for it, so none is lost between
+// the scan and the swap.
+func (db *Database) Reindex(tableName string) (ReindexResult, error) {
+	db.writeMu.Lock()
+	defer db.writeMu.Unlock()
+
+	db.mu.RLock()
+	_, exists := db.Tables[tableName]
+	before := len(db.Indexes[tableName])
+	db.mu.RUnlock()
+	if !exists {
+		return ReindexResult{}, fmt.Errorf("%w: %s", ErrTableNotFound, tableName)
+	}
+
+	if err := db.RebuildIndex(tableName); err != nil {
+		return ReindexResult{}, err
+	}
+
+	db.mu.RLock()
+	after := len(db.Indexes[tableName])
+	db.mu.RUnlock()
+	return ReindexResult{Table: tableName, LiveRows: after, PreviousLiveRows: before}, nil
+}
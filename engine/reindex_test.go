@@ -0,0 +1,60 @@
+package engine
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"pesapal-ledger/storage"
+)
+
+// TestReindex appends records to a table's log behind the engine's back and
+// checks Reindex brings the index in line with the file
+func TestReindex(t *testing.T) {
+	tests := []struct {
+		name     string
+		appended [][]string
+		previous int
+		want     [][]string // live rows after the rebuild
+	}{
+		{"nothing changed", nil, 2, [][]string{{"1", "alice"}, {"2", "bob"}}},
+		{"row added", [][]string{{"3", "1", "carol"}}, 2, [][]string{{"1", "alice"}, {"2", "bob"}, {"3", "carol"}}},
+		{"row deleted", [][]string{{"1", "0", "alice"}}, 2, [][]string{{"2", "bob"}}},
+		{"row updated", [][]string{{"2", "1", "bobby"}}, 2, [][]string{{"1", "alice"}, {"2", "bobby"}}},
+		{"deleted and added back", [][]string{{"1", "0", "alice"}, {"1", "1", "alicia"}}, 2, [][]string{{"1", "alicia"}, {"2", "bob"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			if err := db.CreateTable("users", []string{"id int", "name text"}); err != nil {
+				t.Fatal(err)
+			}
+			for _, row := range [][]string{{"1", "1", "alice"}, {"2", "1", "bob"}} {
+				if err := db.InsertRow("users", row); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, row := range tt.appended {
+				if _, err := storage.AppendRow("users", row); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			result, err := db.Reindex("users")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Table != "users" || result.PreviousLiveRows != tt.previous || result.LiveRows != len(tt.want) {
+				t.Errorf("result = %+v, want %d rows before and %d after", result, tt.previous, len(tt.want))
+			}
+			if got := liveRows(t, db, "users"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("rows = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	db := newTestDB(t)
+	if _, err := db.Reindex("missing"); !errors.Is(err, ErrTableNotFound) {
+		t.Errorf("Reindex of a missing table: err = %v, want ErrTableNotFound", err)
+	}
+}
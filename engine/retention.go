@@ -0,0 +1,104 @@
+package engine
+
+import (
+	"fmt"
+	"pesapal-ledger/storage"
+)
+
+// PurgeCutoff selects what Purge removes. Rows whose key sorts before
+// BeforeID go, as do rows last written before LSN BeforeLSN. Zero values are
+// unset; at least one must be given.
+type PurgeCutoff struct {
+	BeforeID  string
+	BeforeLSN int64
+}
+
+// PurgeResult reports what a purge did
+type PurgeResult struct {
+	Table       string `json:"table"`
+	Purged      int    `json:"purged"` // live rows removed
+	Kept        int    `json:"kept"`   // live rows left
+	BytesBefore int64  `json:"bytesBefore"`
+	BytesAfter  int64  `json:"bytesAfter"`
+}
+
+// Purge removes old rows for retention in a single streaming rewrite of the
+// table's log. The new log holds only the current version of each live row
+// past the cutoff, so superseded versions and tombstones go too (the table
+// is compacted). Purged rows are removed physically, not tombstoned.
+func (db *Database) Purge(tableName string, cutoff PurgeCutoff) (PurgeResult, error) {
+	if err := db.checkTableWritable(tableName); err != nil {
+		return PurgeResult{}, err
+	}
+	if cutoff.BeforeID == "" && cutoff.BeforeLSN <= 0 {
+		return PurgeResult{}, fmt.Errorf("purge needs a cutoff")
+	}
+
+	db.writeMu.Lock()
+	defer db.writeMu.Unlock()
+	return db.purge(tableName, cutoff)
+}
+
+// purge is Purge without the write lock; callers must hold db.writeMu. A zero
+// cutoff purges nothing, which only compacts the table (see Compact).
+func (db *Database) purge(tableName string, cutoff PurgeCutoff) (PurgeResult, error) {
+	db.mu.RLock()
+	metadata, exists := db.Tables[tableName]
+	live := make(map[string]int64, len(db.Indexes[tableName]))
+	for key, offset := range db.Indexes[tableName] {
+		live[key] = offset
+	}
+	var maxID, bytesBefore int64
+	if stats, ok := db.stats[tableName]; ok {
+		maxID, bytesBefore = stats.maxID, stats.totalBytes
+	}
+	db.mu.RUnlock()
+	if !exists {
+		return PurgeResult{}, TableNotExist(tableName)
+	}
+	if cutoff.BeforeID != "" && metadata.CompositeKey() {
+		return PurgeResult{}, fmt.Errorf("table %s has a composite key; purge it by LSN instead of id", tableName)
+	}
+
+	// The rewrite may drop the rows holding the highest id or LSN; save the
+	// high-water marks so neither is handed out again after a restart
+	if metadata.AutoIncrement() && maxID > 0 {
+		if err := storage.WriteSequence(tableName, maxID); err != nil {
+			return PurgeResult{}, err
+		}
+	}
+	if err := storage.WriteSequence(lsnSequence, db.LastLSN()); err != nil {
+		return PurgeResult{}, err
+	}
+
+	result := PurgeResult{Table: tableName, BytesBefore: bytesBefore}
+	err := storage.RewriteTableFile(tableName, func(offset int64, data []string) bool {
+		if len(data) < 2 {
+			return false
+		}
+		key := metadata.rowKey(data)
+		if current, ok := live[key]; !ok || current != offset {
+			return false // a superseded version or a tombstone
+		}
+		if (cutoff.BeforeID != "" && compareIDs(key, cutoff.BeforeID) < 0) ||
+			(cutoff.BeforeLSN > 0 && rowLSN(data, metadata.rowWidth()) < cutoff.BeforeLSN) {
+			result.Purged++
+			return false
+		}
+		result.Kept++
+		return true
+	})
+	if err != nil {
+		return PurgeResult{}, fmt.Errorf("failed to purge table %s: %w", tableName, err)
+	}
+
+	if err := db.RebuildIndex(tableName); err != nil {
+		return PurgeResult{}, err
+	}
+	db.mu.RLock()
+	if stats, ok := db.stats[tableName]; ok {
+		result.BytesAfter = stats.totalBytes
+	}
+	db.mu.RUnlock()
+	return result, nil
+}
@@ -0,0 +1,46 @@
+package engine
+
+import "pesapal-ledger/storage"
+
+// DeleteRowReturning is DeleteRow that also returns the deleted row as it
+// was before the delete
+func (db *Database) DeleteRowReturning(tableName string, id string) ([]string, error) {
+	db.writeMu.Lock()
+	row, err := db.deleteRow(tableName, id)
+	db.writeMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return row, storage.WaitForSync()
+}
+
+// UpdateRowReturning is UpdateRow that also returns the new version of the row
+func (db *Database) UpdateRowReturning(tableName string, id string, updates map[string]string) ([]string, error) {
+	db.writeMu.Lock()
+	row, err := db.updateRow(tableName, id, updates)
+	db.writeMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return row, storage.WaitForSync()
+}
+
+// DeleteAllReturning is DeleteAll that returns the deleted rows instead of a
+// count. On error the rows deleted so far are returned with it.
+func (db *Database) DeleteAllReturning(tableName string) ([][]string, error) {
+	var rows [][]string
+	_, err := db.deleteAll(tableName, db.DeleteRowReturning, func(row []string) {
+		rows = append(rows, row)
+	})
+	return rows, err
+}
+
+// UpdateAllReturning is UpdateAll that returns the new row versions instead
+// of a count. On error the rows updated so far are returned with it.
+func (db *Database) UpdateAllReturning(tableName string, updates map[string]string) ([][]string, error) {
+	var rows [][]string
+	_, err := db.updateAll(tableName, updates, db.UpdateRowReturning, func(row []string) {
+		rows = append(rows, row)
+	})
+	return rows, err
+}
@@ -0,0 +1,457 @@
+package engine
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ActiveFlagColumn is the name reported for the engine-managed active_flag
+// field when describing the stored row layout.
+const ActiveFlagColumn = "active_flag"
+
+// Column is the parsed form of a column definition such as "amount int".
+// Definitions are still stored as plain strings in TableMetadata.Columns so
+// metadata.json stays backwards compatible; Column is derived on demand.
+type Column struct {
+	Name   string
+	Type   string // lower-case type name, "text" when none was declared
+	Length int    // declared maximum length of a varchar(n) or char(n); 0 means unbounded
+	Check  string // expression of a column-level CHECK constraint, if any
+}
+
+// ParseColumn parses a column definition of the form "name [type] [CHECK (expr)]"
+func ParseColumn(colDef string) Column {
+	colDef, check := splitCheck(colDef)
+	fields := strings.Fields(colDef)
+	col := Column{Type: "text", Check: check}
+	if len(fields) > 0 {
+		col.Name = fields[0]
+	}
+	if len(fields) > 1 {
+		typ := fields[1]
+		if len(fields) > 2 && strings.HasPrefix(fields[2], "(") {
+			typ += fields[2] // "varchar (255)"
+		}
+		col.Type, col.Length = parseTypeLength(strings.ToLower(typ))
+	}
+	return col
+}
+
+// parseTypeLength splits "varchar(255)" or "char(3)" into the type name and
+// its length. Other types, and a length that isn't a positive number, are
+// returned as they are, with no length.
+func parseTypeLength(typ string) (string, int) {
+	base, arg, ok := strings.Cut(typ, "(")
+	if !ok || !strings.HasSuffix(arg, ")") || (base != "varchar" && base != "char") {
+		return typ, 0
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(strings.TrimSuffix(arg, ")")))
+	if err != nil || n < 1 {
+		return typ, 0
+	}
+	return base, n
+}
+
+// Schema returns the parsed columns of a table in declaration order
+func (m TableMetadata) Schema() []Column {
+	cols := make([]Column, len(m.Columns))
+	for i, colDef := range m.Columns {
+		cols[i] = ParseColumn(colDef)
+	}
+	return cols
+}
+
+// ColumnInfo describes one column of a table for schema listings
+type ColumnInfo struct {
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	Length     int    `json:"length,omitempty"` // of a varchar(n) or char(n)
+	PrimaryKey bool   `json:"primaryKey"`
+	Check      string `json:"check,omitempty"`
+}
+
+// TableSchema is a table with its column definitions and table-level
+// constraints
+type TableSchema struct {
+	Table      string       `json:"table"`
+	Columns    []ColumnInfo `json:"columns"`
+	PrimaryKey []string     `json:"primaryKey"`
+	Checks     []string     `json:"checks,omitempty"` // table-level CHECKs
+}
+
+// Describe returns the table's schema in structured form
+func (m TableMetadata) Describe() TableSchema {
+	key := map[string]bool{}
+	for _, name := range m.KeyColumns() {
+		key[name] = true
+	}
+	schema := TableSchema{Table: m.Name, PrimaryKey: m.KeyColumns(), Checks: m.Checks}
+	for _, col := range m.Schema() {
+		schema.Columns = append(schema.Columns, ColumnInfo{Name: col.Name, Type: col.Type, Length: col.Length, PrimaryKey: key[col.Name], Check: col.Check})
+	}
+	return schema
+}
+
+// AutoIncrement reports whether the table's primary key is a serial column,
+// whose ids are assigned on insert when none is given
+func (m TableMetadata) AutoIncrement() bool {
+	return len(m.Columns) > 0 && ParseColumn(m.Columns[0]).Type == "serial"
+}
+
+// validateTableName checks a new table's name. A name is either "table" or
+// "schema.table", and names become file paths, so no part may be empty or
+// hold a path separator or control character: a "/" or ".." could reach
+// outside the data directory. (The SQL parser also limits unquoted names to
+// letters, digits and underscores.)
+func validateTableName(name string) error {
+	parts := strings.Split(name, ".")
+	if len(parts) > 2 {
+		return fmt.Errorf("invalid table name %s: expected table or schema.table", name)
+	}
+	for _, part := range parts {
+		if part == "" {
+			return fmt.Errorf("invalid table name %s: empty name", name)
+		}
+		for _, c := range part {
+			if c == '/' || c == '\\' || c < ' ' || c == 0x7f {
+				return fmt.Errorf("invalid table name %s: unexpected character %q", name, c)
+			}
+		}
+	}
+	return nil
+}
+
+// validateColumns checks a new table's column definitions: there must be at
+// least one, and names must be unique ignoring case (column resolution is
+// case-insensitive, so "id" and "ID" would be ambiguous).
+func validateColumns(columns []string) error {
+	if len(columns) == 0 {
+		return fmt.Errorf("table must have at least one column")
+	}
+
+	seen := make(map[string]bool, len(columns))
+	for _, colDef := range columns {
+		col := ParseColumn(colDef)
+		name := col.Name
+		if name == "" {
+			return fmt.Errorf("empty column definition")
+		}
+		if col.Check == "" && hasBareCheck(colDef) {
+			return fmt.Errorf("invalid CHECK constraint %q: the expression must be in parentheses", strings.TrimSpace(colDef))
+		}
+		if strings.HasPrefix(col.Type, "varchar(") || strings.HasPrefix(col.Type, "char(") {
+			return fmt.Errorf("invalid type %s for column %s: the length must be a positive number", col.Type, name)
+		}
+		key := strings.ToLower(name)
+		if seen[key] {
+			return fmt.Errorf("duplicate column name %s", name)
+		}
+		seen[key] = true
+	}
+	return nil
+}
+
+// NormalizeBool maps a boolean literal onto its canonical stored form.
+// The rule is: TRUE, true and 1 mean "true"; FALSE, false and 0 mean "false"
+// (keywords are case-insensitive). Anything else is not a boolean.
+func NormalizeBool(value string) (string, bool) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "true", "1":
+		return "true", true
+	case "false", "0":
+		return "false", true
+	}
+	return "", false
+}
+
+// normalizeValue converts a user-supplied value into the stored form for its
+// column. Blob values are stored base64-encoded, so any bytes, '|', newlines
+// and NULs included, fit in a text record; checksums cover the encoded form.
+// Dates and timestamps are checked and stored in one form (see ParseTime).
+// Numeric columns only take numbers; text and undeclared types take anything.
+// An empty value is NULL and fits every type.
+func normalizeValue(col Column, value string) (string, error) {
+	if err := checkNumeric(col, value); err != nil {
+		return "", err
+	}
+	if err := checkLength(col, value); err != nil {
+		return "", err
+	}
+	if col.Type == "blob" {
+		return base64.StdEncoding.EncodeToString([]byte(value)), nil
+	}
+	if col.IsTimeType() && value != "" {
+		t, err := ParseTime(col, value)
+		if err != nil {
+			return "", err
+		}
+		return formatTime(col, t), nil
+	}
+	if col.Type == "bool" || col.Type == "boolean" {
+		normalized, ok := NormalizeBool(value)
+		if !ok {
+			return "", fmt.Errorf("invalid value %q for column %s: expected bool", value, col.Name)
+		}
+		return normalized, nil
+	}
+	return value, nil
+}
+
+// checkNumeric rejects a value of an int or float column that isn't a number
+// of that kind, so a stray word can't end up in a column that gets summed
+func checkNumeric(col Column, value string) error {
+	if value == "" {
+		return nil
+	}
+	switch col.TypeFamily() {
+	case "integer":
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			return fmt.Errorf("invalid value %q for column %s: expected %s", value, col.Name, col.Type)
+		}
+	case "float":
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			return fmt.Errorf("invalid value %q for column %s: expected %s", value, col.Name, col.Type)
+		}
+	}
+	return nil
+}
+
+// checkLength rejects a value longer than its column's declared length,
+// counted in characters
+func checkLength(col Column, value string) error {
+	if col.Length > 0 && utf8.RuneCountInString(value) > col.Length {
+		return fmt.Errorf("value too long for column %s: %d characters, the limit is %s(%d)", col.Name, utf8.RuneCountInString(value), col.Type, col.Length)
+	}
+	return nil
+}
+
+// checkWidth rejects a new row without exactly one value per column. A short
+// row would have its LSN read back as a column value, and a long one would
+// store values no column holds.
+func (m TableMetadata) checkWidth(row []string) error {
+	if len(row) != m.rowWidth() {
+		return fmt.Errorf("wrong number of values for table %s: expected %d, got %d", m.Name, len(m.Columns), len(row)-1)
+	}
+	return nil
+}
+
+// normalizeRow rewrites the values of a new row in place to their canonical
+// forms, after checking it has one value per column
+func normalizeRow(metadata TableMetadata, row []string) error {
+	if err := metadata.checkWidth(row); err != nil {
+		return err
+	}
+	for i, col := range metadata.Schema() {
+		pos := rowPosition(i)
+		normalized, err := normalizeValue(col, row[pos])
+		if err != nil {
+			return err
+		}
+		row[pos] = normalized
+	}
+	return nil
+}
+
+// checkRowTypes checks the values of a stored row against their column types,
+// the way normalizeValue checks new values. UPDATE runs it over the merged row,
+// so a row only keeps a value that doesn't fit its column if it was written
+// before types were checked, and then only until the row is next updated.
+func checkRowTypes(metadata TableMetadata, row []string) error {
+	for i, col := range metadata.Schema() {
+		pos := rowPosition(i)
+		if pos >= len(row) {
+			break
+		}
+		value := row[pos]
+		if err := checkNumeric(col, value); err != nil {
+			return err
+		}
+		if err := checkLength(col, value); err != nil {
+			return err
+		}
+		switch {
+		case col.TypeFamily() == "bool":
+			if _, ok := NormalizeBool(value); !ok {
+				return fmt.Errorf("invalid value %q for column %s: expected bool", value, col.Name)
+			}
+		case col.IsTimeType() && value != "":
+			if _, err := ParseTime(col, value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// TypedValue converts a stored string into the JSON value for its column type:
+// numbers for int/float columns, booleans for bool columns and the decoded
+// bytes for blob columns, which encoding/json renders as base64.
+// Values that don't parse are returned unchanged so legacy rows still display.
+func TypedValue(col Column, raw string) interface{} {
+	switch col.Type {
+	case "blob":
+		if b, err := DecodeBlob(raw); err == nil {
+			return b
+		}
+	case "bool", "boolean":
+		if normalized, ok := NormalizeBool(raw); ok {
+			return normalized == "true"
+		}
+	case "int", "integer", "bigint", "serial":
+		if n, err := strconv.ParseInt(raw, 10, 64); err == nil {
+			return n
+		}
+	case "float", "double", "real":
+		if f, err := strconv.ParseFloat(raw, 64); err == nil {
+			return f
+		}
+	}
+	return raw
+}
+
+// CheckComparable rejects a WHERE condition on a blob column. Blobs are
+// stored encoded, so comparing them would silently match nothing.
+func CheckComparable(col Column) error {
+	if col.Type == "blob" {
+		return fmt.Errorf("can't compare blob column %s in WHERE", col.Name)
+	}
+	return nil
+}
+
+// DecodeBlob returns the bytes a stored blob value holds
+func DecodeBlob(raw string) ([]byte, error) {
+	b, err := base64.StdEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid blob value: %w", err)
+	}
+	return b, nil
+}
+
+// RowColumns returns the names of the fields in a stored row:
+// the id, the active_flag, then the remaining schema columns.
+func (db *Database) RowColumns(tableName string) ([]string, error) {
+	names, err := db.ColumnNames(tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	columns := make([]string, 0, len(names)+1)
+	for i, name := range names {
+		columns = append(columns, name)
+		if i == 0 {
+			columns = append(columns, ActiveFlagColumn)
+		}
+	}
+	return columns, nil
+}
+
+// TypeFamily groups the column types whose values compare alike:
+// "integer", "float", "bool", "time" or "text"
+func (c Column) TypeFamily() string {
+	switch c.Type {
+	case "bool", "boolean":
+		return "bool"
+	case "date", "timestamp":
+		return "time"
+	case "int", "integer", "bigint", "serial":
+		return "integer"
+	case "float", "double", "real":
+		return "float"
+	}
+	return "text"
+}
+
+// ColumnTypes returns the schema column for each name in columns. The
+// active_flag and _lsn pseudo-columns are accepted too.
+func (db *Database) ColumnTypes(tableName string, columns []string) ([]Column, error) {
+	db.mu.RLock()
+	metadata, exists := db.Tables[tableName]
+	db.mu.RUnlock()
+
+	if !exists {
+		return nil, TableNotExist(tableName)
+	}
+
+	types := make([]Column, len(columns))
+	for i, name := range columns {
+		switch {
+		case strings.EqualFold(name, ActiveFlagColumn):
+			types[i] = Column{Name: ActiveFlagColumn, Type: "text"}
+			continue
+		case strings.EqualFold(name, LSNColumn):
+			types[i] = Column{Name: LSNColumn, Type: "bigint"}
+			continue
+		}
+		col, _, err := findColumn(metadata, name)
+		if err != nil {
+			return nil, err
+		}
+		types[i] = col
+	}
+	return types, nil
+}
+
+// TypeRows converts rows into JSON-friendly values using the table schema.
+// columns names the field at each position; fields that aren't schema
+// columns (such as the active_flag) are left as strings.
+func (db *Database) TypeRows(tableName string, columns []string, rows [][]string) ([][]interface{}, error) {
+	db.mu.RLock()
+	metadata, exists := db.Tables[tableName]
+	db.mu.RUnlock()
+
+	if !exists {
+		return nil, TableNotExist(tableName)
+	}
+
+	// Fields that don't resolve to one schema column stay untyped
+	types := make([]*Column, len(columns))
+	for i, name := range columns {
+		if col, _, err := findColumn(metadata, name); err == nil {
+			types[i] = &col
+		}
+	}
+
+	typed := make([][]interface{}, 0, len(rows))
+	for _, row := range rows {
+		out := make([]interface{}, len(row))
+		for i, raw := range row {
+			if i < len(types) && types[i] != nil {
+				out[i] = TypedValue(*types[i], raw)
+			} else if i < len(columns) && strings.EqualFold(columns[i], LSNColumn) {
+				out[i] = TypedValue(Column{Type: "bigint"}, raw)
+			} else {
+				out[i] = raw
+			}
+		}
+		typed = append(typed, out)
+	}
+
+	return typed, nil
+}
+
+// RowObject converts a stored row into an object keyed by schema column names.
+// The active_flag is dropped and values are typed with TypedValue.
+func (db *Database) RowObject(tableName string, row []string) (map[string]interface{}, error) {
+	db.mu.RLock()
+	metadata, exists := db.Tables[tableName]
+	db.mu.RUnlock()
+
+	if !exists {
+		return nil, TableNotExist(tableName)
+	}
+
+	object := make(map[string]interface{}, len(metadata.Columns))
+	for i, col := range metadata.Schema() {
+		pos := rowPosition(i)
+		if pos >= len(row) {
+			break
+		}
+		object[col.Name] = TypedValue(col, row[pos])
+	}
+	return object, nil
+}
@@ -0,0 +1,361 @@
+package engine
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"pesapal-ledger/storage"
+)
+
+// TestCreateTableValidatesColumns checks that CREATE TABLE refuses column
+// lists that would make column resolution ambiguous or the table unusable,
+// and that a refused table is not left behind
+func TestCreateTableValidatesColumns(t *testing.T) {
+	tests := []struct {
+		name    string
+		columns []string
+		wantErr string
+	}{
+		{"duplicate name", []string{"id int", "id text"}, "duplicate column name id"},
+		{"duplicate ignoring case", []string{"id int", "ID text"}, "duplicate column name ID"},
+		{"duplicate later column", []string{"id int", "name text", "Name varchar(10)"}, "duplicate column name Name"},
+		{"no columns", nil, "at least one column"},
+		{"empty list", []string{}, "at least one column"},
+		{"empty definition", []string{"id int", ""}, "empty column definition"},
+		{"blank definition", []string{"id int", "   "}, "empty column definition"},
+		{"unique names", []string{"id int", "name text", "amount int"}, ""},
+		{"zero length", []string{"id int", "code varchar(0)"}, "invalid type varchar(0) for column code"},
+		{"negative length", []string{"id int", "code char(-1)"}, "invalid type char(-1) for column code"},
+		{"word length", []string{"id int", "code varchar(max)"}, "invalid type varchar(max) for column code"},
+		{"valid lengths", []string{"id int", "code char(3)", "name VARCHAR (255)"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			err := db.CreateTable("accounts", tt.columns)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("CreateTable: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("CreateTable: got %v, want an error containing %q", err, tt.wantErr)
+			}
+			// The name is still free for a valid definition
+			if err := db.CreateTable("accounts", []string{"id int"}); err != nil {
+				t.Fatalf("CreateTable after a rejected schema: %v", err)
+			}
+		})
+	}
+}
+
+// TestCreateTableValidatesName checks that a table name is a table or a
+// schema.table, that a name which could leave the data directory is refused,
+// and that tables of the same name in two schemas are kept apart
+func TestCreateTableValidatesName(t *testing.T) {
+	db := newTestDB(t)
+	tests := []struct {
+		name    string
+		wantErr string // "" when the name is accepted
+	}{
+		{"orders", ""},
+		{"sales.orders", ""},
+		{"archive.orders", ""},
+		// The SQL parser quotes names like these; the engine only keeps them
+		// inside the data directory
+		{"order-lines", ""},
+		{"select", ""},
+		{"bad\x00name", "unexpected character"},
+		{"a.b.c", "expected table or schema.table"},
+		{"../orders", "expected table or schema.table"},
+		{"sales/orders", "unexpected character '/'"},
+		{`sales\orders`, `unexpected character '\\'`},
+		{"sales.", "empty name"},
+		{".orders", "empty name"},
+		{"", "empty name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := db.CreateTable(tt.name, []string{"id int", "item text"})
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("CreateTable: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("CreateTable: got %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	for _, table := range []string{"orders", "sales.orders", "archive.orders"} {
+		if err := db.InsertRow(table, []string{"1", "1", table}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := storage.TableFilePath("sales.orders"), filepath.Join(storage.DataDir(), "sales", "orders.db"); got != want {
+		t.Errorf("sales.orders is stored in %s, want %s", got, want)
+	}
+	db = reopen(t, db)
+	for _, table := range []string{"orders", "sales.orders", "archive.orders"} {
+		row, err := db.FindByID(table, "1")
+		if err != nil {
+			t.Fatalf("%s after reopen: %v", table, err)
+		}
+		if row[2] != table {
+			t.Errorf("%s holds %v after reopen", table, row)
+		}
+	}
+}
+
+// TestConcurrentCreateTable races creates of one table name, and of many
+// names, with and without IF NOT EXISTS, and checks that exactly one create
+// of each name wins and that the saved metadata has every table
+func TestConcurrentCreateTable(t *testing.T) {
+	const workers = 16
+
+	tests := []struct {
+		name        string
+		table       func(worker int) string
+		ifNotExists bool
+	}{
+		{"same name", func(int) string { return "accounts" }, false},
+		{"two names", func(worker int) string { return fmt.Sprintf("accounts_%d", worker%2) }, false},
+		{"distinct names", func(worker int) string { return fmt.Sprintf("accounts_%d", worker) }, false},
+		{"same name if not exists", func(int) string { return "accounts" }, true},
+		{"two names if not exists", func(worker int) string { return fmt.Sprintf("accounts_%d", worker%2) }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+
+			errs := make([]error, workers)
+			results := make([]CreateResult, workers)
+			var wg sync.WaitGroup
+			start := make(chan struct{})
+			for i := 0; i < workers; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					<-start
+					columns := []string{"id int", "owner text"}
+					if tt.ifNotExists {
+						results[i], errs[i] = db.CreateTableIfNotExists(tt.table(i), columns, storage.FormatText)
+						return
+					}
+					errs[i] = db.CreateTable(tt.table(i), columns)
+					results[i].Created = errs[i] == nil
+				}(i)
+			}
+			close(start)
+			wg.Wait()
+
+			// With IF NOT EXISTS the others are told the table was there;
+			// without, they fail
+			created := make(map[string]int)
+			for i, err := range errs {
+				name := tt.table(i)
+				if tt.ifNotExists && err != nil {
+					t.Errorf("worker %d: %v", i, err)
+				} else if !tt.ifNotExists && err != nil {
+					if want := "table " + name + " already exists"; err.Error() != want {
+						t.Errorf("worker %d: got %v, want %q", i, err, want)
+					}
+				}
+				if results[i].Created {
+					created[name]++
+				}
+			}
+			for i := 0; i < workers; i++ {
+				if n := created[tt.table(i)]; n != 1 {
+					t.Fatalf("table %s created %d times", tt.table(i), n)
+				}
+			}
+
+			tables := db.ListTables()
+			if len(tables) != len(created) {
+				t.Fatalf("tables = %v, want %d", tables, len(created))
+			}
+			for _, name := range tables {
+				if err := db.InsertRow(name, []string{"1", "1", "alice"}); err != nil {
+					t.Fatalf("insert into %s: %v", name, err)
+				}
+			}
+
+			// Every table made it into the saved metadata, with its row
+			db = reopen(t, db)
+			if got := db.ListTables(); !reflect.DeepEqual(got, tables) {
+				t.Fatalf("after restart tables = %v, want %v", got, tables)
+			}
+			for _, name := range tables {
+				if row, err := db.FindByID(name, "1"); err != nil || row[2] != "alice" {
+					t.Errorf("%s after restart: %v, %v", name, row, err)
+				}
+			}
+		})
+	}
+}
+
+// TestBlobRoundTrip stores bytes a text record can't hold as they are in a
+// blob column and checks they come back intact, across a restart, in both
+// record formats
+func TestBlobRoundTrip(t *testing.T) {
+	values := []struct {
+		name  string
+		bytes string
+	}{
+		{"newline", "line one\nline two"},
+		{"pipe", "a|b||c"},
+		{"NUL", "\x00before\x00after\x00"},
+		{"all three", "|\n\x00\r\n|"},
+		{"high bytes", "\xff\xfe\x80\x01"},
+		{"empty", ""},
+	}
+	for _, format := range []storage.RecordFormat{storage.FormatText, storage.FormatBinary} {
+		t.Run(string(format), func(t *testing.T) {
+			db := newTestDB(t)
+			if err := db.CreateTableWithFormat("files", []string{"id int", "data blob"}, format); err != nil {
+				t.Fatal(err)
+			}
+			for i, v := range values {
+				if err := db.InsertRow("files", []string{strconv.Itoa(i + 1), "1", v.bytes}); err != nil {
+					t.Fatalf("%s: %v", v.name, err)
+				}
+			}
+			if err := db.UpdateRow("files", "1", map[string]string{"data": "updated\n|\x00"}); err != nil {
+				t.Fatal(err)
+			}
+			db = reopen(t, db)
+
+			types, err := db.ColumnTypes("files", []string{"data"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, v := range values {
+				want := v.bytes
+				if i == 0 {
+					want = "updated\n|\x00"
+				}
+				row, err := db.FindByID("files", strconv.Itoa(i+1))
+				if err != nil {
+					t.Fatalf("%s: %v", v.name, err)
+				}
+				if row[2] != base64.StdEncoding.EncodeToString([]byte(want)) {
+					t.Errorf("%s: stored %q, want it base64-encoded", v.name, row[2])
+				}
+				got, ok := TypedValue(types[0], row[2]).([]byte)
+				if !ok || string(got) != want {
+					t.Errorf("%s: TypedValue = %#v, want %q", v.name, TypedValue(types[0], row[2]), want)
+				}
+			}
+		})
+	}
+
+	db := newTestDB(t)
+	if err := db.CreateTable("keyed", []string{"hash blob", "name text", "PRIMARY KEY (hash)"}); err == nil || !strings.Contains(err.Error(), "blob column hash") {
+		t.Errorf("blob primary key: err = %v, want it refused", err)
+	}
+}
+
+// TestDescribe checks the structured schema of tables with a serial, named
+// and composite key, as it is encoded for SHOW TABLES WITH SCHEMA
+func TestDescribe(t *testing.T) {
+	tests := []struct {
+		name    string
+		columns []string
+		want    string
+	}{
+		{"t", []string{"id int", "amount int CHECK (amount != 0)"},
+			`{"table":"t","columns":[{"name":"id","type":"int","primaryKey":true},{"name":"amount","type":"int","primaryKey":false,"check":"amount != 0"}],"primaryKey":["id"]}`},
+		{"s", []string{"id serial", "note text", "CHECK (note != '')"},
+			`{"table":"s","columns":[{"name":"id","type":"serial","primaryKey":true},{"name":"note","type":"text","primaryKey":false}],"primaryKey":["id"],"checks":["note != ''"]}`},
+		{"k", []string{"name text", "number int", "PRIMARY KEY (number)"},
+			`{"table":"k","columns":[{"name":"name","type":"text","primaryKey":false},{"name":"number","type":"int","primaryKey":true}],"primaryKey":["number"]}`},
+		{"c", []string{"a int", "b text", "PRIMARY KEY (a, b)"},
+			`{"table":"c","columns":[{"name":"a","type":"int","primaryKey":true},{"name":"b","type":"text","primaryKey":true}],"primaryKey":["a","b"]}`},
+	}
+	db := newTestDB(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := db.CreateTable(tt.name, tt.columns); err != nil {
+				t.Fatal(err)
+			}
+			metadata, _ := db.Table(tt.name)
+			got, err := json.Marshal(metadata.Describe())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestColumnLength inserts and updates values at, below and above the declared
+// length of varchar(n) and char(n) columns, counted in characters
+func TestColumnLength(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.CreateTable("t", []string{"id int", "name varchar(5)", "code CHAR (2)", "note text"}); err != nil {
+		t.Fatal(err)
+	}
+	long := strings.Repeat("x", 10000)
+
+	tests := []struct {
+		name    string
+		write   func() error
+		wantErr string // "" for a write that passes
+	}{
+		{"below", func() error { return db.InsertRow("t", []string{"1", "1", "ab", "K", long}) }, ""},
+		{"at", func() error { return db.InsertRow("t", []string{"2", "1", "abcde", "KE", ""}) }, ""},
+		{"above", func() error { return db.InsertRow("t", []string{"3", "1", "abcdef", "KE", ""}) },
+			"value too long for column name: 6 characters, the limit is varchar(5)"},
+		{"char above", func() error { return db.InsertRow("t", []string{"3", "1", "a", "KEN", ""}) },
+			"value too long for column code: 3 characters, the limit is char(2)"},
+		{"characters, not bytes", func() error { return db.InsertRow("t", []string{"4", "1", "héllö", "ñ", ""}) }, ""},
+		{"empty", func() error { return db.InsertRow("t", []string{"5", "1", "", "", ""}) }, ""},
+		{"update at", func() error { return db.UpdateRow("t", "1", map[string]string{"name": "vwxyz"}) }, ""},
+		{"update above", func() error { return db.UpdateRow("t", "1", map[string]string{"name": "uvwxyz"}) },
+			"value too long for column name"},
+		{"import above", func() error { _, err := db.ImportRows("t", [][]string{{"6", "1", long, "", ""}}); return err },
+			"value too long for column name: 10000 characters"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.write()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	// Refused writes left nothing behind, and the limits hold after a restart
+	db = reopen(t, db)
+	if row, err := db.FindByID("t", "1"); err != nil || row[2] != "vwxyz" {
+		t.Errorf("row 1 = %v, %v; want the last accepted name", row, err)
+	}
+	for _, id := range []string{"3", "6"} {
+		if _, err := db.FindByID("t", id); err == nil {
+			t.Errorf("refused row %s was written", id)
+		}
+	}
+	if err := db.InsertRow("t", []string{"7", "1", "abcdef", "", ""}); err == nil {
+		t.Error("the limit was lost on restart")
+	}
+}
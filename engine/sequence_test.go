@@ -0,0 +1,81 @@
+package engine
+
+import (
+	"os"
+	"pesapal-ledger/storage"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestSerialIDsSurviveCrash simulates crashes at the points where the saved
+// counter and the table file disagree, and checks that the recovered table
+// never hands out an id it handed out before
+func TestSerialIDsSurviveCrash(t *testing.T) {
+	tests := []struct {
+		name  string
+		crash func(t *testing.T, db *Database) // runs after ids 1-3 were assigned
+		want  string                           // next id after recovery
+	}{
+		{"clean restart", func(t *testing.T, db *Database) {}, "4"},
+		{"crash after the counter was saved, before the row", func(t *testing.T, db *Database) {
+			if _, err := db.nextID("payments"); err != nil {
+				t.Fatal(err)
+			}
+		}, "5"},
+		{"counter file lost", func(t *testing.T, db *Database) {
+			if err := os.Remove(strings.TrimSuffix(storage.TableFilePath("payments"), ".db") + ".seq"); err != nil {
+				t.Fatal(err)
+			}
+		}, "4"},
+		{"counter behind the file", func(t *testing.T, db *Database) {
+			if err := storage.WriteSequence("payments", 1); err != nil {
+				t.Fatal(err)
+			}
+		}, "4"},
+		{"highest row deleted", func(t *testing.T, db *Database) {
+			if err := db.DeleteRow("payments", "3"); err != nil {
+				t.Fatal(err)
+			}
+		}, "4"},
+		{"highest row deleted and compacted away", func(t *testing.T, db *Database) {
+			if err := db.DeleteRow("payments", "3"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := db.Compact("payments"); err != nil {
+				t.Fatal(err)
+			}
+		}, "4"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			if err := db.CreateTable("payments", []string{"id serial", "merchant text"}); err != nil {
+				t.Fatal(err)
+			}
+			var assigned []string
+			for _, merchant := range []string{"acme", "globex", "initech"} {
+				row := []string{"DEFAULT", "1", merchant}
+				if err := db.InsertRow("payments", row); err != nil {
+					t.Fatal(err)
+				}
+				assigned = append(assigned, row[0])
+			}
+			if want := []string{"1", "2", "3"}; !reflect.DeepEqual(assigned, want) {
+				t.Fatalf("assigned ids %v, want %v", assigned, want)
+			}
+
+			tt.crash(t, db)
+			db = reopen(t, db)
+
+			row := []string{"DEFAULT", "1", "umbrella"}
+			if err := db.InsertRow("payments", row); err != nil {
+				t.Fatal(err)
+			}
+			if row[0] != tt.want {
+				t.Errorf("id after recovery = %s, want %s", row[0], tt.want)
+			}
+		})
+	}
+}
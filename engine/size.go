@@ -0,0 +1,34 @@
+package engine
+
+// TableSize is a table's disk usage, for deciding when to compact
+type TableSize struct {
+	Table     string `json:"table"`
+	FileBytes int64  `json:"fileBytes"` // the table file's size on disk
+	LiveBytes int64  `json:"liveBytes"` // held by the current version of each live row
+	DeadBytes int64  `json:"deadBytes"` // held by superseded versions and tombstones
+	// ReclaimablePercent is the share of the log a compaction would free
+	ReclaimablePercent float64 `json:"reclaimablePercent"`
+}
+
+// TableSize reports how big a table's file is and how much of it is live.
+// The live/dead split is the one EXPLAIN COMPACT TABLE computes, taken from
+// the stats kept up to date on every write instead of a scan of the log.
+// It counts record bytes, so for a compressed table it adds up to more than
+// FileBytes.
+func (db *Database) TableSize(tableName string) (TableSize, error) {
+	stats, err := db.Stats(tableName)
+	if err != nil {
+		return TableSize{}, err
+	}
+
+	size := TableSize{
+		Table:     tableName,
+		FileBytes: stats.FileBytes,
+		LiveBytes: stats.LiveBytes,
+		DeadBytes: stats.DeadBytes,
+	}
+	if total := size.LiveBytes + size.DeadBytes; total > 0 {
+		size.ReclaimablePercent = float64(size.DeadBytes) / float64(total) * 100
+	}
+	return size, nil
+}
@@ -0,0 +1,88 @@
+package engine
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+)
+
+// TestTableSize checks that the reported file size grows with inserts and
+// that the live/dead split follows updates and deletes, agrees with the
+// compaction estimate and is undone by a compaction
+func TestTableSize(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.CreateTable("accounts", []string{"id int", "owner text"}); err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		name     string
+		write    func() error
+		wantDead bool // some of the file is dead
+	}{
+		{"insert 1", func() error { return db.InsertRow("accounts", []string{"1", "1", "alice"}) }, false},
+		{"insert 2", func() error { return db.InsertRow("accounts", []string{"2", "1", "bob"}) }, false},
+		{"update 1", func() error { return db.UpdateRow("accounts", "1", map[string]string{"owner": "alicia"}) }, true},
+		{"update 1 again", func() error { return db.UpdateRow("accounts", "1", map[string]string{"owner": "al"}) }, true},
+		{"delete 2", func() error { return db.DeleteRow("accounts", "2") }, true},
+	}
+	var previous TableSize
+	for _, step := range steps {
+		if err := step.write(); err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		size, err := db.TableSize("accounts")
+		if err != nil {
+			t.Fatalf("%s: TableSize: %v", step.name, err)
+		}
+		if size.FileBytes <= previous.FileBytes {
+			t.Errorf("after %s: file is %d bytes, was %d", step.name, size.FileBytes, previous.FileBytes)
+		}
+		if size.LiveBytes+size.DeadBytes != size.FileBytes {
+			t.Errorf("after %s: live %d + dead %d bytes, file %d", step.name, size.LiveBytes, size.DeadBytes, size.FileBytes)
+		}
+		if size.DeadBytes < previous.DeadBytes || (size.DeadBytes > 0) != step.wantDead {
+			t.Errorf("after %s: %d dead bytes, was %d", step.name, size.DeadBytes, previous.DeadBytes)
+		}
+		want := float64(size.DeadBytes) / float64(size.FileBytes) * 100
+		if size.ReclaimablePercent != want {
+			t.Errorf("after %s: %.2f%% reclaimable, want %.2f%%", step.name, size.ReclaimablePercent, want)
+		}
+		liveBytes, deadBytes, err := db.CompactionEstimate("accounts")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if liveBytes != size.LiveBytes || deadBytes != size.DeadBytes {
+			t.Errorf("after %s: size says %d live, %d dead bytes; the estimate %d, %d", step.name, size.LiveBytes, size.DeadBytes, liveBytes, deadBytes)
+		}
+		previous = size
+	}
+
+	for i := 3; i < 10; i++ {
+		if err := db.InsertRow("accounts", []string{strconv.Itoa(i), "1", "x"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	grown, err := db.TableSize("accounts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if grown.FileBytes <= previous.FileBytes || grown.LiveBytes <= previous.LiveBytes || grown.DeadBytes != previous.DeadBytes {
+		t.Errorf("after inserts: %+v, was %+v", grown, previous)
+	}
+
+	if _, err := db.Compact("accounts"); err != nil {
+		t.Fatal(err)
+	}
+	compacted, err := db.TableSize("accounts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if compacted.DeadBytes != 0 || compacted.ReclaimablePercent != 0 || compacted.FileBytes != grown.LiveBytes {
+		t.Errorf("after compaction: %+v, want %d live bytes and nothing dead", compacted, grown.LiveBytes)
+	}
+
+	if _, err := db.TableSize("missing"); !errors.Is(err, ErrTableNotFound) {
+		t.Errorf("unknown table: err = %v, want ErrTableNotFound", err)
+	}
+}
@@ -0,0 +1,165 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"pesapal-ledger/storage"
+	"sync"
+)
+
+// ErrSnapshotStale is returned when a table read through a snapshot was
+// rewritten after the snapshot was taken, so the rows it saw are gone
+var ErrSnapshotStale = errors.New("snapshot is stale")
+
+// Snapshot is a repeatable-read view of the database: reads through it (see
+// Trace.ReadFrom) see every table as it was when the snapshot was taken,
+// ignoring rows written since. Taking one pins each table's log size; a
+// table's index is only rebuilt up to that size the first time the snapshot
+// reads it, and only if the table was written to in between. Writers are
+// never blocked by a snapshot. A table compacted, purged or altered after
+// the snapshot was taken can't be read through it any more (ErrSnapshotStale).
+type Snapshot struct {
+	db   *Database
+	pins map[string]tablePin
+
+	mu    sync.Mutex
+	views map[string]*tableView
+}
+
+// tablePin is what a snapshot remembers of a table when it is taken
+type tablePin struct {
+	metadata   TableMetadata
+	metaExists bool
+	stats      *tableStats // replaced whenever the index is rebuilt
+	size       int64       // log bytes covered by the index
+	generation int64       // see storage.TableGeneration
+}
+
+// tableView is a table's index as of a snapshot
+type tableView struct {
+	index      Index
+	ordered    *OrderedKeys
+	metadata   TableMetadata
+	metaExists bool
+}
+
+// Snapshot pins every table as it is now. It waits for a write or a
+// transaction in progress to finish, so it never sees half of one.
+func (db *Database) Snapshot() *Snapshot {
+	db.writeMu.Lock()
+	defer db.writeMu.Unlock()
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	pins := make(map[string]tablePin, len(db.Indexes))
+	for name := range db.Indexes {
+		pin := tablePin{stats: db.stats[name], generation: storage.TableGeneration(name)}
+		pin.metadata, pin.metaExists = db.Tables[name]
+		if pin.stats != nil {
+			pin.size = pin.stats.totalBytes
+		}
+		pins[name] = pin
+	}
+	return &Snapshot{db: db, pins: pins, views: make(map[string]*tableView)}
+}
+
+// view returns the table as of the snapshot, building it on first use
+func (s *Snapshot) view(tableName string) (*tableView, error) {
+	pin, ok := s.pins[tableName]
+	if !ok {
+		return nil, TableNotExist(tableName)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if storage.TableGeneration(tableName) != pin.generation {
+		return nil, staleError(tableName)
+	}
+	if v, ok := s.views[tableName]; ok {
+		return v, nil
+	}
+	v, err := s.db.pinnedView(tableName, pin)
+	if err != nil {
+		return nil, err
+	}
+	s.views[tableName] = v
+	return v, nil
+}
+
+// pinnedView builds a table's view as of pin: a copy of the live index if
+// nothing was written since, or else a scan of the log up to the pinned size
+func (db *Database) pinnedView(tableName string, pin tablePin) (*tableView, error) {
+	view := &tableView{metadata: pin.metadata, metaExists: pin.metaExists}
+
+	db.mu.RLock()
+	stats := db.stats[tableName]
+	if stats == pin.stats && (stats == nil || stats.totalBytes == pin.size) &&
+		storage.TableGeneration(tableName) == pin.generation {
+		live := db.Indexes[tableName]
+		view.index = make(Index, len(live))
+		for id, offset := range live {
+			view.index[id] = offset
+		}
+		view.ordered = &OrderedKeys{}
+		if ordered, ok := db.Ordered[tableName]; ok {
+			view.ordered.keys = ordered.Keys()
+		}
+		db.mu.RUnlock()
+		return view, nil
+	}
+	db.mu.RUnlock()
+
+	file, err := storage.OpenTableFileGeneration(tableName, pin.generation)
+	if errors.Is(err, storage.ErrTableRewritten) {
+		return nil, staleError(tableName)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	index, _, err := scanLog(tableName, io.LimitReader(file, pin.size), pin.metadata)
+	if err != nil {
+		return nil, fmt.Errorf("error scanning table file %s: %w", tableName, err)
+	}
+	view.index = index
+	view.ordered = newOrderedKeys(index)
+	return view, nil
+}
+
+func staleError(tableName string) error {
+	return fmt.Errorf("%w: table %s was compacted, purged or altered after the snapshot was taken; retry the request", ErrSnapshotStale, tableName)
+}
+
+// readTable runs fn with the index, ordered keys and metadata a read of
+// tableName sees: the live ones, under db.mu, or those of the snapshot trace
+// reads from. fn must not keep index or ordered once it returns.
+func (db *Database) readTable(tableName string, trace *Trace, fn func(index Index, ordered *OrderedKeys, metadata TableMetadata, metaExists bool)) error {
+	if err := db.checkLoadedCorrupt(tableName, trace); err != nil {
+		return err
+	}
+	if snap := trace.readsFrom(); snap != nil {
+		view, err := snap.view(tableName)
+		if err != nil {
+			return err
+		}
+		fn(view.index, view.ordered, view.metadata, view.metaExists)
+		return nil
+	}
+
+	if db.Paranoid {
+		if err := db.checkTableFile(tableName); err != nil {
+			return err
+		}
+	}
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	index, exists := db.Indexes[tableName]
+	if !exists {
+		return TableNotExist(tableName)
+	}
+	metadata, metaExists := db.Tables[tableName]
+	fn(index, db.Ordered[tableName], metadata, metaExists)
+	return nil
+}
@@ -0,0 +1,85 @@
+package engine
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestSnapshotRepeatableRead reads a table through a snapshot while rows are
+// inserted and updated outside it: the snapshot keeps returning what it
+// first saw, whether its view was built before the writes or after them
+func TestSnapshotRepeatableRead(t *testing.T) {
+	for _, readFirst := range []bool{true, false} {
+		name := "view built after the writes"
+		if readFirst {
+			name = "view built before the writes"
+		}
+		t.Run(name, func(t *testing.T) {
+			db := newTestDB(t)
+			if err := db.CreateTable("accounts", []string{"id int", "owner text"}); err != nil {
+				t.Fatal(err)
+			}
+			if err := db.InsertRow("accounts", []string{"1", "1", "alice"}); err != nil {
+				t.Fatal(err)
+			}
+
+			trace := &Trace{}
+			trace.ReadFrom(db.Snapshot())
+			if readFirst {
+				if rows, err := db.selectAll("accounts", trace); err != nil || len(rows) != 1 {
+					t.Fatalf("first read = %v, %v", rows, err)
+				}
+			}
+
+			if err := db.InsertRow("accounts", []string{"2", "1", "bob"}); err != nil {
+				t.Fatal(err)
+			}
+			if err := db.UpdateRow("accounts", "1", map[string]string{"owner": "carol"}); err != nil {
+				t.Fatal(err)
+			}
+
+			rows, err := db.selectAll("accounts", trace)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rows) != 1 || rows[0][2] != "alice" {
+				t.Errorf("snapshot read = %v, want only alice as she was", rows)
+			}
+			if live, err := db.SelectAll("accounts"); err != nil || len(live) != 2 {
+				t.Errorf("live read = %v, %v; want both rows", live, err)
+			}
+		})
+	}
+}
+
+func TestSnapshotStaleAfterCompaction(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.CreateTable("accounts", []string{"id int", "owner text"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range [][]string{{"1", "1", "alice"}, {"2", "1", "bob"}} {
+		if err := db.InsertRow("accounts", row); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	trace := &Trace{}
+	trace.ReadFrom(db.Snapshot())
+	if rows, err := db.selectAll("accounts", trace); err != nil || len(rows) != 2 {
+		t.Fatalf("read before the compaction = %v, %v", rows, err)
+	}
+
+	if err := db.DeleteRow("accounts", "2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Compact("accounts"); err != nil {
+		t.Fatal(err)
+	}
+
+	if rows, err := db.selectAll("accounts", trace); !errors.Is(err, ErrSnapshotStale) {
+		t.Errorf("read after the compaction = %v, %v; want ErrSnapshotStale", rows, err)
+	}
+	if _, err := db.FindByID("accounts", "1"); err != nil {
+		t.Errorf("live read after the compaction: %v", err)
+	}
+}
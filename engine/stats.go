@@ -0,0 +1,225 @@
+package engine
+
+import (
+	"fmt"
+	"io"
+	"pesapal-ledger/storage"
+	"strconv"
+)
+
+// TableStats summarizes a table's log for query planning
+type TableStats struct {
+	Table         string `json:"table"`
+	LiveRows      int    `json:"liveRows"`
+	TotalVersions int64  `json:"totalVersions"` // row versions and tombstones in the log
+	TotalBytes    int64  `json:"totalBytes"`
+	LiveBytes     int64  `json:"liveBytes"` // bytes held by the current version of each live row
+	DeadBytes     int64  `json:"deadBytes"` // bytes held by superseded versions and tombstones
+	FileBytes     int64  `json:"fileBytes"` // size of the table file on disk
+	// DistinctEstimates maps each indexed column to its number of distinct values.
+	// Only the primary key is indexed, so this is exact for now.
+	DistinctEstimates map[string]int `json:"distinctEstimates"`
+	// CorruptOffsets lists the entries that failed their checksum when the
+	// log was last scanned; they were left out of the index
+	CorruptOffsets []int64 `json:"corruptOffsets,omitempty"`
+}
+
+// tableStats is the state behind TableStats. It is updated on every write
+// and rebuilt whenever the log is rescanned.
+type tableStats struct {
+	versions   int64
+	totalBytes int64
+	liveBytes  int64
+	rowBytes   map[string]int64 // live id -> size of its current version
+	// maxID is the highest numeric id ever written, tombstones included.
+	// It is the auto-increment high-water mark.
+	maxID int64
+	// maxLSN is the highest LSN found when the log was scanned
+	maxLSN int64
+	// corrupt holds the offsets of the entries the scan skipped
+	corrupt []int64
+}
+
+func newTableStats() *tableStats {
+	return &tableStats{rowBytes: make(map[string]int64)}
+}
+
+// record accounts for a row version of size bytes appended for id.
+// live is false for tombstones.
+func (s *tableStats) record(id string, size int64, live bool) {
+	if n, err := strconv.ParseInt(id, 10, 64); err == nil && n > s.maxID {
+		s.maxID = n
+	}
+	s.versions++
+	s.totalBytes += size
+	s.liveBytes -= s.rowBytes[id]
+	if live {
+		s.rowBytes[id] = size
+		s.liveBytes += size
+	} else {
+		delete(s.rowBytes, id)
+	}
+}
+
+// scanLog reads a table log from the start and returns the live index and
+// stats it describes. Entries that aren't rows only count as dead bytes.
+// Rows are keyed as metadata says (see rowKey).
+func scanLog(tableName string, r io.Reader, metadata TableMetadata) (Index, *tableStats, error) {
+	index := make(Index)
+	stats := newTableStats()
+	if err := replayLog(tableName, storage.NewRecordReader(tableName, r), metadata, index, stats); err != nil {
+		return nil, nil, err
+	}
+	return index, stats, nil
+}
+
+// replayLog applies the entries of reader to index and stats, as scanLog
+// does from the start of the log. An entry that fails its checksum is left
+// out, so the key keeps its last intact version, and its offset is recorded
+// in stats.
+func replayLog(tableName string, reader *storage.RecordReader, metadata TableMetadata, index Index, stats *tableStats) error {
+	for reader.Next() {
+		rec := reader.Record()
+		parts := rec.Fields
+		if rec.Err != nil {
+			stats.totalBytes += rec.Size
+			stats.corrupt = append(stats.corrupt, rec.Offset)
+		} else if len(parts) >= 2 && (parts[1] == "1" || parts[1] == "0") {
+			id := metadata.rowKey(parts)
+			live := parts[1] == "1"
+			if live {
+				index[id] = rec.Offset
+			} else {
+				delete(index, id)
+			}
+			stats.record(id, rec.Size, live)
+			if lsn := rowLSN(parts, metadata.rowWidth()); lsn > stats.maxLSN {
+				stats.maxLSN = lsn
+			}
+		} else {
+			stats.totalBytes += rec.Size
+		}
+	}
+	if err := reader.Err(); err != nil {
+		return err
+	}
+
+	// Compaction can drop the entries holding the highest ids; the saved
+	// high-water mark keeps them from being handed out again
+	seq, err := storage.ReadSequence(tableName)
+	if err != nil {
+		return err
+	}
+	if seq > stats.maxID {
+		stats.maxID = seq
+	}
+	return nil
+}
+
+// warnCorrupt reports the entries a scan of the table's log skipped. The
+// offsets stay in the stats, so reads of the table report them too (see
+// checkLoadedCorrupt).
+func warnCorrupt(tableName string, stats *tableStats) {
+	if len(stats.corrupt) == 0 {
+		return
+	}
+	fmt.Printf("Warning: skipped %d corrupt row(s) of table %s at offsets %s; they are not indexed and the table is marked degraded\n", len(stats.corrupt), tableName, joinOffsets(stats.corrupt))
+}
+
+// corruptReason is the degraded reason of a table whose log had corrupt
+// entries when it was last scanned, or "" if it had none
+func (s *tableStats) corruptReason() string {
+	if s == nil || len(s.corrupt) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d corrupt record(s) left out of the index, at offsets %s", len(s.corrupt), joinOffsets(s.corrupt))
+}
+
+// recordWrite updates a table's stats after a row version was appended.
+// Callers must hold db.mu.
+func (db *Database) recordWrite(tableName, id string, size int64, live bool) {
+	stats, exists := db.stats[tableName]
+	if !exists {
+		stats = newTableStats()
+		db.stats[tableName] = stats
+	}
+	stats.record(id, size, live)
+}
+
+// Stats returns the current statistics of a table
+func (db *Database) Stats(tableName string) (TableStats, error) {
+	fileBytes, err := storage.TableFileSize(tableName)
+	if err != nil {
+		return TableStats{}, err
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	metadata, exists := db.Tables[tableName]
+	if !exists {
+		return TableStats{}, TableNotExist(tableName)
+	}
+
+	result := TableStats{
+		Table:             tableName,
+		LiveRows:          len(db.Indexes[tableName]),
+		FileBytes:         fileBytes,
+		DistinctEstimates: make(map[string]int),
+	}
+	if len(metadata.Columns) > 0 {
+		result.DistinctEstimates[ParseColumn(metadata.Columns[0]).Name] = result.LiveRows
+	}
+	if stats, ok := db.stats[tableName]; ok {
+		result.TotalVersions = stats.versions
+		result.TotalBytes = stats.totalBytes
+		result.LiveBytes = stats.liveBytes
+		result.DeadBytes = stats.totalBytes - stats.liveBytes
+		result.CorruptOffsets = append([]int64(nil), stats.corrupt...)
+	}
+	return result, nil
+}
+
+// CompactionEstimate scans a table's log and reports how many bytes belong to
+// the latest live versions and how many to superseded versions and tombstones,
+// i.e. what a compaction would reclaim. Nothing is rewritten.
+func (db *Database) CompactionEstimate(tableName string) (liveBytes, deadBytes int64, err error) {
+	db.mu.RLock()
+	metadata, exists := db.Tables[tableName]
+	db.mu.RUnlock()
+	if !exists {
+		return 0, 0, TableNotExist(tableName)
+	}
+
+	file, err := storage.OpenTableFile(tableName)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+
+	_, stats, err := scanLog(tableName, file, metadata)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error scanning table file %s: %w", tableName, err)
+	}
+	return stats.liveBytes, stats.totalBytes - stats.liveBytes, nil
+}
+
+// nextID hands out the next auto-increment id of a table. The high-water mark
+// is saved before the row is written, so a crash can skip an id but never
+// reuse one. Callers must hold db.writeMu.
+func (db *Database) nextID(tableName string) (string, error) {
+	db.mu.Lock()
+	stats, exists := db.stats[tableName]
+	if !exists {
+		stats = newTableStats()
+		db.stats[tableName] = stats
+	}
+	stats.maxID++
+	next := stats.maxID
+	db.mu.Unlock()
+
+	if err := storage.WriteSequence(tableName, next); err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(next, 10), nil
+}
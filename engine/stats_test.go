@@ -0,0 +1,146 @@
+package engine
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestStatsTrackWrites checks the incrementally kept stats after each kind
+// of write, and that a rescan of the log (on restart) and a compaction agree
+// with them
+func TestStatsTrackWrites(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.CreateTable("accounts", []string{"id int", "owner text"}); err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		name         string
+		write        func() error
+		liveRows     int
+		versions     int64
+		wantDeadFree bool // every byte of the log belongs to a live row
+	}{
+		{"insert", func() error { return db.InsertRow("accounts", []string{"1", "1", "alice"}) }, 1, 1, true},
+		{"second insert", func() error { return db.InsertRow("accounts", []string{"2", "1", "bob"}) }, 2, 2, true},
+		{"update", func() error { return db.UpdateRow("accounts", "1", map[string]string{"owner": "carol"}) }, 2, 3, false},
+		{"delete", func() error { return db.DeleteRow("accounts", "2") }, 1, 4, false},
+		{"reinsert", func() error { return db.InsertRow("accounts", []string{"2", "1", "dave"}) }, 2, 5, false},
+	}
+	for _, step := range steps {
+		if err := step.write(); err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		stats, err := db.Stats("accounts")
+		if err != nil {
+			t.Fatalf("%s: Stats: %v", step.name, err)
+		}
+		if stats.LiveRows != step.liveRows || stats.TotalVersions != step.versions {
+			t.Errorf("after %s: %d live rows in %d versions, want %d in %d", step.name, stats.LiveRows, stats.TotalVersions, step.liveRows, step.versions)
+		}
+		if stats.LiveBytes+stats.DeadBytes != stats.TotalBytes || stats.TotalBytes != stats.FileBytes {
+			t.Errorf("after %s: live %d + dead %d bytes, total %d, file %d", step.name, stats.LiveBytes, stats.DeadBytes, stats.TotalBytes, stats.FileBytes)
+		}
+		if (stats.DeadBytes == 0) != step.wantDeadFree {
+			t.Errorf("after %s: %d dead bytes", step.name, stats.DeadBytes)
+		}
+		if got := stats.DistinctEstimates["id"]; got != step.liveRows {
+			t.Errorf("after %s: %d distinct ids, want %d", step.name, got, step.liveRows)
+		}
+	}
+
+	before, err := db.Stats("accounts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db = reopen(t, db)
+	after, err := db.Stats("accounts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(after, before) {
+		t.Errorf("stats rebuilt on restart = %+v, want %+v", after, before)
+	}
+
+	if _, err := db.Compact("accounts"); err != nil {
+		t.Fatal(err)
+	}
+	compacted, err := db.Stats("accounts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if compacted.LiveRows != 2 || compacted.TotalVersions != 2 || compacted.DeadBytes != 0 || compacted.TotalBytes != compacted.FileBytes {
+		t.Errorf("stats after compaction = %+v, want 2 live versions and no dead bytes", compacted)
+	}
+}
+
+// TestCompactionEstimate checks the dry-run estimate against a log whose
+// live and dead entries are known, and that it matches what compaction
+// then reclaims
+func TestCompactionEstimate(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.CreateTable("accounts", []string{"id int", "owner text"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each write appends one entry; the size of the file before and after
+	// it gives the entry's size
+	writes := []struct {
+		name  string
+		write func() error
+		live  string // id whose current version the entry becomes
+		kills string // id whose previous entry stops being live
+	}{
+		{"insert 1", func() error { return db.InsertRow("accounts", []string{"1", "1", "alice"}) }, "1", ""},
+		{"insert 2", func() error { return db.InsertRow("accounts", []string{"2", "1", "bob"}) }, "2", ""},
+		{"insert 3", func() error { return db.InsertRow("accounts", []string{"3", "1", "carol"}) }, "3", ""},
+		{"update 1", func() error { return db.UpdateRow("accounts", "1", map[string]string{"owner": "alicia"}) }, "1", "1"},
+		{"delete 2", func() error { return db.DeleteRow("accounts", "2") }, "", "2"},
+	}
+	entry := make(map[string]int64) // id -> size of its live entry
+	var size, dead int64
+	for _, w := range writes {
+		if err := w.write(); err != nil {
+			t.Fatalf("%s: %v", w.name, err)
+		}
+		stats, err := db.Stats("accounts")
+		if err != nil {
+			t.Fatal(err)
+		}
+		written := stats.FileBytes - size
+		size = stats.FileBytes
+
+		if w.kills != "" {
+			dead += entry[w.kills]
+			delete(entry, w.kills)
+		}
+		if w.live != "" {
+			entry[w.live] = written
+		} else {
+			dead += written // the tombstone itself
+		}
+	}
+	var live int64
+	for _, n := range entry {
+		live += n
+	}
+
+	liveBytes, deadBytes, err := db.CompactionEstimate("accounts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if liveBytes != live || deadBytes != dead {
+		t.Fatalf("estimate = %d live, %d dead bytes; want %d live, %d dead", liveBytes, deadBytes, live, dead)
+	}
+	if stats, _ := db.Stats("accounts"); stats.FileBytes != size {
+		t.Fatalf("the estimate changed the file: %d bytes, want %d", stats.FileBytes, size)
+	}
+
+	result, err := db.Compact("accounts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.ReclaimedBytes != deadBytes || result.BytesAfter != liveBytes {
+		t.Errorf("compaction reclaimed %d bytes leaving %d, estimate said %d and %d", result.ReclaimedBytes, result.BytesAfter, deadBytes, liveBytes)
+	}
+}
@@ -0,0 +1,13 @@
+package engine
+
+import "strings"
+
+// SystemTablePrefix marks internal tables (migrations, changelogs and the
+// like). They work like any other table but are left out of table listings
+// unless asked for.
+const SystemTablePrefix = "__"
+
+// IsSystemTable reports whether a table name follows the system table convention
+func IsSystemTable(name string) bool {
+	return strings.HasPrefix(name, SystemTablePrefix)
+}
@@ -0,0 +1,81 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+)
+
+// TailRows returns the n most recently written live rows of a table, oldest
+// first. The index already points every live id at its latest version and
+// drops deleted ids, so ordering its offsets finds the newest rows without
+// reading the rest of the log. A row updated recently counts as recent.
+func (db *Database) TailRows(tableName string, n int) ([][]string, error) {
+	return db.tailRows(tableName, n, nil)
+}
+
+// tailRows is TailRows recording its reads in trace
+func (db *Database) tailRows(tableName string, n int, trace *Trace) ([][]string, error) {
+	if n < 0 {
+		return nil, fmt.Errorf("TAIL count must not be negative, got %d", n)
+	}
+
+	trace.accessPath("tail of " + tableName)
+	start := trace.Start()
+	var ids []string
+	var offsets []int64
+	var metadata TableMetadata
+	var metaExists bool
+	err := db.readTable(tableName, trace, func(index Index, _ *OrderedKeys, meta TableMetadata, ok bool) {
+		metadata, metaExists = meta, ok
+		ids = make([]string, 0, len(index))
+		for id := range index {
+			ids = append(ids, id)
+		}
+		sort.Slice(ids, func(i, j int) bool {
+			return index[ids[i]] < index[ids[j]]
+		})
+		if len(ids) > n {
+			ids = ids[len(ids)-n:]
+		}
+		offsets = make([]int64, len(ids))
+		for i, id := range ids {
+			offsets[i] = index[id]
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	trace.Stop(StageIndexLookup, start)
+
+	start = trace.Start()
+	defer trace.Stop(StageScan, start)
+	read, err := rowReader(tableName, offsets)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([][]string, 0, len(offsets))
+	for i, offset := range offsets {
+		row, err := read(offset)
+		if err != nil {
+			if db.skipCorrupt(trace, tableName, ids[i], offset, err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to read row for id %s: %w", ids[i], err)
+		}
+		trace.add(1)
+
+		// Drop the LSN and any other fields past the columns
+		if metaExists {
+			if row, err = db.fitRow(metadata, offset, row); err != nil {
+				return nil, err
+			}
+		}
+
+		if err := db.collectRow(trace); err != nil {
+			return nil, err
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
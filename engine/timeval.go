@@ -0,0 +1,55 @@
+package engine
+
+import (
+	"fmt"
+	"time"
+)
+
+// Stored forms of date and timestamp values. Timestamps are kept in UTC so
+// equal instants are stored alike whatever offset they were written with.
+const (
+	dateLayout      = "2006-01-02"
+	timestampLayout = time.RFC3339Nano
+)
+
+// timeLayouts are the input forms accepted for date and timestamp values.
+// Forms without an offset are read as UTC.
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	dateLayout,
+}
+
+// IsTimeType reports whether a column holds dates or timestamps
+func (c Column) IsTimeType() bool {
+	return c.Type == "date" || c.Type == "timestamp"
+}
+
+// ParseTime reads a value of a date or timestamp column as a time. Dates
+// drop the time of day; a timestamp given as a bare date is its midnight UTC.
+func ParseTime(col Column, value string) (time.Time, error) {
+	for _, layout := range timeLayouts {
+		t, err := time.Parse(layout, value)
+		if err != nil {
+			continue
+		}
+		if col.Type == "date" {
+			return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC), nil
+		}
+		return t.UTC(), nil
+	}
+	if col.Type == "date" {
+		return time.Time{}, fmt.Errorf("invalid date %q for column %s: expected YYYY-MM-DD", value, col.Name)
+	}
+	return time.Time{}, fmt.Errorf("invalid timestamp %q for column %s: expected ISO-8601 such as 2024-01-31T15:04:05Z", value, col.Name)
+}
+
+// formatTime writes a time in the stored form of a date or timestamp column
+func formatTime(col Column, t time.Time) string {
+	if col.Type == "date" {
+		return t.Format(dateLayout)
+	}
+	return t.Format(timestampLayout)
+}
@@ -0,0 +1,81 @@
+package engine
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestParseTime reads the accepted date and timestamp forms and checks what
+// is stored for each, and that malformed values name the column
+func TestParseTime(t *testing.T) {
+	date := Column{Name: "due", Type: "date"}
+	timestamp := Column{Name: "created", Type: "timestamp"}
+
+	tests := []struct {
+		col     Column
+		value   string
+		want    string // stored form; "" when the value is rejected
+		wantErr string
+	}{
+		{timestamp, "2024-01-31T15:04:05Z", "2024-01-31T15:04:05Z", ""},
+		{timestamp, "2024-01-31T18:04:05+03:00", "2024-01-31T15:04:05Z", ""},
+		{timestamp, "2024-01-01T02:30:00+03:00", "2023-12-31T23:30:00Z", ""},
+		{timestamp, "2024-01-31T15:04:05.25Z", "2024-01-31T15:04:05.25Z", ""},
+		{timestamp, "2024-01-31T15:04:05", "2024-01-31T15:04:05Z", ""},
+		{timestamp, "2024-01-31 15:04:05", "2024-01-31T15:04:05Z", ""},
+		{timestamp, "2024-01-31 15:04:05-01:00", "2024-01-31T16:04:05Z", ""},
+		{timestamp, "2024-02-29", "2024-02-29T00:00:00Z", ""},
+		{date, "2024-02-29", "2024-02-29", ""},
+		{date, "2024-01-31T23:59:59Z", "2024-01-31", ""},
+		{date, "2023-02-29", "", `invalid date "2023-02-29" for column due`},
+		{date, "31/01/2024", "", `invalid date "31/01/2024" for column due`},
+		{timestamp, "2024-13-01", "", `invalid timestamp "2024-13-01" for column created`},
+		{timestamp, "2024-01-31T25:00:00Z", "", `invalid timestamp "2024-01-31T25:00:00Z" for column created`},
+		{timestamp, "yesterday", "", `invalid timestamp "yesterday" for column created`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.col.Type+" "+tt.value, func(t *testing.T) {
+			got, err := normalizeValue(tt.col, tt.value)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("stored %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestCompareTimes orders times given with different offsets by the instant
+// they name
+func TestCompareTimes(t *testing.T) {
+	timestamp := Column{Name: "created", Type: "timestamp"}
+	parse := func(value string) interface{} {
+		tm, err := ParseTime(timestamp, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tm
+	}
+
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"2024-01-01T00:00:00Z", "2024-01-01T03:00:00+03:00", 0},
+		{"2023-12-31T23:59:59Z", "2024-01-01", -1},
+		{"2024-01-01T02:30:00+03:00", "2023-12-31T23:59:59Z", -1},
+		{"2024-03-01", "2024-02-29T23:59:59.999Z", 1},
+	}
+	for _, tt := range tests {
+		if got := CompareValues(parse(tt.a), parse(tt.b)); got != tt.want {
+			t.Errorf("CompareValues(%s, %s) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
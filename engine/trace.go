@@ -0,0 +1,200 @@
+package engine
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stage names a trace times
+const (
+	StageIndexLookup = "index lookup"
+	StageScan        = "scan"
+	StageFilter      = "filter"
+	StageAggregate   = "aggregate"
+	StageSort        = "sort"
+	StageProject     = "project"
+)
+
+// Trace records what one query did: how many stored rows it read, which
+// access paths it took and, for timed traces, how long each stage ran.
+// A query reading a million rows to return three is missing an index.
+// The zero value counts rows but reads no clocks; a nil *Trace records nothing.
+type Trace struct {
+	rows      atomic.Int64
+	collected atomic.Int64 // rows kept for the result (see collectRow)
+	timed     bool
+
+	mu     sync.Mutex
+	paths  []string
+	stages map[string]time.Duration
+	order  []string // stage names in first-seen order
+
+	skipped []SkippedRow // corrupt rows left out (see skipCorrupt)
+
+	snapshot *Snapshot // see ReadFrom
+}
+
+// StageTiming is the total time a query spent in one stage
+type StageTiming struct {
+	Stage    string
+	Duration time.Duration
+}
+
+// NewTimedTrace returns a trace that also measures stage timings.
+// Timing reads the clock per row, so it is meant for EXPLAIN ANALYZE only.
+func NewTimedTrace() *Trace {
+	return &Trace{timed: true, stages: make(map[string]time.Duration)}
+}
+
+func (t *Trace) add(n int) {
+	if t != nil {
+		t.rows.Add(int64(n))
+	}
+}
+
+// ReadFrom makes the reads recorded in t see the tables as of snap instead
+// of as they are now. Call it before the trace is used.
+func (t *Trace) ReadFrom(snap *Snapshot) {
+	t.snapshot = snap
+}
+
+func (t *Trace) readsFrom() *Snapshot {
+	if t == nil {
+		return nil
+	}
+	return t.snapshot
+}
+
+// collect counts one row kept in memory and returns the total so far
+func (t *Trace) collect() int64 {
+	if t == nil {
+		return 0
+	}
+	return t.collected.Add(1)
+}
+
+// Rows returns the number of stored rows read so far
+func (t *Trace) Rows() int64 {
+	if t == nil {
+		return 0
+	}
+	return t.rows.Load()
+}
+
+// accessPath records how a table was read, e.g. "full scan of t"
+func (t *Trace) accessPath(path string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	// A nested loop takes the same path once per outer row; list it once
+	if n := len(t.paths); n == 0 || t.paths[n-1] != path {
+		t.paths = append(t.paths, path)
+	}
+	t.mu.Unlock()
+}
+
+// AccessPaths returns the access paths taken, in order
+func (t *Trace) AccessPaths() []string {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]string(nil), t.paths...)
+}
+
+// Start begins timing a stage. It only reads the clock for timed traces.
+func (t *Trace) Start() time.Time {
+	if t == nil || !t.timed {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+// Stop adds the time since start to a stage
+func (t *Trace) Stop(stage string, start time.Time) {
+	if t == nil || !t.timed {
+		return
+	}
+	elapsed := time.Since(start)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, seen := t.stages[stage]; !seen {
+		t.order = append(t.order, stage)
+	}
+	t.stages[stage] += elapsed
+}
+
+// Stages returns the time spent per stage, in the order stages first ran
+func (t *Trace) Stages() []StageTiming {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	timings := make([]StageTiming, len(t.order))
+	for i, stage := range t.order {
+		timings[i] = StageTiming{Stage: stage, Duration: t.stages[stage]}
+	}
+	return timings
+}
+
+// Reader runs the reads of one query, recording them in a trace
+type Reader struct {
+	db    *Database
+	trace *Trace
+}
+
+// Reader returns a Reader whose reads are recorded in trace
+func (db *Database) Reader(trace *Trace) Reader {
+	return Reader{db: db, trace: trace}
+}
+
+// FindByID is Database.FindByID, counting the row read
+func (r Reader) FindByID(tableName, id string) ([]string, error) {
+	return r.db.findByID(tableName, id, r.trace)
+}
+
+// SelectAll is Database.SelectAll, counting every row read
+func (r Reader) SelectAll(tableName string) ([][]string, error) {
+	return r.db.selectAll(tableName, r.trace)
+}
+
+// SelectFirst is Database.SelectFirst, counting the rows read
+func (r Reader) SelectFirst(tableName string, n int) ([][]string, error) {
+	return r.db.selectFirst(tableName, n, r.trace)
+}
+
+// RangeByID is Database.RangeByID, counting the rows in the range
+func (r Reader) RangeByID(tableName, lo, hi string) ([][]string, error) {
+	return r.db.rangeByID(tableName, lo, hi, r.trace)
+}
+
+// SelectByColumn is Database.SelectByColumn, counting every row examined
+func (r Reader) SelectByColumn(tableName, colName, value string) ([][]string, error) {
+	return r.db.selectByColumn(tableName, colName, value, r.trace)
+}
+
+// SelectWhere is Database.SelectWhere, counting every row examined
+func (r Reader) SelectWhere(tableName string, preds []Predicate) ([][]string, error) {
+	return r.db.selectWhere(tableName, preds, r.trace)
+}
+
+// SelectMatching is Database.SelectMatching, counting every row examined
+func (r Reader) SelectMatching(tableName string, match func(row []string) bool) ([][]string, error) {
+	return r.db.selectMatching(tableName, match, r.trace)
+}
+
+// SelectIn is Database.SelectIn, counting every row examined
+func (r Reader) SelectIn(tableName, colName string, values []string) ([][]string, error) {
+	return r.db.selectIn(tableName, colName, values, r.trace)
+}
+
+// TailRows is Database.TailRows, counting the rows read
+func (r Reader) TailRows(tableName string, n int) ([][]string, error) {
+	return r.db.tailRows(tableName, n, r.trace)
+}
@@ -0,0 +1,183 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"pesapal-ledger/storage"
+)
+
+// ErrTxDone is returned when a transaction is used after Commit or Rollback
+var ErrTxDone = errors.New("transaction has already been committed or rolled back")
+
+// Tx is a transaction: row writes to any number of tables that become durable
+// together at Commit, or are all undone. It holds the write lock from Begin
+// until it ends, so other writers wait and see none of its writes half done.
+// Readers aren't blocked and can see its rows before Commit. Keep
+// transactions short, and always end them with Commit or Rollback.
+type Tx struct {
+	db   *Database
+	done bool
+}
+
+// Begin starts a transaction. Before the transaction first writes to a table
+// the table's file size goes into the undo journal (see storage.Journal), so
+// a crash before Commit finishes is rolled back on the next start.
+func (db *Database) Begin() (*Tx, error) {
+	if err := db.checkWritable(); err != nil {
+		return nil, err
+	}
+
+	db.writeMu.Lock()
+	journal, err := storage.BeginJournal()
+	if err != nil {
+		db.writeMu.Unlock()
+		return nil, err
+	}
+	db.txn = journal
+	return &Tx{db: db}, nil
+}
+
+// appendRow appends a stored row to a table's log. Inside a transaction the
+// table is journaled first so the row can be rolled back. Callers must hold
+// db.writeMu.
+func (db *Database) appendRow(tableName string, row []string) (int64, error) {
+	if db.txn != nil {
+		if err := db.txn.Touch(tableName); err != nil {
+			return 0, err
+		}
+	}
+	return storage.AppendRow(tableName, row)
+}
+
+// Commit syncs every table the transaction wrote to and then writes the
+// commit marker. If that fails the transaction is rolled back.
+func (tx *Tx) Commit() error {
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.done = true
+	defer tx.end()
+
+	if err := tx.db.txn.Commit(); err != nil {
+		if rbErr := tx.rollback(); rbErr != nil {
+			return fmt.Errorf("commit failed (%v) and so did the rollback: %w", err, rbErr)
+		}
+		return fmt.Errorf("commit failed, transaction rolled back: %w", err)
+	}
+	return nil
+}
+
+// Rollback undoes every write of the transaction
+func (tx *Tx) Rollback() error {
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.done = true
+	defer tx.end()
+
+	return tx.rollback()
+}
+
+// rollback cuts the touched tables back to their size before the transaction
+// and rebuilds their indexes from what is left. If a table can't be cut back
+// the journal stays, the next start finishes the rollback, and until then the
+// table is marked degraded.
+func (tx *Tx) rollback() error {
+	db := tx.db
+	tables := db.txn.Tables()
+	err := db.txn.Rollback()
+	for _, name := range tables {
+		if rebuildErr := db.RebuildIndex(name); rebuildErr != nil && err == nil {
+			err = rebuildErr
+		}
+	}
+	if err != nil {
+		db.mu.Lock()
+		for _, name := range tables {
+			db.Degraded[name] = "transaction rollback failed; restart to finish it"
+		}
+		db.mu.Unlock()
+		return fmt.Errorf("failed to roll back transaction: %w", err)
+	}
+	return nil
+}
+
+func (tx *Tx) end() {
+	tx.db.txn = nil
+	tx.db.writeMu.Unlock()
+}
+
+// InsertRow is Database.InsertRow inside the transaction
+func (tx *Tx) InsertRow(tableName string, row []string) error {
+	if tx.done {
+		return ErrTxDone
+	}
+	return tx.db.insertRow(tableName, row)
+}
+
+// UpsertRow is Database.UpsertRow inside the transaction
+func (tx *Tx) UpsertRow(tableName string, row []string, updates map[string]string) (bool, error) {
+	if tx.done {
+		return false, ErrTxDone
+	}
+	if len(row) < 2 {
+		return false, fmt.Errorf("invalid row data: too few columns")
+	}
+	return tx.db.upsertRow(tableName, row, updates)
+}
+
+// UpdateRow is Database.UpdateRow inside the transaction
+func (tx *Tx) UpdateRow(tableName string, id string, updates map[string]string) error {
+	_, err := tx.UpdateRowReturning(tableName, id, updates)
+	return err
+}
+
+// UpdateRowReturning is Database.UpdateRowReturning inside the transaction
+func (tx *Tx) UpdateRowReturning(tableName string, id string, updates map[string]string) ([]string, error) {
+	if tx.done {
+		return nil, ErrTxDone
+	}
+	return tx.db.updateRow(tableName, id, updates)
+}
+
+// DeleteRow is Database.DeleteRow inside the transaction
+func (tx *Tx) DeleteRow(tableName string, id string) error {
+	_, err := tx.DeleteRowReturning(tableName, id)
+	return err
+}
+
+// DeleteRowReturning is Database.DeleteRowReturning inside the transaction
+func (tx *Tx) DeleteRowReturning(tableName string, id string) ([]string, error) {
+	if tx.done {
+		return nil, ErrTxDone
+	}
+	return tx.db.deleteRow(tableName, id)
+}
+
+// DeleteAll is Database.DeleteAll inside the transaction
+func (tx *Tx) DeleteAll(tableName string) (int, error) {
+	return tx.db.deleteAll(tableName, tx.DeleteRowReturning, nil)
+}
+
+// DeleteAllReturning is Database.DeleteAllReturning inside the transaction
+func (tx *Tx) DeleteAllReturning(tableName string) ([][]string, error) {
+	var rows [][]string
+	_, err := tx.db.deleteAll(tableName, tx.DeleteRowReturning, func(row []string) {
+		rows = append(rows, row)
+	})
+	return rows, err
+}
+
+// UpdateAll is Database.UpdateAll inside the transaction
+func (tx *Tx) UpdateAll(tableName string, updates map[string]string) (int, error) {
+	return tx.db.updateAll(tableName, updates, tx.UpdateRowReturning, nil)
+}
+
+// UpdateAllReturning is Database.UpdateAllReturning inside the transaction
+func (tx *Tx) UpdateAllReturning(tableName string, updates map[string]string) ([][]string, error) {
+	var rows [][]string
+	_, err := tx.db.updateAll(tableName, updates, tx.UpdateRowReturning, func(row []string) {
+		rows = append(rows, row)
+	})
+	return rows, err
+}
@@ -0,0 +1,98 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"pesapal-ledger/storage"
+	"testing"
+)
+
+// TestTransferCrashRecovery abandons a debit+credit transaction at the points
+// a crash could stop it and checks that recovery applies both writes or
+// neither
+func TestTransferCrashRecovery(t *testing.T) {
+	journal := func() string { return filepath.Join(storage.DataDir(), "txn.journal") }
+	appendJournal := func(t *testing.T, text string) {
+		file, err := os.OpenFile(journal(), os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+		if _, err := file.WriteString(text); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		// credit is whether the transaction gets to its second write
+		credit bool
+		// crash edits the journal as the crash left it
+		crash       func(t *testing.T)
+		wantApplied bool
+	}{
+		{name: "crash after the debit", credit: false, wantApplied: false},
+		{name: "crash before the commit marker", credit: true, wantApplied: false},
+		{
+			name:   "torn journal entry",
+			credit: true,
+			crash: func(t *testing.T) {
+				appendJournal(t, "table cre")
+			},
+			wantApplied: false,
+		},
+		{
+			name:   "crash after the commit marker",
+			credit: true,
+			crash: func(t *testing.T) {
+				appendJournal(t, "commit\n")
+			},
+			wantApplied: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			for _, name := range []string{"debits", "credits"} {
+				if err := db.CreateTable(name, []string{"id int", "account text", "amount int"}); err != nil {
+					t.Fatal(err)
+				}
+				if err := db.InsertRow(name, []string{"1", "1", "opening", "100"}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			tx, err := db.Begin()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := tx.InsertRow("debits", []string{"2", "1", "alice", "50"}); err != nil {
+				t.Fatal(err)
+			}
+			if tt.credit {
+				if err := tx.InsertRow("credits", []string{"2", "1", "bob", "50"}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.crash != nil {
+				tt.crash(t)
+			}
+			// The process dies here: no Commit, no Rollback
+
+			db = reopen(t, db)
+			if _, err := os.Stat(journal()); !os.IsNotExist(err) {
+				t.Errorf("journal still there after recovery: %v", err)
+			}
+			for _, name := range []string{"debits", "credits"} {
+				if _, err := db.FindByID(name, "1"); err != nil {
+					t.Errorf("%s lost its committed row: %v", name, err)
+				}
+				_, err := db.FindByID(name, "2")
+				if applied := err == nil; applied != tt.wantApplied {
+					t.Errorf("%s: transfer row applied = %v, want %v", name, applied, tt.wantApplied)
+				}
+			}
+		})
+	}
+}
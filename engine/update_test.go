@@ -0,0 +1,65 @@
+package engine
+
+import (
+	"pesapal-ledger/storage"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestUpdateChecksMergedRow updates rows through the type and key checks an
+// insert gets, including a row planted with a value that predates type
+// checking, and checks that a rejected update leaves the row as it was
+func TestUpdateChecksMergedRow(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.CreateTable("t", []string{"id int", "name text", "amount int", "settled bool"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.InsertRow("t", []string{"1", "1", "alice", "10", "true"}); err != nil {
+		t.Fatal(err)
+	}
+	// Written before types were checked
+	if _, err := storage.AppendRow("t", []string{"2", "1", "bob", "lots", "true"}); err != nil {
+		t.Fatal(err)
+	}
+	db = reopen(t, db)
+
+	tests := []struct {
+		name    string
+		id      string
+		updates map[string]string
+		wantErr string   // "" for an update that passes
+		want    []string // the row afterwards
+	}{
+		{"valid value", "1", map[string]string{"amount": "7"}, "", []string{"1", "1", "alice", "7", "true"}},
+		{"int column given a word", "1", map[string]string{"amount": "x"}, "amount", []string{"1", "1", "alice", "7", "true"}},
+		{"bool column given a word", "1", map[string]string{"settled": "maybe"}, "settled", []string{"1", "1", "alice", "7", "true"}},
+		{"old malformed value left in place", "2", map[string]string{"name": "bobby"}, "amount", []string{"2", "1", "bob", "lots", "true"}},
+		{"old malformed value fixed", "2", map[string]string{"name": "bobby", "amount": "5"}, "", []string{"2", "1", "bobby", "5", "true"}},
+		{"key set to another row's", "1", map[string]string{"id": "2"}, "duplicate key 2 in table t", []string{"1", "1", "alice", "7", "true"}},
+		{"key changed", "1", map[string]string{"id": "3"}, "cannot update primary key columns (id)", []string{"1", "1", "alice", "7", "true"}},
+		{"key set to itself", "1", map[string]string{"id": "1", "name": "al"}, "", []string{"1", "1", "al", "7", "true"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := db.UpdateRow("t", tt.id, tt.updates)
+			if tt.wantErr == "" && err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("err = %v, want %q", err, tt.wantErr)
+			}
+			row, err := db.FindByID("t", tt.id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(row[:len(tt.want)], tt.want) {
+				t.Errorf("row = %v, want %v", row, tt.want)
+			}
+		})
+	}
+
+	if _, err := db.FindByID("t", "3"); err == nil {
+		t.Error("a refused key change wrote row 3")
+	}
+}
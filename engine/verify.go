@@ -0,0 +1,132 @@
+package engine
+
+import (
+	"fmt"
+	"pesapal-ledger/storage"
+	"sort"
+)
+
+// IndexMismatch is an index entry that doesn't point at its row
+type IndexMismatch struct {
+	Table  string `json:"table"`
+	Key    string `json:"key"`
+	Offset int64  `json:"offset"`
+	Reason string `json:"reason"`
+}
+
+func (m IndexMismatch) String() string {
+	return fmt.Sprintf("table %s: key %s at offset %d: %s", m.Table, displayKey(m.Key), m.Offset, m.Reason)
+}
+
+// VerifyIndex checks that every entry of a table's index points at the start
+// of an intact, live record with the entry's key, and that no later record
+// (an update or a tombstone) supersedes it. The log is read once from the
+// start, so compressed tables are checked too. Writes wait while it runs.
+func (db *Database) VerifyIndex(tableName string) ([]IndexMismatch, error) {
+	db.writeMu.Lock()
+	defer db.writeMu.Unlock()
+
+	db.mu.RLock()
+	metadata, exists := db.Tables[tableName]
+	// offset -> keys of the entries still to be matched with a record. A
+	// damaged index can have several keys on one offset.
+	pending := make(map[int64][]string, len(db.Indexes[tableName]))
+	for key, offset := range db.Indexes[tableName] {
+		pending[offset] = append(pending[offset], key)
+	}
+	db.mu.RUnlock()
+	if !exists {
+		return nil, TableNotExist(tableName)
+	}
+
+	var mismatches []IndexMismatch
+	mismatch := func(key string, offset int64, reason string) {
+		mismatches = append(mismatches, IndexMismatch{Table: tableName, Key: key, Offset: offset, Reason: reason})
+	}
+
+	if len(pending) > 0 {
+		file, err := storage.OpenTableFile(tableName)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+
+		// key -> offset of the entries that matched their record, and of the
+		// last record written for each key
+		matched := make(map[string]int64)
+		latest := make(map[string]int64)
+
+		reader := storage.NewRecordReader(tableName, file)
+		for reader.Next() {
+			rec := reader.Record()
+			if rec.Err == nil && len(rec.Fields) >= 2 {
+				latest[metadata.rowKey(rec.Fields)] = rec.Offset
+			}
+			keys, indexed := pending[rec.Offset]
+			if !indexed {
+				continue
+			}
+			delete(pending, rec.Offset)
+
+			for _, key := range keys {
+				switch {
+				case rec.Err != nil:
+					mismatch(key, rec.Offset, fmt.Sprintf("corrupt record: %v", rec.Err))
+				case len(rec.Fields) < 2 || (rec.Fields[1] != "1" && rec.Fields[1] != "0"):
+					mismatch(key, rec.Offset, "record is not a row")
+				case rec.Fields[1] != "1":
+					mismatch(key, rec.Offset, "record is a tombstone")
+				case metadata.rowKey(rec.Fields) != key:
+					mismatch(key, rec.Offset, fmt.Sprintf("record has key %s", displayKey(metadata.rowKey(rec.Fields))))
+				default:
+					matched[key] = rec.Offset
+				}
+			}
+		}
+		if err := reader.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read table file %s: %w", tableName, err)
+		}
+
+		for key, offset := range matched {
+			if last := latest[key]; last != offset {
+				mismatch(key, offset, fmt.Sprintf("record is superseded by the one at offset %d", last))
+			}
+		}
+	}
+
+	// Whatever is left points past the end or into the middle of a record
+	for offset, keys := range pending {
+		for _, key := range keys {
+			mismatch(key, offset, "no record starts at this offset")
+		}
+	}
+	sort.Slice(mismatches, func(i, j int) bool {
+		return mismatches[i].Offset < mismatches[j].Offset ||
+			(mismatches[i].Offset == mismatches[j].Offset && mismatches[i].Key < mismatches[j].Key)
+	})
+	return mismatches, nil
+}
+
+// VerifyIndexes runs VerifyIndex on every table and marks the tables whose
+// index doesn't match their file degraded. It returns every mismatch found.
+func (db *Database) VerifyIndexes() []IndexMismatch {
+	var all []IndexMismatch
+	for _, name := range db.AllTables() {
+		mismatches, err := db.VerifyIndex(name)
+		if err != nil {
+			fmt.Printf("Warning: Failed to verify index of table %s: %v\n", name, err)
+			continue
+		}
+		if len(mismatches) == 0 {
+			continue
+		}
+		for _, m := range mismatches {
+			fmt.Printf("Warning: index mismatch: %s\n", m)
+		}
+		db.mu.Lock()
+		db.Degraded[name] = fmt.Sprintf("index does not match data file (%d mismatched entries)", len(mismatches))
+		db.mu.Unlock()
+		all = append(all, mismatches...)
+	}
+	return all
+}
@@ -0,0 +1,129 @@
+package engine
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// TestVerifyIndexDetectsCorruption damages a recovered index in different
+// ways and checks that verification names each bad entry
+func TestVerifyIndexDetectsCorruption(t *testing.T) {
+	tests := []struct {
+		name    string
+		corrupt func(index Index, offsets map[string]int64)
+		key     string // the entry reported
+		reason  string
+	}{
+		{
+			name:    "offset of another row",
+			corrupt: func(index Index, offsets map[string]int64) { index["1"] = offsets["2"] },
+			key:     "1",
+			reason:  "record has key 2",
+		},
+		{
+			name:    "offset inside a record",
+			corrupt: func(index Index, offsets map[string]int64) { index["2"] = offsets["2"] + 3 },
+			key:     "2",
+			reason:  "no record starts at this offset",
+		},
+		{
+			name:    "offset past the end",
+			corrupt: func(index Index, offsets map[string]int64) { index["3"] = 1 << 20 },
+			key:     "3",
+			reason:  "no record starts at this offset",
+		},
+		{
+			name:    "offset of a tombstone",
+			corrupt: func(index Index, offsets map[string]int64) { index["4"] = offsets["tombstone"] },
+			key:     "4",
+			reason:  "record is a tombstone",
+		},
+		{
+			name:    "deleted row still indexed",
+			corrupt: func(index Index, offsets map[string]int64) { index["4"] = offsets["4"] },
+			key:     "4",
+			reason:  "record is superseded by the one at offset",
+		},
+		{
+			name:    "old version of an updated row",
+			corrupt: func(index Index, offsets map[string]int64) { index["3"] = offsets["3"] },
+			key:     "3",
+			reason:  "record is superseded by the one at offset",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			if err := db.CreateTable("accounts", []string{"id int", "owner text"}); err != nil {
+				t.Fatal(err)
+			}
+			for _, row := range [][]string{{"1", "1", "alice"}, {"2", "1", "bob"}, {"3", "1", "carol"}, {"4", "1", "dave"}} {
+				if err := db.InsertRow("accounts", row); err != nil {
+					t.Fatal(err)
+				}
+			}
+			offsets := make(map[string]int64)
+			for key, offset := range db.Indexes["accounts"] {
+				offsets[key] = offset
+			}
+			if err := db.UpdateRow("accounts", "3", map[string]string{"owner": "carla"}); err != nil {
+				t.Fatal(err)
+			}
+			if err := db.DeleteRow("accounts", "4"); err != nil {
+				t.Fatal(err)
+			}
+			for _, rec := range readRecords(t, "accounts") {
+				if rec.Fields[1] == "0" {
+					offsets["tombstone"] = rec.Offset
+				}
+			}
+
+			if mismatches := db.VerifyIndexes(); len(mismatches) != 0 {
+				t.Fatalf("intact index reported %v", mismatches)
+			}
+
+			tt.corrupt(db.Indexes["accounts"], offsets)
+			mismatches := db.VerifyIndexes()
+			if len(mismatches) != 1 {
+				t.Fatalf("got %v, want one mismatch", mismatches)
+			}
+			if m := mismatches[0]; m.Table != "accounts" || m.Key != tt.key || !strings.Contains(m.Reason, tt.reason) {
+				t.Errorf("got %+v, want key %s: %s", m, tt.key, tt.reason)
+			}
+
+			// The table is degraded: reads work, writes are refused
+			if _, degraded := db.Degraded["accounts"]; !degraded {
+				t.Error("table not marked degraded")
+			}
+			if err := db.InsertRow("accounts", []string{"5", "1", "erin"}); !errors.Is(err, ErrTableDegraded) {
+				t.Errorf("insert into the degraded table: %v", err)
+			}
+		})
+	}
+}
+
+// TestVerifyIndexCorruptRecord damages the row an index entry points at
+func TestVerifyIndexCorruptRecord(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.CreateTable("accounts", []string{"id int", "owner text"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range [][]string{{"1", "1", "alice"}, {"2", "1", "bob"}} {
+		if err := db.InsertRow("accounts", row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	damage(t, "accounts", "bob")
+
+	mismatches, err := db.VerifyIndex("accounts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mismatches) != 1 || mismatches[0].Key != "2" || !strings.HasPrefix(mismatches[0].Reason, "corrupt record") {
+		t.Errorf("got %v, want the row with key 2 reported corrupt", mismatches)
+	}
+	if _, err := db.VerifyIndex("missing"); err == nil {
+		t.Error("VerifyIndex of a missing table: expected an error")
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// idempotencyHeader lets a client retry a write without applying it twice:
+// a repeat of a request with the same key gets the first response back
+const idempotencyHeader = "Idempotency-Key"
+
+// replayedHeader marks a response that was replayed from the cache
+const replayedHeader = "Idempotent-Replayed"
+
+// maxIdempotencyKeyLength bounds client-supplied keys, which are held in memory
+const maxIdempotencyKeyLength = 255
+
+const (
+	// defaultIdempotencyTTL is how long a key's response is kept for replay
+	defaultIdempotencyTTL = 24 * time.Hour
+	// defaultIdempotencyEntries caps the number of keys kept; the oldest go first
+	defaultIdempotencyEntries = 10000
+)
+
+// idempotentResponse is the outcome of the first request made with a key
+type idempotentResponse struct {
+	key         string
+	fingerprint [sha256.Size]byte // method, URL and body of the request
+	expires     time.Time
+	done        chan struct{} // closed once the response below is recorded
+
+	status      int
+	contentType string
+	body        []byte
+}
+
+// idempotencyCache remembers the responses of keyed requests for a while, so
+// retries of a write (a client that timed out on an INSERT, say) replay the
+// original result instead of posting the row again. It holds at most max
+// keys; when full, the oldest key is forgotten first.
+type idempotencyCache struct {
+	ttl time.Duration
+	max int
+
+	mu      sync.Mutex
+	entries map[string]*idempotentResponse
+	order   []*idempotentResponse // oldest first, for expiry and eviction
+}
+
+func newIdempotencyCache(ttl time.Duration, max int) *idempotencyCache {
+	return &idempotencyCache{
+		ttl:     ttl,
+		max:     max,
+		entries: make(map[string]*idempotentResponse),
+	}
+}
+
+// claim returns the entry for key. owner is true when the caller made the
+// entry and must run the request and record its response; otherwise the
+// entry belongs to an earlier request, which may still be running.
+func (c *idempotencyCache) claim(key string, fingerprint [sha256.Size]byte) (entry *idempotentResponse, owner bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if entry, ok := c.entries[key]; ok && now.Before(entry.expires) {
+		return entry, false
+	}
+	c.prune(now)
+
+	entry = &idempotentResponse{
+		key:         key,
+		fingerprint: fingerprint,
+		expires:     now.Add(c.ttl),
+		done:        make(chan struct{}),
+	}
+	c.entries[key] = entry
+	c.order = append(c.order, entry)
+	return entry, true
+}
+
+// prune drops expired entries, and the oldest ones while the cache is full.
+// Callers hold c.mu.
+func (c *idempotencyCache) prune(now time.Time) {
+	for len(c.order) > 0 {
+		oldest := c.order[0]
+		current := c.entries[oldest.key] == oldest
+		if current && now.Before(oldest.expires) && len(c.entries) < c.max {
+			return
+		}
+		if current {
+			delete(c.entries, oldest.key)
+		}
+		c.order = c.order[1:]
+	}
+}
+
+// finish records the response of the request that owns entry. Server errors
+// aren't kept: the write most likely didn't happen, so a retry should run.
+func (c *idempotencyCache) finish(entry *idempotentResponse, status int, contentType string, body []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry.status, entry.contentType, entry.body = status, contentType, body
+	if status >= http.StatusInternalServerError && c.entries[entry.key] == entry {
+		delete(c.entries, entry.key)
+	}
+	close(entry.done)
+}
+
+// run serves the request that owns entry and records its response. A
+// handler that panics counts as a server error, so retries waiting on the
+// entry run the request themselves rather than hang.
+func (c *idempotencyCache) run(entry *idempotentResponse, next http.HandlerFunc, w http.ResponseWriter, r *http.Request) {
+	rec := &responseCapture{ResponseWriter: w}
+	completed := false
+	defer func() {
+		status := rec.status
+		if !completed {
+			status = http.StatusInternalServerError
+		} else if status == 0 {
+			status = http.StatusOK
+		}
+		c.finish(entry, status, w.Header().Get("Content-Type"), rec.body.Bytes())
+	}()
+	next(rec, r)
+	completed = true
+}
+
+// responseCapture passes a response through while keeping a copy of it
+type responseCapture struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *responseCapture) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseCapture) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
+
+// wrap makes the write requests served by next idempotent when they carry an
+// Idempotency-Key header. The first request with a key runs; a repeat of it
+// (same method, URL and body) within the TTL waits for it if need be and gets
+// the same status and body, marked with Idempotent-Replayed. Reusing a key for
+// a different request is refused with 422. Requests without a key, and GETs,
+// pass straight through.
+func (c *idempotencyCache) wrap(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(idempotencyHeader)
+		if key == "" || r.Method == http.MethodGet || r.Method == http.MethodHead {
+			next(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			writeJSON(w, http.StatusBadRequest, SQLResponse{Success: false, Error: "Idempotency-Key is too long"})
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, SQLResponse{Success: false, Error: "Invalid request body: " + err.Error()})
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		fingerprint := sha256.Sum256([]byte(r.Method + " " + r.URL.RequestURI() + "\n" + string(body)))
+
+		for {
+			entry, owner := c.claim(key, fingerprint)
+			if owner {
+				c.run(entry, next, w, r)
+				return
+			}
+			if entry.fingerprint != fingerprint {
+				writeJSON(w, http.StatusUnprocessableEntity, SQLResponse{
+					Success: false,
+					Error:   "Idempotency-Key was already used for a different request",
+				})
+				return
+			}
+
+			select {
+			case <-entry.done:
+			case <-r.Context().Done():
+				return
+			}
+			// The first attempt failed on the server side and wasn't kept;
+			// run this one in its place
+			if entry.status >= http.StatusInternalServerError {
+				continue
+			}
+			if entry.contentType != "" {
+				w.Header().Set("Content-Type", entry.contentType)
+			}
+			w.Header().Set(replayedHeader, "true")
+			w.WriteHeader(entry.status)
+			w.Write(entry.body)
+			return
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serveKeyed sends one request through the handler with an Idempotency-Key
+// header, unless key is empty
+func serveKeyed(t *testing.T, handler http.HandlerFunc, key, method, target, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if key != "" {
+		req.Header.Set(idempotencyHeader, key)
+	}
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
+
+func TestIdempotencyKey(t *testing.T) {
+	insert := func(id string) string { return `{"query": "INSERT INTO t VALUES (` + id + `, 500)"}` }
+	type step struct {
+		key          string
+		method       string
+		target       string
+		body         string
+		wantStatus   int
+		wantReplayed bool
+	}
+	tests := []struct {
+		name     string
+		steps    []step
+		wantRows int
+	}{
+		{"retry replays the insert", []step{
+			{"k1", http.MethodPost, "/sql", insert("1"), http.StatusOK, false},
+			{"k1", http.MethodPost, "/sql", insert("1"), http.StatusOK, true},
+			{"k1", http.MethodPost, "/sql", insert("1"), http.StatusOK, true},
+		}, 1},
+		{"retry replays a REST insert", []step{
+			{"k1", http.MethodPost, "/tables/t/rows", `{"id": 1, "amount": 500}`, http.StatusCreated, false},
+			{"k1", http.MethodPost, "/tables/t/rows", `{"id": 1, "amount": 500}`, http.StatusCreated, true},
+		}, 1},
+		{"retry replays a client error", []step{
+			{"k1", http.MethodPost, "/sql", `{"query": "INSERT INTO nope VALUES (1)"}`, http.StatusNotFound, false},
+			{"k1", http.MethodPost, "/sql", `{"query": "INSERT INTO nope VALUES (1)"}`, http.StatusNotFound, true},
+		}, 0},
+		{"other keys run", []step{
+			{"k1", http.MethodPost, "/sql", insert("1"), http.StatusOK, false},
+			{"k2", http.MethodPost, "/sql", insert("2"), http.StatusOK, false},
+		}, 2},
+		{"a key reused for another request is refused", []step{
+			{"k1", http.MethodPost, "/sql", insert("1"), http.StatusOK, false},
+			{"k1", http.MethodPost, "/sql", insert("2"), http.StatusUnprocessableEntity, false},
+			{"k1", http.MethodPost, "/tables/t/rows", `{"id": 3, "amount": 500}`, http.StatusUnprocessableEntity, false},
+		}, 1},
+		{"no key runs every time", []step{
+			{"", http.MethodPost, "/sql", insert("1"), http.StatusOK, false},
+			{"", http.MethodPost, "/sql", insert("1"), http.StatusConflict, false},
+		}, 1},
+		{"a key too long is refused", []step{
+			{strings.Repeat("k", maxIdempotencyKeyLength+1), http.MethodPost, "/sql", insert("1"), http.StatusBadRequest, false},
+		}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, "CREATE TABLE t (id int, amount int)")
+			handlers := map[string]http.HandlerFunc{
+				"/sql":           s.idempotency.wrap(s.handleSQL),
+				"/tables/t/rows": s.idempotency.wrap(s.handleTableRows),
+			}
+			var first *httptest.ResponseRecorder
+			for i, st := range tt.steps {
+				rec := serveKeyed(t, handlers[st.target], st.key, st.method, st.target, st.body)
+				if rec.Code != st.wantStatus {
+					t.Fatalf("step %d: status %d (%s), want %d", i, rec.Code, rec.Body.String(), st.wantStatus)
+				}
+				if replayed := rec.Header().Get(replayedHeader) == "true"; replayed != st.wantReplayed {
+					t.Errorf("step %d: replayed = %v, want %v", i, replayed, st.wantReplayed)
+				}
+				if i == 0 {
+					first = rec
+				} else if st.wantReplayed {
+					if rec.Body.String() != first.Body.String() {
+						t.Errorf("step %d: body %q, want the first response %q", i, rec.Body.String(), first.Body.String())
+					}
+					if rec.Header().Get("Content-Type") != first.Header().Get("Content-Type") {
+						t.Errorf("step %d: Content-Type %q, want %q", i, rec.Header().Get("Content-Type"), first.Header().Get("Content-Type"))
+					}
+				}
+			}
+			rows, err := s.db.SelectAll("t")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rows) != tt.wantRows {
+				t.Errorf("table holds %d rows, want %d", len(rows), tt.wantRows)
+			}
+		})
+	}
+}
+
+func TestIdempotencyCacheLimits(t *testing.T) {
+	calls := 0
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		writeJSON(w, http.StatusOK, SQLResponse{Success: true})
+	}
+	failing := func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		writeJSON(w, http.StatusInternalServerError, SQLResponse{Success: false, Error: "disk full"})
+	}
+
+	tests := []struct {
+		name      string
+		ttl       time.Duration
+		max       int
+		handler   http.HandlerFunc
+		keys      []string
+		wantCalls int
+	}{
+		{"repeats are replayed", time.Hour, 10, handler, []string{"a", "a", "b", "b"}, 2},
+		{"oldest key is evicted when full", time.Hour, 1, handler, []string{"a", "b", "a"}, 3},
+		{"expired keys run again", time.Nanosecond, 10, handler, []string{"a", "a"}, 2},
+		{"server errors aren't kept", time.Hour, 10, failing, []string{"a", "a"}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls = 0
+			wrapped := newIdempotencyCache(tt.ttl, tt.max).wrap(tt.handler)
+			for _, key := range tt.keys {
+				if tt.ttl < time.Millisecond {
+					time.Sleep(time.Millisecond)
+				}
+				serveKeyed(t, wrapped, key, http.MethodPost, "/sql", `{"query": "INSERT INTO t VALUES (1)"}`)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("handler ran %d times, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
@@ -2,16 +2,33 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io/fs"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
 	"pesapal-ledger/engine"
 	"pesapal-ledger/parser"
+	"pesapal-ledger/storage"
+	"strconv"
+	"syscall"
+	"time"
 )
 
 // Server holds dependencies for the HTTP handlers
 type Server struct {
 	db *engine.Database
+	// adminToken guards the /admin routes; empty disables them
+	adminToken string
+	// counters count the /sql requests for GET /admin/stats
+	counters *queryCounters
+	// authorize vets every statement before it runs; nil allows all
+	authorize parser.Authorizer
+	// idempotency replays the responses of retried keyed writes
+	idempotency *idempotencyCache
 }
 
 // SQLRequest represents the expected JSON request body
@@ -24,12 +41,34 @@ type SQLResponse struct {
 	Success bool        `json:"success"`
 	Data    interface{} `json:"data,omitempty"`
 	Error   string      `json:"error,omitempty"`
+	// Stats reports rows scanned vs returned for SELECT statements
+	Stats *parser.QueryStats `json:"stats,omitempty"`
+	// Warning flags a successful but incomplete result
+	Warning string `json:"warning,omitempty"`
 }
 
 // handleIndex serves the main web interface
 func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
-	// Serve the static HTML file
-	http.ServeFile(w, r, "web/index.html")
+	serveIndex(w, r)
+}
+
+// responseEncoder returns the JSON encoder for a response. "?pretty=1" (or
+// "?pretty=true") indents the output for people reading it with curl;
+// programmatic clients get compact JSON by default.
+func responseEncoder(w http.ResponseWriter, r *http.Request) *json.Encoder {
+	encoder := json.NewEncoder(w)
+	if pretty, err := strconv.ParseBool(r.URL.Query().Get("pretty")); err == nil && pretty {
+		encoder.SetIndent("", "  ")
+	}
+	return encoder
+}
+
+// writeResponse is writeJSON for the SQL endpoints, which honor "?pretty"
+// (see responseEncoder) on errors as well as results
+func writeResponse(w http.ResponseWriter, r *http.Request, status int, resp SQLResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	responseEncoder(w, r).Encode(resp)
 }
 
 // handleSQL processes the SQL query requests
@@ -41,87 +80,369 @@ func (s *Server) handleSQL(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req SQLRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	if err := decodeStrict(r.Body, &req); err != nil {
+		s.counters.record("", true)
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(SQLResponse{
+		responseEncoder(w, r).Encode(SQLResponse{
 			Success: false,
-			Error:   "Invalid request body",
+			Error:   "Invalid request body: " + err.Error(),
 		})
 		return
 	}
 
 	if req.Query == "" {
+		s.counters.record("", true)
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(SQLResponse{
+		responseEncoder(w, r).Encode(SQLResponse{
 			Success: false,
 			Error:   "Query cannot be empty",
 		})
 		return
 	}
 
+	if err := parser.Authorize(r.Context(), req.Query, s.db, s.authorize); err != nil {
+		s.counters.record(req.Query, true)
+		requestLogger(r).Warn("query denied", "query", req.Query, "error", err)
+		writeAuthorizeError(w, err)
+		return
+	}
+
 	// Process the query using the real parser
-	result, err := parser.ParseSQL(req.Query, s.db)
-	
+	result, stats, err := parser.ExecuteWithStats(s.db, req.Query)
+	s.counters.record(req.Query, err != nil)
+	if err != nil {
+		requestLogger(r).Warn("query failed", "query", req.Query, "error", err)
+	}
+
+	if err != nil && writeMaintenanceError(w, err) {
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	if err != nil {
-		// Distinguish between client errors (syntax) and server errors?
-		// For now, 400 for errors like "invalid syntax" could be better, 
-		// but generic 500 or 400 is fine for MVP.
-		// Let's use 400 Bad Request if it's a parsing error, but parser returns generic error.
-		// We'll stick to 200 with success=false or 500. 
-		// The previous implementation used 500. Let's use 500 for now.
-		w.WriteHeader(http.StatusOK) // Or 500? Client expects JSON. 
-		// Actually, returning 200 with Success: false is often easier for clients to parse JSON error.
-		// But let's follow the previous pattern: WriteHeader then Encode.
-		// If I write 500, I can still write JSON body.
-		w.WriteHeader(http.StatusBadRequest) // Assume most errors are bad queries
-		json.NewEncoder(w).Encode(SQLResponse{
+		w.WriteHeader(sqlErrorStatus(err))
+		responseEncoder(w, r).Encode(SQLResponse{
 			Success: false,
 			Error:   err.Error(),
 		})
 		return
 	}
 
+	// "?format=columnar" transposes SELECT rows into one array per column
+	if r.URL.Query().Get("format") == "columnar" {
+		if rows, ok := result.([][]interface{}); ok {
+			columnar, err := parser.Columnar(s.db, req.Query, rows)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				responseEncoder(w, r).Encode(SQLResponse{
+					Success: false,
+					Error:   err.Error(),
+				})
+				return
+			}
+			result = columnar
+		}
+	}
+
 	// Return success response
+	resp := SQLResponse{
+		Success: true,
+		Data:    result,
+		Stats:   stats,
+	}
+	if stats != nil && len(stats.SkippedRows) > 0 {
+		resp.Warning = fmt.Sprintf("%d corrupt rows were skipped; the results are partial (see stats.skippedRows)", len(stats.SkippedRows))
+	}
+	w.WriteHeader(http.StatusOK)
+	responseEncoder(w, r).Encode(resp)
+}
+
+// handleTables lists every table along with its health status
+func (s *Server) handleTables(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(SQLResponse{
 		Success: true,
-		Data:    result,
+		Data:    s.db.TableInfos(),
 	})
 }
 
+// configureDataDir points storage at dir, or at LITELEDGER_DATA_DIR when dir
+// is empty. Neither set keeps the default "data" in the working directory.
+func configureDataDir(dir string) error {
+	if dir == "" {
+		dir = os.Getenv("LITELEDGER_DATA_DIR")
+	}
+	if dir == "" {
+		return nil
+	}
+	return storage.SetDataDir(dir)
+}
+
+// configureSync sets the storage durability policy from the environment:
+//
+//	LITELEDGER_SYNC          always (default) | group | none
+//	LITELEDGER_SYNC_INTERVAL group commit interval, e.g. 10ms (default 10ms)
+//	LITELEDGER_SYNC_BATCH    group commit early after this many writes (default 1000)
+//	LITELEDGER_SYNC_WAIT     "true" to make inserts wait for their group sync
+func configureSync() error {
+	policy := storage.SyncPolicy{Mode: storage.SyncEveryWrite}
+
+	switch mode := os.Getenv("LITELEDGER_SYNC"); mode {
+	case "", "always":
+	case "none":
+		policy.Mode = storage.SyncNone
+	case "group":
+		policy.Mode = storage.SyncGroup
+		policy.Interval = 10 * time.Millisecond
+		if v := os.Getenv("LITELEDGER_SYNC_INTERVAL"); v != "" {
+			interval, err := time.ParseDuration(v)
+			if err != nil {
+				return fmt.Errorf("invalid LITELEDGER_SYNC_INTERVAL %q: %w", v, err)
+			}
+			policy.Interval = interval
+		}
+		if v := os.Getenv("LITELEDGER_SYNC_BATCH"); v != "" {
+			batch, err := strconv.Atoi(v)
+			if err != nil {
+				return fmt.Errorf("invalid LITELEDGER_SYNC_BATCH %q: %w", v, err)
+			}
+			policy.MaxPending = batch
+		}
+		policy.WaitForSync = os.Getenv("LITELEDGER_SYNC_WAIT") == "true"
+	default:
+		return fmt.Errorf("unknown LITELEDGER_SYNC mode %q", mode)
+	}
+
+	return storage.SetSyncPolicy(policy)
+}
+
+// configureRetry sets how transient storage errors (EAGAIN, EINTR, EBUSY,
+// ETIMEDOUT) are retried from the environment:
+//
+//	LITELEDGER_RETRY_ATTEMPTS    tries in all, 1 to disable retries (default 3)
+//	LITELEDGER_RETRY_BACKOFF     wait before the first retry, doubled after each (default 10ms)
+//	LITELEDGER_RETRY_MAX_BACKOFF cap on the wait (default 1s)
+func configureRetry() error {
+	policy := storage.DefaultRetryPolicy
+	if v := os.Getenv("LITELEDGER_RETRY_ATTEMPTS"); v != "" {
+		attempts, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid LITELEDGER_RETRY_ATTEMPTS %q: %w", v, err)
+		}
+		policy.Attempts = attempts
+	}
+	for _, setting := range []struct {
+		env    string
+		target *time.Duration
+	}{
+		{"LITELEDGER_RETRY_BACKOFF", &policy.Backoff},
+		{"LITELEDGER_RETRY_MAX_BACKOFF", &policy.MaxBackoff},
+	} {
+		if v := os.Getenv(setting.env); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return fmt.Errorf("invalid %s %q: %w", setting.env, v, err)
+			}
+			*setting.target = d
+		}
+	}
+	return storage.SetRetryPolicy(policy)
+}
+
+// configureLimits sets the schema and result caps from the environment:
+//
+//	LITELEDGER_MAX_TABLES      maximum number of tables (default 1000, 0 = unlimited)
+//	LITELEDGER_MAX_COLUMNS     maximum columns per table (default 256, 0 = unlimited)
+//	LITELEDGER_MAX_RESULT_ROWS maximum rows a SELECT may collect (default 100000, 0 = unlimited)
+func configureLimits(db *engine.Database) error {
+	for _, setting := range []struct {
+		env    string
+		target *int
+	}{
+		{"LITELEDGER_MAX_TABLES", &db.Limits.MaxTables},
+		{"LITELEDGER_MAX_COLUMNS", &db.Limits.MaxColumns},
+		{"LITELEDGER_MAX_RESULT_ROWS", &db.Limits.MaxResultRows},
+	} {
+		v := os.Getenv(setting.env)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid %s %q: expected a non-negative integer", setting.env, v)
+		}
+		*setting.target = n
+	}
+	return nil
+}
+
 func main() {
-	fmt.Println("Starting LiteLedger...")
+	// "repl" runs the SQL typed on stdin instead of serving HTTP
+	if len(os.Args) > 1 && os.Args[1] == "repl" {
+		runREPL(os.Args[2:])
+		return
+	}
 
-	// Initialize the database engine
-	db := engine.NewDatabase()
-	
-	// Recover database state from disk
-	if err := db.Recover(); err != nil {
-		// Log error but continue (start fresh if recovery fails completely)
-		fmt.Printf("Warning: Database recovery issues: %v\n", err)
-	} else {
-		fmt.Println("Database recovered successfully.")
+	// --verify-on-start checks every index entry against the table file after
+	// recovery. Off by default: it reads every table log in full.
+	verifyOnStart := flag.Bool("verify-on-start", false, "check that every index entry points at its row after recovery")
+	// --shutdown-timeout (or LITELEDGER_SHUTDOWN_TIMEOUT) bounds how long a
+	// shutdown waits for in-flight requests, e.g. a long bulk import
+	shutdownFlag := flag.String("shutdown-timeout", "", "how long shutdown waits for in-flight requests (default 30s)")
+	flag.Parse()
+
+	drainTimeout, err := shutdownTimeout(*shutdownFlag)
+	if err != nil {
+		log.Fatalf("Invalid shutdown configuration: %v", err)
 	}
-	
+
+	fmt.Println("Starting LiteLedger...")
+	db := openDatabase(*verifyOnStart, "")
+
 	// Create server instance
 	server := &Server{
-		db: db,
+		db:          db,
+		adminToken:  os.Getenv("LITELEDGER_ADMIN_TOKEN"),
+		counters:    newQueryCounters(),
+		idempotency: newIdempotencyCache(defaultIdempotencyTTL, defaultIdempotencyEntries),
 	}
 
-	
 	fmt.Println("LiteLedger Engine Initialized.")
-	
+
 	// Setup HTTP routes
 	http.HandleFunc("/", server.handleIndex)
-	http.HandleFunc("/sql", server.handleSQL)
-	
+	http.HandleFunc("/sql", withRequestID(server.idempotency.wrap(server.handleSQL)))
+	http.HandleFunc("/sql/batch", withRequestID(server.idempotency.wrap(server.handleSQLBatch)))
+	http.HandleFunc("/tables", server.handleTables)
+	http.HandleFunc("/tables/", server.idempotency.wrap(server.handleTableRows))
+	http.HandleFunc("/admin/maintenance", server.handleMaintenance)
+	http.HandleFunc("/admin/stats", server.handleServerStats)
+	http.HandleFunc("/admin/stats/reset", server.handleServerStatsReset)
+	http.HandleFunc("/admin/stats/tables", server.handleTableStats)
+	http.HandleFunc("/admin/reindex", server.handleReindex)
+	http.HandleFunc("/admin/backup/table/", server.handleBackupTable)
+	http.HandleFunc("/admin/restore/table/", server.handleRestoreTable)
+
 	// Start HTTP server
 	port := ":8080"
+	drain := &drainer{}
+	httpServer := &http.Server{Addr: port, Handler: drain.wrap(http.DefaultServeMux)}
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- httpServer.ListenAndServe()
+	}()
 	fmt.Printf("Starting HTTP server on %s\n", port)
-	if err := http.ListenAndServe(port, nil); err != nil {
+
+	// On SIGINT/SIGTERM, answer new requests with 503 and give the running
+	// ones drainTimeout to finish before closing the server
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	select {
+	case err := <-serveErr:
 		log.Fatalf("Server failed to start: %v", err)
+	case sig := <-stop:
+		fmt.Printf("Received %s, draining in-flight requests (timeout %s)...\n", sig, drainTimeout)
+	}
+	// A running VACUUM stops after its current table
+	db.BeginShutdown()
+
+	if remaining := drain.drain(drainTimeout); remaining > 0 {
+		fmt.Printf("Warning: shutdown timeout fired with %d requests still in flight; they are cut off\n", remaining)
+	}
+	httpServer.Close()
+	closeDatabase(db)
+	fmt.Println("LiteLedger stopped.")
+}
+
+// sqlErrorStatus picks the HTTP status of a failed statement. Errors the
+// client can fix by changing the query (syntax, unknown columns, bad values,
+// constraint violations) are 400; a missing table or row is 404; inserting a
+// key that already exists is 409; a full disk is 507; and damaged or
+// unreadable storage is 500, so a client can tell a typo from a broken
+// database.
+func sqlErrorStatus(err error) int {
+	var pathErr *fs.PathError
+	switch {
+	case errors.Is(err, engine.ErrTableNotFound), errors.Is(err, engine.ErrRowNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, engine.ErrDuplicateKey):
+		return http.StatusConflict
+	case errors.Is(err, storage.ErrDiskFull):
+		return http.StatusInsufficientStorage
+	case errors.Is(err, engine.ErrShuttingDown):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, storage.ErrTampered), errors.Is(err, storage.ErrOffsetOutOfRange),
+		errors.Is(err, engine.ErrTableFileChanged), errors.Is(err, engine.ErrRowArity),
+		errors.Is(err, engine.ErrTableDegraded),
+		errors.As(err, &pathErr):
+		return http.StatusInternalServerError
+	}
+	return http.StatusBadRequest
+}
+
+// openDatabase applies the LITELEDGER_* storage settings, then opens and
+// recovers the database in the data directory: dataDir if set, else
+// LITELEDGER_DATA_DIR, else "data". Invalid settings are fatal.
+func openDatabase(verifyOnStart bool, dataDir string) *engine.Database {
+	if err := configureDataDir(dataDir); err != nil {
+		log.Fatalf("Invalid data directory: %v", err)
+	}
+	// Configure write durability before anything touches the log
+	if err := configureSync(); err != nil {
+		log.Fatalf("Invalid sync configuration: %v", err)
+	}
+	if err := configureRetry(); err != nil {
+		log.Fatalf("Invalid retry configuration: %v", err)
+	}
+
+	// Initialize the database engine
+	db := engine.NewDatabase()
+	if err := configureLimits(db); err != nil {
+		log.Fatalf("Invalid limits configuration: %v", err)
+	}
+	// LITELEDGER_STRICT_ROWS=true fails reads of rows that don't match their
+	// schema instead of truncating them, to help find bad data
+	db.StrictRows = os.Getenv("LITELEDGER_STRICT_ROWS") == "true"
+	// LITELEDGER_SKIP_CORRUPT_ROWS=true lets SELECTs return the intact rows,
+	// with a warning, when some rows fail their checksum
+	db.SkipCorruptRows = os.Getenv("LITELEDGER_SKIP_CORRUPT_ROWS") == "true"
+	// LITELEDGER_PARANOID=true checks before each indexed read that the table
+	// file wasn't edited behind the server's back, and reindexes it if it was
+	db.Paranoid = os.Getenv("LITELEDGER_PARANOID") == "true"
+
+	// Recover database state from disk
+	if err := db.Recover(); err != nil {
+		// Log error but continue (start fresh if recovery fails completely)
+		fmt.Printf("Warning: Database recovery issues: %v\n", err)
+	} else {
+		fmt.Println("Database recovered successfully.")
+	}
+	if verifyOnStart {
+		if mismatches := db.VerifyIndexes(); len(mismatches) > 0 {
+			fmt.Printf("Warning: index verification found %d mismatched entries; affected tables are marked degraded\n", len(mismatches))
+		} else {
+			fmt.Println("Index verification passed.")
+		}
+	}
+	return db
+}
+
+// closeDatabase saves the indexes and flushes the logs before the process exits
+func closeDatabase(db *engine.Database) {
+	// Save the indexes so the next start only replays what comes after
+	if err := db.Checkpoint(); err != nil {
+		fmt.Printf("Warning: index checkpoint incomplete: %v\n", err)
+	}
+	storage.CloseWriters()
+	if err := storage.Flush(); err != nil {
+		fmt.Printf("Warning: final sync failed: %v\n", err)
 	}
 }
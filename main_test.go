@@ -0,0 +1,343 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"pesapal-ledger/storage"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSQLDuplicateInsert(t *testing.T) {
+	s := newTestServer(t, "CREATE TABLE users (id int, name text)")
+
+	rec, resp := serve(t, s.handleSQL, http.MethodPost, "/sql", `{"query": "INSERT INTO users VALUES (1, alice)"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("first INSERT: status %d (%s)", rec.Code, resp.Error)
+	}
+	rec, resp = serve(t, s.handleSQL, http.MethodPost, "/sql", `{"query": "INSERT INTO users VALUES (1, bob)"}`)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("duplicate INSERT: status %d (%s), want 409", rec.Code, resp.Error)
+	}
+
+	rec, resp = serve(t, s.handleSQL, http.MethodPost, "/sql", `{"query": "SELECT name FROM users WHERE id = 1"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("SELECT: status %d (%s)", rec.Code, resp.Error)
+	}
+	if rows, _ := resp.Data.([]interface{}); len(rows) != 1 || rows[0].([]interface{})[0] != "alice" {
+		t.Errorf("SELECT after the duplicate = %v, want alice", resp.Data)
+	}
+}
+
+func TestSQLMaxResultRows(t *testing.T) {
+	s := newTestServer(t,
+		"CREATE TABLE t (id int, kind text)",
+		"INSERT INTO t VALUES (1, a)",
+		"INSERT INTO t VALUES (2, a)",
+		"INSERT INTO t VALUES (3, b)",
+	)
+	s.db.Limits.MaxResultRows = 2
+
+	tests := []struct {
+		query    string
+		status   int
+		wantRows int
+	}{
+		{"SELECT * FROM t", http.StatusBadRequest, 0},
+		{"SELECT id FROM t WHERE kind = a", http.StatusOK, 2},
+		{"SELECT id FROM t WHERE id BETWEEN 2 AND 3", http.StatusOK, 2},
+		{"SELECT id FROM t WHERE id >= 1", http.StatusBadRequest, 0},
+		{"SELECT * FROM t TAIL 2", http.StatusOK, 2},
+		{"SELECT * FROM t TAIL 3", http.StatusBadRequest, 0},
+		{"SELECT * FROM t LIMIT 2", http.StatusOK, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			rec, resp := serve(t, s.handleSQL, http.MethodPost, "/sql", fmt.Sprintf(`{"query": %q}`, tt.query))
+			if rec.Code != tt.status {
+				t.Fatalf("status %d (%s), want %d", rec.Code, resp.Error, tt.status)
+			}
+			if tt.status != http.StatusOK {
+				if resp.Success || !strings.Contains(resp.Error, "result too large") {
+					t.Errorf("response = %+v, want a result too large error", resp)
+				}
+				return
+			}
+			if rows, _ := resp.Data.([]interface{}); len(rows) != tt.wantRows {
+				t.Errorf("got %v, want %d rows", resp.Data, tt.wantRows)
+			}
+		})
+	}
+}
+
+func TestPrettyResponses(t *testing.T) {
+	s := newTestServer(t,
+		"CREATE TABLE users (id int, name text)",
+		"INSERT INTO users VALUES (1, alice)",
+	)
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		target  string
+		body    string
+		pretty  bool
+	}{
+		{"compact by default", s.handleSQL, "/sql", `{"query": "SELECT * FROM users"}`, false},
+		{"pretty=1", s.handleSQL, "/sql?pretty=1", `{"query": "SELECT * FROM users"}`, true},
+		{"pretty=true", s.handleSQL, "/sql?pretty=true", `{"query": "SELECT * FROM users"}`, true},
+		{"pretty=0", s.handleSQL, "/sql?pretty=0", `{"query": "SELECT * FROM users"}`, false},
+		{"unrecognized value", s.handleSQL, "/sql?pretty=yes", `{"query": "SELECT * FROM users"}`, false},
+		{"query error", s.handleSQL, "/sql?pretty=1", `{"query": "SELECT * FROM nope"}`, true},
+		{"bad body", s.handleSQL, "/sql?pretty=1", `{"querry": "SELECT 1"}`, true},
+		{"batch", s.handleSQLBatch, "/sql/batch?pretty=1", `{"query": "SELECT * FROM users; SELECT name FROM users"}`, true},
+		{"batch bad body", s.handleSQLBatch, "/sql/batch?pretty=1", `{"queries": ["SELECT 1"]}`, true},
+		{"empty batch", s.handleSQLBatch, "/sql/batch?pretty=1", `{"query": ";"}`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec, resp := serve(t, tt.handler, http.MethodPost, tt.target, tt.body)
+			body := rec.Body.String()
+			if indented := strings.HasPrefix(body, "{\n  \""); indented != tt.pretty {
+				t.Errorf("indented = %v, want %v: %q", indented, tt.pretty, body)
+			}
+			if !tt.pretty && strings.Count(body, "\n") != 1 {
+				t.Errorf("compact response spans several lines: %q", body)
+			}
+
+			// The flag changes only the layout
+			plainTarget := strings.SplitN(tt.target, "?", 2)[0]
+			_, plain := serve(t, tt.handler, http.MethodPost, plainTarget, tt.body)
+			plain.Stats, resp.Stats = nil, nil
+			if !reflect.DeepEqual(resp, plain) {
+				t.Errorf("response = %+v, without the flag %+v", resp, plain)
+			}
+		})
+	}
+}
+
+func TestSQLColumnarFormat(t *testing.T) {
+	s := newTestServer(t,
+		"CREATE TABLE t (id int, merchant text, amount float)",
+		"INSERT INTO t VALUES (1, a, 1.5)",
+		"INSERT INTO t VALUES (2, b, 2)",
+	)
+
+	tests := []struct {
+		query string
+		want  interface{}
+	}{
+		{"SELECT id, merchant FROM t", map[string]interface{}{
+			"columns": []interface{}{"id", "merchant"},
+			"types":   []interface{}{"int", "text"},
+			"rows":    float64(2),
+			"data":    map[string]interface{}{"id": []interface{}{float64(1), float64(2)}, "merchant": []interface{}{"a", "b"}},
+		}},
+		{"SELECT amount FROM t WHERE id > 5", map[string]interface{}{
+			"columns": []interface{}{"amount"},
+			"types":   []interface{}{"float"},
+			"rows":    float64(0),
+			"data":    map[string]interface{}{"amount": []interface{}{}},
+		}},
+		// Statements that don't return rows ignore the flag
+		{"SHOW TABLES", []interface{}{"t"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			rec, resp := serve(t, s.handleSQL, http.MethodPost, "/sql?format=columnar", fmt.Sprintf(`{"query": %q}`, tt.query))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status %d (%s)", rec.Code, resp.Error)
+			}
+			if !reflect.DeepEqual(resp.Data, tt.want) {
+				t.Errorf("data = %#v, want %#v", resp.Data, tt.want)
+			}
+		})
+	}
+}
+
+func TestSQLSkipsCorruptRows(t *testing.T) {
+	setup := []string{"CREATE TABLE txns (id int, merchant text, amount int)"}
+	for i := 1; i <= 20; i++ {
+		setup = append(setup, fmt.Sprintf("INSERT INTO txns VALUES (%d, m%02d, %d)", i, i, i%3))
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		rows  int // returned by a full read of the intact rows
+	}{
+		{"select star", "SELECT * FROM txns", 19},
+		{"column filter", "SELECT id FROM txns WHERE amount >= 0", 19},
+		{"range", "SELECT * FROM txns WHERE id BETWEEN 5 AND 10", 5},
+		{"tail", "SELECT * FROM txns TAIL 20", 19},
+		{"group by", "SELECT amount, COUNT(*) FROM txns GROUP BY amount", 3},
+	}
+	for _, tt := range tests {
+		for _, skip := range []bool{false, true} {
+			mode := "strict"
+			if skip {
+				mode = "skip corrupt rows"
+			}
+			t.Run(tt.name+"/"+mode, func(t *testing.T) {
+				s := newTestServer(t, setup...)
+				s.db.SkipCorruptRows = skip
+				damageRow(t, "txns", "m07")
+
+				rec, resp := serve(t, s.handleSQL, http.MethodPost, "/sql", fmt.Sprintf(`{"query": %q}`, tt.query))
+				if !skip {
+					if rec.Code != http.StatusInternalServerError || resp.Warning != "" {
+						t.Fatalf("status %d (%s, warning %q), want 500", rec.Code, resp.Error, resp.Warning)
+					}
+					return
+				}
+				if rec.Code != http.StatusOK {
+					t.Fatalf("status %d (%s), want 200", rec.Code, resp.Error)
+				}
+				if rows, _ := resp.Data.([]interface{}); len(rows) != tt.rows {
+					t.Errorf("got %d rows, want %d: %v", len(rows), tt.rows, resp.Data)
+				}
+				if !strings.HasPrefix(resp.Warning, "1 corrupt rows were skipped") {
+					t.Errorf("warning = %q", resp.Warning)
+				}
+				if resp.Stats == nil || len(resp.Stats.SkippedRows) != 1 || resp.Stats.SkippedRows[0].Key != "7" || resp.Stats.SkippedRows[0].Table != "txns" {
+					t.Errorf("stats = %+v, want row 7 skipped", resp.Stats)
+				}
+			})
+		}
+	}
+
+	// Intact rows read without a warning, and the corrupt row by its key fails
+	s := newTestServer(t, setup...)
+	s.db.SkipCorruptRows = true
+	damageRow(t, "txns", "m07")
+	if rec, resp := serve(t, s.handleSQL, http.MethodPost, "/sql", `{"query": "SELECT * FROM txns WHERE id BETWEEN 10 AND 20"}`); rec.Code != http.StatusOK || resp.Warning != "" {
+		t.Errorf("range without the corrupt row: status %d, warning %q", rec.Code, resp.Warning)
+	}
+	if rec, resp := serve(t, s.handleSQL, http.MethodPost, "/sql", `{"query": "SELECT * FROM txns WHERE id = 7"}`); rec.Code != http.StatusInternalServerError {
+		t.Errorf("lookup of the corrupt row: status %d (%v)", rec.Code, resp.Data)
+	}
+}
+
+// damageRow flips a bit of value in a table's file, so the row holding it
+// fails its checksum
+func damageRow(t *testing.T, tableName, value string) {
+	t.Helper()
+	path := storage.TableFilePath(tableName)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := bytes.Index(data, []byte(value))
+	if at < 0 {
+		t.Fatalf("%q is not in %s", value, path)
+	}
+	data[at] ^= 0x01
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAuthorizerDeniesWrites(t *testing.T) {
+	s := newTestServer(t,
+		"CREATE TABLE ledger (id int, note text)",
+		"CREATE TABLE users (id int, name text)",
+		"INSERT INTO ledger VALUES (1, opening)",
+	)
+	s.authorize = func(ctx context.Context, stmtType, table string) error {
+		if strings.EqualFold(table, "ledger") && stmtType != "SELECT" {
+			return errors.New("ledger is read-only")
+		}
+		return nil
+	}
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		method  string
+		target  string
+		body    string
+		status  int
+	}{
+		{"SQL read", s.handleSQL, http.MethodPost, "/sql", `{"query": "SELECT * FROM ledger"}`, http.StatusOK},
+		{"SQL write to another table", s.handleSQL, http.MethodPost, "/sql", `{"query": "INSERT INTO users VALUES (1, alice)"}`, http.StatusOK},
+		{"SQL insert", s.handleSQL, http.MethodPost, "/sql", `{"query": "INSERT INTO ledger VALUES (2, x)"}`, http.StatusForbidden},
+		{"SQL update", s.handleSQL, http.MethodPost, "/sql", `{"query": "UPDATE ledger SET note = x WHERE id = 1"}`, http.StatusForbidden},
+		{"SQL delete", s.handleSQL, http.MethodPost, "/sql", `{"query": "DELETE FROM ledger WHERE id = 1"}`, http.StatusForbidden},
+		{"SQL drop", s.handleSQL, http.MethodPost, "/sql", `{"query": "DROP TABLE ledger"}`, http.StatusForbidden},
+		{"SQL peek", s.handleSQL, http.MethodPost, "/sql", `{"query": "PEEK"}`, http.StatusOK},
+		{"SQL dump of every table", s.handleSQL, http.MethodPost, "/sql", `{"query": "DUMP SCHEMA"}`, http.StatusForbidden},
+		{"transaction touching the table", s.handleSQL, http.MethodPost, "/sql",
+			`{"query": "BEGIN; INSERT INTO users VALUES (2, bob); DELETE FROM ledger WHERE id = 1; COMMIT"}`, http.StatusForbidden},
+		{"REST read", s.handleTableRows, http.MethodGet, "/tables/ledger/rows/1", "", http.StatusOK},
+		{"REST insert", s.handleTableRows, http.MethodPost, "/tables/ledger/rows", `{"id": 3, "note": "y"}`, http.StatusForbidden},
+		{"REST delete", s.handleTableRows, http.MethodDelete, "/tables/ledger/rows/1", "", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec, resp := serve(t, tt.handler, tt.method, tt.target, tt.body)
+			if rec.Code != tt.status {
+				t.Fatalf("status %d (%s), want %d", rec.Code, resp.Error, tt.status)
+			}
+			if tt.status == http.StatusForbidden && !strings.Contains(resp.Error, "ledger is read-only") {
+				t.Errorf("error = %q, want the authorizer's reason", resp.Error)
+			}
+		})
+	}
+
+	// A batch runs the allowed statements and reports the denied one
+	rec, resp := serve(t, s.handleSQLBatch, http.MethodPost, "/sql/batch", `{"query": "INSERT INTO users VALUES (3, carol); INSERT INTO ledger VALUES (4, z)"}`)
+	if rec.Code != http.StatusOK || resp.Warning == "" {
+		t.Fatalf("batch: status %d, warning %q; want 200 with a warning", rec.Code, resp.Warning)
+	}
+	if results, _ := resp.Data.([]interface{}); len(results) != 2 || results[0].(map[string]interface{})["success"] != true || results[1].(map[string]interface{})["success"] != false {
+		t.Errorf("batch results = %v, want the first to succeed and the second denied", resp.Data)
+	}
+
+	// Nothing denied reached the ledger or the transaction's other table
+	_, resp = serve(t, s.handleSQL, http.MethodPost, "/sql", `{"query": "SELECT id, note FROM ledger UNION ALL SELECT id, name FROM users"}`)
+	want := []interface{}{[]interface{}{float64(1), "opening"}, []interface{}{float64(1), "alice"}, []interface{}{float64(3), "carol"}}
+	if !reflect.DeepEqual(resp.Data, want) {
+		t.Errorf("rows = %v, want %v", resp.Data, want)
+	}
+}
+
+func TestConfigureDataDir(t *testing.T) {
+	newTestServer(t)
+	before := storage.DataDir()
+	flagDir, envDir := t.TempDir(), t.TempDir()
+
+	tests := []struct {
+		name    string
+		flag    string
+		env     string
+		want    string
+		wantErr bool
+	}{
+		{"neither", "", "", before, false},
+		{"environment", "", envDir, envDir, false},
+		{"flag", flagDir, "", flagDir, false},
+		{"flag over environment", flagDir, envDir, flagDir, false},
+		{"blank environment", "", "  ", before, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("LITELEDGER_DATA_DIR", tt.env)
+			if err := storage.SetDataDir(before); err != nil {
+				t.Fatal(err)
+			}
+			err := configureDataDir(tt.flag)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("configureDataDir(%q) with LITELEDGER_DATA_DIR=%q: %v", tt.flag, tt.env, err)
+			}
+			if got := storage.DataDir(); got != tt.want {
+				t.Errorf("data directory = %s, want %s", got, tt.want)
+			}
+		})
+	}
+	storage.SetDataDir(before)
+}
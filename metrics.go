@@ -0,0 +1,144 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// queryCounters counts the /sql requests served since the server started,
+// or since the counters were last reset
+type queryCounters struct {
+	started time.Time // process start, for uptime; not reset
+
+	mu           sync.Mutex
+	since        time.Time
+	queries      int64
+	errors       int64
+	byType       map[string]int64
+	errorsByType map[string]int64
+}
+
+func newQueryCounters() *queryCounters {
+	now := time.Now()
+	return &queryCounters{
+		started:      now,
+		since:        now,
+		byType:       make(map[string]int64),
+		errorsByType: make(map[string]int64),
+	}
+}
+
+// statementType returns the leading keyword of a query, e.g. "SELECT", or
+// "OTHER" when there is none
+func statementType(query string) string {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return "OTHER"
+	}
+	return strings.ToUpper(strings.TrimSuffix(fields[0], ";"))
+}
+
+// record counts one request for query, failed or not
+func (c *queryCounters) record(query string, failed bool) {
+	kind := statementType(query)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.queries++
+	c.byType[kind]++
+	if failed {
+		c.errors++
+		c.errorsByType[kind]++
+	}
+}
+
+// reset zeroes the counters. Uptime keeps counting from the server start.
+func (c *queryCounters) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.since = time.Now()
+	c.queries, c.errors = 0, 0
+	c.byType = make(map[string]int64)
+	c.errorsByType = make(map[string]int64)
+}
+
+// ServerStats is the body of GET /admin/stats
+type ServerStats struct {
+	StartedAt     time.Time        `json:"startedAt"`
+	UptimeSeconds float64          `json:"uptimeSeconds"`
+	CountersSince time.Time        `json:"countersSince"` // server start or last reset
+	Queries       int64            `json:"queries"`
+	Errors        int64            `json:"errors"`
+	QueriesByType map[string]int64 `json:"queriesByType"`
+	ErrorsByType  map[string]int64 `json:"errorsByType"`
+	Tables        int              `json:"tables"`
+	LiveRows      int64            `json:"liveRows"` // across all tables
+}
+
+// snapshot copies the counters into a ServerStats
+func (c *queryCounters) snapshot() ServerStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := ServerStats{
+		StartedAt:     c.started,
+		UptimeSeconds: time.Since(c.started).Seconds(),
+		CountersSince: c.since,
+		Queries:       c.queries,
+		Errors:        c.errors,
+		QueriesByType: make(map[string]int64, len(c.byType)),
+		ErrorsByType:  make(map[string]int64, len(c.errorsByType)),
+	}
+	for kind, n := range c.byType {
+		stats.QueriesByType[kind] = n
+	}
+	for kind, n := range c.errorsByType {
+		stats.ErrorsByType[kind] = n
+	}
+	return stats
+}
+
+// handleServerStats serves GET /admin/stats: uptime, the query counters and
+// the number of tables and live rows
+func (s *Server) handleServerStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.requireAdmin(w, r) {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, SQLResponse{Success: true, Data: s.serverStats()})
+}
+
+// serverStats adds the number of tables and live rows to the counters
+func (s *Server) serverStats() ServerStats {
+	stats := s.counters.snapshot()
+	for _, name := range s.db.AllTables() {
+		tableStats, err := s.db.Stats(name)
+		if err != nil {
+			continue // dropped while we were iterating
+		}
+		stats.Tables++
+		stats.LiveRows += int64(tableStats.LiveRows)
+	}
+	return stats
+}
+
+// handleServerStatsReset serves POST /admin/stats/reset, which zeroes the
+// query counters
+func (s *Server) handleServerStatsReset(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.requireAdmin(w, r) {
+		return
+	}
+
+	s.counters.reset()
+	writeJSON(w, http.StatusOK, SQLResponse{Success: true, Data: s.serverStats()})
+}
@@ -0,0 +1,305 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"pesapal-ledger/engine"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// groupItem is one entry of a GROUP BY query's select list
+type groupItem struct {
+	alias  string
+	result int // position in the GroupRows output: 0 is the key, 1+i the i-th aggregate
+}
+
+// parseGroupBy parses
+// "SELECT items FROM t [WHERE ...] GROUP BY col [ORDER BY expr [ASC|DESC]] [LIMIT n]".
+// Items are the group column or aggregates (COUNT, SUM, MIN, MAX, AVG), each
+// optionally followed by "AS alias". ORDER BY may name an alias, an aggregate
+// (listed or not) or the group column; it is applied after aggregation and
+// before LIMIT.
+func parseGroupBy(query string, db *engine.Database, trace *engine.Trace) (interface{}, error) {
+	upper := strings.ToUpper(query)
+	idxFrom := strings.Index(upper, " FROM ")
+	idxGroup := strings.Index(upper, " GROUP BY ")
+	if idxFrom == -1 || idxFrom > idxGroup {
+		return nil, fmt.Errorf("invalid SELECT syntax: missing FROM")
+	}
+
+	fromPart := strings.TrimSpace(query[idxFrom+1 : idxGroup])
+	tableName := fromTableName(fromPart)
+
+	// Peel LIMIT and ORDER BY off the end of the GROUP BY clause
+	tail := query[idxGroup+10:] // len(" GROUP BY ")
+	limit := -1
+	if idxLimit := strings.LastIndex(strings.ToUpper(tail), " LIMIT "); idxLimit != -1 {
+		n, err := strconv.Atoi(strings.TrimSpace(tail[idxLimit+7:]))
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid LIMIT %q: expected a non-negative integer", strings.TrimSpace(tail[idxLimit+7:]))
+		}
+		limit = n
+		tail = tail[:idxLimit]
+	}
+	orderBy := ""
+	if idxOrder := strings.Index(strings.ToUpper(tail), " ORDER BY "); idxOrder != -1 {
+		orderBy = strings.TrimSpace(tail[idxOrder+10:]) // len(" ORDER BY ")
+		tail = tail[:idxOrder]
+	}
+
+	groupRef := strings.TrimSpace(tail)
+	if groupRef == "" {
+		return nil, fmt.Errorf("invalid GROUP BY syntax: missing column")
+	}
+	if strings.Contains(groupRef, ",") {
+		return nil, fmt.Errorf("GROUP BY supports a single column")
+	}
+	groupColumn, err := unqualifyColumn(groupRef, tableName)
+	if err != nil {
+		return nil, err
+	}
+	// Every name is checked before any row is read
+	if err := db.CheckColumns(tableName, "GROUP BY", []string{groupColumn}); err != nil {
+		return nil, err
+	}
+
+	// Select list
+	var aggs []engine.Aggregate
+	var items []groupItem
+	for _, raw := range splitTopLevel(query[7:idxFrom], ',') { // len("SELECT ")
+		expr, alias := splitAlias(strings.TrimSpace(raw))
+		if expr == "" {
+			return nil, fmt.Errorf("invalid SELECT syntax: empty select item")
+		}
+
+		if strings.Contains(expr, "(") {
+			agg, err := parseAggregate(expr, tableName)
+			if err != nil {
+				return nil, err
+			}
+			if err := checkAggregateColumn(db, tableName, "SELECT list", agg); err != nil {
+				return nil, err
+			}
+			aggs = append(aggs, agg)
+			items = append(items, groupItem{alias: alias, result: len(aggs)})
+			continue
+		}
+
+		col, err := unqualifyColumn(expr, tableName)
+		if err != nil {
+			return nil, err
+		}
+		if err := db.CheckColumns(tableName, "SELECT list", []string{col}); err != nil {
+			return nil, err
+		}
+		if !strings.EqualFold(col, groupColumn) {
+			return nil, fmt.Errorf("column %s must appear in GROUP BY or be used in an aggregate", col)
+		}
+		items = append(items, groupItem{alias: alias, result: 0})
+	}
+
+	// Work out what to sort by; an aggregate that isn't selected is computed anyway
+	sortBy, desc := -1, false
+	if orderBy != "" {
+		sortBy, desc, aggs, err = resolveGroupOrder(orderBy, tableName, groupColumn, items, aggs, db)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	_, rows, err := selectRows("SELECT * "+fromPart, db, trace)
+	if err != nil {
+		return nil, err
+	}
+
+	start := trace.Start()
+	groups, err := db.GroupRows(tableName, groupColumn, aggs, rows)
+	if err != nil {
+		return nil, err
+	}
+	trace.Stop(engine.StageAggregate, start)
+
+	if sortBy >= 0 {
+		start := trace.Start()
+		sort.SliceStable(groups, func(i, j int) bool {
+			cmp := engine.CompareValues(groups[i][sortBy], groups[j][sortBy])
+			if desc {
+				return cmp > 0
+			}
+			return cmp < 0
+		})
+		trace.Stop(engine.StageSort, start)
+	}
+	if limit >= 0 && limit < len(groups) {
+		groups = groups[:limit]
+	}
+
+	result := make([][]interface{}, 0, len(groups))
+	for _, group := range groups {
+		out := make([]interface{}, len(items))
+		for i, item := range items {
+			out[i] = group[item.result]
+		}
+		result = append(result, out)
+	}
+	return result, nil
+}
+
+// resolveGroupOrder maps an ORDER BY clause of a GROUP BY query onto a
+// position in the GroupRows output, adding the aggregate if it isn't selected
+func resolveGroupOrder(orderBy, tableName, groupColumn string, items []groupItem, aggs []engine.Aggregate, db *engine.Database) (int, bool, []engine.Aggregate, error) {
+	expr, desc := orderBy, false
+	fields := strings.Fields(orderBy)
+	if last := strings.ToUpper(fields[len(fields)-1]); last == "ASC" || last == "DESC" {
+		expr = strings.TrimSpace(orderBy[:strings.LastIndex(orderBy, fields[len(fields)-1])])
+		desc = last == "DESC"
+	}
+
+	for _, item := range items {
+		if item.alias != "" && strings.EqualFold(item.alias, expr) {
+			return item.result, desc, aggs, nil
+		}
+	}
+
+	if strings.Contains(expr, "(") {
+		agg, err := parseAggregate(expr, tableName)
+		if err != nil {
+			return -1, false, nil, err
+		}
+		if err := checkAggregateColumn(db, tableName, "ORDER BY", agg); err != nil {
+			return -1, false, nil, err
+		}
+		for i, existing := range aggs {
+			if existing.Func == agg.Func && strings.EqualFold(existing.Column, agg.Column) {
+				return i + 1, desc, aggs, nil
+			}
+		}
+		aggs = append(aggs, agg)
+		return len(aggs), desc, aggs, nil
+	}
+
+	col, err := unqualifyColumn(expr, tableName)
+	if err != nil {
+		return -1, false, nil, err
+	}
+	if err := db.CheckColumns(tableName, "ORDER BY", []string{col}); err != nil {
+		return -1, false, nil, err
+	}
+	if !strings.EqualFold(col, groupColumn) {
+		return -1, false, nil, fmt.Errorf("ORDER BY %s must name the GROUP BY column, an aggregate or a select alias", expr)
+	}
+	return 0, desc, aggs, nil
+}
+
+// checkAggregateColumn resolves the column an aggregate reads; COUNT(*) reads none
+func checkAggregateColumn(db *engine.Database, tableName, clause string, agg engine.Aggregate) error {
+	if agg.Column == "*" {
+		return nil
+	}
+	return db.CheckColumns(tableName, clause, []string{agg.Column})
+}
+
+// parseAggregate parses a call such as "SUM(amount)" or "COUNT(*)"
+func parseAggregate(expr, tableName string) (engine.Aggregate, error) {
+	idxOpen := strings.Index(expr, "(")
+	if !strings.HasSuffix(expr, ")") {
+		return engine.Aggregate{}, fmt.Errorf("invalid aggregate %s: missing ')'", expr)
+	}
+
+	arg := strings.TrimSpace(expr[idxOpen+1 : len(expr)-1])
+	if arg == "" {
+		return engine.Aggregate{}, fmt.Errorf("invalid aggregate %s: missing argument", expr)
+	}
+	if arg != "*" {
+		col, err := unqualifyColumn(arg, tableName)
+		if err != nil {
+			return engine.Aggregate{}, err
+		}
+		arg = col
+	}
+
+	return engine.Aggregate{
+		Func:   strings.ToUpper(strings.TrimSpace(expr[:idxOpen])),
+		Column: arg,
+	}, nil
+}
+
+// splitAlias splits "expr AS alias" into its parts
+func splitAlias(item string) (string, string) {
+	idxAs := strings.LastIndex(strings.ToUpper(item), " AS ")
+	if idxAs == -1 {
+		return item, ""
+	}
+	return strings.TrimSpace(item[:idxAs]), strings.TrimSpace(item[idxAs+4:])
+}
+
+// aggregateFuncs are the functions parseAggregate accepts
+var aggregateFuncs = map[string]bool{"COUNT": true, "SUM": true, "MIN": true, "MAX": true, "AVG": true}
+
+// isAggregateCall reports whether a select item is an aggregate call
+func isAggregateCall(expr string) bool {
+	idxOpen := strings.Index(expr, "(")
+	return idxOpen > 0 && aggregateFuncs[strings.ToUpper(strings.TrimSpace(expr[:idxOpen]))]
+}
+
+// hasAggregates reports whether any item of a select list is an aggregate
+func hasAggregates(list string) bool {
+	for _, raw := range splitTopLevel(list, ',') {
+		expr, _ := splitAlias(strings.TrimSpace(raw))
+		if isAggregateCall(expr) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseSelectAggregates parses "SELECT agg [AS alias], ... FROM t [WHERE ...]"
+// without GROUP BY, such as SELECT COUNT(*) FROM t or SELECT SUM(amount) FROM
+// t WHERE merchant = Uber. The aggregates are taken over all matching rows.
+// A single aggregate returns its value alone; several return one row.
+func parseSelectAggregates(query string, db *engine.Database, trace *engine.Trace) (interface{}, error) {
+	idxFrom := indexKeyword(query, " FROM ")
+	fromPart := strings.TrimSpace(query[idxFrom+1:])
+	tableName := fromTableName(fromPart)
+	if _, order, err := splitResultOrder(fromPart); err != nil {
+		return nil, err
+	} else if order.column != "" || order.limit >= 0 {
+		return nil, fmt.Errorf("ORDER BY and LIMIT are not supported on aggregates without GROUP BY")
+	}
+
+	var aggs []engine.Aggregate
+	for _, raw := range splitTopLevel(query[7:idxFrom], ',') { // len("SELECT ")
+		expr, _ := splitAlias(strings.TrimSpace(raw))
+		if !isAggregateCall(expr) {
+			return nil, fmt.Errorf("column %s must appear in GROUP BY or be used in an aggregate", expr)
+		}
+		agg, err := parseAggregate(expr, tableName)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkAggregateColumn(db, tableName, "SELECT list", agg); err != nil {
+			return nil, err
+		}
+		aggs = append(aggs, agg)
+	}
+
+	// A key lookup that finds nothing aggregates no rows: COUNT is 0 and the
+	// others NULL, as for a WHERE that matches nothing
+	_, rows, err := selectRows("SELECT * "+fromPart, db, trace)
+	if err != nil && !errors.Is(err, engine.ErrRowNotFound) {
+		return nil, err
+	}
+
+	start := trace.Start()
+	defer trace.Stop(engine.StageAggregate, start)
+	values, err := db.AggregateRows(tableName, aggs, rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) == 1 {
+		return values[0], nil
+	}
+	return [][]interface{}{values}, nil
+}
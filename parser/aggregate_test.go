@@ -0,0 +1,82 @@
+package parser
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGroupByOrderByAggregate(t *testing.T) {
+	db := newTestDB(t,
+		"CREATE TABLE tx (id int, status text, amount int)",
+		"INSERT INTO tx VALUES (1, paid, 10)",
+		"INSERT INTO tx VALUES (2, paid, 30)",
+		"INSERT INTO tx VALUES (3, failed, 5)",
+		"INSERT INTO tx VALUES (4, refunded, 50)",
+		"INSERT INTO tx VALUES (5, pending, 1)",
+		"INSERT INTO tx VALUES (6, failed, 2)",
+	)
+
+	tests := []struct {
+		name  string
+		query string
+		want  [][]interface{}
+	}{
+		{"top N by sum", "SELECT status, SUM(amount) FROM tx GROUP BY status ORDER BY SUM(amount) DESC LIMIT 2",
+			[][]interface{}{{"refunded", int64(50)}, {"paid", int64(40)}}},
+		{"top N by alias", "SELECT status, SUM(amount) AS total FROM tx GROUP BY status ORDER BY total DESC LIMIT 3",
+			[][]interface{}{{"refunded", int64(50)}, {"paid", int64(40)}, {"failed", int64(7)}}},
+		{"ascending sum", "SELECT status, SUM(amount) FROM tx GROUP BY status ORDER BY SUM(amount)",
+			[][]interface{}{{"pending", int64(1)}, {"failed", int64(7)}, {"paid", int64(40)}, {"refunded", int64(50)}}},
+		{"aggregate not selected", "SELECT status, SUM(amount) FROM tx GROUP BY status ORDER BY AVG(amount) DESC LIMIT 2",
+			[][]interface{}{{"refunded", int64(50)}, {"paid", int64(40)}}},
+		{"group column", "SELECT status, SUM(amount) FROM tx GROUP BY status ORDER BY status",
+			[][]interface{}{{"failed", int64(7)}, {"paid", int64(40)}, {"pending", int64(1)}, {"refunded", int64(50)}}},
+		{"filtered before grouping", "SELECT status, SUM(amount) FROM tx WHERE amount > 4 GROUP BY status ORDER BY SUM(amount) LIMIT 2",
+			[][]interface{}{{"failed", int64(5)}, {"paid", int64(40)}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := queryRows(t, db, tt.query); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := Execute(db, "SELECT status, SUM(amount) FROM tx GROUP BY status ORDER BY missing DESC"); err == nil || !strings.Contains(err.Error(), "unknown column missing") {
+		t.Errorf("ORDER BY an unknown name: got %v", err)
+	}
+}
+
+func TestAggregateNoRows(t *testing.T) {
+	db := newTestDB(t,
+		"CREATE TABLE tx (id int, status text, amount int)",
+		"INSERT INTO tx VALUES (1, paid, 10)",
+		"INSERT INTO tx VALUES (2, paid, 30)",
+	)
+
+	tests := []struct {
+		query string
+		want  interface{}
+	}{
+		{"SELECT COUNT(*) FROM tx WHERE id = 1", int64(1)},
+		// A key that isn't there is no rows, the same as a WHERE that matches nothing
+		{"SELECT COUNT(*) FROM tx WHERE id = 999", int64(0)},
+		{"SELECT COUNT(*) FROM tx WHERE status = nobody", int64(0)},
+		{"SELECT SUM(amount) FROM tx WHERE id = 999", nil},
+		{"SELECT SUM(amount) FROM tx WHERE status = nobody", nil},
+		{"SELECT SUM(amount) FROM tx", int64(40)},
+		{"SELECT COUNT(*), MIN(amount), MAX(amount) FROM tx WHERE id = 999", [][]interface{}{{int64(0), nil, nil}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			if got := mustExecute(t, db, tt.query); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := Execute(db, "SELECT COUNT(*) FROM missing WHERE id = 1"); err == nil {
+		t.Error("an aggregate over a missing table succeeded")
+	}
+}
@@ -0,0 +1,236 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"pesapal-ledger/engine"
+	"strings"
+)
+
+// ErrNotAuthorized wraps an Authorizer's refusal
+var ErrNotAuthorized = errors.New("not authorized")
+
+// Authorizer decides whether a statement may run, for instance by the API key
+// the caller put in ctx. It is called once per table the statement touches,
+// with what the statement does to that table: its type (INSERT, DELETE,
+// ALTER, ...) for the table it writes and SELECT for the tables it only
+// reads. A statement that names no table (VACUUM, SHOW TABLES) gets a single
+// call with an empty tableName. One that reads every table (PEEK, DUMP
+// SCHEMA, SHOW TABLES WITH SCHEMA, SHOW INDEXES) gets a call for each table
+// instead, so it is denied if any table is. Returning an error denies the
+// statement.
+type Authorizer func(ctx context.Context, stmtType, tableName string) error
+
+// Check asks a about one table. A nil Authorizer allows everything.
+func (a Authorizer) Check(ctx context.Context, stmtType, tableName string) error {
+	if a == nil {
+		return nil
+	}
+	if err := a(ctx, stmtType, tableName); err != nil {
+		target := tableName
+		if target == "" {
+			target = "the database"
+		}
+		return fmt.Errorf("%w: %s on %s: %v", ErrNotAuthorized, stmtType, target, err)
+	}
+	return nil
+}
+
+// Authorize checks every table query touches with a before it runs; the
+// statements of a BEGIN ... COMMIT block are checked one by one. db supplies
+// the tables of statements that read them all. The first refusal is
+// returned, wrapping ErrNotAuthorized.
+func Authorize(ctx context.Context, query string, db *engine.Database, a Authorizer) error {
+	if a == nil {
+		return nil
+	}
+	targets, err := statementTargets(query, db)
+	if err != nil {
+		return err
+	}
+	for _, t := range targets {
+		if err := a.Check(ctx, t.stmtType, t.table); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// target is one table a statement touches and what it does to it
+type target struct {
+	stmtType string
+	table    string
+}
+
+// writeTypes are the statements that change the first table they name
+var writeTypes = map[string]bool{
+	"INSERT": true, "UPDATE": true, "DELETE": true, "CREATE": true, "ALTER": true,
+	"DROP": true, "IMPORT": true, "PURGE": true, "COMPACT": true,
+}
+
+// statementTargets lists the tables a statement touches, each once
+func statementTargets(query string, db *engine.Database) ([]target, error) {
+	query = strings.TrimSpace(query)
+	upper := strings.ToUpper(query)
+	switch {
+	case strings.HasPrefix(upper, "BEGIN"):
+		statements, err := splitStatements(query)
+		if err != nil {
+			return nil, err
+		}
+		var targets []target
+		for _, stmt := range statements {
+			if isKeywordStatement(stmt, "BEGIN") || isKeywordStatement(stmt, "COMMIT") || isKeywordStatement(stmt, "ROLLBACK") {
+				continue
+			}
+			inner, err := statementTargets(stmt, db)
+			if err != nil {
+				return nil, err
+			}
+			targets = appendTargets(targets, inner...)
+		}
+		return targets, nil
+	case strings.HasPrefix(upper, "EXPLAIN ANALYZE "):
+		return statementTargets(query[16:], db) // len("EXPLAIN ANALYZE "); the query runs
+	}
+
+	words := statementWords(query)
+	if len(words) == 0 {
+		return nil, nil
+	}
+	stmtType := strings.ToUpper(words[0])
+	var targets []target
+	if kind, system, ok := readsEveryTable(words); ok {
+		tables := db.ListTables()
+		if system {
+			tables = db.AllTables()
+		}
+		for _, name := range tables {
+			targets = append(targets, target{stmtType: kind, table: name})
+		}
+		if len(targets) == 0 {
+			targets = append(targets, target{stmtType: stmtType})
+		}
+		return targets, nil
+	}
+	for i, word := range words {
+		if i+1 >= len(words) || !namesTable(strings.ToUpper(word), i, stmtType) {
+			continue
+		}
+		next := i + 1
+		if stmtType == "CREATE" && hasIfNotExists(strings.Join(words[next:], " ")) {
+			next += 3 // CREATE TABLE IF NOT EXISTS name
+		}
+		if stmtType == "DESCRIBE" && strings.EqualFold(words[next], "FULL") && next+1 < len(words) {
+			next++ // DESCRIBE FULL name
+		}
+		if next >= len(words) {
+			continue
+		}
+		name := words[next]
+		if !isNameRef(name) || strings.EqualFold(name, "VALUES") || strings.EqualFold(name, "SELECT") {
+			continue // FROM (VALUES ...) or FROM (SELECT ...)
+		}
+		name = ident(name)
+		kind := stmtType
+		if writeTypes[stmtType] && len(targets) > 0 {
+			kind = "SELECT" // read by a subquery or INSERT ... SELECT
+		}
+		targets = appendTargets(targets, target{stmtType: kind, table: name})
+	}
+	if len(targets) == 0 {
+		targets = append(targets, target{stmtType: stmtType})
+	}
+	return targets, nil
+}
+
+// readsEveryTable reports whether a statement reads every table without
+// naming any, with the type each table is checked as and whether system
+// tables are read too. PEEK returns rows, so it is checked as a SELECT of
+// each table; the others return schema.
+func readsEveryTable(words []string) (string, bool, bool) {
+	upper := strings.ToUpper(strings.Join(words, " "))
+	switch {
+	case strings.EqualFold(words[0], "PEEK"):
+		return "SELECT", false, true
+	case upper == "DUMP SCHEMA":
+		return "DUMP", true, true
+	case upper == "SHOW TABLES WITH SCHEMA", upper == "SHOW INDEXES", upper == "SHOW INDEX":
+		return "SHOW", false, true
+	}
+	return "", false, false
+}
+
+// namesTable reports whether the word at position i is followed by a table name
+func namesTable(word string, i int, stmtType string) bool {
+	switch word {
+	case "FROM", "JOIN", "INTO":
+		return true
+	case "TABLE":
+		return stmtType != "SHOW"
+	case "SIZE":
+		return stmtType == "SHOW" // SHOW TABLE SIZE name
+	case "UPDATE", "DESCRIBE":
+		return i == 0
+	case "ON":
+		return stmtType == "DROP" // DROP INDEX ON name
+	}
+	return false
+}
+
+// statementWords splits a statement into words at spaces, commas, semicolons
+// and parentheses, leaving out quoted values
+func statementWords(query string) []string {
+	var words []string
+	var word strings.Builder
+	flush := func() {
+		if word.Len() > 0 {
+			words = append(words, word.String())
+			word.Reset()
+		}
+	}
+	inQuote := false
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == '\'':
+			inQuote = !inQuote
+			flush()
+		case inQuote:
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',' || c == ';' || c == '(' || c == ')':
+			flush()
+		default:
+			word.WriteByte(c)
+		}
+	}
+	flush()
+	return words
+}
+
+// isIdentifier reports whether a word can be a table name
+func isIdentifier(word string) bool {
+	for i, c := range word {
+		if !(c == '_' || c == '.' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || i > 0 && c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return word != ""
+}
+
+// appendTargets adds targets not already listed
+func appendTargets(targets []target, more ...target) []target {
+	for _, t := range more {
+		seen := false
+		for _, existing := range targets {
+			if existing.stmtType == t.stmtType && strings.EqualFold(existing.table, t.table) {
+				seen = true
+				break
+			}
+		}
+		if !seen {
+			targets = append(targets, t)
+		}
+	}
+	return targets
+}
@@ -0,0 +1,153 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStatementTargets(t *testing.T) {
+	db := newTestDB(t,
+		"CREATE TABLE ledger (id int)",
+		"CREATE TABLE accounts (id int)",
+		"CREATE TABLE __migrations (version int)",
+	)
+	tests := []struct {
+		query string
+		want  []target
+	}{
+		{"SELECT * FROM ledger WHERE id = 1", []target{{"SELECT", "ledger"}}},
+		{"select name from ledger", []target{{"SELECT", "ledger"}}},
+		{"INSERT INTO ledger VALUES (1, 'FROM users')", []target{{"INSERT", "ledger"}}},
+		{"UPDATE ledger SET note = x WHERE id = 1", []target{{"UPDATE", "ledger"}}},
+		{"DELETE FROM ledger WHERE id = 1", []target{{"DELETE", "ledger"}}},
+		{"CREATE TABLE ledger (id int)", []target{{"CREATE", "ledger"}}},
+		{"CREATE TABLE IF NOT EXISTS ledger (id int)", []target{{"CREATE", "ledger"}}},
+		{"DROP TABLE ledger", []target{{"DROP", "ledger"}}},
+		{"ALTER TABLE ledger ADD COLUMN note text", []target{{"ALTER", "ledger"}}},
+		{"PURGE TABLE ledger WHERE id < 10", []target{{"PURGE", "ledger"}}},
+		{"COMPACT TABLE ledger", []target{{"COMPACT", "ledger"}}},
+		{"IMPORT INTO ledger VALUES (1, 1, x)", []target{{"IMPORT", "ledger"}}},
+		{"SELECT id FROM ledger UNION SELECT id FROM archive", []target{{"SELECT", "ledger"}, {"SELECT", "archive"}}},
+		{"SELECT * FROM users WHERE id IN (SELECT user FROM ledger)", []target{{"SELECT", "users"}, {"SELECT", "ledger"}}},
+		{"DELETE FROM users WHERE id IN (SELECT user FROM ledger)", []target{{"DELETE", "users"}, {"SELECT", "ledger"}}},
+		{"SELECT * FROM (VALUES (1), (2)) AS v (n)", []target{{"SELECT", ""}}},
+		{"EXPLAIN ANALYZE DELETE FROM ledger WHERE id = 1", []target{{"DELETE", "ledger"}}},
+		{"BEGIN; INSERT INTO users VALUES (1, a); UPDATE ledger SET n = 1 WHERE id = 1; COMMIT", []target{{"INSERT", "users"}, {"UPDATE", "ledger"}}},
+		{"VACUUM", []target{{"VACUUM", ""}}},
+		{"SHOW TABLES", []target{{"SHOW", ""}}},
+		{"SHOW TABLE SIZE ledger", []target{{"SHOW", "ledger"}}},
+		// Statements that read every table are checked against each one
+		{"PEEK 3", []target{{"SELECT", "accounts"}, {"SELECT", "ledger"}}},
+		{"DUMP SCHEMA", []target{{"DUMP", "__migrations"}, {"DUMP", "accounts"}, {"DUMP", "ledger"}}},
+		{"SHOW TABLES WITH SCHEMA", []target{{"SHOW", "accounts"}, {"SHOW", "ledger"}}},
+		{"show indexes;", []target{{"SHOW", "accounts"}, {"SHOW", "ledger"}}},
+		{"SHOW INDEXES FROM ledger", []target{{"SHOW", "ledger"}}},
+		{"DESCRIBE ledger", []target{{"DESCRIBE", "ledger"}}},
+		{"DESCRIBE FULL ledger", []target{{"DESCRIBE", "ledger"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			got, err := statementTargets(tt.query, db)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("targets = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	db := newTestDB(t)
+	readOnlyLedger := Authorizer(func(ctx context.Context, stmtType, table string) error {
+		if strings.EqualFold(table, "ledger") && stmtType != "SELECT" {
+			return errors.New("ledger is read-only")
+		}
+		return nil
+	})
+
+	tests := []struct {
+		query  string
+		denied bool
+	}{
+		{"SELECT * FROM ledger", false},
+		{"INSERT INTO users VALUES (1, a)", false},
+		{"INSERT INTO ledger VALUES (1, a)", true},
+		{"UPDATE LEDGER SET n = 1 WHERE id = 1", true},
+		{"DELETE FROM ledger ALL", true},
+		{"DROP TABLE ledger", true},
+		{"DELETE FROM users WHERE id IN (SELECT user FROM ledger)", false},
+		{"BEGIN; INSERT INTO users VALUES (2, b); DELETE FROM ledger WHERE id = 1; COMMIT", true},
+		{"VACUUM", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			err := Authorize(context.Background(), tt.query, db, readOnlyLedger)
+			if !tt.denied {
+				if err != nil {
+					t.Errorf("denied: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrNotAuthorized) || !strings.Contains(err.Error(), "ledger is read-only") {
+				t.Errorf("err = %v, want a refusal wrapping ErrNotAuthorized", err)
+			}
+		})
+	}
+
+	if err := Authorize(context.Background(), "DROP TABLE ledger", db, nil); err != nil {
+		t.Errorf("a nil Authorizer denied: %v", err)
+	}
+}
+
+func TestAuthorizeEveryTable(t *testing.T) {
+	db := newTestDB(t,
+		"CREATE TABLE ledger (id int, amount int)",
+		"CREATE TABLE secret (id int, pin text)",
+		"INSERT INTO secret VALUES (1, '1234')",
+	)
+	noSecret := Authorizer(func(ctx context.Context, stmtType, table string) error {
+		if table == "secret" {
+			return errors.New("secret is hidden")
+		}
+		return nil
+	})
+
+	tests := []struct {
+		query  string
+		denied bool
+	}{
+		{"PEEK", true},
+		{"PEEK 1", true},
+		{"DUMP SCHEMA", true},
+		{"SHOW TABLES WITH SCHEMA", true},
+		{"SHOW INDEXES", true},
+		{"SHOW TABLES", false},
+		{"SHOW INDEXES FROM ledger", false},
+		{"SELECT * FROM ledger", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			_, err := executeAuthorized(context.Background(), tt.query, db, noSecret)
+			if !tt.denied {
+				if err != nil {
+					t.Errorf("denied: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrNotAuthorized) || !strings.Contains(err.Error(), "secret is hidden") {
+				t.Errorf("err = %v, want a refusal wrapping ErrNotAuthorized", err)
+			}
+		})
+	}
+
+	// With no tables there is nothing to check per table
+	empty := newTestDB(t)
+	if err := Authorize(context.Background(), "PEEK", empty, noSecret); err != nil {
+		t.Errorf("PEEK of no tables denied: %v", err)
+	}
+}
@@ -0,0 +1,85 @@
+package parser
+
+import (
+	"context"
+	"fmt"
+	"pesapal-ledger/engine"
+	"strings"
+)
+
+// BatchResult is the outcome of one statement of a batch
+type BatchResult struct {
+	Statement string      `json:"statement"`
+	Success   bool        `json:"success"`
+	Data      interface{} `json:"data,omitempty"`
+	Error     string      `json:"error,omitempty"`
+}
+
+// ParseSQLBatch runs several statements separated by semicolons, in order.
+// Semicolons inside quoted values don't split a statement. Each statement
+// runs on its own: one that fails gets an error in its BatchResult and the
+// ones after it still run. A BEGIN ... COMMIT (or ROLLBACK) in the batch runs
+// as a single transaction and gets a single result. Only a batch that can't
+// be split, such as one with an unterminated quote, fails as a whole.
+func ParseSQLBatch(queries string, db *engine.Database) ([]BatchResult, error) {
+	return ParseSQLBatchAuthorized(context.Background(), queries, db, nil)
+}
+
+// ParseSQLBatchAuthorized is ParseSQLBatch checking each statement with a
+// before it runs; a refused statement fails like any other, with an error
+// wrapping ErrNotAuthorized
+func ParseSQLBatchAuthorized(ctx context.Context, queries string, db *engine.Database, a Authorizer) ([]BatchResult, error) {
+	statements, err := batchStatements(queries)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]BatchResult, 0, len(statements))
+	for _, stmt := range statements {
+		result := BatchResult{Statement: stmt}
+		data, err := executeAuthorized(ctx, stmt, db, a)
+		if err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Success, result.Data = true, data
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// executeAuthorized runs one statement of a batch once a allows it
+func executeAuthorized(ctx context.Context, stmt string, db *engine.Database, a Authorizer) (interface{}, error) {
+	if err := Authorize(ctx, stmt, db, a); err != nil {
+		return nil, err
+	}
+	return ParseSQL(stmt, db)
+}
+
+// batchStatements splits a batch into the statements to run, joining each
+// BEGIN with the statements up to its COMMIT or ROLLBACK so the transaction
+// runs as one
+func batchStatements(queries string) ([]string, error) {
+	split, err := splitStatements(queries)
+	if err != nil {
+		return nil, err
+	}
+
+	var statements []string
+	for i := 0; i < len(split); i++ {
+		if !isKeywordStatement(split[i], "BEGIN") {
+			statements = append(statements, split[i])
+			continue
+		}
+		end := i + 1
+		for end < len(split) && !isKeywordStatement(split[end], "COMMIT") && !isKeywordStatement(split[end], "ROLLBACK") {
+			end++
+		}
+		if end == len(split) {
+			return nil, fmt.Errorf("the transaction begun by statement %d must end with COMMIT or ROLLBACK in the same batch", len(statements)+1)
+		}
+		statements = append(statements, strings.Join(split[i:end+1], "; "))
+		i = end
+	}
+	return statements, nil
+}
@@ -0,0 +1,77 @@
+package parser
+
+import (
+	"fmt"
+	"pesapal-ledger/engine"
+	"pesapal-ledger/storage"
+	"testing"
+)
+
+// newTestDB opens an empty database in a temporary data directory, removed
+// when the test or benchmark ends, and runs the setup statements against it
+func newTestDB(tb testing.TB, setup ...string) *engine.Database {
+	tb.Helper()
+	if err := storage.SetDataDir(tb.TempDir()); err != nil {
+		tb.Fatal(err)
+	}
+	if err := storage.SetSyncPolicy(storage.SyncPolicy{Mode: storage.SyncNone}); err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(storage.CloseWriters)
+
+	db := engine.NewDatabase()
+	if err := db.Recover(); err != nil {
+		tb.Fatal(err)
+	}
+	for _, query := range setup {
+		if _, err := Execute(db, query); err != nil {
+			tb.Fatalf("%s: %v", query, err)
+		}
+	}
+	return db
+}
+
+// benchRows is the size of the table the read benchmarks run against
+const benchRows = 10000
+
+// newBenchDB returns a database holding a transactions table of benchRows rows
+func newBenchDB(b *testing.B) *engine.Database {
+	b.Helper()
+	db := newTestDB(b, "CREATE TABLE transactions (id int, merchant text, amount int)")
+	for i := 1; i <= benchRows; i++ {
+		if _, err := Execute(db, fmt.Sprintf("INSERT INTO transactions VALUES (%d, merchant%d, %d)", i, i%100, i*10)); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return db
+}
+
+func BenchmarkInsert(b *testing.B) {
+	db := newTestDB(b, "CREATE TABLE transactions (id int, merchant text, amount int)")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := Execute(db, fmt.Sprintf("INSERT INTO transactions VALUES (%d, Starbucks, 550)", i)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSelectByID(b *testing.B) {
+	db := newBenchDB(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := Execute(db, fmt.Sprintf("SELECT * FROM transactions WHERE id = %d", i%benchRows+1)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFullScan(b *testing.B) {
+	db := newBenchDB(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := Execute(db, "SELECT * FROM transactions WHERE amount > 5000"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
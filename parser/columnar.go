@@ -0,0 +1,194 @@
+package parser
+
+import (
+	"fmt"
+	"pesapal-ledger/engine"
+	"strconv"
+	"strings"
+)
+
+// ColumnarResult is a SELECT result laid out column by column, for clients
+// that load data a column at a time (pandas, Arrow builders). Data holds the
+// values of each column in Columns, in row order.
+type ColumnarResult struct {
+	Columns []string `json:"columns"`
+	// Types is the schema type of each column; columns that aren't table
+	// columns (expressions, aggregates, VALUES) get the type of their values
+	Types []string                 `json:"types"`
+	Rows  int                      `json:"rows"`
+	Data  map[string][]interface{} `json:"data"`
+}
+
+// Columnar transposes the rows a SELECT returned into a ColumnarResult. Column
+// names come from the select list: the alias, the column name or the
+// expression as written. A name used twice gets a "_2" suffix so Data keeps
+// both columns.
+func Columnar(db *engine.Database, query string, rows [][]interface{}) (*ColumnarResult, error) {
+	query = strings.TrimSuffix(strings.TrimSpace(query), ";")
+	names, types, err := resultColumns(query, db)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		if len(row) != len(names) {
+			return nil, fmt.Errorf("columnar format: the query returned %d columns but its select list names %d", len(row), len(names))
+		}
+	}
+
+	result := &ColumnarResult{
+		Columns: uniqueNames(names),
+		Types:   types,
+		Rows:    len(rows),
+		Data:    make(map[string][]interface{}, len(names)),
+	}
+	for i, name := range result.Columns {
+		values := make([]interface{}, len(rows))
+		for r, row := range rows {
+			values[r] = row[i]
+		}
+		result.Data[name] = values
+		if result.Types[i] == "" {
+			result.Types[i] = valuesType(values)
+		}
+	}
+	return result, nil
+}
+
+// resultColumns names the columns a SELECT returns, with the schema type of
+// each one that is a table column ("" for the others). A UNION is named after
+// its first SELECT.
+func resultColumns(query string, db *engine.Database) ([]string, []string, error) {
+	if selects, _, ok := splitUnion(query); ok {
+		query = selects[0]
+	}
+	upper := strings.ToUpper(query)
+	if !strings.HasPrefix(upper, "SELECT ") {
+		return nil, nil, fmt.Errorf("columnar format is only available for SELECT")
+	}
+
+	if isValuesSelect(upper) {
+		selectList, _, alias, columns, _, err := splitValuesSelect(query)
+		if err != nil {
+			return nil, nil, err
+		}
+		if selectList != "*" {
+			if columns, err = parseColumnList(selectList, alias); err != nil {
+				return nil, nil, err
+			}
+		}
+		return columns, make([]string, len(columns)), nil
+	}
+
+	idxFrom := strings.Index(upper, " FROM ")
+	if idxFrom == -1 {
+		return nil, nil, fmt.Errorf("invalid SELECT syntax: missing FROM")
+	}
+	fromPart := query[idxFrom+1:]
+	if idxGroup := strings.Index(upper, " GROUP BY "); idxGroup > idxFrom {
+		fromPart = query[idxFrom+1 : idxGroup]
+	}
+	tableName := fromTableName(strings.TrimSpace(fromPart))
+
+	var names []string
+	var err error
+	switch {
+	case strings.HasPrefix(upper, "SELECT * EXCEPT"):
+		_, _, names, err = exceptColumns(query, db)
+	case strings.HasPrefix(upper, "SELECT * "):
+		names, err = db.RowColumns(tableName)
+	default:
+		names, err = selectListNames(query[7:idxFrom], tableName, db) // len("SELECT ")
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	types := make([]string, len(names))
+	for i, name := range names {
+		if cols, err := db.ColumnTypes(tableName, []string{name}); err == nil {
+			types[i] = cols[0].Type
+		}
+	}
+	return names, types, nil
+}
+
+// selectListNames names the items of a select list: the alias when there is
+// one, the schema spelling of a plain column, or the expression as written
+func selectListNames(list, tableName string, db *engine.Database) ([]string, error) {
+	schema, err := db.RowColumns(tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, item := range splitTopLevel(list, ',') {
+		text, alias := splitAlias(strings.TrimSpace(item))
+		switch {
+		case alias != "":
+			names = append(names, alias)
+		case strings.EqualFold(text, engine.LSNColumn):
+			names = append(names, engine.LSNColumn)
+		default:
+			name := text
+			if col, err := unqualifyColumn(text, tableName); err == nil {
+				if pos, err := engine.ResolveColumn(tableName, schema, col); err == nil {
+					name = schema[pos]
+				}
+			}
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// uniqueNames suffixes repeated names with "_2", "_3", ... so each column
+// has its own key
+func uniqueNames(names []string) []string {
+	unique := make([]string, len(names))
+	seen := make(map[string]bool, len(names))
+	for i, name := range names {
+		candidate := name
+		for n := 2; seen[candidate]; n++ {
+			candidate = name + "_" + strconv.Itoa(n)
+		}
+		seen[candidate] = true
+		unique[i] = candidate
+	}
+	return unique
+}
+
+// valuesType names the type of a column's values, for columns with no schema
+// type: int, float, bool, blob or text. NULLs are ignored; mixed columns are text.
+func valuesType(values []interface{}) string {
+	kind := ""
+	for _, v := range values {
+		var k string
+		switch v.(type) {
+		case nil:
+			continue
+		case int64, int:
+			k = "int"
+		case float64:
+			k = "float"
+		case bool:
+			k = "bool"
+		case []byte:
+			k = "blob"
+		default:
+			k = "text"
+		}
+		switch {
+		case kind == "":
+			kind = k
+		case kind == k:
+		case (kind == "int" && k == "float") || (kind == "float" && k == "int"):
+			kind = "float"
+		default:
+			return "text"
+		}
+	}
+	if kind == "" {
+		return "text"
+	}
+	return kind
+}
@@ -0,0 +1,69 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestColumnar(t *testing.T) {
+	db := newTestDB(t,
+		"CREATE TABLE t (id int, merchant text, amount float, ok bool)",
+		"INSERT INTO t VALUES (1, a, 1.5, true)",
+		"INSERT INTO t VALUES (2, b, 2, false)",
+		"INSERT INTO t VALUES (3, a, 3, true)",
+	)
+
+	tests := []struct {
+		query     string
+		wantCols  []string
+		wantTypes []string
+	}{
+		{"SELECT * FROM t", []string{"id", "active_flag", "merchant", "amount", "ok"}, []string{"int", "text", "text", "float", "bool"}},
+		{"SELECT ID, merchant AS m, id FROM t WHERE id > 1", []string{"id", "m", "id_2"}, []string{"int", "text", "int"}},
+		{"SELECT merchant, SUM(amount) AS total, COUNT(*) FROM t GROUP BY merchant", []string{"merchant", "total", "COUNT(*)"}, []string{"text", "float", "int"}},
+		{"SELECT * EXCEPT (ok) FROM t", []string{"id", "merchant", "amount"}, []string{"int", "text", "float"}},
+		{"SELECT COALESCE(merchant, 'x'), t.amount FROM t", []string{"COALESCE(merchant, 'x')", "amount"}, []string{"text", "float"}},
+		{"SELECT * FROM (VALUES (1, 'x'), (2.5, 'y')) AS v (n, s)", []string{"n", "s"}, []string{"float", "text"}},
+		{"SELECT id FROM t UNION SELECT id FROM t", []string{"id"}, []string{"int"}},
+		{"SELECT _lsn, id FROM t", []string{"_lsn", "id"}, []string{"bigint", "int"}},
+		{"SELECT id, CASE WHEN ok = true THEN 1 ELSE 0 END AS flag FROM t", []string{"id", "flag"}, []string{"int", "int"}},
+		{"SELECT merchant FROM t WHERE id > 10", []string{"merchant"}, []string{"text"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			rows := queryRows(t, db, tt.query)
+			got, err := Columnar(db, tt.query, rows)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got.Columns, tt.wantCols) {
+				t.Errorf("columns = %q, want %q", got.Columns, tt.wantCols)
+			}
+			if !reflect.DeepEqual(got.Types, tt.wantTypes) {
+				t.Errorf("types = %q, want %q", got.Types, tt.wantTypes)
+			}
+			if got.Rows != len(rows) || len(got.Data) != len(got.Columns) {
+				t.Fatalf("rows = %d with %d data columns, want %d rows of %d", got.Rows, len(got.Data), len(rows), len(got.Columns))
+			}
+
+			// Transposing back gives the row-oriented result
+			back := make([][]interface{}, got.Rows)
+			for r := range back {
+				back[r] = make([]interface{}, len(got.Columns))
+				for c, name := range got.Columns {
+					back[r][c] = got.Data[name][r]
+				}
+			}
+			if !reflect.DeepEqual(back, rows) {
+				t.Errorf("rows from the columns = %v, want %v", back, rows)
+			}
+		})
+	}
+
+	if _, err := Columnar(db, "SHOW TABLES", nil); err == nil {
+		t.Error("Columnar accepted a statement that isn't a SELECT")
+	}
+	if _, err := Columnar(db, "SELECT id, merchant FROM t", [][]interface{}{{int64(1)}}); err == nil {
+		t.Error("Columnar accepted rows narrower than the select list")
+	}
+}
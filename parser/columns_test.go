@@ -0,0 +1,142 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"pesapal-ledger/engine"
+	"pesapal-ledger/storage"
+)
+
+func TestColumnNamesIgnoreCase(t *testing.T) {
+	db := newTestDB(t,
+		"CREATE TABLE accounts (id int, Owner text, balance int)",
+		"INSERT INTO accounts VALUES (1, alice, 30)",
+		"INSERT INTO accounts VALUES (2, bob, 10)",
+		"INSERT INTO accounts VALUES (3, carol, 20)",
+	)
+
+	tests := []struct {
+		query string
+		want  [][]interface{}
+	}{
+		{"SELECT OWNER FROM accounts WHERE ID = 2", [][]interface{}{{"bob"}}},
+		{"SELECT owner, BALANCE FROM accounts WHERE Balance > 15", [][]interface{}{{"alice", int64(30)}, {"carol", int64(20)}}},
+		{"SELECT id FROM accounts ORDER BY BALANCE", [][]interface{}{{int64(2)}, {int64(3)}, {int64(1)}}},
+		{"SELECT id FROM accounts WHERE accounts.OWNER = carol", [][]interface{}{{int64(3)}}},
+		{"SELECT id FROM accounts WHERE owner IN (alice, bob)", [][]interface{}{{int64(1)}, {int64(2)}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			if got := queryRows(t, db, tt.query); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	mustExecute(t, db, "UPDATE accounts SET BALANCE = 99 WHERE ID = 2")
+	if got := queryRows(t, db, "SELECT balance FROM accounts WHERE id = 2"); !reflect.DeepEqual(got, [][]interface{}{{int64(99)}}) {
+		t.Errorf("balance after update = %v, want 99", got)
+	}
+	if _, err := Execute(db, "CREATE TABLE dup (id int, name text, NAME text)"); err == nil {
+		t.Error("CREATE TABLE accepted names differing only in case")
+	}
+}
+
+func TestAmbiguousColumns(t *testing.T) {
+	db := newTestDB(t,
+		"CREATE TABLE people (id int, name text, nick text)",
+		"INSERT INTO people VALUES (1, alice, Al)",
+		"INSERT INTO people VALUES (2, bob, Bo)",
+	)
+
+	// A table created before duplicates were rejected: plant "Name" next to
+	// "name" in the metadata and reopen
+	path := filepath.Join(storage.DataDir(), "metadata.json")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(strings.Replace(string(data), `"nick text"`, `"Name text"`, 1)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	storage.CloseWriters()
+	db = engine.NewDatabase()
+	if err := db.Recover(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := queryRows(t, db, "SELECT Name FROM people WHERE name = bob"), [][]interface{}{{"Bo"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("exact spellings: got %v, want %v", got, want)
+	}
+
+	tests := []struct {
+		query   string
+		wantErr string
+	}{
+		{"SELECT NAME FROM people", "ambiguous column NAME"},
+		{"SELECT id FROM people WHERE NAME = bob", "ambiguous column NAME"},
+		{"SELECT id FROM people ORDER BY NAME", "ambiguous column NAME in ORDER BY"},
+		{"UPDATE people SET NAME = x WHERE id = 1", "ambiguous column NAME"},
+		{"SELECT nick FROM people", "nick"},
+		{"SELECT id FROM people ORDER BY nick", "unknown column nick in ORDER BY"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			_, err := Execute(db, tt.query)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	// A failed UPDATE changes nothing
+	if got, want := queryRows(t, db, "SELECT name, Name FROM people WHERE id = 1"), [][]interface{}{{"alice", "Al"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("row after failed update = %v, want %v", got, want)
+	}
+}
+
+func TestUnknownColumnPerClause(t *testing.T) {
+	db := newTestDB(t,
+		"CREATE TABLE t (id int, merchant text, amount int)",
+		"INSERT INTO t VALUES (1, a, 5)",
+		"INSERT INTO t VALUES (2, b, 7)",
+	)
+
+	tests := []struct {
+		query   string
+		wantErr string
+	}{
+		{"SELECT nope FROM t", "unknown column nope in SELECT list of table t"},
+		{"SELECT id, nope FROM t WHERE id = 1", "unknown column nope in SELECT list of table t"},
+		{"SELECT id, COALESCE(nope, 0) FROM t", "unknown column nope in SELECT list of table t"},
+		{"SELECT SUM(nope) FROM t", "unknown column nope in SELECT list of table t"},
+		{"SELECT id FROM t ORDER BY nope", "unknown column nope in ORDER BY of table t"},
+		{"SELECT id FROM t WHERE id = 1 ORDER BY nope DESC LIMIT 1", "unknown column nope in ORDER BY of table t"},
+		{"SELECT merchant, COUNT(*) FROM t GROUP BY nope", "unknown column nope in GROUP BY of table t"},
+		{"SELECT nope, COUNT(*) FROM t GROUP BY merchant", "unknown column nope in SELECT list of table t"},
+		{"SELECT merchant, SUM(nope) FROM t GROUP BY merchant", "unknown column nope in SELECT list of table t"},
+		{"SELECT merchant, COUNT(*) FROM t GROUP BY merchant ORDER BY nope", "unknown column nope in ORDER BY of table t"},
+		{"SELECT merchant, COUNT(*) FROM t GROUP BY merchant ORDER BY SUM(nope) DESC", "unknown column nope in ORDER BY of table t"},
+		// A known column in the wrong place isn't reported as unknown
+		{"SELECT merchant, COUNT(*) FROM t GROUP BY merchant ORDER BY amount", "ORDER BY amount must name the GROUP BY column"},
+		{"SELECT amount, COUNT(*) FROM t GROUP BY merchant", "column amount must appear in GROUP BY"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			_, err := Execute(db, tt.query)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	// The same clauses in any case resolve
+	got := queryRows(t, db, "SELECT MERCHANT, sum(AMOUNT) AS total FROM t GROUP BY Merchant ORDER BY total DESC")
+	if want := [][]interface{}{{"b", int64(7)}, {"a", int64(5)}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("grouped rows = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,35 @@
+package parser
+
+import (
+	"fmt"
+	"pesapal-ledger/engine"
+	"strings"
+)
+
+// parseCompact parses "COMPACT TABLE name", which drops superseded row
+// versions and tombstones from one table's log
+func parseCompact(query string, db *engine.Database) (interface{}, error) {
+	fields := strings.Fields(strings.TrimSuffix(query, ";"))
+	if len(fields) != 3 || !strings.EqualFold(fields[1], "TABLE") {
+		return nil, fmt.Errorf("invalid COMPACT syntax: expected COMPACT TABLE name")
+	}
+
+	result, err := db.Compact(ident(fields[2]))
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// parseVacuum parses "VACUUM", which compacts every table in turn
+func parseVacuum(query string, db *engine.Database) (interface{}, error) {
+	if !strings.EqualFold(strings.TrimSpace(strings.TrimSuffix(query, ";")), "VACUUM") {
+		return nil, fmt.Errorf("invalid VACUUM syntax: VACUUM takes no arguments; use COMPACT TABLE name for one table")
+	}
+
+	result, err := db.Vacuum()
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
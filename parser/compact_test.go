@@ -0,0 +1,55 @@
+package parser
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"pesapal-ledger/engine"
+)
+
+func TestCompactAndVacuum(t *testing.T) {
+	db := newTestDB(t,
+		"CREATE TABLE a (id int, note text)",
+		"CREATE TABLE b (id int, note text)",
+		"INSERT INTO a VALUES (1, x)",
+		"UPDATE a SET note = y WHERE id = 1",
+		"INSERT INTO b VALUES (1, x)",
+		"INSERT INTO b VALUES (2, x)",
+		"DELETE FROM b WHERE id = 2",
+	)
+
+	compacted, ok := mustExecute(t, db, "COMPACT TABLE a").(engine.CompactResult)
+	if !ok || compacted.Table != "a" || compacted.Rows != 1 || compacted.ReclaimedBytes <= 0 {
+		t.Errorf("COMPACT TABLE a = %+v, want one row kept and bytes reclaimed", compacted)
+	}
+
+	vacuumed, ok := mustExecute(t, db, "vacuum;").(engine.VacuumResult)
+	if !ok || len(vacuumed.Tables) != 2 {
+		t.Fatalf("VACUUM = %+v, want both tables", vacuumed)
+	}
+	if a, b := vacuumed.Tables[0], vacuumed.Tables[1]; !a.Skipped || b.Skipped || b.ReclaimedBytes <= 0 {
+		t.Errorf("VACUUM = %+v, want a skipped and b compacted", vacuumed)
+	}
+	if got, want := queryRows(t, db, "SELECT id, note FROM a UNION ALL SELECT id, note FROM b"), [][]interface{}{{int64(1), "y"}, {int64(1), "x"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("rows after VACUUM = %v, want %v", got, want)
+	}
+
+	tests := []struct {
+		query   string
+		wantErr string
+	}{
+		{"VACUUM a", "VACUUM takes no arguments"},
+		{"COMPACT TABLE", "expected COMPACT TABLE name"},
+		{"COMPACT TABLE a b", "expected COMPACT TABLE name"},
+		{"COMPACT TABLE missing", "missing"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			_, err := Execute(db, tt.query)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
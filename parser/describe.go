@@ -0,0 +1,29 @@
+package parser
+
+import (
+	"fmt"
+	"pesapal-ledger/engine"
+	"strings"
+)
+
+// parseDescribe parses "DESCRIBE name", which returns the table's columns and
+// constraints, and "DESCRIBE FULL name", which returns the physical layout of
+// its records instead: every stored field in file order, including the
+// active_flag, LSN and checksum the engine adds, for reading the raw file
+func parseDescribe(query string, db *engine.Database) (interface{}, error) {
+	fields := strings.Fields(strings.TrimSuffix(strings.TrimSpace(query), ";"))
+	full := len(fields) == 3 && strings.EqualFold(fields[1], "FULL")
+	if len(fields) != 2 && !full {
+		return nil, fmt.Errorf("invalid DESCRIBE syntax: expected DESCRIBE [FULL] name")
+	}
+
+	tableName := ident(fields[len(fields)-1])
+	metadata, exists := db.Table(tableName)
+	if !exists {
+		return nil, engine.TableNotExist(tableName)
+	}
+	if full {
+		return metadata.Layout(), nil
+	}
+	return metadata.Describe(), nil
+}
@@ -0,0 +1,68 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+
+	"pesapal-ledger/engine"
+)
+
+func TestDescribe(t *testing.T) {
+	db := newTestDB(t,
+		"CREATE TABLE ledger (id int, amount int CHECK (amount >= 0), note text)",
+		"CREATE TABLE sales.orders (id int, total float) FORMAT BINARY",
+	)
+
+	tests := []struct {
+		query   string
+		table   string
+		full    bool
+		fields  []string // stored fields in order, for DESCRIBE FULL
+		wantErr string
+	}{
+		{query: "DESCRIBE ledger", table: "ledger"},
+		{query: "describe LEDGER;", wantErr: "table LEDGER does not exist"},
+		{query: "describe ledger;", table: "ledger"},
+		{query: "DESCRIBE FULL ledger", table: "ledger", full: true, fields: []string{"id", "active_flag", "amount", "note", "_lsn", "checksum"}},
+		{query: "DESCRIBE full sales.orders", table: "sales.orders", full: true, fields: []string{"id", "active_flag", "total", "_lsn", "checksum"}},
+		{query: "DESCRIBE FULL", table: "FULL", wantErr: "table FULL does not exist"},
+		{query: "DESCRIBE missing", wantErr: "table missing does not exist"},
+		{query: "DESCRIBE ledger extra", wantErr: "invalid DESCRIBE syntax"},
+		{query: "DESCRIBE FULL ledger extra", wantErr: "invalid DESCRIBE syntax"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			result, err := Execute(db, tt.query)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got %v, want an error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.full {
+				schema, ok := result.(engine.TableSchema)
+				if !ok || schema.Table != tt.table || len(schema.Columns) != 3 || schema.Columns[1].Check != "amount >= 0" {
+					t.Errorf("got %+v", result)
+				}
+				return
+			}
+			layout, ok := result.(engine.RowLayout)
+			if !ok || layout.Table != tt.table {
+				t.Fatalf("got %+v", result)
+			}
+			var names []string
+			for i, field := range layout.Fields {
+				if field.Position != i {
+					t.Errorf("field %s at position %d, want %d", field.Name, field.Position, i)
+				}
+				names = append(names, field.Name)
+			}
+			if strings.Join(names, ",") != strings.Join(tt.fields, ",") {
+				t.Errorf("fields = %v, want %v", names, tt.fields)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package parser
+
+import (
+	"fmt"
+	"pesapal-ledger/engine"
+	"pesapal-ledger/storage"
+	"strings"
+)
+
+// parseDump parses "DUMP SCHEMA" and "DUMP TABLE name". DUMP SCHEMA returns
+// the statements recreating every table; DUMP TABLE returns those of one
+// table followed by an INSERT per live row. Running the statements in order
+// through this parser rebuilds the tables.
+func parseDump(query string, db *engine.Database) (interface{}, error) {
+	fields := strings.Fields(query)
+	switch {
+	case len(fields) == 2 && strings.EqualFold(fields[1], "SCHEMA"):
+		statements := []string{}
+		for _, tableName := range db.AllTables() {
+			metadata, _ := db.Table(tableName)
+			statements = append(statements, schemaStatements(metadata)...)
+		}
+		return statements, nil
+	case len(fields) == 3 && strings.EqualFold(fields[1], "TABLE"):
+		return dumpTable(ident(fields[2]), db)
+	}
+	return nil, fmt.Errorf("invalid DUMP syntax: expected DUMP SCHEMA or DUMP TABLE name")
+}
+
+// dumpTable returns the schema statements of a table and an INSERT for each
+// live row, in disk order
+func dumpTable(tableName string, db *engine.Database) ([]string, error) {
+	metadata, exists := db.Table(tableName)
+	if !exists {
+		return nil, engine.TableNotExist(tableName)
+	}
+
+	statements := schemaStatements(metadata)
+	schema := metadata.Schema()
+	err := db.ForEachRow(tableName, func(row []string) bool {
+		statements = append(statements, insertStatement(tableName, schema, row))
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return statements, nil
+}
+
+// schemaStatements reconstructs the DDL of a table from its metadata
+func schemaStatements(metadata engine.TableMetadata) []string {
+	defs := append([]string{}, metadata.Columns...)
+	for _, expr := range metadata.Checks {
+		defs = append(defs, "CHECK ("+expr+")")
+	}
+	if len(metadata.PrimaryKey) > 0 {
+		defs = append(defs, "PRIMARY KEY ("+strings.Join(metadata.PrimaryKey, ", ")+")")
+	}
+	create := fmt.Sprintf("CREATE TABLE %s (%s)", metadata.Name, strings.Join(defs, ", "))
+	if metadata.Format == storage.FormatBinary {
+		create += " FORMAT BINARY"
+	}
+
+	statements := []string{create}
+	if metadata.Compressed {
+		statements = append(statements, fmt.Sprintf("ALTER TABLE %s SET COMPRESSION GZIP", metadata.Name))
+	}
+	return statements
+}
+
+// insertStatement renders a stored row (id, active_flag, columns...) as an INSERT
+func insertStatement(tableName string, schema []engine.Column, row []string) string {
+	values := make([]string, 0, len(schema))
+	for i, col := range schema {
+		pos := i
+		if i > 0 {
+			pos = i + 1 // skip the active_flag
+		}
+		raw := ""
+		if pos < len(row) {
+			raw = row[pos]
+		}
+		values = append(values, quoteValue(col, raw))
+	}
+	return fmt.Sprintf("INSERT INTO %s VALUES (%s)", tableName, strings.Join(values, ", "))
+}
+
+// quoteValue renders a stored value as an INSERT literal. Numbers and booleans
+// are written bare; everything else is single-quoted with quotes doubled.
+// Blobs are written decoded, since INSERT encodes them again.
+func quoteValue(col engine.Column, raw string) string {
+	if col.Type == "blob" {
+		if b, err := engine.DecodeBlob(raw); err == nil {
+			raw = string(b)
+		}
+		return "'" + strings.ReplaceAll(raw, "'", "''") + "'"
+	}
+	if _, isText := engine.TypedValue(col, raw).(string); !isText {
+		return raw
+	}
+	return "'" + strings.ReplaceAll(raw, "'", "''") + "'"
+}
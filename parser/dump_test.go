@@ -0,0 +1,70 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDumpRoundTrip(t *testing.T) {
+	tables := []struct {
+		name  string
+		table string
+		setup []string
+	}{
+		{"quoting", "users", []string{
+			"CREATE TABLE users (id int, name text, note varchar(20), vip bool)",
+			"INSERT INTO users VALUES (1, 'O''Brien', 'a,b', true)",
+			"INSERT INTO users VALUES (2, bob, 'x=y (z)', false)",
+			"INSERT INTO users VALUES (3, carol, gone, false)",
+			"DELETE FROM users WHERE id = 3",
+		}},
+		{"binary with newlines and pipes", "notes", []string{
+			"CREATE TABLE notes (id int, body text) FORMAT BINARY",
+			"INSERT INTO notes VALUES (1, 'first|second')",
+			"INSERT INTO notes VALUES (2, 'line one\nline two')",
+		}},
+		{"blob", "files", []string{
+			"CREATE TABLE files (id int, data blob)",
+			"INSERT INTO files VALUES (1, 'a|b\nc\x00d')",
+			"INSERT INTO files VALUES (2, 'it''s')",
+			"INSERT INTO files VALUES (3, '')",
+		}},
+		{"serial", "payments", []string{
+			"CREATE TABLE payments (id serial, amount float)",
+			"INSERT INTO payments VALUES (DEFAULT, 2.5)",
+			"INSERT INTO payments VALUES (DEFAULT, 10)",
+		}},
+		{"composite key", "enrollments", []string{
+			"CREATE TABLE enrollments (student int, course text, grade text, PRIMARY KEY (student, course))",
+			"INSERT INTO enrollments VALUES (7, 'CS,101', A)",
+			"INSERT INTO enrollments VALUES (7, MA201, B)",
+		}},
+		{"empty", "empty", []string{
+			"CREATE TABLE empty (id int, name text)",
+		}},
+	}
+
+	for _, tt := range tables {
+		t.Run(tt.name, func(t *testing.T) {
+			source := newTestDB(t, tt.setup...)
+			dump, ok := mustExecute(t, source, "DUMP TABLE "+tt.table).([]string)
+			if !ok {
+				t.Fatalf("DUMP TABLE result is not a statement list")
+			}
+			want := queryRows(t, source, "SELECT * FROM "+tt.table)
+
+			// Re-ingest the dump into an empty database
+			restored := newTestDB(t, dump...)
+			if got := queryRows(t, restored, "SELECT * FROM "+tt.table); !reflect.DeepEqual(got, want) {
+				t.Errorf("rows after re-ingesting the dump = %v, want %v", got, want)
+			}
+			if again := mustExecute(t, restored, "DUMP TABLE "+tt.table); !reflect.DeepEqual(again, dump) {
+				t.Errorf("dump of the restored table = %q, want %q", again, dump)
+			}
+			schema := mustExecute(t, restored, "DUMP SCHEMA")
+			if !reflect.DeepEqual(schema, dump[:1]) {
+				t.Errorf("DUMP SCHEMA = %q, want %q", schema, dump[:1])
+			}
+		})
+	}
+}
@@ -0,0 +1,240 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"pesapal-ledger/engine"
+	"strings"
+)
+
+// existsQuery is the subquery of a "[NOT] EXISTS (SELECT ... FROM inner WHERE ...)"
+// filter. Its WHERE clause holds at most one correlation, an equality between
+// a column of the inner table and one of the outer row, and any number of
+// conditions on the inner table alone, joined by AND.
+type existsQuery struct {
+	inner        string
+	innerColumns []string
+	correlated   bool
+	innerPos     int // stored position of the correlated inner column
+	innerCol     string
+	outerPos     int // stored position of the correlated outer column
+	filters      []condition
+}
+
+// splitExists splits "[NOT] EXISTS (subquery)" into the subquery and whether
+// it is negated. ok is false when the clause isn't an EXISTS.
+func splitExists(whereClause string) (subquery string, negate, ok bool, err error) {
+	clause := strings.TrimSpace(whereClause)
+	if upper := strings.ToUpper(clause); strings.HasPrefix(upper, "NOT ") {
+		negate, clause = true, strings.TrimSpace(clause[4:]) // len("NOT ")
+	}
+	upper := strings.ToUpper(clause)
+	if !strings.HasPrefix(upper, "EXISTS ") && !strings.HasPrefix(upper, "EXISTS(") {
+		return "", false, false, nil
+	}
+
+	rest := strings.TrimSpace(clause[6:]) // len("EXISTS")
+	if !strings.HasPrefix(rest, "(") {
+		return "", false, false, fmt.Errorf("invalid EXISTS: expected EXISTS (SELECT ...)")
+	}
+	idxClose, err := matchingParen(rest, 0)
+	if err != nil {
+		return "", false, false, err
+	}
+	if idxClose != len(rest)-1 {
+		return "", false, false, fmt.Errorf("invalid EXISTS: unexpected %q after the subquery", strings.TrimSpace(rest[idxClose+1:]))
+	}
+	return strings.TrimSpace(rest[1:idxClose]), negate, true, nil
+}
+
+// parseExists parses the subquery of an EXISTS filter on outer. Its select
+// list doesn't matter and is ignored.
+func parseExists(outer, subquery string, db *engine.Database) (existsQuery, error) {
+	if !strings.HasPrefix(strings.ToUpper(subquery), "SELECT ") {
+		return existsQuery{}, fmt.Errorf("invalid EXISTS: the subquery must be a SELECT")
+	}
+	idxFrom := indexKeyword(subquery, " FROM ")
+	if idxFrom == -1 {
+		return existsQuery{}, fmt.Errorf("invalid EXISTS subquery: missing FROM")
+	}
+	from := subquery[idxFrom+6:] // len(" FROM ")
+	whereClause := ""
+	if idxWhere := indexKeyword(from, " WHERE "); idxWhere != -1 {
+		whereClause = strings.TrimSpace(from[idxWhere+7:]) // len(" WHERE ")
+		from = from[:idxWhere]
+	}
+
+	q := existsQuery{inner: strings.TrimSpace(from)}
+	var err error
+	if q.innerColumns, err = db.RowColumns(q.inner); err != nil {
+		return existsQuery{}, err
+	}
+	outerColumns, err := db.RowColumns(outer)
+	if err != nil {
+		return existsQuery{}, err
+	}
+	if whereClause == "" {
+		return q, nil
+	}
+
+	for _, term := range splitAndTerms(whereClause) {
+		idx, op := -1, ""
+		for _, candidate := range exprOps {
+			if i := indexKeyword(term, candidate); i != -1 && (idx == -1 || i < idx) {
+				idx, op = i, candidate
+			}
+		}
+		if idx > 0 {
+			leftOuter, leftPos, err := q.resolveSide(strings.TrimSpace(term[:idx]), outer, outerColumns)
+			if err != nil {
+				return existsQuery{}, err
+			}
+			rightOuter, rightPos, err := q.resolveSide(strings.TrimSpace(term[idx+len(op):]), outer, outerColumns)
+			if err != nil {
+				return existsQuery{}, err
+			}
+			if leftOuter || rightOuter {
+				if op != "=" || leftOuter == rightOuter || leftPos == -1 || rightPos == -1 {
+					return existsQuery{}, fmt.Errorf("invalid EXISTS condition %q: a column of %s can only be compared with = to a column of %s", term, outer, q.inner)
+				}
+				if q.correlated {
+					return existsQuery{}, fmt.Errorf("invalid EXISTS condition %q: only one condition may refer to %s", term, outer)
+				}
+				q.correlated = true
+				if leftOuter {
+					q.outerPos, q.innerPos = leftPos, rightPos
+				} else {
+					q.outerPos, q.innerPos = rightPos, leftPos
+				}
+				q.innerCol = q.innerColumns[q.innerPos]
+				continue
+			}
+		}
+
+		cond, err := parseCondition(term, q.inner, q.innerColumns)
+		if err != nil {
+			return existsQuery{}, err
+		}
+		q.filters = append(q.filters, cond)
+	}
+	return q, nil
+}
+
+// resolveSide finds the table a side of a subquery condition refers to:
+// outer is true for a column of the outer table, and pos is the column's
+// stored position in its table, or -1 when the side isn't a column (a
+// literal). Unqualified names are looked up in the inner table first.
+func (q existsQuery) resolveSide(ref, outer string, outerColumns []string) (bool, int, error) {
+	if !strings.HasPrefix(ref, "'") && isNameRef(ref) {
+		ref = ident(ref)
+	}
+	if idxDot := strings.LastIndex(ref, "."); idxDot != -1 && !strings.HasPrefix(ref, "'") && isIdentifier(ref) {
+		qualifier, col := ref[:idxDot], ref[idxDot+1:]
+		switch {
+		case qualifies(qualifier, q.inner):
+			pos, err := engine.ResolveColumn(q.inner, q.innerColumns, col)
+			return false, pos, err
+		case qualifies(qualifier, outer):
+			pos, err := engine.ResolveColumn(outer, outerColumns, col)
+			return true, pos, err
+		}
+		return false, -1, fmt.Errorf("column reference %s matches neither %s nor %s", ref, q.inner, outer)
+	}
+	if pos, err := engine.ResolveColumn(q.inner, q.innerColumns, ref); err == nil {
+		return false, pos, nil
+	}
+	if pos, err := engine.ResolveColumn(outer, outerColumns, ref); err == nil {
+		return true, pos, nil
+	}
+	return false, -1, nil
+}
+
+// passes reports whether an inner row, typed by its columns, meets every
+// condition of the subquery besides the correlation
+func (q existsQuery) passes(row []interface{}) bool {
+	for _, cond := range q.filters {
+		if !cond.holds(row) {
+			return false
+		}
+	}
+	return true
+}
+
+// selectExists keeps the rows of outer for which the EXISTS subquery finds a
+// row (or finds none, for NOT EXISTS). It runs as a nested loop over the
+// outer rows. A correlation on the inner table's primary key is an index
+// lookup per outer row; otherwise the inner table is scanned once and the
+// values it offers are looked up per outer row. The kept rows come back in
+// primary key order, like any other WHERE.
+func selectExists(outer, subquery string, negate bool, db *engine.Database, trace *engine.Trace) ([][]string, error) {
+	q, err := parseExists(outer, subquery, db)
+	if err != nil {
+		return nil, err
+	}
+	var exists func(row []string) (bool, error)
+	if q.correlated && isKeyColumn(q.inner, q.innerCol, db) && !hasCompositeKey(q.inner, db) {
+		exists = func(row []string) (bool, error) {
+			if q.outerPos >= len(row) || row[q.outerPos] == "" {
+				return false, nil // NULL matches nothing
+			}
+			innerRow, err := db.Reader(trace).FindByID(q.inner, row[q.outerPos])
+			if errors.Is(err, engine.ErrRowNotFound) {
+				return false, nil
+			}
+			if err != nil {
+				return false, err
+			}
+			typed, err := db.TypeRows(q.inner, q.innerColumns, [][]string{innerRow})
+			if err != nil {
+				return false, err
+			}
+			return q.passes(typed[0]), nil
+		}
+	} else {
+		innerRows, err := db.Reader(trace).SelectAll(q.inner)
+		if err != nil {
+			return nil, err
+		}
+		typed, err := db.TypeRows(q.inner, q.innerColumns, innerRows)
+		if err != nil {
+			return nil, err
+		}
+		values := make(map[string]bool)
+		found := false
+		for i, innerRow := range typed {
+			if !q.passes(innerRow) {
+				continue
+			}
+			found = true
+			if q.correlated && q.innerPos < len(innerRows[i]) && innerRows[i][q.innerPos] != "" {
+				values[strings.ToLower(innerRows[i][q.innerPos])] = true
+			}
+		}
+		exists = func(row []string) (bool, error) {
+			if !q.correlated {
+				return found, nil
+			}
+			return q.outerPos < len(row) && values[strings.ToLower(row[q.outerPos])], nil
+		}
+	}
+
+	var existsErr error
+	matched, err := db.Reader(trace).SelectMatching(outer, func(row []string) bool {
+		if existsErr != nil {
+			return false
+		}
+		ok, err := exists(row)
+		if err != nil {
+			existsErr = err
+			return false
+		}
+		return ok != negate
+	})
+	if err == nil {
+		err = existsErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return matched, nil
+}
@@ -0,0 +1,78 @@
+package parser
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExists(t *testing.T) {
+	// Accounts go in out of key order; account 4 has no owner
+	db := newTestDB(t,
+		"CREATE TABLE accounts (id int, name text, owner int)",
+		"CREATE TABLE txns (id int, account_id int, status text)",
+		"CREATE TABLE owners (id int, name text)",
+		"INSERT INTO accounts VALUES (3, c, 1)",
+		"INSERT INTO accounts VALUES (1, a, 2)",
+		"INSERT INTO accounts VALUES (2, b, 9)",
+		"INSERT INTO accounts VALUES (4, d, )",
+		"INSERT INTO txns VALUES (10, 1, done)",
+		"INSERT INTO txns VALUES (11, 3, pending)",
+		"INSERT INTO txns VALUES (12, 3, done)",
+		"INSERT INTO owners VALUES (1, x)",
+		"INSERT INTO owners VALUES (2, y)",
+	)
+
+	tests := []struct {
+		where      string
+		want       [][]interface{}
+		accessPath string // the inner table's access path
+	}{
+		{"EXISTS (SELECT 1 FROM txns WHERE txns.account_id = accounts.id)", [][]interface{}{{int64(1)}, {int64(3)}}, "full scan of txns"},
+		{"NOT EXISTS (SELECT 1 FROM txns WHERE txns.account_id = accounts.id)", [][]interface{}{{int64(2)}, {int64(4)}}, "full scan of txns"},
+		{"EXISTS (SELECT 1 FROM txns WHERE txns.account_id = accounts.id AND status = 'pending')", [][]interface{}{{int64(3)}}, "full scan of txns"},
+		{"NOT EXISTS (SELECT 1 FROM txns WHERE account_id = accounts.id AND status = 'done')", [][]interface{}{{int64(2)}, {int64(4)}}, "full scan of txns"},
+		// A correlation on the inner key looks each outer row up; the
+		// account with no owner matches nothing
+		{"EXISTS (SELECT 1 FROM owners WHERE owners.id = accounts.owner)", [][]interface{}{{int64(1)}, {int64(3)}}, "index lookup on owners.id"},
+		{"NOT EXISTS (SELECT * FROM owners WHERE accounts.owner = owners.id)", [][]interface{}{{int64(2)}, {int64(4)}}, "index lookup on owners.id"},
+		// Uncorrelated subqueries keep every row or none
+		{"EXISTS (SELECT 1 FROM txns)", [][]interface{}{{int64(1)}, {int64(2)}, {int64(3)}, {int64(4)}}, "full scan of txns"},
+		{"EXISTS (SELECT 1 FROM txns WHERE status = 'void')", [][]interface{}{}, "full scan of txns"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.where, func(t *testing.T) {
+			query := "SELECT id FROM accounts WHERE " + tt.where
+			if got := queryRows(t, db, query); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+			plan := mustExecute(t, db, "EXPLAIN ANALYZE "+query).(map[string]interface{})
+			paths := plan["accessPaths"].([]string)
+			found := false
+			for _, path := range paths {
+				found = found || path == tt.accessPath
+			}
+			if !found {
+				t.Errorf("access paths = %v, want %q among them", paths, tt.accessPath)
+			}
+		})
+	}
+
+	errTests := []struct {
+		where   string
+		wantErr string
+	}{
+		{"EXISTS (SELECT 1 FROM txns WHERE txns.account_id > accounts.id)", "can only be compared with ="},
+		{"EXISTS (SELECT 1 FROM nope WHERE nope.a = accounts.id)", "table nope does not exist"},
+		{"EXISTS SELECT 1 FROM txns", "expected EXISTS (SELECT ...)"},
+		{"EXISTS (SELECT 1 FROM txns) AND id = 1", `unexpected "AND id = 1" after the subquery`},
+	}
+	for _, tt := range errTests {
+		t.Run(tt.where, func(t *testing.T) {
+			_, err := Execute(db, "SELECT id FROM accounts WHERE "+tt.where)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,353 @@
+package parser
+
+import (
+	"fmt"
+	"pesapal-ledger/engine"
+	"strings"
+)
+
+// expr is a projection expression evaluated against one typed row
+type expr interface {
+	eval(row []interface{}) interface{}
+}
+
+// columnExpr reads a column of the row
+type columnExpr struct{ pos int }
+
+func (e columnExpr) eval(row []interface{}) interface{} {
+	if e.pos < len(row) {
+		return row[e.pos]
+	}
+	return nil
+}
+
+// literalExpr is a constant
+type literalExpr struct{ value interface{} }
+
+func (e literalExpr) eval([]interface{}) interface{} { return e.value }
+
+// coalesceExpr returns its first non-null argument
+type coalesceExpr struct{ args []expr }
+
+func (e coalesceExpr) eval(row []interface{}) interface{} {
+	for _, arg := range e.args {
+		if v := arg.eval(row); !isNull(v) {
+			return v
+		}
+	}
+	return nil
+}
+
+// caseExpr is "CASE WHEN cond THEN x ... [ELSE y] END"
+type caseExpr struct {
+	whens []whenClause
+	other expr // nil when there is no ELSE
+}
+
+type whenClause struct {
+	cond condition
+	then expr
+}
+
+func (e caseExpr) eval(row []interface{}) interface{} {
+	for _, when := range e.whens {
+		if when.cond.holds(row) {
+			return when.then.eval(row)
+		}
+	}
+	if e.other != nil {
+		return e.other.eval(row)
+	}
+	return nil
+}
+
+// condition is "a op b", "a IS NULL" or "a IS NOT NULL"
+type condition struct {
+	left, right expr
+	op          string // a comparison operator, "IS NULL" or "IS NOT NULL"
+}
+
+func (c condition) holds(row []interface{}) bool {
+	left := c.left.eval(row)
+	switch c.op {
+	case "IS NULL":
+		return isNull(left)
+	case "IS NOT NULL":
+		return !isNull(left)
+	}
+
+	right := c.right.eval(row)
+	if isNull(left) || isNull(right) {
+		return false // comparisons with NULL are never true
+	}
+	if c.op == "=" || c.op == "<>" || c.op == "!=" {
+		equal := literalsEqual(left, right)
+		return equal == (c.op == "=")
+	}
+
+	cmp := engine.CompareValues(left, right)
+	switch c.op {
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	}
+	return cmp >= 0
+}
+
+// isNull reports whether a value counts as NULL; empty stored values do
+func isNull(v interface{}) bool {
+	return v == nil || v == ""
+}
+
+// exprOps are the comparison operators of a condition, longest first
+var exprOps = []string{">=", "<=", "<>", "!=", "=", "<", ">"}
+
+// hasExpressions reports whether a select list needs the expression evaluator
+// rather than plain column projection
+func hasExpressions(list string) bool {
+	for _, item := range splitTopLevel(list, ',') {
+		item = strings.TrimSpace(item)
+		for _, c := range item {
+			if !(c == '_' || c == '.' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z') {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parseSelectExprs parses "SELECT expr [AS alias], ... FROM t [WHERE ...]"
+// where each expr is a column, a literal, COALESCE(a, b, ...),
+// JSON_EXTRACT(value, path) or CASE WHEN cond THEN x [WHEN ...] [ELSE y] END.
+// Expressions are evaluated per row; empty values count as NULL.
+func parseSelectExprs(query string, db *engine.Database, trace *engine.Trace) (interface{}, error) {
+	upper := strings.ToUpper(query)
+	idxFrom := strings.Index(upper, " FROM ")
+	if idxFrom == -1 {
+		return nil, fmt.Errorf("invalid SELECT syntax: missing FROM")
+	}
+	fromPart := strings.TrimSpace(query[idxFrom+1:])
+	tableName := fromTableName(fromPart)
+
+	columns, err := db.RowColumns(tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	var exprs []expr
+	for _, item := range splitTopLevel(query[7:idxFrom], ',') { // len("SELECT ")
+		text, _ := splitAlias(strings.TrimSpace(item))
+		if text == "" {
+			return nil, fmt.Errorf("invalid SELECT syntax: empty select item")
+		}
+		e, err := parseExpr(text, tableName, columns)
+		if err != nil {
+			return nil, engine.InClause(err, "SELECT list")
+		}
+		exprs = append(exprs, e)
+	}
+
+	_, rows, err := selectRows("SELECT * "+fromPart, db, trace)
+	if err != nil {
+		return nil, err
+	}
+	start := trace.Start()
+	defer trace.Stop(engine.StageProject, start)
+	typed, err := db.TypeRows(tableName, columns, rows)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([][]interface{}, 0, len(typed))
+	for _, row := range typed {
+		out := make([]interface{}, len(exprs))
+		for i, e := range exprs {
+			out[i] = e.eval(row)
+		}
+		result = append(result, out)
+	}
+	return result, nil
+}
+
+// parseExpr parses a projection expression over the stored row columns
+func parseExpr(text, tableName string, columns []string) (expr, error) {
+	text = strings.TrimSpace(text)
+	upper := strings.ToUpper(text)
+
+	switch {
+	case strings.HasPrefix(upper, "COALESCE(") || strings.HasPrefix(upper, "COALESCE ("):
+		idxOpen := strings.Index(text, "(")
+		idxClose, err := matchingParen(text, idxOpen)
+		if err != nil || idxClose != len(text)-1 {
+			return nil, fmt.Errorf("invalid COALESCE expression %s", text)
+		}
+		if strings.TrimSpace(text[idxOpen+1:idxClose]) == "" {
+			return nil, fmt.Errorf("invalid COALESCE expression %s: expected at least one argument", text)
+		}
+		var args []expr
+		for _, raw := range splitTopLevel(text[idxOpen+1:idxClose], ',') {
+			arg, err := parseExpr(raw, tableName, columns)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+		}
+		return coalesceExpr{args: args}, nil
+
+	case strings.HasPrefix(upper, "JSON_EXTRACT(") || strings.HasPrefix(upper, "JSON_EXTRACT ("):
+		idxOpen := strings.Index(text, "(")
+		idxClose, err := matchingParen(text, idxOpen)
+		if err != nil || idxClose != len(text)-1 {
+			return nil, fmt.Errorf("invalid JSON_EXTRACT expression %s", text)
+		}
+		args := splitTopLevel(text[idxOpen+1:idxClose], ',')
+		if len(args) != 2 {
+			return nil, fmt.Errorf("invalid JSON_EXTRACT expression %s: expected json_extract(value, path)", text)
+		}
+		doc, err := parseExpr(args[0], tableName, columns)
+		if err != nil {
+			return nil, err
+		}
+		path, err := parseExpr(args[1], tableName, columns)
+		if err != nil {
+			return nil, err
+		}
+		return jsonExtractExpr{doc: doc, path: path}, nil
+
+	case strings.HasPrefix(upper, "CASE "):
+		return parseCase(text, tableName, columns)
+
+	case upper == "NULL":
+		return literalExpr{value: nil}, nil
+
+	case strings.HasPrefix(text, "'"):
+		if len(text) < 2 || !strings.HasSuffix(text, "'") {
+			return nil, fmt.Errorf("unterminated quoted value %s", text)
+		}
+		return literalExpr{value: strings.ReplaceAll(text[1:len(text)-1], "''", "'")}, nil
+	}
+
+	if value := literalValue(text); value != text {
+		return literalExpr{value: value}, nil // number or boolean
+	}
+
+	col, err := unqualifyColumn(text, tableName)
+	if err != nil {
+		return nil, err
+	}
+	pos, err := engine.ResolveColumn(tableName, columns, col)
+	if err != nil {
+		return nil, err
+	}
+	return columnExpr{pos: pos}, nil
+}
+
+// parseCase parses "CASE WHEN cond THEN x [WHEN cond THEN y ...] [ELSE z] END"
+func parseCase(text, tableName string, columns []string) (expr, error) {
+	if !strings.HasSuffix(strings.ToUpper(text), " END") {
+		return nil, fmt.Errorf("invalid CASE expression: missing END")
+	}
+	body := strings.TrimSpace(text[5 : len(text)-4]) // len("CASE "), len(" END")
+
+	var e caseExpr
+	for {
+		if !strings.HasPrefix(strings.ToUpper(body), "WHEN ") {
+			return nil, fmt.Errorf("invalid CASE expression: expected WHEN")
+		}
+		body = body[5:] // len("WHEN ")
+
+		idxThen := indexKeyword(body, " THEN ")
+		if idxThen == -1 {
+			return nil, fmt.Errorf("invalid CASE expression: WHEN without THEN")
+		}
+		cond, err := parseCondition(body[:idxThen], tableName, columns)
+		if err != nil {
+			return nil, err
+		}
+		body = body[idxThen+6:] // len(" THEN ")
+
+		// The THEN branch runs to the next WHEN, the ELSE or the end
+		end, next := len(body), ""
+		if idx := indexKeyword(body, " WHEN "); idx != -1 {
+			end, next = idx, "WHEN"
+		}
+		if idx := indexKeyword(body, " ELSE "); idx != -1 && idx < end {
+			end, next = idx, "ELSE"
+		}
+		then, err := parseExpr(body[:end], tableName, columns)
+		if err != nil {
+			return nil, err
+		}
+		e.whens = append(e.whens, whenClause{cond: cond, then: then})
+
+		switch next {
+		case "WHEN":
+			body = strings.TrimSpace(body[end:])
+			continue
+		case "ELSE":
+			if e.other, err = parseExpr(body[end+6:], tableName, columns); err != nil { // len(" ELSE ")
+				return nil, err
+			}
+		}
+		return e, nil
+	}
+}
+
+// parseCondition parses "a op b", "a IS NULL" or "a IS NOT NULL"
+func parseCondition(text, tableName string, columns []string) (condition, error) {
+	text = strings.TrimSpace(text)
+	upper := strings.ToUpper(text)
+	for _, suffix := range []string{" IS NOT NULL", " IS NULL"} {
+		if strings.HasSuffix(upper, suffix) {
+			left, err := parseExpr(text[:len(text)-len(suffix)], tableName, columns)
+			if err != nil {
+				return condition{}, err
+			}
+			return condition{left: left, op: strings.TrimSpace(suffix)}, nil
+		}
+	}
+
+	idx, op := -1, ""
+	for _, candidate := range exprOps {
+		if i := indexKeyword(text, candidate); i != -1 && (idx == -1 || i < idx) {
+			idx, op = i, candidate
+		}
+	}
+	if idx <= 0 {
+		return condition{}, fmt.Errorf("invalid condition %q: expected 'a op b', 'a IS NULL' or 'a IS NOT NULL'", text)
+	}
+
+	left, err := parseExpr(text[:idx], tableName, columns)
+	if err != nil {
+		return condition{}, err
+	}
+	right, err := parseExpr(text[idx+len(op):], tableName, columns)
+	if err != nil {
+		return condition{}, err
+	}
+	return condition{left: left, right: right, op: op}, nil
+}
+
+// indexKeyword finds a keyword or operator case-insensitively, skipping text
+// inside parentheses and single quotes. It returns -1 when there is none.
+func indexKeyword(s, keyword string) int {
+	upper := strings.ToUpper(s)
+	depth, inQuote := 0, false
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\'':
+			inQuote = !inQuote
+		case inQuote:
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case depth == 0 && strings.HasPrefix(upper[i:], keyword):
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,62 @@
+package parser
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSelectExpressions(t *testing.T) {
+	db := newTestDB(t,
+		"CREATE TABLE users (id int, name text, nickname text, age int)",
+		"INSERT INTO users VALUES (1, alice, ally, 30)",
+		"INSERT INTO users VALUES (2, bob, '', 15)",
+		"INSERT INTO users VALUES (3, carol, '', 70)",
+	)
+
+	tests := []struct {
+		name  string
+		query string
+		want  [][]interface{}
+	}{
+		{"COALESCE falls back on NULL", "SELECT id, COALESCE(nickname, name) FROM users",
+			[][]interface{}{{int64(1), "ally"}, {int64(2), "bob"}, {int64(3), "carol"}}},
+		{"COALESCE with a literal", "SELECT COALESCE(nickname, 'anon') AS nick FROM users",
+			[][]interface{}{{"ally"}, {"anon"}, {"anon"}}},
+		{"COALESCE of NULLs only", "SELECT COALESCE(nickname, NULL) FROM users",
+			[][]interface{}{{"ally"}, {nil}, {nil}}},
+		{"COALESCE of several", "SELECT COALESCE(NULL, nickname, name, 'x') FROM users WHERE id = 2",
+			[][]interface{}{{"bob"}}},
+		{"two-branch CASE", "SELECT id, CASE WHEN age >= 18 THEN 'adult' ELSE 'minor' END FROM users",
+			[][]interface{}{{int64(1), "adult"}, {int64(2), "minor"}, {int64(3), "adult"}}},
+		{"CASE without ELSE", "SELECT CASE WHEN age >= 18 THEN 'adult' END AS kind FROM users",
+			[][]interface{}{{"adult"}, {nil}, {"adult"}}},
+		{"first true branch wins", "SELECT CASE WHEN age > 60 THEN 'senior' WHEN age >= 18 THEN 'adult' ELSE 'minor' END FROM users",
+			[][]interface{}{{"adult"}, {"minor"}, {"senior"}}},
+		{"CASE on IS NULL", "SELECT CASE WHEN nickname IS NULL THEN name ELSE nickname END FROM users",
+			[][]interface{}{{"ally"}, {"bob"}, {"carol"}}},
+		{"CASE inside COALESCE", "SELECT COALESCE(CASE WHEN age < 18 THEN 'minor' END, name) FROM users",
+			[][]interface{}{{"alice"}, {"minor"}, {"carol"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := queryRows(t, db, tt.query); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	errorTests := []struct {
+		query   string
+		wantErr string
+	}{
+		{"SELECT COALESCE(missing, name) FROM users", "unknown column missing"},
+		{"SELECT COALESCE() FROM users", "expected at least one argument"},
+		{"SELECT CASE age >= 18 THEN 1 END FROM users", "expected WHEN"},
+	}
+	for _, tt := range errorTests {
+		if _, err := Execute(db, tt.query); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: got %v, want an error containing %q", tt.query, err, tt.wantErr)
+		}
+	}
+}
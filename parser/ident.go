@@ -0,0 +1,101 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Table and column names may be quoted with double quotes or backticks
+// ("order", `select`) to use a reserved word, or characters other than
+// letters, digits and underscores, as a name. The quotes stay in the query
+// while it is parsed, so a quoted keyword is never mistaken for the keyword
+// itself (the parser looks for " FROM " and the like), and are stripped
+// where a name is read (see ident). The stored name is the unquoted one.
+
+// identUnsafe are the characters a quoted name can't hold: whitespace and
+// the punctuation statements are split on, the storage field separator, and
+// path separators. Dots separate a schema from its table, so a qualified
+// name quotes each part ("sales"."order").
+const identUnsafe = " \t\r\n,;()='|./\\"
+
+// checkQuotes rejects a quoted name that is unterminated, empty or holds a
+// character it can't, and a single-quoted value that is never closed.
+func checkQuotes(query string) error {
+	inValue := false
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == '\'':
+			inValue = !inValue
+		case inValue:
+		case c == '"' || c == '`':
+			end := strings.IndexByte(query[i+1:], c)
+			if end == -1 {
+				return fmt.Errorf("unterminated quoted identifier %s", query[i:])
+			}
+			name := query[i+1 : i+1+end]
+			if name == "" {
+				return fmt.Errorf("empty quoted identifier")
+			}
+			for _, r := range name {
+				if r < ' ' || strings.ContainsRune(identUnsafe, r) {
+					return fmt.Errorf("invalid quoted identifier %c%s%c: it can't contain %q", c, name, c, r)
+				}
+			}
+			i += end + 1
+		}
+	}
+	if inValue {
+		return fmt.Errorf("unterminated quoted value %s", query[strings.LastIndexByte(query, '\''):])
+	}
+	return nil
+}
+
+// isQuoted reports whether a name part is wrapped in identifier quotes
+func isQuoted(part string) bool {
+	return len(part) >= 2 && (part[0] == '"' || part[0] == '`') && part[len(part)-1] == part[0]
+}
+
+// ident strips the quotes from each part of a possibly qualified name
+func ident(name string) string {
+	name = strings.TrimSpace(name)
+	if !strings.ContainsAny(name, "\"`") {
+		return name
+	}
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		if isQuoted(part) {
+			parts[i] = part[1 : len(part)-1]
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+// isNameRef reports whether a word is a table or column reference: parts
+// separated by dots, each quoted or a plain identifier
+func isNameRef(word string) bool {
+	for _, part := range strings.Split(word, ".") {
+		if !isQuoted(part) && !isIdentifier(part) {
+			return false
+		}
+	}
+	return word != ""
+}
+
+// checkTableName checks the name of a new table: each unquoted part may only
+// use letters, digits and underscores. Quoted parts were checked by
+// checkQuotes, and the engine checks the whole name again so it can't leave
+// the data directory.
+func checkTableName(name string) error {
+	for _, part := range strings.Split(name, ".") {
+		if isQuoted(part) {
+			continue
+		}
+		for _, c := range part {
+			if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+				return fmt.Errorf("invalid table name %s: unexpected character %q (quote the name to use it)", name, c)
+			}
+		}
+	}
+	return nil
+}
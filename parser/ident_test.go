@@ -0,0 +1,83 @@
+package parser
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestQuotedIdentifiers(t *testing.T) {
+	db := newTestDB(t,
+		"CREATE TABLE \"order\" (id int, \"select\" text, `from` int)",
+		`INSERT INTO "order" VALUES (1, a, 10)`,
+		"INSERT INTO `order` VALUES (2, b, 20)",
+		`INSERT INTO "order" VALUES (3, c, 30)`,
+		`CREATE TABLE "sales"."order" (id int, "where" text)`,
+		`INSERT INTO "sales"."order" VALUES (1, x)`,
+	)
+
+	// The quotes aren't part of the stored names
+	if cols := db.Tables["order"].Columns; !reflect.DeepEqual(cols, []string{"id int", "select text", "from int"}) {
+		t.Errorf("stored columns = %q", cols)
+	}
+	if got := mustExecute(t, db, "SHOW TABLES"); !reflect.DeepEqual(got, []string{"order", "sales.order"}) {
+		t.Errorf("SHOW TABLES = %v", got)
+	}
+
+	tests := []struct {
+		query string
+		want  [][]interface{}
+	}{
+		{`SELECT "select" FROM "order"`, [][]interface{}{{"a"}, {"b"}, {"c"}}},
+		{"SELECT `select`, \"from\" FROM `order` WHERE \"from\" > 10", [][]interface{}{{"b", int64(20)}, {"c", int64(30)}}},
+		{`SELECT "order"."select" FROM "order" WHERE "order".id = 2`, [][]interface{}{{"b"}}},
+		{`SELECT "select" FROM "order" WHERE "select" = a`, [][]interface{}{{"a"}}},
+		{`SELECT "select" FROM "order" ORDER BY "from" DESC LIMIT 2`, [][]interface{}{{"c"}, {"b"}}},
+		{`SELECT "select", COUNT(*) FROM "order" GROUP BY "select" ORDER BY "select"`, [][]interface{}{{"a", int64(1)}, {"b", int64(1)}, {"c", int64(1)}}},
+		{`SELECT "Select" FROM "order" WHERE id = 1`, [][]interface{}{{"a"}}},
+		// Single quotes are still a value, not a name
+		{`SELECT 'select' FROM "order" WHERE id = 1`, [][]interface{}{{"select"}}},
+		{`SELECT id FROM "order" WHERE "select" = 'a "quoted" value'`, [][]interface{}{}},
+		// An unquoted name is the same table
+		{"SELECT id FROM order WHERE id = 3", [][]interface{}{{int64(3)}}},
+		{`SELECT "where" FROM "sales"."order"`, [][]interface{}{{"x"}}},
+		{`SELECT "where" FROM sales."order" WHERE "where" = x`, [][]interface{}{{"x"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			if got := queryRows(t, db, tt.query); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	mustExecute(t, db, `UPDATE "order" SET "select" = z WHERE id = 1`)
+	mustExecute(t, db, "DELETE FROM `order` WHERE id = 2")
+	if got, want := queryRows(t, db, `SELECT id, "select" FROM "order" ORDER BY id`), [][]interface{}{{int64(1), "z"}, {int64(3), "c"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after UPDATE and DELETE = %v, want %v", got, want)
+	}
+
+	errTests := []struct {
+		query   string
+		wantErr string
+	}{
+		{`CREATE TABLE "my order" (id int)`, `invalid quoted identifier "my order": it can't contain ' '`},
+		{`CREATE TABLE "a/b" (id int)`, `it can't contain '/'`},
+		{`CREATE TABLE "..x" (id int)`, `it can't contain '.'`},
+		{"CREATE TABLE `a\\b` (id int)", `it can't contain '\\'`},
+		{`CREATE TABLE "a|b" (id int)`, `it can't contain '|'`},
+		{`CREATE TABLE "" (id int)`, "empty quoted identifier"},
+		{`CREATE TABLE "order (id int)`, "unterminated quoted identifier"},
+		{`SELECT id FROM "order" WHERE "select" = 'a`, "unterminated quoted value"},
+		{"CREATE TABLE my-order (id int)", "quote the name to use it"},
+		{`SELECT "nope" FROM "order"`, "unknown column nope"},
+	}
+	for _, tt := range errTests {
+		t.Run(tt.query, func(t *testing.T) {
+			_, err := Execute(db, tt.query)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
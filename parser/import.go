@@ -0,0 +1,38 @@
+package parser
+
+import (
+	"fmt"
+	"pesapal-ledger/engine"
+	"strings"
+)
+
+// parseImport parses "IMPORT INTO name VALUES (id, active_flag, ...), ...".
+// Unlike INSERT, each row gives its active_flag: 1 for a live row, 0 for one
+// deleted in the system the data comes from. Meant for migrations only.
+func parseImport(query string, db *engine.Database) (interface{}, error) {
+	rest := strings.TrimSpace(query[11:]) // len("IMPORT INTO")
+	idx := strings.Index(strings.ToUpper(rest), " VALUES ")
+	if idx == -1 {
+		return nil, fmt.Errorf("invalid IMPORT syntax: expected IMPORT INTO name VALUES (id, active_flag, ...), ...")
+	}
+	tableName := ident(rest[:idx])
+
+	var rows [][]string
+	for i, raw := range splitTopLevel(rest[idx+8:], ',') { // len(" VALUES ")
+		tuple := strings.TrimSpace(raw)
+		if !strings.HasPrefix(tuple, "(") || !strings.HasSuffix(tuple, ")") {
+			return nil, fmt.Errorf("invalid VALUES syntax: row %d must be enclosed in ()", i+1)
+		}
+		values, err := splitValues(tuple[1 : len(tuple)-1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid VALUES syntax in row %d: %w", i+1, err)
+		}
+		rows = append(rows, values)
+	}
+
+	result, err := db.ImportRows(tableName, rows)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
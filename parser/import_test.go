@@ -0,0 +1,124 @@
+package parser
+
+import (
+	"fmt"
+	"pesapal-ledger/engine"
+	"pesapal-ledger/storage"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestImportActiveFlag(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   []string
+		imports string
+		result  engine.ImportResult
+		want    [][]interface{} // live rows, by key
+	}{
+		{
+			name:    "mix of live and deleted rows",
+			imports: "IMPORT INTO txns VALUES (101, 1, Starbucks, 550), (102, 0, Uber, 1200), (103, 1, 'Java, House', 300)",
+			result:  engine.ImportResult{Table: "txns", Active: 2, Deleted: 1},
+			want:    [][]interface{}{{int64(101), "Starbucks", int64(550)}, {int64(103), "Java, House", int64(300)}},
+		},
+		{
+			name:    "a later row replaces an earlier one",
+			imports: "IMPORT INTO txns VALUES (101, 1, Starbucks, 550), (101, 1, Starbucks, 600), (102, 1, Uber, 1200), (102, 0, Uber, 1200)",
+			result:  engine.ImportResult{Table: "txns", Active: 3, Deleted: 1},
+			want:    [][]interface{}{{int64(101), "Starbucks", int64(600)}},
+		},
+		{
+			name:    "a tombstone deletes an existing row",
+			setup:   []string{"INSERT INTO txns VALUES (100, Bolt, 70)"},
+			imports: "IMPORT INTO txns VALUES (100, 0, Bolt, 70), (104, 1, KFC, 90)",
+			result:  engine.ImportResult{Table: "txns", Active: 1, Deleted: 1},
+			want:    [][]interface{}{{int64(104), "KFC", int64(90)}},
+		},
+		{
+			name:    "only deleted rows",
+			imports: "import into txns values (101, 0, Starbucks, 550)",
+			result:  engine.ImportResult{Table: "txns", Active: 0, Deleted: 1},
+			want:    [][]interface{}{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t, append([]string{"CREATE TABLE txns (id int, merchant text, amount int)"}, tt.setup...)...)
+
+			if got := mustExecute(t, db, tt.imports); !reflect.DeepEqual(got, tt.result) {
+				t.Fatalf("result = %+v, want %+v", got, tt.result)
+			}
+
+			check := func(db *engine.Database) {
+				t.Helper()
+				if got := queryRows(t, db, "SELECT id, merchant, amount FROM txns WHERE id >= 0 ORDER BY id"); !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("rows = %v, want %v", got, tt.want)
+				}
+				// The index holds only the live rows
+				if infos := mustExecute(t, db, "SHOW INDEXES FROM txns").([]engine.IndexInfo); infos[0].Entries != len(tt.want) {
+					t.Errorf("index entries = %d, want %d", infos[0].Entries, len(tt.want))
+				}
+				for _, id := range []string{"100", "102"} {
+					if _, err := db.FindByID("txns", id); err == nil && !hasID(tt.want, id) {
+						t.Errorf("deleted row %s is still indexed", id)
+					}
+				}
+			}
+			check(db)
+
+			// Recovery rebuilds the same index from the imported log
+			storage.CloseWriters()
+			restarted := engine.NewDatabase()
+			if err := restarted.Recover(); err != nil {
+				t.Fatal(err)
+			}
+			check(restarted)
+		})
+	}
+}
+
+// hasID reports whether rows holds a row whose first value is id
+func hasID(rows [][]interface{}, id string) bool {
+	for _, row := range rows {
+		if fmt.Sprint(row[0]) == id {
+			return true
+		}
+	}
+	return false
+}
+
+func TestImportErrors(t *testing.T) {
+	db := newTestDB(t,
+		"CREATE TABLE txns (id int, merchant text, amount int)",
+		"INSERT INTO txns VALUES (1, Bolt, 70)",
+	)
+
+	tests := []struct {
+		query   string
+		wantErr string
+	}{
+		{"IMPORT INTO txns VALUES (2, Uber, 100)", "import row 1 has 3 values, expected 4"},
+		{"IMPORT INTO txns VALUES (2, 1, Uber, 100), (3, 2, Uber, 100)", "import row 2: active_flag must be 1 or 0"},
+		{"IMPORT INTO txns VALUES ('', 1, Uber, 100)", "import row 1: id is required"},
+		{"IMPORT INTO txns VALUES (abc, 1, Uber, 100)", "import row 1"},
+		{"IMPORT INTO txns VALUES (2, 1, Uber, lots)", "expected int"},
+		{"IMPORT INTO txns VALUES 2, 1, Uber, 100", "must be enclosed in ()"},
+		{"IMPORT INTO txns (2, 1, Uber, 100)", "invalid IMPORT syntax"},
+		{"IMPORT INTO missing VALUES (2, 1, Uber, 100)", "does not exist"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			_, err := Execute(db, tt.query)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	// Nothing is written when any row is invalid
+	if rows := queryRows(t, db, "SELECT id FROM txns"); len(rows) != 1 {
+		t.Errorf("rows after the failed imports = %v", rows)
+	}
+}
@@ -0,0 +1,115 @@
+package parser
+
+import (
+	"fmt"
+	"pesapal-ledger/engine"
+	"strings"
+)
+
+// parseShowTables parses "SHOW TABLES", which lists the user tables, and
+// "SHOW TABLES INCLUDING SYSTEM", which adds the system tables. "SHOW TABLES
+// WITH SCHEMA" lists the user tables with their columns and constraints, so a
+// schema browser needs one call.
+func parseShowTables(query string, db *engine.Database) (interface{}, error) {
+	fields := strings.Fields(query)
+	switch {
+	case len(fields) == 2:
+		return db.ListTables(), nil
+	case len(fields) == 4 && strings.EqualFold(fields[2], "INCLUDING") && strings.EqualFold(fields[3], "SYSTEM"):
+		return db.AllTables(), nil
+	case len(fields) == 4 && strings.EqualFold(fields[2], "WITH") && strings.EqualFold(fields[3], "SCHEMA"):
+		return tableSchemas(db), nil
+	}
+	return nil, fmt.Errorf("invalid SHOW TABLES syntax: expected SHOW TABLES [INCLUDING SYSTEM | WITH SCHEMA]")
+}
+
+// tableSchemas describes every user table, for "SHOW TABLES WITH SCHEMA"
+func tableSchemas(db *engine.Database) []engine.TableSchema {
+	schemas := []engine.TableSchema{}
+	for _, tableName := range db.ListTables() {
+		if metadata, exists := db.Table(tableName); exists { // unless dropped since it was listed
+			schemas = append(schemas, metadata.Describe())
+		}
+	}
+	return schemas
+}
+
+// parseShowTableSize parses "SHOW TABLE SIZE name" and reports the table
+// file's size on disk and how much of it is live and dead
+func parseShowTableSize(query string, db *engine.Database) (interface{}, error) {
+	fields := strings.Fields(query)
+	if len(fields) != 4 {
+		return nil, fmt.Errorf("invalid SHOW TABLE SIZE syntax: expected SHOW TABLE SIZE name")
+	}
+	return db.TableSize(ident(strings.TrimSuffix(fields[3], ";")))
+}
+
+// parseShowIndexes parses "SHOW INDEXES" and "SHOW INDEXES FROM name" (INDEX
+// works too) and lists the indexes with their columns and uniqueness
+func parseShowIndexes(query string, db *engine.Database) (interface{}, error) {
+	fields := strings.Fields(query)
+	if !strings.EqualFold(fields[1], "INDEXES") && !strings.EqualFold(fields[1], "INDEX") {
+		return nil, fmt.Errorf("unknown or unsupported command")
+	}
+	switch {
+	case len(fields) == 2:
+		return db.IndexInfos("")
+	case len(fields) == 4 && strings.EqualFold(fields[2], "FROM"):
+		return db.IndexInfos(ident(fields[3]))
+	}
+	return nil, fmt.Errorf("invalid SHOW INDEXES syntax: expected SHOW INDEXES [FROM name]")
+}
+
+// parseDropIndex parses "DROP INDEX ON name (col, ...)" and "DROP INDEX name".
+// The only indexes are the primary key ones, which can't be dropped, so this
+// reports why the named index can't go. Secondary indexes don't exist yet.
+func parseDropIndex(query string, db *engine.Database) (interface{}, error) {
+	rest := strings.TrimSpace(query[10:]) // len("DROP INDEX")
+
+	if len(rest) > 3 && strings.EqualFold(rest[:3], "ON ") {
+		target := strings.TrimSpace(rest[3:])
+		idxOpen := strings.Index(target, "(")
+		if idxOpen == -1 || !strings.HasSuffix(target, ")") {
+			return nil, fmt.Errorf("invalid DROP INDEX syntax: expected DROP INDEX ON name (col, ...)")
+		}
+		tableName := strings.TrimSpace(target[:idxOpen])
+		columns, err := parseColumnList(target[idxOpen+1:len(target)-1], tableName)
+		if err != nil {
+			return nil, err
+		}
+
+		indexes, err := db.IndexInfos(tableName)
+		if err != nil {
+			return nil, err
+		}
+		for _, index := range indexes {
+			if index.Primary && sameColumns(index.Columns, columns) {
+				return nil, fmt.Errorf("cannot drop the primary key index of table %s", tableName)
+			}
+		}
+		return nil, fmt.Errorf("index on %s (%s) does not exist", tableName, strings.Join(columns, ", "))
+	}
+
+	name := rest
+	if name == "" || strings.ContainsAny(name, " \t") {
+		return nil, fmt.Errorf("invalid DROP INDEX syntax: expected DROP INDEX name or DROP INDEX ON name (col, ...)")
+	}
+	if strings.EqualFold(name, engine.PrimaryIndexName) {
+		return nil, fmt.Errorf("cannot drop a primary key index")
+	}
+	return nil, fmt.Errorf("index %s does not exist", name)
+}
+
+// sameColumns reports whether two column lists hold the same names in the
+// same order, ignoring case
+func sameColumns(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !strings.EqualFold(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
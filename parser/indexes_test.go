@@ -0,0 +1,244 @@
+package parser
+
+import (
+	"pesapal-ledger/engine"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestShowIndexes(t *testing.T) {
+	db := newTestDB(t,
+		"CREATE TABLE users (id int, name text)",
+		"CREATE TABLE enrollments (student int, course text, grade text, PRIMARY KEY (student, course))",
+		"INSERT INTO users VALUES (1, alice)",
+		"INSERT INTO users VALUES (2, bob)",
+		"INSERT INTO users VALUES (3, carol)",
+		"DELETE FROM users WHERE id = 2",
+		"INSERT INTO enrollments VALUES (1, math, A)",
+	)
+
+	users := engine.IndexInfo{Table: "users", Name: engine.PrimaryIndexName, Columns: []string{"id"}, Unique: true, Primary: true, Entries: 2}
+	enrollments := engine.IndexInfo{Table: "enrollments", Name: engine.PrimaryIndexName, Columns: []string{"student", "course"}, Unique: true, Primary: true, Entries: 1}
+
+	tests := []struct {
+		query string
+		want  []engine.IndexInfo
+	}{
+		{"SHOW INDEXES", []engine.IndexInfo{enrollments, users}},
+		{"show indexes from users", []engine.IndexInfo{users}},
+		{"SHOW INDEX FROM enrollments", []engine.IndexInfo{enrollments}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			if got := mustExecute(t, db, tt.query); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	// A new table shows up with its index, and its entries follow the writes
+	mustExecute(t, db, "CREATE TABLE accounts (number int, owner text)")
+	mustExecute(t, db, "INSERT INTO accounts VALUES (7, dave)")
+	infos := mustExecute(t, db, "SHOW INDEXES").([]engine.IndexInfo)
+	if len(infos) != 3 || infos[0].Table != "accounts" || infos[0].Entries != 1 || !reflect.DeepEqual(infos[0].Columns, []string{"number"}) {
+		t.Errorf("after CREATE TABLE accounts: %+v", infos)
+	}
+
+	for _, query := range []string{
+		"SHOW INDEXES FROM missing",
+		"SHOW INDEXES users",
+		"SHOW INDEXES FROM users extra",
+		"SHOW INDEXING",
+	} {
+		if _, err := Execute(db, query); err == nil {
+			t.Errorf("%s: expected an error", query)
+		}
+	}
+}
+
+func TestDropIndex(t *testing.T) {
+	db := newTestDB(t,
+		"CREATE TABLE users (id int, name text)",
+		"CREATE TABLE enrollments (student int, course text, PRIMARY KEY (student, course))",
+		"INSERT INTO users VALUES (1, alice)",
+	)
+
+	tests := []struct {
+		query   string
+		wantErr string
+	}{
+		{"DROP INDEX ON users (id)", "cannot drop the primary key index of table users"},
+		{"drop index on users (ID)", "cannot drop the primary key index of table users"},
+		{"DROP INDEX ON enrollments (student, course)", "cannot drop the primary key index of table enrollments"},
+		{"DROP INDEX ON enrollments (course, student)", "index on enrollments (course, student) does not exist"},
+		{"DROP INDEX ON users (name)", "index on users (name) does not exist"},
+		{"DROP INDEX ON missing (id)", "does not exist"},
+		{"DROP INDEX PRIMARY", "cannot drop a primary key index"},
+		{"DROP INDEX users_name", "index users_name does not exist"},
+		{"DROP INDEX", "invalid DROP INDEX syntax"},
+		{"DROP INDEX ON users id", "invalid DROP INDEX syntax"},
+		{"DROP INDEX two words", "invalid DROP INDEX syntax"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			_, err := Execute(db, tt.query)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	// The indexes are untouched and still serve lookups
+	if infos := mustExecute(t, db, "SHOW INDEXES FROM users").([]engine.IndexInfo); len(infos) != 1 || infos[0].Entries != 1 {
+		t.Errorf("SHOW INDEXES FROM users = %+v", infos)
+	}
+	if rows := queryRows(t, db, "SELECT name FROM users WHERE id = 1"); len(rows) != 1 || rows[0][0] != "alice" {
+		t.Errorf("lookup after DROP INDEX = %v", rows)
+	}
+}
+
+func TestShowTablesHidesSystemTables(t *testing.T) {
+	db := newTestDB(t,
+		"CREATE TABLE users (id int, name text)",
+		"CREATE TABLE __migrations (version int, applied text)",
+		"CREATE TABLE accounts (id int, owner text)",
+		"INSERT INTO __migrations VALUES (1, init)",
+	)
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"SHOW TABLES", []string{"accounts", "users"}},
+		{"show tables", []string{"accounts", "users"}},
+		{"SHOW TABLES INCLUDING SYSTEM", []string{"__migrations", "accounts", "users"}},
+		{"show tables including system", []string{"__migrations", "accounts", "users"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			if got := mustExecute(t, db, tt.query); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	for _, query := range []string{"SHOW TABLES INCLUDING", "SHOW TABLES SYSTEM", "SHOW TABLES INCLUDING USER"} {
+		if _, err := Execute(db, query); err == nil || !strings.Contains(err.Error(), "invalid SHOW TABLES syntax") {
+			t.Errorf("%s: got %v, want a syntax error", query, err)
+		}
+	}
+
+	// Hidden from SHOW INDEXES, but still a table like any other
+	for _, info := range mustExecute(t, db, "SHOW INDEXES").([]engine.IndexInfo) {
+		if info.Table == "__migrations" {
+			t.Errorf("SHOW INDEXES lists %+v", info)
+		}
+	}
+	if infos := mustExecute(t, db, "SHOW INDEXES FROM __migrations").([]engine.IndexInfo); len(infos) != 1 || infos[0].Entries != 1 {
+		t.Errorf("SHOW INDEXES FROM __migrations = %+v", infos)
+	}
+	for _, info := range db.TableInfos() {
+		if info.Name == "__migrations" {
+			t.Errorf("TableInfos lists %+v", info)
+		}
+	}
+	if rows := queryRows(t, db, "SELECT applied FROM __migrations WHERE version = 1"); len(rows) != 1 || rows[0][0] != "init" {
+		t.Errorf("SELECT from the system table = %v", rows)
+	}
+	if schema := strings.Join(mustExecute(t, db, "DUMP SCHEMA").([]string), "\n"); !strings.Contains(schema, "CREATE TABLE __migrations") {
+		t.Errorf("DUMP SCHEMA leaves out the system table:\n%s", schema)
+	}
+}
+
+func TestShowTableSize(t *testing.T) {
+	db := newTestDB(t,
+		"CREATE TABLE t (id int, name text)",
+		"CREATE TABLE sales.t (id int, name text)",
+		"INSERT INTO t VALUES (1, alice)",
+		"INSERT INTO t VALUES (2, bob)",
+		"UPDATE t SET name = carol WHERE id = 1",
+	)
+	want, err := db.TableSize("t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want.FileBytes == 0 || want.DeadBytes == 0 {
+		t.Fatalf("TableSize = %+v, want an updated row's dead bytes", want)
+	}
+
+	tests := []struct {
+		query   string
+		want    engine.TableSize
+		wantErr string
+	}{
+		{"SHOW TABLE SIZE t", want, ""},
+		{"show table size t;", want, ""},
+		{"SHOW TABLE SIZE sales.t", engine.TableSize{Table: "sales.t"}, ""},
+		{"SHOW TABLE SIZE nope", engine.TableSize{}, "table nope does not exist"},
+		{"SHOW TABLE SIZE", engine.TableSize{}, "expected SHOW TABLE SIZE name"},
+		{"SHOW TABLE SIZE t u", engine.TableSize{}, "expected SHOW TABLE SIZE name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			got, err := Execute(db, tt.query)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShowTablesWithSchema(t *testing.T) {
+	db := newTestDB(t,
+		"CREATE TABLE ledger (id int, amount int CHECK (amount >= 0), note text, CHECK (note != 'x'))",
+		"CREATE TABLE enrollments (student int, course text, grade text, PRIMARY KEY (student, course))",
+		"CREATE TABLE people (name text, number int, PRIMARY KEY (number))",
+		"CREATE TABLE __migrations (version int, applied text)",
+	)
+
+	want := []engine.TableSchema{
+		{Table: "enrollments", PrimaryKey: []string{"student", "course"}, Columns: []engine.ColumnInfo{
+			{Name: "student", Type: "int", PrimaryKey: true},
+			{Name: "course", Type: "text", PrimaryKey: true},
+			{Name: "grade", Type: "text"},
+		}},
+		{Table: "ledger", PrimaryKey: []string{"id"}, Checks: []string{"note != 'x'"}, Columns: []engine.ColumnInfo{
+			{Name: "id", Type: "int", PrimaryKey: true},
+			{Name: "amount", Type: "int", Check: "amount >= 0"},
+			{Name: "note", Type: "text"},
+		}},
+		{Table: "people", PrimaryKey: []string{"number"}, Columns: []engine.ColumnInfo{
+			{Name: "name", Type: "text"},
+			{Name: "number", Type: "int", PrimaryKey: true},
+		}},
+	}
+	for _, query := range []string{"SHOW TABLES WITH SCHEMA", "show tables with schema"} {
+		t.Run(query, func(t *testing.T) {
+			if got := mustExecute(t, db, query); !reflect.DeepEqual(got, want) {
+				t.Errorf("got %+v\nwant %+v", got, want)
+			}
+		})
+	}
+
+	for _, query := range []string{"SHOW TABLES WITH", "SHOW TABLES SCHEMA", "SHOW TABLES WITH COLUMNS"} {
+		if _, err := Execute(db, query); err == nil || !strings.Contains(err.Error(), "invalid SHOW TABLES syntax") {
+			t.Errorf("%s: got %v, want a syntax error", query, err)
+		}
+	}
+
+	// An empty database lists no tables rather than null
+	empty := newTestDB(t)
+	if got := mustExecute(t, empty, "SHOW TABLES WITH SCHEMA"); !reflect.DeepEqual(got, []engine.TableSchema{}) {
+		t.Errorf("empty database: got %#v", got)
+	}
+}
@@ -0,0 +1,122 @@
+package parser
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// jsonExtractExpr is "json_extract(doc, path)": the part of the JSON document
+// doc that a path such as '$.amount' or '$.items[0].sku' points at. A value
+// that isn't JSON, a path that isn't valid or leads nowhere gives NULL.
+type jsonExtractExpr struct {
+	doc, path expr
+}
+
+func (e jsonExtractExpr) eval(row []interface{}) interface{} {
+	doc, ok := e.doc.eval(row).(string)
+	if !ok {
+		return nil
+	}
+	path, ok := e.path.eval(row).(string)
+	if !ok {
+		return nil
+	}
+	steps, ok := parseJSONPath(path)
+	if !ok {
+		return nil
+	}
+
+	var value interface{}
+	decoder := json.NewDecoder(strings.NewReader(doc))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil || decoder.More() {
+		return nil
+	}
+	for _, step := range steps {
+		switch node := value.(type) {
+		case map[string]interface{}:
+			if step.index >= 0 {
+				return nil
+			}
+			if value, ok = node[step.key]; !ok {
+				return nil
+			}
+		case []interface{}:
+			if step.index < 0 || step.index >= len(node) {
+				return nil
+			}
+			value = node[step.index]
+		default:
+			return nil
+		}
+	}
+	return jsonResult(value)
+}
+
+// jsonStep is one step of a JSON path: an object key, or an array index
+// when index >= 0
+type jsonStep struct {
+	key   string
+	index int
+}
+
+// parseJSONPath parses "$", followed by any number of ".key" and "[n]"
+func parseJSONPath(path string) ([]jsonStep, bool) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, false
+	}
+	rest := path[1:]
+	var steps []jsonStep
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end == -1 {
+				end = len(rest) - 1
+			}
+			key := rest[1 : end+1]
+			if key == "" {
+				return nil, false
+			}
+			steps = append(steps, jsonStep{key: key, index: -1})
+			rest = rest[end+1:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end == -1 {
+				return nil, false
+			}
+			n, err := strconv.Atoi(rest[1:end])
+			if err != nil || n < 0 {
+				return nil, false
+			}
+			steps = append(steps, jsonStep{index: n})
+			rest = rest[end+1:]
+		default:
+			return nil, false
+		}
+	}
+	return steps, true
+}
+
+// jsonResult turns a decoded JSON value into a result value: numbers become
+// integers or floats, and objects and arrays stay JSON text
+func jsonResult(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		if f, err := v.Float64(); err == nil {
+			return f
+		}
+		return v.String()
+	case map[string]interface{}, []interface{}:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return nil
+		}
+		return string(encoded)
+	}
+	return value // string, bool or nil
+}
@@ -0,0 +1,69 @@
+package parser
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestJSONExtract(t *testing.T) {
+	db := newTestDB(t,
+		"CREATE TABLE events (id int, payload text)",
+		`INSERT INTO events VALUES (1, '{"amount": 500, "items": [{"sku": "A1"}, {"sku": "B2"}], "ok": true, "rate": 1.5, "meta": {"k": "v"}}')`,
+		"INSERT INTO events VALUES (2, 'not json')",
+		`INSERT INTO events VALUES (3, '{"amount": "12"}')`,
+		"INSERT INTO events VALUES (4, )",
+	)
+
+	tests := []struct {
+		query string
+		want  [][]interface{}
+	}{
+		{"SELECT id, json_extract(payload, '$.amount') AS amt FROM events", [][]interface{}{{int64(1), int64(500)}, {int64(2), nil}, {int64(3), "12"}, {int64(4), nil}}},
+		{"SELECT JSON_EXTRACT(payload, '$.items[1].sku') FROM events WHERE id = 1", [][]interface{}{{"B2"}}},
+		{"SELECT json_extract(payload, '$.items[0]') FROM events WHERE id = 1", [][]interface{}{{`{"sku":"A1"}`}}},
+		{"SELECT json_extract(payload, '$.ok'), json_extract(payload, '$.rate') FROM events WHERE id = 1", [][]interface{}{{true, 1.5}}},
+		{"SELECT json_extract(payload, '$.meta') FROM events WHERE id = 1", [][]interface{}{{`{"k":"v"}`}}},
+		// Missing paths and invalid paths give NULL
+		{"SELECT json_extract(payload, '$.missing') FROM events WHERE id = 1", [][]interface{}{{nil}}},
+		{"SELECT json_extract(payload, '$.items[5].sku') FROM events WHERE id = 1", [][]interface{}{{nil}}},
+		{"SELECT json_extract(payload, '$.amount[0]') FROM events WHERE id = 1", [][]interface{}{{nil}}},
+		{"SELECT json_extract(payload, 'amount') FROM events WHERE id = 1", [][]interface{}{{nil}}},
+		{"SELECT json_extract(payload, '$.') FROM events WHERE id = 1", [][]interface{}{{nil}}},
+		{"SELECT json_extract(payload, '$.items[x]') FROM events WHERE id = 1", [][]interface{}{{nil}}},
+		{"SELECT COALESCE(json_extract(payload, '$.amount'), 0) AS amt FROM events", [][]interface{}{{int64(500)}, {int64(0)}, {"12"}, {int64(0)}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			if got := queryRows(t, db, tt.query); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	query := "SELECT id, json_extract(payload, '$.amount') AS amt, json_extract(payload, '$.ok') FROM events"
+	got, err := Columnar(db, query, queryRows(t, db, query))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"id", "amt", "json_extract(payload, '$.ok')"}; !reflect.DeepEqual(got.Columns, want) {
+		t.Errorf("columns = %q, want %q", got.Columns, want)
+	}
+
+	errTests := []struct {
+		query   string
+		wantErr string
+	}{
+		{"SELECT json_extract(payload) FROM events", "expected json_extract(value, path)"},
+		{"SELECT json_extract(payload, '$.a', 'x') FROM events", "expected json_extract(value, path)"},
+		{"SELECT json_extract(nope, '$.a') FROM events", "unknown column nope"},
+	}
+	for _, tt := range errTests {
+		t.Run(tt.query, func(t *testing.T) {
+			_, err := Execute(db, tt.query)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package parser
+
+import (
+	"fmt"
+	"pesapal-ledger/engine"
+	"strings"
+)
+
+// hasCompositeKey reports whether a table declares a multi-column PRIMARY KEY
+func hasCompositeKey(tableName string, db *engine.Database) bool {
+	metadata, exists := db.Table(tableName)
+	return exists && metadata.CompositeKey()
+}
+
+// keyColumn returns the name of a table's single-column primary key, "id"
+// when the table is unknown, or "" for a composite key
+func keyColumn(tableName string, db *engine.Database) string {
+	metadata, exists := db.Table(tableName)
+	if !exists {
+		return "id"
+	}
+	if keyColumns := metadata.KeyColumns(); len(keyColumns) == 1 {
+		return keyColumns[0]
+	}
+	return ""
+}
+
+// isKeyColumn reports whether col is the single-column primary key of a
+// table, so a condition on it can use the index. "id" also names the key of
+// tables with no column called id, as it always has.
+func isKeyColumn(tableName, col string, db *engine.Database) bool {
+	key := keyColumn(tableName, db)
+	if key == "" {
+		return false
+	}
+	columns, err := db.ColumnNames(tableName)
+	if err != nil {
+		return strings.EqualFold(col, key) // let the lookup report the missing table
+	}
+	pos, err := engine.ResolveColumn(tableName, columns, col)
+	if err == nil {
+		return columns[pos] == key
+	}
+	return strings.EqualFold(col, "id") && !engine.IsAmbiguousColumn(err)
+}
+
+// whereKey resolves the WHERE clause of a single-row UPDATE or DELETE to the
+// row's key: "key = val" on the primary key column, or "a = x AND b = y"
+// naming every column of a composite PRIMARY KEY
+func whereKey(tableName, whereClause string, db *engine.Database) (string, error) {
+	if hasCompositeKey(tableName, db) {
+		return compositeKey(tableName, whereClause, db)
+	}
+
+	key := keyColumn(tableName, db)
+	condParts := splitTopLevel(whereClause, '=')
+	if len(condParts) != 2 {
+		if _, err := parsePredicates(tableName, whereClause); err == nil {
+			return "", fmt.Errorf("only filtering by the primary key '%s' is supported; add LIMIT n to change the rows matching other conditions", key)
+		}
+		return "", fmt.Errorf("invalid WHERE clause, expected '%s = val'", key)
+	}
+	col, err := unqualifyColumn(strings.TrimSpace(condParts[0]), tableName)
+	if err != nil {
+		return "", err
+	}
+	if !isKeyColumn(tableName, col, db) {
+		return "", fmt.Errorf("only filtering by the primary key '%s' is supported; add LIMIT n to change the rows matching another column", key)
+	}
+	return unquoteValue(condParts[1])
+}
+
+// compositeKey parses "a = x AND b = y" over the primary key columns of a
+// table into its index key
+func compositeKey(tableName, whereClause string, db *engine.Database) (string, error) {
+	values := make(map[string]string)
+	for _, term := range splitAndTerms(whereClause) {
+		parts := splitTopLevel(term, '=')
+		if len(parts) != 2 {
+			return "", fmt.Errorf("invalid WHERE clause %q: expected 'col = val AND ...' over the primary key", term)
+		}
+		col, err := unqualifyColumn(strings.TrimSpace(parts[0]), tableName)
+		if err != nil {
+			return "", err
+		}
+		if values[col], err = unquoteValue(parts[1]); err != nil {
+			return "", err
+		}
+	}
+	return db.KeyFor(tableName, values)
+}
+
+// splitAndTerms splits a condition on top-level AND keywords
+func splitAndTerms(clause string) []string {
+	var terms []string
+	for {
+		idx := indexKeyword(clause, " AND ")
+		if idx == -1 {
+			return append(terms, strings.TrimSpace(clause))
+		}
+		terms = append(terms, strings.TrimSpace(clause[:idx]))
+		clause = clause[idx+5:] // len(" AND ")
+	}
+}
+
+// isKeyTarget reports whether a conflict target "a, b" names exactly the
+// primary key columns of a table, in any order
+func isKeyTarget(tableName, target string, db *engine.Database) bool {
+	metadata, exists := db.Table(tableName)
+	if !exists {
+		return false
+	}
+	names := strings.Split(target, ",")
+	keyColumns := metadata.KeyColumns()
+	if len(names) != len(keyColumns) {
+		return false
+	}
+	for _, name := range names {
+		if _, err := engine.ResolveColumn(tableName, keyColumns, strings.TrimSpace(name)); err != nil {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,66 @@
+package parser
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestWhereOnNamedPrimaryKey(t *testing.T) {
+	db := newTestDB(t,
+		"CREATE TABLE accounts (account_number int, owner text)",
+		"CREATE TABLE cards (owner text, code int, PRIMARY KEY (code))",
+		"CREATE TABLE tags (id int, tag text, PRIMARY KEY (tag))",
+	)
+	for i := 1; i <= 10; i++ {
+		mustExecute(t, db, fmt.Sprintf("INSERT INTO accounts VALUES (%d, owner%d)", 40+i, i))
+		mustExecute(t, db, fmt.Sprintf("INSERT INTO cards VALUES (owner%d, %d)", i, i))
+		mustExecute(t, db, fmt.Sprintf("INSERT INTO tags VALUES (%d, tag%d)", i, i))
+	}
+
+	tests := []struct {
+		query       string
+		accessPath  string
+		rowsScanned int64
+		want        [][]interface{}
+	}{
+		{"SELECT owner FROM accounts WHERE account_number = 42", "index lookup on accounts.account_number", 1, [][]interface{}{{"owner2"}}},
+		{"SELECT owner FROM accounts WHERE ACCOUNT_NUMBER = 42", "index lookup on accounts.account_number", 1, [][]interface{}{{"owner2"}}},
+		{"SELECT owner FROM accounts WHERE id = 42", "index lookup on accounts.account_number", 1, [][]interface{}{{"owner2"}}},
+		{"SELECT owner FROM accounts WHERE account_number BETWEEN 49 AND 60", "range scan on accounts.account_number", 2, [][]interface{}{{"owner9"}, {"owner10"}}},
+		{"SELECT account_number FROM accounts WHERE owner = owner3", "full scan of accounts", 10, [][]interface{}{{int64(43)}}},
+		{"SELECT owner FROM cards WHERE code = 7", "index lookup on cards.code", 1, [][]interface{}{{"owner7"}}},
+		{"SELECT owner FROM cards WHERE id = 7", "index lookup on cards.code", 1, [][]interface{}{{"owner7"}}},
+		// A column named id that isn't the key is an ordinary column
+		{"SELECT tag FROM tags WHERE id = 4", "full scan of tags", 10, [][]interface{}{{"tag4"}}},
+		{"SELECT id FROM tags WHERE tag = tag4", "index lookup on tags.tag", 1, [][]interface{}{{int64(4)}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			if got := queryRows(t, db, tt.query); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+			plan := mustExecute(t, db, "EXPLAIN ANALYZE "+tt.query).(map[string]interface{})
+			if paths := plan["accessPaths"].([]string); len(paths) != 1 || paths[0] != tt.accessPath {
+				t.Errorf("access paths = %v, want %q", paths, tt.accessPath)
+			}
+			if scanned := plan["rowsScanned"].(int64); scanned != tt.rowsScanned {
+				t.Errorf("rows scanned = %d, want %d", scanned, tt.rowsScanned)
+			}
+		})
+	}
+
+	// UPDATE and DELETE on the key column address a single row, no LIMIT needed
+	mustExecute(t, db, "UPDATE accounts SET owner = carol WHERE account_number = 43")
+	mustExecute(t, db, "DELETE FROM accounts WHERE Account_Number = 44")
+	mustExecute(t, db, "UPDATE cards SET owner = dave WHERE code = 5")
+	if got, want := queryRows(t, db, "SELECT account_number, owner FROM accounts WHERE account_number BETWEEN 43 AND 44"), [][]interface{}{{int64(43), "carol"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("accounts after UPDATE and DELETE = %v, want %v", got, want)
+	}
+	if got := queryRows(t, db, "SELECT owner FROM cards WHERE code = 5"); len(got) != 1 || got[0][0] != "dave" {
+		t.Errorf("cards after UPDATE = %v", got)
+	}
+	if _, err := Execute(db, "UPDATE tags SET tag = x WHERE id = 1"); err == nil {
+		t.Error("UPDATE on a non-key id column without LIMIT: expected an error")
+	}
+}
@@ -0,0 +1,112 @@
+package parser
+
+import (
+	"fmt"
+	"pesapal-ledger/engine"
+	"strconv"
+	"strings"
+)
+
+// splitMutationLimit splits a trailing "LIMIT n" off an UPDATE or DELETE.
+// LIMIT inside a quoted value doesn't count.
+func splitMutationLimit(query string) (string, int, bool, error) {
+	idx := lastKeyword(query, " LIMIT ")
+	if idx == -1 {
+		return query, 0, false, nil
+	}
+	text := strings.TrimSpace(query[idx+7:]) // len(" LIMIT ")
+	n, err := strconv.Atoi(text)
+	if err != nil || n < 0 {
+		return "", 0, false, fmt.Errorf("invalid LIMIT %q: expected a non-negative integer", text)
+	}
+	return strings.TrimSpace(query[:idx]), n, true, nil
+}
+
+// limitedKeys picks the rows an UPDATE or DELETE with LIMIT n changes: the
+// first n rows in key order matching "col op val [AND ...]" on any columns or
+// "a op b" comparing two columns, or of the whole table when whereClause is
+// empty (ALL)
+func limitedKeys(tableName, whereClause string, limit int, db *engine.Database) ([]string, error) {
+	if whereClause == "" {
+		return db.MatchingKeysWhere(tableName, nil, limit)
+	}
+	columns, err := db.RowColumns(tableName)
+	if err != nil {
+		return nil, err
+	}
+	if cond, ok, err := columnComparison(tableName, whereClause, columns, db); err != nil {
+		return nil, err
+	} else if ok {
+		match, matchErr := rowMatcher(tableName, columns, cond, db)
+		keys, err := db.MatchingKeysFunc(tableName, match, limit)
+		if err == nil {
+			err = *matchErr
+		}
+		if err != nil {
+			return nil, err
+		}
+		return keys, nil
+	}
+
+	preds, err := parsePredicates(tableName, whereClause)
+	if err != nil {
+		return nil, err
+	}
+	return db.MatchingKeysWhere(tableName, preds, limit)
+}
+
+// deleteLimited runs "DELETE FROM t WHERE col = val LIMIT n" (or "ALL LIMIT n")
+func deleteLimited(tableName, whereClause string, limit int, returning string, hasReturning bool, db *engine.Database, w writer) (interface{}, error) {
+	var returnCols []string
+	if hasReturning {
+		var err error
+		if returnCols, err = returningColumns(tableName, returning, db); err != nil {
+			return nil, err
+		}
+	}
+	keys, err := limitedKeys(tableName, whereClause, limit, db)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([][]string, 0, len(keys))
+	for _, key := range keys {
+		row, err := w.DeleteRowReturning(tableName, key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to delete row %s after deleting %d: %w", key, len(rows), err)
+		}
+		rows = append(rows, row)
+	}
+	if hasReturning {
+		return returningRows(tableName, returnCols, rows, db)
+	}
+	return MutationResult{Message: "Rows deleted successfully", Affected: len(rows)}, nil
+}
+
+// updateLimited runs "UPDATE t SET ... WHERE col = val LIMIT n" (or "ALL LIMIT n")
+func updateLimited(tableName, whereClause string, updates map[string]string, limit int, returning string, hasReturning bool, db *engine.Database, w writer) (interface{}, error) {
+	var returnCols []string
+	if hasReturning {
+		var err error
+		if returnCols, err = returningColumns(tableName, returning, db); err != nil {
+			return nil, err
+		}
+	}
+	keys, err := limitedKeys(tableName, whereClause, limit, db)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([][]string, 0, len(keys))
+	for _, key := range keys {
+		row, err := w.UpdateRowReturning(tableName, key, updates)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update row %s after updating %d: %w", key, len(rows), err)
+		}
+		rows = append(rows, row)
+	}
+	if hasReturning {
+		return returningRows(tableName, returnCols, rows, db)
+	}
+	return MutationResult{Message: "Rows updated successfully", Affected: len(rows)}, nil
+}
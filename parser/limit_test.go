@@ -0,0 +1,122 @@
+package parser
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMutationLimit(t *testing.T) {
+	// 25 rows inserted out of key order; ids 1-9 and 10-25 would interleave
+	// if keys were compared as text
+	setup := []string{"CREATE TABLE txns (id int, status text, note text)"}
+	for _, id := range []int{25, 3, 17, 1, 10, 22, 2, 9, 11, 4, 20, 5, 15, 6, 24, 7, 13, 8, 19, 12, 14, 16, 18, 21, 23} {
+		setup = append(setup, fmt.Sprintf("INSERT INTO txns VALUES (%d, tmp, 'LIMIT 1')", id))
+	}
+	setup = append(setup, "INSERT INTO txns VALUES (26, keep, x)")
+	db := newTestDB(t, setup...)
+
+	ids := func(where string) []int64 {
+		var out []int64
+		for _, row := range queryRows(t, db, "SELECT id FROM txns WHERE "+where) {
+			out = append(out, row[0].(int64))
+		}
+		return out
+	}
+	span := func(lo, hi int64) []int64 {
+		var out []int64
+		for id := lo; id <= hi; id++ {
+			out = append(out, id)
+		}
+		return out
+	}
+
+	// Repeated batches each change at most n rows, lowest keys first
+	updates := []struct {
+		affected int
+		done     []int64
+	}{
+		{10, span(1, 10)},
+		{10, span(1, 20)},
+		{5, span(1, 25)},
+		{0, span(1, 25)},
+	}
+	for i, step := range updates {
+		t.Run(fmt.Sprintf("update batch %d", i+1), func(t *testing.T) {
+			result := mustExecute(t, db, "UPDATE txns SET status = done WHERE status = tmp LIMIT 10")
+			if got := result.(MutationResult).Affected; got != step.affected {
+				t.Errorf("affected = %d, want %d", got, step.affected)
+			}
+			if got := ids("status = done"); !reflect.DeepEqual(got, step.done) {
+				t.Errorf("done ids = %v, want %v", got, step.done)
+			}
+		})
+	}
+
+	deletes := []struct {
+		affected int
+		left     []int64
+	}{
+		{7, append(span(8, 25), 26)},
+		{7, append(span(15, 25), 26)},
+		{7, append(span(22, 25), 26)},
+		{4, []int64{26}},
+		{0, []int64{26}},
+	}
+	for i, step := range deletes {
+		t.Run(fmt.Sprintf("delete batch %d", i+1), func(t *testing.T) {
+			result := mustExecute(t, db, "DELETE FROM txns WHERE status = done LIMIT 7")
+			if got := result.(MutationResult).Affected; got != step.affected {
+				t.Errorf("affected = %d, want %d", got, step.affected)
+			}
+			if got := ids("id > 0"); !reflect.DeepEqual(got, step.left) {
+				t.Errorf("ids left = %v, want %v", got, step.left)
+			}
+		})
+	}
+}
+
+func TestMutationLimitForms(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		affected int
+		wantErr  string
+		left     int // live rows afterwards, of 3
+	}{
+		{"ALL with LIMIT", "DELETE FROM t ALL LIMIT 2", 2, "", 1},
+		{"LIMIT 0", "DELETE FROM t WHERE kind = a LIMIT 0", 0, "", 3},
+		{"no match", "DELETE FROM t WHERE kind = z LIMIT 5", 0, "", 3},
+		{"limit past the matches", "DELETE FROM t WHERE kind = a LIMIT 100", 2, "", 1},
+		{"comparison", "DELETE FROM t WHERE id >= 2 LIMIT 1", 1, "", 2},
+		{"LIMIT inside a quoted value", "UPDATE t SET note = 'x LIMIT 9' WHERE kind = a LIMIT 1", 1, "", 3},
+		{"lowercase limit", "update t set note = y all limit 2", 2, "", 3},
+		{"negative LIMIT", "DELETE FROM t WHERE kind = a LIMIT -1", 0, "expected a non-negative integer", 3},
+		{"word LIMIT", "UPDATE t SET note = y ALL LIMIT many", 0, "expected a non-negative integer", 3},
+		{"unknown column", "DELETE FROM t WHERE nope = a LIMIT 1", 0, "nope", 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t,
+				"CREATE TABLE t (id int, kind text, note text)",
+				"INSERT INTO t VALUES (1, a, n)",
+				"INSERT INTO t VALUES (2, a, n)",
+				"INSERT INTO t VALUES (3, b, n)",
+			)
+			result, err := Execute(db, tt.query)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			} else if got := result.(MutationResult).Affected; got != tt.affected {
+				t.Errorf("affected = %d, want %d", got, tt.affected)
+			}
+			if rows := queryRows(t, db, "SELECT id FROM t"); len(rows) != tt.left {
+				t.Errorf("rows left = %v, want %d", rows, tt.left)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package parser
+
+import (
+	"fmt"
+	"pesapal-ledger/engine"
+	"strconv"
+	"strings"
+)
+
+// resultOrder is the trailing "[ORDER BY col [ASC|DESC]] [LIMIT n]" of a
+// SELECT without GROUP BY
+type resultOrder struct {
+	column string // "" without ORDER BY
+	desc   bool
+	limit  int // -1 without LIMIT
+}
+
+// splitResultOrder splits the ORDER BY and LIMIT clauses off the end of a
+// SELECT. Clauses inside quotes or parentheses (a subquery) don't count.
+func splitResultOrder(query string) (string, resultOrder, error) {
+	order := resultOrder{limit: -1}
+
+	if idx := lastKeyword(query, " LIMIT "); idx != -1 {
+		text := strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(query[idx+7:]), ";")) // len(" LIMIT ")
+		n, err := strconv.Atoi(text)
+		if err != nil || n < 0 {
+			return "", order, fmt.Errorf("invalid LIMIT %q: expected a non-negative integer", text)
+		}
+		order.limit = n
+		query = strings.TrimSpace(query[:idx])
+	}
+
+	if idx := lastKeyword(query, " ORDER BY "); idx != -1 {
+		fields := strings.Fields(strings.TrimSuffix(strings.TrimSpace(query[idx+10:]), ";")) // len(" ORDER BY ")
+		switch {
+		case len(fields) == 1:
+		case len(fields) == 2 && (strings.EqualFold(fields[1], "ASC") || strings.EqualFold(fields[1], "DESC")):
+			order.desc = strings.EqualFold(fields[1], "DESC")
+		default:
+			return "", order, fmt.Errorf("invalid ORDER BY clause %q: expected ORDER BY col [ASC|DESC], optionally followed by LIMIT n", strings.TrimSpace(query[idx+10:]))
+		}
+		order.column = fields[0]
+		query = strings.TrimSpace(query[:idx])
+	}
+	return query, order, nil
+}
+
+// lastKeyword is indexKeyword finding the last top-level match
+func lastKeyword(s, keyword string) int {
+	idx := -1
+	for next := indexKeyword(s, keyword); next != -1; {
+		idx += next + 1
+		next = indexKeyword(s[idx+1:], keyword)
+	}
+	return idx
+}
+
+// check resolves the ORDER BY column against the table before any row is read
+func (o *resultOrder) check(tableName string, db *engine.Database) error {
+	if o.column == "" {
+		return nil
+	}
+	column, err := unqualifyColumn(o.column, tableName)
+	if err != nil {
+		return err
+	}
+	if err := db.CheckColumns(tableName, "ORDER BY", []string{column}); err != nil {
+		return err
+	}
+	o.column = column
+	return nil
+}
+
+// apply sorts and truncates the rows a SELECT matched
+func (o resultOrder) apply(tableName string, rows [][]string, db *engine.Database, trace *engine.Trace) ([][]string, error) {
+	start := trace.Start()
+	defer trace.Stop(engine.StageSort, start)
+	if o.column != "" {
+		if err := db.SortRows(tableName, rows, o.column, o.desc); err != nil {
+			return nil, engine.InClause(err, "ORDER BY")
+		}
+	}
+	if o.limit >= 0 && len(rows) > o.limit {
+		rows = rows[:o.limit]
+	}
+	return rows, nil
+}
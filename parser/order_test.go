@@ -0,0 +1,81 @@
+package parser
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSelectOrderByLimit(t *testing.T) {
+	db := newTestDB(t,
+		"CREATE TABLE txns (id int, merchant text, amount float, day date)",
+		"INSERT INTO txns VALUES (4, acme, 10, 2024-03-01)",
+		"INSERT INTO txns VALUES (10, Zeta, 9.5, 2024-01-15)",
+		"INSERT INTO txns VALUES (2, beta, 100, 2023-12-31)",
+		"INSERT INTO txns VALUES (7, acme, '', 2024-02-10)",
+		"INSERT INTO txns VALUES (1, beta, 10, '')",
+		"INSERT INTO txns VALUES (3, 'ORDER BY x', 50, 2024-01-01)",
+	)
+	ids := func(query string) []int64 {
+		var out []int64
+		for _, row := range queryRows(t, db, query) {
+			out = append(out, row[0].(int64))
+		}
+		return out
+	}
+
+	tests := []struct {
+		query string
+		want  []int64
+	}{
+		// amount is a float column: 9.5 < 10 < 50 < 100, not as text
+		{"SELECT id FROM txns ORDER BY amount", []int64{7, 10, 4, 1, 3, 2}},
+		{"SELECT id FROM txns ORDER BY amount DESC", []int64{2, 3, 4, 1, 10, 7}},
+		{"SELECT id FROM txns ORDER BY amount ASC LIMIT 3", []int64{7, 10, 4}},
+		{"SELECT id FROM txns ORDER BY id", []int64{1, 2, 3, 4, 7, 10}},
+		{"SELECT id FROM txns ORDER BY id DESC LIMIT 2", []int64{10, 7}},
+		// Text sorts case-sensitively, so Zeta comes before acme; ties keep file order
+		{"SELECT id FROM txns ORDER BY merchant", []int64{3, 10, 4, 7, 2, 1}},
+		{"SELECT id FROM txns ORDER BY day", []int64{1, 2, 3, 10, 7, 4}},
+		{"SELECT id FROM txns ORDER BY day DESC", []int64{4, 7, 10, 3, 2, 1}},
+		{"SELECT id FROM txns WHERE merchant = acme ORDER BY day DESC", []int64{4, 7}},
+		{"SELECT id FROM txns WHERE amount >= 10 ORDER BY amount DESC LIMIT 2", []int64{2, 3}},
+		{"SELECT id FROM txns WHERE merchant = beta LIMIT 1", []int64{1}},
+		{"SELECT id FROM txns ORDER BY txns.amount LIMIT 1", []int64{7}},
+		{"select id from txns order by AMOUNT desc limit 1;", []int64{2}},
+		// The ORDER BY column needn't be selected; a quoted keyword isn't a clause
+		{"SELECT id FROM txns WHERE merchant = 'ORDER BY x' ORDER BY day", []int64{3}},
+		// Without ORDER BY, LIMIT keeps the first rows in file order
+		{"SELECT * FROM txns LIMIT 2", []int64{4, 10}},
+		{"SELECT id FROM txns LIMIT 0", nil},
+		{"SELECT id FROM txns LIMIT 100", []int64{4, 10, 2, 7, 1, 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			if got := ids(tt.query); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	errors := []struct {
+		query   string
+		wantErr string
+	}{
+		{"SELECT id FROM txns ORDER BY nope", "unknown column nope in ORDER BY of table txns"},
+		{"SELECT id FROM txns ORDER BY other.amount", "other"},
+		{"SELECT id FROM txns ORDER BY amount SIDEWAYS", "invalid ORDER BY clause"},
+		{"SELECT id FROM txns ORDER BY amount, id", "invalid ORDER BY clause"},
+		{"SELECT id FROM txns LIMIT -1", "invalid LIMIT"},
+		{"SELECT id FROM txns LIMIT ten", "invalid LIMIT"},
+		{"SELECT id FROM txns ORDER BY amount LIMIT 1.5", "invalid LIMIT"},
+		{"SELECT id FROM txns UNION SELECT id FROM txns ORDER BY id", "ORDER BY and LIMIT are not supported in a UNION"},
+	}
+	for _, tt := range errors {
+		t.Run(tt.query, func(t *testing.T) {
+			if _, err := Execute(db, tt.query); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
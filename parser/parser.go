@@ -1,17 +1,40 @@
 package parser
 
 import (
+	"errors"
 	"fmt"
 	"pesapal-ledger/engine"
+	"pesapal-ledger/storage"
 	"strings"
 )
 
+// MutationResult reports how many rows a whole-table DELETE/UPDATE touched
+type MutationResult struct {
+	Message  string `json:"message"`
+	Affected int    `json:"affected"`
+}
+
+// Execute runs a single SQL statement against the database in-process.
+// It is the stable entry point for embedding the engine or profiling it
+// without the HTTP layer, and behaves exactly like the /sql endpoint.
+func Execute(db *engine.Database, query string) (interface{}, error) {
+	return ParseSQL(query, db)
+}
+
 // ParseSQL parses a raw SQL query and executes it against the database engine
 func ParseSQL(query string, db *engine.Database) (interface{}, error) {
+	return parseSQL(query, db, nil)
+}
+
+// parseSQL is ParseSQL recording what SELECT statements do in trace
+func parseSQL(query string, db *engine.Database, trace *engine.Trace) (interface{}, error) {
 	query = strings.TrimSpace(query)
 	if query == "" {
 		return nil, fmt.Errorf("empty query")
 	}
+	if err := checkQuotes(query); err != nil {
+		return nil, err
+	}
 
 	// Normalize for prefix check (case insensitive)
 	upperQuery := strings.ToUpper(query)
@@ -19,62 +42,138 @@ func ParseSQL(query string, db *engine.Database) (interface{}, error) {
 	if strings.HasPrefix(upperQuery, "CREATE TABLE") {
 		return parseCreateTable(query, db)
 	} else if strings.HasPrefix(upperQuery, "SHOW TABLES") {
-		return db.ListTables(), nil
+		return parseShowTables(query, db)
+	} else if strings.HasPrefix(upperQuery, "SHOW TABLE SIZE") {
+		return parseShowTableSize(query, db)
+	} else if strings.HasPrefix(upperQuery, "SHOW INDEX") {
+		return parseShowIndexes(query, db)
+	} else if strings.HasPrefix(upperQuery, "DROP INDEX") {
+		return parseDropIndex(query, db)
 	} else if strings.HasPrefix(upperQuery, "INSERT INTO") {
-		return parseInsert(query, db)
+		return parseInsert(query, db, db)
 	} else if strings.HasPrefix(upperQuery, "SELECT") {
-		return parseSelect(query, db)
+		return parseSelect(query, db, trace)
 	} else if strings.HasPrefix(upperQuery, "DELETE FROM") {
-		return parseDelete(query, db)
+		return parseDelete(query, db, db)
 	} else if strings.HasPrefix(upperQuery, "UPDATE") {
-		return parseUpdate(query, db)
+		return parseUpdate(query, db, db)
+	} else if strings.HasPrefix(upperQuery, "ALTER TABLE") {
+		return parseAlterTable(query, db)
+	} else if strings.HasPrefix(upperQuery, "EXPLAIN ANALYZE ") {
+		return parseExplainAnalyze(query, db)
+	} else if strings.HasPrefix(upperQuery, "EXPLAIN COMPACT TABLE") {
+		return parseExplainCompact(query, db)
+	} else if strings.HasPrefix(upperQuery, "IMPORT INTO") {
+		return parseImport(query, db)
+	} else if strings.HasPrefix(upperQuery, "PURGE TABLE") {
+		return parsePurge(query, db)
+	} else if strings.HasPrefix(upperQuery, "COMPACT TABLE") {
+		return parseCompact(query, db)
+	} else if strings.HasPrefix(upperQuery, "VACUUM") {
+		return parseVacuum(query, db)
+	} else if strings.HasPrefix(upperQuery, "DUMP") {
+		return parseDump(query, db)
+	} else if strings.HasPrefix(upperQuery, "PEEK") {
+		return parsePeek(query, db)
+	} else if strings.HasPrefix(upperQuery, "DESCRIBE ") {
+		return parseDescribe(query, db)
+	} else if strings.HasPrefix(upperQuery, "BEGIN") {
+		return parseTransaction(query, db, trace)
 	}
 
 	return nil, fmt.Errorf("unknown or unsupported command")
 }
 
-// parseDelete parses "DELETE FROM name WHERE id = val"
-func parseDelete(query string, db *engine.Database) (interface{}, error) {
+// parseDelete parses "DELETE FROM name WHERE id = val".
+// "DELETE FROM name ALL" deletes every live row; the explicit ALL keeps a
+// forgotten WHERE clause from wiping a table by accident.
+// A trailing "LIMIT n" deletes at most n rows matching "col = val" on any
+// column (or of ALL), the first ones in key order.
+// A trailing "RETURNING cols" returns the deleted rows instead of a message.
+func parseDelete(query string, db *engine.Database, w writer) (interface{}, error) {
+	query, returning, hasReturning := splitReturning(query)
+	query, limit, hasLimit, err := splitMutationLimit(query)
+	if err != nil {
+		return nil, err
+	}
+
 	// Logic similar to parseSelect but calls DeleteRow
-	upper := strings.ToUpper(query)
-	if !strings.HasPrefix(upper, "DELETE FROM ") {
+	if len(query) < 12 || !strings.EqualFold(query[:12], "DELETE FROM ") {
 		return nil, fmt.Errorf("invalid DELETE syntax")
 	}
 
 	// Remove "DELETE FROM "
 	rest := query[12:]
-	
-	// Split by " WHERE "
-	parts := strings.SplitN(upper[12:], " WHERE ", 2)
-	if len(parts) != 2 {
+
+	// Split by " WHERE ", outside quoted values
+	idxWhere := indexKeyword(rest, " WHERE ")
+	if idxWhere == -1 {
+		if tableName, ok := trimAllKeyword(rest); ok {
+			tableName = ident(tableName)
+			if hasLimit {
+				return deleteLimited(tableName, "", limit, returning, hasReturning, db, w)
+			}
+			if hasReturning {
+				returnCols, err := returningColumns(tableName, returning, db)
+				if err != nil {
+					return nil, err
+				}
+				rows, err := w.DeleteAllReturning(tableName)
+				if err != nil {
+					return nil, err
+				}
+				return returningRows(tableName, returnCols, rows, db)
+			}
+			deleted, err := w.DeleteAll(tableName)
+			if err != nil {
+				return nil, err
+			}
+			return MutationResult{Message: "Rows deleted successfully", Affected: deleted}, nil
+		}
 		return nil, fmt.Errorf("missing WHERE clause")
 	}
 
-	tableName := strings.TrimSpace(rest[:len(parts[0])])
-	whereClause := strings.TrimSpace(rest[len(parts[0])+7:]) // +7 for " WHERE "
-	
-	// Parse "id = val"
-	condParts := strings.Split(whereClause, "=")
-	if len(condParts) != 2 {
-		return nil, fmt.Errorf("invalid WHERE clause, expected 'id = val'")
+	tableName := ident(rest[:idxWhere])
+	whereClause := strings.TrimSpace(rest[idxWhere+7:]) // +7 for " WHERE "
+	if hasLimit {
+		return deleteLimited(tableName, whereClause, limit, returning, hasReturning, db, w)
 	}
-	
-	col := strings.TrimSpace(condParts[0])
-	val := strings.TrimSpace(condParts[1])
-	
-	if strings.ToLower(col) != "id" {
-		return nil, fmt.Errorf("only filtering by 'id' is supported")
+
+	// Parse "id = val", or the composite key "a = x AND b = y"
+	val, err := whereKey(tableName, whereClause, db)
+	if err != nil {
+		return nil, err
 	}
-	
-	if err := db.DeleteRow(tableName, val); err != nil {
+
+	if hasReturning {
+		returnCols, err := returningColumns(tableName, returning, db)
+		if err != nil {
+			return nil, err
+		}
+		row, err := w.DeleteRowReturning(tableName, val)
+		if err != nil {
+			return nil, err
+		}
+		return returningRows(tableName, returnCols, [][]string{row}, db)
+	}
+
+	if err := w.DeleteRow(tableName, val); err != nil {
 		return nil, err
 	}
-	
+
 	return "Row deleted successfully", nil
 }
 
-// parseUpdate parses "UPDATE table SET col1=val1, col2=val2 WHERE id=val"
-func parseUpdate(query string, db *engine.Database) (interface{}, error) {
+// parseUpdate parses "UPDATE table SET col1=val1, col2=val2 WHERE id=val".
+// "UPDATE table SET ... ALL" updates every live row.
+// A trailing "LIMIT n" updates at most n rows, as for DELETE.
+// A trailing "RETURNING cols" returns the updated rows instead of a message.
+func parseUpdate(query string, db *engine.Database, w writer) (interface{}, error) {
+	query, returning, hasReturning := splitReturning(query)
+	query, limit, hasLimit, err := splitMutationLimit(query)
+	if err != nil {
+		return nil, err
+	}
 	upper := strings.ToUpper(query)
 	if !strings.HasPrefix(upper, "UPDATE ") {
 		return nil, fmt.Errorf("invalid UPDATE syntax")
@@ -82,115 +181,313 @@ func parseUpdate(query string, db *engine.Database) (interface{}, error) {
 
 	// Remove "UPDATE "
 	rest := query[7:] // len("UPDATE ")
-	
+
 	// Find " SET "
 	idxSet := strings.Index(upper[7:], " SET ")
 	if idxSet == -1 {
 		return nil, fmt.Errorf("missing SET clause")
 	}
-	
-	tableName := strings.TrimSpace(rest[:idxSet])
+
+	tableName := ident(rest[:idxSet])
 	restAfterTable := rest[idxSet+5:] // len(" SET ")
-	upperAfterTable := upper[7+idxSet+5:]
 
-	// Find " WHERE "
-	idxWhere := strings.Index(upperAfterTable, " WHERE ")
+	// Find " WHERE ", outside quoted values
+	idxWhere := indexKeyword(restAfterTable, " WHERE ")
 	if idxWhere == -1 {
-		return nil, fmt.Errorf("missing WHERE clause")
+		setClause, ok := trimAllKeyword(restAfterTable)
+		if !ok {
+			return nil, fmt.Errorf("missing WHERE clause")
+		}
+
+		updates, err := parseAssignments(setClause)
+		if err != nil {
+			return nil, err
+		}
+		if hasLimit {
+			return updateLimited(tableName, "", updates, limit, returning, hasReturning, db, w)
+		}
+
+		if hasReturning {
+			returnCols, err := returningColumns(tableName, returning, db)
+			if err != nil {
+				return nil, err
+			}
+			rows, err := w.UpdateAllReturning(tableName, updates)
+			if err != nil {
+				return nil, err
+			}
+			return returningRows(tableName, returnCols, rows, db)
+		}
+
+		updated, err := w.UpdateAll(tableName, updates)
+		if err != nil {
+			return nil, err
+		}
+		return MutationResult{Message: "Rows updated successfully", Affected: updated}, nil
 	}
-	
+
 	setClause := strings.TrimSpace(restAfterTable[:idxWhere])
 	whereClause := strings.TrimSpace(restAfterTable[idxWhere+7:]) // len(" WHERE ")
-	
-	// Parse WHERE clause "id = val"
-	condParts := strings.Split(whereClause, "=")
-	if len(condParts) != 2 {
-		return nil, fmt.Errorf("invalid WHERE clause, expected 'id = val'")
+	if hasLimit {
+		updates, err := parseAssignments(setClause)
+		if err != nil {
+			return nil, err
+		}
+		return updateLimited(tableName, whereClause, updates, limit, returning, hasReturning, db, w)
+	}
+
+	// Parse WHERE clause "id = val", or the composite key "a = x AND b = y"
+	idVal, err := whereKey(tableName, whereClause, db)
+	if err != nil {
+		return nil, err
 	}
-	
-	col := strings.TrimSpace(condParts[0])
-	idVal := strings.TrimSpace(condParts[1])
-	
-	if strings.ToLower(col) != "id" {
-		return nil, fmt.Errorf("only filtering by 'id' is supported")
+
+	updates, err := parseAssignments(setClause)
+	if err != nil {
+		return nil, err
 	}
-	
-	// Parse SET clause "col1=val1, col2=val2"
+
+	if hasReturning {
+		returnCols, err := returningColumns(tableName, returning, db)
+		if err != nil {
+			return nil, err
+		}
+		row, err := w.UpdateRowReturning(tableName, idVal, updates)
+		if err != nil {
+			return nil, err
+		}
+		return returningRows(tableName, returnCols, [][]string{row}, db)
+	}
+
+	if err := w.UpdateRow(tableName, idVal, updates); err != nil {
+		return nil, err
+	}
+
+	return "Row updated successfully", nil
+}
+
+// parseAssignments parses a SET clause "col1=val1, col2='val, 2'". Quoted
+// values keep their commas and equals signs, and are stored without the quotes.
+func parseAssignments(setClause string) (map[string]string, error) {
 	updates := make(map[string]string)
-	assignments := strings.Split(setClause, ",")
+	assignments := splitTopLevel(setClause, ',')
 	for _, assignment := range assignments {
-		parts := strings.Split(assignment, "=")
+		parts := splitTopLevel(assignment, '=')
 		if len(parts) != 2 {
 			return nil, fmt.Errorf("invalid assignment in SET clause: %s", assignment)
 		}
-		
-		colName := strings.TrimSpace(parts[0])
-		colVal := strings.TrimSpace(parts[1])
+
+		colName := ident(parts[0])
+		colVal, err := unquoteValue(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid assignment in SET clause: %w", err)
+		}
 		updates[colName] = colVal
 	}
-	
+
 	if len(updates) == 0 {
 		return nil, fmt.Errorf("no columns to update")
 	}
-	
-	if err := db.UpdateRow(tableName, idVal, updates); err != nil {
-		return nil, err
+	return updates, nil
+}
+
+// trimAllKeyword strips a trailing "ALL" confirmation keyword from a clause.
+// It reports false when the keyword is missing.
+func trimAllKeyword(clause string) (string, bool) {
+	clause = strings.TrimSpace(clause)
+	if !strings.HasSuffix(strings.ToUpper(clause), " ALL") {
+		return "", false
 	}
-	
-	return "Row updated successfully", nil
+	return strings.TrimSpace(clause[:len(clause)-4]), true // len(" ALL")
 }
 
-// parseCreateTable parses "CREATE TABLE name (col1, col2, ...)"
+// parseCreateTable parses "CREATE TABLE [IF NOT EXISTS] name (col1, col2, ...)"
 func parseCreateTable(query string, db *engine.Database) (interface{}, error) {
 	// Simple parsing strategy:
 	// 1. Remove "CREATE TABLE " prefix
 	// 2. Split by "(" to get name and columns part
 	// 3. Parse columns
-	
+
 	// Case insensitive prefix removal
+	if len(query) <= 13 {
+		return nil, fmt.Errorf("invalid CREATE TABLE syntax: missing table name")
+	}
 	rest := query[13:] // len("CREATE TABLE ")
 	rest = strings.TrimSpace(rest)
+	// "IF NOT EXISTS" leaves an existing table alone and reports which happened
+	ifNotExists := hasIfNotExists(rest)
+	if ifNotExists {
+		rest = strings.TrimSpace(rest[len("IF NOT EXISTS"):])
+	}
 
-	parts := strings.SplitN(rest, "(", 2)
-	if len(parts) != 2 {
+	idxOpen := strings.Index(rest, "(")
+	if idxOpen == -1 {
 		return nil, fmt.Errorf("invalid CREATE TABLE syntax: missing '('")
 	}
 
-	tableName := strings.TrimSpace(parts[0])
-	columnsPart := strings.TrimSuffix(strings.TrimSpace(parts[1]), ")")
-
+	tableName := strings.TrimSpace(rest[:idxOpen])
 	if tableName == "" {
 		return nil, fmt.Errorf("invalid table name")
 	}
+	if err := checkTableName(tableName); err != nil {
+		return nil, err
+	}
+	tableName = ident(tableName)
 
-	// Split columns by comma
-	colsRaw := strings.Split(columnsPart, ",")
+	// The column list must close exactly at the end of the statement
+	idxClose, err := matchingParen(rest, idxOpen)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CREATE TABLE syntax: %w", err)
+	}
+	// Optional "FORMAT TEXT|BINARY" picks the record format of the table file
+	format := storage.FormatText
+	if trailing := strings.TrimSpace(rest[idxClose+1:]); trailing != "" {
+		fields := strings.Fields(trailing)
+		if len(fields) != 2 || !strings.EqualFold(fields[0], "FORMAT") {
+			return nil, fmt.Errorf("invalid CREATE TABLE syntax: unexpected %q after column list", trailing)
+		}
+		if format, err = storage.ParseRecordFormat(fields[1]); err != nil {
+			return nil, fmt.Errorf("invalid CREATE TABLE syntax: %w", err)
+		}
+	}
+
+	columnsPart := strings.TrimSpace(rest[idxOpen+1 : idxClose])
+	if columnsPart == "" {
+		return nil, fmt.Errorf("invalid CREATE TABLE syntax: at least one column is required")
+	}
+
+	// Split columns by top-level commas (types may carry their own parentheses)
+	colsRaw := splitTopLevel(columnsPart, ',')
 	var columns []string
-	for _, c := range colsRaw {
+	for i, c := range colsRaw {
 		col := strings.TrimSpace(c)
+		if col == "" {
+			return nil, fmt.Errorf("invalid CREATE TABLE syntax: empty column definition at position %d", i+1)
+		}
 		// We might want to strip types (e.g. "id int") -> just keep "id" or full string?
 		// Architecture says: "CREATE TABLE name (col1 type, col2 type)"
-		// Engine CreateTable expects []string columns. 
+		// Engine CreateTable expects []string columns.
 		// For simplicity, let's keep the full definition for now or just the name?
 		// Engine doesn't seem to use types yet, just stores metadata.
 		// Let's store the full "name type" string for metadata.
+		// A quoted column name is stored without its quotes.
+		if name, def, _ := strings.Cut(col, " "); isQuoted(name) {
+			col = strings.TrimSpace(ident(name) + " " + def)
+		}
 		if col != "" {
 			columns = append(columns, col)
 		}
 	}
 
-	if err := db.CreateTable(tableName, columns); err != nil {
+	if ifNotExists {
+		result, err := db.CreateTableIfNotExists(tableName, columns, format)
+		if err != nil {
+			return nil, err
+		}
+		return CreateTableResult{CreateResult: result, Message: createMessage(result)}, nil
+	}
+	if err := db.CreateTableWithFormat(tableName, columns, format); err != nil {
 		return nil, err
 	}
 
 	return fmt.Sprintf("Table '%s' created successfully", tableName), nil
 }
 
-// parseInsert parses "INSERT INTO name VALUES (val1, val2, ...)"
-func parseInsert(query string, db *engine.Database) (interface{}, error) {
-	// Remove "INSERT INTO "
-	rest := query[12:] 
-	rest = strings.TrimSpace(rest)
+// CreateTableResult is the result of CREATE TABLE IF NOT EXISTS: whether the
+// table was created or already existed, with a message saying so
+type CreateTableResult struct {
+	engine.CreateResult
+	Message string `json:"message"`
+}
+
+// hasIfNotExists reports whether the rest of a CREATE TABLE starts with
+// "IF NOT EXISTS"
+func hasIfNotExists(rest string) bool {
+	return strings.HasPrefix(strings.ToUpper(rest), "IF NOT EXISTS ")
+}
+
+// createMessage describes what CREATE TABLE IF NOT EXISTS did
+func createMessage(result engine.CreateResult) string {
+	switch {
+	case !result.Created:
+		return fmt.Sprintf("Table '%s' already exists, nothing created", result.Table)
+	case result.Adopted:
+		return fmt.Sprintf("Table '%s' created from its existing file", result.Table)
+	}
+	return fmt.Sprintf("Table '%s' created successfully", result.Table)
+}
+
+// parseAlterTable parses "ALTER TABLE name SET COMPRESSION GZIP|NONE" and
+// "ALTER TABLE name DROP COLUMN col"
+func parseAlterTable(query string, db *engine.Database) (interface{}, error) {
+	fields := strings.Fields(strings.TrimSuffix(strings.TrimSpace(query), ";"))
+	if len(fields) == 6 && strings.EqualFold(fields[3], "DROP") && strings.EqualFold(fields[4], "COLUMN") {
+		tableName, column := ident(fields[2]), ident(fields[5])
+		if err := db.DropColumn(tableName, column); err != nil {
+			return nil, err
+		}
+		return fmt.Sprintf("Column '%s' dropped from table '%s'", column, tableName), nil
+	}
+	if len(fields) != 6 || !strings.EqualFold(fields[3], "SET") || !strings.EqualFold(fields[4], "COMPRESSION") {
+		return nil, fmt.Errorf("invalid ALTER TABLE syntax: expected ALTER TABLE name SET COMPRESSION GZIP|NONE or ALTER TABLE name DROP COLUMN col")
+	}
+	tableName := ident(fields[2])
+
+	var compressed bool
+	switch strings.ToUpper(fields[5]) {
+	case "GZIP":
+		compressed = true
+	case "NONE":
+		compressed = false
+	default:
+		return nil, fmt.Errorf("unsupported compression %s: expected GZIP or NONE", fields[5])
+	}
+
+	if err := db.SetCompression(tableName, compressed); err != nil {
+		return nil, err
+	}
+	return fmt.Sprintf("Table '%s' compression set to %s", tableName, strings.ToUpper(fields[5])), nil
+}
+
+// parseExplainCompact parses "EXPLAIN COMPACT TABLE name" and reports how much
+// space compacting the table would reclaim, without compacting it
+func parseExplainCompact(query string, db *engine.Database) (interface{}, error) {
+	tableName := strings.TrimSpace(query[21:]) // len("EXPLAIN COMPACT TABLE")
+	if tableName == "" || strings.ContainsAny(tableName, " \t") {
+		return nil, fmt.Errorf("invalid EXPLAIN syntax: expected EXPLAIN COMPACT TABLE name")
+	}
+	tableName = ident(tableName)
+
+	liveBytes, deadBytes, err := db.CompactionEstimate(tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	reclaimable := 0.0
+	if total := liveBytes + deadBytes; total > 0 {
+		reclaimable = float64(deadBytes) / float64(total) * 100
+	}
+	return map[string]interface{}{
+		"table":              tableName,
+		"liveBytes":          liveBytes,
+		"deadBytes":          deadBytes,
+		"reclaimablePercent": reclaimable,
+	}, nil
+}
+
+// parseInsert parses "INSERT INTO name VALUES (val1, val2, ...)", optionally followed by
+// "ON CONFLICT (id) DO NOTHING" or "ON CONFLICT (id) DO UPDATE SET col=val, ..."
+// or by "RETURNING cols" to get the inserted row back.
+func parseInsert(query string, db *engine.Database, w writer) (interface{}, error) {
+	query, returning, hasReturning := splitReturning(query)
+
+	// Remove "INSERT INTO ". The prefix is checked on query itself: a bare
+	// "INSERT INTO" is too short to slice, and upper-casing can change the
+	// length of non-ASCII text.
+	if len(query) < 12 || !strings.EqualFold(query[:12], "INSERT INTO ") {
+		return nil, fmt.Errorf("invalid INSERT syntax: expected INSERT INTO name VALUES (...)")
+	}
+	rest := strings.TrimSpace(query[12:])
 
 	// Split by " VALUES " (case insensitive search needed? assuming standard casing from user or strict)
 	// Let's do a case-insensitive split
@@ -199,102 +496,770 @@ func parseInsert(query string, db *engine.Database) (interface{}, error) {
 		return nil, fmt.Errorf("invalid INSERT syntax: missing VALUES")
 	}
 
-	tableName := strings.TrimSpace(rest[:idx])
+	tableName := ident(rest[:idx])
 	valuesPart := strings.TrimSpace(rest[idx+8:]) // len(" VALUES ")
 
+	// Split off an optional ON CONFLICT clause
+	conflictClause := ""
+	if idxConflict := strings.Index(strings.ToUpper(valuesPart), " ON CONFLICT"); idxConflict != -1 {
+		conflictClause = strings.TrimSpace(valuesPart[idxConflict+12:]) // len(" ON CONFLICT")
+		valuesPart = strings.TrimSpace(valuesPart[:idxConflict])
+	}
+
 	if !strings.HasPrefix(valuesPart, "(") || !strings.HasSuffix(valuesPart, ")") {
 		return nil, fmt.Errorf("invalid VALUES syntax: must be enclosed in ()")
 	}
 
 	valuesContent := valuesPart[1 : len(valuesPart)-1]
-	
-	// Split values by comma. Note: this breaks if values contain commas. 
-	// For "Strict Subset" / MVP, simple split is okay.
+
+	// Split values by comma; quote a value ('a, b') to keep its commas.
 	// We need to handle id|active_flag|...
 	// User provides: (1, John, ...)
 	// System needs: 1|1|John|... (active_flag=1 is automatic?)
 	// Architecture says: "INSERT INTO name VALUES (val1, val2)"
 	// Architecture row format: id|active_flag|col1|col2|checksum
-	// So user provides val1 (id), val2 (col1?). 
+	// So user provides val1 (id), val2 (col1?).
 	// Wait, architecture: "INSERT INTO name VALUES (val1, val2)"
 	// Row: id|active|col1|col2...
 	// Does user provide ID? Yes, usually.
 	// Does user provide active_flag? No, that's internal.
 	// So we need to inject active_flag=1.
-	
-	valsRaw := strings.Split(valuesContent, ",")
-	var values []string
-	for _, v := range valsRaw {
-		values = append(values, strings.TrimSpace(v))
+
+	values, err := splitValues(valuesContent)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VALUES syntax: %w", err)
 	}
-	
+
 	if len(values) < 1 {
 		return nil, fmt.Errorf("no values provided")
 	}
 
+	// Serial tables may leave out the id (or pass DEFAULT) to have one assigned
+	metadata, exists := db.Table(tableName)
+	autoID := exists && metadata.AutoIncrement()
+	if autoID && len(values) == len(metadata.Columns)-1 {
+		values = append([]string{""}, values...)
+	}
+	autoID = autoID && (values[0] == "" || strings.EqualFold(values[0], "DEFAULT"))
+
 	// Construct row: ID | 1 | col1 | col2 ...
 	// values[0] is ID.
 	// We need to insert "1" (active) after ID.
-	
+
 	row := make([]string, 0, len(values)+1)
-	row = append(row, values[0]) // ID
-	row = append(row, "1")       // Active Flag
+	row = append(row, values[0])     // ID
+	row = append(row, "1")           // Active Flag
 	row = append(row, values[1:]...) // Rest of columns
 
-	if err := db.InsertRow(tableName, row); err != nil {
+	if conflictClause != "" {
+		if hasReturning {
+			return nil, fmt.Errorf("RETURNING is not supported with ON CONFLICT")
+		}
+		return parseOnConflict(tableName, row, conflictClause, db, w)
+	}
+
+	var returnCols []string
+	if hasReturning {
+		if returnCols, err = returningColumns(tableName, returning, db); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := w.InsertRow(tableName, row); err != nil {
 		return nil, err
 	}
 
+	// InsertRow fills in the assigned id and normalized values
+	if hasReturning {
+		return returningRows(tableName, returnCols, [][]string{row}, db)
+	}
+
+	if autoID {
+		return fmt.Sprintf("Row inserted with id %s", row[0]), nil
+	}
 	return "Row inserted successfully", nil
 }
 
-// parseSelect parses "SELECT * FROM name WHERE id = val"
-func parseSelect(query string, db *engine.Database) (interface{}, error) {
+// parseOnConflict parses "(id) DO NOTHING" or "(id) DO UPDATE SET col=val, ..."
+// and performs the insert as an upsert. Composite key tables name their key
+// columns, e.g. "(a, b) DO NOTHING".
+func parseOnConflict(tableName string, row []string, clause string, db *engine.Database, w writer) (interface{}, error) {
+	// The conflict target is optional, but only the primary key is supported
+	if strings.HasPrefix(clause, "(") {
+		idxClose := strings.Index(clause, ")")
+		if idxClose == -1 {
+			return nil, fmt.Errorf("invalid ON CONFLICT syntax: missing ')'")
+		}
+		target := strings.TrimSpace(clause[1:idxClose])
+		if hasCompositeKey(tableName, db) {
+			if !isKeyTarget(tableName, target, db) {
+				return nil, fmt.Errorf("ON CONFLICT is only supported on the primary key")
+			}
+		} else if !isKeyColumn(tableName, target, db) {
+			return nil, fmt.Errorf("ON CONFLICT is only supported on the primary key '%s'", keyColumn(tableName, db))
+		}
+		clause = strings.TrimSpace(clause[idxClose+1:])
+	}
+
+	upper := strings.ToUpper(clause)
+	var updates map[string]string
+	switch {
+	case upper == "DO NOTHING":
+		// nil updates leave the existing row untouched
+	case strings.HasPrefix(upper, "DO UPDATE SET "):
+		var err error
+		updates, err = parseAssignments(clause[14:]) // len("DO UPDATE SET ")
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("invalid ON CONFLICT syntax: expected DO NOTHING or DO UPDATE SET")
+	}
+
+	inserted, err := w.UpsertRow(tableName, row, updates)
+	if err != nil {
+		return nil, err
+	}
+
+	if inserted {
+		return "Row inserted successfully", nil
+	}
+	if updates == nil {
+		return "Row already exists, nothing inserted", nil
+	}
+	return "Row updated successfully", nil
+}
+
+// parseSelect parses a SELECT statement and returns its rows typed by the table schema
+func parseSelect(query string, db *engine.Database, trace *engine.Trace) (interface{}, error) {
+	if selects, all, ok := splitUnion(query); ok {
+		return parseUnion(selects, all, db, trace)
+	}
+	upper := strings.ToUpper(query)
+	if isValuesSelect(upper) {
+		return parseSelectValues(query, db, trace)
+	}
+	if strings.Contains(upper, " GROUP BY ") {
+		return parseGroupBy(query, db, trace)
+	}
+	if idxFrom := indexKeyword(query, " FROM "); idxFrom > 7 && hasAggregates(query[7:idxFrom]) {
+		return parseSelectAggregates(query, db, trace)
+	}
+	if strings.HasPrefix(upper, "SELECT * EXCEPT") {
+		return parseSelectExcept(query, db, trace)
+	}
+	if !strings.HasPrefix(upper, "SELECT * ") {
+		if idxFrom := strings.Index(upper, " FROM "); idxFrom > 7 && hasExpressions(query[7:idxFrom]) {
+			return parseSelectExprs(query, db, trace)
+		}
+		return parseSelectColumns(query, db, trace)
+	}
+
+	tableName, rows, err := selectRows(query, db, trace)
+	if err != nil {
+		return nil, err
+	}
+
+	columns, err := db.RowColumns(tableName)
+	if err != nil {
+		return nil, err
+	}
+	start := trace.Start()
+	defer trace.Stop(engine.StageProject, start)
+	return db.TypeRows(tableName, columns, rows)
+}
+
+// selectRows parses "SELECT * FROM name [WHERE ...] [ORDER BY col [ASC|DESC]]
+// [LIMIT n]" and returns the table name along with the matching stored rows.
+// ORDER BY and LIMIT apply after the filter; without them rows come in the
+// order the filter lists them.
+func selectRows(query string, db *engine.Database, trace *engine.Trace) (string, [][]string, error) {
+	query, order, err := splitResultOrder(query)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(query) < 14 { // len("SELECT * FROM ")
+		return "", nil, fmt.Errorf("only 'SELECT * FROM ...' supported")
+	}
+	rest := query[14:]
+	tableName := fromTableName("FROM " + rest)
+	if err := order.check(tableName, db); err != nil {
+		return "", nil, err
+	}
+
+	// "SELECT * FROM name LIMIT n" only reads the first n rows
+	if order.column == "" && order.limit >= 0 && indexKeyword(rest, " WHERE ") == -1 && indexKeyword(rest, " TAIL ") == -1 {
+		rows, err := db.Reader(trace).SelectFirst(tableName, order.limit)
+		return tableName, rows, err
+	}
+
+	tableName, rows, err := filterRows(query, db, trace)
+	if err != nil {
+		return "", nil, err
+	}
+	rows, err = order.apply(tableName, rows, db, trace)
+	return tableName, rows, err
+}
+
+// filterRows parses "SELECT * FROM name WHERE id = val" and returns the table name
+// along with the matching stored rows
+func filterRows(query string, db *engine.Database, trace *engine.Trace) (string, [][]string, error) {
 	// Strict subset: "SELECT * FROM name WHERE id = val"
 	// We assume strictly this format for now.
-	
+
 	upper := strings.ToUpper(query)
 	if !strings.HasPrefix(upper, "SELECT * FROM ") {
-		return nil, fmt.Errorf("only 'SELECT * FROM ...' supported")
+		return "", nil, fmt.Errorf("only 'SELECT * FROM ...' supported")
 	}
 
 	rest := query[14:] // len("SELECT * FROM ")
-	
-	parts := strings.SplitN(upper[14:], " WHERE ", 2)
-	
-	if len(parts) == 1 {
+
+	idxWhere := indexKeyword(rest, " WHERE ")
+
+	// "SELECT * FROM name TAIL n" reads the n most recently written rows
+	if indexKeyword(rest, " TAIL ") != -1 {
+		if idxWhere != -1 {
+			return "", nil, fmt.Errorf("TAIL cannot be combined with WHERE")
+		}
+		tableName, n, _, err := splitTail(strings.TrimSpace(rest))
+		if err != nil {
+			return "", nil, err
+		}
+		tableName = ident(tableName)
+		rows, err := db.Reader(trace).TailRows(tableName, n)
+		if err != nil {
+			return "", nil, err
+		}
+		return tableName, rows, nil
+	}
+
+	if idxWhere == -1 {
 		// No WHERE clause, assume Select All
-		tableName := strings.TrimSpace(query[14:]) // Use original query for case
-		rows, err := db.SelectAll(tableName)
+		tableName := ident(query[14:]) // Use original query for case
+		rows, err := db.Reader(trace).SelectAll(tableName)
 		if err != nil {
-			return nil, err
+			return "", nil, err
+		}
+		return tableName, rows, nil
+	}
+
+	tableName := ident(rest[:idxWhere])
+	whereClause := strings.TrimSpace(rest[idxWhere+7:]) // +7 for " WHERE "
+
+	// Parse "[NOT] EXISTS (SELECT ... FROM t WHERE t.col = outer.col ...)"
+	if subquery, negate, ok, err := splitExists(whereClause); err != nil {
+		return "", nil, err
+	} else if ok {
+		rows, err := selectExists(tableName, subquery, negate, db, trace)
+		return tableName, rows, err
+	}
+
+	// Parse "col IN (SELECT ...)" or "col IN (v1, v2, ...)"
+	if col, list, ok := splitIn(whereClause); ok {
+		rows, err := parseIn(tableName, col, list, db, trace)
+		return tableName, rows, err
+	}
+
+	// Parse "id BETWEEN lo AND hi" (range scan over the ordered keys)
+	if idxBetween := indexKeyword(whereClause, " BETWEEN "); idxBetween != -1 {
+		rows, err := parseBetween(tableName, whereClause, idxBetween, db, trace)
+		return tableName, rows, err
+	}
+
+	// Parse "a = x AND b = y" over a composite primary key (index lookup)
+	composite := hasCompositeKey(tableName, db)
+	if composite && indexKeyword(whereClause, " AND ") != -1 {
+		key, err := compositeKey(tableName, whereClause, db)
+		if err != nil {
+			return "", nil, err
+		}
+		row, err := db.Reader(trace).FindByID(tableName, key)
+		if err != nil {
+			return "", nil, err
+		}
+		return tableName, [][]string{row}, nil
+	}
+
+	// Parse "col op value AND col op value ...", e.g. "amount > 1000 AND
+	// status = 'done'" (full scan)
+	if indexKeyword(whereClause, " AND ") != -1 {
+		preds, err := parsePredicates(tableName, whereClause)
+		if err != nil {
+			return "", nil, err
 		}
-		return rows, nil
+		rows, err := db.Reader(trace).SelectWhere(tableName, preds)
+		return tableName, rows, err
+	}
+
+	columns, err := db.RowColumns(tableName)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// Parse "col op value" on a date or timestamp column, compared as times
+	if cond, ok, err := timeComparison(tableName, whereClause, columns, db); err != nil {
+		return "", nil, err
+	} else if ok {
+		rows, err := selectWhere(tableName, columns, cond, db, trace)
+		return tableName, rows, err
 	}
-	
-	// Re-slice from original 'rest' to preserve case of table name (if needed)
-	// parts[0] length in rest is same as in upper
-	tableName := strings.TrimSpace(rest[:len(parts[0])])
-	whereClause := strings.TrimSpace(rest[len(parts[0])+7:]) // +7 for " WHERE "
-	
-	// Parse "id = val"
-	condParts := strings.Split(whereClause, "=")
+
+	// Parse "a op b" comparing two columns of each row, e.g. "debit != credit"
+	if cond, ok, err := columnComparison(tableName, whereClause, columns, db); err != nil {
+		return "", nil, err
+	} else if ok {
+		rows, err := selectWhere(tableName, columns, cond, db, trace)
+		return tableName, rows, err
+	}
+
+	// Parse "col op value" comparing with a literal, e.g. "amount > 1000"
+	if preds, err := parsePredicates(tableName, whereClause); err == nil && preds[0].Op != "=" {
+		rows, err := db.Reader(trace).SelectWhere(tableName, preds)
+		return tableName, rows, err
+	}
+
+	// Parse "id = val"; val may be quoted ('Nairobi, Kenya')
+	condParts := splitTopLevel(whereClause, '=')
 	if len(condParts) != 2 {
-		return nil, fmt.Errorf("invalid WHERE clause, expected 'id = val'")
-	}
-	
-	col := strings.TrimSpace(condParts[0])
-	val := strings.TrimSpace(condParts[1])
-	
-	// Handle search by ID or generic column
-	if strings.ToLower(col) == "id" {
-		row, err := db.FindByID(tableName, val)
+		return "", nil, fmt.Errorf("invalid WHERE clause, expected 'id = val'")
+	}
+
+	col, err := unqualifyColumn(strings.TrimSpace(condParts[0]), tableName)
+	if err != nil {
+		return "", nil, err
+	}
+	val, err := unquoteValue(condParts[1])
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid WHERE clause: %w", err)
+	}
+
+	// Handle search by primary key (index lookup) or generic column (scan)
+	if isKeyColumn(tableName, col, db) {
+		row, err := db.Reader(trace).FindByID(tableName, val)
 		if err != nil {
-			return nil, err
+			return "", nil, err
 		}
-		return [][]string{row}, nil
+		return tableName, [][]string{row}, nil
 	} else {
 		// Generic column search
-		return db.SelectByColumn(tableName, col, val)
+		rows, err := db.Reader(trace).SelectByColumn(tableName, col, val)
+		return tableName, rows, err
+	}
+}
+
+// splitIn splits a "col IN (list)" condition into the column reference and the
+// text between the parentheses
+func splitIn(whereClause string) (string, string, bool) {
+	idxIn := indexKeyword(whereClause, " IN ")
+	if idxIn == -1 {
+		return "", "", false
+	}
+	col := strings.TrimSpace(whereClause[:idxIn])
+	list := strings.TrimSpace(whereClause[idxIn+4:]) // len(" IN ")
+	if col == "" || strings.Contains(col, " ") || !strings.HasPrefix(list, "(") || !strings.HasSuffix(list, ")") {
+		return "", "", false
+	}
+	return col, list[1 : len(list)-1], true
+}
+
+// parseIn evaluates "col IN (...)". The list is either literal values or an
+// uncorrelated single-column subquery, which runs first and supplies the values.
+func parseIn(tableName, colRef, list string, db *engine.Database, trace *engine.Trace) ([][]string, error) {
+	col, err := unqualifyColumn(colRef, tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	list = strings.TrimSpace(list)
+	var values []string
+	if strings.HasPrefix(strings.ToUpper(list), "SELECT ") {
+		values, err = subqueryValues(list, db, trace)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		all, err := splitValues(list)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IN clause: %w", err)
+		}
+		for _, v := range all {
+			if v != "" {
+				values = append(values, v)
+			}
+		}
+		if len(values) == 0 {
+			return nil, fmt.Errorf("invalid IN clause: empty value list")
+		}
+	}
+
+	return db.Reader(trace).SelectIn(tableName, col, values)
+}
+
+// subqueryValues runs the SELECT inside an IN (...) and returns its single column
+func subqueryValues(query string, db *engine.Database, trace *engine.Trace) ([]string, error) {
+	upper := strings.ToUpper(query)
+	if strings.HasPrefix(upper, "SELECT *") {
+		return nil, fmt.Errorf("subquery must select a single column, not *")
+	}
+	if strings.Contains(upper, " GROUP BY ") {
+		return nil, fmt.Errorf("GROUP BY is not supported in subqueries")
+	}
+
+	_, columns, rows, err := selectColumns(query, db, trace)
+	if errors.Is(err, engine.ErrRowNotFound) {
+		// A lookup by key that finds nothing is an empty result, not a failure
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("subquery failed: %w", err)
+	}
+	if len(columns) != 1 {
+		return nil, fmt.Errorf("subquery must select a single column, got %d", len(columns))
+	}
+
+	values := make([]string, len(rows))
+	for i, row := range rows {
+		values[i] = row[0]
+	}
+	return values, nil
+}
+
+// parseBetween parses the "id BETWEEN lo AND hi" part of a WHERE clause
+func parseBetween(tableName, whereClause string, idxBetween int, db *engine.Database, trace *engine.Trace) ([][]string, error) {
+	col, err := unqualifyColumn(strings.TrimSpace(whereClause[:idxBetween]), tableName)
+	if err != nil {
+		return nil, err
+	}
+	bounds := whereClause[idxBetween+9:] // len(" BETWEEN ")
+
+	idxAnd := indexKeyword(bounds, " AND ")
+	if idxAnd == -1 {
+		return nil, fmt.Errorf("invalid BETWEEN clause, expected 'id BETWEEN lo AND hi'")
+	}
+
+	lo, err := unquoteValue(bounds[:idxAnd])
+	if err != nil {
+		return nil, fmt.Errorf("invalid BETWEEN clause: %w", err)
+	}
+	hi, err := unquoteValue(bounds[idxAnd+5:]) // len(" AND ")
+	if err != nil {
+		return nil, fmt.Errorf("invalid BETWEEN clause: %w", err)
+	}
+	if lo == "" || hi == "" {
+		return nil, fmt.Errorf("invalid BETWEEN clause, expected 'id BETWEEN lo AND hi'")
+	}
+
+	if !isKeyColumn(tableName, col, db) {
+		if hasCompositeKey(tableName, db) {
+			return nil, fmt.Errorf("BETWEEN is not supported on tables with a composite primary key")
+		}
+		return nil, fmt.Errorf("BETWEEN is only supported on the primary key '%s'", keyColumn(tableName, db))
+	}
+
+	return db.Reader(trace).RangeByID(tableName, lo, hi)
+}
+
+// parseSelectExcept parses "SELECT * EXCEPT (col1, col2) FROM name [WHERE ...]".
+// It runs the plain SELECT * and then projects every schema column except the named ones.
+func parseSelectExcept(query string, db *engine.Database, trace *engine.Trace) (interface{}, error) {
+	tableName, fromPart, kept, err := exceptColumns(query, db)
+	if err != nil {
+		return nil, err
+	}
+
+	_, rows, err := selectRows("SELECT * "+fromPart, db, trace)
+	if err != nil {
+		return nil, err
+	}
+
+	start := trace.Start()
+	defer trace.Stop(engine.StageProject, start)
+	projected, err := db.ProjectColumns(tableName, rows, kept)
+	if err != nil {
+		return nil, err
+	}
+	return db.TypeRows(tableName, kept, projected)
+}
+
+// exceptColumns parses the column list and FROM clause of a
+// "SELECT * EXCEPT (...)" query and returns the table, the FROM clause and the
+// schema columns that survive, rejecting unknown names
+func exceptColumns(query string, db *engine.Database) (string, string, []string, error) {
+	rest := strings.TrimSpace(query[15:]) // len("SELECT * EXCEPT")
+	if !strings.HasPrefix(rest, "(") {
+		return "", "", nil, fmt.Errorf("invalid EXCEPT syntax: column list must be enclosed in ()")
+	}
+
+	idxClose := strings.Index(rest, ")")
+	if idxClose == -1 {
+		return "", "", nil, fmt.Errorf("invalid EXCEPT syntax: missing ')'")
+	}
+
+	// The remainder is a regular "FROM name [WHERE ...]"
+	fromPart := strings.TrimSpace(rest[idxClose+1:])
+	if !strings.HasPrefix(strings.ToUpper(fromPart), "FROM ") {
+		return "", "", nil, fmt.Errorf("invalid EXCEPT syntax: expected FROM after column list")
+	}
+	tableName := fromTableName(fromPart)
+
+	excluded, err := parseColumnList(rest[1:idxClose], tableName)
+	if err != nil {
+		return "", "", nil, err
+	}
+	if len(excluded) == 0 {
+		return "", "", nil, fmt.Errorf("EXCEPT requires at least one column")
+	}
+
+	allColumns, err := db.ColumnNames(tableName)
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	drop := make(map[int]bool, len(excluded))
+	for _, ex := range excluded {
+		pos, err := engine.ResolveColumn(tableName, allColumns, ex)
+		if err != nil {
+			return "", "", nil, err
+		}
+		drop[pos] = true
+	}
+
+	var kept []string
+	for i, col := range allColumns {
+		if !drop[i] {
+			kept = append(kept, col)
+		}
+	}
+
+	if len(kept) == 0 {
+		return "", "", nil, fmt.Errorf("EXCEPT cannot exclude every column")
+	}
+	return tableName, fromPart, kept, nil
+}
+
+// parseSelectColumns parses "SELECT col1, t.col2 FROM t [WHERE ...]".
+// It runs the plain SELECT * and then projects the listed columns in order.
+func parseSelectColumns(query string, db *engine.Database, trace *engine.Trace) (interface{}, error) {
+	tableName, columns, projected, err := selectColumns(query, db, trace)
+	if err != nil {
+		return nil, err
+	}
+	start := trace.Start()
+	defer trace.Stop(engine.StageProject, start)
+	return db.TypeRows(tableName, columns, projected)
+}
+
+// selectColumns runs "SELECT col1, t.col2 FROM t [WHERE ...]" and returns the
+// table name, the selected columns and the projected stored values
+func selectColumns(query string, db *engine.Database, trace *engine.Trace) (string, []string, [][]string, error) {
+	if len(query) <= 7 {
+		return "", nil, nil, fmt.Errorf("invalid SELECT syntax: no columns selected")
+	}
+	rest := query[7:] // len("SELECT ")
+
+	idxFrom := strings.Index(strings.ToUpper(rest), " FROM ")
+	if idxFrom == -1 {
+		return "", nil, nil, fmt.Errorf("invalid SELECT syntax: missing FROM")
+	}
+
+	fromPart := strings.TrimSpace(rest[idxFrom+1:])
+	tableName := fromTableName(fromPart)
+
+	columns, err := parseColumnList(rest[:idxFrom], tableName)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	if len(columns) == 0 {
+		return "", nil, nil, fmt.Errorf("invalid SELECT syntax: no columns selected")
+	}
+	if err := db.CheckColumns(tableName, "SELECT list", columns); err != nil {
+		return "", nil, nil, err
+	}
+
+	_, rows, err := selectRows("SELECT * "+fromPart, db, trace)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	start := trace.Start()
+	projected, err := db.ProjectColumns(tableName, rows, columns)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	trace.Stop(engine.StageProject, start)
+	return tableName, columns, projected, nil
+}
+
+// fromTableName extracts the table name from "FROM name [WHERE ...|TAIL n]"
+func fromTableName(fromPart string) string {
+	tableName := strings.TrimSpace(fromPart[5:]) // len("FROM ")
+	if idxWhere := strings.Index(strings.ToUpper(tableName), " WHERE "); idxWhere != -1 {
+		tableName = strings.TrimSpace(tableName[:idxWhere])
+	}
+	for _, keyword := range []string{" TAIL ", " ORDER BY ", " LIMIT "} {
+		if idx := strings.Index(strings.ToUpper(tableName), keyword); idx != -1 {
+			tableName = strings.TrimSpace(tableName[:idx])
+		}
+	}
+	return ident(tableName)
+}
+
+// parseColumnList splits a comma separated list of column references,
+// resolving any "table.column" qualifiers against the FROM table
+func parseColumnList(list, tableName string) ([]string, error) {
+	var columns []string
+	for _, c := range strings.Split(list, ",") {
+		ref := strings.TrimSpace(c)
+		if ref == "" {
+			continue
+		}
+		col, err := unqualifyColumn(ref, tableName)
+		if err != nil {
+			return nil, err
+		}
+		columns = append(columns, col)
+	}
+	return columns, nil
+}
+
+// unqualifyColumn strips a "table." (or "schema.table.") qualifier from a
+// column reference. Single-table queries only accept the FROM table as qualifier.
+func unqualifyColumn(ref, tableName string) (string, error) {
+	ref = ident(ref)
+	idxDot := strings.LastIndex(ref, ".")
+	if idxDot == -1 {
+		return ref, nil
+	}
+
+	qualifier := ref[:idxDot]
+	if !qualifies(qualifier, tableName) {
+		return "", fmt.Errorf("column reference %s does not match table %s", ref, tableName)
+	}
+	return ref[idxDot+1:], nil
+}
+
+// qualifies reports whether a column qualifier names the table. A
+// schema-qualified table can be referred to with or without its schema
+// (sales.orders.id or orders.id).
+func qualifies(qualifier, tableName string) bool {
+	if strings.EqualFold(qualifier, tableName) {
+		return true
+	}
+	_, table, ok := strings.Cut(tableName, ".")
+	return ok && strings.EqualFold(qualifier, table)
+}
+
+// matchingParen returns the index of the ')' closing the '(' at position open.
+// It reports an error when the parentheses are unbalanced.
+func matchingParen(s string, open int) (int, error) {
+	depth := 0
+	for i := open; i < len(s); i++ {
+		switch s[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i, nil
+			}
+		}
+	}
+	return -1, fmt.Errorf("unbalanced parentheses: missing ')'")
+}
+
+// splitTopLevel splits s on sep, ignoring separators nested inside parentheses
+// or single-quoted values, so "note = 'a, b = c'" splits into one assignment
+func splitTopLevel(s string, sep byte) []string {
+	var parts []string
+	depth, start, inQuote := 0, 0, false
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\'':
+			inQuote = !inQuote
+		case inQuote:
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == sep && depth == 0:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// unquoteValue reads one value of a SET clause or WHERE comparison. A
+// single-quoted value has its quotes stripped and a doubled quote read as one;
+// anything else is trimmed of surrounding spaces.
+func unquoteValue(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if !strings.HasPrefix(value, "'") {
+		return value, nil
+	}
+	var unquoted strings.Builder
+	for i := 1; i < len(value); i++ {
+		switch {
+		case value[i] != '\'':
+			unquoted.WriteByte(value[i])
+		case i+1 < len(value) && value[i+1] == '\'':
+			unquoted.WriteByte('\'')
+			i++
+		case strings.TrimSpace(value[i+1:]) != "":
+			return "", fmt.Errorf("unexpected %q after quoted value %s", strings.TrimSpace(value[i+1:]), value[:i+1])
+		default:
+			return unquoted.String(), nil
+		}
+	}
+	return "", fmt.Errorf("unterminated quoted value %s", value)
+}
+
+// splitValues splits a VALUES list on commas. A value may be a single-quoted
+// string, which can contain commas and writes a literal quote as two; the quotes
+// are stripped. Unquoted values are trimmed of surrounding spaces.
+func splitValues(list string) ([]string, error) {
+	var values []string
+	var current strings.Builder
+	quoted, inQuote, closed := false, false, false
+
+	finish := func() {
+		value := current.String()
+		if !quoted {
+			value = strings.TrimSpace(value)
+		}
+		values = append(values, value)
+		current.Reset()
+		quoted, closed = false, false
+	}
+
+	for i := 0; i < len(list); i++ {
+		c := list[i]
+		switch {
+		case inQuote:
+			if c != '\'' {
+				current.WriteByte(c)
+			} else if i+1 < len(list) && list[i+1] == '\'' {
+				current.WriteByte('\'')
+				i++
+			} else {
+				inQuote, closed = false, true
+			}
+		case c == ',':
+			finish()
+		case c == '\'' && !quoted && strings.TrimSpace(current.String()) == "":
+			current.Reset()
+			quoted, inQuote = true, true
+		case closed:
+			if c != ' ' && c != '\t' {
+				return nil, fmt.Errorf("unexpected %q after quoted value", string(c))
+			}
+		default:
+			current.WriteByte(c)
+		}
+	}
+	if inQuote {
+		return nil, fmt.Errorf("unterminated quoted value")
 	}
+	finish()
+	return values, nil
 }
@@ -0,0 +1,426 @@
+package parser
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"pesapal-ledger/engine"
+	"pesapal-ledger/storage"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// mustExecute runs a statement and fails the test if it errors
+func mustExecute(t testing.TB, db *engine.Database, query string) interface{} {
+	t.Helper()
+	result, err := Execute(db, query)
+	if err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+	return result
+}
+
+// queryRows runs a SELECT and returns its result rows
+func queryRows(t testing.TB, db *engine.Database, query string) [][]interface{} {
+	t.Helper()
+	rows, ok := mustExecute(t, db, query).([][]interface{})
+	if !ok {
+		t.Fatalf("%s: result is not a row set", query)
+	}
+	return rows
+}
+
+func TestInsertOnConflict(t *testing.T) {
+	tests := []struct {
+		name    string
+		insert  string
+		message string
+		want    []interface{} // the row with id 1 afterwards
+	}{
+		{
+			name:    "do nothing",
+			insert:  "INSERT INTO users VALUES (1, bob) ON CONFLICT (id) DO NOTHING",
+			message: "Row already exists, nothing inserted",
+			want:    []interface{}{int64(1), "alice"},
+		},
+		{
+			name:    "do update",
+			insert:  "INSERT INTO users VALUES (1, bob) ON CONFLICT (id) DO UPDATE SET name = carol",
+			message: "Row updated successfully",
+			want:    []interface{}{int64(1), "carol"},
+		},
+		{
+			name:    "no target",
+			insert:  "insert into users values (1, bob) on conflict do update set name = dave",
+			message: "Row updated successfully",
+			want:    []interface{}{int64(1), "dave"},
+		},
+		{
+			name:    "new key",
+			insert:  "INSERT INTO users VALUES (2, erin) ON CONFLICT (id) DO NOTHING",
+			message: "Row inserted successfully",
+			want:    []interface{}{int64(1), "alice"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t,
+				"CREATE TABLE users (id int, name text)",
+				"INSERT INTO users VALUES (1, alice)",
+			)
+			result, err := Execute(db, tt.insert)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result != tt.message {
+				t.Errorf("result = %v, want %q", result, tt.message)
+			}
+
+			rows, err := Execute(db, "SELECT id, name FROM users WHERE id = 1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := rows.([][]interface{}); len(got) != 1 || !reflect.DeepEqual(got[0], tt.want) {
+				t.Errorf("row 1 = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInsertOnConflictErrors(t *testing.T) {
+	tests := []string{
+		"INSERT INTO users VALUES (1, bob) ON CONFLICT (name) DO NOTHING",
+		"INSERT INTO users VALUES (1, bob) ON CONFLICT (id DO NOTHING",
+		"INSERT INTO users VALUES (1, bob) ON CONFLICT (id) DO SOMETHING",
+		"INSERT INTO users VALUES (1, bob) ON CONFLICT (id) DO NOTHING RETURNING id",
+	}
+	for _, query := range tests {
+		t.Run(query, func(t *testing.T) {
+			db := newTestDB(t,
+				"CREATE TABLE users (id int, name text)",
+				"INSERT INTO users VALUES (1, alice)",
+			)
+			if result, err := Execute(db, query); err == nil {
+				t.Errorf("got %v, want an error", result)
+			}
+		})
+	}
+}
+
+func TestSelectExcept(t *testing.T) {
+	db := newTestDB(t,
+		"CREATE TABLE notes (id int, title text, internal_notes text, amount int)",
+		"INSERT INTO notes VALUES (1, rent, secret, 10)",
+		"INSERT INTO notes VALUES (2, food, private, 20)",
+	)
+
+	tests := []struct {
+		query string
+		want  [][]interface{}
+	}{
+		{
+			query: "SELECT * EXCEPT (internal_notes) FROM notes",
+			want:  [][]interface{}{{int64(1), "rent", int64(10)}, {int64(2), "food", int64(20)}},
+		},
+		{
+			query: "SELECT * EXCEPT (internal_notes, AMOUNT) FROM notes WHERE id = 2",
+			want:  [][]interface{}{{int64(2), "food"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			if got := queryRows(t, db, tt.query); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := Execute(db, "SELECT * EXCEPT (nope) FROM notes"); err == nil {
+		t.Error("excluding an unknown column succeeded")
+	}
+}
+
+func TestWholeTableMutations(t *testing.T) {
+	tests := []struct {
+		query    string
+		affected int    // -1 when the statement must be refused
+		left     int    // live rows afterwards
+		amount   string // amount of row 1 afterwards, if any are left
+	}{
+		{query: "DELETE FROM ledger", affected: -1, left: 3, amount: "10"},
+		{query: "UPDATE ledger SET amount = 0", affected: -1, left: 3, amount: "10"},
+		{query: "DELETE FROM ledger ALL", affected: 3, left: 0},
+		{query: "delete from ledger all", affected: 3, left: 0},
+		{query: "UPDATE ledger SET amount = 0 ALL", affected: 3, left: 3, amount: "0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			db := newTestDB(t,
+				"CREATE TABLE ledger (id int, amount int)",
+				"INSERT INTO ledger VALUES (1, 10)",
+				"INSERT INTO ledger VALUES (2, 20)",
+				"INSERT INTO ledger VALUES (3, 30)",
+			)
+			result, err := Execute(db, tt.query)
+			if tt.affected < 0 {
+				if err == nil {
+					t.Fatalf("got %v, want the missing WHERE error", result)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			} else if got := result.(MutationResult).Affected; got != tt.affected {
+				t.Errorf("affected = %d, want %d", got, tt.affected)
+			}
+
+			rows := queryRows(t, db, "SELECT id, amount FROM ledger")
+			if len(rows) != tt.left {
+				t.Fatalf("%d rows left, want %d", len(rows), tt.left)
+			}
+			if tt.left > 0 && fmt.Sprint(rows[0][1]) != tt.amount {
+				t.Errorf("row 1 amount = %v, want %s", rows[0][1], tt.amount)
+			}
+		})
+	}
+}
+
+func TestQualifiedColumns(t *testing.T) {
+	db := newTestDB(t,
+		"CREATE TABLE ledger (id int, name text, amount int)",
+		"INSERT INTO ledger VALUES (1, alice, 10)",
+		"INSERT INTO ledger VALUES (2, bob, 20)",
+	)
+
+	tests := []struct {
+		query string
+		want  [][]interface{}
+	}{
+		{"SELECT ledger.id, ledger.name FROM ledger", [][]interface{}{{int64(1), "alice"}, {int64(2), "bob"}}},
+		{"SELECT ledger.id FROM ledger WHERE ledger.amount = 20", [][]interface{}{{int64(2)}}},
+		{"SELECT id FROM ledger WHERE LEDGER.id = 1", [][]interface{}{{int64(1)}}},
+		{"SELECT ledger.id FROM ledger ORDER BY ledger.amount DESC", [][]interface{}{{int64(2)}, {int64(1)}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			if got := queryRows(t, db, tt.query); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	for _, query := range []string{
+		"SELECT other.id FROM ledger",
+		"SELECT id FROM ledger WHERE other.amount = 20",
+	} {
+		if _, err := Execute(db, query); err == nil || !strings.Contains(err.Error(), "does not match table ledger") {
+			t.Errorf("%s: got %v, want a mismatched qualifier error", query, err)
+		}
+	}
+}
+
+func TestCreateTableSyntax(t *testing.T) {
+	tests := []struct {
+		query   string
+		wantErr string
+	}{
+		{"CREATE TABLE t ()", "at least one column is required"},
+		{"CREATE TABLE t (   )", "at least one column is required"},
+		{"CREATE TABLE t (id int", "missing ')'"},
+		{"CREATE TABLE t (id int, amount decimal(10, 2)", "missing ')'"},
+		{"CREATE TABLE t (id int))", `unexpected ")" after column list`},
+		{"CREATE TABLE t", "missing '('"},
+		{"CREATE TABLE t id int", "missing '('"},
+		{"CREATE TABLE ", "missing table name"},
+		{"CREATE TABLE t (id int,)", "empty column definition at position 2"},
+		{"CREATE TABLE t (id int) FORMAT", "after column list"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			db := newTestDB(t)
+			_, err := Execute(db, tt.query)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got %v, want an error containing %q", err, tt.wantErr)
+			}
+			// Nothing was created
+			if _, err := Execute(db, "SELECT * FROM t"); err == nil {
+				t.Error("a rejected CREATE TABLE left a usable table behind")
+			}
+		})
+	}
+
+	db := newTestDB(t)
+	mustExecute(t, db, "CREATE TABLE t (id int, amount decimal(10, 2))")
+	mustExecute(t, db, "INSERT INTO t VALUES (1, 2.50)")
+}
+
+func TestInSubquery(t *testing.T) {
+	db := newTestDB(t,
+		"CREATE TABLE accounts (id int, active bool)",
+		"CREATE TABLE txns (id int, account_id int, amount int)",
+		"INSERT INTO accounts VALUES (1, true)",
+		"INSERT INTO accounts VALUES (2, false)",
+		"INSERT INTO accounts VALUES (3, true)",
+		"INSERT INTO txns VALUES (10, 1, 5)",
+		"INSERT INTO txns VALUES (11, 2, 6)",
+		"INSERT INTO txns VALUES (12, 3, 7)",
+		"INSERT INTO txns VALUES (13, 1, 8)",
+	)
+
+	tests := []struct {
+		name  string
+		query string
+		want  []int64
+	}{
+		{"many values", "SELECT id FROM txns WHERE account_id IN (SELECT id FROM accounts WHERE active = 'true')", []int64{10, 12, 13}},
+		{"one value", "SELECT id FROM txns WHERE account_id IN (SELECT id FROM accounts WHERE active = false)", []int64{11}},
+		{"one value by key", "SELECT id FROM txns WHERE account_id IN (SELECT id FROM accounts WHERE id = 2)", []int64{11}},
+		{"no values", "SELECT id FROM txns WHERE account_id IN (SELECT id FROM accounts WHERE id > 50)", nil},
+		{"no values by key", "SELECT id FROM txns WHERE account_id IN (SELECT id FROM accounts WHERE id = 99)", nil},
+		{"whole table", "SELECT id FROM txns WHERE account_id IN (SELECT id FROM accounts)", []int64{10, 11, 12, 13}},
+		{"literal list", "SELECT id FROM txns WHERE account_id IN (1, 3)", []int64{10, 12, 13}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []int64
+			for _, row := range queryRows(t, db, tt.query) {
+				got = append(got, row[0].(int64))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got ids %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	for _, query := range []string{
+		"SELECT id FROM txns WHERE account_id IN (SELECT id, active FROM accounts)",
+		"SELECT id FROM txns WHERE account_id IN (SELECT * FROM accounts)",
+		"SELECT id FROM txns WHERE account_id IN (SELECT id FROM missing)",
+	} {
+		if _, err := Execute(db, query); err == nil {
+			t.Errorf("%s: no error", query)
+		}
+	}
+}
+
+func TestCreateTableIfNotExists(t *testing.T) {
+	db := newTestDB(t)
+	// A file left without metadata, as by a crash between the two
+	if err := os.WriteFile(filepath.Join(storage.DataDir(), "orphan.db"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		query   string
+		want    CreateTableResult
+		wantErr string
+	}{
+		{"CREATE TABLE IF NOT EXISTS ledger (id int, amount int)",
+			CreateTableResult{engine.CreateResult{Table: "ledger", Created: true}, "Table 'ledger' created successfully"}, ""},
+		{"CREATE TABLE IF NOT EXISTS ledger (id int, amount int)",
+			CreateTableResult{engine.CreateResult{Table: "ledger"}, "Table 'ledger' already exists, nothing created"}, ""},
+		{"create table if not exists ledger (id int, note text, other text)",
+			CreateTableResult{engine.CreateResult{Table: "ledger"}, "Table 'ledger' already exists, nothing created"}, ""},
+		{"CREATE TABLE IF NOT EXISTS orphan (id int)",
+			CreateTableResult{engine.CreateResult{Table: "orphan", Created: true, Adopted: true}, "Table 'orphan' created from its existing file"}, ""},
+		{"CREATE TABLE ledger (id int, amount int)", CreateTableResult{}, "table ledger already exists"},
+		{"CREATE TABLE IF NOT EXISTS bad (id int, id text)", CreateTableResult{}, "invalid schema for table bad"},
+		{"CREATE TABLE IF NOT EXISTS (id int)", CreateTableResult{}, "invalid table name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			got, err := Execute(db, tt.query)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got %v, want an error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	// The existing schema was kept
+	mustExecute(t, db, "INSERT INTO ledger VALUES (1, 5)")
+	if got, want := queryRows(t, db, "SELECT amount FROM ledger WHERE id = 1"), [][]interface{}{{int64(5)}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if tables := db.ListTables(); !reflect.DeepEqual(tables, []string{"ledger", "orphan"}) {
+		t.Errorf("tables = %v", tables)
+	}
+}
+
+func TestVarcharLength(t *testing.T) {
+	db := newTestDB(t, "CREATE TABLE people (id int, name varchar(5), code char (2))")
+
+	tests := []struct {
+		query   string
+		wantErr string // "" for a statement that runs
+	}{
+		{"INSERT INTO people VALUES (1, abc, KE)", ""},
+		{"INSERT INTO people VALUES (2, abcde, K)", ""},
+		{"INSERT INTO people VALUES (3, abcdef, KE)", "value too long for column name: 6 characters, the limit is varchar(5)"},
+		{"INSERT INTO people VALUES (3, 'a, b c', KE)", "value too long for column name"},
+		{"INSERT INTO people VALUES (3, a, KEN)", "the limit is char(2)"},
+		{"UPDATE people SET name = vwxyz WHERE id = 1", ""},
+		{"UPDATE people SET name = uvwxyz WHERE id = 1", "value too long for column name"},
+		{"INSERT INTO people VALUES (2, abcdefg, KE) ON CONFLICT (id) DO UPDATE SET name = abcdefg", "value too long for column name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			_, err := Execute(db, tt.query)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	if got, want := queryRows(t, db, "SELECT id, name FROM people ORDER BY id"), [][]interface{}{{int64(1), "vwxyz"}, {int64(2), "abcde"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("rows = %v, want %v", got, want)
+	}
+	schemas := mustExecute(t, db, "SHOW TABLES WITH SCHEMA").([]engine.TableSchema)
+	if col := schemas[0].Columns[1]; col.Type != "varchar" || col.Length != 5 {
+		t.Errorf("name column = %+v, want varchar of length 5", col)
+	}
+}
+
+func TestInsertValueCount(t *testing.T) {
+	db := newTestDB(t,
+		"CREATE TABLE t (id int, name text, amount int, ok bool)",
+		"INSERT INTO t VALUES (1, alice, 3, true)",
+	)
+
+	tests := []struct {
+		query   string
+		wantErr string
+	}{
+		{"INSERT INTO t VALUES (6)", "wrong number of values for table t: expected 4, got 1"},
+		{"INSERT INTO t VALUES (6, x, 3)", "expected 4, got 3"},
+		{"INSERT INTO t VALUES (5, x, 1, true, extra)", "expected 4, got 5"},
+		{"INSERT INTO t VALUES (1, x) ON CONFLICT (id) DO UPDATE SET name = y", "expected 4, got 2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			if _, err := Execute(db, tt.query); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	mustExecute(t, db, "INSERT INTO t VALUES (2, '', '', false)")
+	want := [][]interface{}{{int64(1), "alice"}, {int64(2), ""}}
+	if got := queryRows(t, db, "SELECT id, name FROM t ORDER BY id"); !reflect.DeepEqual(got, want) {
+		t.Errorf("rows = %#v, want %#v", got, want)
+	}
+}
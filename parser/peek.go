@@ -0,0 +1,68 @@
+package parser
+
+import (
+	"fmt"
+	"pesapal-ledger/engine"
+	"strconv"
+	"strings"
+)
+
+// defaultPeekRows and maxPeekRows bound the rows PEEK takes from each table
+const (
+	defaultPeekRows = 5
+	maxPeekRows     = 100
+)
+
+// TableSample is one table of a PEEK result: its schema and its first rows,
+// keyed by column name
+type TableSample struct {
+	Table   string                   `json:"table"`
+	Columns []string                 `json:"columns"`
+	Types   []string                 `json:"types"`
+	Rows    []map[string]interface{} `json:"rows"`
+}
+
+// parsePeek parses "PEEK [n]", which returns the schema and first n rows (5
+// by default) of every user table in disk order, for a first look at an
+// unfamiliar database
+func parsePeek(query string, db *engine.Database) (interface{}, error) {
+	fields := strings.Fields(strings.TrimSuffix(strings.TrimSpace(query), ";"))
+	if !strings.EqualFold(fields[0], "PEEK") || len(fields) > 2 {
+		return nil, fmt.Errorf("invalid PEEK syntax: expected PEEK [n]")
+	}
+	n := defaultPeekRows
+	if len(fields) == 2 {
+		var err error
+		n, err = strconv.Atoi(fields[1])
+		if err != nil || n < 1 || n > maxPeekRows {
+			return nil, fmt.Errorf("invalid PEEK row count %q: expected a number from 1 to %d", fields[1], maxPeekRows)
+		}
+	}
+
+	samples := []TableSample{}
+	for _, tableName := range db.ListTables() {
+		metadata, exists := db.Table(tableName)
+		if !exists {
+			continue // dropped since it was listed
+		}
+		rows, err := db.SelectFirst(tableName, n)
+		if err != nil {
+			return nil, fmt.Errorf("failed to sample table %s: %w", tableName, err)
+		}
+
+		sample := TableSample{Table: tableName, Rows: make([]map[string]interface{}, 0, len(rows))}
+		for _, col := range metadata.Schema() {
+			sample.Columns = append(sample.Columns, col.Name)
+			sample.Types = append(sample.Types, col.Type)
+		}
+		for _, row := range rows {
+			object, err := db.RowObject(tableName, row)
+			if err != nil {
+				return nil, err
+			}
+			sample.Rows = append(sample.Rows, object)
+		}
+		samples = append(samples, sample)
+	}
+	return samples, nil
+}
@@ -0,0 +1,85 @@
+package parser
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPeek(t *testing.T) {
+	setup := []string{
+		"CREATE TABLE ledger (id int, merchant text, amount int)",
+		"CREATE TABLE accounts (id int, owner text)",
+		"CREATE TABLE empty (id int, note text)",
+		"CREATE TABLE __migrations (version int, applied text)",
+		"INSERT INTO accounts VALUES (1, alice)",
+		"INSERT INTO __migrations VALUES (1, init)",
+	}
+	for i := 1; i <= 8; i++ {
+		setup = append(setup, fmt.Sprintf("INSERT INTO ledger VALUES (%d, m%d, %d)", i, i, i*10))
+	}
+	// Deleted rows are left out, and an updated row moves to the end of the file
+	setup = append(setup, "DELETE FROM ledger WHERE id = 2", "UPDATE ledger SET amount = 99 WHERE id = 3")
+	db := newTestDB(t, setup...)
+
+	tests := []struct {
+		query      string
+		ledgerIDs  []int64 // the ledger rows sampled, in order
+		accountIDs []int64
+	}{
+		{"PEEK", []int64{1, 4, 5, 6, 7}, []int64{1}},
+		{"peek 2;", []int64{1, 4}, []int64{1}},
+		{"PEEK 1", []int64{1}, []int64{1}},
+		{"PEEK 100", []int64{1, 4, 5, 6, 7, 8, 3}, []int64{1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			samples := mustExecute(t, db, tt.query).([]TableSample)
+			var tables []string
+			for _, s := range samples {
+				tables = append(tables, s.Table)
+			}
+			if want := []string{"accounts", "empty", "ledger"}; !reflect.DeepEqual(tables, want) {
+				t.Fatalf("tables = %v, want %v", tables, want)
+			}
+
+			for _, s := range samples {
+				var want []int64
+				switch s.Table {
+				case "ledger":
+					want = tt.ledgerIDs
+					if cols := []string{"id", "merchant", "amount"}; !reflect.DeepEqual(s.Columns, cols) {
+						t.Errorf("ledger columns = %v, want %v", s.Columns, cols)
+					}
+					if types := []string{"int", "text", "int"}; !reflect.DeepEqual(s.Types, types) {
+						t.Errorf("ledger types = %v, want %v", s.Types, types)
+					}
+				case "accounts":
+					want = tt.accountIDs
+				}
+				if s.Rows == nil {
+					t.Errorf("%s: rows is nil, want an empty list", s.Table)
+				}
+				var ids []int64
+				for _, row := range s.Rows {
+					ids = append(ids, row["id"].(int64))
+				}
+				if !reflect.DeepEqual(ids, want) {
+					t.Errorf("%s rows = %v, want ids %v", s.Table, s.Rows, want)
+				}
+			}
+		})
+	}
+
+	samples := mustExecute(t, db, "PEEK").([]TableSample)
+	if got, want := samples[2].Rows[0], map[string]interface{}{"id": int64(1), "merchant": "m1", "amount": int64(10)}; !reflect.DeepEqual(got, want) {
+		t.Errorf("first ledger row = %#v, want %#v", got, want)
+	}
+
+	for _, query := range []string{"PEEK 0", "PEEK 101", "PEEK -1", "PEEK x", "PEEK 1 2", "PEEKABOO"} {
+		if _, err := Execute(db, query); err == nil || !strings.Contains(err.Error(), "PEEK") {
+			t.Errorf("%s: got %v, want a PEEK syntax error", query, err)
+		}
+	}
+}
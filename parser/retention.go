@@ -0,0 +1,44 @@
+package parser
+
+import (
+	"fmt"
+	"pesapal-ledger/engine"
+	"strconv"
+	"strings"
+)
+
+// parsePurge parses "PURGE TABLE name WHERE key < val", on the primary key, and
+// "PURGE TABLE name WHERE _lsn < n". Matching rows are removed physically
+// and the table is compacted in the same pass.
+func parsePurge(query string, db *engine.Database) (interface{}, error) {
+	const usage = "invalid PURGE syntax: expected PURGE TABLE name WHERE id < val or PURGE TABLE name WHERE _lsn < n"
+
+	fields := strings.Fields(query)
+	if len(fields) != 7 || !strings.EqualFold(fields[1], "TABLE") ||
+		!strings.EqualFold(fields[3], "WHERE") || fields[5] != "<" {
+		return nil, fmt.Errorf(usage)
+	}
+	tableName, column, value := ident(fields[2]), ident(fields[4]), fields[6]
+
+	var cutoff engine.PurgeCutoff
+	switch {
+	case strings.EqualFold(column, engine.LSNColumn):
+		lsn, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || lsn <= 0 {
+			return nil, fmt.Errorf("invalid LSN cutoff '%s': must be a positive integer", value)
+		}
+		cutoff.BeforeLSN = lsn
+	case isKeyColumn(tableName, column, db) || hasCompositeKey(tableName, db):
+		// A composite key has no single column to cut on; Purge says to
+		// use the LSN instead
+		cutoff.BeforeID = value
+	default:
+		return nil, fmt.Errorf(usage)
+	}
+
+	result, err := db.Purge(tableName, cutoff)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,128 @@
+package parser
+
+import (
+	"fmt"
+	"pesapal-ledger/engine"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPurge(t *testing.T) {
+	tests := []struct {
+		name    string
+		purge   string
+		purged  int
+		wantIDs []interface{} // ids left, in file order
+	}{
+		{"by id", "PURGE TABLE events WHERE id < 6", 5, []interface{}{int64(6), int64(7), int64(8), int64(9), int64(10)}},
+		{"by key column name", "purge table events where ID < 3", 2, []interface{}{int64(3), int64(4), int64(5), int64(6), int64(7), int64(8), int64(9), int64(10)}},
+		{"by LSN", "PURGE TABLE events WHERE _lsn < 6", 5, []interface{}{int64(6), int64(7), int64(8), int64(9), int64(10)}},
+		{"nothing", "PURGE TABLE events WHERE id < 1", 0, []interface{}{int64(1), int64(2), int64(3), int64(4), int64(5), int64(6), int64(7), int64(8), int64(9), int64(10)}},
+		{"everything", "PURGE TABLE events WHERE id < 100", 10, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t, "CREATE TABLE events (id serial, kind text)")
+			for i := 1; i <= 10; i++ {
+				mustExecute(t, db, fmt.Sprintf("INSERT INTO events VALUES (DEFAULT, kind%d)", i))
+			}
+
+			result, ok := mustExecute(t, db, tt.purge).(engine.PurgeResult)
+			if !ok || result.Purged != tt.purged || result.Kept != 10-tt.purged {
+				t.Fatalf("result = %+v, want %d purged and %d kept", result, tt.purged, 10-tt.purged)
+			}
+			if result.BytesAfter > result.BytesBefore {
+				t.Errorf("the file grew from %d to %d bytes", result.BytesBefore, result.BytesAfter)
+			}
+
+			var ids []interface{}
+			for _, row := range queryRows(t, db, "SELECT id, kind FROM events") {
+				if row[1] != fmt.Sprintf("kind%d", row[0]) {
+					t.Errorf("row %v changed", row)
+				}
+				ids = append(ids, row[0])
+			}
+			if !reflect.DeepEqual(ids, tt.wantIDs) {
+				t.Errorf("ids left = %v, want %v", ids, tt.wantIDs)
+			}
+
+			// Purged ids aren't handed out again
+			if got := mustExecute(t, db, "INSERT INTO events VALUES (DEFAULT, new)"); got != "Row inserted with id 11" {
+				t.Errorf("insert after the purge: %v", got)
+			}
+		})
+	}
+}
+
+func TestPurgeDropsOldVersions(t *testing.T) {
+	db := newTestDB(t,
+		"CREATE TABLE accounts (id int, owner text)",
+		"INSERT INTO accounts VALUES (1, alice)",
+		"INSERT INTO accounts VALUES (2, bob)",
+		"INSERT INTO accounts VALUES (3, carol)",
+		"UPDATE accounts SET owner = dave WHERE id = 3",
+		"DELETE FROM accounts WHERE id = 2",
+	)
+
+	result := mustExecute(t, db, "PURGE TABLE accounts WHERE id < 2").(engine.PurgeResult)
+	if result.Purged != 1 || result.Kept != 1 {
+		t.Fatalf("result = %+v, want 1 purged and 1 kept", result)
+	}
+	// Only the current version of row 3 is left in the file
+	if got, want := queryRows(t, db, "SELECT * FROM accounts"), [][]interface{}{{int64(3), "1", "dave"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("rows = %v, want %v", got, want)
+	}
+	if live, dead, err := db.CompactionEstimate("accounts"); err != nil || dead != 0 || live != result.BytesAfter {
+		t.Errorf("CompactionEstimate after the purge = %d live, %d dead (%v); want %d live", live, dead, err, result.BytesAfter)
+	}
+}
+
+func TestPurgeCompositeKeyByLSN(t *testing.T) {
+	db := newTestDB(t,
+		"CREATE TABLE enrollments (student int, course text, PRIMARY KEY (student, course))",
+		"INSERT INTO enrollments VALUES (1, math)",
+		"INSERT INTO enrollments VALUES (1, art)",
+		"INSERT INTO enrollments VALUES (2, math)",
+	)
+
+	if result := mustExecute(t, db, "PURGE TABLE enrollments WHERE _lsn < 3").(engine.PurgeResult); result.Purged != 2 || result.Kept != 1 {
+		t.Fatalf("result = %+v, want 2 purged and 1 kept", result)
+	}
+	if got, want := queryRows(t, db, "SELECT student, course FROM enrollments"), [][]interface{}{{int64(2), "math"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("rows = %v, want %v", got, want)
+	}
+}
+
+func TestPurgeErrors(t *testing.T) {
+	db := newTestDB(t,
+		"CREATE TABLE accounts (id int, owner text)",
+		"CREATE TABLE enrollments (student int, course text, PRIMARY KEY (student, course))",
+		"INSERT INTO accounts VALUES (1, alice)",
+	)
+
+	tests := []struct {
+		query   string
+		wantErr string
+	}{
+		{"PURGE TABLE accounts WHERE owner < m", "invalid PURGE syntax"},
+		{"PURGE TABLE accounts WHERE id > 5", "invalid PURGE syntax"},
+		{"PURGE TABLE accounts WHERE id<5", "invalid PURGE syntax"},
+		{"PURGE TABLE accounts", "invalid PURGE syntax"},
+		{"PURGE TABLE accounts WHERE _lsn < 0", "must be a positive integer"},
+		{"PURGE TABLE accounts WHERE _lsn < abc", "must be a positive integer"},
+		{"PURGE TABLE enrollments WHERE student < 5", "composite key"},
+		{"PURGE TABLE missing WHERE _lsn < 5", "does not exist"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			_, err := Execute(db, tt.query)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+	if rows := queryRows(t, db, "SELECT id FROM accounts"); len(rows) != 1 {
+		t.Errorf("rows after the failed purges = %v", rows)
+	}
+}
@@ -0,0 +1,66 @@
+package parser
+
+import (
+	"fmt"
+	"pesapal-ledger/engine"
+	"strings"
+)
+
+// splitReturning splits a trailing "RETURNING col1, col2" (or "RETURNING *")
+// off an INSERT, UPDATE or DELETE statement. RETURNING inside a quoted value
+// doesn't count.
+func splitReturning(query string) (string, string, bool) {
+	idx := -1
+	for next := indexKeyword(query, " RETURNING "); next != -1; {
+		idx += next + 1
+		next = indexKeyword(query[idx+1:], " RETURNING ")
+	}
+	if idx == -1 {
+		return query, "", false
+	}
+	return strings.TrimSpace(query[:idx]), strings.TrimSpace(query[idx+11:]), true // len(" RETURNING ")
+}
+
+// returningColumns resolves the columns of a RETURNING clause. "*" means
+// every schema column. It runs before the statement so a bad column doesn't
+// leave the write done and the result lost.
+func returningColumns(tableName, list string, db *engine.Database) ([]string, error) {
+	names, err := db.ColumnNames(tableName)
+	if err != nil {
+		return nil, err
+	}
+	if list == "*" {
+		return names, nil
+	}
+
+	columns, err := parseColumnList(list, tableName)
+	if err != nil {
+		return nil, err
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("invalid RETURNING clause: no columns listed")
+	}
+	for _, col := range columns {
+		if _, err := engine.ResolveColumn(tableName, names, col); err != nil {
+			return nil, err
+		}
+	}
+	return columns, nil
+}
+
+// returningRows projects the stored rows touched by a statement onto its
+// RETURNING columns
+func returningRows(tableName string, columns []string, rows [][]string, db *engine.Database) (interface{}, error) {
+	projected, err := db.ProjectColumns(tableName, rows, columns)
+	if err != nil {
+		return nil, err
+	}
+	typed, err := db.TypeRows(tableName, columns, projected)
+	if err != nil {
+		return nil, err
+	}
+	if typed == nil {
+		typed = [][]interface{}{}
+	}
+	return typed, nil
+}
@@ -0,0 +1,71 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestReturning(t *testing.T) {
+	db := newTestDB(t,
+		"CREATE TABLE txns (id int, status text, amount int)",
+		"INSERT INTO txns VALUES (1, pending, 10)",
+		"INSERT INTO txns VALUES (2, pending, 20)",
+		"INSERT INTO txns VALUES (3, paid, 30)",
+	)
+
+	// The steps run in order against the same table
+	steps := []struct {
+		query string
+		want  [][]interface{}
+	}{
+		{"INSERT INTO txns VALUES (4, pending, 40) RETURNING id, status",
+			[][]interface{}{{int64(4), "pending"}}},
+		{"INSERT INTO txns VALUES (5, paid, 50) RETURNING *",
+			[][]interface{}{{int64(5), "paid", int64(50)}}},
+		{"UPDATE txns SET status = void WHERE status = pending LIMIT 10 RETURNING id, status",
+			[][]interface{}{{int64(1), "void"}, {int64(2), "void"}, {int64(4), "void"}}},
+		{"UPDATE txns SET amount = 99 WHERE id = 3 RETURNING amount, id",
+			[][]interface{}{{int64(99), int64(3)}}},
+		{"DELETE FROM txns WHERE id = 1 RETURNING id, amount",
+			[][]interface{}{{int64(1), int64(10)}}},
+		{"DELETE FROM txns WHERE status = void LIMIT 10 RETURNING id",
+			[][]interface{}{{int64(2)}, {int64(4)}}},
+		{"UPDATE txns SET amount = 0 ALL RETURNING id, amount",
+			[][]interface{}{{int64(3), int64(0)}, {int64(5), int64(0)}}},
+		{"SELECT id, status, amount FROM txns",
+			[][]interface{}{{int64(3), "paid", int64(0)}, {int64(5), "paid", int64(0)}}},
+		{"DELETE FROM txns ALL RETURNING *",
+			[][]interface{}{{int64(3), "paid", int64(0)}, {int64(5), "paid", int64(0)}}},
+		{"UPDATE txns SET amount = 1 ALL RETURNING id",
+			[][]interface{}{}},
+	}
+	for _, step := range steps {
+		got := queryRows(t, db, step.query)
+		if !reflect.DeepEqual(got, step.want) {
+			t.Errorf("%s: got %v, want %v", step.query, got, step.want)
+		}
+	}
+}
+
+func TestReturningErrors(t *testing.T) {
+	db := newTestDB(t,
+		"CREATE TABLE txns (id int, status text, amount int)",
+		"INSERT INTO txns VALUES (1, pending, 10)",
+	)
+
+	// A bad RETURNING list is caught before anything is written
+	for _, query := range []string{
+		"INSERT INTO txns VALUES (2, pending, 20) RETURNING missing",
+		"UPDATE txns SET amount = 0 WHERE id = 1 RETURNING missing",
+		"DELETE FROM txns WHERE id = 1 RETURNING id, missing",
+		"UPDATE txns SET amount = 0 WHERE id = 42 RETURNING id",
+	} {
+		if _, err := Execute(db, query); err == nil {
+			t.Errorf("%s: no error", query)
+		}
+	}
+	want := [][]interface{}{{int64(1), "pending", int64(10)}}
+	if got := queryRows(t, db, "SELECT id, status, amount FROM txns"); !reflect.DeepEqual(got, want) {
+		t.Errorf("rows after the failed statements = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,81 @@
+package parser
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"pesapal-ledger/engine"
+	"pesapal-ledger/storage"
+)
+
+func TestSchemaQualifiedTables(t *testing.T) {
+	db := newTestDB(t,
+		"CREATE TABLE sales.orders (id int, item text)",
+		"CREATE TABLE archive.orders (id int, item text)",
+		"CREATE TABLE orders (id int, item text)",
+		"INSERT INTO sales.orders VALUES (1, ink)",
+		"INSERT INTO sales.orders VALUES (2, pen)",
+		"INSERT INTO archive.orders VALUES (1, quill)",
+		"INSERT INTO orders VALUES (7, plain)",
+	)
+
+	tests := []struct {
+		query string
+		want  [][]interface{}
+	}{
+		{"SELECT item FROM sales.orders", [][]interface{}{{"ink"}, {"pen"}}},
+		{"SELECT item FROM archive.orders", [][]interface{}{{"quill"}}},
+		{"SELECT item FROM orders", [][]interface{}{{"plain"}}},
+		{"SELECT sales.orders.item FROM sales.orders WHERE sales.orders.id = 2", [][]interface{}{{"pen"}}},
+		{"SELECT orders.item FROM archive.orders WHERE orders.id = 1", [][]interface{}{{"quill"}}},
+		{"SELECT id FROM sales.orders WHERE EXISTS (SELECT 1 FROM archive.orders WHERE archive.orders.id = sales.orders.id)", [][]interface{}{{int64(1)}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			if got := queryRows(t, db, tt.query); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if got, want := mustExecute(t, db, "SHOW TABLES"), []string{"archive.orders", "orders", "sales.orders"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("SHOW TABLES = %v, want %v", got, want)
+	}
+
+	// Writes to one schema leave the other alone, across a restart
+	mustExecute(t, db, "UPDATE sales.orders SET item = pencil WHERE id = 2")
+	mustExecute(t, db, "DELETE FROM archive.orders WHERE id = 1")
+	storage.CloseWriters()
+	db = engine.NewDatabase()
+	if err := db.Recover(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := queryRows(t, db, "SELECT id, item FROM sales.orders"), [][]interface{}{{int64(1), "ink"}, {int64(2), "pencil"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sales.orders after restart = %v, want %v", got, want)
+	}
+	if got := queryRows(t, db, "SELECT id FROM archive.orders"); len(got) != 0 {
+		t.Errorf("archive.orders after restart = %v, want no rows", got)
+	}
+
+	errTests := []struct {
+		query   string
+		wantErr string
+	}{
+		{"SELECT item FROM sales.orders WHERE archive.orders.id = 1", "does not match table sales.orders"},
+		{"SELECT * FROM nope.orders", "table nope.orders does not exist"},
+		{"CREATE TABLE ../evil (id int)", "invalid table name"},
+		{"CREATE TABLE sales/evil (id int)", "invalid table name"},
+		{`CREATE TABLE "../evil" (id int)`, "can't contain '.'"},
+		{"CREATE TABLE a.b.c (id int)", "expected table or schema.table"},
+		{"CREATE TABLE sales. (id int)", "empty name"},
+	}
+	for _, tt := range errTests {
+		t.Run(tt.query, func(t *testing.T) {
+			_, err := Execute(db, tt.query)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
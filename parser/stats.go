@@ -0,0 +1,89 @@
+package parser
+
+import (
+	"fmt"
+	"pesapal-ledger/engine"
+	"strings"
+	"time"
+)
+
+// QueryStats reports how much work a SELECT did. Many rows scanned for few
+// returned means the query filters by full scan instead of an index.
+type QueryStats struct {
+	RowsScanned  int64 `json:"rowsScanned"`
+	RowsReturned int   `json:"rowsReturned"`
+	// SkippedRows lists the corrupt rows left out when the database skips
+	// them (see engine.Database.SkipCorruptRows); the results are partial
+	SkippedRows []engine.SkippedRow `json:"skippedRows,omitempty"`
+}
+
+// ExecuteWithStats is Execute that also reports, for SELECT statements, how
+// many stored rows were read and how many came back. The stats are nil for
+// other statements.
+func ExecuteWithStats(db *engine.Database, query string) (interface{}, *QueryStats, error) {
+	if !strings.HasPrefix(strings.ToUpper(strings.TrimSpace(query)), "SELECT") {
+		result, err := Execute(db, query)
+		return result, nil, err
+	}
+
+	var trace engine.Trace
+	result, err := parseSQL(query, db, &trace)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	stats := &QueryStats{RowsScanned: trace.Rows(), RowsReturned: rowsReturned(result), SkippedRows: trace.Skipped()}
+	return result, stats, nil
+}
+
+// rowsReturned counts the rows of a SELECT result. A scalar aggregate such as
+// COUNT(*) is one row.
+func rowsReturned(result interface{}) int {
+	if rows, ok := result.([][]interface{}); ok {
+		return len(rows)
+	}
+	return 1
+}
+
+// parseExplainAnalyze parses "EXPLAIN ANALYZE SELECT ...". It runs the query
+// and reports the access paths taken, the rows scanned and returned, and the
+// time spent per stage, instead of the rows themselves.
+func parseExplainAnalyze(query string, db *engine.Database) (interface{}, error) {
+	inner := strings.TrimSpace(query[16:]) // len("EXPLAIN ANALYZE ")
+	if !strings.HasPrefix(strings.ToUpper(inner), "SELECT") {
+		return nil, fmt.Errorf("invalid EXPLAIN syntax: EXPLAIN ANALYZE only supports SELECT")
+	}
+
+	trace := engine.NewTimedTrace()
+	start := time.Now()
+	result, err := parseSQL(inner, db, trace)
+	if err != nil {
+		return nil, err
+	}
+	total := time.Since(start)
+
+	stages := []map[string]interface{}{}
+	for _, timing := range trace.Stages() {
+		stages = append(stages, map[string]interface{}{
+			"stage":      timing.Stage,
+			"durationMs": milliseconds(timing.Duration),
+		})
+	}
+	paths := trace.AccessPaths()
+	if paths == nil {
+		paths = []string{}
+	}
+	return map[string]interface{}{
+		"query":        inner,
+		"accessPaths":  paths,
+		"rowsScanned":  trace.Rows(),
+		"rowsReturned": rowsReturned(result),
+		"stages":       stages,
+		"totalMs":      milliseconds(total),
+	}, nil
+}
+
+// milliseconds converts a duration to fractional milliseconds
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,124 @@
+package parser
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestQueryStats(t *testing.T) {
+	const rows = 100
+	db := newTestDB(t, "CREATE TABLE transactions (id int, merchant text, amount int)")
+	for i := 1; i <= rows; i++ {
+		mustExecute(t, db, fmt.Sprintf("INSERT INTO transactions VALUES (%d, merchant%d, %d)", i, i%10, i))
+	}
+
+	tests := []struct {
+		query    string
+		scanned  int64
+		returned int
+	}{
+		{"SELECT * FROM transactions WHERE id = 5", 1, 1},
+		{"SELECT * FROM transactions WHERE id BETWEEN 10 AND 19", 10, 10},
+		{"SELECT * FROM transactions LIMIT 5", 5, 5},
+		{"SELECT * FROM transactions TAIL 3", 3, 3},
+		{"SELECT * FROM transactions WHERE merchant = merchant3", rows, 10},
+		{"SELECT * FROM transactions WHERE amount = 7", rows, 1},
+		{"SELECT * FROM transactions", rows, rows},
+		{"SELECT COUNT(*) FROM transactions", rows, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			_, stats, err := ExecuteWithStats(db, tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stats == nil {
+				t.Fatal("no stats for a SELECT")
+			}
+			if stats.RowsScanned != tt.scanned || stats.RowsReturned != tt.returned {
+				t.Errorf("scanned %d, returned %d; want %d and %d", stats.RowsScanned, stats.RowsReturned, tt.scanned, tt.returned)
+			}
+		})
+	}
+
+	if _, stats, err := ExecuteWithStats(db, "INSERT INTO transactions VALUES (101, merchant1, 1)"); err != nil || stats != nil {
+		t.Errorf("INSERT: stats %+v, error %v; want no stats", stats, err)
+	}
+}
+
+func TestExplainAnalyze(t *testing.T) {
+	db := newTestDB(t,
+		"CREATE TABLE transactions (id int, merchant text, amount int)",
+		"INSERT INTO transactions VALUES (1, acme, 10)",
+		"INSERT INTO transactions VALUES (2, globex, 20)",
+		"INSERT INTO transactions VALUES (3, acme, 30)",
+	)
+
+	tests := []struct {
+		query    string
+		path     string
+		stages   []string // stages that must have run, in order
+		scanned  int64
+		returned int
+	}{
+		{"SELECT * FROM transactions WHERE id = 2", "index lookup on transactions.id",
+			[]string{"index lookup", "scan", "project"}, 1, 1},
+		{"SELECT * FROM transactions WHERE merchant = acme", "full scan of transactions",
+			[]string{"scan", "filter", "project"}, 3, 2},
+		{"SELECT id FROM transactions ORDER BY amount DESC", "full scan of transactions",
+			[]string{"scan", "sort", "project"}, 3, 3},
+		{"SELECT merchant, SUM(amount) FROM transactions GROUP BY merchant", "full scan of transactions",
+			[]string{"scan", "aggregate"}, 3, 2},
+		{"SELECT COUNT(*) FROM transactions", "full scan of transactions",
+			[]string{"scan", "aggregate"}, 3, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			plan, ok := mustExecute(t, db, "EXPLAIN ANALYZE "+tt.query).(map[string]interface{})
+			if !ok {
+				t.Fatal("result is not a plan")
+			}
+			if paths := plan["accessPaths"].([]string); len(paths) != 1 || paths[0] != tt.path {
+				t.Errorf("access paths = %v, want [%s]", paths, tt.path)
+			}
+			if plan["rowsScanned"] != tt.scanned || plan["rowsReturned"] != tt.returned {
+				t.Errorf("scanned %v, returned %v; want %d and %d", plan["rowsScanned"], plan["rowsReturned"], tt.scanned, tt.returned)
+			}
+
+			total := plan["totalMs"].(float64)
+			var ran []string
+			for _, stage := range plan["stages"].([]map[string]interface{}) {
+				name, ms := stage["stage"].(string), stage["durationMs"].(float64)
+				if ms <= 0 || ms > total {
+					t.Errorf("stage %s took %vms of %vms in total", name, ms, total)
+				}
+				ran = append(ran, name)
+			}
+			if !inOrder(ran, tt.stages) {
+				t.Errorf("stages %v, want %v among them in order", ran, tt.stages)
+			}
+		})
+	}
+
+	for _, query := range []string{
+		"EXPLAIN ANALYZE DELETE FROM transactions WHERE id = 1",
+		"EXPLAIN ANALYZE SELECT * FROM missing",
+	} {
+		if _, err := Execute(db, query); err == nil {
+			t.Errorf("%s: no error", query)
+		}
+	}
+	if rows := queryRows(t, db, "SELECT id FROM transactions"); len(rows) != 3 {
+		t.Errorf("%d rows left, want 3", len(rows))
+	}
+}
+
+// inOrder reports whether want appears in got as a subsequence
+func inOrder(got, want []string) bool {
+	for _, name := range got {
+		if len(want) > 0 && name == want[0] {
+			want = want[1:]
+		}
+	}
+	return len(want) == 0
+}
@@ -0,0 +1,23 @@
+package parser
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// splitTail splits "name TAIL n" into the table name and n. ok is false when
+// there is no TAIL clause.
+func splitTail(tableRef string) (string, int, bool, error) {
+	idx := strings.Index(strings.ToUpper(tableRef), " TAIL ")
+	if idx == -1 {
+		return tableRef, 0, false, nil
+	}
+	tableName := strings.TrimSpace(tableRef[:idx])
+	count := strings.TrimSpace(tableRef[idx+6:]) // len(" TAIL ")
+	n, err := strconv.Atoi(count)
+	if err != nil || n < 0 {
+		return "", 0, false, fmt.Errorf("invalid TAIL clause: expected a non-negative row count, got %q", count)
+	}
+	return tableName, n, true, nil
+}
@@ -0,0 +1,53 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTail(t *testing.T) {
+	for _, format := range []string{"TEXT", "BINARY"} {
+		t.Run(format, func(t *testing.T) {
+			db := newTestDB(t,
+				"CREATE TABLE tx (id int, memo text) FORMAT "+format,
+				"INSERT INTO tx VALUES (1, a)",
+				"INSERT INTO tx VALUES (2, b)",
+				"INSERT INTO tx VALUES (3, c)",
+				"INSERT INTO tx VALUES (4, d)",
+				"UPDATE tx SET memo = a2 WHERE id = 1",
+				"DELETE FROM tx WHERE id = 4",
+				"UPDATE tx SET memo = b2 WHERE id = 2",
+				"INSERT INTO tx VALUES (5, e)",
+				"DELETE FROM tx WHERE id = 5",
+			)
+
+			// Rows come oldest first, by their latest version; deleted rows
+			// and superseded versions don't count toward n
+			tests := []struct {
+				query string
+				want  [][]interface{}
+			}{
+				{"SELECT id, memo FROM tx TAIL 1", [][]interface{}{{int64(2), "b2"}}},
+				{"SELECT id, memo FROM tx TAIL 2", [][]interface{}{{int64(1), "a2"}, {int64(2), "b2"}}},
+				{"SELECT id, memo FROM tx TAIL 3", [][]interface{}{{int64(3), "c"}, {int64(1), "a2"}, {int64(2), "b2"}}},
+				{"SELECT id FROM tx TAIL 10", [][]interface{}{{int64(3)}, {int64(1)}, {int64(2)}}},
+				{"SELECT id FROM tx TAIL 0", [][]interface{}{}},
+			}
+			for _, tt := range tests {
+				if got := queryRows(t, db, tt.query); !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("%s: got %v, want %v", tt.query, got, tt.want)
+				}
+			}
+
+			for _, query := range []string{
+				"SELECT id FROM tx TAIL -1",
+				"SELECT id FROM tx TAIL x",
+				"SELECT id FROM tx WHERE memo = c TAIL 1",
+			} {
+				if _, err := Execute(db, query); err == nil {
+					t.Errorf("%s: no error", query)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package parser
+
+import (
+	"fmt"
+	"pesapal-ledger/engine"
+	"strings"
+)
+
+// writer performs row writes: the database itself, or a transaction whose
+// writes commit together
+type writer interface {
+	InsertRow(tableName string, row []string) error
+	UpsertRow(tableName string, row []string, updates map[string]string) (bool, error)
+	UpdateRow(tableName string, id string, updates map[string]string) error
+	UpdateRowReturning(tableName string, id string, updates map[string]string) ([]string, error)
+	UpdateAll(tableName string, updates map[string]string) (int, error)
+	UpdateAllReturning(tableName string, updates map[string]string) ([][]string, error)
+	DeleteRow(tableName string, id string) error
+	DeleteRowReturning(tableName string, id string) ([]string, error)
+	DeleteAll(tableName string) (int, error)
+	DeleteAllReturning(tableName string) ([][]string, error)
+}
+
+// TransactionResult reports a transaction's outcome and the result of each
+// statement in it
+type TransactionResult struct {
+	Committed bool          `json:"committed"`
+	Results   []interface{} `json:"results"`
+}
+
+// parseTransaction runs "BEGIN; stmt; ...; COMMIT" as one transaction: the
+// writes of every statement become durable together, across tables, or not
+// at all. Ending with ROLLBACK instead runs the statements and undoes them.
+// INSERT, UPDATE, DELETE and SELECT are allowed inside; if one fails, the
+// whole transaction is rolled back and the error names the statement. A
+// transaction of SELECTs only reads from a snapshot (see readSnapshot).
+func parseTransaction(query string, db *engine.Database, trace *engine.Trace) (interface{}, error) {
+	statements, err := splitStatements(query)
+	if err != nil {
+		return nil, err
+	}
+	if len(statements) == 0 || !isKeywordStatement(statements[0], "BEGIN") {
+		return nil, fmt.Errorf("invalid transaction syntax: expected BEGIN")
+	}
+	last := statements[len(statements)-1]
+	commit := isKeywordStatement(last, "COMMIT")
+	if len(statements) < 2 || (!commit && !isKeywordStatement(last, "ROLLBACK")) {
+		return nil, fmt.Errorf("a transaction must end with COMMIT or ROLLBACK in the same query")
+	}
+	body := statements[1 : len(statements)-1]
+	for i, stmt := range body {
+		upper := strings.ToUpper(stmt)
+		if !strings.HasPrefix(upper, "INSERT INTO") && !strings.HasPrefix(upper, "UPDATE") &&
+			!strings.HasPrefix(upper, "DELETE FROM") && !strings.HasPrefix(upper, "SELECT") {
+			return nil, fmt.Errorf("statement %d (%s) is not allowed in a transaction: only INSERT, UPDATE, DELETE and SELECT are", i+1, statementKeyword(stmt))
+		}
+	}
+
+	if readOnly(body) {
+		return readSnapshot(body, db, trace, commit)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]interface{}, 0, len(body))
+	for i, stmt := range body {
+		result, err := executeInTx(stmt, db, tx, trace)
+		if err != nil {
+			if rbErr := tx.Rollback(); rbErr != nil {
+				return nil, fmt.Errorf("statement %d failed (%v) and rolling back failed: %w", i+1, err, rbErr)
+			}
+			return nil, fmt.Errorf("statement %d failed, transaction rolled back: %w", i+1, err)
+		}
+		results = append(results, result)
+	}
+
+	if !commit {
+		if err := tx.Rollback(); err != nil {
+			return nil, err
+		}
+		return TransactionResult{Committed: false, Results: results}, nil
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return TransactionResult{Committed: true, Results: results}, nil
+}
+
+// readOnly reports whether a transaction body only has SELECTs
+func readOnly(body []string) bool {
+	for _, stmt := range body {
+		if !strings.HasPrefix(strings.ToUpper(stmt), "SELECT") {
+			return false
+		}
+	}
+	return true
+}
+
+// readSnapshot runs a transaction of SELECTs against one snapshot taken at
+// BEGIN, so every SELECT sees the same data (repeatable read) while writers
+// carry on instead of waiting for the transaction to end
+func readSnapshot(body []string, db *engine.Database, trace *engine.Trace, commit bool) (interface{}, error) {
+	if trace == nil {
+		trace = &engine.Trace{}
+	}
+	trace.ReadFrom(db.Snapshot())
+
+	results := make([]interface{}, 0, len(body))
+	for i, stmt := range body {
+		result, err := parseSelect(stmt, db, trace)
+		if err != nil {
+			return nil, fmt.Errorf("statement %d failed: %w", i+1, err)
+		}
+		results = append(results, result)
+	}
+	return TransactionResult{Committed: commit, Results: results}, nil
+}
+
+// executeInTx runs one statement of a transaction, sending its writes to tx
+func executeInTx(stmt string, db *engine.Database, tx *engine.Tx, trace *engine.Trace) (interface{}, error) {
+	upper := strings.ToUpper(stmt)
+	switch {
+	case strings.HasPrefix(upper, "INSERT INTO"):
+		return parseInsert(stmt, db, tx)
+	case strings.HasPrefix(upper, "DELETE FROM"):
+		return parseDelete(stmt, db, tx)
+	case strings.HasPrefix(upper, "UPDATE"):
+		return parseUpdate(stmt, db, tx)
+	default:
+		return parseSelect(stmt, db, trace)
+	}
+}
+
+// splitStatements splits a query at the semicolons outside quoted values and
+// drops empty statements
+func splitStatements(query string) ([]string, error) {
+	var statements []string
+	start, inQuote := 0, false
+	for i := 0; i < len(query); i++ {
+		switch query[i] {
+		case '\'':
+			inQuote = !inQuote // a doubled '' toggles twice
+		case ';':
+			if !inQuote {
+				if stmt := strings.TrimSpace(query[start:i]); stmt != "" {
+					statements = append(statements, stmt)
+				}
+				start = i + 1
+			}
+		}
+	}
+	if inQuote {
+		return nil, fmt.Errorf("unterminated quoted value")
+	}
+	if stmt := strings.TrimSpace(query[start:]); stmt != "" {
+		statements = append(statements, stmt)
+	}
+	return statements, nil
+}
+
+// isKeywordStatement reports whether stmt is keyword, optionally followed by
+// TRANSACTION or WORK
+func isKeywordStatement(stmt, keyword string) bool {
+	fields := strings.Fields(strings.ToUpper(stmt))
+	if len(fields) == 0 || fields[0] != keyword {
+		return false
+	}
+	return len(fields) == 1 || (len(fields) == 2 && (fields[1] == "TRANSACTION" || fields[1] == "WORK"))
+}
+
+// statementKeyword returns the leading keyword of a statement
+func statementKeyword(stmt string) string {
+	fields := strings.Fields(stmt)
+	if len(fields) == 0 {
+		return ""
+	}
+	return strings.ToUpper(fields[0])
+}
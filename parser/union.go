@@ -0,0 +1,148 @@
+package parser
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"pesapal-ledger/engine"
+	"strings"
+)
+
+// splitUnion splits "q1 UNION [ALL] q2 ..." at its top-level UNIONs. all[i]
+// tells whether selects[i+1] was joined with UNION ALL. ok is false when the
+// query isn't a union.
+func splitUnion(query string) (selects []string, all []bool, ok bool) {
+	rest := query
+	for {
+		idx := indexKeyword(rest, " UNION ")
+		if idx == -1 {
+			break
+		}
+		selects = append(selects, strings.TrimSpace(rest[:idx]))
+		rest = strings.TrimSpace(rest[idx+7:]) // len(" UNION ")
+		isAll := strings.EqualFold(rest, "ALL") || (len(rest) > 4 && strings.EqualFold(rest[:4], "ALL "))
+		if isAll {
+			rest = strings.TrimSpace(rest[3:])
+		}
+		all = append(all, isAll)
+	}
+	// A dangling "UNION [ALL]" leaves an empty SELECT, which parseUnion rejects
+	upper := strings.ToUpper(rest)
+	if strings.HasSuffix(upper, " UNION") || strings.HasSuffix(upper, " UNION ALL") {
+		idx := strings.LastIndex(upper, " UNION")
+		return append(selects, strings.TrimSpace(rest[:idx]), ""), append(all, false), true
+	}
+	if selects == nil {
+		return nil, nil, false
+	}
+	return append(selects, rest), all, true
+}
+
+// parseUnion runs "SELECT ... UNION [ALL] SELECT ..." over two or more
+// SELECTs with the same number of columns of matching types. Rows come back
+// in the order of the SELECTs. UNION removes duplicate rows from everything
+// to its left, UNION ALL keeps them, as in SQL.
+func parseUnion(selects []string, all []bool, db *engine.Database, trace *engine.Trace) (interface{}, error) {
+	var columns []engine.Column
+	var result [][]interface{}
+	for i, query := range selects {
+		if query == "" {
+			return nil, fmt.Errorf("invalid UNION syntax: empty SELECT")
+		}
+		types, rows, err := unionBranch(query, db, trace)
+		if err != nil {
+			return nil, err
+		}
+
+		if i == 0 {
+			columns, result = types, rows
+			continue
+		}
+		if len(types) != len(columns) {
+			return nil, fmt.Errorf("each SELECT in a UNION must have the same number of columns: SELECT 1 has %d, SELECT %d has %d", len(columns), i+1, len(types))
+		}
+		for j := range types {
+			if types[j].TypeFamily() != columns[j].TypeFamily() {
+				return nil, fmt.Errorf("UNION column %d is %s in SELECT 1 but %s in SELECT %d", j+1, columns[j].Type, types[j].Type, i+1)
+			}
+		}
+		result = append(result, rows...)
+		if !all[i-1] {
+			result = distinctRows(result)
+		}
+	}
+	return result, nil
+}
+
+// unionBranch runs one SELECT of a union and returns the type of each
+// selected column with the typed rows. Only SELECT * and column list
+// SELECTs can be combined.
+func unionBranch(query string, db *engine.Database, trace *engine.Trace) ([]engine.Column, [][]interface{}, error) {
+	upper := strings.ToUpper(query)
+	if !strings.HasPrefix(upper, "SELECT ") {
+		return nil, nil, fmt.Errorf("invalid UNION syntax: expected SELECT, got %q", query)
+	}
+	if isValuesSelect(upper) || strings.Contains(upper, " GROUP BY ") || strings.HasPrefix(upper, "SELECT * EXCEPT") {
+		return nil, nil, fmt.Errorf("UNION only combines SELECT * and SELECT col, ... queries")
+	}
+	if indexKeyword(query, " ORDER BY ") != -1 || indexKeyword(query, " LIMIT ") != -1 {
+		return nil, nil, fmt.Errorf("ORDER BY and LIMIT are not supported in a UNION")
+	}
+
+	idxFrom := strings.Index(upper, " FROM ")
+	if idxFrom == -1 {
+		return nil, nil, fmt.Errorf("invalid SELECT syntax: missing FROM")
+	}
+	tableName := fromTableName(strings.TrimSpace(query[idxFrom+1:]))
+
+	// A key lookup that matches nothing gives the SELECT no rows rather than
+	// failing the whole union
+	var names []string
+	var rows [][]string
+	var err error
+	if strings.HasPrefix(upper, "SELECT * ") {
+		if _, rows, err = selectRows(query, db, trace); err != nil && !errors.Is(err, engine.ErrRowNotFound) {
+			return nil, nil, err
+		}
+		if names, err = db.RowColumns(tableName); err != nil {
+			return nil, nil, err
+		}
+	} else {
+		if idxFrom > 7 && hasExpressions(query[7:idxFrom]) {
+			return nil, nil, fmt.Errorf("UNION only combines SELECT * and SELECT col, ... queries")
+		}
+		if _, names, rows, err = selectColumns(query, db, trace); errors.Is(err, engine.ErrRowNotFound) {
+			names, err = parseColumnList(query[7:idxFrom], tableName)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	types, err := db.ColumnTypes(tableName, names)
+	if err != nil {
+		return nil, nil, err
+	}
+	start := trace.Start()
+	defer trace.Stop(engine.StageProject, start)
+	typed, err := db.TypeRows(tableName, names, rows)
+	if err != nil {
+		return nil, nil, err
+	}
+	return types, typed, nil
+}
+
+// distinctRows drops repeated rows, keeping the first of each
+func distinctRows(rows [][]interface{}) [][]interface{} {
+	seen := make(map[string]bool, len(rows))
+	distinct := rows[:0]
+	for _, row := range rows {
+		key, _ := json.Marshal(row)
+		if seen[string(key)] {
+			continue
+		}
+		seen[string(key)] = true
+		distinct = append(distinct, row)
+	}
+	return distinct
+}
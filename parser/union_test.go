@@ -0,0 +1,122 @@
+package parser
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUnion(t *testing.T) {
+	db := newTestDB(t,
+		"CREATE TABLE txns_2024_01 (id int, merchant text, amount int)",
+		"CREATE TABLE txns_2024_02 (id int, merchant text, amount int)",
+		"CREATE TABLE txns_2024_03 (txn int, shop text, total bigint)",
+		"INSERT INTO txns_2024_01 VALUES (1, Uber, 100)",
+		"INSERT INTO txns_2024_01 VALUES (2, Java, 50)",
+		"INSERT INTO txns_2024_01 VALUES (3, Uber, 100)",
+		"INSERT INTO txns_2024_02 VALUES (1, Uber, 100)",
+		"INSERT INTO txns_2024_02 VALUES (4, Bolt, 70)",
+		"INSERT INTO txns_2024_03 VALUES (5, Java, 50)",
+	)
+
+	tests := []struct {
+		name  string
+		query string
+		want  [][]interface{}
+	}{
+		{
+			name:  "union all keeps the order of the selects",
+			query: "SELECT id, merchant FROM txns_2024_02 UNION ALL SELECT id, merchant FROM txns_2024_01",
+			want:  [][]interface{}{{int64(1), "Uber"}, {int64(4), "Bolt"}, {int64(1), "Uber"}, {int64(2), "Java"}, {int64(3), "Uber"}},
+		},
+		{
+			name:  "union drops duplicates",
+			query: "SELECT merchant, amount FROM txns_2024_01 UNION SELECT merchant, amount FROM txns_2024_02",
+			want:  [][]interface{}{{"Uber", int64(100)}, {"Java", int64(50)}, {"Bolt", int64(70)}},
+		},
+		{
+			name:  "union all of select star with a where",
+			query: "SELECT * FROM txns_2024_01 WHERE merchant = Java UNION ALL SELECT * FROM txns_2024_02 WHERE merchant = Uber",
+			want:  [][]interface{}{{int64(2), "1", "Java", int64(50)}, {int64(1), "1", "Uber", int64(100)}},
+		},
+		{
+			name:  "three selects",
+			query: "SELECT merchant FROM txns_2024_01 UNION ALL SELECT merchant FROM txns_2024_02 UNION ALL SELECT shop FROM txns_2024_03",
+			want:  [][]interface{}{{"Uber"}, {"Java"}, {"Uber"}, {"Uber"}, {"Bolt"}, {"Java"}},
+		},
+		{
+			// UNION dedups everything to its left, UNION ALL then appends as is
+			name:  "union then union all",
+			query: "SELECT merchant FROM txns_2024_01 UNION SELECT merchant FROM txns_2024_02 UNION ALL SELECT shop FROM txns_2024_03",
+			want:  [][]interface{}{{"Uber"}, {"Java"}, {"Bolt"}, {"Java"}},
+		},
+		{
+			name:  "union all then union",
+			query: "SELECT merchant FROM txns_2024_01 UNION ALL SELECT merchant FROM txns_2024_02 union select shop from txns_2024_03",
+			want:  [][]interface{}{{"Uber"}, {"Java"}, {"Bolt"}},
+		},
+		{
+			name:  "int and bigint columns combine",
+			query: "SELECT id, amount FROM txns_2024_02 UNION SELECT txn, total FROM txns_2024_03",
+			want:  [][]interface{}{{int64(1), int64(100)}, {int64(4), int64(70)}, {int64(5), int64(50)}},
+		},
+		{
+			name:  "a select with no rows",
+			query: "SELECT merchant FROM txns_2024_01 WHERE id = 99 UNION ALL SELECT merchant FROM txns_2024_02 WHERE id = 4",
+			want:  [][]interface{}{{"Bolt"}},
+		},
+		{
+			name:  "a select star with no rows",
+			query: "SELECT * FROM txns_2024_01 WHERE id = 4 UNION ALL SELECT * FROM txns_2024_02 WHERE id = 4",
+			want:  [][]interface{}{{int64(4), "1", "Bolt", int64(70)}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := queryRows(t, db, tt.query); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnionErrors(t *testing.T) {
+	db := newTestDB(t,
+		"CREATE TABLE a (id int, name text, amount int)",
+		"CREATE TABLE b (id int, name text)",
+		"INSERT INTO a VALUES (1, x, 5)",
+		"INSERT INTO b VALUES (1, x)",
+	)
+
+	tests := []struct {
+		query   string
+		wantErr string
+	}{
+		{"SELECT * FROM a UNION SELECT * FROM b", "same number of columns: SELECT 1 has 4, SELECT 2 has 3"},
+		{"SELECT id, name FROM a UNION SELECT name, id FROM b", "UNION column 1 is int in SELECT 1 but text in SELECT 2"},
+		{"SELECT id FROM a UNION", "empty SELECT"},
+		{"SELECT id FROM a UNION ALL", "empty SELECT"},
+		{"SELECT id FROM a UNION DELETE FROM b WHERE id = 1", "expected SELECT"},
+		{"SELECT id FROM a UNION SELECT id FROM b ORDER BY id", "ORDER BY and LIMIT are not supported"},
+		{"SELECT id FROM a UNION SELECT id FROM b LIMIT 1", "ORDER BY and LIMIT are not supported"},
+		{"SELECT name, COUNT(*) FROM a GROUP BY name UNION SELECT name, id FROM b", "only combines SELECT *"},
+		{"SELECT id + 1 FROM a UNION SELECT id FROM b", "only combines SELECT *"},
+		{"SELECT id FROM a UNION SELECT id FROM missing", "does not exist"},
+		{"SELECT id FROM a UNION SELECT id FROM missing WHERE id = 1", "does not exist"},
+		{"SELECT * FROM a UNION SELECT * FROM missing WHERE id = 1", "does not exist"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			_, err := Execute(db, tt.query)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	// A quoted " UNION " is a value, not a union
+	mustExecute(t, db, "INSERT INTO b VALUES (2, 'p UNION q')")
+	if rows := queryRows(t, db, "SELECT id FROM b WHERE name = 'p UNION q'"); len(rows) != 1 || rows[0][0] != int64(2) {
+		t.Errorf("quoted UNION: %v", rows)
+	}
+}
@@ -0,0 +1,255 @@
+package parser
+
+import (
+	"fmt"
+	"pesapal-ledger/engine"
+	"strconv"
+	"strings"
+)
+
+// isValuesSelect reports whether a SELECT reads from an inline VALUES list
+func isValuesSelect(upper string) bool {
+	idxFrom := strings.Index(upper, " FROM (")
+	if idxFrom == -1 {
+		return false
+	}
+	return strings.HasPrefix(strings.TrimSpace(upper[idxFrom+7:]), "VALUES") // len(" FROM (")
+}
+
+// parseSelectValues parses
+// "SELECT * | cols FROM (VALUES (1, 'a'), (2, 'b')) AS t(id, name) [WHERE ...]".
+// The rows exist only for this statement; nothing touches storage. Without a
+// column list the columns are named column1, column2, ... The WHERE clause
+// supports "col = v", "col IN (...)" and "col BETWEEN lo AND hi".
+func parseSelectValues(query string, db *engine.Database, trace *engine.Trace) (interface{}, error) {
+	selectList, rows, alias, columns, whereClause, err := splitValuesSelect(query)
+	if err != nil {
+		return nil, err
+	}
+
+	if whereClause != "" {
+		rows, err = filterValues(rows, columns, alias, whereClause, db, trace)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Projection
+	positions := make([]int, len(columns))
+	for i := range columns {
+		positions[i] = i
+	}
+	if selectList != "*" {
+		selected, err := parseColumnList(selectList, alias)
+		if err != nil {
+			return nil, err
+		}
+		if len(selected) == 0 {
+			return nil, fmt.Errorf("invalid SELECT syntax: no columns selected")
+		}
+		positions = make([]int, len(selected))
+		for i, col := range selected {
+			if positions[i], err = engine.ResolveColumn(alias, columns, col); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	result := make([][]interface{}, 0, len(rows))
+	for _, row := range rows {
+		out := make([]interface{}, len(positions))
+		for i, pos := range positions {
+			out[i] = row[pos]
+		}
+		result = append(result, out)
+	}
+	return result, nil
+}
+
+// splitValuesSelect splits a SELECT over an inline VALUES list into its select
+// list, the parsed rows, the alias with its column names, and the WHERE clause
+func splitValuesSelect(query string) (selectList string, rows [][]interface{}, alias string, columns []string, whereClause string, err error) {
+	upper := strings.ToUpper(query)
+	idxFrom := strings.Index(upper, " FROM (")
+	selectList = strings.TrimSpace(query[7:idxFrom]) // len("SELECT ")
+
+	idxOpen := idxFrom + 6 // position of "(" in " FROM ("
+	idxClose, err := matchingParen(query, idxOpen)
+	if err != nil {
+		return "", nil, "", nil, "", fmt.Errorf("invalid VALUES syntax: %w", err)
+	}
+	body := strings.TrimSpace(query[idxOpen+1 : idxClose])
+	rows, err = parseValuesRows(strings.TrimSpace(body[6:])) // len("VALUES")
+	if err != nil {
+		return "", nil, "", nil, "", err
+	}
+
+	// "AS t(id, name)" and an optional WHERE
+	rest := strings.TrimSpace(query[idxClose+1:])
+	if idxWhere := strings.Index(strings.ToUpper(rest), " WHERE "); idxWhere != -1 {
+		whereClause = strings.TrimSpace(rest[idxWhere+7:]) // len(" WHERE ")
+		rest = strings.TrimSpace(rest[:idxWhere])
+	} else if strings.HasPrefix(strings.ToUpper(rest), "WHERE ") {
+		whereClause = strings.TrimSpace(rest[6:])
+		rest = ""
+	}
+	alias, columns, err = parseValuesAlias(rest, len(rows[0]))
+	if err != nil {
+		return "", nil, "", nil, "", err
+	}
+	return selectList, rows, alias, columns, whereClause, nil
+}
+
+// parseValuesRows parses "(1, 'a'), (2, 'b')" into typed rows of equal width
+func parseValuesRows(list string) ([][]interface{}, error) {
+	var rows [][]interface{}
+	for i, raw := range splitTopLevel(list, ',') {
+		tuple := strings.TrimSpace(raw)
+		if !strings.HasPrefix(tuple, "(") || !strings.HasSuffix(tuple, ")") {
+			return nil, fmt.Errorf("invalid VALUES syntax: row %d must be enclosed in ()", i+1)
+		}
+
+		var row []interface{}
+		for _, v := range splitTopLevel(tuple[1:len(tuple)-1], ',') {
+			row = append(row, literalValue(strings.TrimSpace(v)))
+		}
+		if len(rows) > 0 && len(row) != len(rows[0]) {
+			return nil, fmt.Errorf("invalid VALUES syntax: row %d has %d values, expected %d", i+1, len(row), len(rows[0]))
+		}
+		rows = append(rows, row)
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("invalid VALUES syntax: no rows")
+	}
+	return rows, nil
+}
+
+// parseValuesAlias parses "AS t(id, name)" (or just "AS t"), returning the
+// alias and column names
+func parseValuesAlias(clause string, width int) (string, []string, error) {
+	if !strings.HasPrefix(strings.ToUpper(clause), "AS ") {
+		return "", nil, fmt.Errorf("invalid VALUES syntax: expected AS alias(col1, ...) after the VALUES list")
+	}
+	clause = strings.TrimSpace(clause[3:]) // len("AS ")
+
+	idxOpen := strings.Index(clause, "(")
+	if idxOpen == -1 {
+		columns := make([]string, width)
+		for i := range columns {
+			columns[i] = "column" + strconv.Itoa(i+1)
+		}
+		return clause, columns, nil
+	}
+
+	alias := strings.TrimSpace(clause[:idxOpen])
+	if !strings.HasSuffix(clause, ")") || alias == "" {
+		return "", nil, fmt.Errorf("invalid VALUES syntax: expected AS alias(col1, ...)")
+	}
+	var columns []string
+	for _, c := range strings.Split(clause[idxOpen+1:len(clause)-1], ",") {
+		columns = append(columns, strings.TrimSpace(c))
+	}
+	if len(columns) != width {
+		return "", nil, fmt.Errorf("invalid VALUES syntax: %s names %d columns but rows have %d values", alias, len(columns), width)
+	}
+	return alias, columns, nil
+}
+
+// filterValues keeps the inline rows matching a WHERE clause
+func filterValues(rows [][]interface{}, columns []string, alias, whereClause string, db *engine.Database, trace *engine.Trace) ([][]interface{}, error) {
+	upperWhere := strings.ToUpper(whereClause)
+
+	var colRef string
+	var match func(v interface{}) bool
+	if ref, list, ok := splitIn(whereClause); ok {
+		colRef = ref
+		var values []string
+		if strings.HasPrefix(strings.ToUpper(strings.TrimSpace(list)), "SELECT ") {
+			var err error
+			if values, err = subqueryValues(strings.TrimSpace(list), db, trace); err != nil {
+				return nil, err
+			}
+		} else {
+			values = splitTopLevel(list, ',')
+		}
+		match = func(v interface{}) bool {
+			for _, candidate := range values {
+				if literalsEqual(v, literalValue(strings.TrimSpace(candidate))) {
+					return true
+				}
+			}
+			return false
+		}
+	} else if idxBetween := strings.Index(upperWhere, " BETWEEN "); idxBetween != -1 {
+		colRef = strings.TrimSpace(whereClause[:idxBetween])
+		bounds := whereClause[idxBetween+9:] // len(" BETWEEN ")
+		idxAnd := strings.Index(strings.ToUpper(bounds), " AND ")
+		if idxAnd == -1 {
+			return nil, fmt.Errorf("invalid BETWEEN clause, expected 'col BETWEEN lo AND hi'")
+		}
+		lo := literalValue(strings.TrimSpace(bounds[:idxAnd]))
+		hi := literalValue(strings.TrimSpace(bounds[idxAnd+5:])) // len(" AND ")
+		match = func(v interface{}) bool {
+			return engine.CompareValues(v, lo) >= 0 && engine.CompareValues(v, hi) <= 0
+		}
+	} else {
+		ref, value, found := strings.Cut(whereClause, "=")
+		if !found {
+			return nil, fmt.Errorf("invalid WHERE clause, expected 'col = val'")
+		}
+		colRef = strings.TrimSpace(ref)
+		want := literalValue(strings.TrimSpace(value))
+		match = func(v interface{}) bool {
+			return literalsEqual(v, want)
+		}
+	}
+
+	col, err := unqualifyColumn(colRef, alias)
+	if err != nil {
+		return nil, err
+	}
+	pos, err := engine.ResolveColumn(alias, columns, col)
+	if err != nil {
+		return nil, err
+	}
+
+	var filtered [][]interface{}
+	for _, row := range rows {
+		if match(row[pos]) {
+			filtered = append(filtered, row)
+		}
+	}
+	return filtered, nil
+}
+
+// literalValue types an inline literal: 'quoted' text stays a string, TRUE and
+// FALSE become booleans, numbers become numbers and anything else is a string
+func literalValue(raw string) interface{} {
+	if len(raw) >= 2 && strings.HasPrefix(raw, "'") && strings.HasSuffix(raw, "'") {
+		return raw[1 : len(raw)-1]
+	}
+	switch strings.ToUpper(raw) {
+	case "TRUE":
+		return true
+	case "FALSE":
+		return false
+	}
+	if n, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		return n
+	}
+	if f, err := strconv.ParseFloat(raw, 64); err == nil {
+		return f
+	}
+	return raw
+}
+
+// literalsEqual compares two literals; text compares ignoring case, like
+// WHERE on stored tables
+func literalsEqual(a, b interface{}) bool {
+	sa, aText := a.(string)
+	sb, bText := b.(string)
+	if aText && bText {
+		return strings.EqualFold(sa, sb)
+	}
+	return engine.CompareValues(a, b) == 0
+}
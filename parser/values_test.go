@@ -0,0 +1,52 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSelectValues(t *testing.T) {
+	db := newTestDB(t)
+	const inline = "(VALUES (1, 'a'), (2, 'b,c'), (3, 'x=y'), (4, TRUE)) AS t(id, name)"
+
+	tests := []struct {
+		name  string
+		query string
+		want  [][]interface{}
+	}{
+		{"all rows", "SELECT * FROM " + inline,
+			[][]interface{}{{int64(1), "a"}, {int64(2), "b,c"}, {int64(3), "x=y"}, {int64(4), true}}},
+		{"equality", "SELECT id FROM " + inline + " WHERE name = 'a'", [][]interface{}{{int64(1)}}},
+		{"equality ignores case", "SELECT id FROM " + inline + " WHERE name = 'A'", [][]interface{}{{int64(1)}}},
+		{"equals sign in the value", "SELECT id FROM " + inline + " WHERE name = 'x=y'", [][]interface{}{{int64(3)}}},
+		{"number", "SELECT name FROM " + inline + " WHERE id = 2", [][]interface{}{{"b,c"}}},
+		{"bool", "SELECT id FROM " + inline + " WHERE name = true", [][]interface{}{{int64(4)}}},
+		{"IN with a comma in a value", "SELECT id FROM " + inline + " WHERE name IN ('b,c', 'a')", [][]interface{}{{int64(1)}, {int64(2)}}},
+		{"BETWEEN", "SELECT id FROM " + inline + " WHERE id BETWEEN 2 AND 3", [][]interface{}{{int64(2)}, {int64(3)}}},
+		{"qualified", "SELECT t.name FROM " + inline + " WHERE t.id = 1", [][]interface{}{{"a"}}},
+		{"no match", "SELECT * FROM " + inline + " WHERE id = 9", [][]interface{}{}},
+		{"default column names", "SELECT column2 FROM (VALUES (1, 'a'), (2, 'b')) AS t WHERE column1 = 2", [][]interface{}{{"b"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := queryRows(t, db, tt.query); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	for _, query := range []string{
+		"SELECT * FROM (VALUES (1, 'a'), (2)) AS t(id, name)",
+		"SELECT * FROM (VALUES (1, 'a')) AS t(id)",
+		"SELECT * FROM (VALUES (1, 'a'))",
+		"SELECT missing FROM " + inline,
+		"SELECT * FROM " + inline + " WHERE other.id = 1",
+	} {
+		if _, err := Execute(db, query); err == nil {
+			t.Errorf("%s: no error", query)
+		}
+	}
+	if tables := mustExecute(t, db, "SHOW TABLES"); !reflect.DeepEqual(tables, []string{}) {
+		t.Errorf("SHOW TABLES = %v, want no tables created", tables)
+	}
+}
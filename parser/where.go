@@ -0,0 +1,211 @@
+package parser
+
+import (
+	"fmt"
+	"pesapal-ledger/engine"
+	"strconv"
+	"strings"
+)
+
+// numericExpr reads text that parses as a number as that number, so two
+// columns holding numbers compare numerically whatever their declared type
+type numericExpr struct{ e expr }
+
+func (n numericExpr) eval(row []interface{}) interface{} {
+	v := n.e.eval(row)
+	s, ok := v.(string)
+	if !ok {
+		return v
+	}
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return i
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f
+	}
+	return v
+}
+
+// columnComparison parses "a op b" where both sides are columns of the table,
+// e.g. "debit != credit". ok is false when the right side isn't a column,
+// leaving the clause to be read as a comparison with a literal. Blob columns
+// can't be compared.
+func columnComparison(tableName, whereClause string, columns []string, db *engine.Database) (condition, bool, error) {
+	idx, op := -1, ""
+	for _, candidate := range exprOps {
+		if i := indexKeyword(whereClause, candidate); i != -1 && (idx == -1 || i < idx) {
+			idx, op = i, candidate
+		}
+	}
+	if idx <= 0 {
+		return condition{}, false, nil
+	}
+
+	right := strings.TrimSpace(whereClause[idx+len(op):])
+	if strings.HasPrefix(right, "'") || hasExpressions(right) {
+		return condition{}, false, nil
+	}
+	rightCol, err := unqualifyColumn(right, tableName)
+	if err != nil {
+		return condition{}, false, nil
+	}
+	if _, err := engine.ResolveColumn(tableName, columns, rightCol); err != nil && !engine.IsAmbiguousColumn(err) {
+		return condition{}, false, nil // not a column: a literal
+	}
+
+	left, err := parseExpr(whereClause[:idx], tableName, columns)
+	if err != nil {
+		return condition{}, false, err
+	}
+	rightExpr, err := parseExpr(rightCol, tableName, columns)
+	if err != nil {
+		return condition{}, false, err
+	}
+	for _, e := range []expr{left, rightExpr} {
+		col, isColumn := e.(columnExpr)
+		if !isColumn {
+			continue
+		}
+		if types, err := db.ColumnTypes(tableName, columns[col.pos:col.pos+1]); err == nil {
+			if err := engine.CheckComparable(types[0]); err != nil {
+				return condition{}, false, err
+			}
+		}
+	}
+	return condition{left: numericExpr{left}, right: numericExpr{rightExpr}, op: op}, true, nil
+}
+
+// timeExpr reads the stored value of a date or timestamp column as a time,
+// so it compares chronologically. Values that don't parse count as NULL.
+type timeExpr struct {
+	e   expr
+	col engine.Column
+}
+
+func (t timeExpr) eval(row []interface{}) interface{} {
+	v := t.e.eval(row)
+	s, ok := v.(string)
+	if !ok || s == "" {
+		return v
+	}
+	tm, err := engine.ParseTime(t.col, s)
+	if err != nil {
+		return nil
+	}
+	return tm
+}
+
+// timeComparison parses "col op value" where col is a date or timestamp
+// column, e.g. "created >= '2024-01-01'". The value is another column or a
+// literal, which must parse as a date or timestamp. Both sides compare as
+// times. ok is false when the left side isn't a date or timestamp column.
+func timeComparison(tableName, whereClause string, columns []string, db *engine.Database) (condition, bool, error) {
+	idx, op := -1, ""
+	for _, candidate := range exprOps {
+		if i := indexKeyword(whereClause, candidate); i != -1 && (idx == -1 || i < idx) {
+			idx, op = i, candidate
+		}
+	}
+	if idx <= 0 {
+		return condition{}, false, nil
+	}
+
+	leftCol, err := unqualifyColumn(strings.TrimSpace(whereClause[:idx]), tableName)
+	if err != nil {
+		return condition{}, false, nil
+	}
+	types, err := db.ColumnTypes(tableName, []string{leftCol})
+	if err != nil || !types[0].IsTimeType() {
+		return condition{}, false, nil
+	}
+	pos, err := engine.ResolveColumn(tableName, columns, leftCol)
+	if err != nil {
+		return condition{}, false, err
+	}
+	cond := condition{left: timeExpr{e: columnExpr{pos: pos}, col: types[0]}, op: op}
+
+	right := strings.TrimSpace(whereClause[idx+len(op):])
+	if !strings.HasPrefix(right, "'") {
+		if rightCol, err := unqualifyColumn(right, tableName); err == nil {
+			if rightPos, err := engine.ResolveColumn(tableName, columns, rightCol); err == nil {
+				rightTypes, err := db.ColumnTypes(tableName, []string{rightCol})
+				if err != nil || !rightTypes[0].IsTimeType() {
+					return condition{}, false, fmt.Errorf("can't compare %s column %s with %s", types[0].Type, types[0].Name, rightCol)
+				}
+				cond.right = timeExpr{e: columnExpr{pos: rightPos}, col: rightTypes[0]}
+				return cond, true, nil
+			}
+		}
+	}
+
+	right, err = unquoteValue(right)
+	if err != nil {
+		return condition{}, false, err
+	}
+	value, err := engine.ParseTime(types[0], right)
+	if err != nil {
+		return condition{}, false, err
+	}
+	cond.right = literalExpr{value: value}
+	return cond, true, nil
+}
+
+// selectWhere scans a table and keeps the rows for which cond holds, in
+// primary key order. cond is evaluated over the typed row, laid out as columns.
+func selectWhere(tableName string, columns []string, cond condition, db *engine.Database, trace *engine.Trace) ([][]string, error) {
+	match, matchErr := rowMatcher(tableName, columns, cond, db)
+	rows, err := db.Reader(trace).SelectMatching(tableName, match)
+	if err == nil {
+		err = *matchErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// rowMatcher returns a function reporting whether cond holds for a raw row.
+// A row that can't be typed doesn't match, and the first such error is left
+// in the returned error pointer for the caller to check after the scan.
+func rowMatcher(tableName string, columns []string, cond condition, db *engine.Database) (func(row []string) bool, *error) {
+	var matchErr error
+	return func(row []string) bool {
+		if matchErr != nil {
+			return false
+		}
+		typed, err := db.TypeRows(tableName, columns, [][]string{row})
+		if err != nil {
+			matchErr = err
+			return false
+		}
+		return cond.holds(typed[0])
+	}, &matchErr
+}
+
+// parsePredicates parses "col op value [AND col op value ...]", e.g.
+// "amount > 1000 AND status = 'done'", where op is a comparison operator.
+// Values may be quoted; the right side is always a value, not a column.
+func parsePredicates(tableName, whereClause string) ([]engine.Predicate, error) {
+	var preds []engine.Predicate
+	for _, term := range splitAndTerms(whereClause) {
+		idx, op := -1, ""
+		for _, candidate := range exprOps {
+			if i := indexKeyword(term, candidate); i != -1 && (idx == -1 || i < idx) {
+				idx, op = i, candidate
+			}
+		}
+		if idx <= 0 {
+			return nil, fmt.Errorf("invalid condition %q in WHERE clause: expected 'col op value'", term)
+		}
+		col, err := unqualifyColumn(strings.TrimSpace(term[:idx]), tableName)
+		if err != nil {
+			return nil, err
+		}
+		value, err := unquoteValue(term[idx+len(op):])
+		if err != nil {
+			return nil, fmt.Errorf("invalid condition %q in WHERE clause: %w", term, err)
+		}
+		preds = append(preds, engine.Predicate{Column: col, Op: op, Value: value})
+	}
+	return preds, nil
+}
@@ -0,0 +1,240 @@
+package parser
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWhereBool(t *testing.T) {
+	db := newTestDB(t,
+		"CREATE TABLE flags (id int, active bool)",
+		"INSERT INTO flags VALUES (1, TRUE)",
+		"INSERT INTO flags VALUES (2, false)",
+		"INSERT INTO flags VALUES (3, 1)",
+		"INSERT INTO flags VALUES (4, 'FALSE')",
+		"INSERT INTO flags VALUES (5, 0)",
+	)
+
+	trueIDs := [][]interface{}{{int64(1)}, {int64(3)}}
+	falseIDs := [][]interface{}{{int64(2)}, {int64(4)}, {int64(5)}}
+	tests := []struct {
+		where string
+		want  [][]interface{}
+	}{
+		{"active = true", trueIDs},
+		{"active = TRUE", trueIDs},
+		{"active = 1", trueIDs},
+		{"active = 'True'", trueIDs},
+		{"active = false", falseIDs},
+		{"active = 0", falseIDs},
+		{"active != true", falseIDs},
+	}
+	for _, tt := range tests {
+		t.Run(tt.where, func(t *testing.T) {
+			got := queryRows(t, db, "SELECT id FROM flags WHERE "+tt.where)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// Stored in canonical form and returned as JSON booleans
+	rows := queryRows(t, db, "SELECT active FROM flags WHERE id = 4")
+	if !reflect.DeepEqual(rows, [][]interface{}{{false}}) {
+		t.Errorf("SELECT active = %v, want [[false]]", rows)
+	}
+	if _, err := Execute(db, "INSERT INTO flags VALUES (6, maybe)"); err == nil {
+		t.Error("inserting a non-boolean into a bool column succeeded")
+	}
+}
+
+func TestWhereColumnComparison(t *testing.T) {
+	db := newTestDB(t,
+		"CREATE TABLE txns (id int, debit int, credit float, payer text, payee text, ref text, code text)",
+		"INSERT INTO txns VALUES (4, 75, 50, payee, erin, 10, 9)",
+		"INSERT INTO txns VALUES (1, 100, 100.0, alice, bob, 9, 10)",
+		"INSERT INTO txns VALUES (3, 50, 75, carol, dave, abc, abd)",
+		"INSERT INTO txns VALUES (2, 100, 90.5, alice, Alice, 10, 10)",
+	)
+
+	// Matches come in key order, not insertion order
+
+	tests := []struct {
+		where string
+		want  []int64
+	}{
+		// Numeric columns, int against float
+		{"debit = credit", []int64{1}},
+		{"debit != credit", []int64{2, 3, 4}},
+		{"debit <> credit", []int64{2, 3, 4}},
+		{"debit > credit", []int64{2, 4}},
+		{"debit >= credit", []int64{1, 2, 4}},
+		{"debit < credit", []int64{3}},
+		{"credit <= debit", []int64{1, 2, 4}},
+		// Text columns; = and != ignore case
+		{"payer = payee", []int64{2}},
+		{"payer != payee", []int64{1, 3, 4}},
+		{"code > ref", []int64{1, 3}},
+		// Text holding numbers compares numerically: 9 < 10
+		{"ref < code", []int64{1, 3}},
+		{"ref = code", []int64{2}},
+		// Qualified names, and a quoted name meaning the text
+		{"txns.debit = txns.credit", []int64{1}},
+		{"payer = 'payee'", []int64{4}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.where, func(t *testing.T) {
+			var got []int64
+			for _, row := range queryRows(t, db, "SELECT id FROM txns WHERE "+tt.where) {
+				got = append(got, row[0].(int64))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got ids %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// UPDATE and DELETE take the comparison with a LIMIT, first keys first
+	mustExecute(t, db, "UPDATE txns SET code = fixed WHERE debit != credit LIMIT 1")
+	if got, want := queryRows(t, db, "SELECT id FROM txns WHERE code = fixed"), [][]interface{}{{int64(2)}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("rows updated = %v, want %v", got, want)
+	}
+	mustExecute(t, db, "DELETE FROM txns WHERE debit > credit LIMIT 10")
+	if got, want := queryRows(t, db, "SELECT id FROM txns"), [][]interface{}{{int64(1)}, {int64(3)}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("rows left = %v, want %v", got, want)
+	}
+}
+
+func TestWhereBlob(t *testing.T) {
+	db := newTestDB(t,
+		"CREATE TABLE files (id int, data blob, name text)",
+		"INSERT INTO files VALUES (1, 'a|b\nc\x00d', x)",
+		"INSERT INTO files VALUES (2, 'YXxi', y)",
+	)
+
+	if got, want := queryRows(t, db, "SELECT data FROM files WHERE id = 1"), [][]interface{}{{[]byte("a|b\nc\x00d")}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("blob value = %q, want %q", got, want)
+	}
+
+	// Blobs are stored encoded, so no WHERE condition may compare them,
+	// not even with the encoded form of a stored value
+	for _, where := range []string{
+		"data = 'a|b'",
+		"data = YXxi",
+		"data > a",
+		"data IN (a, b)",
+		"data = name",
+		"name = data",
+		"id = 1 AND data = x",
+	} {
+		t.Run(where, func(t *testing.T) {
+			_, err := Execute(db, "SELECT id FROM files WHERE "+where)
+			if err == nil || !strings.Contains(err.Error(), "can't compare blob column data") {
+				t.Errorf("err = %v, want the blob comparison refused", err)
+			}
+		})
+	}
+	if _, err := Execute(db, "DELETE FROM files WHERE data = YXxi LIMIT 1"); err == nil {
+		t.Error("DELETE by a blob value succeeded")
+	}
+	if rows := queryRows(t, db, "SELECT id FROM files"); len(rows) != 2 {
+		t.Errorf("rows left = %v, want both", rows)
+	}
+}
+
+func TestWhereTimestamp(t *testing.T) {
+	db := newTestDB(t,
+		"CREATE TABLE ev (id int, created timestamp, due date, note text)",
+		"INSERT INTO ev VALUES (1, '2023-12-31T23:59:59Z', 2023-12-31, a)",
+		"INSERT INTO ev VALUES (2, '2024-01-01T00:00:00Z', 2024-01-01, b)",
+		"INSERT INTO ev VALUES (3, '2024-01-01T02:30:00+03:00', 2024-02-29, c)",
+		"INSERT INTO ev VALUES (4, '2024-01-01 00:00:00.5', 2024-03-01, d)",
+		"INSERT INTO ev VALUES (5, 2024-02-29, 2024-01-01, e)",
+		"INSERT INTO ev VALUES (6, '', 2024-01-01, f)",
+	)
+
+	tests := []struct {
+		where string
+		want  []int64
+	}{
+		// Across midnight of the new year; 3 is 23:30 UTC the day before
+		{"created >= '2024-01-01'", []int64{2, 4, 5}},
+		{"created < '2024-01-01'", []int64{1, 3}},
+		{"created > '2024-01-01T00:00:00Z'", []int64{4, 5}},
+		{"created <= 2024-01-01T03:00:00+03:00", []int64{1, 2, 3}},
+		{"created = '2023-12-31T23:30:00Z'", []int64{3}},
+		{"created = '2024-01-01 02:30:00+03:00'", []int64{3}},
+		{"created != '2024-01-01'", []int64{1, 3, 4, 5}},
+		// Leap day and the day after
+		{"due >= 2024-02-29", []int64{3, 4}},
+		{"due > '2024-02-29'", []int64{4}},
+		// A timestamp literal against a date column counts as its day
+		{"ev.due <= '2024-01-01T12:00:00Z'", []int64{1, 2, 5, 6}},
+		// Two time columns
+		{"due = created", []int64{2}},
+		{"created > due", []int64{1, 5}},
+		{"created >= '2024-01-01' AND id > 2", []int64{4, 5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.where, func(t *testing.T) {
+			var got []int64
+			for _, row := range queryRows(t, db, "SELECT id FROM ev WHERE "+tt.where) {
+				got = append(got, row[0].(int64))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got ids %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	for _, query := range []string{
+		"SELECT id FROM ev WHERE due > yesterday",
+		"SELECT id FROM ev WHERE created < '2024-13-01'",
+		"SELECT id FROM ev WHERE due > note",
+		"INSERT INTO ev VALUES (7, 2024-01-01, 2023-02-29, g)",
+		"UPDATE ev SET created = nope WHERE id = 1",
+	} {
+		if _, err := Execute(db, query); err == nil {
+			t.Errorf("%s: expected an error", query)
+		}
+	}
+}
+
+func TestWhereKeyOrder(t *testing.T) {
+	// Rows go in out of key order, and an update moves one to the end of the file
+	db := newTestDB(t,
+		"CREATE TABLE t (id int, grp text)",
+		"CREATE TABLE e (student int, course text, grade text, PRIMARY KEY (student, course))",
+		"INSERT INTO t VALUES (10, a)",
+		"INSERT INTO t VALUES (2, b)",
+		"INSERT INTO t VALUES (33, b)",
+		"INSERT INTO t VALUES (1, a)",
+		"UPDATE t SET grp = a WHERE id = 2",
+		"INSERT INTO e VALUES (10, math, A)",
+		"INSERT INTO e VALUES (2, math, A)",
+		"INSERT INTO e VALUES (2, art, A)",
+		"INSERT INTO e VALUES (1, art, B)",
+	)
+
+	tests := []struct {
+		query string
+		want  [][]interface{}
+	}{
+		{"SELECT id FROM t WHERE grp = a", [][]interface{}{{int64(1)}, {int64(2)}, {int64(10)}}},
+		{"SELECT id FROM t WHERE grp IN (a, c)", [][]interface{}{{int64(1)}, {int64(2)}, {int64(10)}}},
+		{"SELECT id FROM t WHERE grp = 'a' AND id > 1", [][]interface{}{{int64(2)}, {int64(10)}}},
+		{"SELECT id FROM t WHERE grp <> c", [][]interface{}{{int64(1)}, {int64(2)}, {int64(10)}, {int64(33)}}},
+		{"SELECT student, course FROM e WHERE grade = A", [][]interface{}{{int64(2), "art"}, {int64(2), "math"}, {int64(10), "math"}}},
+		{"SELECT student, course FROM e WHERE grade IN (A, B)", [][]interface{}{{int64(1), "art"}, {int64(2), "art"}, {int64(2), "math"}, {int64(10), "math"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			for i := 0; i < 3; i++ {
+				if got := queryRows(t, db, tt.query); !reflect.DeepEqual(got, tt.want) {
+					t.Fatalf("run %d: got %v, want %v", i+1, got, tt.want)
+				}
+			}
+		})
+	}
+}
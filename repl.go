@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"pesapal-ledger/engine"
+	"pesapal-ledger/parser"
+	"strings"
+)
+
+// replPrompt is shown before each statement when stdin is a terminal
+const replPrompt = "liteledger> "
+
+// runREPL runs "lite-ledger repl [--data dir]": it opens the database
+// directly, without the HTTP server, and runs the SQL read from stdin one
+// line at a time. Result sets are printed as aligned text tables. ".exit" or
+// the end of input quits.
+func runREPL(args []string) {
+	flags := flag.NewFlagSet("repl", flag.ExitOnError)
+	dataDir := flags.String("data", "", "the data directory to open (default $LITELEDGER_DATA_DIR or data)")
+	flags.Parse(args)
+
+	db := openDatabase(false, *dataDir)
+
+	prompt := ""
+	if info, err := os.Stdin.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+		prompt = replPrompt
+	}
+	repl(db, os.Stdin, os.Stdout, prompt)
+	closeDatabase(db)
+}
+
+// repl runs each line of in as a statement and writes its result, or error,
+// to out. Blank lines are skipped; ".exit" stops.
+func repl(db *engine.Database, in io.Reader, out io.Writer, prompt string) {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for {
+		fmt.Fprint(out, prompt)
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				fmt.Fprintf(out, "Error: %v\n", err)
+			}
+			if prompt != "" {
+				fmt.Fprintln(out)
+			}
+			return
+		}
+
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+			continue
+		case line == ".exit":
+			return
+		}
+
+		result, err := parser.Execute(db, line)
+		if err != nil {
+			fmt.Fprintf(out, "Error: %v\n", err)
+			continue
+		}
+		printResult(out, db, line, result)
+	}
+}
+
+// printResult writes a statement's result: rows as a table, messages as they
+// are and anything else (SHOW, EXPLAIN, PEEK, ...) as indented JSON
+func printResult(out io.Writer, db *engine.Database, query string, result interface{}) {
+	switch v := result.(type) {
+	case [][]interface{}:
+		printTable(out, resultHeaders(db, query, v), v)
+	case string:
+		fmt.Fprintln(out, v)
+	case nil:
+		fmt.Fprintln(out, "OK")
+	default:
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			fmt.Fprintf(out, "Error: %v\n", err)
+			return
+		}
+		fmt.Fprintln(out, string(data))
+	}
+}
+
+// resultHeaders names the columns of a result set after the select list, or
+// numbers them when the query doesn't name them (SELECT * includes the
+// active_flag, for one)
+func resultHeaders(db *engine.Database, query string, rows [][]interface{}) []string {
+	if columnar, err := parser.Columnar(db, query, rows); err == nil {
+		return columnar.Columns
+	}
+	width := 0
+	for _, row := range rows {
+		width = max(width, len(row))
+	}
+	headers := make([]string, width)
+	for i := range headers {
+		headers[i] = fmt.Sprint(i + 1)
+	}
+	return headers
+}
+
+// printTable writes rows under headers as an aligned text table, followed by
+// the row count
+func printTable(out io.Writer, headers []string, rows [][]interface{}) {
+	cells := make([][]string, len(rows))
+	widths := make([]int, len(headers))
+	for i, header := range headers {
+		widths[i] = len(header)
+	}
+	for r, row := range rows {
+		cells[r] = make([]string, len(headers))
+		for i := range headers {
+			if i < len(row) {
+				cells[r][i] = formatCell(row[i])
+			}
+			widths[i] = max(widths[i], len(cells[r][i]))
+		}
+	}
+
+	writeLine := func(values []string) {
+		padded := make([]string, len(values))
+		for i, value := range values {
+			padded[i] = value + strings.Repeat(" ", widths[i]-len(value))
+		}
+		fmt.Fprintln(out, strings.TrimRight(" "+strings.Join(padded, " | "), " "))
+	}
+	writeLine(headers)
+	rules := make([]string, len(widths))
+	for i, width := range widths {
+		rules[i] = strings.Repeat("-", width+2)
+	}
+	fmt.Fprintln(out, strings.Join(rules, "+"))
+	for _, row := range cells {
+		writeLine(row)
+	}
+
+	if len(rows) == 1 {
+		fmt.Fprintln(out, "(1 row)")
+	} else {
+		fmt.Fprintf(out, "(%d rows)\n", len(rows))
+	}
+}
+
+// formatCell renders a typed value the way the JSON API shows it, without
+// the quotes
+func formatCell(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return base64.StdEncoding.EncodeToString(v)
+	case string:
+		return v
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestREPLMalformedStatements(t *testing.T) {
+	s := newTestServer(t, "CREATE TABLE users (id int, name text)")
+
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"INSERT INTO", "Error: invalid INSERT syntax"},
+		{"INSERT INTO ", "Error: invalid INSERT syntax"},
+		{"DELETE FROM", "Error: invalid DELETE syntax"},
+		{"INSERT INTO users VALUES (1, alice)", "inserted"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			var out bytes.Buffer
+			repl(s.db, strings.NewReader(tt.line+"\n"), &out, "")
+			if !strings.Contains(out.String(), tt.want) {
+				t.Errorf("output %q, want it to contain %q", out.String(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestRequestID(t *testing.T) {
+	s := newTestServer(t, "CREATE TABLE users (id int, name text)")
+
+	var logs bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	generated := regexp.MustCompile(`^[0-9a-f]{32}$`)
+	tests := []struct {
+		name string
+		sent string
+		want string // "" expects a generated id
+	}{
+		{"provided", "trace-42", "trace-42"},
+		{"missing", "", ""},
+		{"too long", strings.Repeat("x", maxRequestIDLength+1), ""},
+		{"longest accepted", strings.Repeat("y", maxRequestIDLength), strings.Repeat("y", maxRequestIDLength)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs.Reset()
+			var seen string
+			handler := withRequestID(func(w http.ResponseWriter, r *http.Request) {
+				seen = RequestID(r.Context())
+				s.handleSQL(w, r)
+			})
+			rec, resp := serve(t, func(w http.ResponseWriter, r *http.Request) {
+				if tt.sent != "" {
+					r.Header.Set(requestIDHeader, tt.sent)
+				}
+				handler(w, r)
+			}, http.MethodPost, "/sql", `{"query": "SELECT * FROM missing"}`)
+			if rec.Code != http.StatusNotFound {
+				t.Fatalf("status %d (%s), want 404", rec.Code, resp.Error)
+			}
+
+			echoed := rec.Header().Get(requestIDHeader)
+			if tt.want != "" && echoed != tt.want {
+				t.Errorf("echoed id %q, want %q", echoed, tt.want)
+			}
+			if tt.want == "" && !generated.MatchString(echoed) {
+				t.Errorf("echoed id %q, want a generated one", echoed)
+			}
+			if seen != echoed {
+				t.Errorf("handler saw id %q, response carries %q", seen, echoed)
+			}
+
+			// Both the failed query and the request summary are logged with the id
+			lines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+			if len(lines) != 2 {
+				t.Fatalf("logged %d lines, want 2:\n%s", len(lines), logs.String())
+			}
+			for _, line := range lines {
+				if !strings.Contains(line, "request_id="+echoed) {
+					t.Errorf("log line without the request id: %s", line)
+				}
+			}
+		})
+	}
+}
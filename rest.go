@@ -0,0 +1,394 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"pesapal-ledger/engine"
+	"pesapal-ledger/parser"
+	"strings"
+)
+
+// writeJSON writes an SQLResponse with the given status code
+func writeJSON(w http.ResponseWriter, status int, resp SQLResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// writeAuthorizeError answers 403 for a statement the authorizer denied and
+// 400 when the statement couldn't be read to ask it
+func writeAuthorizeError(w http.ResponseWriter, err error) {
+	status := http.StatusBadRequest
+	if errors.Is(err, parser.ErrNotAuthorized) {
+		status = http.StatusForbidden
+	}
+	writeJSON(w, status, SQLResponse{Success: false, Error: err.Error()})
+}
+
+// writeEngineError answers a failed engine call with the status /sql gives the
+// same error (see sqlErrorStatus), or 503 in maintenance mode
+func writeEngineError(w http.ResponseWriter, err error) {
+	if writeMaintenanceError(w, err) {
+		return
+	}
+	writeJSON(w, sqlErrorStatus(err), SQLResponse{Success: false, Error: err.Error()})
+}
+
+// handleTableRows serves the REST row routes that sit alongside /sql:
+//
+//	POST   /tables/{name}/rows       insert a row from a JSON object (column -> value)
+//	GET    /tables/{name}/rows/{id}  fetch a row by primary key as a JSON object
+//	PUT    /tables/{name}/rows/{id}  update the columns given in a JSON object
+//	DELETE /tables/{name}/rows/{id}  delete a row by primary key
+//	POST   /tables/{name}/import     import CSV rows (see importCSV)
+//
+// {id} is the row's primary key. On a table with a composite PRIMARY KEY it
+// is the key values in key column order joined by commas, with a comma
+// inside a value escaped as %2C: /tables/enrollments/rows/7,CS101.
+//
+// Writes answer with the affected row as a JSON object: the row as inserted
+// or updated, or as it was before the delete.
+func (s *Server) handleTableRows(w http.ResponseWriter, r *http.Request) {
+	// Split the escaped path, so an escaped comma in {id} stays escaped
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.EscapedPath(), "/tables/"), "/"), "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || !(parts[1] == "rows" || parts[1] == "import" && len(parts) == 2) {
+		writeJSON(w, http.StatusNotFound, SQLResponse{Success: false, Error: "Not found"})
+		return
+	}
+
+	tableName, err := url.PathUnescape(parts[0])
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, SQLResponse{Success: false, Error: "Not found"})
+		return
+	}
+	// Ask before looking the table up, so a denied caller can't probe for tables
+	var stmtType string
+	switch r.Method {
+	case http.MethodPost:
+		stmtType = "INSERT"
+	case http.MethodGet:
+		stmtType = "SELECT"
+	case http.MethodPut:
+		stmtType = "UPDATE"
+	case http.MethodDelete:
+		stmtType = "DELETE"
+	}
+	if stmtType != "" {
+		if err := s.authorize.Check(r.Context(), stmtType, tableName); err != nil {
+			writeAuthorizeError(w, err)
+			return
+		}
+	}
+
+	metadata, exists := s.db.Table(tableName)
+	if !exists {
+		writeJSON(w, http.StatusNotFound, SQLResponse{
+			Success: false,
+			Error:   fmt.Sprintf("table %s does not exist", tableName),
+		})
+		return
+	}
+
+	// /tables/{name}/import
+	if parts[1] == "import" {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		s.importCSV(w, r, metadata)
+		return
+	}
+
+	// /tables/{name}/rows
+	if len(parts) == 2 {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		s.createRow(w, r, metadata)
+		return
+	}
+
+	// /tables/{name}/rows/{id}
+	id, err := s.rowKeyFromPath(metadata, parts[2])
+	if err != nil {
+		writeJSON(w, sqlErrorStatus(err), SQLResponse{Success: false, Error: "Invalid row id: " + err.Error()})
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		s.getRow(w, tableName, id)
+	case http.MethodPut:
+		s.updateRow(w, r, metadata, id)
+	case http.MethodDelete:
+		s.deleteRow(w, tableName, id)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// createRow inserts a row from a JSON object and answers 201 with its Location
+func (s *Server) createRow(w http.ResponseWriter, r *http.Request, metadata engine.TableMetadata) {
+	decoder := json.NewDecoder(r.Body)
+	decoder.UseNumber() // keep numbers exactly as sent
+	var body map[string]interface{}
+	if err := decoder.Decode(&body); err != nil {
+		writeJSON(w, http.StatusBadRequest, SQLResponse{Success: false, Error: "Invalid request body: expected a JSON object"})
+		return
+	}
+
+	row, err := rowFromObject(metadata, body)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, SQLResponse{Success: false, Error: err.Error()})
+		return
+	}
+
+	inserted, err := s.db.UpsertRow(metadata.Name, row, nil)
+	if err != nil {
+		writeEngineError(w, err)
+		return
+	}
+	if !inserted {
+		writeJSON(w, http.StatusConflict, SQLResponse{
+			Success: false,
+			Error:   fmt.Sprintf("record with id %s already exists in table %s", strings.Join(metadata.KeyValues(row), ", "), metadata.Name),
+		})
+		return
+	}
+
+	// Read the row back by its key; the insert filled in any serial id and
+	// normalized the values, so row holds the key as stored
+	keyValues := make(map[string]string)
+	for i, value := range metadata.KeyValues(row) {
+		keyValues[metadata.KeyColumns()[i]] = value
+	}
+	key, err := s.db.KeyFor(metadata.Name, keyValues)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, SQLResponse{Success: false, Error: err.Error()})
+		return
+	}
+	created, err := s.rowObject(metadata.Name, key)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, SQLResponse{Success: false, Error: err.Error()})
+		return
+	}
+
+	w.Header().Set("Location", rowPath(metadata, row))
+	writeJSON(w, http.StatusCreated, SQLResponse{Success: true, Data: created})
+}
+
+// rowKeyFromPath turns the escaped {id} of a row URL into the table's index
+// key. A composite key is split on commas and its values matched up with the
+// key columns in order.
+func (s *Server) rowKeyFromPath(metadata engine.TableMetadata, segment string) (string, error) {
+	if !metadata.CompositeKey() {
+		return url.PathUnescape(segment)
+	}
+
+	keyColumns := metadata.KeyColumns()
+	parts := strings.Split(segment, ",")
+	if len(parts) != len(keyColumns) {
+		return "", fmt.Errorf("table %s is keyed on (%s): expected %d comma-separated values, got %d",
+			metadata.Name, strings.Join(keyColumns, ", "), len(keyColumns), len(parts))
+	}
+	values := make(map[string]string, len(parts))
+	for i, part := range parts {
+		value, err := url.PathUnescape(part)
+		if err != nil {
+			return "", err
+		}
+		values[keyColumns[i]] = value
+	}
+	return s.db.KeyFor(metadata.Name, values)
+}
+
+// rowPath is the URL of a stored row, as rowKeyFromPath reads it back
+func rowPath(metadata engine.TableMetadata, row []string) string {
+	parts := metadata.KeyValues(row)
+	for i, part := range parts {
+		// PathEscape leaves commas alone, but they separate the key values
+		parts[i] = strings.ReplaceAll(url.PathEscape(part), ",", "%2C")
+	}
+	return "/tables/" + url.PathEscape(metadata.Name) + "/rows/" + strings.Join(parts, ",")
+}
+
+// getRow returns a single row by primary key, keyed by column name.
+// Unknown ids answer 404.
+func (s *Server) getRow(w http.ResponseWriter, tableName, id string) {
+	row, err := s.rowObject(tableName, id)
+	if err != nil {
+		writeEngineError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, SQLResponse{Success: true, Data: row})
+}
+
+// updateRow applies a JSON object (column -> new value) to a row by primary
+// key and returns the updated row. Columns left out keep their values; the
+// key columns can't be changed.
+func (s *Server) updateRow(w http.ResponseWriter, r *http.Request, metadata engine.TableMetadata, id string) {
+	decoder := json.NewDecoder(r.Body)
+	decoder.UseNumber() // keep numbers exactly as sent
+	var body map[string]interface{}
+	if err := decoder.Decode(&body); err != nil {
+		writeJSON(w, http.StatusBadRequest, SQLResponse{Success: false, Error: "Invalid request body: expected a JSON object"})
+		return
+	}
+
+	updates, err := updatesFromObject(metadata, id, body)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, SQLResponse{Success: false, Error: err.Error()})
+		return
+	}
+
+	row, err := s.db.UpdateRowReturning(metadata.Name, id, updates)
+	if err != nil {
+		writeEngineError(w, err)
+		return
+	}
+	s.writeRowObject(w, metadata.Name, row)
+}
+
+// deleteRow tombstones a single row by primary key and returns it as it was
+func (s *Server) deleteRow(w http.ResponseWriter, tableName, id string) {
+	row, err := s.db.DeleteRowReturning(tableName, id)
+	if err != nil {
+		writeEngineError(w, err)
+		return
+	}
+	s.writeRowObject(w, tableName, row)
+}
+
+// writeRowObject answers 200 with a stored row keyed by column name
+func (s *Server) writeRowObject(w http.ResponseWriter, tableName string, row []string) {
+	object, err := s.db.RowObject(tableName, row)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, SQLResponse{Success: false, Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, SQLResponse{Success: true, Data: object})
+}
+
+// rowObject reads a row by id and returns it keyed by column name, typed by the schema
+func (s *Server) rowObject(tableName, id string) (map[string]interface{}, error) {
+	row, err := s.db.FindByID(tableName, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.db.RowObject(tableName, row)
+}
+
+// rowFromObject validates a JSON object against the schema and builds the
+// stored row: id, active_flag, then the remaining columns in schema order
+func rowFromObject(metadata engine.TableMetadata, body map[string]interface{}) ([]string, error) {
+	schema := metadata.Schema()
+	names := make([]string, len(schema))
+	for i, col := range schema {
+		names[i] = col.Name
+	}
+
+	// Map each key to its column, rejecting columns that aren't in the
+	// schema and columns given twice in different case
+	given := make(map[int]interface{}, len(body))
+	for key, val := range body {
+		pos, err := engine.ResolveColumn(metadata.Name, names, key)
+		if err != nil {
+			return nil, err
+		}
+		if _, dup := given[pos]; dup {
+			return nil, fmt.Errorf("column %s is given more than once", names[pos])
+		}
+		given[pos] = val
+	}
+
+	values := make([]string, len(schema))
+	for i, col := range schema {
+		raw, present := given[i]
+		if !present {
+			if i == 0 && metadata.AutoIncrement() {
+				continue // assigned on insert
+			}
+			return nil, fmt.Errorf("missing value for column %s", col.Name)
+		}
+
+		value, err := jsonValueToString(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for column %s: %w", col.Name, err)
+		}
+		values[i] = value
+	}
+
+	row := make([]string, 0, len(values)+1)
+	row = append(row, values[0]) // ID
+	row = append(row, "1")       // Active Flag
+	row = append(row, values[1:]...)
+	return row, nil
+}
+
+// updatesFromObject validates a JSON object of new column values against the
+// schema. Key columns may only be given with the value they already have, so
+// a client can send back a whole row it fetched.
+func updatesFromObject(metadata engine.TableMetadata, id string, body map[string]interface{}) (map[string]string, error) {
+	schema := metadata.Schema()
+	names := make([]string, len(schema))
+	for i, col := range schema {
+		names[i] = col.Name
+	}
+	isKey := make(map[string]bool)
+	for _, name := range metadata.KeyColumns() {
+		isKey[name] = true
+	}
+
+	if len(body) == 0 {
+		return nil, fmt.Errorf("no columns to update")
+	}
+	updates := make(map[string]string, len(body))
+	for key, raw := range body {
+		pos, err := engine.ResolveColumn(metadata.Name, names, key)
+		if err != nil {
+			return nil, err
+		}
+		name := names[pos]
+		if _, dup := updates[name]; dup {
+			return nil, fmt.Errorf("column %s is given more than once", name)
+		}
+		value, err := jsonValueToString(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for column %s: %w", name, err)
+		}
+		// The engine refuses to change a composite key; a single key is the id
+		if isKey[name] && !metadata.CompositeKey() {
+			if value != id {
+				return nil, fmt.Errorf("primary key column %s can't be changed (the row is %s)", name, id)
+			}
+			continue
+		}
+		updates[name] = value
+	}
+	return updates, nil
+}
+
+// jsonValueToString converts a decoded JSON scalar to its stored string form
+func jsonValueToString(raw interface{}) (string, error) {
+	switch v := raw.(type) {
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		if v {
+			return "true", nil
+		}
+		return "false", nil
+	case nil:
+		return "", fmt.Errorf("null is not supported")
+	default:
+		var buf bytes.Buffer
+		json.NewEncoder(&buf).Encode(v)
+		return "", fmt.Errorf("expected a scalar, got %s", strings.TrimSpace(buf.String()))
+	}
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"pesapal-ledger/engine"
+	"pesapal-ledger/parser"
+	"pesapal-ledger/storage"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newTestServer opens an empty database in a temporary data directory and
+// runs the setup statements against it
+func newTestServer(t *testing.T, setup ...string) *Server {
+	t.Helper()
+	if err := storage.SetDataDir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.SetSyncPolicy(storage.SyncPolicy{Mode: storage.SyncNone}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(storage.CloseWriters)
+
+	db := engine.NewDatabase()
+	if err := db.Recover(); err != nil {
+		t.Fatal(err)
+	}
+	for _, query := range setup {
+		if _, err := parser.Execute(db, query); err != nil {
+			t.Fatalf("%s: %v", query, err)
+		}
+	}
+	return &Server{
+		db:          db,
+		counters:    newQueryCounters(),
+		idempotency: newIdempotencyCache(defaultIdempotencyTTL, defaultIdempotencyEntries),
+	}
+}
+
+// serve sends one request through the handler and decodes its response
+func serve(t *testing.T, handler http.HandlerFunc, method, target, body string) (*httptest.ResponseRecorder, SQLResponse) {
+	t.Helper()
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	var resp SQLResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("%s %s: response is not JSON: %q", method, target, rec.Body.String())
+	}
+	return rec, resp
+}
+
+func TestCreateRowCompositeKey(t *testing.T) {
+	s := newTestServer(t, "CREATE TABLE enrollments (student int, course text, grade text, PRIMARY KEY (student, course))")
+
+	rec, resp := serve(t, s.handleTableRows, http.MethodPost, "/tables/enrollments/rows",
+		`{"student": 7, "course": "CS,101", "grade": "A"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("POST: status %d (%s), want 201", rec.Code, resp.Error)
+	}
+	location := rec.Header().Get("Location")
+	if location != "/tables/enrollments/rows/7,CS%2C101" {
+		t.Fatalf("Location = %q", location)
+	}
+
+	rec, resp = serve(t, s.handleTableRows, http.MethodGet, location, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET %s: status %d (%s), want 200", location, rec.Code, resp.Error)
+	}
+	row, _ := resp.Data.(map[string]interface{})
+	if row["course"] != "CS,101" || row["grade"] != "A" {
+		t.Errorf("GET %s = %v", location, resp.Data)
+	}
+
+	// The same key again is a conflict, not a failed insert
+	rec, resp = serve(t, s.handleTableRows, http.MethodPost, "/tables/enrollments/rows",
+		`{"student": 7, "course": "CS,101", "grade": "B"}`)
+	if rec.Code != http.StatusConflict {
+		t.Errorf("second POST: status %d (%s), want 409", rec.Code, resp.Error)
+	}
+}
+
+func TestCreateRowKeyNotFirstColumn(t *testing.T) {
+	s := newTestServer(t, "CREATE TABLE accounts (name text, code text, PRIMARY KEY (code))")
+
+	rec, resp := serve(t, s.handleTableRows, http.MethodPost, "/tables/accounts/rows", `{"name": "Cash", "code": "1000"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("POST: status %d (%s), want 201", rec.Code, resp.Error)
+	}
+	if location := rec.Header().Get("Location"); location != "/tables/accounts/rows/1000" {
+		t.Errorf("Location = %q", location)
+	}
+}
+
+func TestCreateRowColumnNames(t *testing.T) {
+	s := newTestServer(t, "CREATE TABLE accounts (id int, name text, Balance int)")
+
+	tests := []struct {
+		name    string
+		body    string
+		status  int
+		wantErr string
+	}{
+		{"schema case", `{"id": 1, "name": "Cash", "Balance": 5}`, http.StatusCreated, ""},
+		{"other case", `{"ID": 2, "NAME": "Bank", "balance": 7}`, http.StatusCreated, ""},
+		{"unknown column", `{"id": 3, "name": "Till", "owner": "bob"}`, http.StatusBadRequest, "column owner not found"},
+		{"column given twice", `{"id": 4, "name": "Safe", "Name": "Vault"}`, http.StatusBadRequest, "given more than once"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec, resp := serve(t, s.handleTableRows, http.MethodPost, "/tables/accounts/rows", tt.body)
+			if rec.Code != tt.status {
+				t.Fatalf("status %d (%s), want %d", rec.Code, resp.Error, tt.status)
+			}
+			if !strings.Contains(resp.Error, tt.wantErr) {
+				t.Errorf("error = %q, want %q", resp.Error, tt.wantErr)
+			}
+		})
+	}
+
+	_, resp := serve(t, s.handleTableRows, http.MethodGet, "/tables/accounts/rows/2", "")
+	want := map[string]interface{}{"id": float64(2), "name": "Bank", "Balance": float64(7)}
+	if !reflect.DeepEqual(resp.Data, want) {
+		t.Errorf("row = %#v, want %#v", resp.Data, want)
+	}
+}
+
+func TestGetRow(t *testing.T) {
+	s := newTestServer(t,
+		"CREATE TABLE transactions (id int, merchant text, amount float, settled bool)",
+		"INSERT INTO transactions VALUES (101, Starbucks, 5.5, true)",
+	)
+
+	tests := []struct {
+		name   string
+		target string
+		status int
+		want   map[string]interface{}
+	}{
+		{
+			name:   "found",
+			target: "/tables/transactions/rows/101",
+			status: http.StatusOK,
+			want:   map[string]interface{}{"id": float64(101), "merchant": "Starbucks", "amount": 5.5, "settled": true},
+		},
+		{name: "row not found", target: "/tables/transactions/rows/999", status: http.StatusNotFound},
+		{name: "unknown table", target: "/tables/nope/rows/101", status: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec, resp := serve(t, s.handleTableRows, http.MethodGet, tt.target, "")
+			if rec.Code != tt.status {
+				t.Fatalf("status %d (%s), want %d", rec.Code, resp.Error, tt.status)
+			}
+			if tt.want == nil {
+				if resp.Success || resp.Error == "" {
+					t.Errorf("response = %+v, want an error", resp)
+				}
+				return
+			}
+			if !reflect.DeepEqual(resp.Data, tt.want) {
+				t.Errorf("row = %#v, want %#v", resp.Data, tt.want)
+			}
+		})
+	}
+}
+
+func TestWritesReturnRow(t *testing.T) {
+	s := newTestServer(t,
+		"CREATE TABLE transactions (id int, merchant text, amount float, settled bool)",
+		"CREATE TABLE enrollments (student int, course text, grade text, PRIMARY KEY (student, course))",
+		"INSERT INTO transactions VALUES (101, Starbucks, 5.5, true)",
+		"INSERT INTO enrollments VALUES (7, CS101, A)",
+	)
+	updated := map[string]interface{}{"id": float64(101), "merchant": "Java", "amount": float64(6), "settled": false}
+
+	steps := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		status int
+		want   map[string]interface{} // the row returned, and then fetched unless deleted
+	}{
+		{"update one column", http.MethodPut, "/tables/transactions/rows/101", `{"amount": 6}`, http.StatusOK,
+			map[string]interface{}{"id": float64(101), "merchant": "Starbucks", "amount": float64(6), "settled": true}},
+		{"update with the unchanged key", http.MethodPut, "/tables/transactions/rows/101", `{"Merchant": "Java", "ID": 101, "settled": false}`, http.StatusOK, updated},
+		{"change the key", http.MethodPut, "/tables/transactions/rows/101", `{"id": 102}`, http.StatusBadRequest, nil},
+		{"no columns", http.MethodPut, "/tables/transactions/rows/101", `{}`, http.StatusBadRequest, nil},
+		{"unknown column", http.MethodPut, "/tables/transactions/rows/101", `{"nope": 1}`, http.StatusBadRequest, nil},
+		{"value of the wrong type", http.MethodPut, "/tables/transactions/rows/101", `{"amount": "lots"}`, http.StatusBadRequest, nil},
+		{"not an object", http.MethodPut, "/tables/transactions/rows/101", `[1]`, http.StatusBadRequest, nil},
+		{"update a missing row", http.MethodPut, "/tables/transactions/rows/999", `{"amount": 1}`, http.StatusNotFound, nil},
+		{"update a composite key row", http.MethodPut, "/tables/enrollments/rows/7,CS101", `{"grade": "B"}`, http.StatusOK,
+			map[string]interface{}{"student": float64(7), "course": "CS101", "grade": "B"}},
+		{"change a composite key", http.MethodPut, "/tables/enrollments/rows/7,CS101", `{"course": "CS102"}`, http.StatusBadRequest, nil},
+		{"delete", http.MethodDelete, "/tables/transactions/rows/101", "", http.StatusOK, updated},
+		{"delete again", http.MethodDelete, "/tables/transactions/rows/101", "", http.StatusNotFound, nil},
+	}
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			before, _ := s.db.SelectAll("transactions")
+			rec, resp := serve(t, s.handleTableRows, step.method, step.target, step.body)
+			if rec.Code != step.status {
+				t.Fatalf("status %d (%s), want %d", rec.Code, resp.Error, step.status)
+			}
+			if step.want == nil {
+				if after, _ := s.db.SelectAll("transactions"); !reflect.DeepEqual(after, before) {
+					t.Errorf("a refused write changed the table: %v, was %v", after, before)
+				}
+				return
+			}
+			if !reflect.DeepEqual(resp.Data, step.want) {
+				t.Errorf("returned row = %#v, want %#v", resp.Data, step.want)
+			}
+
+			rec, resp = serve(t, s.handleTableRows, http.MethodGet, step.target, "")
+			if step.method == http.MethodDelete {
+				if rec.Code != http.StatusNotFound {
+					t.Errorf("GET after the delete: status %d, want 404", rec.Code)
+				}
+				return
+			}
+			if !reflect.DeepEqual(resp.Data, step.want) {
+				t.Errorf("fetched row = %#v, want the returned one %#v", resp.Data, step.want)
+			}
+		})
+	}
+}
+
+func TestBlobRows(t *testing.T) {
+	s := newTestServer(t, "CREATE TABLE files (id int, data blob)")
+
+	tests := []struct {
+		name string
+		data string // JSON string contents
+	}{
+		{"pipe and newline", `a|b\nc`},
+		{"NUL", `\u0000x\u0000`},
+		{"empty", ""},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id := i + 1
+			rec, resp := serve(t, s.handleTableRows, http.MethodPost, "/tables/files/rows", fmt.Sprintf(`{"id": %d, "data": "%s"}`, id, tt.data))
+			if rec.Code != http.StatusCreated {
+				t.Fatalf("POST: status %d (%s), want 201", rec.Code, resp.Error)
+			}
+
+			var raw string
+			if err := json.Unmarshal([]byte(`"`+tt.data+`"`), &raw); err != nil {
+				t.Fatal(err)
+			}
+			want := base64.StdEncoding.EncodeToString([]byte(raw))
+			_, resp = serve(t, s.handleTableRows, http.MethodGet, fmt.Sprintf("/tables/files/rows/%d", id), "")
+			if row, _ := resp.Data.(map[string]interface{}); row["data"] != want {
+				t.Errorf("GET data = %#v, want %q", resp.Data, want)
+			}
+			_, resp = serve(t, s.handleSQL, http.MethodPost, "/sql", fmt.Sprintf(`{"query": "SELECT data FROM files WHERE id = %d"}`, id))
+			if !reflect.DeepEqual(resp.Data, []interface{}{[]interface{}{want}}) {
+				t.Errorf("SELECT data = %#v, want %q", resp.Data, want)
+			}
+		})
+	}
+}
+
+func TestWriteEngineError(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+	}{
+		{fmt.Errorf("failed to append row: %w", storage.ErrDiskFull), http.StatusInsufficientStorage},
+		{engine.TableNotExist("orders"), http.StatusNotFound},
+		{fmt.Errorf("record with id 9 %w in table orders", engine.ErrRowNotFound), http.StatusNotFound},
+		{fmt.Errorf("record with id 9 %w in table orders", engine.ErrDuplicateKey), http.StatusConflict},
+		{fmt.Errorf("failed to read row: %w", storage.ErrTampered), http.StatusInternalServerError},
+		{engine.ErrMaintenance, http.StatusServiceUnavailable},
+		{fmt.Errorf("%w: orders (data file missing)", engine.ErrTableDegraded), http.StatusInternalServerError},
+		{errors.New("invalid value for column amount"), http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		writeEngineError(rec, tt.err)
+		if rec.Code != tt.status {
+			t.Errorf("%v: status %d, want %d", tt.err, rec.Code, tt.status)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// defaultShutdownTimeout is how long shutdown waits for in-flight requests
+const defaultShutdownTimeout = 30 * time.Second
+
+// drainer tracks in-flight requests so shutdown can let them finish while
+// turning new ones away
+type drainer struct {
+	mu       sync.Mutex
+	inFlight int
+	draining bool
+	idle     chan struct{} // closed when the last request finishes while draining
+}
+
+// wrap counts the requests served by next, and answers 503 once draining
+// has started
+func (d *drainer) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d.mu.Lock()
+		if d.draining {
+			d.mu.Unlock()
+			w.Header().Set("Connection", "close")
+			writeJSON(w, http.StatusServiceUnavailable, SQLResponse{
+				Success: false,
+				Error:   "server is shutting down",
+			})
+			return
+		}
+		d.inFlight++
+		d.mu.Unlock()
+
+		defer d.finish()
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (d *drainer) finish() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.inFlight--
+	if d.inFlight == 0 && d.idle != nil {
+		close(d.idle)
+		d.idle = nil
+	}
+}
+
+// drain refuses new requests and waits up to timeout for the in-flight ones
+// to finish. It returns how many were still running when the timeout fired.
+func (d *drainer) drain(timeout time.Duration) int {
+	d.mu.Lock()
+	d.draining = true
+	if d.inFlight == 0 {
+		d.mu.Unlock()
+		return 0
+	}
+	idle := make(chan struct{})
+	d.idle = idle
+	d.mu.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-idle:
+		return 0
+	case <-timer.C:
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		return d.inFlight
+	}
+}
+
+// shutdownTimeout returns the drain timeout: the --shutdown-timeout flag if
+// set, else LITELEDGER_SHUTDOWN_TIMEOUT, else 30s
+func shutdownTimeout(flagValue string) (time.Duration, error) {
+	source, v := "--shutdown-timeout", flagValue
+	if v == "" {
+		source, v = "LITELEDGER_SHUTDOWN_TIMEOUT", os.Getenv("LITELEDGER_SHUTDOWN_TIMEOUT")
+	}
+	if v == "" {
+		return defaultShutdownTimeout, nil
+	}
+	timeout, err := time.ParseDuration(v)
+	if err != nil || timeout < 0 {
+		return 0, fmt.Errorf("invalid %s %q: expected a non-negative duration such as 30s", source, v)
+	}
+	return timeout, nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startDrain runs drain in the background and waits until new requests are
+// being refused. The channel receives drain's result.
+func startDrain(t *testing.T, d *drainer, timeout time.Duration) <-chan int {
+	t.Helper()
+	done := make(chan int, 1)
+	go func() { done <- d.drain(timeout) }()
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		d.mu.Lock()
+		draining := d.draining
+		d.mu.Unlock()
+		if draining {
+			return done
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("drain did not start")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestDrainer(t *testing.T) {
+	tests := []struct {
+		name     string
+		timeout  time.Duration
+		finish   bool // let the in-flight request finish before the timeout
+		stillRun int  // in-flight requests drain reports
+	}{
+		{"request finishes", time.Minute, true, 0},
+		{"timeout fires", 20 * time.Millisecond, false, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &drainer{}
+			started, release := make(chan struct{}), make(chan struct{})
+			handler := d.wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/slow" {
+					close(started)
+					<-release
+				}
+				writeJSON(w, http.StatusOK, SQLResponse{Success: true})
+			}))
+
+			// A request started before shutdown
+			slow := httptest.NewRecorder()
+			slowDone := make(chan struct{})
+			go func() {
+				handler.ServeHTTP(slow, httptest.NewRequest(http.MethodPost, "/slow", nil))
+				close(slowDone)
+			}()
+			<-started
+
+			done := startDrain(t, d, tt.timeout)
+
+			// A new one is refused while draining
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/sql", strings.NewReader(`{"query": "SHOW TABLES"}`)))
+			if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "server is shutting down") {
+				t.Errorf("new request: status %d %q, want 503", rec.Code, rec.Body.String())
+			}
+			if rec.Header().Get("Connection") != "close" {
+				t.Error("refused request does not close the connection")
+			}
+
+			if tt.finish {
+				close(release)
+			}
+			select {
+			case n := <-done:
+				if n != tt.stillRun {
+					t.Errorf("drain reported %d requests still running, want %d", n, tt.stillRun)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("drain did not return")
+			}
+			if !tt.finish {
+				close(release)
+			}
+
+			// The request started before shutdown completes either way
+			<-slowDone
+			if slow.Code != http.StatusOK {
+				t.Errorf("in-flight request: status %d, want 200", slow.Code)
+			}
+		})
+	}
+}
+
+func TestDrainerIdle(t *testing.T) {
+	d := &drainer{}
+	handler := d.wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, SQLResponse{Success: true})
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/tables", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("before shutdown: status %d", rec.Code)
+	}
+
+	start := time.Now()
+	if n := d.drain(time.Minute); n != 0 || time.Since(start) > time.Second {
+		t.Errorf("drain with nothing in flight = %d after %v", n, time.Since(start))
+	}
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/tables", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("after shutdown: status %d, want 503", rec.Code)
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	tests := []struct {
+		name    string
+		flag    string
+		env     string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"default", "", "", defaultShutdownTimeout, false},
+		{"environment", "", "5s", 5 * time.Second, false},
+		{"flag", "1m", "", time.Minute, false},
+		{"flag over environment", "2s", "5s", 2 * time.Second, false},
+		{"zero", "0s", "", 0, false},
+		{"not a duration", "30", "", 0, true},
+		{"negative", "", "-5s", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("LITELEDGER_SHUTDOWN_TIMEOUT", tt.env)
+			got, err := shutdownTimeout(tt.flag)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("shutdownTimeout(%q) with env %q = %v, %v", tt.flag, tt.env, got, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package storage
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ErrCorruptUpload is returned by ReplaceTableFile for a file with a corrupt
+// or truncated record
+var ErrCorruptUpload = errors.New("corrupt table file")
+
+// OpenRawTableFile opens a table file to be copied as is (a compressed
+// table stays compressed) and returns it with its size at the time of
+// opening. The handle keeps reading that file even if it is replaced while
+// open, so reading up to size gives the file as it was.
+func OpenRawTableFile(tableName string) (*os.File, int64, error) {
+	storageMutex.RLock()
+	defer storageMutex.RUnlock()
+
+	file, err := os.Open(tablePath(tableName, ".db"))
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to open table file %s: %w", tableName, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, 0, fmt.Errorf("failed to stat table file %s: %w", tableName, err)
+	}
+	return file, info.Size(), nil
+}
+
+// ReplaceTableFile installs src, a table file as OpenRawTableFile copies it
+// (gzip-compressed for a compressed table), as the table's new file. Every
+// record is checked as it is written to a temporary file, which is renamed
+// over the old file only if all of them are intact; a corrupt upload leaves
+// the table untouched. It returns the number of bytes installed. Row offsets
+// change, so callers must rebuild their index afterwards.
+func ReplaceTableFile(tableName string, src io.Reader) (int64, error) {
+	// The writer's append handle would keep pointing at the old file
+	stopWriter(tableName)
+
+	storageMutex.Lock()
+	defer storageMutex.Unlock()
+
+	filePath := tablePath(tableName, ".db")
+	tmpPath := filePath + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create temporary file for %s: %w", tableName, err)
+	}
+
+	counter := &countingWriter{w: tmp}
+	err = checkRecords(tableName, io.TeeReader(src, counter))
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, filePath)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return 0, fmt.Errorf("failed to restore table file %s: %w", tableName, err)
+	}
+	bumpGeneration(tableName)
+	removeIndexCheckpoint(tableName)
+	return counter.n, nil
+}
+
+// checkRecords reads a whole table file from r and fails on the first
+// record that is corrupt or cut short
+func checkRecords(tableName string, r io.Reader) error {
+	raw := r
+	if IsCompressed(tableName) {
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			if err == io.EOF {
+				return nil // an empty file
+			}
+			return fmt.Errorf("%w: compressed table expects a gzip file: %v", ErrCorruptUpload, err)
+		}
+		r = zr
+	}
+
+	last := &lastByteReader{r: r}
+	reader := NewRecordReader(tableName, last)
+	for reader.Next() {
+		record := reader.Record()
+		if record.Err != nil {
+			return fmt.Errorf("%w: record at offset %d: %v", ErrCorruptUpload, record.Offset, record.Err)
+		}
+	}
+	if err := reader.Err(); err != nil {
+		if errors.Is(err, gzip.ErrChecksum) || errors.Is(err, gzip.ErrHeader) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return fmt.Errorf("%w: %v", ErrCorruptUpload, err)
+		}
+		return err
+	}
+	// A text row without its newline would run into the next one appended
+	if TableFormat(tableName) != FormatBinary && last.n > 0 && last.b != '\n' {
+		return fmt.Errorf("%w: last row is cut short", ErrCorruptUpload)
+	}
+	// Anything past the end of the gzip stream is still copied; read it
+	_, err := io.Copy(io.Discard, raw)
+	return err
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// lastByteReader remembers the last byte read through it
+type lastByteReader struct {
+	r io.Reader
+	b byte
+	n int64
+}
+
+func (l *lastByteReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	if n > 0 {
+		l.b = p[n-1]
+		l.n += int64(n)
+	}
+	return n, err
+}
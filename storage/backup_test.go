@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"testing"
+)
+
+// TestOpenRawTableFile checks that the size taken when the file is opened
+// pins the copy: rows appended afterwards aren't part of it
+func TestOpenRawTableFile(t *testing.T) {
+	newTestTable(t, SyncPolicy{Mode: SyncNone})
+	tests := []struct {
+		name string
+		rows [][]string // appended before the file is opened
+	}{
+		{"empty", nil},
+		{"one row", [][]string{{"1", "1", "alice"}}},
+		{"more rows", [][]string{{"2", "1", "bob"}, {"3", "1", "carol"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, row := range tt.rows {
+				if _, err := AppendRow("t", row); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(tablePath("t", ".db"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			file, size, err := OpenRawTableFile("t")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+			if _, err := AppendRow("t", []string{"9" + tt.name, "1", "later"}); err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(io.LimitReader(file, size))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if size != int64(len(want)) || !bytes.Equal(got, want) {
+				t.Errorf("copied %d bytes (size %d), want the %d bytes before the append", len(got), size, len(want))
+			}
+		})
+	}
+
+	if _, _, err := OpenRawTableFile("missing"); err == nil {
+		t.Error("OpenRawTableFile opened a table with no file")
+	}
+}
+
+// TestReplaceTableFile checks that an upload is installed only if every
+// record in it is intact
+func TestReplaceTableFile(t *testing.T) {
+	newTestTable(t, SyncPolicy{Mode: SyncNone})
+	for _, row := range [][]string{{"1", "1", "alice"}, {"2", "1", "bob"}} {
+		if _, err := AppendRow("t", row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	good, err := os.ReadFile(tablePath("t", ".db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		upload  []byte
+		wantErr error
+	}{
+		{"intact", good, nil},
+		{"empty", nil, nil},
+		{"flipped byte", bytes.Replace(good, []byte("bob"), []byte("bib"), 1), ErrCorruptUpload},
+		{"last row cut short", good[:len(good)-1], ErrCorruptUpload},
+		{"not a table file", []byte("hello\n"), ErrCorruptUpload},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before, err := os.ReadFile(tablePath("t", ".db"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			n, err := ReplaceTableFile("t", bytes.NewReader(tt.upload))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ReplaceTableFile: err = %v, want %v", err, tt.wantErr)
+			}
+			after, err := os.ReadFile(tablePath("t", ".db"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := tt.upload
+			if tt.wantErr != nil {
+				want = before // left as it was
+			} else if n != int64(len(tt.upload)) {
+				t.Errorf("installed %d bytes, want %d", n, len(tt.upload))
+			}
+			if !bytes.Equal(after, want) {
+				t.Errorf("table file is %q, want %q", after, want)
+			}
+			if _, err := os.Stat(tablePath("t", ".db.tmp")); !os.IsNotExist(err) {
+				t.Errorf("temporary file left behind: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,299 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+// Index checkpoint file layout (all integers are varints unless noted):
+//
+//	magic "LLIX", version (1 byte)
+//	log size, log fingerprint (4 bytes, big endian)
+//	versions, total bytes, max id, max LSN
+//	entry count, then per entry: key length, key, offset, row size
+//	CRC-32 of everything above (4 bytes, big endian)
+//
+// The log size is how far into the table file the checkpoint reaches; rows
+// appended after it are replayed on load. The fingerprint is the CRC-32 of
+// the log bytes just before that point, which catches a table file that was
+// replaced behind the checkpoint's back.
+const (
+	checkpointMagic   = "LLIX"
+	checkpointVersion = 1
+	fingerprintBytes  = 4096
+)
+
+// ErrStaleCheckpoint is returned by ReadIndexCheckpoint when the checkpoint
+// doesn't match the table file anymore. The table must be scanned in full.
+var ErrStaleCheckpoint = errors.New("index checkpoint does not match the table file")
+
+// IndexCheckpoint is a table's index saved at a point in its log, so
+// recovery only has to replay the rows appended after it
+type IndexCheckpoint struct {
+	LogSize    int64 // bytes of the table file the checkpoint covers
+	Versions   int64 // row versions and tombstones in those bytes
+	TotalBytes int64
+	MaxID      int64
+	MaxLSN     int64
+	Entries    []IndexEntry
+}
+
+// IndexEntry is one live key of a checkpoint
+type IndexEntry struct {
+	Key    string
+	Offset int64 // where the key's current version starts
+	Size   int64 // bytes that version takes up
+}
+
+func checkpointPath(tableName string) string {
+	return tablePath(tableName, ".idx")
+}
+
+// WriteIndexCheckpoint syncs the table file and saves cp next to it. The
+// file is replaced with an atomic rename, so a crash leaves the old
+// checkpoint or the new one. Compressed tables can't be checkpointed: their
+// offsets can't be seeked to.
+func WriteIndexCheckpoint(tableName string, cp *IndexCheckpoint) error {
+	if IsCompressed(tableName) {
+		return ErrCompressedSeek
+	}
+	if err := syncTableFile(tableName); err != nil {
+		return err
+	}
+	fingerprint, err := logFingerprint(tableName, cp.LogSize)
+	if err != nil {
+		return err
+	}
+
+	filePath := checkpointPath(tableName)
+	tmpPath := filePath + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create index checkpoint for %s: %w", tableName, err)
+	}
+
+	crc := crc32.NewIEEE()
+	w := bufio.NewWriter(io.MultiWriter(tmp, crc))
+	var buf [binary.MaxVarintLen64]byte
+	uvarint := func(v uint64) { w.Write(buf[:binary.PutUvarint(buf[:], v)]) }
+	varint := func(v int64) { w.Write(buf[:binary.PutVarint(buf[:], v)]) }
+
+	w.WriteString(checkpointMagic)
+	w.WriteByte(checkpointVersion)
+	uvarint(uint64(cp.LogSize))
+	binary.Write(w, binary.BigEndian, fingerprint)
+	uvarint(uint64(cp.Versions))
+	uvarint(uint64(cp.TotalBytes))
+	varint(cp.MaxID)
+	varint(cp.MaxLSN)
+	uvarint(uint64(len(cp.Entries)))
+	for _, e := range cp.Entries {
+		uvarint(uint64(len(e.Key)))
+		w.WriteString(e.Key)
+		uvarint(uint64(e.Offset))
+		uvarint(uint64(e.Size))
+	}
+
+	err = w.Flush()
+	if err == nil {
+		err = binary.Write(tmp, binary.BigEndian, crc.Sum32())
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, filePath)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write index checkpoint for %s: %w", tableName, err)
+	}
+	return nil
+}
+
+// ReadIndexCheckpoint loads a table's index checkpoint. It returns nil when
+// there is none, and ErrStaleCheckpoint (wrapped) when the checkpoint is
+// damaged or no longer matches the table file.
+func ReadIndexCheckpoint(tableName string) (*IndexCheckpoint, error) {
+	if IsCompressed(tableName) {
+		return nil, nil
+	}
+	content, err := os.ReadFile(checkpointPath(tableName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index checkpoint for %s: %w", tableName, err)
+	}
+
+	if len(content) < len(checkpointMagic)+1+4 || string(content[:len(checkpointMagic)]) != checkpointMagic {
+		return nil, fmt.Errorf("%w: not an index checkpoint", ErrStaleCheckpoint)
+	}
+	body, sum := content[:len(content)-4], binary.BigEndian.Uint32(content[len(content)-4:])
+	if crc32.ChecksumIEEE(body) != sum {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrStaleCheckpoint)
+	}
+	if version := body[len(checkpointMagic)]; version != checkpointVersion {
+		return nil, fmt.Errorf("%w: unsupported format version %d", ErrStaleCheckpoint, version)
+	}
+
+	d := checkpointDecoder{buf: body[len(checkpointMagic)+1:]}
+	cp := &IndexCheckpoint{LogSize: int64(d.uvarint())}
+	fingerprint := d.uint32()
+	cp.Versions = int64(d.uvarint())
+	cp.TotalBytes = int64(d.uvarint())
+	cp.MaxID = d.varint()
+	cp.MaxLSN = d.varint()
+	count := d.uvarint()
+	if d.err == nil && count > uint64(len(d.buf)) {
+		d.err = io.ErrUnexpectedEOF // each entry takes at least a byte
+	}
+	if d.err == nil {
+		cp.Entries = make([]IndexEntry, 0, count)
+	}
+	for i := uint64(0); i < count && d.err == nil; i++ {
+		key := d.bytes(d.uvarint())
+		cp.Entries = append(cp.Entries, IndexEntry{Key: string(key), Offset: int64(d.uvarint()), Size: int64(d.uvarint())})
+	}
+	if d.err != nil || len(d.buf) != 0 {
+		return nil, fmt.Errorf("%w: malformed entries", ErrStaleCheckpoint)
+	}
+
+	current, err := logFingerprint(tableName, cp.LogSize)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrStaleCheckpoint, err)
+	}
+	if current != fingerprint {
+		return nil, fmt.Errorf("%w: the log before offset %d changed", ErrStaleCheckpoint, cp.LogSize)
+	}
+	return cp, nil
+}
+
+// checkpointDecoder reads the fields of a checkpoint, remembering the first
+// error so callers can check once at the end
+type checkpointDecoder struct {
+	buf []byte
+	err error
+}
+
+func (d *checkpointDecoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		d.err = io.ErrUnexpectedEOF
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *checkpointDecoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.buf)
+	if n <= 0 {
+		d.err = io.ErrUnexpectedEOF
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *checkpointDecoder) uint32() uint32 {
+	b := d.bytes(4)
+	if d.err != nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(b)
+}
+
+func (d *checkpointDecoder) bytes(n uint64) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n > uint64(len(d.buf)) {
+		d.err = io.ErrUnexpectedEOF
+		return nil
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+// logFingerprint returns the CRC-32 of the table file bytes just before
+// offset. The file must be at least offset bytes long.
+func logFingerprint(tableName string, offset int64) (uint32, error) {
+	file, err := os.Open(tablePath(tableName, ".db"))
+	if err != nil {
+		return 0, fmt.Errorf("failed to open table file %s: %w", tableName, err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("failed to stat table file %s: %w", tableName, err)
+	}
+	if info.Size() < offset {
+		return 0, fmt.Errorf("table file %s is shorter (%d bytes) than the checkpoint (%d bytes)", tableName, info.Size(), offset)
+	}
+
+	start := offset - fingerprintBytes
+	if start < 0 {
+		start = 0
+	}
+	buf := make([]byte, offset-start)
+	if _, err := file.ReadAt(buf, start); err != nil {
+		return 0, fmt.Errorf("failed to read table file %s: %w", tableName, err)
+	}
+	return crc32.ChecksumIEEE(buf), nil
+}
+
+// removeIndexCheckpoint deletes a table's checkpoint. Everything that
+// replaces or shortens a table file calls it, since the saved offsets would
+// point into the wrong data.
+func removeIndexCheckpoint(tableName string) {
+	if err := os.Remove(checkpointPath(tableName)); err != nil && !os.IsNotExist(err) {
+		fmt.Printf("Warning: failed to remove index checkpoint of %s: %v\n", tableName, err)
+	}
+}
+
+// TableFileSize returns the size of a table's file; 0 if it doesn't exist
+func TableFileSize(tableName string) (int64, error) {
+	info, err := os.Stat(tablePath(tableName, ".db"))
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to stat table file %s: %w", tableName, err)
+	}
+	return info.Size(), nil
+}
+
+// NewRecordReaderAt reads a table's log from offset, which must be where a
+// record starts. It returns the reader and the file to close after reading.
+// Compressed tables can't be read from an offset.
+func NewRecordReaderAt(tableName string, offset int64) (*RecordReader, io.Closer, error) {
+	if IsCompressed(tableName) {
+		return nil, nil, ErrCompressedSeek
+	}
+	file, err := os.Open(tablePath(tableName, ".db"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open table file %s: %w", tableName, err)
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, nil, fmt.Errorf("failed to seek table file %s: %w", tableName, err)
+	}
+	return newRecordReader(TableFormat(tableName), file, offset), file, nil
+}
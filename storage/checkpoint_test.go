@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"strconv"
+	"testing"
+)
+
+// writeTestCheckpoint saves a checkpoint of n keys for table t over a log of
+// logSize bytes
+func writeTestCheckpoint(tb testing.TB, n int, logSize int64) *IndexCheckpoint {
+	tb.Helper()
+	if err := SetDataDir(tb.TempDir()); err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(CloseWriters)
+	if err := os.MkdirAll(DataDir(), 0755); err != nil {
+		tb.Fatal(err)
+	}
+	log := make([]byte, logSize)
+	for i := range log {
+		log[i] = byte(i)
+	}
+	if err := os.WriteFile(tablePath("t", ".db"), log, 0644); err != nil {
+		tb.Fatal(err)
+	}
+
+	cp := &IndexCheckpoint{LogSize: logSize, Versions: int64(n), TotalBytes: int64(n) * 40, MaxID: int64(n), MaxLSN: int64(n)}
+	for i := 0; i < n; i++ {
+		cp.Entries = append(cp.Entries, IndexEntry{Key: strconv.Itoa(i + 1), Offset: int64(i) * 40, Size: 40})
+	}
+	if err := WriteIndexCheckpoint("t", cp); err != nil {
+		tb.Fatal(err)
+	}
+	return cp
+}
+
+func TestReadIndexCheckpointStale(t *testing.T) {
+	tests := []struct {
+		name   string
+		damage func(t *testing.T)
+	}{
+		{
+			name: "checkpoint byte flipped",
+			damage: func(t *testing.T) {
+				flipByte(t, checkpointPath("t"), 20)
+			},
+		},
+		{
+			name: "log changed before the checkpoint offset",
+			damage: func(t *testing.T) {
+				flipByte(t, tablePath("t", ".db"), 8000)
+			},
+		},
+		{
+			name: "log shorter than the checkpoint",
+			damage: func(t *testing.T) {
+				if err := os.Truncate(tablePath("t", ".db"), 100); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writeTestCheckpoint(t, 100, 8192)
+			if cp, err := ReadIndexCheckpoint("t"); err != nil || len(cp.Entries) != 100 {
+				t.Fatalf("intact checkpoint: %v", err)
+			}
+			tt.damage(t)
+			if _, err := ReadIndexCheckpoint("t"); !errors.Is(err, ErrStaleCheckpoint) {
+				t.Errorf("got %v, want ErrStaleCheckpoint", err)
+			}
+		})
+	}
+}
+
+func flipByte(t *testing.T, path string, at int) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[at] ^= 0xff
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// BenchmarkIndexLoad compares loading a 1M-key index from the binary
+// checkpoint with decoding the same entries from JSON
+func BenchmarkIndexLoad(b *testing.B) {
+	const keys = 1000000
+	cp := writeTestCheckpoint(b, keys, 8192)
+
+	b.Run("binary", func(b *testing.B) {
+		info, err := os.Stat(checkpointPath("t"))
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.ReportMetric(float64(info.Size()), "file-bytes")
+		for i := 0; i < b.N; i++ {
+			loaded, err := ReadIndexCheckpoint("t")
+			if err != nil || len(loaded.Entries) != keys {
+				b.Fatalf("ReadIndexCheckpoint: %v", err)
+			}
+		}
+	})
+
+	b.Run("json", func(b *testing.B) {
+		path := tablePath("t", ".json")
+		encoded, err := json.Marshal(cp)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err := os.WriteFile(path, encoded, 0644); err != nil {
+			b.Fatal(err)
+		}
+		b.ResetTimer()
+		b.ReportMetric(float64(len(encoded)), "file-bytes")
+		for i := 0; i < b.N; i++ {
+			content, err := os.ReadFile(path)
+			if err != nil {
+				b.Fatal(err)
+			}
+			var loaded IndexCheckpoint
+			if err := json.Unmarshal(content, &loaded); err != nil || len(loaded.Entries) != keys {
+				b.Fatalf("json.Unmarshal: %v", err)
+			}
+		}
+	})
+}
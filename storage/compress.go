@@ -0,0 +1,176 @@
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// ErrCompressedSeek is returned when a row of a compressed table is read by
+// offset. Offsets point into the decompressed stream, so those tables can
+// only be read with a full scan.
+var ErrCompressedSeek = errors.New("compressed tables don't support offset reads; use a full scan")
+
+var (
+	compressMu sync.RWMutex // guards compressed
+	compressed = make(map[string]bool)
+)
+
+// SetCompressed records whether a table's file is stored gzip-compressed.
+// It only tells storage how to read and append the file; use
+// ConvertTableFile to actually change the file.
+func SetCompressed(tableName string, enabled bool) {
+	compressMu.Lock()
+	defer compressMu.Unlock()
+
+	if enabled {
+		compressed[tableName] = true
+	} else {
+		delete(compressed, tableName)
+	}
+}
+
+// IsCompressed reports whether a table's file is stored gzip-compressed
+func IsCompressed(tableName string) bool {
+	compressMu.RLock()
+	defer compressMu.RUnlock()
+	return compressed[tableName]
+}
+
+// gzipReadCloser decompresses a table file and closes it when done
+type gzipReadCloser struct {
+	io.Reader
+	file *os.File
+}
+
+func (g *gzipReadCloser) Close() error {
+	return g.file.Close()
+}
+
+// newGzipReadCloser wraps an open compressed table file. An empty file is
+// read as an empty table.
+func newGzipReadCloser(tableName string, file *os.File) (io.ReadCloser, error) {
+	zr, err := gzip.NewReader(file)
+	if err == io.EOF {
+		return &gzipReadCloser{Reader: strings.NewReader(""), file: file}, nil
+	}
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to decompress table file %s: %w", tableName, err)
+	}
+	return &gzipReadCloser{Reader: zr, file: file}, nil
+}
+
+// appendCompressed appends a line to a compressed table as its own gzip
+// member (readers handle concatenated members)
+func appendCompressed(tableName string, file *os.File, line string) error {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(line)); err != nil {
+		return fmt.Errorf("failed to compress row for %s: %w", tableName, err)
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to compress row for %s: %w", tableName, err)
+	}
+
+	if _, err := file.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to write row to %s: %w", tableName, err)
+	}
+	return nil
+}
+
+// ScanRows streams the rows of a table in log order. fn gets each row's
+// offset in the (decompressed) log, its data without the checksum, and the
+// error from decoding it, if any; returning false stops the scan.
+// It works for plain and compressed tables alike. fn must not call back
+// into storage.
+func ScanRows(tableName string, fn func(offset int64, data []string, err error) bool) error {
+	storageMutex.RLock()
+	defer storageMutex.RUnlock()
+
+	file, err := OpenTableFile(tableName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := NewRecordReader(tableName, file)
+	for reader.Next() {
+		record := reader.Record()
+		if !fn(record.Offset, record.Fields, record.Err) {
+			return nil
+		}
+	}
+	if err := reader.Err(); err != nil {
+		return fmt.Errorf("failed to scan table file %s: %w", tableName, err)
+	}
+	return nil
+}
+
+// ConvertTableFile rewrites a table file gzip-compressed, or back to plain
+// text, and switches the table's compression flag. The decompressed content,
+// and so every row offset, stays the same. The old file is replaced with an
+// atomic rename.
+func ConvertTableFile(tableName string, compress bool) error {
+	// The writer's append handle would keep pointing at the old file
+	stopWriter(tableName)
+
+	storageMutex.Lock()
+	defer storageMutex.Unlock()
+
+	if IsCompressed(tableName) == compress {
+		return nil
+	}
+
+	src, err := OpenTableFile(tableName)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	filePath := tablePath(tableName, ".db")
+	tmpPath := filePath + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file for %s: %w", tableName, err)
+	}
+
+	err = copyTableFile(tmp, src, compress)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, filePath)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to convert table file %s: %w", tableName, err)
+	}
+
+	bumpGeneration(tableName)
+	removeIndexCheckpoint(tableName)
+	SetCompressed(tableName, compress)
+	return nil
+}
+
+// copyTableFile copies the decompressed log into dst, compressing it if asked
+func copyTableFile(dst io.Writer, src io.Reader, compress bool) error {
+	if !compress {
+		_, err := io.Copy(dst, src)
+		return err
+	}
+
+	zw := gzip.NewWriter(dst)
+	if _, err := io.Copy(zw, src); err != nil {
+		return err
+	}
+	return zw.Close()
+}
@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// ErrTableRewritten is returned when a table file was replaced (compacted,
+// purged, altered or converted) since a reader pinned its generation
+var ErrTableRewritten = errors.New("table file was rewritten")
+
+// Each table file has a generation that moves on whenever the file is
+// replaced, so offsets taken from one generation are never used against
+// another. Rolling back a transaction only cuts off what it appended and
+// keeps the generation. Generations live only in memory; they start at zero.
+var (
+	generationMu sync.Mutex
+	generations  = make(map[string]int64)
+)
+
+// bumpGeneration moves the table to a new generation. Callers hold
+// storageMutex for writing.
+func bumpGeneration(tableName string) {
+	generationMu.Lock()
+	generations[tableName]++
+	generationMu.Unlock()
+	restamp(tableName)
+}
+
+// TableGeneration returns the table file's current generation
+func TableGeneration(tableName string) int64 {
+	generationMu.Lock()
+	defer generationMu.Unlock()
+	return generations[tableName]
+}
+
+// OpenTableFileGeneration is OpenTableFile for a reader that pinned the
+// table's generation: it fails with ErrTableRewritten if the file was
+// replaced since. The handle keeps reading that generation even if the file
+// is replaced while it is open.
+func OpenTableFileGeneration(tableName string, generation int64) (io.ReadCloser, error) {
+	storageMutex.RLock()
+	defer storageMutex.RUnlock()
+
+	if TableGeneration(tableName) != generation {
+		return nil, fmt.Errorf("%w: %s", ErrTableRewritten, tableName)
+	}
+	return OpenTableFile(tableName)
+}
@@ -0,0 +1,217 @@
+package storage
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// journalFile is where the undo journal of the running transaction lives.
+// Before a transaction first appends to a table it records the table file's
+// size, and COMMIT appends a commit marker once every touched table is
+// synced. A journal found at startup without the marker belongs to a
+// transaction that never committed: its tables are cut back to the recorded
+// sizes.
+func journalFile() string {
+	return filepath.Join(DataDir(), "txn.journal")
+}
+
+const journalCommit = "commit"
+
+// Journal records the tables a transaction writes to, so the writes can be
+// made durable together or undone together
+type Journal struct {
+	file  *os.File
+	sizes map[string]int64 // table -> file size before the transaction
+}
+
+// BeginJournal starts the journal of a transaction. Only one transaction can
+// run at a time; a leftover journal must be settled by RecoverJournal first.
+func BeginJournal() (*Journal, error) {
+	if err := os.MkdirAll(DataDir(), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create data directory: %w", err)
+	}
+	file, err := os.OpenFile(journalFile(), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		if os.IsExist(err) {
+			return nil, fmt.Errorf("an unfinished transaction journal exists; restart to recover it")
+		}
+		return nil, fmt.Errorf("failed to create transaction journal: %w", err)
+	}
+	return &Journal{file: file, sizes: make(map[string]int64)}, nil
+}
+
+// Touch records a table's file size before the transaction's first append to
+// it. The entry is synced before Touch returns, so it is on disk before any
+// row it covers.
+func (j *Journal) Touch(tableName string) error {
+	if _, ok := j.sizes[tableName]; ok {
+		return nil
+	}
+
+	size, err := TableFileSize(tableName)
+	if err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintf(j.file, "table %s %d\n", tableName, size); err != nil {
+		return fmt.Errorf("failed to write transaction journal: %w", err)
+	}
+	if err := j.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync transaction journal: %w", err)
+	}
+	j.sizes[tableName] = size
+	return nil
+}
+
+// Tables returns the tables the transaction wrote to, sorted
+func (j *Journal) Tables() []string {
+	names := make([]string, 0, len(j.sizes))
+	for name := range j.sizes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Commit syncs every table the transaction wrote to, then the commit marker,
+// and removes the journal. If Commit fails the transaction isn't committed
+// and the journal stays in place for Rollback.
+func (j *Journal) Commit() error {
+	for _, name := range j.Tables() {
+		if err := syncTableFile(name); err != nil {
+			return err
+		}
+	}
+	if _, err := fmt.Fprintln(j.file, journalCommit); err != nil {
+		return fmt.Errorf("failed to write commit marker: %w", err)
+	}
+	if err := j.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync commit marker: %w", err)
+	}
+	return j.remove()
+}
+
+// Rollback cuts every table the transaction wrote to back to its size before
+// the transaction, then removes the journal. On failure the journal is kept,
+// so the rollback is finished by RecoverJournal on the next start.
+func (j *Journal) Rollback() error {
+	if err := truncateTables(j.sizes); err != nil {
+		j.file.Close()
+		return err
+	}
+	return j.remove()
+}
+
+func (j *Journal) remove() error {
+	j.file.Close()
+	if err := os.Remove(journalFile()); err != nil {
+		return fmt.Errorf("failed to remove transaction journal: %w", err)
+	}
+	return nil
+}
+
+// RecoverJournal settles a transaction interrupted by a crash. Without a
+// commit marker, the tables in the journal are cut back to their sizes before
+// the transaction. It returns the tables rolled back, and must run before
+// indexes are loaded.
+func RecoverJournal() ([]string, error) {
+	file, err := os.Open(journalFile())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open transaction journal: %w", err)
+	}
+
+	sizes := make(map[string]int64)
+	committed := false
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == journalCommit {
+			committed = true
+			continue
+		}
+		// A torn last entry was never synced, so no row was written under it
+		fields := strings.Fields(line)
+		if len(fields) != 3 || fields[0] != "table" {
+			continue
+		}
+		size, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			continue
+		}
+		sizes[fields[1]] = size
+	}
+	err = scanner.Err()
+	file.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read transaction journal: %w", err)
+	}
+
+	var rolledBack []string
+	if !committed {
+		if err := truncateTables(sizes); err != nil {
+			return nil, err
+		}
+		for name := range sizes {
+			rolledBack = append(rolledBack, name)
+		}
+		sort.Strings(rolledBack)
+	}
+	if err := os.Remove(journalFile()); err != nil {
+		return nil, fmt.Errorf("failed to remove transaction journal: %w", err)
+	}
+	return rolledBack, nil
+}
+
+// truncateTables cuts table files back to the given sizes and syncs them.
+// Files already at or below their size are left alone.
+func truncateTables(sizes map[string]int64) error {
+	for name, size := range sizes {
+		// The writer's append handle would keep its old position otherwise
+		stopWriter(name)
+
+		if err := truncateTableFile(name, size); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func truncateTableFile(tableName string, size int64) error {
+	storageMutex.Lock()
+	defer storageMutex.Unlock()
+
+	filePath := tablePath(tableName, ".db")
+	info, err := os.Stat(filePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to stat table file %s: %w", tableName, err)
+	}
+	if info.Size() <= size {
+		return nil
+	}
+	removeIndexCheckpoint(tableName)
+
+	file, err := os.OpenFile(filePath, os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open table file %s: %w", tableName, err)
+	}
+	defer file.Close()
+	if err := file.Truncate(size); err != nil {
+		return fmt.Errorf("failed to truncate table file %s: %w", tableName, err)
+	}
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync table file %s: %w", tableName, err)
+	}
+	restamp(tableName)
+	return nil
+}
@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// DefaultDataDir is where table files live unless SetDataDir says otherwise
+const DefaultDataDir = "data"
+
+var (
+	dataDirMu sync.RWMutex
+	dataDir   = DefaultDataDir
+)
+
+// SetDataDir points storage, and the engine's metadata.json, at another
+// directory, such as a test's temp dir or a second instance's own folder. It
+// is created on the first write. Set it before opening a database: the
+// append handles of the old directory are closed, but a Database already
+// loaded from it keeps its tables and indexes.
+func SetDataDir(path string) error {
+	if strings.TrimSpace(path) == "" {
+		return fmt.Errorf("data directory must not be empty")
+	}
+	CloseWriters()
+
+	dataDirMu.Lock()
+	dataDir = filepath.Clean(path)
+	dataDirMu.Unlock()
+	return nil
+}
+
+// DataDir returns the directory the table files live in
+func DataDir() string {
+	dataDirMu.RLock()
+	defer dataDirMu.RUnlock()
+	return dataDir
+}
+
+// tablePath is where a table's file with the given extension lives. A
+// schema-qualified name ("sales.orders") is stored in a subdirectory named
+// after the schema (data/sales/orders.db).
+func tablePath(tableName, ext string) string {
+	if schema, table, ok := strings.Cut(tableName, "."); ok {
+		return filepath.Join(DataDir(), schema, table+ext)
+	}
+	return filepath.Join(DataDir(), tableName+ext)
+}
+
+// TableFilePath returns where a table's log lives, e.g. data/orders.db
+func TableFilePath(tableName string) string {
+	return tablePath(tableName, ".db")
+}
@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy retries table file operations that fail with a transient
+// error, such as EAGAIN from a network mount, so a momentary hiccup doesn't
+// fail the statement. Other errors (a missing file, a permission problem, a
+// corrupt row) fail at once.
+type RetryPolicy struct {
+	Attempts   int           // tries in all, the first included; 1 disables retries
+	Backoff    time.Duration // wait before the first retry; it doubles after each
+	MaxBackoff time.Duration // cap on the wait between retries
+}
+
+// DefaultRetryPolicy tries three times, waiting 10ms and then 20ms
+var DefaultRetryPolicy = RetryPolicy{Attempts: 3, Backoff: 10 * time.Millisecond, MaxBackoff: time.Second}
+
+var (
+	retryMu     sync.Mutex
+	retryPolicy = DefaultRetryPolicy
+)
+
+// SetRetryPolicy changes how transient storage errors are retried
+func SetRetryPolicy(policy RetryPolicy) error {
+	if policy.Attempts < 1 {
+		return fmt.Errorf("retry attempts must be at least 1, got %d", policy.Attempts)
+	}
+	if policy.Backoff < 0 || policy.MaxBackoff < 0 {
+		return fmt.Errorf("retry backoff must not be negative")
+	}
+	if policy.MaxBackoff < policy.Backoff {
+		policy.MaxBackoff = policy.Backoff
+	}
+
+	retryMu.Lock()
+	retryPolicy = policy
+	retryMu.Unlock()
+	return nil
+}
+
+// isTransient reports whether an error is worth retrying
+func isTransient(err error) bool {
+	var errno syscall.Errno
+	if !errors.As(err, &errno) {
+		return false
+	}
+	switch errno {
+	case syscall.EAGAIN, syscall.EINTR, syscall.EBUSY, syscall.ETIMEDOUT:
+		return true
+	}
+	return false
+}
+
+// retry runs op until it succeeds, fails with an error that isn't transient
+// or runs out of attempts, backing off between tries. op must be safe to run
+// again after it failed.
+func retry(op func() error) error {
+	retryMu.Lock()
+	policy := retryPolicy
+	retryMu.Unlock()
+
+	wait := policy.Backoff
+	for attempt := 1; ; attempt++ {
+		err := op()
+		if err == nil || attempt >= policy.Attempts || !isTransient(err) {
+			return err
+		}
+		fmt.Printf("Warning: transient storage error, retrying in %v (attempt %d of %d): %v\n", wait, attempt+1, policy.Attempts, err)
+		time.Sleep(wait)
+		wait = min(wait*2, policy.MaxBackoff)
+	}
+}
@@ -0,0 +1,147 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// flakyFile writes half of what it's given and fails with err for the first
+// failures writes, then writes normally
+type flakyFile struct {
+	file     *os.File
+	err      error
+	failures int
+	calls    int
+}
+
+func (f *flakyFile) WriteString(s string) (int, error) {
+	f.calls++
+	if f.calls > f.failures {
+		return f.file.WriteString(s)
+	}
+	n, err := f.file.WriteString(s[:len(s)/2])
+	if err != nil {
+		return n, err
+	}
+	return n, f.err
+}
+
+// TestAppendRowRetry appends through a file that fails a number of times
+// before it succeeds: transient errors are retried up to the policy's
+// attempts without writing any part of the row twice, others fail at once
+func TestAppendRowRetry(t *testing.T) {
+	if err := SetRetryPolicy(RetryPolicy{Attempts: 3, Backoff: time.Millisecond}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { SetRetryPolicy(DefaultRetryPolicy) })
+
+	tests := []struct {
+		name      string
+		err       error
+		failures  int
+		wantCalls int
+		wantErr   bool
+	}{
+		{"no failures", syscall.EAGAIN, 0, 1, false},
+		{"one EAGAIN", syscall.EAGAIN, 1, 2, false},
+		{"two EINTR", syscall.EINTR, 2, 3, false},
+		{"EBUSY", syscall.EBUSY, 1, 2, false},
+		{"ETIMEDOUT", syscall.ETIMEDOUT, 1, 2, false},
+		{"out of attempts", syscall.EAGAIN, 3, 3, true},
+		{"permission", syscall.EACCES, 1, 1, true},
+		{"missing file", syscall.ENOENT, 1, 1, true},
+		{"I/O error", syscall.EIO, 1, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newTestTable(t, SyncPolicy{Mode: SyncNone})
+			write := appendLine
+			t.Cleanup(func() { appendLine = write })
+
+			if _, err := AppendRow("t", []string{"1", "1", "alice"}); err != nil {
+				t.Fatal(err)
+			}
+			size := tableSize(t)
+
+			var flaky *flakyFile
+			appendLine = func(file *os.File, line string) error {
+				flaky = &flakyFile{file: file, err: tt.err, failures: tt.failures}
+				return writeFull(flaky, line)
+			}
+			row := []string{"2", "1", "bob"}
+			offset, err := AppendRow("t", row)
+			if flaky.calls != tt.wantCalls {
+				t.Errorf("%d writes, want %d", flaky.calls, tt.wantCalls)
+			}
+			if tt.wantErr {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("got %v, want %v", err, tt.err)
+				}
+				if got := tableSize(t); got != size {
+					t.Errorf("file is %d bytes after the failed append, want %d", got, size)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, err := ReadRow("t", offset); offset != size || err != nil || !reflect.DeepEqual(got, row) {
+				t.Errorf("row at %d = %v, %v; want %v at %d", offset, got, err, row, size)
+			}
+			next := []string{"3", "1", "carol"}
+			nextOffset, err := AppendRow("t", next)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, err := ReadRow("t", nextOffset); err != nil || !reflect.DeepEqual(got, next) {
+				t.Errorf("row after the retried one = %v, %v; want %v", got, err, next)
+			}
+		})
+	}
+}
+
+// TestSetRetryPolicy rejects policies that can't run and raises a cap below
+// the first wait to it
+func TestSetRetryPolicy(t *testing.T) {
+	t.Cleanup(func() { SetRetryPolicy(DefaultRetryPolicy) })
+
+	tests := []struct {
+		name    string
+		policy  RetryPolicy
+		want    RetryPolicy
+		wantErr bool
+	}{
+		{"default", DefaultRetryPolicy, DefaultRetryPolicy, false},
+		{"retries disabled", RetryPolicy{Attempts: 1}, RetryPolicy{Attempts: 1}, false},
+		{"cap below the backoff", RetryPolicy{Attempts: 2, Backoff: time.Second, MaxBackoff: time.Millisecond},
+			RetryPolicy{Attempts: 2, Backoff: time.Second, MaxBackoff: time.Second}, false},
+		{"no attempts", RetryPolicy{Attempts: 0}, RetryPolicy{}, true},
+		{"negative backoff", RetryPolicy{Attempts: 2, Backoff: -time.Millisecond}, RetryPolicy{}, true},
+		{"negative cap", RetryPolicy{Attempts: 2, MaxBackoff: -time.Millisecond}, RetryPolicy{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetRetryPolicy(DefaultRetryPolicy)
+			err := SetRetryPolicy(tt.policy)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("SetRetryPolicy(%+v) succeeded", tt.policy)
+				}
+				if retryPolicy != DefaultRetryPolicy {
+					t.Errorf("a rejected policy replaced the current one: %+v", retryPolicy)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if retryPolicy != tt.want {
+				t.Errorf("policy = %+v, want %+v", retryPolicy, tt.want)
+			}
+		})
+	}
+}
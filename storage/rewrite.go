@@ -0,0 +1,176 @@
+package storage
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+)
+
+// RewriteTableFile streams a table's log into a new file holding only the
+// rows keep accepts, in the same order, then swaps it in with an atomic
+// rename. keep gets each row's offset in the old (decompressed) log and its
+// data. Row offsets change, so callers must rebuild their index afterwards.
+// A corrupt record aborts the rewrite and leaves the table untouched, so bad
+// data is never silently dropped or re-checksummed.
+func RewriteTableFile(tableName string, keep func(offset int64, data []string) bool) error {
+	return TransformTableFile(tableName, func(offset int64, data []string) ([]string, bool) {
+		return data, keep(offset, data)
+	})
+}
+
+// TransformTableFile is RewriteTableFile where each kept row may also be
+// replaced: transform returns the row to write, re-encoded with a fresh
+// checksum, and whether to keep it at all
+func TransformTableFile(tableName string, transform func(offset int64, data []string) ([]string, bool)) error {
+	// The writer's append handle would keep pointing at the old file
+	stopWriter(tableName)
+
+	storageMutex.Lock()
+	defer storageMutex.Unlock()
+
+	filePath := tablePath(tableName, ".db")
+	tmpPath := filePath + ".tmp"
+	err := writeTransformed(tableName, tmpPath, transform)
+	if err == nil {
+		err = os.Rename(tmpPath, filePath)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to rewrite table file %s: %w", tableName, err)
+	}
+	bumpGeneration(tableName)
+	removeIndexCheckpoint(tableName)
+	return nil
+}
+
+// writeTransformed writes the rows of a table's log that transform keeps to
+// a new file at path and syncs it. Callers hold storageMutex.
+func writeTransformed(tableName, path string, transform func(offset int64, data []string) ([]string, bool)) error {
+	src, err := OpenTableFile(tableName)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file for %s: %w", tableName, err)
+	}
+	err = copyKeptRows(dst, tableName, src, transform)
+	if err == nil {
+		err = dst.Sync()
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// A schema change that rewrites every row (dropping a column, say) has to
+// replace the table file and the metadata describing it together, and there
+// is no atomic rename of two files. So the new log is staged beside the old
+// one under the schema version it belongs to (data/t.db.v3), then the
+// metadata naming that version is saved, and only then is the stage renamed
+// into place. The metadata save is the commit point: RecoverStagedTableFile
+// finishes a change whose metadata was saved and throws away one whose
+// metadata wasn't, so a reload always sees a file matching its schema.
+
+// stagedPath is where the log of a table's given schema version is staged
+func stagedPath(tableName string, version int) string {
+	return tablePath(tableName, fmt.Sprintf(".db.v%d", version))
+}
+
+// StageTransformTableFile writes the log TransformTableFile would, as the
+// staged file of schema version version, leaving the table file as it is.
+// Callers must keep the table from being written until the stage is
+// committed or discarded.
+func StageTransformTableFile(tableName string, version int, transform func(offset int64, data []string) ([]string, bool)) error {
+	// The writer's append handle would keep pointing at the old file
+	stopWriter(tableName)
+
+	storageMutex.Lock()
+	defer storageMutex.Unlock()
+
+	path := stagedPath(tableName, version)
+	if err := writeTransformed(tableName, path, transform); err != nil {
+		os.Remove(path)
+		return fmt.Errorf("failed to stage table file %s: %w", tableName, err)
+	}
+	return nil
+}
+
+// CommitStagedTableFile renames the staged log of schema version version
+// over the table file, once the metadata naming that version is saved
+func CommitStagedTableFile(tableName string, version int) error {
+	storageMutex.Lock()
+	defer storageMutex.Unlock()
+
+	if err := os.Rename(stagedPath(tableName, version), tablePath(tableName, ".db")); err != nil {
+		return fmt.Errorf("failed to replace table file %s: %w", tableName, err)
+	}
+	bumpGeneration(tableName)
+	removeIndexCheckpoint(tableName)
+	return nil
+}
+
+// DiscardStagedTableFile removes a stage whose schema change was abandoned
+func DiscardStagedTableFile(tableName string, version int) {
+	os.Remove(stagedPath(tableName, version))
+}
+
+// RecoverStagedTableFile settles a schema change interrupted by a crash,
+// before the table is loaded. version is the table's schema version in the
+// saved metadata. A stage of that version was committed but not yet renamed
+// into place, so the rename is finished and true returned; a stage of the
+// next version never got its metadata saved and is removed.
+func RecoverStagedTableFile(tableName string, version int) (bool, error) {
+	DiscardStagedTableFile(tableName, version+1)
+	if _, err := os.Stat(stagedPath(tableName, version)); os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("failed to check staged file of table %s: %w", tableName, err)
+	}
+	if err := CommitStagedTableFile(tableName, version); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// copyKeptRows re-encodes the rows of src that transform keeps into dst,
+// compressing them if the table is compressed
+func copyKeptRows(dst io.Writer, tableName string, src io.Reader, transform func(offset int64, data []string) ([]string, bool)) error {
+	var zw *gzip.Writer
+	if IsCompressed(tableName) {
+		zw = gzip.NewWriter(dst)
+		dst = zw
+	}
+
+	format := TableFormat(tableName)
+	reader := NewRecordReader(tableName, src)
+	for reader.Next() {
+		record := reader.Record()
+		if record.Err != nil {
+			return fmt.Errorf("corrupt record at offset %d: %w", record.Offset, record.Err)
+		}
+		fields, keep := transform(record.Offset, record.Fields)
+		if !keep {
+			continue
+		}
+		encoded, err := encodeRow(format, fields)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(dst, encoded); err != nil {
+			return err
+		}
+	}
+	if err := reader.Err(); err != nil {
+		return err
+	}
+
+	if zw != nil {
+		return zw.Close()
+	}
+	return nil
+}
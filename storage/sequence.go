@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ReadSequence returns the auto-increment high-water mark saved for a table,
+// or 0 if none was saved
+func ReadSequence(tableName string) (int64, error) {
+	content, err := os.ReadFile(tablePath(tableName, ".seq"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to read sequence file for %s: %w", tableName, err)
+	}
+
+	value, err := strconv.ParseInt(strings.TrimSpace(string(content)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("corrupt sequence file for %s: %w", tableName, err)
+	}
+	return value, nil
+}
+
+// WriteSequence saves the auto-increment high-water mark of a table.
+// The file is replaced with an atomic rename, so it always holds a whole value.
+func WriteSequence(tableName string, value int64) error {
+	filePath := tablePath(tableName, ".seq")
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return fmt.Errorf("failed to create data directory: %w", err)
+	}
+	tmpPath := filePath + ".tmp"
+	if err := os.WriteFile(tmpPath, []byte(strconv.FormatInt(value, 10)+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to write sequence file for %s: %w", tableName, err)
+	}
+	if err := os.Rename(tmpPath, filePath); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write sequence file for %s: %w", tableName, err)
+	}
+	return nil
+}
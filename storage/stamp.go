@@ -0,0 +1,131 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// fileStamp is the size and modification time of a table file as storage
+// last left it. A missing file has size -1.
+type fileStamp struct {
+	size    int64
+	modTime time.Time
+}
+
+// Watched table files have a stamp, kept current by the appends, rollbacks
+// and replacements made through storage. A file whose size or mtime no
+// longer matches its stamp was written by something else, such as an editor
+// or a copy made while the server was running, and the offsets indexed for
+// it can't be trusted. Edits that keep both the size and the mtime (within
+// the filesystem's timestamp resolution) aren't noticed.
+//
+// While storage itself is changing a file its stamp is out of date, so a
+// check then would mistake the server's own write for an outside one. Table
+// replacements hold storageMutex until they restamp, and a writer's batch
+// counts in writing until it has.
+var (
+	stampMu sync.Mutex
+	stamps  = make(map[string]fileStamp)
+	writing = make(map[string]int)
+)
+
+// statTableFile returns the current stamp of a table file
+func statTableFile(tableName string) (fileStamp, error) {
+	info, err := os.Stat(tablePath(tableName, ".db"))
+	if os.IsNotExist(err) {
+		return fileStamp{size: -1}, nil
+	}
+	if err != nil {
+		return fileStamp{}, fmt.Errorf("failed to stat table file %s: %w", tableName, err)
+	}
+	return fileStamp{size: info.Size(), modTime: info.ModTime()}, nil
+}
+
+// WatchTableFile starts watching a table file for outside changes, taking
+// its current state as the one the index describes. Call it again after
+// rebuilding the index from the file.
+func WatchTableFile(tableName string) error {
+	stamp, err := statTableFile(tableName)
+	if err != nil {
+		return err
+	}
+	stampMu.Lock()
+	stamps[tableName] = stamp
+	stampMu.Unlock()
+	return nil
+}
+
+// TableFileChanged reports whether a watched table file was changed by
+// something other than storage since it was stamped. Unwatched tables never
+// count as changed.
+func TableFileChanged(tableName string) (bool, error) {
+	storageMutex.RLock()
+	defer storageMutex.RUnlock()
+
+	// Stat under stampMu too, so no writer's batch can start in between
+	stampMu.Lock()
+	defer stampMu.Unlock()
+	want, watched := stamps[tableName]
+	if !watched || writing[tableName] > 0 {
+		return false, nil
+	}
+	got, err := statTableFile(tableName)
+	if err != nil {
+		return false, err
+	}
+	return got.size != want.size || !got.modTime.Equal(want.modTime), nil
+}
+
+// restamp takes the file's current state as its stamp after storage changed
+// it. Unwatched tables are left alone.
+func restamp(tableName string) {
+	stampMu.Lock()
+	_, watched := stamps[tableName]
+	stampMu.Unlock()
+	if !watched {
+		return
+	}
+	stamp, err := statTableFile(tableName)
+	if err != nil {
+		// Leave the stamp as it was: the next check sees a change and
+		// rebuilds, which is safe
+		return
+	}
+	stampMu.Lock()
+	if _, watched := stamps[tableName]; watched {
+		stamps[tableName] = stamp
+	}
+	stampMu.Unlock()
+}
+
+// beginWrite marks a table file as being appended to by its writer, until
+// the matching endWrite
+func beginWrite(tableName string) {
+	stampMu.Lock()
+	writing[tableName]++
+	stampMu.Unlock()
+}
+
+// endWrite ends a beginWrite, once the writer has restamped the file
+func endWrite(tableName string) {
+	stampMu.Lock()
+	if writing[tableName]--; writing[tableName] <= 0 {
+		delete(writing, tableName)
+	}
+	stampMu.Unlock()
+}
+
+// ResyncTableFile prepares a table file that was changed from outside for
+// its index to be rebuilt: the writer is stopped, so the next append reopens
+// the file and goes after whatever was added, and the table moves to a new
+// generation, so snapshots pinned to the old offsets stop using them.
+func ResyncTableFile(tableName string) {
+	stopWriter(tableName)
+
+	storageMutex.Lock()
+	defer storageMutex.Unlock()
+	bumpGeneration(tableName)
+	removeIndexCheckpoint(tableName)
+}
@@ -1,97 +1,123 @@
 package storage
 
 import (
-	"bufio"
 	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
 )
 
+// ErrOffsetOutOfRange is returned by ReadRow for an offset outside the table
+// file, which means the caller's index is stale
+var ErrOffsetOutOfRange = errors.New("offset out of range; the index may be stale")
+
 // storageMutex protects file access to ensure thread safety
 var storageMutex sync.RWMutex
 
-// calculateChecksum computes a SHA-256 checksum of the pipe-joined data
+// calculateChecksum computes a SHA-256 checksum of the pipe-joined data.
+// data is the whole stored row, so the checksum covers the id and the
+// active_flag as well as the column values (see encodeRow).
 func calculateChecksum(data []string) string {
 	content := strings.Join(data, "|")
 	hash := sha256.Sum256([]byte(content))
 	return hex.EncodeToString(hash[:])
 }
 
+// encodeText renders a row as a text record: the pipe-joined data, its
+// checksum, and a trailing newline
+func encodeText(data []string) string {
+	return strings.Join(data, "|") + "|" + calculateChecksum(data) + "\n"
+}
+
+// RowSize returns the number of bytes a row takes up in the table file
+func RowSize(tableName string, data []string) int64 {
+	record, _ := encodeRow(TableFormat(tableName), data)
+	return int64(len(record))
+}
+
 // AppendRow appends a new row to the table file.
 // The data slice represents the columns of the row.
 // Returns the offset at which the row was written and an error if any.
+// Rows go through the table's writer goroutine, so appends to one table
+// land in the order AppendRow was called.
+// Durability follows the configured SyncPolicy (see SetSyncPolicy and WaitForSync).
 func AppendRow(tableName string, data []string) (int64, error) {
-	storageMutex.Lock()
-	defer storageMutex.Unlock()
-
-	// Ensure data directory exists
-	if err := os.MkdirAll("data", 0755); err != nil {
-		return 0, fmt.Errorf("failed to create data directory: %w", err)
-	}
-
-	filePath := filepath.Join("data", tableName+".db")
-	file, err := os.OpenFile(filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		return 0, fmt.Errorf("failed to open table file %s: %w", tableName, err)
-	}
-	defer file.Close()
-
-	// Calculate checksum of the row content
-	checksum := calculateChecksum(data)
-	
-	// Create a new slice with checksum appended
-	rowWithChecksum := make([]string, len(data)+1)
-	copy(rowWithChecksum, data)
-	rowWithChecksum[len(data)] = checksum
-
-	// Get current offset
-	stat, err := file.Stat()
-	if err != nil {
-		return 0, fmt.Errorf("failed to stat file %s: %w", tableName, err)
-	}
-	offset := stat.Size()
-
-	// Join data with pipes and add newline
-	line := strings.Join(rowWithChecksum, "|") + "\n"
-
-	if _, err := file.WriteString(line); err != nil {
-		return 0, fmt.Errorf("failed to write row to %s: %w", tableName, err)
-	}
-
-	return offset, nil
+	done := make(chan writeResult, 1)
+	submitWrite(tableName, writeRequest{data: data, done: done})
+	result := <-done
+	return result.offset, result.err
 }
 
 // ReadRow reads a row from the table file at the given offset.
+// Compressed tables can't be seeked into and return ErrCompressedSeek.
+// Transient errors are retried (see SetRetryPolicy).
 func ReadRow(tableName string, offset int64) ([]string, error) {
 	storageMutex.RLock()
 	defer storageMutex.RUnlock()
 
-	filePath := filepath.Join("data", tableName+".db")
+	if IsCompressed(tableName) {
+		return nil, fmt.Errorf("cannot read %s at offset %d: %w", tableName, offset, ErrCompressedSeek)
+	}
+
+	var fields []string
+	err := retry(func() error {
+		var err error
+		fields, err = readRowAt(tableName, offset)
+		return err
+	})
+	return fields, err
+}
+
+// readRowAt is one attempt of ReadRow. Callers hold storageMutex.
+func readRowAt(tableName string, offset int64) ([]string, error) {
+	filePath := tablePath(tableName, ".db")
 	file, err := os.Open(filePath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open table file %s: %w", tableName, err)
 	}
 	defer file.Close()
 
+	// An offset past the end means the index no longer matches the file
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat file %s: %w", tableName, err)
+	}
+	if offset < 0 || offset >= stat.Size() {
+		return nil, fmt.Errorf("cannot read %s at offset %d (file size %d): %w", tableName, offset, stat.Size(), ErrOffsetOutOfRange)
+	}
+
 	if _, err := file.Seek(offset, 0); err != nil {
 		return nil, fmt.Errorf("failed to seek to offset %d in %s: %w", offset, tableName, err)
 	}
 
-	reader := bufio.NewReader(file)
-	line, err := reader.ReadString('\n')
-	if err != nil {
-		return nil, fmt.Errorf("failed to read line at offset %d in %s: %w", offset, tableName, err)
+	reader := newRecordReader(TableFormat(tableName), file, offset)
+	if !reader.Next() {
+		err := reader.Err()
+		if err == nil {
+			err = io.EOF
+		}
+		return nil, fmt.Errorf("failed to read record at offset %d in %s: %w", offset, tableName, err)
+	}
+
+	record := reader.Record()
+	if record.Err != nil {
+		return nil, record.Err
 	}
+	return record.Fields, nil
+}
 
+// decodeRow splits a stored line and verifies its checksum.
+// It returns the data without the checksum, even when the checksum doesn't match.
+func decodeRow(line string) ([]string, error) {
 	// Remove newline and split by pipe
 	line = strings.TrimSuffix(line, "\n")
 	parts := strings.Split(line, "|")
-	
+
 	// Checksum verification
 	if len(parts) < 2 {
 		return nil, fmt.Errorf("corrupt row: insufficient data")
@@ -104,52 +130,72 @@ func ReadRow(tableName string, offset int64) ([]string, error) {
 
 	calculatedChecksum := calculateChecksum(dataParts)
 	if storedChecksum != calculatedChecksum {
-		return nil, errors.New("SECURITY ALERT: Row data has been tampered with!")
+		return dataParts, ErrTampered
 	}
 
 	return dataParts, nil
 }
 
-// OpenTableFile opens the table file for reading. 
+// OpenTableFile opens the table file for reading.
 // It returns the file handle which the caller is responsible for closing.
-func OpenTableFile(tableName string) (*os.File, error) {
-    // Note: Caller is responsible for locking if needed, though simply opening for read usually doesn't require global lock 
-    // unless we are protecting against file deletion/renaming.
-    // For simplicity in this architecture, we assume files persist.
-    
-	filePath := filepath.Join("data", tableName+".db")
-	file, err := os.Open(filePath)
+// Compressed tables are decompressed transparently.
+func OpenTableFile(tableName string) (io.ReadCloser, error) {
+	// Note: Caller is responsible for locking if needed, though simply opening for read usually doesn't require global lock
+	// unless we are protecting against file deletion/renaming.
+	// For simplicity in this architecture, we assume files persist.
+
+	filePath := tablePath(tableName, ".db")
+	var file *os.File
+	err := retry(func() error {
+		var err error
+		file, err = os.Open(filePath)
+		return err
+	})
 	if err != nil {
 		if os.IsNotExist(err) {
-            // Return nil, nil if file doesn't exist yet, or error? 
-            // Architecture says "Open .db file", implying existence or creation.
-            // Let's return the error to be explicit.
+			// Return nil, nil if file doesn't exist yet, or error?
+			// Architecture says "Open .db file", implying existence or creation.
+			// Let's return the error to be explicit.
 			return nil, fmt.Errorf("table file %s does not exist: %w", tableName, err)
 		}
 		return nil, fmt.Errorf("failed to open table file %s: %w", tableName, err)
 	}
+	if IsCompressed(tableName) {
+		return newGzipReadCloser(tableName, file)
+	}
 	return file, nil
 }
 
+// TableFileExists reports whether the table's data file is present on disk
+func TableFileExists(tableName string) (bool, error) {
+	filePath := tablePath(tableName, ".db")
+	if _, err := os.Stat(filePath); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to stat table file %s: %w", tableName, err)
+	}
+	return true, nil
+}
+
 // CreateTableFile creates the table file if it doesn't exist.
 func CreateTableFile(tableName string) error {
 	storageMutex.Lock()
 	defer storageMutex.Unlock()
 
-	// Ensure data directory exists
-	if err := os.MkdirAll("data", 0755); err != nil {
+	// Ensure data directory (and the schema's subdirectory) exists
+	filePath := tablePath(tableName, ".db")
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
 		return fmt.Errorf("failed to create data directory: %w", err)
 	}
 
-	filePath := filepath.Join("data", tableName+".db")
-	
 	// Create the file. If it exists, it truncates it? No, we shouldn't truncate if it exists.
 	// But CreateTable in engine checks if table exists in memory.
 	// If file exists on disk but not in memory (restart), we should load it.
 	// But CreateTable is for NEW tables.
 	// Use os.Create will truncate. Use OpenFile with O_CREATE|O_EXCL to fail if exists?
 	// The safest is O_CREATE without O_TRUNC.
-	
+
 	file, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
 	if err != nil {
 		if os.IsExist(err) {
@@ -0,0 +1,163 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestReadRowOffsetOutOfRange checks that offsets outside the table file,
+// as a stale index would hold after the file shrank, are reported as such
+// rather than as a read error
+func TestReadRowOffsetOutOfRange(t *testing.T) {
+	newTestTable(t, SyncPolicy{Mode: SyncNone})
+	first := []string{"1", "1", "alice"}
+	second := []string{"2", "1", "bob"}
+	if _, err := AppendRow("t", first); err != nil {
+		t.Fatal(err)
+	}
+	secondOffset, err := AppendRow("t", second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := tableSize(t)
+
+	tests := []struct {
+		name    string
+		offset  int64
+		want    []string
+		wantErr error
+	}{
+		{"first row", 0, first, nil},
+		{"second row", secondOffset, second, nil},
+		{"negative", -1, nil, ErrOffsetOutOfRange},
+		{"end of file", size, nil, ErrOffsetOutOfRange},
+		{"past the end", size + 100, nil, ErrOffsetOutOfRange},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadRow("t", tt.offset)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ReadRow at %d: got error %v, want %v", tt.offset, err, tt.wantErr)
+			}
+			if tt.wantErr == nil && !reflect.DeepEqual(got[:len(tt.want)], tt.want) {
+				t.Errorf("ReadRow at %d = %v, want %v", tt.offset, got, tt.want)
+			}
+		})
+	}
+
+	// The file shrinks under an index that still points at the second row
+	CloseWriters()
+	if err := os.Truncate(tablePath("t", ".db"), secondOffset); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadRow("t", secondOffset); !errors.Is(err, ErrOffsetOutOfRange) {
+		t.Errorf("ReadRow of a truncated row: got %v, want ErrOffsetOutOfRange", err)
+	}
+}
+
+// TestTablePath checks that a schema-qualified table is stored in a
+// subdirectory named after its schema, and that its file is created there
+func TestTablePath(t *testing.T) {
+	newTestTable(t, SyncPolicy{Mode: SyncNone})
+	dir := DataDir()
+	tests := []struct {
+		table string
+		ext   string
+		want  string
+	}{
+		{"orders", ".db", filepath.Join(dir, "orders.db")},
+		{"sales.orders", ".db", filepath.Join(dir, "sales", "orders.db")},
+		{"sales.orders", ".idx", filepath.Join(dir, "sales", "orders.idx")},
+		{"archive.orders", ".seq", filepath.Join(dir, "archive", "orders.seq")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.table+tt.ext, func(t *testing.T) {
+			if got := tablePath(tt.table, tt.ext); got != tt.want {
+				t.Errorf("tablePath = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	if err := CreateTableFile("sales.orders"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := AppendRow("sales.orders", []string{"1", "1", "ink"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ReadRow("sales.orders", 0); err != nil || got[2] != "ink" {
+		t.Fatalf("ReadRow = %v, %v", got, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "sales", "orders.db")); err != nil {
+		t.Errorf("table file not in the schema directory: %v", err)
+	}
+}
+
+// TestSetDataDir checks that table files follow the data directory and that
+// an empty directory is refused without changing the current one
+func TestSetDataDir(t *testing.T) {
+	newTestTable(t, SyncPolicy{Mode: SyncNone})
+	before := DataDir()
+	t.Cleanup(func() { SetDataDir(before) })
+	other := t.TempDir()
+
+	tests := []struct {
+		path    string
+		want    string
+		wantErr bool
+	}{
+		{other, other, false},
+		{other + "/./sub/..", other, false},
+		{filepath.Join(other, "nested"), filepath.Join(other, "nested"), false},
+		{"", "", true},
+		{"   ", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			SetDataDir(before)
+			err := SetDataDir(tt.path)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("SetDataDir(%q) succeeded", tt.path)
+				}
+				if got := DataDir(); got != before {
+					t.Errorf("DataDir = %s after a refused change, want %s", got, before)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := DataDir(); got != tt.want {
+				t.Errorf("DataDir = %s, want %s", got, tt.want)
+			}
+			if got := TableFilePath("t"); got != filepath.Join(tt.want, "t.db") {
+				t.Errorf("TableFilePath = %s, want it under %s", got, tt.want)
+			}
+		})
+	}
+
+	// Appends after a switch go to the new directory, not the old handle
+	SetDataDir(before)
+	if _, err := AppendRow("t", []string{"1", "1", "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	size := tableSize(t)
+	if err := SetDataDir(other); err != nil {
+		t.Fatal(err)
+	}
+	if err := CreateTableFile("t"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := AppendRow("t", []string{"2", "1", "bob"}); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(filepath.Join(before, "t.db")); err != nil || info.Size() != size {
+		t.Errorf("the old directory's file changed after the switch: %v, %v", info, err)
+	}
+	if row, err := ReadRow("t", 0); err != nil || row[0] != "2" {
+		t.Errorf("first row in the new directory = %v, %v; want bob's", row, err)
+	}
+}
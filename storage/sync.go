@@ -0,0 +1,309 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// SyncMode controls when appended rows are flushed to stable storage
+type SyncMode int
+
+const (
+	// SyncNone leaves flushing to the OS. A crash can lose recent writes.
+	SyncNone SyncMode = iota
+	// SyncEveryWrite fsyncs the table file before AppendRow returns. It is
+	// the default: a ledger shouldn't report an insert that a crash can undo.
+	SyncEveryWrite
+	// SyncGroup coalesces fsyncs: dirty tables are flushed every Interval,
+	// or as soon as MaxPending writes have queued up, whichever comes first.
+	SyncGroup
+)
+
+// SyncPolicy configures durability for AppendRow.
+//
+// Durability window in SyncGroup mode: a write is on disk at the latest
+// Interval after it was appended (sooner if MaxPending writes arrive first).
+// A crash inside that window can lose it, unless WaitForSync is set, in which
+// case callers block in WaitForSync until a group sync covering the write finished.
+type SyncPolicy struct {
+	Mode        SyncMode
+	Interval    time.Duration // SyncGroup: maximum time between syncs
+	MaxPending  int           // SyncGroup: sync early after this many writes
+	WaitForSync bool          // SyncGroup: make WaitForSync block until writes are synced
+}
+
+// groupCommitter tracks writes that still need an fsync and flushes them in batches
+type groupCommitter struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	policy  SyncPolicy
+	dirty   map[string]bool
+	pending int
+	queued  uint64         // sequence number of the last queued write
+	synced  uint64         // highest sequence number covered by a finished sync
+	waiting map[uint64]int // sequence numbers callers are blocked in wait for
+	failed  []syncFailure  // flushes that failed, oldest first
+	flushMu sync.Mutex     // serializes flushes, so each covers (synced, queued]
+	kick    chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+var (
+	syncMu     sync.Mutex // guards syncPolicy and committer replacement
+	syncPolicy = SyncPolicy{Mode: SyncEveryWrite}
+	committer  *groupCommitter
+)
+
+// SetSyncPolicy changes the durability policy. Any running group committer is
+// flushed and stopped before the new policy takes effect.
+func SetSyncPolicy(policy SyncPolicy) error {
+	if policy.Mode == SyncGroup {
+		if policy.Interval <= 0 {
+			return fmt.Errorf("group commit requires a positive sync interval")
+		}
+		if policy.MaxPending <= 0 {
+			policy.MaxPending = 1000
+		}
+	}
+
+	syncMu.Lock()
+	defer syncMu.Unlock()
+
+	if committer != nil {
+		committer.close()
+		committer = nil
+	}
+
+	syncPolicy = policy
+	if policy.Mode == SyncGroup {
+		committer = newGroupCommitter(policy)
+	}
+	return nil
+}
+
+// Flush forces an fsync of every write queued by group commit.
+// It is a no-op in the other modes. Call it before shutting down.
+func Flush() error {
+	syncMu.Lock()
+	gc := committer
+	syncMu.Unlock()
+
+	if gc == nil {
+		return nil
+	}
+	return gc.flush()
+}
+
+// WaitForSync blocks until every write queued so far has been synced, when the
+// policy is SyncGroup with WaitForSync set. Otherwise it returns immediately.
+// Callers should invoke it after releasing their own locks so that concurrent
+// writers coalesce into one fsync.
+func WaitForSync() error {
+	syncMu.Lock()
+	policy := syncPolicy
+	gc := committer
+	syncMu.Unlock()
+
+	if gc == nil || !policy.WaitForSync {
+		return nil
+	}
+
+	gc.mu.Lock()
+	defer gc.mu.Unlock()
+	return gc.waitLocked(gc.queued)
+}
+
+// afterWrite applies the sync policy to a batch of rows just written to the
+// table file. A nil file means the append handle was lost; the table file is
+// then synced through a fresh one.
+func afterWrite(tableName string, file *os.File, writes int) error {
+	syncMu.Lock()
+	policy := syncPolicy
+	gc := committer
+	syncMu.Unlock()
+
+	switch policy.Mode {
+	case SyncEveryWrite:
+		if file == nil {
+			return syncTableFile(tableName)
+		}
+		if err := fsync(file); err != nil {
+			return fmt.Errorf("failed to sync table file %s: %w", tableName, err)
+		}
+	case SyncGroup:
+		if gc != nil {
+			for i := 0; i < writes; i++ {
+				gc.queue(tableName)
+			}
+		}
+	}
+	return nil
+}
+
+// syncFailure records a flush that failed and the writes it covered
+type syncFailure struct {
+	from, to uint64 // sequence numbers covered, inclusive
+	err      error
+}
+
+func newGroupCommitter(policy SyncPolicy) *groupCommitter {
+	gc := &groupCommitter{
+		policy:  policy,
+		dirty:   make(map[string]bool),
+		waiting: make(map[uint64]int),
+		kick:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	gc.cond = sync.NewCond(&gc.mu)
+	go gc.loop()
+	return gc
+}
+
+// queue records a write to tableName that still needs an fsync
+func (gc *groupCommitter) queue(tableName string) {
+	gc.mu.Lock()
+	defer gc.mu.Unlock()
+
+	gc.dirty[tableName] = true
+	gc.pending++
+	gc.queued++
+	if gc.pending >= gc.policy.MaxPending {
+		select {
+		case gc.kick <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// wait blocks until the write with the given sequence number has been synced
+// and returns the error of the flush that covered it
+func (gc *groupCommitter) wait(seq uint64) error {
+	gc.mu.Lock()
+	defer gc.mu.Unlock()
+	return gc.waitLocked(seq)
+}
+
+// waitLocked is wait for callers holding gc.mu
+func (gc *groupCommitter) waitLocked(seq uint64) error {
+	gc.waiting[seq]++
+	for gc.synced < seq {
+		gc.cond.Wait()
+	}
+	if gc.waiting[seq]--; gc.waiting[seq] == 0 {
+		delete(gc.waiting, seq)
+	}
+
+	for _, f := range gc.failed {
+		if f.from <= seq && seq <= f.to {
+			return f.err
+		}
+	}
+	return nil
+}
+
+// loop syncs dirty tables on every tick or when enough writes are pending
+func (gc *groupCommitter) loop() {
+	defer close(gc.done)
+
+	ticker := time.NewTicker(gc.policy.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			gc.flush()
+		case <-gc.kick:
+			gc.flush()
+		case <-gc.stop:
+			gc.flush()
+			return
+		}
+	}
+}
+
+// flush fsyncs every dirty table and wakes the writers it covered
+func (gc *groupCommitter) flush() error {
+	gc.flushMu.Lock()
+	defer gc.flushMu.Unlock()
+
+	gc.mu.Lock()
+	if gc.pending == 0 {
+		gc.mu.Unlock()
+		return nil
+	}
+	tables := gc.dirty
+	target := gc.queued
+	gc.dirty = make(map[string]bool)
+	gc.pending = 0
+	gc.mu.Unlock()
+
+	var firstErr error
+	for tableName := range tables {
+		if err := groupSync(tableName); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	gc.mu.Lock()
+	gc.pruneFailures()
+	if firstErr != nil {
+		gc.failed = append(gc.failed, syncFailure{from: gc.synced + 1, to: target, err: firstErr})
+	}
+	gc.synced = target
+	gc.cond.Broadcast()
+	gc.mu.Unlock()
+
+	return firstErr
+}
+
+// pruneFailures forgets failed flushes no waiter can ask about any more:
+// blocked callers wait for their own sequence number, and later ones for at
+// least the current gc.queued. Callers hold gc.mu.
+func (gc *groupCommitter) pruneFailures() {
+	low := gc.queued
+	for seq := range gc.waiting {
+		if seq < low {
+			low = seq
+		}
+	}
+	kept := gc.failed[:0]
+	for _, f := range gc.failed {
+		if f.to >= low {
+			kept = append(kept, f)
+		}
+	}
+	gc.failed = kept
+}
+
+// close stops the background loop after a final flush
+func (gc *groupCommitter) close() {
+	close(gc.stop)
+	<-gc.done
+}
+
+// fsync syncs an append handle in SyncEveryWrite mode; tests swap it to
+// inject failures
+var fsync = (*os.File).Sync
+
+// groupSync is how a group commit fsyncs a table; tests swap it to inject failures
+var groupSync = syncTableFile
+
+// syncTableFile fsyncs a table file. fsync flushes the file's dirty pages no
+// matter which descriptor wrote them, so a fresh handle is enough.
+func syncTableFile(tableName string) error {
+	filePath := tablePath(tableName, ".db")
+	file, err := os.OpenFile(filePath, os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open table file %s for sync: %w", tableName, err)
+	}
+	defer file.Close()
+
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync table file %s: %w", tableName, err)
+	}
+	return nil
+}
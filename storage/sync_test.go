@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// TestGroupSyncFailureReachesWaiters fails the fsync of one batch and checks
+// that every write in it is told so, even when a later flush succeeds before
+// the waiters wake up
+func TestGroupSyncFailureReachesWaiters(t *testing.T) {
+	errSync := errors.New("injected fsync failure")
+	t.Cleanup(func() { groupSync = syncTableFile })
+
+	// A long interval and a large batch, so only explicit flushes run
+	gc := newGroupCommitter(SyncPolicy{Mode: SyncGroup, Interval: time.Hour, MaxPending: 1000})
+	t.Cleanup(gc.close)
+
+	const batch = 3
+	for i := 0; i < batch; i++ {
+		gc.queue("t")
+	}
+	results := make(chan error, batch)
+	for seq := uint64(1); seq <= batch; seq++ {
+		go func(seq uint64) { results <- gc.wait(seq) }(seq)
+	}
+	for blocked := 0; blocked < batch; {
+		time.Sleep(time.Millisecond)
+		gc.mu.Lock()
+		blocked = 0
+		for _, n := range gc.waiting {
+			blocked += n
+		}
+		gc.mu.Unlock()
+	}
+
+	groupSync = func(string) error { return errSync }
+	if err := gc.flush(); !errors.Is(err, errSync) {
+		t.Fatalf("failed flush returned %v", err)
+	}
+
+	// The next batch syncs fine; it must not clear the first one's error
+	groupSync = func(string) error { return nil }
+	gc.queue("t")
+	if err := gc.flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < batch; i++ {
+		if err := <-results; !errors.Is(err, errSync) {
+			t.Errorf("waiter %d got %v, want the injected failure", i, err)
+		}
+	}
+	if err := gc.wait(batch + 1); err != nil {
+		t.Errorf("write in the successful batch got %v", err)
+	}
+}
+
+// BenchmarkSync compares fsyncing every append with group commit, under
+// many parallel writers that wait until their rows are durable
+func BenchmarkSync(b *testing.B) {
+	policies := []struct {
+		name   string
+		policy SyncPolicy
+	}{
+		{"every write", SyncPolicy{Mode: SyncEveryWrite}},
+		{"group", SyncPolicy{Mode: SyncGroup, Interval: 2 * time.Millisecond, MaxPending: 64, WaitForSync: true}},
+	}
+
+	for _, p := range policies {
+		b.Run(p.name, func(b *testing.B) {
+			if err := SetDataDir(b.TempDir()); err != nil {
+				b.Fatal(err)
+			}
+			b.Cleanup(CloseWriters)
+			if err := SetSyncPolicy(p.policy); err != nil {
+				b.Fatal(err)
+			}
+			b.Cleanup(func() { SetSyncPolicy(SyncPolicy{Mode: SyncEveryWrite}) })
+			if err := CreateTableFile("t"); err != nil {
+				b.Fatal(err)
+			}
+
+			// Many clients, so a group has writes to coalesce
+			b.SetParallelism(32)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for i := 0; pb.Next(); i++ {
+					if _, err := AppendRow("t", []string{strconv.Itoa(i), "1", "Starbucks", "550"}); err != nil {
+						b.Fatal(err)
+					}
+					if err := WaitForSync(); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		})
+	}
+}
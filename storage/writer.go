@@ -0,0 +1,355 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+)
+
+// ErrDiskFull is returned by an append that ran out of disk space (or quota).
+// The partial row is truncated away, so the file stays as it was before.
+var ErrDiskFull = errors.New("disk full")
+
+// maxWriteBatch caps how many queued rows a writer appends before syncing
+// and answering the callers
+const maxWriteBatch = 256
+
+// writeRequest asks a table writer to append one row
+type writeRequest struct {
+	data []string
+	done chan writeResult
+}
+
+// writeResult is the answer to a writeRequest
+type writeResult struct {
+	offset int64
+	err    error
+}
+
+// tableWriter is the goroutine that owns a table's append handle. All
+// appends to the table are funneled through its channel, so they are
+// written in order without contending on a lock, and rows that queue up
+// while one batch is written share the next fsync.
+type tableWriter struct {
+	tableName string
+	requests  chan writeRequest
+	done      chan struct{}
+
+	// Owned by the writer goroutine
+	file   *os.File
+	size   int64 // (decompressed) size of the log, i.e. the next row's offset
+	failed bool  // a write failed part-way, so size can't be trusted
+}
+
+var (
+	// writersMu guards writers. Senders hold it for reading while they
+	// enqueue, so stopWriter can't close a channel under them.
+	writersMu sync.RWMutex
+	writers   = make(map[string]*tableWriter)
+)
+
+// submitWrite hands a request to the table's writer, starting it if needed
+func submitWrite(tableName string, req writeRequest) {
+	for {
+		writersMu.RLock()
+		if w, ok := writers[tableName]; ok {
+			w.requests <- req
+			writersMu.RUnlock()
+			return
+		}
+		writersMu.RUnlock()
+		startWriter(tableName)
+	}
+}
+
+// startWriter launches the writer goroutine of a table unless it is running
+func startWriter(tableName string) {
+	writersMu.Lock()
+	defer writersMu.Unlock()
+
+	if _, ok := writers[tableName]; ok {
+		return
+	}
+	w := &tableWriter{
+		tableName: tableName,
+		requests:  make(chan writeRequest, maxWriteBatch),
+		done:      make(chan struct{}),
+	}
+	writers[tableName] = w
+	go w.loop()
+}
+
+// stopWriter lets a table's writer finish what is queued, then closes its
+// append handle. The next AppendRow starts a fresh writer, which reopens the
+// file; use this before replacing a table file.
+func stopWriter(tableName string) {
+	writersMu.Lock()
+	w, ok := writers[tableName]
+	delete(writers, tableName)
+	writersMu.Unlock()
+
+	if ok {
+		close(w.requests)
+		<-w.done
+	}
+}
+
+// CloseWriters stops every table writer once its queued rows are written and
+// closes the append handles. Call it on shutdown, or before table files are
+// replaced behind storage's back.
+func CloseWriters() {
+	writersMu.RLock()
+	names := make([]string, 0, len(writers))
+	for name := range writers {
+		names = append(names, name)
+	}
+	writersMu.RUnlock()
+
+	for _, name := range names {
+		stopWriter(name)
+	}
+}
+
+// loop appends queued rows in batches until the writer is stopped
+func (w *tableWriter) loop() {
+	defer close(w.done)
+	defer w.closeFile()
+
+	for req := range w.requests {
+		batch := []writeRequest{req}
+	drain:
+		for len(batch) < maxWriteBatch {
+			select {
+			case next, ok := <-w.requests:
+				if !ok {
+					break drain
+				}
+				batch = append(batch, next)
+			default:
+				break drain
+			}
+		}
+		w.writeBatch(batch)
+	}
+}
+
+// writeBatch appends a batch of rows, applies the sync policy once for all
+// of them and answers every request
+func (w *tableWriter) writeBatch(batch []writeRequest) {
+	results := make([]writeResult, len(batch))
+	written := 0
+
+	// A file changed from outside: reopen it so the rows go after whatever
+	// was added, and leave its stamp stale so the index gets rebuilt
+	changed, _ := TableFileChanged(w.tableName)
+	if changed {
+		w.failed = true
+	}
+	beginWrite(w.tableName)
+	defer endWrite(w.tableName)
+
+	// Readers can keep going; the exclusive lock is only taken by
+	// operations that replace the table file
+	var start, startSize int64 // file and log size before the first row written
+	storageMutex.RLock()
+	for i, req := range batch {
+		if written == 0 {
+			start, startSize = w.mark()
+		}
+		offset, err := w.write(req.data)
+		results[i] = writeResult{offset: offset, err: err}
+		if err == nil {
+			written++
+		}
+	}
+	storageMutex.RUnlock()
+
+	if written > 0 {
+		if err := afterWrite(w.tableName, w.file, written); err != nil {
+			// The callers are told their rows failed, so the rows must not
+			// come back on the next load either
+			err = w.discard(start, startSize, err)
+			for i := range results {
+				if results[i].err == nil {
+					results[i] = writeResult{err: err}
+				}
+			}
+		}
+	}
+	// A rolled back write changed the mtime too
+	if !changed {
+		restamp(w.tableName)
+	}
+
+	for i, req := range batch {
+		req.done <- results[i]
+	}
+}
+
+// write appends one row and returns its offset
+func (w *tableWriter) write(data []string) (int64, error) {
+	if err := w.ready(); err != nil {
+		return 0, err
+	}
+
+	line, err := encodeRow(TableFormat(w.tableName), data)
+	if err != nil {
+		return 0, err
+	}
+	offset := w.size
+
+	// Rows only go at the end, so a failed write is undone by cutting the
+	// file back to its size from before
+	before, err := w.file.Stat()
+	if err != nil {
+		w.failed = true
+		return 0, fmt.Errorf("failed to stat table file %s: %w", w.tableName, err)
+	}
+
+	if IsCompressed(w.tableName) {
+		err = appendCompressed(w.tableName, w.file, line)
+	} else if err = appendLine(w.file, line); err != nil {
+		err = fmt.Errorf("failed to write row to %s: %w", w.tableName, err)
+	}
+	if err != nil {
+		return 0, w.rollback(before.Size(), err)
+	}
+
+	w.size += int64(len(line))
+	return offset, nil
+}
+
+// rollback truncates the file back to size after a failed append, so no
+// partial row is left at its tail, and returns the append's error
+func (w *tableWriter) rollback(size int64, err error) error {
+	if errors.Is(err, syscall.ENOSPC) || errors.Is(err, syscall.EDQUOT) || errors.Is(err, syscall.EFBIG) {
+		err = fmt.Errorf("%w: %w", ErrDiskFull, err)
+	}
+	if truncErr := w.file.Truncate(size); truncErr != nil {
+		// Part of the row may have stayed in the file; reopen to find the real size
+		w.failed = true
+		return fmt.Errorf("%w (and removing the partial row failed: %v)", err, truncErr)
+	}
+	return err
+}
+
+// mark opens the append handle if needed and returns the file size and log
+// size the next row goes at. The file size is -1 if it can't be told.
+func (w *tableWriter) mark() (int64, int64) {
+	if err := w.ready(); err != nil {
+		return -1, w.size
+	}
+	stat, err := w.file.Stat()
+	if err != nil {
+		return -1, w.size
+	}
+	return stat.Size(), w.size
+}
+
+// discard truncates away the rows of a batch whose sync failed. start is
+// the file size before the batch (-1 if unknown) and size the log size.
+func (w *tableWriter) discard(start, size int64, err error) error {
+	storageMutex.Lock()
+	defer storageMutex.Unlock()
+
+	if start < 0 || w.file == nil {
+		w.failed = true
+		return fmt.Errorf("%w (the unsynced rows may still be in the file)", err)
+	}
+	if truncErr := w.file.Truncate(start); truncErr != nil {
+		w.failed = true
+		return fmt.Errorf("%w (and removing the unsynced rows failed: %v)", err, truncErr)
+	}
+	w.size = size
+	return fmt.Errorf("%w; the rows were not written", err)
+}
+
+// ready makes sure the append handle is open, reopening it after a failure
+func (w *tableWriter) ready() error {
+	if w.failed {
+		w.closeFile()
+	}
+	if w.file == nil {
+		return w.open()
+	}
+	return nil
+}
+
+// open opens the append handle and works out where the next row goes
+func (w *tableWriter) open() error {
+	// Ensure data directory (and the schema's subdirectory) exists
+	filePath := tablePath(w.tableName, ".db")
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return fmt.Errorf("failed to create data directory: %w", err)
+	}
+	var file *os.File
+	err := retry(func() error {
+		var err error
+		file, err = os.OpenFile(filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to open table file %s: %w", w.tableName, err)
+	}
+
+	size, err := logSize(w.tableName, file)
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	w.file = file
+	w.size = size
+	return nil
+}
+
+// appendLine writes a plain row to the append handle; tests swap it to
+// inject failed writes
+var appendLine = func(file *os.File, line string) error { return writeFull(file, line) }
+
+// writeFull appends line, retrying transient errors from where the failed
+// attempt stopped so no part of the row is written twice
+func writeFull(file io.StringWriter, line string) error {
+	return retry(func() error {
+		n, err := file.WriteString(line)
+		line = line[n:]
+		return err
+	})
+}
+
+// closeFile closes the append handle, if open
+func (w *tableWriter) closeFile() {
+	if w.file != nil {
+		w.file.Close()
+		w.file = nil
+	}
+	w.failed = false
+}
+
+// logSize returns the size of a table's log: the file size for plain tables,
+// the decompressed size for compressed ones
+func logSize(tableName string, file *os.File) (int64, error) {
+	if !IsCompressed(tableName) {
+		stat, err := file.Stat()
+		if err != nil {
+			return 0, fmt.Errorf("failed to stat file %s: %w", tableName, err)
+		}
+		return stat.Size(), nil
+	}
+
+	reader, err := OpenTableFile(tableName)
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+
+	size, err := io.Copy(io.Discard, reader)
+	if err != nil {
+		return 0, fmt.Errorf("failed to decompress table file %s: %w", tableName, err)
+	}
+	return size, nil
+}
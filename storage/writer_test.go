@@ -0,0 +1,206 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"sync"
+	"syscall"
+	"testing"
+)
+
+// newTestTable points storage at a temporary data directory holding an
+// empty table file t, with the given sync policy
+func newTestTable(t testing.TB, policy SyncPolicy) {
+	t.Helper()
+	if err := SetDataDir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(CloseWriters)
+	if err := SetSyncPolicy(policy); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { SetSyncPolicy(SyncPolicy{Mode: SyncEveryWrite}) })
+	if err := CreateTableFile("t"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// tableSize returns the size of table t's file
+func tableSize(t *testing.T) int64 {
+	t.Helper()
+	info, err := os.Stat(tablePath("t", ".db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info.Size()
+}
+
+// TestAppendRowSyncFailure checks that a row whose fsync failed is removed
+// again, so a retry of the insert isn't turned away as a duplicate after a
+// restart, and that offsets still point at the rows written
+func TestAppendRowSyncFailure(t *testing.T) {
+	newTestTable(t, SyncPolicy{Mode: SyncEveryWrite})
+	errSync := errors.New("injected fsync failure")
+	t.Cleanup(func() { fsync = (*os.File).Sync })
+
+	first := []string{"1", "1", "alice"}
+	if _, err := AppendRow("t", first); err != nil {
+		t.Fatal(err)
+	}
+	size := tableSize(t)
+
+	fsync = func(*os.File) error { return errSync }
+	if _, err := AppendRow("t", []string{"2", "1", "bob"}); !errors.Is(err, errSync) {
+		t.Fatalf("append with a failing fsync: got %v, want the sync error", err)
+	}
+	if got := tableSize(t); got != size {
+		t.Errorf("file is %d bytes after the failed sync, want %d", got, size)
+	}
+
+	fsync = (*os.File).Sync
+	retried := []string{"2", "1", "bob"}
+	offset, err := AppendRow("t", retried)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offset != size {
+		t.Errorf("retried row at offset %d, want %d", offset, size)
+	}
+	for at, want := range map[int64][]string{0: first, offset: retried} {
+		if row, err := ReadRow("t", at); err != nil || !reflect.DeepEqual(row, want) {
+			t.Errorf("ReadRow(%d) = %v, %v; want %v", at, row, err, want)
+		}
+	}
+}
+
+// TestAppendRowPartialWrite fails an append part-way through the row and
+// checks that the partial row is cut off and a full disk is reported
+func TestAppendRowPartialWrite(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		diskFull bool
+	}{
+		{"no space", syscall.ENOSPC, true},
+		{"quota", syscall.EDQUOT, true},
+		{"too large", syscall.EFBIG, true},
+		{"I/O error", syscall.EIO, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newTestTable(t, SyncPolicy{Mode: SyncNone})
+			write := appendLine
+			t.Cleanup(func() { appendLine = write })
+
+			if _, err := AppendRow("t", []string{"1", "1", "alice"}); err != nil {
+				t.Fatal(err)
+			}
+			size := tableSize(t)
+
+			appendLine = func(file *os.File, line string) error {
+				if _, err := file.WriteString(line[:len(line)/2]); err != nil {
+					return err
+				}
+				return tt.err
+			}
+			_, err := AppendRow("t", []string{"2", "1", "bob"})
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got %v, want %v", err, tt.err)
+			}
+			if got := errors.Is(err, ErrDiskFull); got != tt.diskFull {
+				t.Errorf("errors.Is(%v, ErrDiskFull) = %v, want %v", err, got, tt.diskFull)
+			}
+			if got := tableSize(t); got != size {
+				t.Errorf("file is %d bytes after the failed append, want %d", got, size)
+			}
+
+			appendLine = write
+			row := []string{"2", "1", "bob"}
+			offset, err := AppendRow("t", row)
+			if err != nil {
+				t.Fatalf("append after the failure: %v", err)
+			}
+			if got, err := ReadRow("t", offset); offset != size || err != nil || !reflect.DeepEqual(got, row) {
+				t.Errorf("next row at %d = %v, %v; want %v at %d", offset, got, err, row, size)
+			}
+		})
+	}
+}
+
+// TestAppendRowConcurrent appends from many goroutines at once: every row
+// gets its own offset and reads back from it
+func TestAppendRowConcurrent(t *testing.T) {
+	for _, format := range []RecordFormat{FormatText, FormatBinary} {
+		t.Run(string(format), func(t *testing.T) {
+			newTestTable(t, SyncPolicy{Mode: SyncNone})
+			SetFormat("t", format)
+			t.Cleanup(func() { SetFormat("t", FormatText) })
+
+			const writers, rows = 16, 50
+			offsets := make([][]int64, writers)
+			var wg sync.WaitGroup
+			for w := 0; w < writers; w++ {
+				wg.Add(1)
+				go func(w int) {
+					defer wg.Done()
+					for i := 0; i < rows; i++ {
+						offset, err := AppendRow("t", []string{fmt.Sprintf("%d-%d", w, i), "1", "x"})
+						if err != nil {
+							t.Error(err)
+							return
+						}
+						offsets[w] = append(offsets[w], offset)
+					}
+				}(w)
+			}
+			wg.Wait()
+
+			seen := make(map[int64]string)
+			for w := range offsets {
+				for i, offset := range offsets[w] {
+					id := fmt.Sprintf("%d-%d", w, i)
+					if other, dup := seen[offset]; dup {
+						t.Fatalf("rows %s and %s both at offset %d", other, id, offset)
+					}
+					seen[offset] = id
+					row, err := ReadRow("t", offset)
+					if err != nil || row[0] != id {
+						t.Errorf("ReadRow(%d) = %v, %v; want row %s", offset, row, err, id)
+					}
+				}
+			}
+			if len(seen) != writers*rows {
+				t.Errorf("%d rows written, want %d", len(seen), writers*rows)
+			}
+		})
+	}
+}
+
+// BenchmarkAppendRowParallel appends from parallel goroutines through the
+// table's writer, with fsync off and with an fsync per batch
+func BenchmarkAppendRowParallel(b *testing.B) {
+	for _, p := range []struct {
+		name   string
+		policy SyncPolicy
+	}{
+		{"no sync", SyncPolicy{Mode: SyncNone}},
+		{"sync", SyncPolicy{Mode: SyncEveryWrite}},
+	} {
+		b.Run(p.name, func(b *testing.B) {
+			newTestTable(b, p.policy)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for i := 0; pb.Next(); i++ {
+					if _, err := AppendRow("t", []string{strconv.Itoa(i), "1", "Starbucks", "550"}); err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
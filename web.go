@@ -0,0 +1,35 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"net/http"
+	"os"
+	"time"
+)
+
+// webFS holds the web interface compiled into the binary, so the UI works
+// from any working directory and in containers without a web/ directory
+//
+//go:embed web
+var webFS embed.FS
+
+// indexPath is the on-disk copy of the UI; when present it takes precedence
+// over the embedded one, so the page can be edited without rebuilding
+const indexPath = "web/index.html"
+
+// serveIndex writes the web interface, from disk if web/ exists and from the
+// embedded copy otherwise
+func serveIndex(w http.ResponseWriter, r *http.Request) {
+	if info, err := os.Stat(indexPath); err == nil && !info.IsDir() {
+		http.ServeFile(w, r, indexPath)
+		return
+	}
+
+	page, err := webFS.ReadFile(indexPath)
+	if err != nil {
+		http.Error(w, "web interface not available", http.StatusInternalServerError)
+		return
+	}
+	http.ServeContent(w, r, "index.html", time.Time{}, bytes.NewReader(page))
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIndexWithoutWebDirectory(t *testing.T) {
+	embedded, err := webFS.ReadFile(indexPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		setup func(t *testing.T, dir string) // prepares the working directory
+		want  string
+	}{
+		{"no web directory", func(*testing.T, string) {}, string(embedded)},
+		{"web directory without the page", func(t *testing.T, dir string) {
+			if err := os.Mkdir(filepath.Join(dir, "web"), 0755); err != nil {
+				t.Fatal(err)
+			}
+		}, string(embedded)},
+		{"edited page on disk", func(t *testing.T, dir string) {
+			if err := os.MkdirAll(filepath.Join(dir, "web"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(dir, indexPath), []byte("<html>edited</html>"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}, "<html>edited</html>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			tt.setup(t, dir)
+			chdir(t, dir)
+
+			rec := httptest.NewRecorder()
+			(&Server{}).handleIndex(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status %d, want 200", rec.Code)
+			}
+			if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+				t.Errorf("Content-Type = %q, want text/html", ct)
+			}
+			if rec.Body.String() != tt.want {
+				t.Errorf("served %.60q..., want %.60q...", rec.Body.String(), tt.want)
+			}
+		})
+	}
+}
+
+// chdir switches the working directory for the rest of the test
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	previous, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := os.Chdir(previous); err != nil {
+			t.Fatal(err)
+		}
+	})
+}